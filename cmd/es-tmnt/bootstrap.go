@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"es-tmnt/pkg/config"
+	"es-tmnt/pkg/proxy"
+)
+
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*f = append(*f, item)
+		}
+	}
+	return nil
+}
+
+// parseBootstrapArgs parses the bootstrap subcommand flags into a plan. Mapping
+// files are given as base=path and hold an index create body as tenants see it.
+func parseBootstrapArgs(args []string, output io.Writer) (proxy.BootstrapPlan, error) {
+	var indices, mappings stringListFlag
+	flags := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.Var(&indices, "index", "tenant index to prepare, e.g. products-tenant1 (repeatable, comma separated)")
+	flags.Var(&mappings, "mapping", "index create body for a base index as base=path (repeatable)")
+	backfill := flags.Bool("backfill", false, "reindex documents from existing indices named like -index into their target")
+	if err := flags.Parse(args); err != nil {
+		return proxy.BootstrapPlan{}, err
+	}
+	if flags.NArg() != 0 {
+		return proxy.BootstrapPlan{}, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if len(indices) == 0 {
+		return proxy.BootstrapPlan{}, errors.New("at least one -index is required")
+	}
+	plan := proxy.BootstrapPlan{
+		Indices:  indices,
+		Mappings: make(map[string][]byte, len(mappings)),
+		Backfill: *backfill,
+	}
+	for _, entry := range mappings {
+		baseIndex, path, ok := strings.Cut(entry, "=")
+		if !ok || baseIndex == "" || path == "" {
+			return proxy.BootstrapPlan{}, fmt.Errorf("invalid -mapping %q, expected base=path", entry)
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return proxy.BootstrapPlan{}, fmt.Errorf("read mapping for %s: %w", baseIndex, err)
+		}
+		plan.Mappings[baseIndex] = body
+	}
+	return plan, nil
+}
+
+func runBootstrap(args []string) error {
+	plan, err := parseBootstrapArgs(args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	service, err := proxy.New(cfg)
+	if err != nil {
+		return fmt.Errorf("proxy init error: %w", err)
+	}
+	return service.Bootstrap(context.Background(), plan)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseBootstrapArgs(t *testing.T) {
+	dir := t.TempDir()
+	mappingPath := filepath.Join(dir, "products.json")
+	if err := os.WriteFile(mappingPath, []byte(`{"mappings":{"properties":{"name":{"type":"text"}}}}`), 0o600); err != nil {
+		t.Fatalf("write mapping: %v", err)
+	}
+
+	plan, err := parseBootstrapArgs([]string{
+		"-index", "products-tenant1,products-tenant2",
+		"-index", "orders-tenant1",
+		"-mapping", "products=" + mappingPath,
+		"-backfill",
+	}, io.Discard)
+	if err != nil {
+		t.Fatalf("parse args: %v", err)
+	}
+	if strings.Join(plan.Indices, ",") != "products-tenant1,products-tenant2,orders-tenant1" {
+		t.Fatalf("unexpected indices: %v", plan.Indices)
+	}
+	if !strings.Contains(string(plan.Mappings["products"]), `"name"`) {
+		t.Fatalf("expected products mapping loaded, got %v", plan.Mappings)
+	}
+	if !plan.Backfill {
+		t.Fatalf("expected backfill enabled")
+	}
+}
+
+func TestParseBootstrapArgsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "missing index", args: nil, wantErr: "at least one -index is required"},
+		{name: "invalid mapping", args: []string{"-index", "products-tenant1", "-mapping", "products"}, wantErr: "expected base=path"},
+		{name: "missing mapping file", args: []string{"-index", "products-tenant1", "-mapping", "products=/does/not/exist.json"}, wantErr: "read mapping for products"},
+		{name: "extra arguments", args: []string{"-index", "products-tenant1", "extra"}, wantErr: "unexpected arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseBootstrapArgs(tt.args, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
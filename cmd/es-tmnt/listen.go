@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"es-tmnt/pkg/config"
+)
+
+// listenFDsStart is the first file descriptor systemd passes with socket
+// activation.
+const listenFDsStart = 3
+
+// proxyListeners opens the listeners of the proxy handler: ports.http, unless
+// it is 0, and the configured listeners. Listeners opened before a failure are
+// closed.
+func proxyListeners(cfg config.Config) ([]net.Listener, error) {
+	var listeners []net.Listener
+	var activated []*os.File
+	fail := func(err error) ([]net.Listener, error) {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		for _, file := range activated {
+			file.Close()
+		}
+		return nil, err
+	}
+	if cfg.Ports.HTTP > 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Ports.HTTP))
+		if err != nil {
+			return fail(err)
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, spec := range cfg.Listeners {
+		switch strings.ToLower(strings.TrimSpace(spec.Type)) {
+		case "tcp":
+			listener, err := net.Listen("tcp", spec.Address)
+			if err != nil {
+				return fail(err)
+			}
+			listeners = append(listeners, listener)
+		case "unix":
+			listener, err := listenUnix(spec.Path, spec.Mode)
+			if err != nil {
+				return fail(err)
+			}
+			listeners = append(listeners, listener)
+		case "systemd":
+			if activated == nil {
+				var err error
+				if activated, err = systemdFiles(); err != nil {
+					return fail(err)
+				}
+			}
+			matched := 0
+			for _, file := range activated {
+				if spec.Name != "" && file.Name() != spec.Name {
+					continue
+				}
+				listener, err := net.FileListener(file)
+				if err != nil {
+					return fail(fmt.Errorf("systemd socket %s: %w", file.Name(), err))
+				}
+				listeners = append(listeners, listener)
+				matched++
+			}
+			if matched == 0 {
+				return fail(fmt.Errorf("no systemd socket named %q was passed", spec.Name))
+			}
+		default:
+			return fail(fmt.Errorf("unknown listener type %q", spec.Type))
+		}
+	}
+	for _, file := range activated {
+		file.Close()
+	}
+	return listeners, nil
+}
+
+// adminListener opens ports.admin, serving TLS when admin.tls_cert_path is
+// set. Client certificates are verified against admin.client_ca_path when
+// given but not required, so load balancers can probe /healthz and /readyz
+// without one.
+func adminListener(cfg config.Config) (net.Listener, error) {
+	tlsConfig, err := adminTLSConfig(cfg.Admin)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Ports.Admin))
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	return listener, nil
+}
+
+func adminTLSConfig(admin config.Admin) (*tls.Config, error) {
+	if admin.TLSCertPath == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(admin.TLSCertPath, admin.TLSKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("admin tls certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if admin.ClientCAPath != "" {
+		pem, err := os.ReadFile(admin.ClientCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("admin client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("admin client ca: no certificates in %s", admin.ClientCAPath)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// listenUnix creates a Unix socket at path, replacing a socket left behind by
+// a previous run. With an octal mode, the socket is bound in a private
+// directory next to path, given the mode there, and then moved to path, so it
+// is never reachable with the looser default mode.
+func listenUnix(path, mode string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("unix socket %s: file exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("unix socket %s: remove stale socket: %w", path, err)
+		}
+	}
+	if mode == "" {
+		return net.Listen("unix", path)
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unix socket %s: set mode %s: %w", path, mode, err)
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".es-tmnt-")
+	if err != nil {
+		return nil, fmt.Errorf("unix socket %s: %w", path, err)
+	}
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, "sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: private, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(private, fs.FileMode(perm)); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unix socket %s: set mode %s: %w", path, mode, err)
+	}
+	if err := os.Rename(private, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unix socket %s: %w", path, err)
+	}
+	return &movedUnixListener{UnixListener: listener, path: path}, nil
+}
+
+// movedUnixListener serves a Unix socket that was moved to path after it was
+// bound. It reports path as its address and removes the socket there when
+// closed, as net.UnixListener does for the path it bound.
+type movedUnixListener struct {
+	*net.UnixListener
+	path  string
+	close sync.Once
+}
+
+func (l *movedUnixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *movedUnixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.close.Do(func() { os.Remove(l.path) })
+	return err
+}
+
+// systemdFiles returns the sockets systemd passed with socket activation,
+// named by LISTEN_FDNAMES, and unsets the activation variables so child
+// processes do not take the sockets too.
+func systemdFiles() ([]*os.File, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no systemd sockets were passed to this process")
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, errors.New("no systemd sockets were passed to this process")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	files := make([]*os.File, 0, count)
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files = append(files, os.NewFile(uintptr(listenFDsStart+i), name))
+	}
+	return files, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestProxyListeners(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "es-tmnt.sock")
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not available: %v", err)
+	}
+	// Leave the socket file behind, as a crashed process would.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	cfg := config.Default()
+	cfg.Ports.HTTP = 0
+	cfg.Listeners = []config.Listener{
+		{Type: "unix", Path: socket, Mode: "0600"},
+		{Type: "tcp", Address: "127.0.0.1:0"},
+	}
+	listeners, err := proxyListeners(cfg)
+	if err != nil {
+		t.Fatalf("open listeners: %v", err)
+	}
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+	if len(listeners) != 2 || listeners[0].Addr().Network() != "unix" || listeners[1].Addr().Network() != "tcp" {
+		t.Fatalf("unexpected listeners %v", listeners)
+	}
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected socket mode 0600, got %o", perm)
+	}
+	if addr := listeners[0].Addr().String(); addr != socket {
+		t.Fatalf("expected socket address %s, got %s", socket, addr)
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("dial socket: %v", err)
+	}
+	conn.Close()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read socket dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the socket in %s, got %d entries", dir, len(entries))
+	}
+	listeners[0].Close()
+	if _, err := os.Lstat(socket); !os.IsNotExist(err) {
+		t.Fatalf("expected the socket to be removed on close, got %v", err)
+	}
+}
+
+func TestProxyListenersErrors(t *testing.T) {
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "not-a-socket")
+	if err := os.WriteFile(regular, []byte("data"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	t.Setenv("LISTEN_PID", "")
+	tests := []struct {
+		name     string
+		listener config.Listener
+		wantErr  string
+	}{
+		{name: "regular file", listener: config.Listener{Type: "unix", Path: regular}, wantErr: "is not a socket"},
+		{name: "no systemd sockets", listener: config.Listener{Type: "systemd"}, wantErr: "no systemd sockets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Ports.HTTP = 0
+			cfg.Listeners = []config.Listener{{Type: "tcp", Address: "127.0.0.1:0"}, tt.listener}
+			if _, err := proxyListeners(cfg); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+	if _, err := os.Stat(regular); err != nil {
+		t.Fatalf("expected the regular file to be left alone: %v", err)
+	}
+}
+
+func TestAdminTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCertificate(t, dir)
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	tlsConfig, err := adminTLSConfig(config.Admin{})
+	if err != nil || tlsConfig != nil {
+		t.Fatalf("expected no tls without a certificate, got %v, %v", tlsConfig, err)
+	}
+	tlsConfig, err = adminTLSConfig(config.Admin{TLSCertPath: certPath, TLSKeyPath: keyPath})
+	if err != nil || len(tlsConfig.Certificates) != 1 || tlsConfig.ClientAuth != tls.NoClientCert {
+		t.Fatalf("unexpected tls config %+v, %v", tlsConfig, err)
+	}
+	tlsConfig, err = adminTLSConfig(config.Admin{TLSCertPath: certPath, TLSKeyPath: keyPath, ClientCAPath: certPath})
+	if err != nil || tlsConfig.ClientAuth != tls.VerifyClientCertIfGiven || tlsConfig.ClientCAs == nil {
+		t.Fatalf("unexpected mtls config %+v, %v", tlsConfig, err)
+	}
+	if _, err := adminTLSConfig(config.Admin{TLSCertPath: certPath, TLSKeyPath: keyPath, ClientCAPath: empty}); err == nil || !strings.Contains(err.Error(), "no certificates") {
+		t.Fatalf("expected an empty client ca error, got %v", err)
+	}
+	if _, err := adminTLSConfig(config.Admin{TLSCertPath: empty, TLSKeyPath: keyPath}); err == nil {
+		t.Fatalf("expected a certificate error")
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate and its key to dir.
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "es-tmnt test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certPath, keyPath
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"es-tmnt/internal/config"
-	"es-tmnt/internal/proxy"
+	"es-tmnt/pkg/config"
+	"es-tmnt/pkg/proxy"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap" {
+		if err := runBootstrap(os.Args[2:]); err != nil {
+			log.Fatalf("bootstrap error: %v", err)
+		}
+		return
+	}
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("config error: %v", err)
@@ -18,9 +30,57 @@ func main() {
 	if err != nil {
 		log.Fatalf("proxy init error: %v", err)
 	}
-	address := fmt.Sprintf(":%d", cfg.Ports.HTTP)
-	log.Printf("starting proxy on %s", address)
-	if err := http.ListenAndServe(address, service); err != nil {
+	listeners, err := proxyListeners(cfg)
+	if err != nil {
+		log.Fatalf("listen error: %v", err)
+	}
+	errs := make(chan error, len(listeners)+1)
+	servers := []*http.Server{serve("proxy", service, listeners, errs)}
+	if cfg.Ports.Admin > 0 {
+		listener, err := adminListener(cfg)
+		if err != nil {
+			log.Fatalf("listen error: admin server: %v", err)
+		}
+		servers = append(servers, serve("admin server", service.AdminHandler(), []net.Listener{listener}, errs))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-errs:
 		log.Fatalf("server error: %v", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	timeout := cfg.Shutdown.DrainTimeout()
+	log.Printf("shutting down, draining in-flight requests for up to %s", timeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := service.Drain(drainCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	for _, server := range servers {
+		if err := server.Shutdown(drainCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}
+	if err := service.Close(); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+}
+
+// serve starts an HTTP server on listeners in the background, reporting
+// failures other than a shutdown on errs.
+func serve(name string, handler http.Handler, listeners []net.Listener, errs chan<- error) *http.Server {
+	server := &http.Server{Handler: handler}
+	for _, listener := range listeners {
+		log.Printf("starting %s on %s %s", name, listener.Addr().Network(), listener.Addr())
+		go func(listener net.Listener) {
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("%s: %w", name, err)
+			}
+		}(listener)
 	}
+	return server
 }
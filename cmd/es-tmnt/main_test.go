@@ -10,10 +10,10 @@ func TestMainFunction(t *testing.T) {
 	// But we can test that the imports and basic setup work
 	
 	// Test that config package is importable
-	_ = "es-tmnt/internal/config"
+	_ = "es-tmnt/pkg/config"
 	
 	// Test that proxy package is importable  
-	_ = "es-tmnt/internal/proxy"
+	_ = "es-tmnt/pkg/proxy"
 	
 	// Test that standard library imports work
 	_ = "fmt"
@@ -0,0 +1,715 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Ports              Ports                     `yaml:"ports"`
+	Listeners          []Listener                `yaml:"listeners"`
+	Admin              Admin                     `yaml:"admin"`
+	UpstreamURL        string                    `yaml:"upstream_url"`
+	Mode               string                    `yaml:"mode"`
+	Verbose            bool                      `yaml:"verbose"`
+	BodyPreview        BodyPreview               `yaml:"body_preview"`
+	Rewriter           string                    `yaml:"rewriter"`
+	ErrorFormat        string                    `yaml:"error_format"`
+	TenantRegex        TenantRegex               `yaml:"tenant_regex"`
+	SharedIndex        SharedIndex               `yaml:"shared_index"`
+	IndexPerTenant     IndexPerTenant            `yaml:"index_per_tenant"`
+	PassthroughPaths   []string                  `yaml:"passthrough_paths"`
+	Auth               Auth                      `yaml:"auth"`
+	Audit              Audit                     `yaml:"audit"`
+	Cat                Cat                       `yaml:"cat"`
+	Limits             Limits                    `yaml:"limits"`
+	Usage              Usage                     `yaml:"usage"`
+	SlowLog            SlowLog                   `yaml:"slow_log"`
+	Shutdown           Shutdown                  `yaml:"shutdown"`
+	Lifecycle          Lifecycle                 `yaml:"lifecycle"`
+	Scripts            Scripts                   `yaml:"scripts"`
+	Tasks              Tasks                     `yaml:"tasks"`
+	Ingest             Ingest                    `yaml:"ingest"`
+	Freeze             Freeze                    `yaml:"freeze"`
+	ResponseCache      ResponseCache             `yaml:"response_cache"`
+	State              State                     `yaml:"state"`
+	Timeouts           Timeouts                  `yaml:"timeouts"`
+	TenantResolver     TenantResolver            `yaml:"tenant_resolver"`
+	RootInfo           RootInfo                  `yaml:"root_info"`
+	UnknownPaths       UnknownPaths              `yaml:"unknown_paths"`
+	ModeOverride       ModeOverride              `yaml:"mode_override"`
+	Migration          Migration                 `yaml:"migration"`
+	Shadow             Shadow                    `yaml:"shadow"`
+	IndexNames         IndexNames                `yaml:"index_names"`
+	ReservedTenants    []string                  `yaml:"reserved_tenants"`
+	Faults             Faults                    `yaml:"faults"`
+	Bulk               Bulk                      `yaml:"bulk"`
+	ResponseHeaders    ResponseHeaders           `yaml:"response_headers"`
+	APIKeys            APIKeys                   `yaml:"api_keys"`
+	Permissions        Permissions               `yaml:"permissions"`
+	NetworkPolicy      NetworkPolicy             `yaml:"network_policy"`
+	TrustedProxies     []string                  `yaml:"trusted_proxies"`
+	TrustedProxyHeader string                    `yaml:"trusted_proxy_header"`
+	Upstreams          []Upstream                `yaml:"upstreams"`
+	Tenants            map[string]TenantSettings `yaml:"tenants"`
+}
+
+type Ports struct {
+	HTTP  int `yaml:"http"`
+	Admin int `yaml:"admin"`
+}
+
+// BodyPreview logs the first MaxBytes bytes of each rewritten request body as
+// it is sent upstream, masking the values of fields whose names match
+// RedactPattern so that rewrites can be debugged without logging personal
+// data.
+type BodyPreview struct {
+	Enabled       bool   `yaml:"enabled"`
+	MaxBytes      int    `yaml:"max_bytes"`
+	RedactPattern string `yaml:"redact_pattern"`
+}
+
+// Admin secures the admin port. /healthz and /readyz are always open; the
+// control endpoints under /admin require Token as a bearer token or, with
+// ClientCAPath, a client certificate signed by that CA, when either is set.
+// TLSCertPath and TLSKeyPath serve the admin port over TLS, which client
+// certificates require. ReadinessTimeoutSeconds bounds each upstream probe of
+// /readyz. Diagnostics serves pprof profiles, runtime statistics, and a
+// goroutine dump among the control endpoints.
+type Admin struct {
+	Token                   string `yaml:"token"`
+	TLSCertPath             string `yaml:"tls_cert_path"`
+	TLSKeyPath              string `yaml:"tls_key_path"`
+	ClientCAPath            string `yaml:"client_ca_path"`
+	ReadinessTimeoutSeconds int    `yaml:"readiness_timeout_seconds"`
+	Diagnostics             bool   `yaml:"diagnostics"`
+}
+
+// Listener is an address the proxy accepts requests on besides ports.http,
+// which may be 0 to listen on listeners only. Type "tcp" listens on Address,
+// such as "127.0.0.1:9200"; "unix" creates a Unix socket at Path, with the
+// octal permissions Mode, such as "0660"; and "systemd" takes the sockets
+// systemd passed with socket activation, all of them or those whose
+// FileDescriptorName is Name.
+type Listener struct {
+	Type    string `yaml:"type"`
+	Address string `yaml:"address"`
+	Path    string `yaml:"path"`
+	Mode    string `yaml:"mode"`
+	Name    string `yaml:"name"`
+}
+
+// ParseListener parses the type:value form listeners take in
+// ES_TMNT_LISTENERS, such as "unix:/run/es-tmnt.sock", "systemd",
+// "systemd:es-tmnt", or "tcp:127.0.0.1:9200".
+func ParseListener(spec string) Listener {
+	kind, value, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	listener := Listener{Type: strings.ToLower(kind)}
+	switch listener.Type {
+	case "tcp":
+		listener.Address = value
+	case "unix":
+		listener.Path = value
+	case "systemd":
+		listener.Name = value
+	}
+	return listener
+}
+
+type TenantRegex struct {
+	Pattern  string         `yaml:"pattern"`
+	Compiled *regexp.Regexp `yaml:"-"`
+}
+
+// SharedIndex configures shared mode. FieldManifestPath optionally names a JSON
+// file mapping tenant IDs to the fields _field_caps may report to them.
+type SharedIndex struct {
+	Name              string           `yaml:"name"`
+	AliasTemplate     string           `yaml:"alias_template"`
+	TenantField       string           `yaml:"tenant_field"`
+	EnforceFilter     bool             `yaml:"enforce_filter"`
+	RouteByTenant     bool             `yaml:"route_by_tenant"`
+	DenyPatterns      []string         `yaml:"deny_patterns"`
+	DenyCompiled      []*regexp.Regexp `yaml:"-"`
+	Groups            []SharedGroup    `yaml:"groups"`
+	FieldManifestPath string           `yaml:"field_manifest_path"`
+}
+
+// SharedGroup stores the base indices matching Pattern, a glob such as logs-*,
+// in their own shared index. Empty alias templates and tenant fields fall back
+// to the shared_index settings.
+type SharedGroup struct {
+	Pattern       string `yaml:"pattern"`
+	Name          string `yaml:"name"`
+	AliasTemplate string `yaml:"alias_template"`
+	TenantField   string `yaml:"tenant_field"`
+}
+
+// IndexPerTenant configures index-per-tenant mode. Documents are nested under
+// their base index and query fields prefixed with it unless WrapSource is set to
+// false, which only renames indices. With AutoCreate, the first write of a
+// tenant creates its index from the create body in CreateTemplatePath, a JSON
+// file with settings and mappings as tenants see them.
+type IndexPerTenant struct {
+	IndexTemplate      string   `yaml:"index_template"`
+	PercolatorFields   []string `yaml:"percolator_fields"`
+	SkipFields         []string `yaml:"skip_fields"`
+	WrapSource         *bool    `yaml:"wrap_source"`
+	AutoCreate         bool     `yaml:"auto_create"`
+	CreateTemplatePath string   `yaml:"create_template_path"`
+}
+
+// SourceWrapped reports whether documents are nested under their base index,
+// which is the default when WrapSource is unset.
+func (i IndexPerTenant) SourceWrapped() bool {
+	return i.WrapSource == nil || *i.WrapSource
+}
+
+type Auth struct {
+	Required  bool      `yaml:"required"`
+	Header    string    `yaml:"header"`
+	BasicAuth BasicAuth `yaml:"basic_auth"`
+}
+
+// BasicAuth makes the proxy check basic auth credentials itself, answering 401
+// to requests without valid ones, and confines each user to a tenant: indices
+// of other tenants are rejected. Users come from Users and from the
+// htpasswd-style file at HtpasswdPath, whose lines are user:hash or
+// user:hash:tenant. Passwords are {SHA} or $apr1$ hashes, as written by
+// htpasswd -s and -m, or plain text prefixed with {PLAIN}. A user without a
+// tenant is the tenant of the same name.
+type BasicAuth struct {
+	Enabled      bool            `yaml:"enabled"`
+	Realm        string          `yaml:"realm"`
+	Users        []BasicAuthUser `yaml:"users"`
+	HtpasswdPath string          `yaml:"htpasswd_path"`
+}
+
+type BasicAuthUser struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Tenant   string `yaml:"tenant"`
+}
+
+// APIKeys lets clients authenticate with keys minted on the admin port, sent
+// as Authorization: ApiKey like Elasticsearch API keys. Each key is bound to a
+// tenant and grants the "read", "write", and "admin" permissions it was minted
+// with. Store "index" keeps the hashed keys in the upstream index Index and
+// "file" in the JSON file at Path.
+type APIKeys struct {
+	Enabled bool   `yaml:"enabled"`
+	Store   string `yaml:"store"`
+	Path    string `yaml:"path"`
+	Index   string `yaml:"index"`
+}
+
+// Permissions limits the operations tenants may perform: "search",
+// "index", "delete", "mapping_change", "index_create", "index_delete", and
+// "manage" for every other write. Tenants lists the operations of each
+// tenant; tenants not listed get Default, and an empty Default allows every
+// operation. A tenant listed without operations may perform none.
+type Permissions struct {
+	Default []string            `yaml:"default"`
+	Tenants map[string][]string `yaml:"tenants"`
+}
+
+// Operations are the operation names Permissions takes.
+var Operations = map[string]bool{
+	"search": true, "index": true, "delete": true, "mapping_change": true,
+	"index_create": true, "index_delete": true, "manage": true,
+}
+
+// NetworkPolicy confines tenants to the CIDR ranges Tenants lists for them;
+// tenants not listed may connect from anywhere. The client address is the peer
+// address of the connection, or the address trusted_proxies forwarded for.
+type NetworkPolicy struct {
+	Tenants map[string][]string `yaml:"tenants"`
+}
+
+// Upstream is an Elasticsearch cluster besides UpstreamURL. Tenants are routed
+// to it by naming it in their TenantSettings.
+type Upstream struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// TenantSettings overrides settings for one tenant. Upstream names the
+// Upstreams entry the tenant is routed to instead of UpstreamURL. Permissions
+// and Networks replace the tenant's entries in Permissions.Tenants and
+// NetworkPolicy.Tenants; an empty list denies every operation or address.
+// Fields left unset keep the global settings.
+type TenantSettings struct {
+	Upstream    string   `yaml:"upstream"`
+	Permissions []string `yaml:"permissions"`
+	Networks    []string `yaml:"networks"`
+}
+
+// TenantPermissions returns Permissions.Tenants with the permissions set in
+// Tenants applied over it.
+func (c Config) TenantPermissions() map[string][]string {
+	merged := make(map[string][]string, len(c.Permissions.Tenants))
+	for tenant, operations := range c.Permissions.Tenants {
+		merged[tenant] = operations
+	}
+	for tenant, settings := range c.Tenants {
+		if settings.Permissions != nil {
+			merged[tenant] = settings.Permissions
+		}
+	}
+	return merged
+}
+
+// TenantNetworks returns NetworkPolicy.Tenants with the networks set in
+// Tenants applied over it.
+func (c Config) TenantNetworks() map[string][]string {
+	merged := make(map[string][]string, len(c.NetworkPolicy.Tenants))
+	for tenant, ranges := range c.NetworkPolicy.Tenants {
+		merged[tenant] = ranges
+	}
+	for tenant, settings := range c.Tenants {
+		if settings.Networks != nil {
+			merged[tenant] = settings.Networks
+		}
+	}
+	return merged
+}
+
+// Audit configures the write audit trail. An empty sink disables auditing.
+type Audit struct {
+	Sink  string `yaml:"sink"`
+	Path  string `yaml:"path"`
+	Index string `yaml:"index"`
+}
+
+// Cat configures the tenant annotation of _cat responses. Rows are filtered to a
+// single tenant when the request carries TenantHeader. TenantScoped always
+// filters, taking the tenant only from the authenticated user and ignoring
+// TenantHeader, and rejects _cat requests that identify no tenant.
+type Cat struct {
+	TenantHeader string `yaml:"tenant_header"`
+	TenantScoped bool   `yaml:"tenant_scoped"`
+}
+
+// Limits caps request body sizes in bytes, and the size in bytes and number of
+// the NDJSON lines of _msearch bodies. Zero disables a limit.
+type Limits struct {
+	MaxBodyBytes            int64 `yaml:"max_body_bytes"`
+	MaxBulkBodyBytes        int64 `yaml:"max_bulk_body_bytes"`
+	MaxMultiSearchLineBytes int64 `yaml:"max_msearch_line_bytes"`
+	MaxMultiSearchLines     int   `yaml:"max_msearch_lines"`
+}
+
+// Usage configures where per-tenant usage counters are flushed. Counters are
+// always kept in memory; an empty sink only disables flushing.
+type Usage struct {
+	Sink                 string `yaml:"sink"`
+	Path                 string `yaml:"path"`
+	Index                string `yaml:"index"`
+	FlushIntervalSeconds int    `yaml:"flush_interval_seconds"`
+}
+
+// SlowLog logs upstream searches and bulk requests that take longer than their
+// threshold in milliseconds; a zero threshold disables logging for that kind.
+// Query selects how search bodies are logged: "full", "truncate" (to
+// MaxQueryBytes), "hash" (SHA-256), or "none". Recent is the number of slow
+// queries kept for the admin endpoint.
+type SlowLog struct {
+	SearchThresholdMs int    `yaml:"search_threshold_ms"`
+	BulkThresholdMs   int    `yaml:"bulk_threshold_ms"`
+	Query             string `yaml:"query"`
+	MaxQueryBytes     int    `yaml:"max_query_bytes"`
+	Recent            int    `yaml:"recent"`
+}
+
+// Shutdown configures how long in-flight requests may take to finish once the
+// process is asked to stop.
+type Shutdown struct {
+	DrainTimeoutSeconds int `yaml:"drain_timeout_seconds"`
+}
+
+// Lifecycle configures per-tenant namespacing of ILM and SLM policies. With
+// NamespacePolicies set, policy names are parsed with the tenant regex and
+// rendered from PolicyTemplate, and other _ilm and _slm endpoints are rejected.
+type Lifecycle struct {
+	NamespacePolicies bool   `yaml:"namespace_policies"`
+	PolicyTemplate    string `yaml:"policy_template"`
+}
+
+// Scripts configures per-tenant namespacing of stored scripts and search
+// templates. With NamespaceScripts set, script ids are parsed with the tenant
+// regex and rendered from ScriptTemplate on the _scripts endpoints and in the
+// id of search template requests.
+type Scripts struct {
+	NamespaceScripts bool   `yaml:"namespace_scripts"`
+	ScriptTemplate   string `yaml:"script_template"`
+}
+
+// Tasks configures per-tenant scoping of the _tasks API. With ScopeTasks set,
+// the proxy remembers the tasks that asynchronous by-query and reindex requests
+// start for each tenant, and only lets that tenant get or cancel them. The
+// caller's tenant is the tenant it authenticated as.
+type Tasks struct {
+	ScopeTasks bool `yaml:"scope_tasks"`
+}
+
+// Ingest configures how tenant pipeline ids, which follow the tenant regex like
+// index names, are rendered into the ids stored upstream.
+type Ingest struct {
+	PipelineTemplate string `yaml:"pipeline_template"`
+}
+
+const defaultPipelineTemplate = "{{.tenant}}-{{.index}}"
+
+// Template returns the pipeline template, using the default when it is unset.
+func (i Ingest) Template() string {
+	if strings.TrimSpace(i.PipelineTemplate) == "" {
+		return defaultPipelineTemplate
+	}
+	return i.PipelineTemplate
+}
+
+// Freeze rejects every write while reads keep working, for cluster maintenance
+// and reindex windows. Writes starts the proxy frozen; the admin endpoint
+// toggles the freeze at runtime. Message is returned to rejected clients.
+type Freeze struct {
+	Writes  bool   `yaml:"writes"`
+	Message string `yaml:"message"`
+}
+
+const defaultFreezeMessage = "writes are frozen for cluster maintenance"
+
+// Reason returns the freeze message, using the default when it is unset.
+func (f Freeze) Reason() string {
+	if strings.TrimSpace(f.Message) == "" {
+		return defaultFreezeMessage
+	}
+	return f.Message
+}
+
+// ResponseCache caches the responses of GET _search and _count requests in
+// memory, per tenant. Zero MaxEntries disables the cache. MaxBytes caps the
+// cached body bytes, zero meaning no cap, and TTLSeconds is how long a cached
+// response is served.
+type ResponseCache struct {
+	MaxEntries int   `yaml:"max_entries"`
+	MaxBytes   int64 `yaml:"max_bytes"`
+	TTLSeconds int   `yaml:"ttl_seconds"`
+}
+
+// State selects where state that proxy replicas must share, such as the tenants
+// of async EQL searches, is kept. An empty or "memory" store keeps it in each
+// instance; "redis" keeps it in the Redis server at RedisURL, under keys
+// starting with KeyPrefix.
+type State struct {
+	Store     string `yaml:"store"`
+	RedisURL  string `yaml:"redis_url"`
+	KeyPrefix string `yaml:"key_prefix"`
+}
+
+// Timeouts bounds how long the upstream may take to answer a request, in
+// seconds, per kind of route: searches and other reads, bulk and by-query
+// writes, passthrough paths, and every other request. Zero means no deadline.
+type Timeouts struct {
+	SearchSeconds      int `yaml:"search_seconds"`
+	BulkSeconds        int `yaml:"bulk_seconds"`
+	PassthroughSeconds int `yaml:"passthrough_seconds"`
+	DefaultSeconds     int `yaml:"default_seconds"`
+}
+
+// TenantResolver selects how the tenant of a request is found. "regex", the
+// default, parses it from every index name with TenantRegex. "header" reads it
+// from Header, "jwt" from Claim of the bearer token in the Authorization
+// header, verified with JWTSecret (HMAC) or the RSA public key in the PEM file
+// JWTPublicKeyPath, and "basic_auth" uses the basic auth user name. With the
+// last three, index names in requests are base indices.
+type TenantResolver struct {
+	Type             string `yaml:"type"`
+	Header           string `yaml:"header"`
+	Claim            string `yaml:"claim"`
+	JWTSecret        string `yaml:"jwt_secret"`
+	JWTPublicKeyPath string `yaml:"jwt_public_key_path"`
+}
+
+// RootInfo controls GET and HEAD /, which clients call to check the product and
+// version of the cluster. By default the upstream answers; with Synthesize the
+// proxy answers itself with ClusterName and Version.
+type RootInfo struct {
+	Synthesize  bool   `yaml:"synthesize"`
+	ClusterName string `yaml:"cluster_name"`
+	Version     string `yaml:"version"`
+}
+
+// UnknownPaths controls requests to paths no endpoint of the proxy handles.
+// Action "reject", the default, answers them with an unsupported_request error;
+// "passthrough" forwards them to the upstream unchanged; and "not_found"
+// answers a bare 404. Paths in Ignore, such as /favicon.ico, are answered with
+// a bare 404 before they are logged; a trailing * matches a prefix.
+type UnknownPaths struct {
+	Action string   `yaml:"action"`
+	Ignore []string `yaml:"ignore"`
+}
+
+// ModeOverride lets a request choose the mode it is served in with the Header
+// header, such as X-ES-TMNT-Mode: index-per-tenant, so operators can canary a
+// tenant migration through the same instance. It is off unless Enabled. When
+// Token is set, requests must also send it in TokenHeader.
+type ModeOverride struct {
+	Enabled     bool   `yaml:"enabled"`
+	Header      string `yaml:"header"`
+	Token       string `yaml:"token"`
+	TokenHeader string `yaml:"token_header"`
+}
+
+// Migration moves the tenants in Tenants between the two modes without
+// downtime. Their reads are served in Primary, "shared" or "index-per-tenant"
+// and Mode when empty, and their writes in both modes, logging the writes whose
+// responses diverge. Other tenants are served in Mode.
+type Migration struct {
+	Tenants []string `yaml:"tenants"`
+	Primary string   `yaml:"primary"`
+}
+
+// Shadow copies Percent percent of the rewritten requests to the cluster at
+// UpstreamURL, such as one running a newer Elasticsearch version. The copies
+// are sent in the background and their responses discarded, recording how
+// their status and latency differ from the upstream's. An empty UpstreamURL
+// disables shadowing.
+type Shadow struct {
+	UpstreamURL string `yaml:"upstream_url"`
+	Percent     int    `yaml:"percent"`
+}
+
+// IndexNames is the naming policy for indices tenants create through the proxy,
+// explicitly or, in index-per-tenant mode, by writing to them. Base index names
+// must match Pattern when it is set, and neither they nor the upstream names
+// they render to may start with one of ReservedPrefixes. Rendered names are
+// limited to MaxLength bytes, zero for no limit.
+type IndexNames struct {
+	MaxLength        int      `yaml:"max_length"`
+	Pattern          string   `yaml:"pattern"`
+	ReservedPrefixes []string `yaml:"reserved_prefixes"`
+}
+
+// Faults injects upstream failures to test client retries and the proxy's own
+// error handling in staging; it must not be enabled in production. Rules are
+// tried in order for every upstream call of a tenanted request, and the first
+// that fires applies its action.
+type Faults struct {
+	Enabled bool        `yaml:"enabled"`
+	Rules   []FaultRule `yaml:"rules"`
+}
+
+// FaultRule fires for Percent percent of the upstream calls of Tenant, or of
+// every tenant when Tenant is empty. Action "delay" holds the call for DelayMs
+// milliseconds before sending it, "drop" fails it as if the connection broke,
+// and "error" answers it with Status, 503 when unset, without calling the
+// upstream.
+type FaultRule struct {
+	Tenant  string `yaml:"tenant"`
+	Percent int    `yaml:"percent"`
+	Action  string `yaml:"action"`
+	DelayMs int    `yaml:"delay_ms"`
+	Status  int    `yaml:"status"`
+}
+
+// Bulk configures how bulk bodies are parsed. RepairPrettyPrinted accepts
+// action and source lines pretty-printed over several lines, as some clients
+// send them, by joining each JSON value back onto one line. Rewritten bodies are
+// held until every line has been checked: the first SpoolMemoryBytes in memory
+// and the rest in a temporary file in SpoolDir, the system default when empty.
+type Bulk struct {
+	RepairPrettyPrinted bool   `yaml:"repair_pretty_printed"`
+	SpoolMemoryBytes    int64  `yaml:"spool_memory_bytes"`
+	SpoolDir            string `yaml:"spool_dir"`
+}
+
+// ResponseHeaders is the header policy of every response. Strip lists upstream
+// headers that reveal cluster details, which are removed before responses reach
+// clients, and Set headers are added to every response.
+type ResponseHeaders struct {
+	Strip []string          `yaml:"strip"`
+	Set   map[string]string `yaml:"set"`
+	CORS  CORS              `yaml:"cors"`
+}
+
+// CORS lets browser-based dashboards on AllowedOrigins, where "*" allows any
+// origin, call the proxy: preflight requests are answered by the proxy before
+// routing and responses carry the CORS headers. AllowedMethods and
+// AllowedHeaders are the methods and request headers browsers may use, and
+// preflight answers are cached for MaxAgeSeconds. Origins allows further
+// origins with their own methods, headers, or credentials. CORS is off when no
+// origins are configured.
+type CORS struct {
+	AllowedOrigins   []string     `yaml:"allowed_origins"`
+	AllowedMethods   []string     `yaml:"allowed_methods"`
+	AllowedHeaders   []string     `yaml:"allowed_headers"`
+	AllowCredentials bool         `yaml:"allow_credentials"`
+	MaxAgeSeconds    int          `yaml:"max_age_seconds"`
+	Origins          []CORSOrigin `yaml:"origins"`
+}
+
+// CORSOrigin allows Origin with its own settings; empty methods and headers and
+// an unset AllowCredentials fall back to the cors settings.
+type CORSOrigin struct {
+	Origin           string   `yaml:"origin"`
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	AllowCredentials *bool    `yaml:"allow_credentials"`
+}
+
+// Enabled reports whether any origin is allowed.
+func (c CORS) Enabled() bool {
+	return len(c.AllowedOrigins) > 0 || len(c.Origins) > 0
+}
+
+const defaultDrainTimeoutSeconds = 30
+
+// DrainTimeout returns the drain timeout, using the default when it is unset.
+func (s Shutdown) DrainTimeout() time.Duration {
+	if s.DrainTimeoutSeconds <= 0 {
+		return defaultDrainTimeoutSeconds * time.Second
+	}
+	return time.Duration(s.DrainTimeoutSeconds) * time.Second
+}
+
+const defaultReadinessTimeoutSeconds = 2
+
+// ReadinessTimeout returns the readiness probe timeout, using the default when
+// it is unset.
+func (a Admin) ReadinessTimeout() time.Duration {
+	if a.ReadinessTimeoutSeconds <= 0 {
+		return defaultReadinessTimeoutSeconds * time.Second
+	}
+	return time.Duration(a.ReadinessTimeoutSeconds) * time.Second
+}
+
+func Default() Config {
+	return Config{
+		Ports: Ports{
+			HTTP:  8080,
+			Admin: 8081,
+		},
+		UpstreamURL: "http://localhost:9200",
+		Mode:        "shared",
+		Verbose:     false,
+		BodyPreview: BodyPreview{
+			MaxBytes:      1024,
+			RedactPattern: `(?i)pass(word)?|secret|token|api_?key|authorization|e_?mail|phone|ssn|card`,
+		},
+		Rewriter:    "auto",
+		ErrorFormat: "proxy",
+		TenantRegex: TenantRegex{
+			Pattern: `^(?P<prefix>[^-]+)-(?P<tenant>[^-]+)(?P<postfix>.*)$`,
+		},
+		SharedIndex: SharedIndex{
+			Name:          "{{.index}}",
+			AliasTemplate: "alias-{{.index}}-{{.tenant}}",
+			TenantField:   "tenant_id",
+		},
+		IndexPerTenant: IndexPerTenant{
+			IndexTemplate: "{{.index}}-{{.tenant}}",
+		},
+		Auth: Auth{
+			Required: false,
+			Header:   "Authorization",
+			BasicAuth: BasicAuth{
+				Realm: "es-tmnt",
+			},
+		},
+		Audit: Audit{
+			Index: "es-tmnt-audit",
+		},
+		APIKeys: APIKeys{
+			Store: "index",
+			Index: "es-tmnt-api-keys",
+		},
+		Cat: Cat{
+			TenantHeader: "X-Tenant-ID",
+		},
+		Limits: Limits{
+			MaxBodyBytes:            10 << 20,
+			MaxBulkBodyBytes:        100 << 20,
+			MaxMultiSearchLineBytes: 1 << 20,
+			MaxMultiSearchLines:     10000,
+		},
+		Bulk: Bulk{
+			SpoolMemoryBytes: 8 << 20,
+		},
+		Usage: Usage{
+			Index:                "es-tmnt-usage",
+			FlushIntervalSeconds: 60,
+		},
+		SlowLog: SlowLog{
+			Query:         "truncate",
+			MaxQueryBytes: 1024,
+			Recent:        100,
+		},
+		Shutdown: Shutdown{
+			DrainTimeoutSeconds: defaultDrainTimeoutSeconds,
+		},
+		Admin: Admin{
+			ReadinessTimeoutSeconds: defaultReadinessTimeoutSeconds,
+		},
+		Lifecycle: Lifecycle{
+			PolicyTemplate: "{{.tenant}}-{{.index}}",
+		},
+		Scripts: Scripts{
+			ScriptTemplate: "{{.tenant}}-{{.index}}",
+		},
+		Ingest: Ingest{
+			PipelineTemplate: defaultPipelineTemplate,
+		},
+		Freeze: Freeze{
+			Message: defaultFreezeMessage,
+		},
+		ResponseCache: ResponseCache{
+			MaxBytes:   64 << 20,
+			TTLSeconds: 30,
+		},
+		State: State{
+			Store:     "memory",
+			KeyPrefix: "es-tmnt:",
+		},
+		Timeouts: Timeouts{
+			SearchSeconds:      60,
+			BulkSeconds:        300,
+			PassthroughSeconds: 30,
+			DefaultSeconds:     60,
+		},
+		TenantResolver: TenantResolver{
+			Type:   "regex",
+			Header: "X-Tenant-ID",
+			Claim:  "tenant",
+		},
+		RootInfo: RootInfo{
+			ClusterName: "es-tmnt",
+			Version:     "8.13.4",
+		},
+		Shadow: Shadow{
+			Percent: 100,
+		},
+		ReservedTenants:    []string{"system", "all", "default", "*"},
+		TrustedProxyHeader: "X-Forwarded-For",
+		IndexNames: IndexNames{
+			MaxLength:        255,
+			ReservedPrefixes: []string{"."},
+		},
+		UnknownPaths: UnknownPaths{
+			Action: "reject",
+			Ignore: []string{"/favicon.ico", "/robots.txt"},
+		},
+		ModeOverride: ModeOverride{
+			Header:      "X-ES-TMNT-Mode",
+			TokenHeader: "X-ES-TMNT-Admin-Token",
+		},
+		ResponseHeaders: ResponseHeaders{
+			Strip: []string{"X-Found-Handling-Cluster", "X-Found-Handling-Instance", "X-Cloud-Request-Id"},
+			CORS: CORS{
+				AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "DELETE"},
+				AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID"},
+				MaxAgeSeconds:  600,
+			},
+		},
+	}
+}
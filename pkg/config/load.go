@@ -0,0 +1,388 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	envConfigPath                  = "ES_TMNT_CONFIG"
+	envHTTPPort                    = "ES_TMNT_HTTP_PORT"
+	envAdminPort                   = "ES_TMNT_ADMIN_PORT"
+	envListeners                   = "ES_TMNT_LISTENERS"
+	envAdminToken                  = "ES_TMNT_ADMIN_TOKEN"
+	envAdminTLSCertPath            = "ES_TMNT_ADMIN_TLS_CERT_PATH"
+	envAdminTLSKeyPath             = "ES_TMNT_ADMIN_TLS_KEY_PATH"
+	envAdminClientCAPath           = "ES_TMNT_ADMIN_CLIENT_CA_PATH"
+	envAdminReadinessTimeout       = "ES_TMNT_ADMIN_READINESS_TIMEOUT_SECONDS"
+	envAdminDiagnostics            = "ES_TMNT_ADMIN_DIAGNOSTICS"
+	envUpstreamURL                 = "ES_TMNT_UPSTREAM_URL"
+	envMode                        = "ES_TMNT_MODE"
+	envVerbose                     = "ES_TMNT_VERBOSE"
+	envBodyPreviewEnabled          = "ES_TMNT_BODY_PREVIEW_ENABLED"
+	envBodyPreviewMaxBytes         = "ES_TMNT_BODY_PREVIEW_MAX_BYTES"
+	envBodyPreviewRedactPattern    = "ES_TMNT_BODY_PREVIEW_REDACT_PATTERN"
+	envRewriter                    = "ES_TMNT_REWRITER"
+	envErrorFormat                 = "ES_TMNT_ERROR_FORMAT"
+	envPassthroughPaths            = "ES_TMNT_PASSTHROUGH_PATHS"
+	envTenantRegexPattern          = "ES_TMNT_TENANT_REGEX_PATTERN"
+	envSharedIndexName             = "ES_TMNT_SHARED_INDEX_NAME"
+	envSharedIndexAliasTemplate    = "ES_TMNT_SHARED_INDEX_ALIAS_TEMPLATE"
+	envSharedIndexTenantField      = "ES_TMNT_SHARED_INDEX_TENANT_FIELD"
+	envSharedIndexEnforceFilter    = "ES_TMNT_SHARED_INDEX_ENFORCE_FILTER"
+	envSharedIndexRouteByTenant    = "ES_TMNT_SHARED_INDEX_ROUTE_BY_TENANT"
+	envSharedIndexDenyPatterns     = "ES_TMNT_SHARED_INDEX_DENY_PATTERNS"
+	envSharedIndexFieldManifest    = "ES_TMNT_SHARED_INDEX_FIELD_MANIFEST_PATH"
+	envIndexPerTenantIndexTemplate = "ES_TMNT_INDEX_PER_TENANT_TEMPLATE"
+	envIndexPerTenantPercolator    = "ES_TMNT_INDEX_PER_TENANT_PERCOLATOR_FIELDS"
+	envIndexPerTenantSkipFields    = "ES_TMNT_INDEX_PER_TENANT_SKIP_FIELDS"
+	envIndexPerTenantWrapSource    = "ES_TMNT_INDEX_PER_TENANT_WRAP_SOURCE"
+	envIndexPerTenantAutoCreate    = "ES_TMNT_INDEX_PER_TENANT_AUTO_CREATE"
+	envIndexPerTenantCreateTmpl    = "ES_TMNT_INDEX_PER_TENANT_CREATE_TEMPLATE_PATH"
+	envAuthRequired                = "ES_TMNT_AUTH_REQUIRED"
+	envAuthHeader                  = "ES_TMNT_AUTH_HEADER"
+	envBasicAuthEnabled            = "ES_TMNT_AUTH_BASIC_AUTH_ENABLED"
+	envBasicAuthRealm              = "ES_TMNT_AUTH_BASIC_AUTH_REALM"
+	envBasicAuthHtpasswdPath       = "ES_TMNT_AUTH_BASIC_AUTH_HTPASSWD_PATH"
+	envAPIKeysEnabled              = "ES_TMNT_API_KEYS_ENABLED"
+	envAPIKeysStore                = "ES_TMNT_API_KEYS_STORE"
+	envAPIKeysPath                 = "ES_TMNT_API_KEYS_PATH"
+	envAPIKeysIndex                = "ES_TMNT_API_KEYS_INDEX"
+	envPermissionsDefault          = "ES_TMNT_PERMISSIONS_DEFAULT"
+	envTrustedProxies              = "ES_TMNT_TRUSTED_PROXIES"
+	envTrustedProxyHeader          = "ES_TMNT_TRUSTED_PROXY_HEADER"
+	envAuditSink                   = "ES_TMNT_AUDIT_SINK"
+	envAuditPath                   = "ES_TMNT_AUDIT_PATH"
+	envAuditIndex                  = "ES_TMNT_AUDIT_INDEX"
+	envCatTenantHeader             = "ES_TMNT_CAT_TENANT_HEADER"
+	envCatTenantScoped             = "ES_TMNT_CAT_TENANT_SCOPED"
+	envLimitsMaxBodyBytes          = "ES_TMNT_LIMITS_MAX_BODY_BYTES"
+	envLimitsMaxBulkBodyBytes      = "ES_TMNT_LIMITS_MAX_BULK_BODY_BYTES"
+	envLimitsMaxMsearchLineBytes   = "ES_TMNT_LIMITS_MAX_MSEARCH_LINE_BYTES"
+	envLimitsMaxMsearchLines       = "ES_TMNT_LIMITS_MAX_MSEARCH_LINES"
+	envUsageSink                   = "ES_TMNT_USAGE_SINK"
+	envUsagePath                   = "ES_TMNT_USAGE_PATH"
+	envUsageIndex                  = "ES_TMNT_USAGE_INDEX"
+	envUsageFlushIntervalSeconds   = "ES_TMNT_USAGE_FLUSH_INTERVAL_SECONDS"
+	envSlowLogSearchThresholdMs    = "ES_TMNT_SLOW_LOG_SEARCH_THRESHOLD_MS"
+	envSlowLogBulkThresholdMs      = "ES_TMNT_SLOW_LOG_BULK_THRESHOLD_MS"
+	envSlowLogQuery                = "ES_TMNT_SLOW_LOG_QUERY"
+	envSlowLogMaxQueryBytes        = "ES_TMNT_SLOW_LOG_MAX_QUERY_BYTES"
+	envSlowLogRecent               = "ES_TMNT_SLOW_LOG_RECENT"
+	envShutdownDrainTimeoutSeconds = "ES_TMNT_SHUTDOWN_DRAIN_TIMEOUT_SECONDS"
+	envLifecycleNamespacePolicies  = "ES_TMNT_LIFECYCLE_NAMESPACE_POLICIES"
+	envLifecyclePolicyTemplate     = "ES_TMNT_LIFECYCLE_POLICY_TEMPLATE"
+	envScriptsNamespaceScripts     = "ES_TMNT_SCRIPTS_NAMESPACE_SCRIPTS"
+	envScriptsScriptTemplate       = "ES_TMNT_SCRIPTS_SCRIPT_TEMPLATE"
+	envTasksScopeTasks             = "ES_TMNT_TASKS_SCOPE_TASKS"
+	envIngestPipelineTemplate      = "ES_TMNT_INGEST_PIPELINE_TEMPLATE"
+	envFreezeWrites                = "ES_TMNT_FREEZE_WRITES"
+	envFreezeMessage               = "ES_TMNT_FREEZE_MESSAGE"
+	envResponseCacheMaxEntries     = "ES_TMNT_RESPONSE_CACHE_MAX_ENTRIES"
+	envResponseCacheMaxBytes       = "ES_TMNT_RESPONSE_CACHE_MAX_BYTES"
+	envResponseCacheTTLSeconds     = "ES_TMNT_RESPONSE_CACHE_TTL_SECONDS"
+	envStateStore                  = "ES_TMNT_STATE_STORE"
+	envStateRedisURL               = "ES_TMNT_STATE_REDIS_URL"
+	envStateKeyPrefix              = "ES_TMNT_STATE_KEY_PREFIX"
+	envTimeoutsSearchSeconds       = "ES_TMNT_TIMEOUTS_SEARCH_SECONDS"
+	envTimeoutsBulkSeconds         = "ES_TMNT_TIMEOUTS_BULK_SECONDS"
+	envTimeoutsPassthroughSeconds  = "ES_TMNT_TIMEOUTS_PASSTHROUGH_SECONDS"
+	envTimeoutsDefaultSeconds      = "ES_TMNT_TIMEOUTS_DEFAULT_SECONDS"
+	envTenantResolverType          = "ES_TMNT_TENANT_RESOLVER_TYPE"
+	envTenantResolverHeader        = "ES_TMNT_TENANT_RESOLVER_HEADER"
+	envTenantResolverClaim         = "ES_TMNT_TENANT_RESOLVER_CLAIM"
+	envTenantResolverJWTSecret     = "ES_TMNT_TENANT_RESOLVER_JWT_SECRET"
+	envTenantResolverJWTPublicKey  = "ES_TMNT_TENANT_RESOLVER_JWT_PUBLIC_KEY_PATH"
+	envRootInfoSynthesize          = "ES_TMNT_ROOT_INFO_SYNTHESIZE"
+	envRootInfoClusterName         = "ES_TMNT_ROOT_INFO_CLUSTER_NAME"
+	envRootInfoVersion             = "ES_TMNT_ROOT_INFO_VERSION"
+	envUnknownPathsAction          = "ES_TMNT_UNKNOWN_PATHS_ACTION"
+	envUnknownPathsIgnore          = "ES_TMNT_UNKNOWN_PATHS_IGNORE"
+	envModeOverrideEnabled         = "ES_TMNT_MODE_OVERRIDE_ENABLED"
+	envModeOverrideHeader          = "ES_TMNT_MODE_OVERRIDE_HEADER"
+	envModeOverrideToken           = "ES_TMNT_MODE_OVERRIDE_TOKEN"
+	envModeOverrideTokenHeader     = "ES_TMNT_MODE_OVERRIDE_TOKEN_HEADER"
+	envMigrationTenants            = "ES_TMNT_MIGRATION_TENANTS"
+	envMigrationPrimary            = "ES_TMNT_MIGRATION_PRIMARY"
+	envShadowUpstreamURL           = "ES_TMNT_SHADOW_UPSTREAM_URL"
+	envShadowPercent               = "ES_TMNT_SHADOW_PERCENT"
+	envIndexNamesMaxLength         = "ES_TMNT_INDEX_NAMES_MAX_LENGTH"
+	envIndexNamesPattern           = "ES_TMNT_INDEX_NAMES_PATTERN"
+	envIndexNamesReservedPrefixes  = "ES_TMNT_INDEX_NAMES_RESERVED_PREFIXES"
+	envReservedTenants             = "ES_TMNT_RESERVED_TENANTS"
+	envFaultsEnabled               = "ES_TMNT_FAULTS_ENABLED"
+	envBulkRepairPrettyPrinted     = "ES_TMNT_BULK_REPAIR_PRETTY_PRINTED"
+	envBulkSpoolMemoryBytes        = "ES_TMNT_BULK_SPOOL_MEMORY_BYTES"
+	envBulkSpoolDir                = "ES_TMNT_BULK_SPOOL_DIR"
+	envResponseHeadersStrip        = "ES_TMNT_RESPONSE_HEADERS_STRIP"
+	envCORSAllowedOrigins          = "ES_TMNT_RESPONSE_HEADERS_CORS_ALLOWED_ORIGINS"
+	envCORSAllowedMethods          = "ES_TMNT_RESPONSE_HEADERS_CORS_ALLOWED_METHODS"
+	envCORSAllowedHeaders          = "ES_TMNT_RESPONSE_HEADERS_CORS_ALLOWED_HEADERS"
+	envCORSAllowCredentials        = "ES_TMNT_RESPONSE_HEADERS_CORS_ALLOW_CREDENTIALS"
+	envCORSMaxAgeSeconds           = "ES_TMNT_RESPONSE_HEADERS_CORS_MAX_AGE_SECONDS"
+)
+
+func Load() (Config, error) {
+	cfg := Default()
+
+	if path := strings.TrimSpace(os.Getenv(envConfigPath)); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("read config file: %w", err)
+		}
+		if err := unmarshalConfigFile(path, data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("parse config file: %w", err)
+		}
+	}
+
+	overrideInt(envHTTPPort, &cfg.Ports.HTTP)
+	overrideInt(envAdminPort, &cfg.Ports.Admin)
+	overrideListeners(envListeners, &cfg.Listeners)
+	overrideString(envAdminToken, &cfg.Admin.Token)
+	overrideString(envAdminTLSCertPath, &cfg.Admin.TLSCertPath)
+	overrideString(envAdminTLSKeyPath, &cfg.Admin.TLSKeyPath)
+	overrideString(envAdminClientCAPath, &cfg.Admin.ClientCAPath)
+	overrideInt(envAdminReadinessTimeout, &cfg.Admin.ReadinessTimeoutSeconds)
+	overrideBool(envAdminDiagnostics, &cfg.Admin.Diagnostics)
+	overrideString(envUpstreamURL, &cfg.UpstreamURL)
+	overrideString(envMode, &cfg.Mode)
+	overrideBool(envVerbose, &cfg.Verbose)
+	overrideBool(envBodyPreviewEnabled, &cfg.BodyPreview.Enabled)
+	overrideInt(envBodyPreviewMaxBytes, &cfg.BodyPreview.MaxBytes)
+	overrideString(envBodyPreviewRedactPattern, &cfg.BodyPreview.RedactPattern)
+	overrideString(envRewriter, &cfg.Rewriter)
+	overrideString(envErrorFormat, &cfg.ErrorFormat)
+	overrideString(envTenantRegexPattern, &cfg.TenantRegex.Pattern)
+	overrideString(envSharedIndexName, &cfg.SharedIndex.Name)
+	overrideString(envSharedIndexAliasTemplate, &cfg.SharedIndex.AliasTemplate)
+	overrideString(envSharedIndexTenantField, &cfg.SharedIndex.TenantField)
+	overrideBool(envSharedIndexEnforceFilter, &cfg.SharedIndex.EnforceFilter)
+	overrideBool(envSharedIndexRouteByTenant, &cfg.SharedIndex.RouteByTenant)
+	overrideStringSlice(envSharedIndexDenyPatterns, &cfg.SharedIndex.DenyPatterns)
+	overrideString(envSharedIndexFieldManifest, &cfg.SharedIndex.FieldManifestPath)
+	overrideString(envIndexPerTenantIndexTemplate, &cfg.IndexPerTenant.IndexTemplate)
+	overrideStringSlice(envIndexPerTenantPercolator, &cfg.IndexPerTenant.PercolatorFields)
+	overrideStringSlice(envIndexPerTenantSkipFields, &cfg.IndexPerTenant.SkipFields)
+	overrideBoolPtr(envIndexPerTenantWrapSource, &cfg.IndexPerTenant.WrapSource)
+	overrideBool(envIndexPerTenantAutoCreate, &cfg.IndexPerTenant.AutoCreate)
+	overrideString(envIndexPerTenantCreateTmpl, &cfg.IndexPerTenant.CreateTemplatePath)
+	overridePassthrough(envPassthroughPaths, &cfg.PassthroughPaths)
+	overrideBool(envAuthRequired, &cfg.Auth.Required)
+	overrideString(envAuthHeader, &cfg.Auth.Header)
+	overrideBool(envBasicAuthEnabled, &cfg.Auth.BasicAuth.Enabled)
+	overrideString(envBasicAuthRealm, &cfg.Auth.BasicAuth.Realm)
+	overrideString(envBasicAuthHtpasswdPath, &cfg.Auth.BasicAuth.HtpasswdPath)
+	overrideBool(envAPIKeysEnabled, &cfg.APIKeys.Enabled)
+	overrideString(envAPIKeysStore, &cfg.APIKeys.Store)
+	overrideString(envAPIKeysPath, &cfg.APIKeys.Path)
+	overrideString(envAPIKeysIndex, &cfg.APIKeys.Index)
+	overrideStringSlice(envPermissionsDefault, &cfg.Permissions.Default)
+	overrideStringSlice(envTrustedProxies, &cfg.TrustedProxies)
+	overrideString(envTrustedProxyHeader, &cfg.TrustedProxyHeader)
+	overrideString(envAuditSink, &cfg.Audit.Sink)
+	overrideString(envAuditPath, &cfg.Audit.Path)
+	overrideString(envAuditIndex, &cfg.Audit.Index)
+	overrideString(envCatTenantHeader, &cfg.Cat.TenantHeader)
+	overrideBool(envCatTenantScoped, &cfg.Cat.TenantScoped)
+	overrideInt64(envLimitsMaxBodyBytes, &cfg.Limits.MaxBodyBytes)
+	overrideInt64(envLimitsMaxBulkBodyBytes, &cfg.Limits.MaxBulkBodyBytes)
+	overrideInt64(envLimitsMaxMsearchLineBytes, &cfg.Limits.MaxMultiSearchLineBytes)
+	overrideInt(envLimitsMaxMsearchLines, &cfg.Limits.MaxMultiSearchLines)
+	overrideString(envUsageSink, &cfg.Usage.Sink)
+	overrideString(envUsagePath, &cfg.Usage.Path)
+	overrideString(envUsageIndex, &cfg.Usage.Index)
+	overrideInt(envUsageFlushIntervalSeconds, &cfg.Usage.FlushIntervalSeconds)
+	overrideInt(envSlowLogSearchThresholdMs, &cfg.SlowLog.SearchThresholdMs)
+	overrideInt(envSlowLogBulkThresholdMs, &cfg.SlowLog.BulkThresholdMs)
+	overrideString(envSlowLogQuery, &cfg.SlowLog.Query)
+	overrideInt(envSlowLogMaxQueryBytes, &cfg.SlowLog.MaxQueryBytes)
+	overrideInt(envSlowLogRecent, &cfg.SlowLog.Recent)
+	overrideInt(envShutdownDrainTimeoutSeconds, &cfg.Shutdown.DrainTimeoutSeconds)
+	overrideBool(envLifecycleNamespacePolicies, &cfg.Lifecycle.NamespacePolicies)
+	overrideString(envLifecyclePolicyTemplate, &cfg.Lifecycle.PolicyTemplate)
+	overrideBool(envScriptsNamespaceScripts, &cfg.Scripts.NamespaceScripts)
+	overrideString(envScriptsScriptTemplate, &cfg.Scripts.ScriptTemplate)
+	overrideBool(envTasksScopeTasks, &cfg.Tasks.ScopeTasks)
+	overrideString(envIngestPipelineTemplate, &cfg.Ingest.PipelineTemplate)
+	overrideBool(envFreezeWrites, &cfg.Freeze.Writes)
+	overrideString(envFreezeMessage, &cfg.Freeze.Message)
+	overrideInt(envResponseCacheMaxEntries, &cfg.ResponseCache.MaxEntries)
+	overrideInt64(envResponseCacheMaxBytes, &cfg.ResponseCache.MaxBytes)
+	overrideInt(envResponseCacheTTLSeconds, &cfg.ResponseCache.TTLSeconds)
+	overrideString(envStateStore, &cfg.State.Store)
+	overrideString(envStateRedisURL, &cfg.State.RedisURL)
+	overrideString(envStateKeyPrefix, &cfg.State.KeyPrefix)
+	overrideInt(envTimeoutsSearchSeconds, &cfg.Timeouts.SearchSeconds)
+	overrideInt(envTimeoutsBulkSeconds, &cfg.Timeouts.BulkSeconds)
+	overrideInt(envTimeoutsPassthroughSeconds, &cfg.Timeouts.PassthroughSeconds)
+	overrideInt(envTimeoutsDefaultSeconds, &cfg.Timeouts.DefaultSeconds)
+	overrideString(envTenantResolverType, &cfg.TenantResolver.Type)
+	overrideString(envTenantResolverHeader, &cfg.TenantResolver.Header)
+	overrideString(envTenantResolverClaim, &cfg.TenantResolver.Claim)
+	overrideString(envTenantResolverJWTSecret, &cfg.TenantResolver.JWTSecret)
+	overrideString(envTenantResolverJWTPublicKey, &cfg.TenantResolver.JWTPublicKeyPath)
+	overrideBool(envRootInfoSynthesize, &cfg.RootInfo.Synthesize)
+	overrideString(envRootInfoClusterName, &cfg.RootInfo.ClusterName)
+	overrideString(envRootInfoVersion, &cfg.RootInfo.Version)
+	overrideString(envUnknownPathsAction, &cfg.UnknownPaths.Action)
+	overrideStringSlice(envUnknownPathsIgnore, &cfg.UnknownPaths.Ignore)
+	overrideBool(envModeOverrideEnabled, &cfg.ModeOverride.Enabled)
+	overrideString(envModeOverrideHeader, &cfg.ModeOverride.Header)
+	overrideString(envModeOverrideToken, &cfg.ModeOverride.Token)
+	overrideString(envModeOverrideTokenHeader, &cfg.ModeOverride.TokenHeader)
+	overrideStringSlice(envMigrationTenants, &cfg.Migration.Tenants)
+	overrideString(envMigrationPrimary, &cfg.Migration.Primary)
+	overrideString(envShadowUpstreamURL, &cfg.Shadow.UpstreamURL)
+	overrideInt(envShadowPercent, &cfg.Shadow.Percent)
+	overrideInt(envIndexNamesMaxLength, &cfg.IndexNames.MaxLength)
+	overrideString(envIndexNamesPattern, &cfg.IndexNames.Pattern)
+	overrideStringSlice(envIndexNamesReservedPrefixes, &cfg.IndexNames.ReservedPrefixes)
+	overrideStringSlice(envReservedTenants, &cfg.ReservedTenants)
+	overrideBool(envFaultsEnabled, &cfg.Faults.Enabled)
+	overrideBool(envBulkRepairPrettyPrinted, &cfg.Bulk.RepairPrettyPrinted)
+	overrideInt64(envBulkSpoolMemoryBytes, &cfg.Bulk.SpoolMemoryBytes)
+	overrideString(envBulkSpoolDir, &cfg.Bulk.SpoolDir)
+	overrideStringSlice(envResponseHeadersStrip, &cfg.ResponseHeaders.Strip)
+	overrideStringSlice(envCORSAllowedOrigins, &cfg.ResponseHeaders.CORS.AllowedOrigins)
+	overrideStringSlice(envCORSAllowedMethods, &cfg.ResponseHeaders.CORS.AllowedMethods)
+	overrideStringSlice(envCORSAllowedHeaders, &cfg.ResponseHeaders.CORS.AllowedHeaders)
+	overrideBool(envCORSAllowCredentials, &cfg.ResponseHeaders.CORS.AllowCredentials)
+	overrideInt(envCORSMaxAgeSeconds, &cfg.ResponseHeaders.CORS.MaxAgeSeconds)
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Compile(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// Compile compiles the tenant regex and the shared index deny patterns. Load
+// compiles them; configurations built in code are compiled by proxy.New.
+func (c *Config) Compile() error {
+	compiled, err := regexp.Compile(c.TenantRegex.Pattern)
+	if err != nil {
+		return fmt.Errorf("tenant_regex.pattern is invalid: %w", err)
+	}
+	c.TenantRegex.Compiled = compiled
+	c.SharedIndex.DenyCompiled = compilePatterns(c.SharedIndex.DenyPatterns)
+	return nil
+}
+
+// unmarshalConfigFile decodes a config file by its extension: .yaml and .yml
+// files are YAML, .json files are JSON, and other files are tried as JSON, then
+// as YAML.
+func unmarshalConfigFile(path string, data []byte, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return unmarshalYAML(data, cfg)
+	case ".json":
+		return json.Unmarshal(data, cfg)
+	}
+	decoded := *cfg
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		decoded = *cfg
+		if yamlErr := unmarshalYAML(data, &decoded); yamlErr != nil {
+			return fmt.Errorf("not JSON (%v) or YAML (%v)", err, yamlErr)
+		}
+	}
+	*cfg = decoded
+	return nil
+}
+
+func overrideString(key string, target *string) {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		*target = value
+	}
+}
+
+func overrideInt(key string, target *int) {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			*target = parsed
+		}
+	}
+}
+
+func overrideInt64(key string, target *int64) {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			*target = parsed
+		}
+	}
+}
+
+func overrideBool(key string, target *bool) {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			*target = parsed
+		}
+	}
+}
+
+func overrideBoolPtr(key string, target **bool) {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			*target = &parsed
+		}
+	}
+}
+
+func overridePassthrough(key string, target *[]string) {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		parts := strings.Split(value, ",")
+		result := make([]string, 0, len(parts))
+		for _, part := range parts {
+			trimmed := strings.TrimSpace(part)
+			if trimmed != "" {
+				result = append(result, trimmed)
+			}
+		}
+		*target = result
+	}
+}
+
+func overrideStringSlice(key string, target *[]string) {
+	overridePassthrough(key, target)
+}
+
+func overrideListeners(key string, target *[]Listener) {
+	var specs []string
+	overrideStringSlice(key, &specs)
+	if specs == nil {
+		return
+	}
+	listeners := make([]Listener, 0, len(specs))
+	for _, spec := range specs {
+		listeners = append(listeners, ParseListener(spec))
+	}
+	*target = listeners
+}
+
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	if len(patterns) == 0 {
+		return nil
+	}
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Printf("warning: failed to compile regex pattern %q: %v", pattern, err)
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
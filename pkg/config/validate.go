@@ -0,0 +1,620 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+)
+
+var rootVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+const (
+	tenantPrefixGroup  = "prefix"
+	tenantIDGroup      = "tenant"
+	tenantPostfixGroup = "postfix"
+)
+
+func (c Config) Validate() error {
+	if strings.TrimSpace(c.UpstreamURL) == "" {
+		return fmt.Errorf("upstream_url is required")
+	}
+	if _, err := url.ParseRequestURI(c.UpstreamURL); err != nil {
+		return fmt.Errorf("upstream_url must be a valid URL: %w", err)
+	}
+
+	if c.Ports.HTTP <= 0 && len(c.Listeners) == 0 {
+		return fmt.Errorf("ports.http or listeners is required")
+	}
+	for i, listener := range c.Listeners {
+		switch strings.ToLower(strings.TrimSpace(listener.Type)) {
+		case "tcp":
+			if strings.TrimSpace(listener.Address) == "" {
+				return fmt.Errorf("listeners[%d].address is required for tcp listeners", i)
+			}
+		case "unix":
+			if strings.TrimSpace(listener.Path) == "" {
+				return fmt.Errorf("listeners[%d].path is required for unix listeners", i)
+			}
+			if listener.Mode != "" {
+				if _, err := strconv.ParseUint(listener.Mode, 8, 32); err != nil {
+					return fmt.Errorf("listeners[%d].mode must be octal permissions such as \"0660\" (got %q)", i, listener.Mode)
+				}
+			}
+		case "systemd":
+		default:
+			return fmt.Errorf("listeners[%d].type must be \"tcp\", \"unix\", or \"systemd\" (got %q)", i, listener.Type)
+		}
+	}
+
+	if (c.Admin.TLSCertPath == "") != (c.Admin.TLSKeyPath == "") {
+		return fmt.Errorf("admin.tls_cert_path and admin.tls_key_path must be set together")
+	}
+	if c.Admin.ClientCAPath != "" && c.Admin.TLSCertPath == "" {
+		return fmt.Errorf("admin.client_ca_path requires admin.tls_cert_path and admin.tls_key_path")
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(c.Mode))
+	switch mode {
+	case "shared", "index-per-tenant":
+	default:
+		return fmt.Errorf("mode must be \"shared\" or \"index-per-tenant\" (got %q)", c.Mode)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.Rewriter)) {
+	case "", "auto", "fastjson", "stdlib":
+	default:
+		return fmt.Errorf("rewriter must be \"auto\", \"fastjson\", or \"stdlib\" (got %q)", c.Rewriter)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.ErrorFormat)) {
+	case "", "proxy", "elasticsearch":
+	default:
+		return fmt.Errorf("error_format must be \"proxy\" or \"elasticsearch\" (got %q)", c.ErrorFormat)
+	}
+
+	pattern := strings.TrimSpace(c.TenantRegex.Pattern)
+	if pattern == "" {
+		return fmt.Errorf("tenant_regex.pattern is required")
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("tenant_regex.pattern is invalid: %w", err)
+	}
+	if compiled.SubexpIndex(tenantPrefixGroup) < 0 ||
+		compiled.SubexpIndex(tenantIDGroup) < 0 ||
+		compiled.SubexpIndex(tenantPostfixGroup) < 0 {
+		return fmt.Errorf("tenant_regex.pattern must include named capture groups %q, %q, and %q",
+			tenantPrefixGroup, tenantIDGroup, tenantPostfixGroup)
+	}
+	if err := validateRegexComplexity(pattern); err != nil {
+		return err
+	}
+
+	for i, path := range c.PassthroughPaths {
+		if strings.TrimSpace(path) == "" {
+			return fmt.Errorf("passthrough_paths[%d] must not be empty", i)
+		}
+	}
+
+	if mode == "shared" {
+		if strings.TrimSpace(c.SharedIndex.Name) == "" {
+			return fmt.Errorf("shared_index.name is required in shared mode")
+		}
+		if strings.TrimSpace(c.SharedIndex.AliasTemplate) == "" {
+			return fmt.Errorf("shared_index.alias_template is required in shared mode")
+		}
+		if strings.TrimSpace(c.SharedIndex.TenantField) == "" {
+			return fmt.Errorf("shared_index.tenant_field is required in shared mode")
+		}
+		if err := validateTenantTemplate("shared_index.alias_template", c.SharedIndex.AliasTemplate); err != nil {
+			return err
+		}
+		for i, group := range c.SharedIndex.Groups {
+			if group.AliasTemplate == "" {
+				continue
+			}
+			if err := validateTenantTemplate(fmt.Sprintf("shared_index.groups[%d].alias_template", i), group.AliasTemplate); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, group := range c.SharedIndex.Groups {
+		if strings.TrimSpace(group.Pattern) == "" {
+			return fmt.Errorf("shared_index.groups[%d].pattern is required", i)
+		}
+		if _, err := path.Match(group.Pattern, ""); err != nil {
+			return fmt.Errorf("shared_index.groups[%d].pattern is invalid (got %q)", i, group.Pattern)
+		}
+		if strings.TrimSpace(group.Name) == "" {
+			return fmt.Errorf("shared_index.groups[%d].name is required", i)
+		}
+	}
+
+	for i, pattern := range c.SharedIndex.DenyPatterns {
+		trimmed := strings.TrimSpace(pattern)
+		if trimmed == "" {
+			return fmt.Errorf("shared_index.deny_patterns[%d] must not be empty", i)
+		}
+		if _, err := regexp.Compile(trimmed); err != nil {
+			return fmt.Errorf("shared_index.deny_patterns[%d] is invalid: %w", i, err)
+		}
+	}
+
+	if mode == "index-per-tenant" {
+		if strings.TrimSpace(c.IndexPerTenant.IndexTemplate) == "" {
+			return fmt.Errorf("index_per_tenant.index_template is required in index-per-tenant mode")
+		}
+		if err := validateTenantTemplate("index_per_tenant.index_template", c.IndexPerTenant.IndexTemplate); err != nil {
+			return err
+		}
+	} else if c.IndexPerTenant.AutoCreate {
+		return fmt.Errorf("index_per_tenant.auto_create requires index-per-tenant mode")
+	}
+	for i, field := range c.IndexPerTenant.PercolatorFields {
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("index_per_tenant.percolator_fields[%d] must not be empty", i)
+		}
+	}
+	for i, field := range c.IndexPerTenant.SkipFields {
+		if strings.TrimSpace(strings.TrimSuffix(field, "*")) == "" {
+			return fmt.Errorf("index_per_tenant.skip_fields[%d] must not be empty", i)
+		}
+	}
+
+	if c.Auth.Required && strings.TrimSpace(c.Auth.Header) == "" {
+		return fmt.Errorf("auth.header is required when auth.required is true")
+	}
+	if basic := c.Auth.BasicAuth; basic.Enabled {
+		if len(basic.Users) == 0 && strings.TrimSpace(basic.HtpasswdPath) == "" {
+			return fmt.Errorf("auth.basic_auth.users or auth.basic_auth.htpasswd_path is required when auth.basic_auth.enabled is true")
+		}
+		users := make(map[string]bool, len(basic.Users))
+		for i, user := range basic.Users {
+			if user.Username == "" || strings.Contains(user.Username, ":") {
+				return fmt.Errorf("auth.basic_auth.users[%d].username must be non-empty and must not contain ':'", i)
+			}
+			if users[user.Username] {
+				return fmt.Errorf("auth.basic_auth.users[%d].username %q is configured twice", i, user.Username)
+			}
+			users[user.Username] = true
+			if user.Password == "" {
+				return fmt.Errorf("auth.basic_auth.users[%d].password is required", i)
+			}
+		}
+	}
+
+	if c.APIKeys.Enabled {
+		switch strings.ToLower(strings.TrimSpace(c.APIKeys.Store)) {
+		case "file":
+			if strings.TrimSpace(c.APIKeys.Path) == "" {
+				return fmt.Errorf("api_keys.path is required when api_keys.store is \"file\"")
+			}
+		case "index":
+			if strings.TrimSpace(c.APIKeys.Index) == "" {
+				return fmt.Errorf("api_keys.index is required when api_keys.store is \"index\"")
+			}
+		default:
+			return fmt.Errorf("api_keys.store must be \"file\" or \"index\" (got %q)", c.APIKeys.Store)
+		}
+	}
+
+	for i, operation := range c.Permissions.Default {
+		if !Operations[operation] {
+			return fmt.Errorf("permissions.default[%d] %q is not an operation", i, operation)
+		}
+	}
+	for tenant, operations := range c.Permissions.Tenants {
+		if strings.TrimSpace(tenant) == "" {
+			return fmt.Errorf("permissions.tenants must not have an empty tenant")
+		}
+		for i, operation := range operations {
+			if !Operations[operation] {
+				return fmt.Errorf("permissions.tenants.%s[%d] %q is not an operation", tenant, i, operation)
+			}
+		}
+	}
+
+	for tenant, ranges := range c.NetworkPolicy.Tenants {
+		if strings.TrimSpace(tenant) == "" {
+			return fmt.Errorf("network_policy.tenants must not have an empty tenant")
+		}
+		for i, value := range ranges {
+			if _, err := ParsePrefix(value); err != nil {
+				return fmt.Errorf("network_policy.tenants.%s[%d]: %w", tenant, i, err)
+			}
+		}
+	}
+	upstreams := make(map[string]bool, len(c.Upstreams))
+	for i, upstream := range c.Upstreams {
+		name := strings.TrimSpace(upstream.Name)
+		if name == "" {
+			return fmt.Errorf("upstreams[%d].name is required", i)
+		}
+		if upstreams[name] {
+			return fmt.Errorf("upstreams[%d].name %q is used more than once", i, name)
+		}
+		if name == "primary" || name == "shadow" {
+			return fmt.Errorf("upstreams[%d].name %q is reserved", i, name)
+		}
+		upstreams[name] = true
+		if _, err := url.ParseRequestURI(upstream.URL); err != nil {
+			return fmt.Errorf("upstreams[%d].url must be a valid URL: %w", i, err)
+		}
+	}
+	for tenant, settings := range c.Tenants {
+		if strings.TrimSpace(tenant) == "" {
+			return fmt.Errorf("tenants must not have an empty tenant")
+		}
+		if settings.Upstream != "" && !upstreams[settings.Upstream] {
+			return fmt.Errorf("tenants.%s.upstream %q is not in upstreams", tenant, settings.Upstream)
+		}
+		for i, operation := range settings.Permissions {
+			if !Operations[operation] {
+				return fmt.Errorf("tenants.%s.permissions[%d] %q is not an operation", tenant, i, operation)
+			}
+		}
+		for i, value := range settings.Networks {
+			if _, err := ParsePrefix(value); err != nil {
+				return fmt.Errorf("tenants.%s.networks[%d]: %w", tenant, i, err)
+			}
+		}
+	}
+	for i, value := range c.TrustedProxies {
+		if _, err := ParsePrefix(value); err != nil {
+			return fmt.Errorf("trusted_proxies[%d]: %w", i, err)
+		}
+	}
+	if c.TrustedProxyHeader != "" && !strings.EqualFold(c.TrustedProxyHeader, "X-Forwarded-For") && !strings.EqualFold(c.TrustedProxyHeader, "Forwarded") {
+		return fmt.Errorf("trusted_proxy_header must be \"X-Forwarded-For\" or \"Forwarded\" (got %q)", c.TrustedProxyHeader)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.Audit.Sink)) {
+	case "", "syslog":
+	case "file":
+		if strings.TrimSpace(c.Audit.Path) == "" {
+			return fmt.Errorf("audit.path is required when audit.sink is \"file\"")
+		}
+	case "index":
+		if strings.TrimSpace(c.Audit.Index) == "" {
+			return fmt.Errorf("audit.index is required when audit.sink is \"index\"")
+		}
+	default:
+		return fmt.Errorf("audit.sink must be \"file\", \"syslog\", or \"index\" (got %q)", c.Audit.Sink)
+	}
+
+	if c.Limits.MaxBodyBytes < 0 {
+		return fmt.Errorf("limits.max_body_bytes must not be negative")
+	}
+	if c.Limits.MaxBulkBodyBytes < 0 {
+		return fmt.Errorf("limits.max_bulk_body_bytes must not be negative")
+	}
+	if c.Bulk.SpoolMemoryBytes < 0 {
+		return fmt.Errorf("bulk.spool_memory_bytes must not be negative")
+	}
+	if c.Limits.MaxMultiSearchLineBytes < 0 {
+		return fmt.Errorf("limits.max_msearch_line_bytes must not be negative")
+	}
+	if c.Limits.MaxMultiSearchLines < 0 {
+		return fmt.Errorf("limits.max_msearch_lines must not be negative")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.Usage.Sink)) {
+	case "":
+	case "file":
+		if strings.TrimSpace(c.Usage.Path) == "" {
+			return fmt.Errorf("usage.path is required when usage.sink is \"file\"")
+		}
+	case "index":
+		if strings.TrimSpace(c.Usage.Index) == "" {
+			return fmt.Errorf("usage.index is required when usage.sink is \"index\"")
+		}
+	default:
+		return fmt.Errorf("usage.sink must be \"file\" or \"index\" (got %q)", c.Usage.Sink)
+	}
+	if c.Usage.Sink != "" && c.Usage.FlushIntervalSeconds <= 0 {
+		return fmt.Errorf("usage.flush_interval_seconds must be positive when usage.sink is set")
+	}
+
+	if c.SlowLog.SearchThresholdMs < 0 {
+		return fmt.Errorf("slow_log.search_threshold_ms must not be negative")
+	}
+	if c.SlowLog.BulkThresholdMs < 0 {
+		return fmt.Errorf("slow_log.bulk_threshold_ms must not be negative")
+	}
+	switch strings.ToLower(strings.TrimSpace(c.SlowLog.Query)) {
+	case "", "full", "hash", "none":
+	case "truncate":
+		if c.SlowLog.MaxQueryBytes <= 0 {
+			return fmt.Errorf("slow_log.max_query_bytes must be positive when slow_log.query is \"truncate\"")
+		}
+	default:
+		return fmt.Errorf("slow_log.query must be \"full\", \"truncate\", \"hash\", or \"none\" (got %q)", c.SlowLog.Query)
+	}
+	if c.SlowLog.Recent < 0 {
+		return fmt.Errorf("slow_log.recent must not be negative")
+	}
+
+	if c.Admin.ReadinessTimeoutSeconds < 0 {
+		return fmt.Errorf("admin.readiness_timeout_seconds must not be negative")
+	}
+	if c.Shutdown.DrainTimeoutSeconds < 0 {
+		return fmt.Errorf("shutdown.drain_timeout_seconds must not be negative")
+	}
+
+	if c.Lifecycle.NamespacePolicies && !strings.Contains(c.Lifecycle.PolicyTemplate, ".tenant") {
+		return fmt.Errorf("lifecycle.policy_template must reference {{.tenant}} when lifecycle.namespace_policies is true")
+	}
+	if c.Scripts.NamespaceScripts && !strings.Contains(c.Scripts.ScriptTemplate, ".tenant") {
+		return fmt.Errorf("scripts.script_template must reference {{.tenant}} when scripts.namespace_scripts is true")
+	}
+	if !strings.Contains(c.Ingest.Template(), ".tenant") {
+		return fmt.Errorf("ingest.pipeline_template must reference {{.tenant}}")
+	}
+
+	if c.ResponseCache.MaxEntries < 0 || c.ResponseCache.MaxBytes < 0 {
+		return fmt.Errorf("response_cache limits must not be negative")
+	}
+	if c.ResponseCache.MaxEntries > 0 && c.ResponseCache.TTLSeconds <= 0 {
+		return fmt.Errorf("response_cache.ttl_seconds must be positive when the cache is enabled")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.State.Store)) {
+	case "", "memory":
+	case "redis":
+		parsed, err := url.Parse(strings.TrimSpace(c.State.RedisURL))
+		if err != nil || (parsed.Scheme != "redis" && parsed.Scheme != "rediss") || parsed.Host == "" {
+			return fmt.Errorf("state.redis_url must be a redis:// or rediss:// URL when state.store is \"redis\"")
+		}
+	default:
+		return fmt.Errorf("state.store must be \"memory\" or \"redis\" (got %q)", c.State.Store)
+	}
+
+	if c.Timeouts.SearchSeconds < 0 || c.Timeouts.BulkSeconds < 0 || c.Timeouts.PassthroughSeconds < 0 || c.Timeouts.DefaultSeconds < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.TenantResolver.Type)) {
+	case "", "regex", "basic_auth":
+	case "header":
+		if strings.TrimSpace(c.TenantResolver.Header) == "" {
+			return fmt.Errorf("tenant_resolver.header is required when tenant_resolver.type is \"header\"")
+		}
+	case "jwt":
+		if strings.TrimSpace(c.TenantResolver.Claim) == "" {
+			return fmt.Errorf("tenant_resolver.claim is required when tenant_resolver.type is \"jwt\"")
+		}
+		if (c.TenantResolver.JWTSecret == "") == (strings.TrimSpace(c.TenantResolver.JWTPublicKeyPath) == "") {
+			return fmt.Errorf("tenant_resolver needs exactly one of jwt_secret and jwt_public_key_path when tenant_resolver.type is \"jwt\"")
+		}
+	default:
+		return fmt.Errorf("tenant_resolver.type must be \"regex\", \"header\", \"jwt\", or \"basic_auth\" (got %q)", c.TenantResolver.Type)
+	}
+
+	if c.RootInfo.Synthesize && !rootVersionPattern.MatchString(c.RootInfo.Version) {
+		return fmt.Errorf("root_info.version must be a version such as 8.13.4 when root_info.synthesize is true (got %q)", c.RootInfo.Version)
+	}
+
+	switch c.UnknownPaths.Action {
+	case "", "reject", "passthrough", "not_found":
+	default:
+		return fmt.Errorf("unknown_paths.action must be \"reject\", \"passthrough\", or \"not_found\" (got %q)", c.UnknownPaths.Action)
+	}
+	for _, ignored := range c.UnknownPaths.Ignore {
+		if !strings.HasPrefix(ignored, "/") {
+			return fmt.Errorf("unknown_paths.ignore entries must start with / (got %q)", ignored)
+		}
+	}
+
+	if c.ModeOverride.Enabled {
+		if strings.TrimSpace(c.ModeOverride.Header) == "" {
+			return fmt.Errorf("mode_override.header is required when mode_override.enabled is true")
+		}
+		if c.ModeOverride.Token != "" && strings.TrimSpace(c.ModeOverride.TokenHeader) == "" {
+			return fmt.Errorf("mode_override.token_header is required when mode_override.token is set")
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.Migration.Primary)) {
+	case "", "shared", "index-per-tenant":
+	default:
+		return fmt.Errorf("migration.primary must be \"shared\" or \"index-per-tenant\" (got %q)", c.Migration.Primary)
+	}
+	for _, tenant := range c.Migration.Tenants {
+		if strings.TrimSpace(tenant) == "" {
+			return fmt.Errorf("migration.tenants must not contain empty names")
+		}
+	}
+
+	if c.Shadow.UpstreamURL != "" {
+		if _, err := url.ParseRequestURI(c.Shadow.UpstreamURL); err != nil {
+			return fmt.Errorf("shadow.upstream_url must be a valid URL: %w", err)
+		}
+	}
+	if c.Shadow.Percent < 0 || c.Shadow.Percent > 100 {
+		return fmt.Errorf("shadow.percent must be between 0 and 100 (got %d)", c.Shadow.Percent)
+	}
+
+	for i, tenant := range c.ReservedTenants {
+		if strings.TrimSpace(tenant) == "" {
+			return fmt.Errorf("reserved_tenants[%d] must not be empty", i)
+		}
+	}
+
+	for i, rule := range c.Faults.Rules {
+		if rule.Percent < 0 || rule.Percent > 100 {
+			return fmt.Errorf("faults.rules[%d].percent must be between 0 and 100 (got %d)", i, rule.Percent)
+		}
+		switch strings.ToLower(strings.TrimSpace(rule.Action)) {
+		case "delay":
+			if rule.DelayMs <= 0 {
+				return fmt.Errorf("faults.rules[%d].delay_ms must be positive for the delay action", i)
+			}
+		case "drop":
+		case "error":
+			if rule.Status != 0 && (rule.Status < 400 || rule.Status > 599) {
+				return fmt.Errorf("faults.rules[%d].status must be between 400 and 599 (got %d)", i, rule.Status)
+			}
+		default:
+			return fmt.Errorf("faults.rules[%d].action must be \"delay\", \"drop\", or \"error\" (got %q)", i, rule.Action)
+		}
+	}
+
+	for i, name := range c.ResponseHeaders.Strip {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("response_headers.strip[%d] must not be empty", i)
+		}
+	}
+	for name := range c.ResponseHeaders.Set {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("response_headers.set must not contain empty header names")
+		}
+	}
+	cors := c.ResponseHeaders.CORS
+	for i, origin := range cors.AllowedOrigins {
+		if strings.TrimSpace(origin) == "" {
+			return fmt.Errorf("response_headers.cors.allowed_origins[%d] must not be empty", i)
+		}
+		if origin == "*" && cors.AllowCredentials {
+			return fmt.Errorf("response_headers.cors.allow_credentials cannot be used with the \"*\" origin")
+		}
+	}
+	if err := validateCORSMethods("response_headers.cors.allowed_methods", cors.AllowedMethods); err != nil {
+		return err
+	}
+	if cors.MaxAgeSeconds < 0 {
+		return fmt.Errorf("response_headers.cors.max_age_seconds must not be negative")
+	}
+	origins := make(map[string]bool, len(cors.Origins))
+	for i, rule := range cors.Origins {
+		origin := strings.TrimSpace(rule.Origin)
+		if origin == "" {
+			return fmt.Errorf("response_headers.cors.origins[%d].origin must not be empty", i)
+		}
+		if origins[origin] {
+			return fmt.Errorf("response_headers.cors.origins[%d].origin %q is configured twice", i, origin)
+		}
+		origins[origin] = true
+		credentials := cors.AllowCredentials
+		if rule.AllowCredentials != nil {
+			credentials = *rule.AllowCredentials
+		}
+		if origin == "*" && credentials {
+			return fmt.Errorf("response_headers.cors.origins[%d].allow_credentials cannot be used with the \"*\" origin", i)
+		}
+		if err := validateCORSMethods(fmt.Sprintf("response_headers.cors.origins[%d].allowed_methods", i), rule.AllowedMethods); err != nil {
+			return err
+		}
+	}
+
+	if c.IndexNames.MaxLength < 0 {
+		return fmt.Errorf("index_names.max_length must not be negative")
+	}
+	if c.BodyPreview.Enabled && c.BodyPreview.MaxBytes <= 0 {
+		return fmt.Errorf("body_preview.max_bytes must be positive")
+	}
+	if c.BodyPreview.RedactPattern != "" {
+		if _, err := regexp.Compile(c.BodyPreview.RedactPattern); err != nil {
+			return fmt.Errorf("body_preview.redact_pattern is invalid: %w", err)
+		}
+	}
+	if c.IndexNames.Pattern != "" {
+		if _, err := regexp.Compile(c.IndexNames.Pattern); err != nil {
+			return fmt.Errorf("index_names.pattern is invalid: %w", err)
+		}
+	}
+	for i, prefix := range c.IndexNames.ReservedPrefixes {
+		if strings.TrimSpace(prefix) == "" {
+			return fmt.Errorf("index_names.reserved_prefixes[%d] must not be empty", i)
+		}
+	}
+
+	return nil
+}
+
+// validateCORSMethods checks that methods are HTTP method tokens such as GET.
+func validateCORSMethods(key string, methods []string) error {
+	for i, method := range methods {
+		method = strings.TrimSpace(method)
+		if method == "" || strings.ToUpper(method) != method || strings.ContainsAny(method, " ,") {
+			return fmt.Errorf("%s[%d] must be an upper-case HTTP method (got %q)", key, i, method)
+		}
+	}
+	return nil
+}
+
+var templateAction = regexp.MustCompile(`\{\{[^}]*\}\}`)
+
+// validateTenantTemplate checks that a template rendering tenant names renders
+// distinct names for distinct tenants. It must reference {{.tenant}}, and a
+// literal must separate the tenant from other fields: with
+// "{{.index}}{{.tenant}}", index a of tenant bc and index ab of tenant c would
+// share the name abc.
+func validateTenantTemplate(field, text string) error {
+	if !strings.Contains(text, ".tenant") {
+		return fmt.Errorf("%s must reference {{.tenant}} (got %q)", field, text)
+	}
+	actions := templateAction.FindAllStringIndex(text, -1)
+	for i := 1; i < len(actions); i++ {
+		previous, current := actions[i-1], actions[i]
+		if previous[1] != current[0] {
+			continue
+		}
+		if strings.Contains(text[previous[0]:previous[1]], ".tenant") || strings.Contains(text[current[0]:current[1]], ".tenant") {
+			return fmt.Errorf("%s must separate {{.tenant}} from other fields with a literal (got %q)", field, text)
+		}
+	}
+	return nil
+}
+
+func validateRegexComplexity(pattern string) error {
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return fmt.Errorf("tenant_regex.pattern is invalid: %w", err)
+	}
+	if hasNestedQuantifiers(parsed, false) {
+		return fmt.Errorf("tenant_regex.pattern contains nested quantifiers and may be vulnerable to ReDoS")
+	}
+	return nil
+}
+
+func hasNestedQuantifiers(re *syntax.Regexp, inRepeat bool) bool {
+	if re == nil {
+		return false
+	}
+	isRepeat := re.Op == syntax.OpStar || re.Op == syntax.OpPlus || re.Op == syntax.OpQuest || re.Op == syntax.OpRepeat
+	if inRepeat && isRepeat {
+		return true
+	}
+	nextRepeat := inRepeat || isRepeat
+	for _, sub := range re.Sub {
+		if hasNestedQuantifiers(sub, nextRepeat) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePrefix parses a CIDR range such as 10.0.0.0/8, or a single address,
+// which is the range of that address alone.
+func ParsePrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR range %q", value)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q", value)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// unmarshalYAML decodes a YAML document into cfg, matching keys against the
+// yaml struct tags. Keys that match no field are an error; omitted and null
+// keys keep the values already in cfg.
+func unmarshalYAML(data []byte, cfg *Config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+	var next yaml.Node
+	if err := decoder.Decode(&next); !errors.Is(err, io.EOF) {
+		return errors.New("multiple documents are not supported")
+	}
+	return nil
+}
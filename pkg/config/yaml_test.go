@@ -0,0 +1,168 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleYAML = `# es-tmnt configuration
+ports:
+  http: 9300
+  admin: 0
+upstream_url: "http://elasticsearch:9200"
+mode: index-per-tenant
+verbose: true
+tenant_regex:
+  pattern: '^(?P<prefix>[^-]+)-(?P<tenant>[^-]+)(?P<postfix>.*)$'
+shared_index:
+  deny_patterns:
+  - ^shared-.*$
+  - "^internal-.*$"
+index_per_tenant:
+  index_template: "{{.tenant}}-{{.index}}"  # per tenant
+passthrough_paths: [/_cluster/health, "/_nodes"]
+limits: {max_body_bytes: 0x100000, max_bulk_body_bytes: 2097152}
+freeze:
+  message: >-
+    writes are frozen
+    for the reindex
+state:
+  store: memory
+  key_prefix:
+permissions:
+  tenants:
+    acme: [search]
+    globex: [search, index]
+upstreams:
+- name: eu
+  url: "http://elasticsearch-eu:9200"
+tenants:
+  acme:
+    upstream: eu
+    permissions: [search, index, delete]
+    networks: [10.0.0.0/8]
+  initech:
+    permissions: []
+`
+
+func TestLoadYAMLConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(sampleYAML), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv(envConfigPath, configPath)
+	t.Setenv(envHTTPPort, "9400")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.Ports.HTTP != 9400 || cfg.Ports.Admin != 0 {
+		t.Fatalf("unexpected ports: %+v", cfg.Ports)
+	}
+	if cfg.UpstreamURL != "http://elasticsearch:9200" || cfg.Mode != "index-per-tenant" || !cfg.Verbose {
+		t.Fatalf("unexpected top-level settings: %+v", cfg)
+	}
+	if cfg.TenantRegex.Compiled == nil || cfg.TenantRegex.Pattern != `^(?P<prefix>[^-]+)-(?P<tenant>[^-]+)(?P<postfix>.*)$` {
+		t.Fatalf("unexpected tenant regex: %+v", cfg.TenantRegex)
+	}
+	if !reflect.DeepEqual(cfg.SharedIndex.DenyPatterns, []string{"^shared-.*$", "^internal-.*$"}) || len(cfg.SharedIndex.DenyCompiled) != 2 {
+		t.Fatalf("unexpected deny patterns: %+v", cfg.SharedIndex.DenyPatterns)
+	}
+	if cfg.SharedIndex.AliasTemplate != "alias-{{.index}}-{{.tenant}}" {
+		t.Fatalf("expected defaults to be kept, got %+v", cfg.SharedIndex)
+	}
+	if cfg.IndexPerTenant.IndexTemplate != "{{.tenant}}-{{.index}}" {
+		t.Fatalf("unexpected index template: %q", cfg.IndexPerTenant.IndexTemplate)
+	}
+	if !reflect.DeepEqual(cfg.PassthroughPaths, []string{"/_cluster/health", "/_nodes"}) {
+		t.Fatalf("unexpected passthrough paths: %+v", cfg.PassthroughPaths)
+	}
+	if cfg.Limits.MaxBodyBytes != 1<<20 || cfg.Limits.MaxBulkBodyBytes != 2<<20 {
+		t.Fatalf("unexpected limits: %+v", cfg.Limits)
+	}
+	if cfg.Freeze.Message != "writes are frozen for the reindex" {
+		t.Fatalf("unexpected folded message: %q", cfg.Freeze.Message)
+	}
+	if cfg.State.KeyPrefix != "es-tmnt:" {
+		t.Fatalf("expected empty key to keep default, got %q", cfg.State.KeyPrefix)
+	}
+	if !reflect.DeepEqual(cfg.Upstreams, []Upstream{{Name: "eu", URL: "http://elasticsearch-eu:9200"}}) {
+		t.Fatalf("unexpected upstreams: %+v", cfg.Upstreams)
+	}
+	if cfg.Tenants["acme"].Upstream != "eu" || cfg.Tenants["initech"].Upstream != "" {
+		t.Fatalf("unexpected tenant settings: %+v", cfg.Tenants)
+	}
+	wantPermissions := map[string][]string{
+		"acme":    {"search", "index", "delete"},
+		"globex":  {"search", "index"},
+		"initech": {},
+	}
+	if got := cfg.TenantPermissions(); !reflect.DeepEqual(got, wantPermissions) {
+		t.Fatalf("unexpected tenant permissions: %+v", got)
+	}
+	if got := cfg.TenantNetworks(); !reflect.DeepEqual(got, map[string][]string{"acme": {"10.0.0.0/8"}}) {
+		t.Fatalf("unexpected tenant networks: %+v", got)
+	}
+}
+
+func TestLoadConfigWithoutExtensionTriesJSONThenYAML(t *testing.T) {
+	dir := t.TempDir()
+	for name, payload := range map[string]string{
+		"config-json": `{"Mode":"index-per-tenant"}`,
+		"config-yaml": "mode: index-per-tenant\n",
+	} {
+		configPath := filepath.Join(dir, name)
+		if err := os.WriteFile(configPath, []byte(payload), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		t.Setenv(envConfigPath, configPath)
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("load %s: %v", name, err)
+		}
+		if cfg.Mode != "index-per-tenant" {
+			t.Fatalf("expected %s to set mode, got %q", name, cfg.Mode)
+		}
+	}
+}
+
+func TestYAMLErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "unknown key", data: "ports:\n  https: 1\n", wantErr: "field https not found"},
+		{name: "bad integer", data: "ports:\n  http: eighty\n", wantErr: "cannot unmarshal !!str `eighty` into int"},
+		{name: "bad boolean", data: "verbose: maybe\n", wantErr: "cannot unmarshal !!str `maybe` into bool"},
+		{name: "sequence for string", data: "mode:\n  - shared\n", wantErr: "cannot unmarshal !!seq into string"},
+		{name: "tab indentation", data: "ports:\n\thttp: 1\n", wantErr: "line 2"},
+		{name: "duplicate key", data: "mode: shared\nmode: shared\n", wantErr: `mapping key "mode" already defined`},
+		{name: "unterminated quote", data: "mode: \"shared\n", wantErr: "found unexpected end of stream"},
+		{name: "unterminated flow", data: "passthrough_paths: [a, b\n", wantErr: "did not find expected ',' or ']'"},
+		{name: "multiple documents", data: "mode: shared\n---\nmode: shared\n", wantErr: "multiple documents are not supported"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			err := unmarshalYAML([]byte(tc.data), &cfg)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestYAMLEmptyDocumentKeepsDefaults(t *testing.T) {
+	cfg := Default()
+	if err := unmarshalYAML([]byte("# nothing set\n"), &cfg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Fatalf("expected defaults, got %+v", cfg)
+	}
+}
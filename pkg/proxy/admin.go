@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// AdminHandler serves the operational endpoints on the admin port. /healthz
+// and /readyz are open to load balancers; the /admin endpoints require admin
+// credentials when admin.token or admin.client_ca_path is set.
+func (p *Proxy) AdminHandler() http.Handler {
+	control := http.NewServeMux()
+	control.HandleFunc("/admin/usage", p.handleUsage)
+	control.HandleFunc("/admin/slowlog", p.handleSlowLog)
+	control.HandleFunc("/admin/freeze", p.handleFreeze)
+	control.HandleFunc("/admin/cache", p.handleCache)
+	control.HandleFunc("/admin/regexcache", p.handleRegexCache)
+	control.HandleFunc("/admin/tenants", p.handleTenants)
+	control.HandleFunc("/admin/tenants/", p.handleTenant)
+	control.HandleFunc("/admin/api_keys", p.handleAPIKeys)
+	control.HandleFunc("/admin/api_keys/", p.handleAPIKey)
+	control.HandleFunc("/admin/selftest", p.handleSelfTest)
+	control.HandleFunc("/admin/errors", p.handleErrorCatalogue)
+	control.HandleFunc("/admin/shadow", p.handleShadow)
+	if p.cfg.Admin.Diagnostics {
+		registerDiagnostics(control)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", p.handleHealthz)
+	mux.HandleFunc("/readyz", p.handleReadyz)
+	mux.Handle("/admin/", p.requireAdmin(control))
+	return mux
+}
+
+// requireAdmin admits requests with the admin token as a bearer token or with
+// a client certificate verified against admin.client_ca_path. Without either
+// configured, the control endpoints are open.
+func (p *Proxy) requireAdmin(next http.Handler) http.Handler {
+	token := p.cfg.Admin.Token
+	clientCerts := p.cfg.Admin.ClientCAPath != ""
+	if token == "" && !clientCerts {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if token != "" {
+			scheme, presented, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if ok && strings.EqualFold(scheme, "Bearer") && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(presented)), []byte(token)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="es-tmnt admin"`)
+		}
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "admin credentials are required")
+	})
+}
+
+// handleHealthz reports 503 while draining so load balancers stop routing new
+// requests to the proxy.
+func (p *Proxy) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if p.drain != nil && p.drain.isDraining() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":    "draining",
+			"in_flight": p.drain.inFlight(),
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleUsage reports the usage counters of the tenant given by the tenant
+// query parameter, or of every tenant without it.
+func (p *Proxy) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for usage")
+		return
+	}
+	usage := p.usage
+	if usage == nil {
+		usage = newUsageTracker()
+	}
+	if tenantID := strings.TrimSpace(r.URL.Query().Get("tenant")); tenantID != "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"tenant": tenantID,
+			"usage":  usage.get(tenantID),
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tenants": usage.snapshot()})
+}
+
+// handleSlowLog lists the most recent slow queries, newest first, optionally
+// limited to the tenant given by the tenant query parameter.
+func (p *Proxy) handleSlowLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for slowlog")
+		return
+	}
+	queries := []slowQuery{}
+	if p.slowLog != nil {
+		queries = p.slowLog.recent(strings.TrimSpace(r.URL.Query().Get("tenant")))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"slow_queries": queries})
+}
+
+// handleCache reports the response cache counters on GET and drops the cached
+// responses of the tenant given by the tenant query parameter, or all of them
+// without it, on DELETE.
+func (p *Proxy) handleCache(w http.ResponseWriter, r *http.Request) {
+	if p.cache == nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "response cache is disabled")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		p.cache.invalidate(strings.TrimSpace(r.URL.Query().Get("tenant")), "")
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for cache")
+		return
+	}
+	writeJSON(w, http.StatusOK, p.cache.stats())
+}
+
+// handleRegexCache reports the tenant regex match cache counters on GET and
+// drops the cached matches on DELETE.
+func (p *Proxy) handleRegexCache(w http.ResponseWriter, r *http.Request) {
+	if p.matches == nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "regex cache is disabled")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		p.matches.reset()
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for regexcache")
+		return
+	}
+	writeJSON(w, http.StatusOK, p.matches.stats())
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
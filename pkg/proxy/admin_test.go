@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestAdminAuthentication(t *testing.T) {
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	tests := []struct {
+		name       string
+		admin      config.Admin
+		path       string
+		auth       string
+		tls        *tls.ConnectionState
+		wantStatus int
+	}{
+		{name: "open without credentials configured", path: "/admin/errors", wantStatus: http.StatusOK},
+		{name: "missing token", admin: config.Admin{Token: "secret"}, path: "/admin/errors", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", admin: config.Admin{Token: "secret"}, path: "/admin/errors", auth: "Bearer other", wantStatus: http.StatusUnauthorized},
+		{name: "token", admin: config.Admin{Token: "secret"}, path: "/admin/errors", auth: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "basic credentials", admin: config.Admin{Token: "secret"}, path: "/admin/errors", auth: "Basic c2VjcmV0", wantStatus: http.StatusUnauthorized},
+		{name: "healthz stays open", admin: config.Admin{Token: "secret"}, path: "/healthz", wantStatus: http.StatusOK},
+		{name: "unverified client", admin: config.Admin{ClientCAPath: "ca.pem"}, path: "/admin/errors", tls: &tls.ConnectionState{}, wantStatus: http.StatusUnauthorized},
+		{name: "verified client certificate", admin: config.Admin{ClientCAPath: "ca.pem"}, path: "/admin/errors", tls: verified, wantStatus: http.StatusOK},
+		{name: "token or certificate", admin: config.Admin{Token: "secret", ClientCAPath: "ca.pem"}, path: "/admin/errors", auth: "Bearer secret", tls: &tls.ConnectionState{}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Admin = tt.admin
+			proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{}`))
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			req.TLS = tt.tls
+			rec := httptest.NewRecorder()
+			proxyHandler.AdminHandler().ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code == http.StatusUnauthorized && tt.admin.Token != "" && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Fatalf("expected a bearer challenge")
+			}
+		})
+	}
+}
@@ -0,0 +1,458 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// aliasManager maintains the filtered tenant aliases that shared mode routes
+// reads through. Aliases are created when a tenant creates its index and removed
+// when the tenant deletes it.
+type aliasManager struct {
+	upstream *upstreamClient
+}
+
+func newAliasManager(upstream *upstreamClient) *aliasManager {
+	return &aliasManager{upstream: upstream}
+}
+
+func (m *aliasManager) addAliasBody(index, alias, tenantField, tenantID string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"actions": []interface{}{
+			map[string]interface{}{
+				"add": map[string]interface{}{
+					"index": index,
+					"alias": alias,
+					"filter": map[string]interface{}{
+						"term": map[string]interface{}{tenantField: tenantID},
+					},
+				},
+			},
+		},
+	})
+}
+
+func (m *aliasManager) removeAliasBody(index, alias string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"actions": []interface{}{
+			map[string]interface{}{
+				"remove": map[string]interface{}{
+					"index": index,
+					"alias": alias,
+				},
+			},
+		},
+	})
+}
+
+func (m *aliasManager) exists(ctx context.Context, header http.Header, alias string) (bool, error) {
+	resp, err := m.upstream.do(ctx, header, http.MethodHead, "/_alias/"+url.PathEscape(alias), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status %d checking alias %s", resp.StatusCode, alias)
+	}
+}
+
+func (m *aliasManager) add(ctx context.Context, header http.Header, index, alias, tenantField, tenantID string) error {
+	body, err := m.addAliasBody(index, alias, tenantField, tenantID)
+	if err != nil {
+		return err
+	}
+	resp, err := m.upstream.do(ctx, header, http.MethodPost, "/_aliases", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status %d creating alias %s: %s", resp.StatusCode, alias, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// remove deletes alias from index. A missing alias is not an error.
+func (m *aliasManager) remove(ctx context.Context, header http.Header, index, alias string) error {
+	body, err := m.removeAliasBody(index, alias)
+	if err != nil {
+		return err
+	}
+	resp, err := m.upstream.do(ctx, header, http.MethodPost, "/_aliases", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status %d removing alias %s: %s", resp.StatusCode, alias, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// ensureTenantAlias runs after a shared-mode index create. The shared index is
+// created once, so an already-exists error from a later tenant is answered by
+// adding that tenant's alias instead.
+func (p *Proxy) ensureTenantAlias(resp *http.Response, state *requestState) error {
+	created := resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices
+	if !created {
+		if resp.StatusCode != http.StatusBadRequest {
+			return nil
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if !bytes.Contains(body, []byte("resource_already_exists_exception")) {
+			return nil
+		}
+		exists, err := p.tenantAliases(state.tenantID).exists(resp.Request.Context(), resp.Request.Header, state.alias)
+		if err != nil {
+			return fmt.Errorf("check tenant alias %s: %w", state.alias, err)
+		}
+		if exists {
+			return nil
+		}
+	}
+	if err := p.tenantAliases(state.tenantID).add(resp.Request.Context(), resp.Request.Header, state.target, state.alias, p.tenantField(state.baseIndex), state.tenantID); err != nil {
+		return fmt.Errorf("create tenant alias %s: %w", state.alias, err)
+	}
+	p.logRequestVerbose(resp.Request, "tenant alias created: %s -> %s", state.alias, state.target)
+	body, err := json.Marshal(map[string]interface{}{
+		"acknowledged":        true,
+		"shards_acknowledged": true,
+		"index":               state.index,
+	})
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	resp.StatusCode = http.StatusOK
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Type", "application/json")
+	p.replaceResponseBody(resp, body)
+	return nil
+}
+
+// handleAliasActions serves POST /_aliases. Index and alias names in every
+// action are rewritten for the tenant, which must be the same across all
+// actions. Shared mode adds the tenant filter to every alias it creates so an
+// alias never exposes the shared index unfiltered.
+func (p *Proxy) handleAliasActions(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		p.reject(w, codeInvalidJSON, "invalid JSON body")
+		return
+	}
+	actions, ok := payload["actions"].([]interface{})
+	if !ok || len(actions) == 0 {
+		p.reject(w, codeInvalidRequest, "alias actions are required")
+		return
+	}
+	tenantID := ""
+	for _, item := range actions {
+		action, ok := item.(map[string]interface{})
+		if !ok || len(action) != 1 {
+			p.reject(w, codeInvalidRequest, "invalid alias action")
+			return
+		}
+		for name, value := range action {
+			params, ok := value.(map[string]interface{})
+			if !ok {
+				p.reject(w, codeInvalidRequest, "invalid alias action")
+				return
+			}
+			if err := p.rewriteAliasAction(r, name, params, &tenantID); err != nil {
+				p.rejectError(w, err)
+				return
+			}
+		}
+	}
+	body, err = json.Marshal(payload)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	p.proxy.ServeHTTP(w, r)
+}
+
+// rewriteAliasAction rewrites one add, remove, or remove_index action in place.
+// tenantID carries the tenant resolved by earlier actions.
+func (p *Proxy) rewriteAliasAction(r *http.Request, name string, params map[string]interface{}, tenantID *string) error {
+	switch name {
+	case "add", "remove":
+	case "remove_index":
+		if isSharedMode(p.cfg.Mode) {
+			return errors.New("remove_index alias actions are not supported in shared mode")
+		}
+	default:
+		return fmt.Errorf("unsupported alias action: %s", name)
+	}
+	var baseIndices []string
+	for _, key := range []string{"index", "indices"} {
+		value, ok := params[key]
+		if !ok {
+			continue
+		}
+		names, err := aliasActionNames(value)
+		if err != nil {
+			return err
+		}
+		targets := make([]interface{}, 0, len(names))
+		for _, indexName := range names {
+			baseIndex, err := p.aliasActionTenant(r, indexName, tenantID)
+			if err != nil {
+				return err
+			}
+			target, err := p.renderTargetIndex(baseIndex, *tenantID)
+			if err != nil {
+				return err
+			}
+			if !containsString(baseIndices, baseIndex) {
+				baseIndices = append(baseIndices, baseIndex)
+			}
+			targets = append(targets, target)
+		}
+		if key == "index" {
+			params[key] = targets[0]
+		} else {
+			params[key] = targets
+		}
+	}
+	if len(baseIndices) == 0 {
+		return fmt.Errorf("%s alias action requires an index", name)
+	}
+	if name == "remove_index" {
+		return nil
+	}
+	hasAlias := false
+	for _, key := range []string{"alias", "aliases"} {
+		value, ok := params[key]
+		if !ok {
+			continue
+		}
+		names, err := aliasActionNames(value)
+		if err != nil {
+			return err
+		}
+		aliases := make([]interface{}, 0, len(names))
+		for _, aliasName := range names {
+			baseAlias, err := p.aliasActionTenant(r, aliasName, tenantID)
+			if err != nil {
+				return err
+			}
+			alias, err := p.renderQueryIndex(baseAlias, *tenantID)
+			if err != nil {
+				return err
+			}
+			aliases = append(aliases, alias)
+		}
+		hasAlias = true
+		if key == "alias" {
+			params[key] = aliases[0]
+		} else {
+			params[key] = aliases
+		}
+	}
+	if !hasAlias {
+		return fmt.Errorf("%s alias action requires an alias", name)
+	}
+	if name == "add" {
+		return p.rewriteAliasFilter(params, baseIndices, *tenantID)
+	}
+	return nil
+}
+
+// aliasActionTenant resolves an index or alias name of an alias action and
+// checks it belongs to the tenant of the other names in the request.
+func (p *Proxy) aliasActionTenant(r *http.Request, name string, tenantID *string) (string, error) {
+	if strings.ContainsAny(name, "*?,") {
+		return "", withCode(codeMultiIndexUnsupported, fmt.Errorf("alias actions must not use patterns: %s", name))
+	}
+	baseName, nameTenant, err := p.parseIndex(r, name)
+	if err != nil {
+		return "", err
+	}
+	if *tenantID == "" {
+		*tenantID = nameTenant
+	} else if *tenantID != nameTenant {
+		return "", withCode(codeMultipleTenants, fmt.Errorf("alias actions reference multiple tenants: %s and %s", *tenantID, nameTenant))
+	}
+	return baseName, nil
+}
+
+// rewriteAliasFilter scopes the filter of an alias being added: shared mode
+// wraps it with the tenant filter and index-per-tenant mode prefixes its fields.
+func (p *Proxy) rewriteAliasFilter(params map[string]interface{}, baseIndices []string, tenantID string) error {
+	filter, hasFilter := params["filter"]
+	if hasFilter {
+		if err := p.validateQueryValue(filter); err != nil {
+			return err
+		}
+	}
+	if isSharedMode(p.cfg.Mode) {
+		tenantField, err := p.commonTenantField(baseIndices)
+		if err != nil {
+			return err
+		}
+		params["filter"] = addTenantFilter(filter, tenantField, tenantID)
+		return nil
+	}
+	if !hasFilter || !p.wrapSource() {
+		return nil
+	}
+	if len(baseIndices) != 1 {
+		return errors.New("alias filters over multiple indices are not supported")
+	}
+	params["filter"] = p.rewriteQueryValue(filter, baseIndices[0])
+	return nil
+}
+
+func aliasActionNames(value interface{}) ([]string, error) {
+	switch typed := value.(type) {
+	case string:
+		return []string{typed}, nil
+	case []interface{}:
+		names := make([]string, 0, len(typed))
+		for _, item := range typed {
+			name, ok := item.(string)
+			if !ok {
+				return nil, errors.New("alias action names must be strings")
+			}
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return nil, errors.New("alias action names must not be empty")
+		}
+		return names, nil
+	default:
+		return nil, errors.New("alias action names must be strings")
+	}
+}
+
+// handleIndexAlias serves /{index}/_alias and /{index}/_alias/{name}. The alias
+// name must belong to the index's tenant and is namespaced like the index, so
+// it resolves the same way when used as a search target.
+func (p *Proxy) handleIndexAlias(w http.ResponseWriter, r *http.Request, index string, segments []string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	switch len(segments) {
+	case 2:
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			p.reject(w, codeInvalidRequest, "missing alias name")
+			return
+		}
+		p.setPathSegments(r, []string{targetIndex, segments[1]})
+		p.setResponseKind(r, responseKindAliases, baseIndex, tenantID)
+		p.proxy.ServeHTTP(w, r)
+		return
+	case 3:
+	default:
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "unsupported endpoint")
+		return
+	}
+	aliasTenant := tenantID
+	baseAlias, err := p.aliasActionTenant(r, segments[2], &aliasTenant)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	alias, err := p.renderQueryIndex(baseAlias, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		var params map[string]interface{}
+		if r.Body != nil {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				p.reject(w, codeBodyReadFailed, "failed to read body")
+				return
+			}
+			if len(bytes.TrimSpace(body)) != 0 {
+				if err := json.Unmarshal(body, &params); err != nil {
+					p.reject(w, codeInvalidJSON, "invalid JSON body")
+					return
+				}
+			}
+		}
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		if err := p.rewriteAliasFilter(params, []string{baseIndex}, tenantID); err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		body, err := json.Marshal(params)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		setBodyContentType(r, mediaTypeJSON)
+	}
+	p.setPathSegments(r, []string{targetIndex, segments[1], alias})
+	p.proxy.ServeHTTP(w, r)
+}
+
+// filterTenantAliases drops the aliases of other tenants from a get alias
+// response for the shared index.
+func (p *Proxy) filterTenantAliases(payload map[string]interface{}, tenantID string) bool {
+	changed := false
+	for _, value := range payload {
+		entry, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		aliases, ok := entry["aliases"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for alias := range aliases {
+			if aliasTenant, ok := p.tenantIDForAlias(alias); !ok || aliasTenant != tenantID {
+				delete(aliases, alias)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,320 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+type aliasUpstream struct {
+	mu          sync.Mutex
+	createCode  int
+	aliasExists bool
+	aliasCode   int
+	aliasBodies []string
+	authHeaders []string
+}
+
+func (u *aliasUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodPut:
+		if u.createCode == http.StatusBadRequest {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"error":{"type":"resource_already_exists_exception"},"status":400}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"acknowledged":true,"shards_acknowledged":true,"index":"shared-products"}`)
+	case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/_alias/"):
+		if !u.aliasExists {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPost && r.URL.Path == "/_aliases":
+		u.aliasBodies = append(u.aliasBodies, string(body))
+		u.authHeaders = append(u.authHeaders, r.Header.Get("Authorization"))
+		if u.aliasCode != 0 {
+			w.WriteHeader(u.aliasCode)
+		}
+		_, _ = io.WriteString(w, `{"acknowledged":true}`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newAliasTestProxy(t *testing.T, upstream *aliasUpstream) *Proxy {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	return newProxyWithUpstream(t, cfg, upstream)
+}
+
+func TestIndexCreateSharedAddsTenantAlias(t *testing.T) {
+	upstream := &aliasUpstream{}
+	proxyHandler := newAliasTestProxy(t, upstream)
+
+	req := httptest.NewRequest(http.MethodPut, "/products-tenant1", nil)
+	req.Header.Set("Authorization", "Basic dGVzdDp0ZXN0")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if len(upstream.aliasBodies) != 1 {
+		t.Fatalf("expected one alias request, got %d", len(upstream.aliasBodies))
+	}
+	var actions map[string]interface{}
+	if err := json.Unmarshal([]byte(upstream.aliasBodies[0]), &actions); err != nil {
+		t.Fatalf("parse alias body: %v", err)
+	}
+	add := actions["actions"].([]interface{})[0].(map[string]interface{})["add"].(map[string]interface{})
+	if add["index"] != "shared-products" || add["alias"] != "alias-products-tenant1" {
+		t.Fatalf("unexpected alias action: %v", add)
+	}
+	term := add["filter"].(map[string]interface{})["term"].(map[string]interface{})
+	if term["tenant_id"] != "tenant1" {
+		t.Fatalf("expected tenant filter on alias, got %v", add["filter"])
+	}
+	if upstream.authHeaders[0] != "Basic dGVzdDp0ZXN0" {
+		t.Fatalf("expected credentials forwarded, got %q", upstream.authHeaders[0])
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if payload["index"] != "products-tenant1" || payload["acknowledged"] != true {
+		t.Fatalf("unexpected create response: %v", payload)
+	}
+}
+
+func TestIndexCreateSharedExistingIndexAddsAlias(t *testing.T) {
+	upstream := &aliasUpstream{createCode: http.StatusBadRequest}
+	proxyHandler := newAliasTestProxy(t, upstream)
+
+	req := httptest.NewRequest(http.MethodPut, "/products-tenant2", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if len(upstream.aliasBodies) != 1 || !strings.Contains(upstream.aliasBodies[0], `"alias-products-tenant2"`) {
+		t.Fatalf("expected tenant alias created, got %v", upstream.aliasBodies)
+	}
+}
+
+func TestIndexCreateSharedExistingAliasKeepsError(t *testing.T) {
+	upstream := &aliasUpstream{createCode: http.StatusBadRequest, aliasExists: true}
+	proxyHandler := newAliasTestProxy(t, upstream)
+
+	req := httptest.NewRequest(http.MethodPut, "/products-tenant1", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "resource_already_exists_exception") {
+		t.Fatalf("expected upstream error kept, got %s", rec.Body.String())
+	}
+	if len(upstream.aliasBodies) != 0 {
+		t.Fatalf("expected no alias requests, got %v", upstream.aliasBodies)
+	}
+}
+
+func TestIndexCreateSharedAliasFailure(t *testing.T) {
+	upstream := &aliasUpstream{aliasCode: http.StatusForbidden}
+	proxyHandler := newAliasTestProxy(t, upstream)
+
+	req := httptest.NewRequest(http.MethodPut, "/products-tenant1", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected status 502, got %d", rec.Code)
+	}
+}
+
+func TestIndexDeleteSharedRemovesTenantAlias(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodDelete, "/products-tenant1", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	path, _, body, method, count := capture.snapshot()
+	if count != 1 || method != http.MethodPost || path != "/_aliases" {
+		t.Fatalf("expected a single alias request, got %d %s %s", count, method, path)
+	}
+	var actions map[string]interface{}
+	if err := json.Unmarshal(body, &actions); err != nil {
+		t.Fatalf("parse alias body: %v", err)
+	}
+	remove := actions["actions"].([]interface{})[0].(map[string]interface{})["remove"].(map[string]interface{})
+	if remove["index"] != "shared-products" || remove["alias"] != "alias-products-tenant1" {
+		t.Fatalf("unexpected alias action: %v", remove)
+	}
+}
+
+func TestAliasActionsShared(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"actions":[{"add":{"index":"products-tenant1","alias":"recent-tenant1","filter":{"term":{"color":"red"}}}},{"remove":{"indices":["products-tenant1"],"aliases":["old-tenant1"]}}]}`
+	req := httptest.NewRequest(http.MethodPost, "/_aliases", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, _, _ := capture.snapshot()
+	if path != "/_aliases" {
+		t.Fatalf("expected /_aliases, got %s", path)
+	}
+	var payload struct {
+		Actions []map[string]map[string]interface{} `json:"actions"`
+	}
+	if err := json.Unmarshal(captured, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	add := payload.Actions[0]["add"]
+	if add["index"] != "shared-products" || add["alias"] != "alias-recent-tenant1" {
+		t.Fatalf("unexpected add action: %v", add)
+	}
+	filter, _ := json.Marshal(add["filter"])
+	if !strings.Contains(string(filter), `{"term":{"tenant_id":"tenant1"}}`) || !strings.Contains(string(filter), `"color":"red"`) {
+		t.Fatalf("expected tenant filter combined with the alias filter, got %s", filter)
+	}
+	remove := payload.Actions[1]["remove"]
+	indices, _ := json.Marshal(remove["indices"])
+	aliases, _ := json.Marshal(remove["aliases"])
+	if string(indices) != `["shared-products"]` || string(aliases) != `["alias-old-tenant1"]` {
+		t.Fatalf("unexpected remove action: %v", remove)
+	}
+}
+
+func TestAliasActionsIndexPerTenantPrefixesFilter(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.tenant}}-{{.index}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"actions":[{"add":{"index":"products-tenant1","alias":"recent-tenant1","filter":{"term":{"color":"red"}}}},{"remove_index":{"index":"old-tenant1"}}]}`
+	req := httptest.NewRequest(http.MethodPost, "/_aliases", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	_, _, captured, _, _ := capture.snapshot()
+	want := `{"actions":[{"add":{"alias":"tenant1-recent","filter":{"term":{"products.color":"red"}},"index":"tenant1-products"}},{"remove_index":{"index":"tenant1-old"}}]}`
+	if string(captured) != want {
+		t.Fatalf("expected %s, got %s", want, captured)
+	}
+}
+
+func TestAliasActionsRejected(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{name: "cross tenant alias", body: `{"actions":[{"add":{"index":"products-tenant1","alias":"recent-tenant2"}}]}`, wantErr: "multiple tenants"},
+		{name: "cross tenant action", body: `{"actions":[{"add":{"index":"products-tenant1","alias":"a-tenant1"}},{"remove":{"index":"products-tenant2","alias":"a-tenant2"}}]}`, wantErr: "multiple tenants"},
+		{name: "pattern", body: `{"actions":[{"remove":{"index":"products-*","alias":"a-tenant1"}}]}`, wantErr: "must not use patterns"},
+		{name: "remove index", body: `{"actions":[{"remove_index":{"index":"products-tenant1"}}]}`, wantErr: "not supported in shared mode"},
+		{name: "unknown action", body: `{"actions":[{"swap":{"index":"products-tenant1"}}]}`, wantErr: "unsupported alias action"},
+		{name: "missing alias", body: `{"actions":[{"add":{"index":"products-tenant1"}}]}`, wantErr: "requires an alias"},
+		{name: "missing actions", body: `{}`, wantErr: "alias actions are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_aliases", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Fatalf("expected rejection containing %q, got %d: %s", tt.wantErr, rec.Code, rec.Body.String())
+			}
+		})
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+}
+
+func TestIndexAliasPutShared(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodPut, "/products-tenant1/_alias/recent-tenant1", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, method, _ := capture.snapshot()
+	if method != http.MethodPut || path != "/shared-products/_alias/alias-recent-tenant1" {
+		t.Fatalf("unexpected upstream request %s %s", method, path)
+	}
+	if string(captured) != `{"filter":{"bool":{"filter":[{"term":{"tenant_id":"tenant1"}}]}}}` {
+		t.Fatalf("expected tenant filter body, got %s", captured)
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/products-tenant1/_alias/recent-tenant2", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "multiple tenants") {
+		t.Fatalf("expected cross-tenant alias rejection, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestIndexAliasGetSharedFiltersTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	var gotPath string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		jsonUpstream(http.StatusOK, `{"shared-products":{"aliases":{"alias-products-tenant1":{},"alias-recent-tenant1":{},"alias-products-tenant2":{}}}}`).ServeHTTP(w, r)
+	})
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products-tenant1/_alias", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if gotPath != "/shared-products/_alias" {
+		t.Fatalf("expected shared index path, got %s", gotPath)
+	}
+	if strings.Contains(rec.Body.String(), "tenant2") || !strings.Contains(rec.Body.String(), "alias-recent-tenant1") {
+		t.Fatalf("expected only tenant1 aliases, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,586 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+// API key permissions. Keys grant exactly the permissions they were minted
+// with; admin does not imply write, nor write read.
+const (
+	permissionRead  = "read"
+	permissionWrite = "write"
+	permissionAdmin = "admin"
+)
+
+// apiKeyCacheTTL is how long keys read from the index store are trusted before
+// they are read again, so keys invalidated on another replica stop working.
+const apiKeyCacheTTL = 30 * time.Second
+
+var errAPIKeyNotFound = errors.New("api key not found")
+
+// apiKey is a stored API key. Only the SHA-256 hash of its secret is kept.
+type apiKey struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name,omitempty"`
+	Tenant      string    `json:"tenant"`
+	Permissions []string  `json:"permissions"`
+	Operations  []string  `json:"operations,omitempty"`
+	Hash        string    `json:"hash"`
+	Created     time.Time `json:"created"`
+}
+
+func (k apiKey) allows(permission string) bool {
+	for _, granted := range k.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// view is the key as the admin endpoint lists it, without its hash.
+func (k apiKey) view() map[string]interface{} {
+	view := map[string]interface{}{
+		"id":          k.ID,
+		"tenant":      k.Tenant,
+		"permissions": k.Permissions,
+		"created":     k.Created,
+	}
+	if k.Name != "" {
+		view["name"] = k.Name
+	}
+	if len(k.Operations) > 0 {
+		view["operations"] = k.Operations
+	}
+	return view
+}
+
+// apiKeyStore keeps API keys. Implementations must be safe for concurrent use.
+type apiKeyStore interface {
+	get(ctx context.Context, id string) (apiKey, error)
+	list(ctx context.Context) ([]apiKey, error)
+	put(ctx context.Context, key apiKey) error
+	delete(ctx context.Context, id string) error
+}
+
+func newAPIKeyStore(cfg config.APIKeys, upstream *upstreamClient) (apiKeyStore, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.Store)) {
+	case "file":
+		return newFileAPIKeyStore(cfg.Path)
+	case "index":
+		return newIndexAPIKeyStore(upstream, cfg.Index), nil
+	default:
+		return nil, fmt.Errorf("unsupported api key store %q", cfg.Store)
+	}
+}
+
+// fileAPIKeyStore keeps the keys in memory and rewrites the whole JSON file
+// whenever they change.
+type fileAPIKeyStore struct {
+	mu   sync.RWMutex
+	path string
+	keys map[string]apiKey
+}
+
+func newFileAPIKeyStore(path string) (*fileAPIKeyStore, error) {
+	store := &fileAPIKeyStore{path: path, keys: make(map[string]apiKey)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read api key file: %w", err)
+	}
+	var keys []apiKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse api key file %s: %w", path, err)
+	}
+	for _, key := range keys {
+		store.keys[key.ID] = key
+	}
+	return store, nil
+}
+
+func (s *fileAPIKeyStore) get(_ context.Context, id string) (apiKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return apiKey{}, errAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *fileAPIKeyStore) list(context.Context) ([]apiKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]apiKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *fileAPIKeyStore) put(_ context.Context, key apiKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, key.ID)
+		return err
+	}
+	return nil
+}
+
+func (s *fileAPIKeyStore) delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return errAPIKeyNotFound
+	}
+	delete(s.keys, id)
+	if err := s.save(); err != nil {
+		s.keys[id] = key
+		return err
+	}
+	return nil
+}
+
+// save writes the keys to a temporary file renamed over the key file, so a
+// crash never leaves a truncated file. The caller holds the lock.
+func (s *fileAPIKeyStore) save() error {
+	keys := make([]apiKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("write api key file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write api key file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write api key file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("write api key file: %w", err)
+	}
+	return nil
+}
+
+// indexAPIKeyStore keeps the keys as documents of an upstream index, so every
+// proxy replica sees the keys minted on any of them. Lookups are cached for
+// apiKeyCacheTTL.
+type indexAPIKeyStore struct {
+	upstream *upstreamClient
+	index    string
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedAPIKey
+}
+
+// cachedAPIKey is a lookup result; found is false for ids the index does not
+// hold, so unknown ids do not reach the upstream on every request.
+type cachedAPIKey struct {
+	key     apiKey
+	found   bool
+	fetched time.Time
+}
+
+const maxCachedAPIKeys = 10000
+
+func newIndexAPIKeyStore(upstream *upstreamClient, index string) *indexAPIKeyStore {
+	return &indexAPIKeyStore{upstream: upstream, index: index, now: time.Now, cache: make(map[string]cachedAPIKey)}
+}
+
+func (s *indexAPIKeyStore) get(ctx context.Context, id string) (apiKey, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[id]
+	s.mu.Unlock()
+	if ok && s.now().Sub(cached.fetched) < apiKeyCacheTTL {
+		if !cached.found {
+			return apiKey{}, errAPIKeyNotFound
+		}
+		return cached.key, nil
+	}
+	var doc struct {
+		Found  bool   `json:"found"`
+		Source apiKey `json:"_source"`
+	}
+	status, err := s.request(ctx, http.MethodGet, "/_doc/"+url.PathEscape(id), nil, &doc)
+	if err != nil && status != http.StatusNotFound {
+		return apiKey{}, err
+	}
+	s.remember(id, cachedAPIKey{key: doc.Source, found: doc.Found, fetched: s.now()})
+	if !doc.Found {
+		return apiKey{}, errAPIKeyNotFound
+	}
+	return doc.Source, nil
+}
+
+func (s *indexAPIKeyStore) list(ctx context.Context) ([]apiKey, error) {
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source apiKey `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	status, err := s.request(ctx, http.MethodGet, "/_search?size=10000", nil, &result)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]apiKey, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		keys = append(keys, hit.Source)
+	}
+	return keys, nil
+}
+
+func (s *indexAPIKeyStore) put(ctx context.Context, key apiKey) error {
+	body, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	if _, err := s.request(ctx, http.MethodPut, "/_doc/"+url.PathEscape(key.ID)+"?refresh=wait_for", body, nil); err != nil {
+		return err
+	}
+	s.remember(key.ID, cachedAPIKey{key: key, found: true, fetched: s.now()})
+	return nil
+}
+
+func (s *indexAPIKeyStore) delete(ctx context.Context, id string) error {
+	status, err := s.request(ctx, http.MethodDelete, "/_doc/"+url.PathEscape(id)+"?refresh=wait_for", nil, nil)
+	if status == http.StatusNotFound {
+		return errAPIKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.remember(id, cachedAPIKey{fetched: s.now()})
+	return nil
+}
+
+func (s *indexAPIKeyStore) remember(id string, entry cachedAPIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= maxCachedAPIKeys {
+		s.cache = make(map[string]cachedAPIKey)
+	}
+	s.cache[id] = entry
+}
+
+// request calls the key index, decoding a successful response into out. It
+// returns the status along with an error for any other response.
+func (s *indexAPIKeyStore) request(ctx context.Context, method, pathValue string, body []byte, out interface{}) (int, error) {
+	resp, err := s.upstream.do(ctx, nil, method, "/"+url.PathEscape(s.index)+pathValue, body)
+	if err != nil {
+		return 0, fmt.Errorf("api key index: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("api key index: %w", err)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		if out != nil && resp.StatusCode == http.StatusNotFound {
+			_ = json.Unmarshal(data, out)
+		}
+		return resp.StatusCode, fmt.Errorf("api key index: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("api key index: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// apiKeyCredentials returns the id and secret of an Authorization: ApiKey
+// header, which holds base64(id:secret).
+func apiKeyCredentials(r *http.Request) (string, string, bool) {
+	scheme, value, ok := strings.Cut(strings.TrimSpace(r.Header.Get("Authorization")), " ")
+	if !ok || !strings.EqualFold(scheme, "ApiKey") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return "", "", true
+	}
+	id, secret, _ := strings.Cut(string(decoded), ":")
+	return id, secret, true
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticate runs the proxy's own authentication of a request: API keys sent
+// as Authorization: ApiKey, then the basic auth front door. The tenant of the
+// key or user is recorded for checkAuthTenant. Requests failing it are
+// answered and false is returned.
+func (p *Proxy) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	if p.apiKeys != nil {
+		if id, secret, ok := apiKeyCredentials(r); ok {
+			return p.authenticateAPIKey(w, r, id, secret)
+		}
+	}
+	if p.basicAuth != nil {
+		tenantID, ok := p.basicAuth.authenticate(r)
+		if !ok {
+			p.setResponseMode(w, responseModeHandled)
+			p.rejectUnauthenticated(w, r)
+			return false
+		}
+		if state := requestStateFrom(r); state != nil {
+			state.authTenant = tenantID
+		}
+	}
+	return true
+}
+
+// authenticateAPIKey checks an API key and that it grants the permission the
+// request needs. The Authorization header is not forwarded, as the upstream
+// does not know proxy keys.
+func (p *Proxy) authenticateAPIKey(w http.ResponseWriter, r *http.Request, id, secret string) bool {
+	key, err := p.apiKeys.get(r.Context(), id)
+	if err != nil && !errors.Is(err, errAPIKeyNotFound) {
+		log.Printf("api keys: request_id=%s %v", requestIDFrom(r), err)
+		p.setResponseMode(w, responseModeHandled)
+		p.writeError(w, http.StatusServiceUnavailable, "service_unavailable", codeStateUnavailable, "api keys are unavailable")
+		return false
+	}
+	if err != nil || subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(key.Hash)) != 1 {
+		p.setResponseMode(w, responseModeHandled)
+		p.rejectStatus(w, http.StatusUnauthorized, codeAuthenticationRequired, "invalid api key")
+		return false
+	}
+	if permission := requiredPermission(r, splitPath(r.URL.Path)); !key.allows(permission) {
+		p.setResponseMode(w, responseModeHandled)
+		p.rejectStatus(w, http.StatusForbidden, codePermissionDenied, fmt.Sprintf("api key %s does not grant the %s permission", key.ID, permission))
+		return false
+	}
+	if state := requestStateFrom(r); state != nil {
+		state.authTenant = key.Tenant
+		state.keyOps = operationSet(key.Operations)
+		state.apiKeyID = key.ID
+	}
+	r.Header.Del("Authorization")
+	return true
+}
+
+// rejectUnscopedAPIKey rejects a request authenticated with an API key that
+// would be forwarded without a tenant scope, such as a passthrough path. The
+// upstream sees the proxy's own credentials, so a tenant's key would otherwise
+// get cluster-wide access. It reports whether the request was rejected.
+func (p *Proxy) rejectUnscopedAPIKey(w http.ResponseWriter, r *http.Request) bool {
+	state := requestStateFrom(r)
+	if state == nil || state.apiKeyID == "" {
+		return false
+	}
+	p.setResponseMode(w, responseModeHandled)
+	p.rejectStatus(w, http.StatusForbidden, codePermissionDenied, fmt.Sprintf("api key %s may not access %s, which is not scoped to a tenant", state.apiKeyID, r.URL.Path))
+	return true
+}
+
+// apiKeyMintRequest is the body of POST /admin/api_keys.
+type apiKeyMintRequest struct {
+	Name        string   `json:"name"`
+	Tenant      string   `json:"tenant"`
+	Permissions []string `json:"permissions"`
+	Operations  []string `json:"operations"`
+}
+
+// validateMintRequest checks the tenant and permissions of a key to mint.
+func (p *Proxy) validateMintRequest(request apiKeyMintRequest) error {
+	if !validTenantID.MatchString(request.Tenant) {
+		return fmt.Errorf("invalid tenant '%s'", request.Tenant)
+	}
+	if p.reservedTenant(request.Tenant) {
+		return fmt.Errorf("tenant '%s' is reserved", request.Tenant)
+	}
+	if len(request.Permissions) == 0 {
+		return errors.New("at least one permission is required")
+	}
+	for _, permission := range request.Permissions {
+		switch permission {
+		case permissionRead, permissionWrite, permissionAdmin:
+		default:
+			return fmt.Errorf("unknown permission '%s', expected read, write, or admin", permission)
+		}
+	}
+	for _, operation := range request.Operations {
+		if !config.Operations[operation] {
+			return fmt.Errorf("unknown operation '%s'", operation)
+		}
+	}
+	return nil
+}
+
+// mintAPIKey creates a key and returns it with its secret, which is not
+// stored and cannot be recovered later.
+func (p *Proxy) mintAPIKey(ctx context.Context, request apiKeyMintRequest) (apiKey, string, error) {
+	var random [40]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return apiKey{}, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(random[16:])
+	key := apiKey{
+		ID:          hex.EncodeToString(random[:16]),
+		Name:        request.Name,
+		Tenant:      request.Tenant,
+		Permissions: request.Permissions,
+		Operations:  request.Operations,
+		Hash:        hashAPIKeySecret(secret),
+		Created:     time.Now().UTC(),
+	}
+	if err := p.apiKeys.put(ctx, key); err != nil {
+		return apiKey{}, "", err
+	}
+	return key, secret, nil
+}
+
+// handleAPIKeys lists the API keys on GET, of the tenant given by the tenant
+// query parameter or of every tenant, and mints a key on POST with a
+// {"tenant": "...", "permissions": [...], "name": "..."} body, which may also
+// limit the key to some of the tenant's operations with "operations".
+func (p *Proxy) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if p.apiKeys == nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "api keys are disabled")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := p.apiKeys.list(r.Context())
+		if err != nil {
+			log.Printf("api keys: list: %v", err)
+			writeJSONError(w, http.StatusBadGateway, "upstream_error", err.Error())
+			return
+		}
+		tenantID := strings.TrimSpace(r.URL.Query().Get("tenant"))
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Created.Before(keys[j].Created) })
+		views := []map[string]interface{}{}
+		for _, key := range keys {
+			if tenantID == "" || key.Tenant == tenantID {
+				views = append(views, key.view())
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"api_keys": views})
+	case http.MethodPost:
+		var request apiKeyMintRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad_request", "failed to read body")
+			return
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad_request", "invalid JSON body")
+			return
+		}
+		if err := p.validateMintRequest(request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		key, secret, err := p.mintAPIKey(r.Context(), request)
+		if err != nil {
+			log.Printf("api keys: mint for %s: %v", request.Tenant, err)
+			writeJSONError(w, http.StatusBadGateway, "upstream_error", err.Error())
+			return
+		}
+		log.Printf("api keys: minted %s for tenant %s with %s", key.ID, key.Tenant, strings.Join(key.Permissions, ","))
+		view := key.view()
+		view["api_key"] = secret
+		view["encoded"] = base64.StdEncoding.EncodeToString([]byte(key.ID + ":" + secret))
+		writeJSON(w, http.StatusOK, view)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for api_keys")
+	}
+}
+
+// handleAPIKey shows the API key /admin/api_keys/{id} on GET and invalidates
+// it on DELETE.
+func (p *Proxy) handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	if p.apiKeys == nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "api keys are disabled")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/admin/api_keys/")
+	if id == "" || strings.Contains(id, "/") {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "expected /admin/api_keys/{id}")
+		return
+	}
+	var err error
+	var key apiKey
+	switch r.Method {
+	case http.MethodGet:
+		key, err = p.apiKeys.get(r.Context(), id)
+	case http.MethodDelete:
+		err = p.apiKeys.delete(r.Context(), id)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for api_keys")
+		return
+	}
+	switch {
+	case errors.Is(err, errAPIKeyNotFound):
+		writeJSONError(w, http.StatusNotFound, "not_found", fmt.Sprintf("api key %s not found", id))
+	case err != nil:
+		log.Printf("api keys: %s %s: %v", strings.ToLower(r.Method), id, err)
+		writeJSONError(w, http.StatusBadGateway, "upstream_error", err.Error())
+	case r.Method == http.MethodDelete:
+		log.Printf("api keys: invalidated %s", id)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "invalidated": true})
+	default:
+		writeJSON(w, http.StatusOK, key.view())
+	}
+}
+
+// requiredPermission is the permission a request needs: read for searches and
+// other reads, write for document writes, and admin for every other write,
+// such as index, mapping, alias, and pipeline changes.
+func requiredPermission(r *http.Request, segments []string) string {
+	switch requestOperation(r, segments) {
+	case operationSearch:
+		return permissionRead
+	case operationIndex, operationDelete:
+		return permissionWrite
+	default:
+		return permissionAdmin
+	}
+}
@@ -0,0 +1,333 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func newAPIKeyProxy(t *testing.T) (*Proxy, *capturedRequest) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.APIKeys = config.APIKeys{Enabled: true, Store: "file", Path: filepath.Join(t.TempDir(), "api_keys.json")}
+	return newProxyWithServer(t, cfg)
+}
+
+func mintTestAPIKey(t *testing.T, proxyHandler *Proxy, body string) map[string]interface{} {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/api_keys", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("mint: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var minted map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &minted); err != nil {
+		t.Fatalf("decode minted key: %v", err)
+	}
+	return minted
+}
+
+func TestAPIKeyAdmin(t *testing.T) {
+	proxyHandler, _ := newAPIKeyProxy(t)
+	admin := proxyHandler.AdminHandler()
+
+	minted := mintTestAPIKey(t, proxyHandler, `{"name":"ingest","tenant":"tenant1","permissions":["read","write"]}`)
+	id, _ := minted["id"].(string)
+	secret, _ := minted["api_key"].(string)
+	if id == "" || secret == "" {
+		t.Fatalf("expected id and api_key, got %v", minted)
+	}
+	if minted["encoded"] != base64.StdEncoding.EncodeToString([]byte(id+":"+secret)) {
+		t.Fatalf("unexpected encoded key %v", minted["encoded"])
+	}
+	mintTestAPIKey(t, proxyHandler, `{"tenant":"tenant2","permissions":["admin"]}`)
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/api_keys?tenant=tenant1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), secret) || strings.Contains(rec.Body.String(), "hash") {
+		t.Fatalf("expected listed keys without secrets, got %s", rec.Body.String())
+	}
+	var listed struct {
+		APIKeys []map[string]interface{} `json:"api_keys"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(listed.APIKeys) != 1 || listed.APIKeys[0]["id"] != id || listed.APIKeys[0]["name"] != "ingest" {
+		t.Fatalf("expected the tenant1 key, got %v", listed.APIKeys)
+	}
+
+	for name, body := range map[string]string{
+		"invalid tenant":     `{"tenant":"Tenant One","permissions":["read"]}`,
+		"no permissions":     `{"tenant":"tenant1"}`,
+		"unknown permission": `{"tenant":"tenant1","permissions":["delete"]}`,
+		"invalid json":       `{"tenant":`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/api_keys", strings.NewReader(body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/api_keys/"+id, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/api_keys/"+id, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected deleted key to be gone, got %d", rec.Code)
+	}
+
+	reloaded, err := newFileAPIKeyStore(proxyHandler.cfg.APIKeys.Path)
+	if err != nil {
+		t.Fatalf("reload key file: %v", err)
+	}
+	keys, _ := reloaded.list(context.Background())
+	if len(keys) != 1 || keys[0].Tenant != "tenant2" || keys[0].Hash == "" {
+		t.Fatalf("expected the remaining key persisted, got %+v", keys)
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	proxyHandler, capture := newAPIKeyProxy(t)
+	reader := mintTestAPIKey(t, proxyHandler, `{"tenant":"tenant1","permissions":["read"]}`)["encoded"].(string)
+	writer := mintTestAPIKey(t, proxyHandler, `{"tenant":"tenant1","permissions":["read","write"]}`)["encoded"].(string)
+	wrongSecret := base64.StdEncoding.EncodeToString([]byte(strings.SplitN(mustDecode(t, reader), ":", 2)[0] + ":guess"))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		key        string
+		wantStatus int
+		wantCode   rejectCode
+	}{
+		{name: "read", method: http.MethodGet, path: "/orders-tenant1/_search", key: reader, wantStatus: http.StatusOK},
+		{name: "write", method: http.MethodPut, path: "/orders-tenant1/_doc/1", body: `{"a":1}`, key: writer, wantStatus: http.StatusOK},
+		{name: "write without permission", method: http.MethodPut, path: "/orders-tenant1/_doc/1", body: `{"a":1}`, key: reader, wantStatus: http.StatusForbidden, wantCode: codePermissionDenied},
+		{name: "admin without permission", method: http.MethodPut, path: "/orders-tenant1", body: `{}`, key: writer, wantStatus: http.StatusForbidden, wantCode: codePermissionDenied},
+		{name: "other tenant", method: http.MethodGet, path: "/orders-tenant2/_search", key: reader, wantStatus: http.StatusForbidden, wantCode: codeTenantForbidden},
+		{name: "wrong secret", method: http.MethodGet, path: "/orders-tenant1/_search", key: wrongSecret, wantStatus: http.StatusUnauthorized, wantCode: codeAuthenticationRequired},
+		{name: "unknown key", method: http.MethodGet, path: "/orders-tenant1/_search", key: base64.StdEncoding.EncodeToString([]byte("nope:nope")), wantStatus: http.StatusUnauthorized, wantCode: codeAuthenticationRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, _, before := capture.snapshot()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "ApiKey "+tt.key)
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			if !strings.Contains(rec.Body.String(), string(tt.wantCode)) {
+				t.Fatalf("expected %s, got %s", tt.wantCode, rec.Body.String())
+			}
+			if _, _, _, _, after := capture.snapshot(); after != before {
+				t.Fatalf("expected rejected request not to reach the upstream")
+			}
+		})
+	}
+}
+
+func TestAPIKeyRejectedOnUnscopedPaths(t *testing.T) {
+	cfg := config.Default()
+	cfg.APIKeys = config.APIKeys{Enabled: true, Store: "file", Path: filepath.Join(t.TempDir(), "api_keys.json")}
+	cfg.PassthroughPaths = []string{"/_cluster/health"}
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	key := mintTestAPIKey(t, proxyHandler, `{"tenant":"tenant1","permissions":["read","write","admin"]}`)["encoded"].(string)
+
+	for _, tt := range []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodGet, path: "/_cluster/health"},
+		{method: http.MethodGet, path: "/_nodes/stats"},
+		{method: http.MethodGet, path: "/_tasks"},
+		{method: http.MethodPut, path: "/_snapshot/backups"},
+		{method: http.MethodGet, path: "/_security/user"},
+		{method: http.MethodPost, path: "/_reindex/node1:1/_rethrottle"},
+	} {
+		_, _, _, _, before := capture.snapshot()
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "ApiKey "+key)
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), string(codePermissionDenied)) {
+			t.Fatalf("%s %s: expected %s, got %d: %s", tt.method, tt.path, codePermissionDenied, rec.Code, rec.Body.String())
+		}
+		if _, _, _, _, after := capture.snapshot(); after != before {
+			t.Fatalf("%s %s: expected rejected request not to reach the upstream", tt.method, tt.path)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_cluster/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected passthrough without a key, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPIKeyOverridesResolvedTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.APIKeys = config.APIKeys{Enabled: true, Store: "file", Path: filepath.Join(t.TempDir(), "api_keys.json")}
+	cfg.TenantResolver = config.TenantResolver{Type: "header", Header: "X-Tenant-ID"}
+	var mu sync.Mutex
+	var paths []string
+	var authorization string
+	proxyHandler := newProxyWithUpstream(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		authorization = r.Header.Get("Authorization")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"count":0}`))
+	}))
+	key := mintTestAPIKey(t, proxyHandler, `{"tenant":"tenant1","permissions":["read"]}`)["encoded"].(string)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/_count", nil)
+	req.Header.Set("Authorization", "ApiKey "+key)
+	req.Header.Set("X-Tenant-ID", "tenant2")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paths) != 1 || !strings.Contains(paths[0], "tenant1") || strings.Contains(paths[0], "tenant2") {
+		t.Fatalf("expected the key tenant to be used, got %v", paths)
+	}
+	if authorization != "" {
+		t.Fatalf("expected the api key not to be forwarded, got %q", authorization)
+	}
+}
+
+func TestIndexAPIKeyStore(t *testing.T) {
+	var mu sync.Mutex
+	docs := map[string][]byte{}
+	var gets int
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		id := strings.TrimPrefix(r.URL.Path, "/es-tmnt-api-keys/_doc/")
+		switch {
+		case r.Method == http.MethodPut:
+			var body [4096]byte
+			n, _ := r.Body.Read(body[:])
+			docs[id] = append([]byte(nil), body[:n]...)
+			_, _ = w.Write([]byte(`{"result":"created"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/es-tmnt-api-keys/_search":
+			hits := []string{}
+			for _, doc := range docs {
+				hits = append(hits, `{"_source":`+string(doc)+`}`)
+			}
+			_, _ = w.Write([]byte(`{"hits":{"hits":[` + strings.Join(hits, ",") + `]}}`))
+		case r.Method == http.MethodGet:
+			gets++
+			doc, ok := docs[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"found":false}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"found":true,"_source":` + string(doc) + `}`))
+		case r.Method == http.MethodDelete:
+			if _, ok := docs[id]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"result":"not_found"}`))
+				return
+			}
+			delete(docs, id)
+			_, _ = w.Write([]byte(`{"result":"deleted"}`))
+		}
+	})
+	cfg := config.Default()
+	cfg.APIKeys = config.APIKeys{Enabled: true, Store: "index", Index: "es-tmnt-api-keys"}
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+	store := proxyHandler.apiKeys
+	ctx := context.Background()
+
+	if _, err := store.get(ctx, "missing"); err != errAPIKeyNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err := store.get(ctx, "missing"); err != errAPIKeyNotFound || gets != 1 {
+		t.Fatalf("expected the miss to be cached, got %v after %d gets", err, gets)
+	}
+	key := apiKey{ID: "abc", Tenant: "tenant1", Permissions: []string{permissionRead}, Hash: hashAPIKeySecret("secret")}
+	if err := store.put(ctx, key); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	store.(*indexAPIKeyStore).cache = map[string]cachedAPIKey{}
+	got, err := store.get(ctx, "abc")
+	if err != nil || got.Tenant != "tenant1" || got.Hash != key.Hash {
+		t.Fatalf("expected stored key, got %+v, %v", got, err)
+	}
+	keys, err := store.list(ctx)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected one listed key, got %v, %v", keys, err)
+	}
+	if err := store.delete(ctx, "abc"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := store.delete(ctx, "abc"); err != errAPIKeyNotFound {
+		t.Fatalf("expected not found on second delete, got %v", err)
+	}
+	if _, err := store.get(ctx, "abc"); err != errAPIKeyNotFound {
+		t.Fatalf("expected deleted key to be gone, got %v", err)
+	}
+}
+
+func TestRequiredPermission(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodGet, path: "/orders-tenant1/_search", want: permissionRead},
+		{method: http.MethodPost, path: "/orders-tenant1/_search", want: permissionRead},
+		{method: http.MethodPost, path: "/_bulk", want: permissionWrite},
+		{method: http.MethodDelete, path: "/orders-tenant1/_doc/1", want: permissionWrite},
+		{method: http.MethodPost, path: "/orders-tenant1/_update_by_query", want: permissionWrite},
+		{method: http.MethodPut, path: "/orders-tenant1", want: permissionAdmin},
+		{method: http.MethodPut, path: "/orders-tenant1/_mapping", want: permissionAdmin},
+		{method: http.MethodDelete, path: "/orders-tenant1", want: permissionAdmin},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requiredPermission(req, splitPath(tt.path)); got != tt.want {
+			t.Fatalf("%s %s: expected %s, got %s", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+func mustDecode(t *testing.T, encoded string) string {
+	t.Helper()
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("decode %q: %v", encoded, err)
+	}
+	return string(decoded)
+}
@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+// auditEvent records a single tenant write forwarded to the upstream cluster.
+type auditEvent struct {
+	Timestamp   time.Time `json:"@timestamp"`
+	RequestID   string    `json:"request_id,omitempty"`
+	Operation   string    `json:"operation"`
+	Tenant      string    `json:"tenant"`
+	Index       string    `json:"index,omitempty"`
+	TargetIndex string    `json:"target_index"`
+	DocumentIDs []string  `json:"document_ids,omitempty"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Status      int       `json:"status"`
+}
+
+// auditSink stores audit events. Implementations must be safe for concurrent use.
+type auditSink interface {
+	Write(event auditEvent) error
+}
+
+func newAuditSink(cfg config.Audit, upstream *upstreamClient) (auditSink, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Sink)) {
+	case "":
+		return nil, nil
+	case "file":
+		return newFileAuditSink(cfg.Path)
+	case "syslog":
+		return newSyslogAuditSink()
+	case "index":
+		return newIndexAuditSink(upstream, cfg.Index), nil
+	default:
+		return nil, fmt.Errorf("unsupported audit sink %q", cfg.Sink)
+	}
+}
+
+// fileAuditSink appends events to a file as newline-delimited JSON.
+type fileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileAuditSink(path string) (*fileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit file: %w", err)
+	}
+	return &fileAuditSink{file: file}, nil
+}
+
+func (s *fileAuditSink) Write(event auditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(line)
+	return err
+}
+
+// indexAuditSink indexes events into a dedicated upstream index. Events are
+// queued and written in the background so audit writes do not add latency to
+// tenant requests; events are dropped with a log line when the queue is full.
+// Each write is bounded by timeout so a stuck upstream cannot stall the queue.
+type indexAuditSink struct {
+	upstream *upstreamClient
+	index    string
+	events   chan auditEvent
+	timeout  time.Duration
+}
+
+// auditSendTimeout bounds the upstream write of a single audit event.
+const auditSendTimeout = 10 * time.Second
+
+func newIndexAuditSink(upstream *upstreamClient, index string) *indexAuditSink {
+	sink := &indexAuditSink{
+		upstream: upstream,
+		index:    index,
+		events:   make(chan auditEvent, 1024),
+		timeout:  auditSendTimeout,
+	}
+	go sink.run()
+	return sink
+}
+
+func (s *indexAuditSink) Write(event auditEvent) error {
+	select {
+	case s.events <- event:
+		return nil
+	default:
+		return fmt.Errorf("audit queue full, dropping %s event for tenant %s", event.Operation, event.Tenant)
+	}
+}
+
+func (s *indexAuditSink) run() {
+	for event := range s.events {
+		if err := s.send(event); err != nil {
+			log.Printf("audit: %v", err)
+		}
+	}
+}
+
+func (s *indexAuditSink) send(event auditEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	resp, err := s.upstream.do(ctx, nil, http.MethodPost, "/"+url.PathEscape(s.index)+"/_doc", body)
+	if err != nil {
+		return fmt.Errorf("index audit event: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("index audit event: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// setAuditEvent marks the request as a tenant write to be audited once the
+// upstream responds. It returns nil when auditing is disabled.
+func (p *Proxy) setAuditEvent(r *http.Request, operation, index, tenantID, targetIndex string, docIDs []string) *auditEvent {
+	if p.audit == nil {
+		return nil
+	}
+	state := requestStateFrom(r)
+	if state == nil {
+		return nil
+	}
+	state.audit = &auditEvent{
+		RequestID:   state.requestID,
+		Operation:   operation,
+		Tenant:      tenantID,
+		Index:       index,
+		TargetIndex: targetIndex,
+		DocumentIDs: docIDs,
+		Method:      r.Method,
+		Path:        r.URL.Path,
+	}
+	return state.audit
+}
+
+func (p *Proxy) recordAudit(resp *http.Response, event *auditEvent) {
+	event.Timestamp = time.Now().UTC()
+	event.Status = resp.StatusCode
+	if len(event.DocumentIDs) == 0 && event.Operation == "index" {
+		if id := responseDocumentID(resp); id != "" {
+			event.DocumentIDs = []string{id}
+		}
+	}
+	if err := p.audit.Write(*event); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+// responseDocumentID reads the _id of an auto-generated document from an index
+// response, leaving the body readable for the client.
+func responseDocumentID(resp *http.Response) string {
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return ""
+	}
+	if resp.Header.Get("Content-Encoding") != "" || !isJSONMediaType(resp.Header.Get("Content-Type")) {
+		return ""
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var payload struct {
+		ID string `json:"_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return payload.ID
+}
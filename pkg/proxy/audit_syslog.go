@@ -0,0 +1,30 @@
+//go:build !windows && !plan9
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// syslogAuditSink sends events to the local syslog daemon as JSON messages.
+type syslogAuditSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogAuditSink() (auditSink, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, "es-tmnt")
+	if err != nil {
+		return nil, fmt.Errorf("connect to syslog: %w", err)
+	}
+	return &syslogAuditSink{writer: writer}, nil
+}
+
+func (s *syslogAuditSink) Write(event auditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.writer.Info(string(line))
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package proxy
+
+import "errors"
+
+func newSyslogAuditSink() (auditSink, error) {
+	return nil, errors.New("syslog audit sink is not supported on this platform")
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+type memoryAuditSink struct {
+	mu     sync.Mutex
+	events []auditEvent
+}
+
+func (s *memoryAuditSink) Write(event auditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memoryAuditSink) snapshot() []auditEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]auditEvent(nil), s.events...)
+}
+
+func TestAuditRecordsWrites(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusCreated, `{"_id":"generated","result":"created"}`))
+	sink := &memoryAuditSink{}
+	proxyHandler.audit = sink
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		operation string
+		target    string
+		ids       []string
+	}{
+		{name: "index with id", method: http.MethodPut, path: "/products-tenant1/_doc/1", body: `{"name":"shoe"}`, operation: "index", target: "shared-products", ids: []string{"1"}},
+		{name: "index auto id", method: http.MethodPost, path: "/products-tenant1/_doc", body: `{"name":"shoe"}`, operation: "index", target: "shared-products", ids: []string{"generated"}},
+		{name: "update", method: http.MethodPost, path: "/products-tenant1/_update/2", body: `{"doc":{"name":"hat"}}`, operation: "update", target: "shared-products", ids: []string{"2"}},
+		{name: "delete", method: http.MethodPost, path: "/products-tenant1/_delete/3", operation: "delete", target: "shared-products", ids: []string{"3"}},
+		{name: "bulk", method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"products-tenant1\",\"_id\":\"4\"}}\n{\"name\":\"a\"}\n{\"delete\":{\"_index\":\"orders-tenant1\",\"_id\":\"5\"}}\n", operation: "bulk", target: "shared-products,shared-orders", ids: []string{"4", "5"}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			events := sink.snapshot()
+			if len(events) != i+1 {
+				t.Fatalf("expected %d audit events, got %d", i+1, len(events))
+			}
+			event := events[i]
+			if event.Operation != tt.operation || event.Tenant != "tenant1" || event.TargetIndex != tt.target {
+				t.Fatalf("unexpected audit event: %+v", event)
+			}
+			if strings.Join(event.DocumentIDs, ",") != strings.Join(tt.ids, ",") {
+				t.Fatalf("expected ids %v, got %v", tt.ids, event.DocumentIDs)
+			}
+			if event.Status != http.StatusCreated || event.Timestamp.IsZero() {
+				t.Fatalf("expected status and timestamp recorded, got %+v", event)
+			}
+		})
+	}
+	if !strings.Contains(sink.snapshot()[1].Path, "/products-tenant1/_doc") {
+		t.Fatalf("expected tenant-facing path recorded, got %q", sink.snapshot()[1].Path)
+	}
+}
+
+func TestAuditSkipsReads(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{"hits":{"hits":[]}}`))
+	sink := &memoryAuditSink{}
+	proxyHandler.audit = sink
+
+	req := httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if events := sink.snapshot(); len(events) != 0 {
+		t.Fatalf("expected no audit events, got %v", events)
+	}
+}
+
+func TestAuditFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.Audit.Sink = "file"
+	cfg.Audit.Path = path
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{"result":"updated"}`))
+
+	for _, id := range []string{"1", "2"} {
+		req := httptest.NewRequest(http.MethodPut, "/products-tenant1/_doc/"+id, strings.NewReader(`{"name":"shoe"}`))
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit file: %v", err)
+	}
+	defer file.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("parse audit line: %v", err)
+		}
+		lines = append(lines, entry)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected two audit lines, got %d", len(lines))
+	}
+	if lines[1]["tenant"] != "tenant1" || lines[1]["document_ids"].([]interface{})[0] != "2" {
+		t.Fatalf("unexpected audit line: %v", lines[1])
+	}
+	if _, ok := lines[0]["@timestamp"]; !ok {
+		t.Fatalf("expected timestamp in audit line: %v", lines[0])
+	}
+}
+
+func TestNewAuditSinkRejectsUnknownSink(t *testing.T) {
+	if _, err := newAuditSink(config.Audit{Sink: "kafka"}, nil); err == nil {
+		t.Fatalf("expected error for unknown sink")
+	}
+}
+
+func TestIndexAuditSinkSendTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	proxyHandler := newProxyWithUpstream(t, config.Default(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(func() { close(release) })
+	sink := &indexAuditSink{upstream: proxyHandler.upstream, index: "es-tmnt-audit", timeout: 50 * time.Millisecond}
+	err := sink.send(auditEvent{Operation: "index", Tenant: "tenant1"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
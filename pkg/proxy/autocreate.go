@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"es-tmnt/pkg/config"
+)
+
+// indexCreator creates missing per-tenant indices ahead of a tenant's first
+// write, for clusters with automatic index creation disabled. Indices known to
+// exist are remembered, so only the first write to an index checks upstream.
+type indexCreator struct {
+	upstream *upstreamClient
+	body     []byte
+	mu       sync.Mutex
+	known    map[string]struct{}
+}
+
+// newIndexCreator returns nil unless index_per_tenant.auto_create is set. The
+// create template is read once and must hold a JSON object.
+func newIndexCreator(cfg config.IndexPerTenant, upstream *upstreamClient) (*indexCreator, error) {
+	if !cfg.AutoCreate {
+		return nil, nil
+	}
+	creator := &indexCreator{upstream: upstream, known: map[string]struct{}{}}
+	if templatePath := strings.TrimSpace(cfg.CreateTemplatePath); templatePath != "" {
+		data, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("read index create template: %w", err)
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, fmt.Errorf("parse index create template %s: %w", templatePath, err)
+		}
+		creator.body = data
+	}
+	return creator, nil
+}
+
+func (c *indexCreator) exists(index string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.known[index]
+	return ok
+}
+
+func (c *indexCreator) remember(index string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.known[index] = struct{}{}
+}
+
+func (c *indexCreator) forget(index string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.known, index)
+}
+
+// ensureTenantIndex creates targetIndex from the create template, with its
+// mappings nested under baseIndex, when the index does not exist yet. Failures
+// are logged and the write is forwarded anyway, so the client sees the
+// upstream's own error.
+func (p *Proxy) ensureTenantIndex(r *http.Request, targetIndex, baseIndex string) {
+	if p.creator == nil || p.creator.exists(targetIndex) {
+		return
+	}
+	if err := p.createTenantIndex(r, targetIndex, baseIndex); err != nil {
+		log.Printf("auto create: request_id=%s index=%s: %v", requestIDFrom(r), targetIndex, err)
+		return
+	}
+	p.creator.remember(targetIndex)
+}
+
+func (p *Proxy) createTenantIndex(r *http.Request, targetIndex, baseIndex string) error {
+	upstream := p.requestUpstream(r)
+	resp, err := upstream.do(r.Context(), r.Header, http.MethodHead, "/"+url.PathEscape(targetIndex), nil)
+	if err != nil {
+		return fmt.Errorf("check index: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+	default:
+		return fmt.Errorf("check index: unexpected status %d", resp.StatusCode)
+	}
+	var body []byte
+	if len(p.creator.body) != 0 {
+		body, err = p.rewriteMappingBody(p.creator.body, baseIndex)
+		if err != nil {
+			return fmt.Errorf("create template: %w", err)
+		}
+	}
+	resp, err = upstream.do(r.Context(), r.Header, http.MethodPut, "/"+url.PathEscape(targetIndex), body)
+	if err != nil {
+		return fmt.Errorf("create index: %w", err)
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
+		p.logRequestVerbose(r, "auto create: created index %s", targetIndex)
+	case resp.StatusCode == http.StatusBadRequest && bytes.Contains(message, []byte("resource_already_exists_exception")):
+		// A concurrent write created the index first.
+	default:
+		return fmt.Errorf("create index: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
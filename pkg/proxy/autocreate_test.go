@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func autoCreateConfig(t *testing.T) config.Config {
+	t.Helper()
+	templatePath := filepath.Join(t.TempDir(), "tenant-index.json")
+	body := `{"settings":{"number_of_shards":1},"mappings":{"properties":{"total":{"type":"long"}}}}`
+	if err := os.WriteFile(templatePath, []byte(body), 0o600); err != nil {
+		t.Fatalf("write create template: %v", err)
+	}
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	cfg.IndexPerTenant.AutoCreate = true
+	cfg.IndexPerTenant.CreateTemplatePath = templatePath
+	return cfg
+}
+
+func TestAutoCreateOnFirstWrite(t *testing.T) {
+	upstream := &bootstrapUpstream{existing: map[string]bool{"orders-tenant2": true}}
+	proxyHandler := newProxyWithUpstream(t, autoCreateConfig(t), upstream)
+
+	requests := []struct {
+		path string
+		body string
+	}{
+		{path: "/orders-tenant1/_doc/1", body: `{"total":1}`},
+		{path: "/orders-tenant1/_doc/2", body: `{"total":2}`},
+		{path: "/_bulk", body: "{\"index\":{\"_index\":\"orders-tenant1\"}}\n{\"total\":3}\n{\"delete\":{\"_index\":\"products-tenant1\",\"_id\":\"1\"}}\n"},
+		{path: "/orders-tenant2/_doc/1", body: `{"total":4}`},
+	}
+	for _, request := range requests {
+		req := httptest.NewRequest(http.MethodPost, request.path, strings.NewReader(request.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d: %s", request.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	if heads := upstream.find(http.MethodHead, "/orders-tenant1"); len(heads) != 1 {
+		t.Fatalf("expected orders-tenant1 checked once, got %d", len(heads))
+	}
+	creates := upstream.find(http.MethodPut, "/orders-tenant1")
+	if len(creates) != 1 {
+		t.Fatalf("expected orders-tenant1 created once, got %d", len(creates))
+	}
+	if want := `"properties":{"orders":{"properties":{"total":{"type":"long"}}}}`; !strings.Contains(string(creates[0].body), want) {
+		t.Fatalf("expected wrapped mappings in create body, got %s", creates[0].body)
+	}
+	if heads := upstream.find(http.MethodHead, "/products-tenant1"); len(heads) != 0 {
+		t.Fatalf("expected bulk deletes not to create indices, got %d checks", len(heads))
+	}
+	if creates := upstream.find(http.MethodPut, "/orders-tenant2"); len(creates) != 0 {
+		t.Fatalf("expected existing index not to be created, got %d", len(creates))
+	}
+}
+
+func TestAutoCreateForgetsDeletedIndex(t *testing.T) {
+	upstream := &bootstrapUpstream{existing: map[string]bool{}}
+	proxyHandler := newProxyWithUpstream(t, autoCreateConfig(t), upstream)
+
+	for _, step := range []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodPut, path: "/orders-tenant1/_doc/1"},
+		{method: http.MethodDelete, path: "/orders-tenant1"},
+		{method: http.MethodPut, path: "/orders-tenant1/_doc/1"},
+	} {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(`{"total":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if creates := upstream.find(http.MethodPut, "/orders-tenant1"); len(creates) != 2 {
+		t.Fatalf("expected index recreated after delete, got %d creates", len(creates))
+	}
+}
@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"es-tmnt/pkg/config"
+)
+
+// htpasswdUser is a user of the basic auth front door and the tenant it is
+// confined to.
+type htpasswdUser struct {
+	hash   string
+	tenant string
+}
+
+// basicAuthenticator checks the basic auth credentials of every request on the
+// proxy listener against the configured users.
+type basicAuthenticator struct {
+	realm string
+	users map[string]htpasswdUser
+}
+
+// newBasicAuthenticator loads the users of cfg, returning nil when the front
+// door is disabled. Users in the config take precedence over the htpasswd
+// file.
+func newBasicAuthenticator(cfg config.BasicAuth) (*basicAuthenticator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	auth := &basicAuthenticator{realm: cfg.Realm, users: make(map[string]htpasswdUser)}
+	if cfg.HtpasswdPath != "" {
+		data, err := os.ReadFile(cfg.HtpasswdPath)
+		if err != nil {
+			return nil, fmt.Errorf("read htpasswd file: %w", err)
+		}
+		if err := auth.parseHtpasswd(data); err != nil {
+			return nil, fmt.Errorf("parse htpasswd file %s: %w", cfg.HtpasswdPath, err)
+		}
+	}
+	for _, user := range cfg.Users {
+		if err := auth.add(user.Username, user.Password, user.Tenant); err != nil {
+			return nil, fmt.Errorf("basic auth user %q: %w", user.Username, err)
+		}
+	}
+	return auth, nil
+}
+
+// parseHtpasswd reads user:hash and user:hash:tenant lines, skipping blank
+// lines and # comments.
+func (a *basicAuthenticator) parseHtpasswd(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ":")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" {
+			return fmt.Errorf("line %d: expected user:hash or user:hash:tenant", line)
+		}
+		tenant := ""
+		if len(fields) == 3 {
+			tenant = fields[2]
+		}
+		if err := a.add(fields[0], fields[1], tenant); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// plainPasswordPrefix marks a password stored as plain text. Without it, a
+// hash in a format the proxy does not know would be compared as plain text,
+// letting the hash itself log in.
+const plainPasswordPrefix = "{PLAIN}"
+
+func (a *basicAuthenticator) add(username, hash, tenant string) error {
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"), strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, plainPasswordPrefix):
+	case strings.HasPrefix(hash, "$2"):
+		return fmt.Errorf("bcrypt hashes are not supported, use htpasswd -m or -s")
+	default:
+		return fmt.Errorf("unsupported password hash, use htpasswd -m or -s, or prefix a plain text password with %s", plainPasswordPrefix)
+	}
+	if tenant == "" {
+		tenant = username
+	}
+	if !validTenantID.MatchString(tenant) {
+		return fmt.Errorf("invalid tenant '%s'", tenant)
+	}
+	a.users[username] = htpasswdUser{hash: hash, tenant: tenant}
+	return nil
+}
+
+// authenticate returns the tenant of the user whose credentials r carries.
+func (a *basicAuthenticator) authenticate(r *http.Request) (string, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	user, ok := a.users[username]
+	if !ok || !checkPassword(user.hash, password) {
+		return "", false
+	}
+	return user.tenant, true
+}
+
+// rejectUnauthenticated answers 401 with the challenge browsers and clients
+// answer with credentials.
+func (p *Proxy) rejectUnauthenticated(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", p.basicAuth.realm))
+	message := "authentication required"
+	if _, _, ok := r.BasicAuth(); ok {
+		message = "invalid credentials"
+	}
+	p.rejectStatus(w, http.StatusUnauthorized, codeAuthenticationRequired, message)
+}
+
+// checkAuthTenant rejects a tenant other than the one the request
+// authenticated as.
+func checkAuthTenant(r *http.Request, tenantID string) error {
+	state := requestStateFrom(r)
+	if state == nil || state.authTenant == "" || state.authTenant == tenantID {
+		return nil
+	}
+	return withCode(codeTenantForbidden, fmt.Errorf("tenant '%s' is not the authenticated tenant '%s'", tenantID, state.authTenant))
+}
+
+// checkPassword compares password with an htpasswd hash in constant time.
+// Hashes in other formats never match.
+func checkPassword(hash, password string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		computed = apr1Hash(password, salt)
+	case strings.HasPrefix(hash, plainPasswordPrefix):
+		computed = plainPasswordPrefix + password
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// apr1Hash is the Apache variant of the MD5-based crypt, as written by
+// htpasswd -m.
+func apr1Hash(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+	alternate := md5.New()
+	alternate.Write(pw)
+	alternate.Write([]byte(salt))
+	alternate.Write(pw)
+	final := alternate.Sum(nil)
+
+	digest := md5.New()
+	digest.Write(pw)
+	digest.Write([]byte(magic))
+	digest.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= 16 {
+		digest.Write(final[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digest.Write([]byte{0})
+		} else {
+			digest.Write(pw[:1])
+		}
+	}
+	final = digest.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	encoded := make([]byte, 0, 22)
+	encode := func(value uint32, n int) {
+		for ; n > 0; n-- {
+			encoded = append(encoded, itoa64[value&0x3f])
+			value >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(final[group[0]])<<16|uint32(final[group[1]])<<8|uint32(final[group[2]]), 4)
+	}
+	encode(uint32(final[11]), 2)
+	return magic + salt + "$" + string(encoded)
+}
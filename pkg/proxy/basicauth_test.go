@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestCheckPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{name: "apr1", hash: "$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/", password: "secret", want: true},
+		{name: "apr1 empty password", hash: "$apr1$xy$43..WIhbfuznGvwoCyUek/", password: "", want: true},
+		{name: "apr1 long password", hash: "$apr1$12345678$MTmhL9UCLzSxp9RmTZ2mB/", password: "a longer password with more than sixteen bytes", want: true},
+		{name: "apr1 wrong password", hash: "$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/", password: "Secret", want: false},
+		{name: "sha", hash: "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", password: "secret", want: true},
+		{name: "sha wrong password", hash: "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", password: "other", want: false},
+		{name: "plain", hash: "{PLAIN}secret", password: "secret", want: true},
+		{name: "plain wrong password", hash: "{PLAIN}secret", password: "secret2", want: false},
+		{name: "unmarked plain", hash: "secret", password: "secret", want: false},
+		{name: "unknown hash", hash: "$6$salt$hash", password: "$6$salt$hash", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkPassword(tt.hash, tt.password); got != tt.want {
+				t.Fatalf("checkPassword(%q, %q) = %v, want %v", tt.hash, tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBasicAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "htpasswd")
+	htpasswd := "# dashboards\nacme:$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/\n\nreports:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=:globex\n"
+	if err := os.WriteFile(path, []byte(htpasswd), 0o600); err != nil {
+		t.Fatalf("write htpasswd: %v", err)
+	}
+	auth, err := newBasicAuthenticator(config.BasicAuth{
+		Enabled:      true,
+		HtpasswdPath: path,
+		Users:        []config.BasicAuthUser{{Username: "reports", Password: "{PLAIN}override", Tenant: "initech"}},
+	})
+	if err != nil {
+		t.Fatalf("new authenticator: %v", err)
+	}
+	if got := auth.users["acme"].tenant; got != "acme" {
+		t.Fatalf("expected user tenant to default to the user name, got %q", got)
+	}
+	if got := auth.users["reports"]; got.tenant != "initech" || got.hash != "{PLAIN}override" {
+		t.Fatalf("expected config users to take precedence, got %+v", got)
+	}
+
+	for name, data := range map[string]string{
+		"bcrypt":         "acme:$2y$05$abcdefghijklmnopqrstuu\n",
+		"sha-512 crypt":  "acme:$6$salt$hash\n",
+		"yescrypt":       "acme:$y$j9T$salt$hash\n",
+		"salted sha":     "acme:{SSHA}c2FsdGVkaGFzaA==\n",
+		"unmarked plain": "acme:secret\n",
+		"missing hash":   "acme\n",
+		"invalid tenant": "acme:{PLAIN}secret:Acme Corp\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+				t.Fatalf("write htpasswd: %v", err)
+			}
+			if _, err := newBasicAuthenticator(config.BasicAuth{Enabled: true, HtpasswdPath: path}); err == nil || !strings.Contains(err.Error(), "line 1") {
+				t.Fatalf("expected a line 1 error, got %v", err)
+			}
+		})
+	}
+
+	if auth, err := newBasicAuthenticator(config.BasicAuth{}); auth != nil || err != nil {
+		t.Fatalf("expected no authenticator when disabled, got %v, %v", auth, err)
+	}
+}
+
+func TestBasicAuthFrontDoor(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.BasicAuth = config.BasicAuth{
+		Enabled: true,
+		Realm:   "tenants",
+		Users: []config.BasicAuthUser{
+			{Username: "alice", Password: "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", Tenant: "tenant1"},
+		},
+	}
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		user       string
+		password   string
+		wantStatus int
+		wantCode   rejectCode
+	}{
+		{name: "own tenant", path: "/orders-tenant1/_search", user: "alice", password: "secret", wantStatus: http.StatusOK},
+		{name: "missing credentials", path: "/orders-tenant1/_search", wantStatus: http.StatusUnauthorized, wantCode: codeAuthenticationRequired},
+		{name: "wrong password", path: "/orders-tenant1/_search", user: "alice", password: "guess", wantStatus: http.StatusUnauthorized, wantCode: codeAuthenticationRequired},
+		{name: "unknown user", path: "/orders-tenant1/_search", user: "bob", password: "secret", wantStatus: http.StatusUnauthorized, wantCode: codeAuthenticationRequired},
+		{name: "other tenant", path: "/orders-tenant2/_search", user: "alice", password: "secret", wantStatus: http.StatusForbidden, wantCode: codeTenantForbidden},
+		{name: "other tenant in bulk", path: "/_bulk", body: "{\"index\":{\"_index\":\"orders-tenant2\",\"_id\":\"1\"}}\n{\"a\":1}\n", user: "alice", password: "secret", wantStatus: http.StatusForbidden, wantCode: codeTenantForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, _, before := capture.snapshot()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.body != "" {
+				req = httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+				req.Header.Set("Content-Type", "application/x-ndjson")
+			}
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			if !strings.Contains(rec.Body.String(), string(tt.wantCode)) {
+				t.Fatalf("expected %s, got %s", tt.wantCode, rec.Body.String())
+			}
+			if _, _, _, _, after := capture.snapshot(); after != before {
+				t.Fatalf("expected rejected request not to reach the upstream")
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != `Basic realm="tenants"` {
+				t.Fatalf("unexpected challenge %q", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
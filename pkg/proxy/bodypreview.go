@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"es-tmnt/pkg/config"
+)
+
+// redactedValue replaces the values of redacted fields in body previews.
+const redactedValue = `"[REDACTED]"`
+
+// bodyPreview is the compiled body_preview configuration.
+type bodyPreview struct {
+	maxBytes int
+	redact   *regexp.Regexp
+}
+
+// newBodyPreview returns nil when body previews are disabled.
+func newBodyPreview(cfg config.BodyPreview) (*bodyPreview, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	preview := &bodyPreview{maxBytes: cfg.MaxBytes}
+	if cfg.RedactPattern != "" {
+		redact, err := regexp.Compile(cfg.RedactPattern)
+		if err != nil {
+			return nil, fmt.Errorf("parse body preview redact pattern: %w", err)
+		}
+		preview.redact = redact
+	}
+	return preview, nil
+}
+
+// previewBody logs the start of the body of an upstream request once it has
+// been sent, without holding back streamed bodies.
+func (p *Proxy) previewBody(outbound *http.Request) {
+	if p.bodyPreview == nil || outbound.Body == nil || outbound.Body == http.NoBody {
+		return
+	}
+	outbound.Body = &previewReader{
+		ReadCloser: outbound.Body,
+		preview:    p.bodyPreview,
+		requestID:  requestIDFrom(outbound),
+		method:     outbound.Method,
+		path:       outbound.URL.Path,
+	}
+}
+
+// previewReader keeps the first bytes of a request body as the transport
+// reads it and logs them when the body is exhausted or closed. The transport
+// may close the body while its write loop still reads it.
+type previewReader struct {
+	io.ReadCloser
+	preview   *bodyPreview
+	requestID string
+	method    string
+	path      string
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	total  int64
+	logged bool
+}
+
+func (r *previewReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.mu.Lock()
+	if keep := r.preview.maxBytes - r.buf.Len(); keep > 0 {
+		r.buf.Write(b[:min(n, keep)])
+	}
+	r.total += int64(n)
+	r.mu.Unlock()
+	if err == io.EOF {
+		r.log()
+	}
+	return n, err
+}
+
+func (r *previewReader) Close() error {
+	r.log()
+	return r.ReadCloser.Close()
+}
+
+func (r *previewReader) log() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.logged {
+		return
+	}
+	r.logged = true
+	log.Printf("debug: request_id=%s method=%s path=%s body_bytes=%d truncated=%t body=%q",
+		r.requestID, r.method, r.path, r.total, r.total > int64(r.buf.Len()), redactJSON(r.buf.Bytes(), r.preview.redact))
+}
+
+// redactJSON masks the values of object fields whose names match redact. It
+// works on the raw text, so that truncated bodies and NDJSON bulk bodies are
+// redacted as well; a value cut off by truncation is masked to the end.
+func redactJSON(body []byte, redact *regexp.Regexp) string {
+	if redact == nil {
+		return string(body)
+	}
+	var out bytes.Buffer
+	for i := 0; i < len(body); {
+		if body[i] != '"' {
+			out.WriteByte(body[i])
+			i++
+			continue
+		}
+		end := jsonStringEnd(body, i)
+		key := body[i:end]
+		out.Write(key)
+		i = end
+		colon := skipJSONSpace(body, i)
+		if colon >= len(body) || body[colon] != ':' {
+			continue
+		}
+		name := bytes.TrimSuffix(key[1:], []byte(`"`))
+		if !redact.Match(name) {
+			continue
+		}
+		value := skipJSONSpace(body, colon+1)
+		out.Write(body[i:value])
+		if value < len(body) {
+			out.WriteString(redactedValue)
+		}
+		i = jsonValueEnd(body, value)
+	}
+	return out.String()
+}
+
+// jsonStringEnd returns the index after the string starting at the quote at
+// start, or the end of body when it is cut off.
+func jsonStringEnd(body []byte, start int) int {
+	for i := start + 1; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(body)
+}
+
+func skipJSONSpace(body []byte, i int) int {
+	for i < len(body) && (body[i] == ' ' || body[i] == '\t' || body[i] == '\n' || body[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// jsonValueEnd returns the index after the value starting at start, or the end
+// of body when it is cut off.
+func jsonValueEnd(body []byte, start int) int {
+	if start >= len(body) {
+		return start
+	}
+	switch body[start] {
+	case '"':
+		return jsonStringEnd(body, start)
+	case '{', '[':
+		depth := 0
+		for i := start; i < len(body); i++ {
+			switch body[i] {
+			case '"':
+				i = jsonStringEnd(body, i) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return len(body)
+	}
+	i := start
+	for i < len(body) && !bytes.ContainsRune([]byte(",}] \t\r\n"), rune(body[i])) {
+		i++
+	}
+	return i
+}
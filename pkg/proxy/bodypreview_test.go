@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestRedactJSON(t *testing.T) {
+	redact := regexp.MustCompile(`(?i)password|email|address`)
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "string", body: `{"user":"ann","email":"ann@example.com"}`, want: `{"user":"ann","email":"[REDACTED]"}`},
+		{name: "number and spacing", body: `{"password" : 1234, "n": 1}`, want: `{"password" : "[REDACTED]", "n": 1}`},
+		{name: "object", body: `{"address":{"street":"a \"b\"","zip":[1,2]},"q":1}`, want: `{"address":"[REDACTED]","q":1}`},
+		{name: "prefixed field", body: `{"query":{"term":{"products.email":"x"}}}`, want: `{"query":{"term":{"products.email":"[REDACTED]"}}}`},
+		{name: "escaped quote in value", body: `{"note":"say \"email\": hi","email":"x"}`, want: `{"note":"say \"email\": hi","email":"[REDACTED]"}`},
+		{name: "truncated value", body: `{"name":"a","email":"ann@exa`, want: `{"name":"a","email":"[REDACTED]"`},
+		{name: "truncated before value", body: `{"email":`, want: `{"email":`},
+		{name: "ndjson", body: "{\"index\":{}}\n{\"email\":\"a\"}\n", want: "{\"index\":{}}\n{\"email\":\"[REDACTED]\"}\n"},
+		{name: "field names as values", body: `{"field":"email"}`, want: `{"field":"email"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactJSON([]byte(tt.body), redact); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+	if got := redactJSON([]byte(`{"email":"a"}`), nil); got != `{"email":"a"}` {
+		t.Fatalf("expected no redaction without a pattern, got %s", got)
+	}
+}
+
+func TestBodyPreviewLogsRewrittenBody(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.BodyPreview.Enabled = true
+	cfg.BodyPreview.MaxBytes = 64
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	body := `{"name":"ann","email":"ann@example.com","text":"` + strings.Repeat("x", 100) + `"}`
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/products-tenant1/_doc/1", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	line := ""
+	for _, candidate := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(candidate, "debug: request_id=") {
+			line = candidate
+		}
+	}
+	if line == "" {
+		t.Fatalf("expected a body preview, got %s", logs.String())
+	}
+	if strings.Contains(line, "ann@example.com") || !strings.Contains(line, `\"email\":\"[REDACTED]\"`) {
+		t.Fatalf("expected the email to be redacted, got %s", line)
+	}
+	if !strings.Contains(line, "truncated=true") || !strings.Contains(line, "method=PUT") {
+		t.Fatalf("expected a truncated preview, got %s", line)
+	}
+}
+
+func TestBodyPreviewDisabled(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/products-tenant1/_doc/1", strings.NewReader(`{"name":"ann"}`)))
+	if strings.Contains(logs.String(), "debug: ") {
+		t.Fatalf("expected no body preview, got %s", logs.String())
+	}
+}
@@ -0,0 +1,302 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// BootstrapPlan describes the tenant indices to prepare on the upstream cluster
+// when adopting the proxy.
+type BootstrapPlan struct {
+	// Indices are tenant-facing index names such as products-tenant1.
+	Indices []string
+	// Mappings holds index create bodies (settings and mappings as tenants see
+	// them) keyed by base index.
+	Mappings map[string][]byte
+	// Backfill copies documents from existing upstream indices named like
+	// Indices into their target index, adding the tenant field or wrapping the
+	// source under the base index on the way.
+	Backfill bool
+}
+
+type bootstrapTarget struct {
+	index    string
+	upstream *upstreamClient
+	bases    []string
+	tenants  []bootstrapTenant
+}
+
+type bootstrapTenant struct {
+	index     string
+	baseIndex string
+	tenantID  string
+}
+
+// Bootstrap creates the shared or per-tenant indices for plan with merged
+// mappings, creates the tenant aliases in shared mode, and optionally backfills
+// existing documents.
+func (p *Proxy) Bootstrap(ctx context.Context, plan BootstrapPlan) error {
+	if len(plan.Indices) == 0 {
+		return fmt.Errorf("bootstrap requires at least one index")
+	}
+	targets, err := p.bootstrapTargets(plan.Indices)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		body, err := p.mergedCreateBody(target, plan.Mappings)
+		if err != nil {
+			return err
+		}
+		if err := p.bootstrapCreateIndex(ctx, target.upstream, target.index, body); err != nil {
+			return err
+		}
+		for _, tenant := range target.tenants {
+			if isSharedMode(p.cfg.Mode) {
+				if err := p.bootstrapAlias(ctx, target.index, tenant); err != nil {
+					return err
+				}
+			}
+			if plan.Backfill {
+				if err := p.bootstrapBackfill(ctx, target.index, tenant); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Proxy) bootstrapTargets(indices []string) ([]*bootstrapTarget, error) {
+	tenants := make([]bootstrapTenant, 0, len(indices))
+	for _, index := range indices {
+		baseIndex, tenantID, err := p.matchTenantRegex(index)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, bootstrapTenant{index: index, baseIndex: baseIndex, tenantID: tenantID})
+	}
+	return p.groupBootstrapTargets(tenants)
+}
+
+// groupBootstrapTargets groups tenant indices by the shared or per-tenant index
+// storing them and the upstream cluster the tenant is routed to.
+func (p *Proxy) groupBootstrapTargets(tenants []bootstrapTenant) ([]*bootstrapTarget, error) {
+	type targetKey struct {
+		index    string
+		upstream *upstreamClient
+	}
+	byIndex := make(map[targetKey]*bootstrapTarget)
+	var targets []*bootstrapTarget
+	for _, tenant := range tenants {
+		targetIndex, err := p.renderTargetIndex(tenant.baseIndex, tenant.tenantID)
+		if err != nil {
+			return nil, err
+		}
+		key := targetKey{index: targetIndex, upstream: p.upstreamFor(tenant.tenantID)}
+		target, ok := byIndex[key]
+		if !ok {
+			target = &bootstrapTarget{index: targetIndex, upstream: key.upstream}
+			byIndex[key] = target
+			targets = append(targets, target)
+		}
+		if !containsString(target.bases, tenant.baseIndex) {
+			target.bases = append(target.bases, tenant.baseIndex)
+		}
+		target.tenants = append(target.tenants, tenant)
+	}
+	return targets, nil
+}
+
+// mergedCreateBody combines the create bodies of every base index stored in
+// target. Settings and mapping options are taken from the first body that sets
+// them; field mappings are merged and must agree.
+func (p *Proxy) mergedCreateBody(target *bootstrapTarget, mappings map[string][]byte) ([]byte, error) {
+	settings := map[string]interface{}{}
+	mappingOptions := map[string]interface{}{}
+	properties := map[string]interface{}{}
+	for _, baseIndex := range target.bases {
+		body, ok := mappings[baseIndex]
+		if !ok || len(bytes.TrimSpace(body)) == 0 {
+			continue
+		}
+		rewritten, err := p.rewriteMappingBody(body, baseIndex)
+		if err != nil {
+			return nil, fmt.Errorf("mapping for %s: %w", baseIndex, err)
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(rewritten, &payload); err != nil {
+			return nil, fmt.Errorf("mapping for %s: invalid JSON body: %w", baseIndex, err)
+		}
+		if _, ok := payload["mappings"]; !ok {
+			if _, ok := payload["properties"]; ok {
+				payload = map[string]interface{}{"mappings": payload}
+			}
+		}
+		if value, ok := payload["settings"].(map[string]interface{}); ok {
+			for key, setting := range value {
+				if _, exists := settings[key]; !exists {
+					settings[key] = setting
+				}
+			}
+		}
+		mapping, _ := payload["mappings"].(map[string]interface{})
+		for key, value := range mapping {
+			if key != "properties" {
+				if _, exists := mappingOptions[key]; !exists {
+					mappingOptions[key] = value
+				}
+				continue
+			}
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("mapping for %s: mappings.properties must be an object", baseIndex)
+			}
+			for field, fieldMapping := range props {
+				if existing, exists := properties[field]; exists && !reflect.DeepEqual(existing, fieldMapping) {
+					return nil, fmt.Errorf("conflicting mappings for field %s in %s", field, target.index)
+				}
+				properties[field] = fieldMapping
+			}
+		}
+	}
+	if isSharedMode(p.cfg.Mode) {
+		for _, baseIndex := range target.bases {
+			field := p.tenantField(baseIndex)
+			if _, exists := properties[field]; !exists {
+				properties[field] = map[string]interface{}{"type": "keyword"}
+			}
+		}
+	}
+	payload := map[string]interface{}{}
+	if len(settings) != 0 {
+		payload["settings"] = settings
+	}
+	if len(properties) != 0 || len(mappingOptions) != 0 {
+		mappingOptions["properties"] = properties
+		payload["mappings"] = mappingOptions
+	}
+	return json.Marshal(payload)
+}
+
+func (p *Proxy) bootstrapCreateIndex(ctx context.Context, upstream *upstreamClient, index string, body []byte) error {
+	resp, err := upstream.do(ctx, nil, http.MethodPut, "/"+url.PathEscape(index), body)
+	if err != nil {
+		return fmt.Errorf("create index %s: %w", index, err)
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
+		log.Printf("bootstrap: created index %s", index)
+	case resp.StatusCode == http.StatusBadRequest && bytes.Contains(message, []byte("resource_already_exists_exception")):
+		log.Printf("bootstrap: index %s already exists", index)
+	default:
+		return fmt.Errorf("create index %s: unexpected status %d: %s", index, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+func (p *Proxy) bootstrapAlias(ctx context.Context, index string, tenant bootstrapTenant) error {
+	aliasName, err := p.renderAlias(tenant.baseIndex, tenant.tenantID)
+	if err != nil {
+		return err
+	}
+	aliases := p.tenantAliases(tenant.tenantID)
+	exists, err := aliases.exists(ctx, nil, aliasName)
+	if err != nil {
+		return fmt.Errorf("check tenant alias %s: %w", aliasName, err)
+	}
+	if exists {
+		log.Printf("bootstrap: alias %s already exists", aliasName)
+		return nil
+	}
+	if err := aliases.add(ctx, nil, index, aliasName, p.tenantField(tenant.baseIndex), tenant.tenantID); err != nil {
+		return fmt.Errorf("create tenant alias %s: %w", aliasName, err)
+	}
+	log.Printf("bootstrap: created alias %s -> %s", aliasName, index)
+	return nil
+}
+
+// bootstrapBackfill reindexes documents from an existing index named like the
+// tenant index into the target index. Missing source indices are skipped.
+func (p *Proxy) bootstrapBackfill(ctx context.Context, index string, tenant bootstrapTenant) error {
+	if tenant.index == index {
+		return nil
+	}
+	upstream := p.upstreamFor(tenant.tenantID)
+	resp, err := upstream.do(ctx, nil, http.MethodHead, "/"+url.PathEscape(tenant.index), nil)
+	if err != nil {
+		return fmt.Errorf("check index %s: %w", tenant.index, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("check index %s: unexpected status %d", tenant.index, resp.StatusCode)
+	}
+	payload := map[string]interface{}{
+		"source": map[string]interface{}{"index": tenant.index},
+		"dest":   map[string]interface{}{"index": index},
+	}
+	switch {
+	case isSharedMode(p.cfg.Mode):
+		payload["script"] = map[string]interface{}{
+			"lang":   "painless",
+			"source": "ctx._source[params.field] = params.tenant",
+			"params": map[string]interface{}{
+				"field":  p.tenantField(tenant.baseIndex),
+				"tenant": tenant.tenantID,
+			},
+		}
+	case p.wrapSource():
+		payload["script"] = map[string]interface{}{
+			"lang":   "painless",
+			"source": "Map wrapped = new HashMap(); wrapped.put(params.base, ctx._source); ctx._source = wrapped",
+			"params": map[string]interface{}{"base": tenant.baseIndex},
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err = upstream.do(ctx, nil, http.MethodPost, "/_reindex", body)
+	if err != nil {
+		return fmt.Errorf("backfill %s: %w", tenant.index, err)
+	}
+	defer resp.Body.Close()
+	message, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("backfill %s: %w", tenant.index, err)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("backfill %s: unexpected status %d: %s", tenant.index, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	var result struct {
+		Total    int64         `json:"total"`
+		Failures []interface{} `json:"failures"`
+	}
+	if err := json.Unmarshal(message, &result); err == nil && len(result.Failures) != 0 {
+		return fmt.Errorf("backfill %s: %d failures", tenant.index, len(result.Failures))
+	}
+	log.Printf("bootstrap: backfilled %d documents from %s into %s", result.Total, tenant.index, index)
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+type bootstrapUpstream struct {
+	mu       sync.Mutex
+	existing map[string]bool
+	calls    []capturedCall
+}
+
+func (u *bootstrapUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.calls = append(u.calls, capturedCall{method: r.Method, path: r.URL.Path, body: body})
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodHead:
+		if !u.existing[strings.TrimPrefix(r.URL.Path, "/")] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPost && r.URL.Path == "/_reindex":
+		_, _ = io.WriteString(w, `{"total":3,"failures":[]}`)
+	default:
+		_, _ = io.WriteString(w, `{"acknowledged":true}`)
+	}
+}
+
+func (u *bootstrapUpstream) find(method, path string) []capturedCall {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var found []capturedCall
+	for _, call := range u.calls {
+		if call.method == method && call.path == path {
+			found = append(found, call)
+		}
+	}
+	return found
+}
+
+func TestBootstrapSharedMode(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-index"
+	upstream := &bootstrapUpstream{existing: map[string]bool{
+		"_alias/alias-products-tenant2": true,
+		"products-tenant1":              true,
+	}}
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	err := proxyHandler.Bootstrap(context.Background(), BootstrapPlan{
+		Indices: []string{"products-tenant1", "products-tenant2", "orders-tenant1"},
+		Mappings: map[string][]byte{
+			"products": []byte(`{"settings":{"number_of_shards":1},"mappings":{"properties":{"name":{"type":"text"}}}}`),
+			"orders":   []byte(`{"properties":{"total":{"type":"long"}}}`),
+		},
+		Backfill: true,
+	})
+	if err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+
+	creates := upstream.find(http.MethodPut, "/shared-index")
+	if len(creates) != 1 {
+		t.Fatalf("expected shared index created once, got %d", len(creates))
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(creates[0].body, &payload); err != nil {
+		t.Fatalf("parse create body: %v", err)
+	}
+	props := payload["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	for _, field := range []string{"name", "total", "tenant_id"} {
+		if _, ok := props[field]; !ok {
+			t.Fatalf("expected merged mapping for %s, got %v", field, props)
+		}
+	}
+	if payload["settings"].(map[string]interface{})["number_of_shards"] != float64(1) {
+		t.Fatalf("expected settings kept, got %v", payload["settings"])
+	}
+
+	aliases := upstream.find(http.MethodPost, "/_aliases")
+	if len(aliases) != 2 {
+		t.Fatalf("expected two missing aliases created, got %d", len(aliases))
+	}
+	if strings.Contains(string(aliases[0].body)+string(aliases[1].body), "alias-products-tenant2") {
+		t.Fatalf("expected existing alias skipped")
+	}
+
+	reindex := upstream.find(http.MethodPost, "/_reindex")
+	if len(reindex) != 1 {
+		t.Fatalf("expected one backfill for the existing index, got %d", len(reindex))
+	}
+	body := string(reindex[0].body)
+	if !strings.Contains(body, `"index":"products-tenant1"`) || !strings.Contains(body, `"tenant":"tenant1"`) {
+		t.Fatalf("unexpected reindex body: %s", body)
+	}
+}
+
+func TestBootstrapIndexPerTenantWrapsMappings(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}-v1"
+	upstream := &bootstrapUpstream{existing: map[string]bool{"products-tenant1": true}}
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	err := proxyHandler.Bootstrap(context.Background(), BootstrapPlan{
+		Indices:  []string{"products-tenant1"},
+		Mappings: map[string][]byte{"products": []byte(`{"mappings":{"properties":{"name":{"type":"text"}}}}`)},
+		Backfill: true,
+	})
+	if err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	creates := upstream.find(http.MethodPut, "/products-tenant1-v1")
+	if len(creates) != 1 || !strings.Contains(string(creates[0].body), `{"products":{"properties":{"name"`) {
+		t.Fatalf("expected wrapped mapping, got %v", creates)
+	}
+	if len(upstream.find(http.MethodPost, "/_aliases")) != 0 {
+		t.Fatalf("expected no aliases in index-per-tenant mode")
+	}
+	reindex := upstream.find(http.MethodPost, "/_reindex")
+	if len(reindex) != 1 || !strings.Contains(string(reindex[0].body), `"base":"products"`) {
+		t.Fatalf("expected wrapping backfill, got %v", reindex)
+	}
+}
+
+func TestBootstrapConflictingMappings(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-index"
+	upstream := &bootstrapUpstream{}
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	err := proxyHandler.Bootstrap(context.Background(), BootstrapPlan{
+		Indices: []string{"products-tenant1", "orders-tenant1"},
+		Mappings: map[string][]byte{
+			"products": []byte(`{"properties":{"name":{"type":"text"}}}`),
+			"orders":   []byte(`{"properties":{"name":{"type":"keyword"}}}`),
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "conflicting mappings for field name") {
+		t.Fatalf("expected mapping conflict, got %v", err)
+	}
+	if len(upstream.calls) != 0 {
+		t.Fatalf("expected no upstream calls, got %d", len(upstream.calls))
+	}
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// setBulkResponse records the summary of a rewritten bulk body, so the items
+// of the response can report the indices the actions named.
+func (p *Proxy) setBulkResponse(r *http.Request, summary *bulkSummary) {
+	p.setResponseKind(r, responseKindBulk, "", "")
+	if state := requestStateFrom(r); state != nil {
+		state.bulk = summary
+	}
+}
+
+// rewriteBulkItems reports the items of a bulk response under the indices
+// their actions named instead of the shared or per-tenant indices they were
+// written to. Failed items keep their error type and reason, with the upstream
+// index replaced and the index UUID and shard, which describe the cluster
+// rather than the tenant, removed.
+func rewriteBulkItems(payload map[string]interface{}, indices []string) bool {
+	items, ok := payload["items"].([]interface{})
+	if !ok {
+		return false
+	}
+	changed := false
+	for i, item := range items {
+		if i >= len(indices) {
+			break
+		}
+		operation, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, value := range operation {
+			result, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			target, _ := result["_index"].(string)
+			if target != "" && target != indices[i] {
+				result["_index"] = indices[i]
+				changed = true
+			}
+			if cause, ok := result["error"].(map[string]interface{}); ok {
+				changed = scrubBulkError(cause, target, indices[i]) || changed
+			}
+		}
+	}
+	return changed
+}
+
+// scrubBulkError rewrites an item error and its causes for the index the
+// action named.
+func scrubBulkError(cause map[string]interface{}, target, index string) bool {
+	changed := setCauseIndex(cause, index)
+	if _, ok := cause["shard"]; ok {
+		delete(cause, "shard")
+		changed = true
+	}
+	if reason, ok := cause["reason"].(string); ok && target != "" && target != index {
+		if scrubbed := replaceBracketedIndex(reason, target, index); scrubbed != reason {
+			cause["reason"] = scrubbed
+			changed = true
+		}
+	}
+	if causedBy, ok := cause["caused_by"].(map[string]interface{}); ok {
+		changed = scrubBulkError(causedBy, target, index) || changed
+	}
+	return changed
+}
+
+// replaceBracketedIndex replaces the references to target in an error reason,
+// [target] or [target/uuid], with [index].
+func replaceBracketedIndex(reason, target, index string) string {
+	var builder strings.Builder
+	rest := reason
+	for {
+		start := strings.Index(rest, "["+target)
+		if start < 0 {
+			break
+		}
+		after := rest[start+1+len(target):]
+		end := -1
+		switch {
+		case strings.HasPrefix(after, "]"):
+			end = 1
+		case strings.HasPrefix(after, "/"):
+			end = strings.IndexByte(after, ']') + 1
+		}
+		if end <= 0 {
+			builder.WriteString(rest[:start+1])
+			rest = rest[start+1:]
+			continue
+		}
+		builder.WriteString(rest[:start])
+		builder.WriteString("[" + index + "]")
+		rest = after[end:]
+	}
+	if builder.Len() == 0 {
+		return reason
+	}
+	builder.WriteString(rest)
+	return builder.String()
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestBulkResponseItemsReportNamedIndices(t *testing.T) {
+	cfg := config.Default()
+	upstreamBody := `{"took":3,"errors":true,"items":[` +
+		`{"index":{"_index":"orders","_id":"1","_version":1,"result":"created","_shards":{"total":2,"successful":1,"failed":0},"status":201}},` +
+		`{"create":{"_index":"orders","_id":"2","status":409,"error":{"type":"version_conflict_engine_exception","reason":"[2]: version conflict, document already exists (current version [1]) in [orders/9kP2xQ]","index_uuid":"9kP2xQ","shard":"3","index":"orders"}}},` +
+		`{"update":{"_index":"users","_id":"3","status":404,"error":{"type":"document_missing_exception","reason":"[3]: document missing","index_uuid":"Zx81Lm","shard":"0","index":"users","caused_by":{"type":"illegal_state_exception","reason":"index [users] shard [0]"}}}}` +
+		`]}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, upstreamBody))
+
+	body := "{\"index\":{\"_index\":\"orders-tenant1\",\"_id\":\"1\"}}\n{\"total\":1}\n" +
+		"{\"create\":{\"_index\":\"orders-tenant1\",\"_id\":\"2\"}}\n{\"total\":2}\n" +
+		"{\"update\":{\"_index\":\"users-tenant1\",\"_id\":\"3\"}}\n{\"doc\":{\"name\":\"a\"}}\n"
+	req := httptest.NewRequest(http.MethodPost, "/_bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var payload struct {
+		Items []map[string]map[string]interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response %q: %v", rec.Body.String(), err)
+	}
+	if len(payload.Items) != 3 {
+		t.Fatalf("expected three items, got %s", rec.Body.String())
+	}
+	for i, want := range []string{"orders-tenant1", "orders-tenant1", "users-tenant1"} {
+		for _, result := range payload.Items[i] {
+			if result["_index"] != want {
+				t.Fatalf("item %d: expected _index %s, got %v", i, want, result["_index"])
+			}
+		}
+	}
+	conflict := payload.Items[1]["create"]["error"].(map[string]interface{})
+	if conflict["index"] != "orders-tenant1" || conflict["index_uuid"] != nil || conflict["shard"] != nil {
+		t.Fatalf("expected the conflict scrubbed, got %v", conflict)
+	}
+	if reason := conflict["reason"]; reason != "[2]: version conflict, document already exists (current version [1]) in [orders-tenant1]" {
+		t.Fatalf("unexpected conflict reason %q", reason)
+	}
+	causedBy := payload.Items[2]["update"]["error"].(map[string]interface{})["caused_by"].(map[string]interface{})
+	if causedBy["reason"] != "index [users-tenant1] shard [0]" {
+		t.Fatalf("unexpected caused_by reason %q", causedBy["reason"])
+	}
+	if shards, ok := payload.Items[0]["index"]["_shards"].(map[string]interface{}); !ok || shards["total"] != float64(2) {
+		t.Fatalf("expected successful items to keep their shards, got %v", payload.Items[0])
+	}
+}
+
+func TestReplaceBracketedIndex(t *testing.T) {
+	cases := map[string]string{
+		"index [orders]":             "index [orders-tenant1]",
+		"in [orders/9kP2xQ] and [1]": "in [orders-tenant1] and [1]",
+		"field [orders.total]":       "field [orders.total]",
+		"[orders-archive] missing":   "[orders-archive] missing",
+		"no index":                   "no index",
+	}
+	for reason, want := range cases {
+		if got := replaceBracketedIndex(reason, "orders", "orders-tenant1"); got != want {
+			t.Fatalf("replaceBracketedIndex(%q) = %q, want %q", reason, got, want)
+		}
+	}
+}
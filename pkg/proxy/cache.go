@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"container/list"
+	"regexp"
+	"sync"
+	"text/template"
+)
+
+// nameCacheSize bounds the number of rendered index and alias names kept per
+// proxy. Each entry is a few dozen bytes, and the working set is the number of
+// active (base index, tenant) pairs.
+const nameCacheSize = 4096
+
+type nameKey struct {
+	tmpl   *template.Template
+	index  string
+	tenant string
+}
+
+type nameEntry struct {
+	key  nameKey
+	name string
+}
+
+// nameCache is a fixed-size LRU cache of rendered index and alias names. A nil
+// cache never hits, so proxies built without one render every name.
+type nameCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[nameKey]*list.Element
+}
+
+func newNameCache(capacity int) *nameCache {
+	return &nameCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[nameKey]*list.Element, capacity),
+	}
+}
+
+func (c *nameCache) get(key nameKey) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*nameEntry).name, true
+}
+
+func (c *nameCache) add(key nameKey, name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*nameEntry).name = name
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&nameEntry{key: key, name: name})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*nameEntry).key)
+	}
+}
+
+// matchCacheSize bounds the number of tenant regex results kept per proxy. The
+// working set is the number of index names clients and _cat output use.
+const matchCacheSize = 4096
+
+// matchKey includes the compiled tenant regex, so results of a previous
+// pattern never answer for a proxy built from a reloaded configuration.
+type matchKey struct {
+	regex *regexp.Regexp
+	index string
+}
+
+// tenantMatch is the result of matching an index name against the tenant
+// regex. An unmatched name is cached too, so _cat output of other indices does
+// not run the regex on every line.
+type tenantMatch struct {
+	matched   bool
+	baseIndex string
+	tenantID  string
+}
+
+type matchEntry struct {
+	key   matchKey
+	match tenantMatch
+}
+
+// matchCacheStats are the counters reported on GET /admin/regexcache.
+type matchCacheStats struct {
+	Entries  int     `json:"entries"`
+	Capacity int     `json:"capacity"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRate  float64 `json:"hit_rate"`
+}
+
+// matchCache is a fixed-size LRU cache of tenant regex results. A nil cache
+// never hits, so proxies built without one run the regex on every lookup.
+type matchCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[matchKey]*list.Element
+	hits     int64
+	misses   int64
+}
+
+func newMatchCache(capacity int) *matchCache {
+	return &matchCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[matchKey]*list.Element, capacity),
+	}
+}
+
+func (c *matchCache) get(key matchKey) (tenantMatch, bool) {
+	if c == nil {
+		return tenantMatch{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return tenantMatch{}, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*matchEntry).match, true
+}
+
+func (c *matchCache) add(key matchKey, match tenantMatch) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*matchEntry).match = match
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&matchEntry{key: key, match: match})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*matchEntry).key)
+	}
+}
+
+// reset drops every cached result.
+func (c *matchCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[matchKey]*list.Element, c.capacity)
+}
+
+func (c *matchCache) stats() matchCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := matchCacheStats{Entries: c.order.Len(), Capacity: c.capacity, Hits: c.hits, Misses: c.misses}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"text/template"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestNameCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	tmpl := template.Must(template.New("alias").Parse("{{.index}}"))
+	cache := newNameCache(2)
+	first := nameKey{tmpl: tmpl, index: "orders", tenant: "tenant1"}
+	second := nameKey{tmpl: tmpl, index: "orders", tenant: "tenant2"}
+	third := nameKey{tmpl: tmpl, index: "orders", tenant: "tenant3"}
+
+	cache.add(first, "alias-orders-tenant1")
+	cache.add(second, "alias-orders-tenant2")
+	if name, ok := cache.get(first); !ok || name != "alias-orders-tenant1" {
+		t.Fatalf("expected cached name, got %q %v", name, ok)
+	}
+	cache.add(third, "alias-orders-tenant3")
+
+	if _, ok := cache.get(second); ok {
+		t.Fatalf("expected least recently used entry evicted")
+	}
+	if _, ok := cache.get(first); !ok {
+		t.Fatalf("expected recently used entry kept")
+	}
+	if _, ok := cache.get(third); !ok {
+		t.Fatalf("expected newest entry kept")
+	}
+}
+
+func TestNilNameCacheNeverHits(t *testing.T) {
+	var cache *nameCache
+	key := nameKey{index: "orders", tenant: "tenant1"}
+	cache.add(key, "orders")
+	if _, ok := cache.get(key); ok {
+		t.Fatalf("expected nil cache to miss")
+	}
+}
+
+func TestRenderUsesTemplateInCacheKey(t *testing.T) {
+	cfg := config.Default()
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	for i := 0; i < 2; i++ {
+		alias, err := proxyHandler.renderAlias("orders", "tenant1")
+		if err != nil || alias != "alias-orders-tenant1" {
+			t.Fatalf("unexpected alias %q: %v", alias, err)
+		}
+		index, err := proxyHandler.renderTargetIndex("orders", "tenant1")
+		if err != nil || index != "shared-orders" {
+			t.Fatalf("unexpected index %q: %v", index, err)
+		}
+	}
+}
+
+func TestMatchCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	regex := regexp.MustCompile(`^(?P<prefix>[^-]+)-(?P<tenant>[^-]+)(?P<postfix>.*)$`)
+	cache := newMatchCache(2)
+	first := matchKey{regex: regex, index: "orders-tenant1"}
+	second := matchKey{regex: regex, index: "orders-tenant2"}
+	third := matchKey{regex: regex, index: "orders-tenant3"}
+
+	cache.add(first, tenantMatch{matched: true, baseIndex: "orders", tenantID: "tenant1"})
+	cache.add(second, tenantMatch{matched: true, baseIndex: "orders", tenantID: "tenant2"})
+	if match, ok := cache.get(first); !ok || match.tenantID != "tenant1" {
+		t.Fatalf("expected cached match, got %+v %v", match, ok)
+	}
+	cache.add(third, tenantMatch{matched: true, baseIndex: "orders", tenantID: "tenant3"})
+
+	if _, ok := cache.get(second); ok {
+		t.Fatalf("expected least recently used entry evicted")
+	}
+	if _, ok := cache.get(first); !ok {
+		t.Fatalf("expected recently used entry kept")
+	}
+	if _, ok := cache.get(matchKey{regex: regexp.MustCompile(regex.String()), index: "orders-tenant1"}); ok {
+		t.Fatalf("expected another compiled regex to miss")
+	}
+	if stats := cache.stats(); stats.Entries != 2 || stats.Hits != 2 || stats.Misses != 2 || stats.HitRate != 0.5 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMatchTenantRegexCachesResults(t *testing.T) {
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+	for i := 0; i < 2; i++ {
+		baseIndex, tenantID, err := proxyHandler.matchTenantRegex("orders-tenant1")
+		if err != nil || baseIndex != "orders" || tenantID != "tenant1" {
+			t.Fatalf("unexpected match %q %q: %v", baseIndex, tenantID, err)
+		}
+		if _, _, err := proxyHandler.matchTenantRegex("orders"); codeOf(err, "") != codeTenantRegexMismatch {
+			t.Fatalf("expected a regex mismatch, got %v", err)
+		}
+		if tenantID, ok := proxyHandler.tenantIDForIndex("orders-tenant1"); !ok || tenantID != "tenant1" {
+			t.Fatalf("unexpected tenant %q %v", tenantID, ok)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/regexcache", nil))
+	var stats matchCacheStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("parse regex cache stats %q: %v", rec.Body.String(), err)
+	}
+	if stats.Entries != 2 || stats.Misses != 2 || stats.Hits != 4 {
+		t.Fatalf("unexpected regex cache stats %+v", stats)
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/regexcache", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.Entries != 0 {
+		t.Fatalf("expected the regex cache to be dropped, got %s", rec.Body.String())
+	}
+}
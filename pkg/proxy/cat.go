@@ -0,0 +1,299 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	catIndices = "indices"
+	catAliases = "aliases"
+	catShards  = "shards"
+	catCount   = "count"
+)
+
+// catEndpoint returns the _cat API whose response is annotated with tenant ids,
+// or an empty string for any other path.
+func (p *Proxy) catEndpoint(pathValue string) string {
+	segments := splitPath(pathValue)
+	if len(segments) < 2 || segments[0] != "_cat" {
+		return ""
+	}
+	switch segments[1] {
+	case catIndices:
+		if len(segments) == 2 {
+			return catIndices
+		}
+	case catAliases, catShards:
+		if len(segments) <= 3 {
+			return segments[1]
+		}
+	case catCount:
+		if len(segments) == 3 {
+			return catCount
+		}
+	}
+	return ""
+}
+
+// catTenantColumns lists the column names, including their short forms, that
+// hold the name the tenant is derived from.
+func catTenantColumns(endpoint string) []string {
+	switch endpoint {
+	case catAliases:
+		return []string{"alias", "a"}
+	case catIndices, catShards:
+		return []string{"index", "i", "idx"}
+	}
+	return nil
+}
+
+// catTenant returns the tenant _cat rows are filtered to, or an empty string
+// when every row is returned. A tenant authenticated by the basic auth front
+// door only sees its own rows. With TenantScoped the tenant header is ignored,
+// since any client could set it to read another tenant's rows.
+func (p *Proxy) catTenant(r *http.Request) string {
+	if state := requestStateFrom(r); state != nil && state.authTenant != "" {
+		return state.authTenant
+	}
+	if p.cfg.Cat.TenantHeader != "" && !p.cfg.Cat.TenantScoped {
+		if tenantID := strings.TrimSpace(r.Header.Get(p.cfg.Cat.TenantHeader)); tenantID != "" {
+			return tenantID
+		}
+	}
+	if p.cfg.Cat.TenantScoped && p.cfg.Auth.Header != "" {
+		return basicAuthUser(r.Header.Get(p.cfg.Auth.Header))
+	}
+	return ""
+}
+
+func basicAuthUser(value string) string {
+	scheme, credentials, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok || !strings.EqualFold(scheme, "basic") {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return ""
+	}
+	user, _, _ := strings.Cut(string(decoded), ":")
+	return user
+}
+
+func (p *Proxy) handleCatCount(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+	baseIndex, tenantID, err := p.parseIndex(r, segments[2])
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	queryIndex, err := p.renderQueryIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if state := requestStateFrom(r); state != nil {
+		state.baseIndex = baseIndex
+		state.tenantID = tenantID
+	}
+	segments[2] = queryIndex
+	p.setPathSegments(r, segments)
+	p.proxy.ServeHTTP(w, r)
+}
+
+// rewriteCatResponse adds the owning tenant to every row of a _cat response.
+// When the request identifies a tenant, rows belonging to other tenants are
+// dropped.
+func (p *Proxy) rewriteCatResponse(resp *http.Response, endpoint string) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if len(body) == 0 || resp.StatusCode != http.StatusOK {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+	filter := p.catTenant(resp.Request)
+	var pathTenant string
+	if state := requestStateFrom(resp.Request); state != nil {
+		pathTenant = state.tenantID
+	}
+	rowTenant := func(name string) (string, bool) {
+		if endpoint == catCount {
+			return pathTenant, pathTenant != ""
+		}
+		if endpoint == catAliases {
+			return p.tenantIDForAlias(name)
+		}
+		return p.tenantIDForIndex(name)
+	}
+	if isJSONMediaType(resp.Header.Get("Content-Type")) {
+		rewritten, err := addTenantToCatJSON(body, catTenantColumns(endpoint), rowTenant, filter)
+		if err != nil {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return nil
+		}
+		p.replaceResponseBody(resp, rewritten)
+		return nil
+	}
+	query := resp.Request.URL.Query()
+	header := query.Has("v") && query.Get("v") != "false"
+	column := catColumnPosition(endpoint, query.Get("h"))
+	p.replaceResponseBody(resp, addTenantToCatText(body, header, column, rowTenant, filter))
+	return nil
+}
+
+func addTenantToCatJSON(body []byte, columns []string, rowTenant func(string) (string, bool), filter string) ([]byte, error) {
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, err
+	}
+	kept := rows[:0]
+	for _, row := range rows {
+		var name string
+		for _, column := range columns {
+			if value, ok := row[column].(string); ok {
+				name = value
+				break
+			}
+		}
+		tenantID, ok := rowTenant(name)
+		if ok {
+			row["tenant_id"] = tenantID
+		}
+		if filter != "" && tenantID != filter {
+			continue
+		}
+		kept = append(kept, row)
+	}
+	return json.Marshal(kept)
+}
+
+// catColumnPosition finds the tenant column in a text _cat response. Without an
+// explicit column list (the h parameter) the endpoint's default columns apply.
+func catColumnPosition(endpoint, headers string) int {
+	columns := catTenantColumns(endpoint)
+	if len(columns) == 0 {
+		return -1
+	}
+	if strings.TrimSpace(headers) == "" {
+		if endpoint == catIndices {
+			return 2
+		}
+		return 0
+	}
+	for idx, header := range strings.Split(headers, ",") {
+		if containsString(columns, strings.TrimSpace(header)) {
+			return idx
+		}
+	}
+	return -1
+}
+
+func addTenantToCatText(body []byte, header bool, column int, rowTenant func(string) (string, bool), filter string) []byte {
+	text := string(body)
+	trailingNewline := strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	output := make([]string, 0, len(lines))
+	for idx, line := range lines {
+		if idx == 0 && header {
+			output = append(output, line+" TENANT_ID")
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var name string
+		if fields := strings.Fields(line); column >= 0 && column < len(fields) {
+			name = fields[column]
+		}
+		tenantID, ok := rowTenant(name)
+		if filter != "" && tenantID != filter {
+			continue
+		}
+		if !ok {
+			tenantID = "-"
+		}
+		output = append(output, line+" "+tenantID)
+	}
+	rewritten := strings.Join(output, "\n")
+	if trailingNewline && rewritten != "" {
+		rewritten += "\n"
+	}
+	return []byte(rewritten)
+}
+
+// tenantIDForAlias extracts the tenant from an alias rendered from the alias
+// templates of the shared index groups, falling back to the tenant regex for
+// other names.
+func (p *Proxy) tenantIDForAlias(alias string) (string, bool) {
+	if tenantID, ok := p.tenantIDFromAliasPatterns(alias); ok {
+		return tenantID, true
+	}
+	return p.tenantIDForIndex(alias)
+}
+
+// tenantIDFromAliasPatterns extracts the tenant from an alias rendered from the
+// alias templates of the shared index groups.
+func (p *Proxy) tenantIDFromAliasPatterns(alias string) (string, bool) {
+	patterns := make([]*regexp.Regexp, 0, len(p.sharedGroups)+1)
+	for _, group := range p.sharedGroups {
+		patterns = append(patterns, group.aliasPattern)
+	}
+	for _, pattern := range append(patterns, p.aliasPattern) {
+		if pattern == nil {
+			continue
+		}
+		if matches := pattern.FindStringSubmatch(alias); matches != nil {
+			if tenantID := matches[pattern.SubexpIndex("tenant")]; tenantID != "" {
+				return tenantID, true
+			}
+		}
+	}
+	return "", false
+}
+
+var templateFieldPattern = regexp.MustCompile(`\{\{\s*\.(index|tenant)\s*\}\}`)
+
+// templatePattern turns a name template such as alias-{{.index}}-{{.tenant}} into
+// a regexp with a tenant group. Templates using any other action, or not
+// referencing the tenant, return nil.
+func templatePattern(text string) *regexp.Regexp {
+	var builder strings.Builder
+	builder.WriteString("^")
+	hasTenant := false
+	last := 0
+	for _, loc := range templateFieldPattern.FindAllStringSubmatchIndex(text, -1) {
+		literal := text[last:loc[0]]
+		if strings.Contains(literal, "{{") {
+			return nil
+		}
+		builder.WriteString(regexp.QuoteMeta(literal))
+		switch field := text[loc[2]:loc[3]]; {
+		case field == "tenant" && !hasTenant:
+			builder.WriteString("(?P<tenant>.+?)")
+			hasTenant = true
+		case field == "tenant":
+			builder.WriteString(".+?")
+		default:
+			builder.WriteString(".+")
+		}
+		last = loc[1]
+	}
+	if !hasTenant || strings.Contains(text[last:], "{{") {
+		return nil
+	}
+	builder.WriteString(regexp.QuoteMeta(text[last:]))
+	builder.WriteString("$")
+	pattern, err := regexp.Compile(builder.String())
+	if err != nil {
+		return nil
+	}
+	return pattern
+}
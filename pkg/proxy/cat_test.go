@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestCatEndpoint(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	tests := map[string]string{
+		"/_cat/indices":                catIndices,
+		"/_cat/aliases":                catAliases,
+		"/_cat/aliases/alias-orders-1": catAliases,
+		"/_cat/shards/orders":          catShards,
+		"/_cat/count/orders-tenant1":   catCount,
+		"/_cat/count":                  "",
+		"/_cat/health":                 "",
+		"/orders/_cat":                 "",
+	}
+	for path, expected := range tests {
+		if got := proxyHandler.catEndpoint(path); got != expected {
+			t.Fatalf("catEndpoint(%q) = %q, expected %q", path, got, expected)
+		}
+	}
+}
+
+func TestTemplatePattern(t *testing.T) {
+	pattern := templatePattern("alias-{{.index}}-{{ .tenant }}")
+	if pattern == nil {
+		t.Fatalf("expected pattern")
+	}
+	matches := pattern.FindStringSubmatch("alias-orders-prod-tenant1")
+	if matches == nil || matches[pattern.SubexpIndex("tenant")] != "tenant1" {
+		t.Fatalf("unexpected matches: %v", matches)
+	}
+	if templatePattern("alias-{{.index}}") != nil {
+		t.Fatalf("expected nil pattern without tenant")
+	}
+	if templatePattern(`{{printf "%s" .tenant}}`) != nil {
+		t.Fatalf("expected nil pattern for other actions")
+	}
+}
+
+func TestCatAliasesJSONAnnotatesAndFilters(t *testing.T) {
+	cfg := config.Default()
+	body := `[{"alias":"alias-orders-tenant1","index":"orders"},{"alias":"alias-orders-tenant2","index":"orders"},{"alias":"reports","index":"reports"}]`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, body))
+
+	req := httptest.NewRequest(http.MethodGet, "/_cat/aliases?format=json", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if len(rows) != 3 || rows[0]["tenant_id"] != "tenant1" || rows[1]["tenant_id"] != "tenant2" {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+	if _, ok := rows[2]["tenant_id"]; ok {
+		t.Fatalf("expected no tenant for unrelated alias, got %v", rows[2])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/_cat/aliases?format=json", nil)
+	req.Header.Set("X-Tenant-ID", "tenant2")
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	rows = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["alias"] != "alias-orders-tenant2" {
+		t.Fatalf("expected only tenant2 rows, got %v", rows)
+	}
+}
+
+func TestCatShardsTextAnnotatesAndFilters(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	body := "index          shard prirep state\norders-tenant1 0     p      STARTED\norders-tenant2 0     p      STARTED\n"
+	proxyHandler := newProxyWithUpstream(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(body))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/_cat/shards?v", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	expected := "index          shard prirep state TENANT_ID\norders-tenant1 0     p      STARTED tenant1\n"
+	if rec.Body.String() != expected {
+		t.Fatalf("unexpected response:\n%s", rec.Body.String())
+	}
+}
+
+func TestCatCountRewritesIndexAndAnnotates(t *testing.T) {
+	cfg := config.Default()
+	var upstreamPath string
+	proxyHandler := newProxyWithUpstream(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"epoch":"1","timestamp":"00:00:01","count":"12"}]`))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/_cat/count/orders-tenant1?format=json", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if upstreamPath != "/_cat/count/alias-orders-tenant1" {
+		t.Fatalf("expected count routed to tenant alias, got %q", upstreamPath)
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["tenant_id"] != "tenant1" || rows[0]["count"] != "12" {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+}
+
+func TestCatIndicesTenantScoped(t *testing.T) {
+	cfg := config.Default()
+	cfg.Cat.TenantScoped = true
+	body := `[{"health":"green","index":"orders-tenant1"},{"health":"green","index":"orders-tenant2"},{"health":"green","index":"orders"}]`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, body))
+
+	req := httptest.NewRequest(http.MethodGet, "/_cat/indices?format=json", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without tenant, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/_cat/indices?format=json", nil)
+	req.SetBasicAuth("tenant2", "secret")
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["index"] != "orders-tenant2" || rows[0]["tenant_id"] != "tenant2" {
+		t.Fatalf("expected only tenant2 indices, got %v", rows)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/_cat/indices?format=json", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 with only a tenant header, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/_cat/indices?format=json", nil)
+	req.SetBasicAuth("tenant2", "secret")
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	rows = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["tenant_id"] != "tenant2" {
+		t.Fatalf("expected the tenant header ignored, got %v", rows)
+	}
+}
+
+func TestCatIndicesTextFilteredByHeader(t *testing.T) {
+	cfg := config.Default()
+	body := "health status index          pri\ngreen  open   orders-tenant1 1\ngreen  open   orders-tenant2 1\n"
+	proxyHandler := newProxyWithUpstream(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(body))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/_cat/indices?v=true", nil)
+	req.Header.Set("X-Tenant-ID", "tenant2")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	expected := "health status index          pri TENANT_ID\ngreen  open   orders-tenant2 1 tenant2\n"
+	if rec.Body.String() != expected {
+		t.Fatalf("unexpected response:\n%s", rec.Body.String())
+	}
+}
+
+func TestBasicAuthUser(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("tenant1", "a:b")
+	if user := basicAuthUser(req.Header.Get("Authorization")); user != "tenant1" {
+		t.Fatalf("expected tenant1, got %q", user)
+	}
+	if user := basicAuthUser("Bearer token"); user != "" {
+		t.Fatalf("expected no user for bearer token, got %q", user)
+	}
+}
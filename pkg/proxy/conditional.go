@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// checkConditionalWrite validates the optimistic concurrency parameters of a
+// document write. They are forwarded unchanged, so conditional writes behave
+// as they do against Elasticsearch directly; malformed ones are rejected before
+// the body is rewritten.
+func checkConditionalWrite(q url.Values, update bool) error {
+	if (q.Get("if_seq_no") == "") != (q.Get("if_primary_term") == "") {
+		return errors.New("if_seq_no and if_primary_term must be set together")
+	}
+	for _, key := range []string{"if_seq_no", "if_primary_term", "version"} {
+		value := q.Get(key)
+		if value == "" {
+			continue
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err != nil || n < 0 {
+			return fmt.Errorf("%s must be a non-negative integer (got %q)", key, value)
+		}
+	}
+	if update {
+		if q.Get("version") != "" || q.Get("version_type") != "" {
+			return errors.New("_update does not support version, use if_seq_no and if_primary_term")
+		}
+		return nil
+	}
+	switch opType := q.Get("op_type"); opType {
+	case "", "index", "create":
+	default:
+		return fmt.Errorf("op_type must be \"index\" or \"create\" (got %q)", opType)
+	}
+	return nil
+}
+
+// setWriteResponse records the index a document write names, so a version
+// conflict reports it instead of the index the write was sent to.
+func (p *Proxy) setWriteResponse(r *http.Request, index, baseIndex, tenantID string) {
+	p.setResponseKind(r, responseKindWrite, baseIndex, tenantID)
+	if state := requestStateFrom(r); state != nil {
+		state.index = index
+	}
+}
+
+// rewriteConflictIndex replaces the index of a version conflict error and its
+// root causes with the index the client wrote to.
+func rewriteConflictIndex(payload map[string]interface{}, index string) bool {
+	cause, ok := payload["error"].(map[string]interface{})
+	if !ok || cause["type"] != "version_conflict_engine_exception" {
+		return false
+	}
+	changed := setCauseIndex(cause, index)
+	if rootCauses, ok := cause["root_cause"].([]interface{}); ok {
+		for _, item := range rootCauses {
+			if rootCause, ok := item.(map[string]interface{}); ok {
+				changed = setCauseIndex(rootCause, index) || changed
+			}
+		}
+	}
+	return changed
+}
+
+func setCauseIndex(cause map[string]interface{}, index string) bool {
+	if _, ok := cause["index"]; !ok || cause["index"] == index {
+		return false
+	}
+	cause["index"] = index
+	delete(cause, "index_uuid")
+	return true
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestConditionalWrites(t *testing.T) {
+	var mu sync.Mutex
+	var paths, queries []string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		queries = append(queries, r.URL.RawQuery)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"error":{"root_cause":[{"type":"version_conflict_engine_exception","reason":"[1]: version conflict","index_uuid":"u1","shard":"0","index":"products"}],"type":"version_conflict_engine_exception","reason":"[1]: version conflict","index_uuid":"u1","shard":"0","index":"products"},"status":409}`))
+	})
+	proxyHandler := newProxyWithUpstream(t, config.Default(), upstream)
+
+	cases := []struct {
+		method string
+		target string
+		body   string
+		path   string
+		params []string
+	}{
+		{method: http.MethodPut, target: "/products-tenant1/_doc/1?if_seq_no=5&if_primary_term=2", body: `{"a":1}`, path: "/products/_doc/1", params: []string{"if_seq_no=5", "if_primary_term=2"}},
+		{method: http.MethodPut, target: "/products-tenant1/_doc/1?version=7&version_type=external", body: `{"a":1}`, path: "/products/_doc/1", params: []string{"version=7", "version_type=external"}},
+		{method: http.MethodPut, target: "/products-tenant1/_doc/1?op_type=create", body: `{"a":1}`, path: "/products/_doc/1", params: []string{"op_type=create"}},
+		{method: http.MethodPut, target: "/products-tenant1/_create/1", body: `{"a":1}`, path: "/products/_create/1"},
+		{method: http.MethodPost, target: "/products-tenant1/_update/1?if_seq_no=5&if_primary_term=2", body: `{"doc":{"a":1}}`, path: "/products/_update/1", params: []string{"if_seq_no=5", "if_primary_term=2"}},
+	}
+	for i, tc := range cases {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("%s: expected 409, got %d: %s", tc.target, rec.Code, rec.Body.String())
+		}
+		var payload struct {
+			Error struct {
+				Index     string `json:"index"`
+				RootCause []struct {
+					Index string `json:"index"`
+				} `json:"root_cause"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("decode conflict: %v", err)
+		}
+		if payload.Error.Index != "products-tenant1" || payload.Error.RootCause[0].Index != "products-tenant1" {
+			t.Fatalf("%s: expected conflict on products-tenant1, got %s", tc.target, rec.Body.String())
+		}
+		if strings.Contains(rec.Body.String(), "index_uuid") {
+			t.Fatalf("%s: expected shared index uuid to be dropped, got %s", tc.target, rec.Body.String())
+		}
+		mu.Lock()
+		path, query := paths[i], queries[i]
+		mu.Unlock()
+		if path != tc.path {
+			t.Fatalf("%s: expected upstream path %s, got %s", tc.target, tc.path, path)
+		}
+		for _, param := range tc.params {
+			if !strings.Contains(query, param) {
+				t.Fatalf("%s: expected %s to be forwarded, got %s", tc.target, param, query)
+			}
+		}
+	}
+}
+
+func TestConditionalWriteErrors(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, config.Default())
+	cases := []struct {
+		method  string
+		target  string
+		wantErr string
+	}{
+		{method: http.MethodPut, target: "/products-tenant1/_doc/1?if_seq_no=5", wantErr: "if_seq_no and if_primary_term must be set together"},
+		{method: http.MethodPut, target: "/products-tenant1/_doc/1?if_seq_no=x&if_primary_term=1", wantErr: "if_seq_no must be a non-negative integer"},
+		{method: http.MethodPut, target: "/products-tenant1/_doc/1?version=-1", wantErr: "version must be a non-negative integer"},
+		{method: http.MethodPut, target: "/products-tenant1/_doc/1?op_type=upsert", wantErr: "op_type must be"},
+		{method: http.MethodPost, target: "/products-tenant1/_update/1?version=3", wantErr: "_update does not support version"},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, strings.NewReader(`{"doc":{}}`)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tc.wantErr) {
+			t.Fatalf("%s: expected %q, got %d: %s", tc.target, tc.wantErr, rec.Code, rec.Body.String())
+		}
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream requests, got %d", count)
+	}
+}
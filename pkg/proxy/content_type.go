@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	mediaTypeJSON   = "application/json"
+	mediaTypeNDJSON = "application/x-ndjson"
+
+	vendorMediaTypePrefix = "application/vnd.elasticsearch+"
+	productHeader         = "X-Elastic-Product"
+	productName           = "Elasticsearch"
+)
+
+// requestMediaType returns the body media type with any Elasticsearch vendor
+// prefix removed, so application/vnd.elasticsearch+json; compatible-with=8 is
+// reported as application/json.
+func requestMediaType(header string) (string, map[string]string, error) {
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", nil, err
+	}
+	if format, ok := strings.CutPrefix(mediaType, vendorMediaTypePrefix); ok {
+		mediaType = "application/" + format
+	}
+	return mediaType, params, nil
+}
+
+// checkContentType rejects request bodies the proxy cannot rewrite. Bodies are
+// rewritten as JSON, or as newline-delimited JSON for _bulk and _msearch, so
+// binary formats such as CBOR and SMILE are refused up front instead of failing
+// with a parse error. A missing Content-Type is treated as JSON.
+func checkContentType(r *http.Request, segments []string) error {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+	header := strings.TrimSpace(r.Header.Get("Content-Type"))
+	if header == "" {
+		return nil
+	}
+	mediaType, params, err := requestMediaType(header)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type header %q", header)
+	}
+	if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") && !strings.EqualFold(charset, "utf8") {
+		return fmt.Errorf("unsupported charset %q, request bodies must be UTF-8", charset)
+	}
+	switch mediaType {
+	case mediaTypeJSON:
+		return nil
+	case mediaTypeNDJSON:
+		if isNDJSONPath(segments) {
+			return nil
+		}
+		return fmt.Errorf("Content-Type %s is only supported for _bulk and _msearch", mediaType)
+	case "application/cbor", "application/smile", "application/yaml", "application/x-yaml":
+		return fmt.Errorf("Content-Type %s is not supported, request bodies must be JSON", mediaType)
+	}
+	return nil
+}
+
+func isNDJSONPath(segments []string) bool {
+	if len(segments) == 0 {
+		return false
+	}
+	last := segments[len(segments)-1]
+	if last == "template" && len(segments) > 1 {
+		last = segments[len(segments)-2]
+	}
+	return last == "_bulk" || last == "_msearch"
+}
+
+// isJSONMediaType reports whether a Content-Type header names JSON, including
+// the Elasticsearch vendor type.
+func isJSONMediaType(header string) bool {
+	mediaType, _, err := requestMediaType(header)
+	return err == nil && mediaType == mediaTypeJSON
+}
+
+// compatibleWith returns the REST API compatibility version a request asks for
+// with a vendor media type in its Accept or Content-Type header, or "".
+func compatibleWith(header http.Header) string {
+	values := append(strings.Split(header.Get("Accept"), ","), header.Get("Content-Type"))
+	for _, value := range values {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+		if err != nil || !strings.HasPrefix(mediaType, vendorMediaTypePrefix) {
+			continue
+		}
+		if version := params["compatible-with"]; version != "" {
+			return version
+		}
+	}
+	return ""
+}
+
+// compatibleMediaType returns the vendor form of a JSON or NDJSON media type
+// for a compatibility version, or the media type itself when there is none.
+func compatibleMediaType(mediaType, version string) string {
+	if version == "" {
+		return mediaType
+	}
+	return vendorMediaTypePrefix + strings.TrimPrefix(mediaType, "application/") + ";compatible-with=" + version
+}
+
+// setBodyContentType sets the Content-Type of a body the proxy rewrote into a
+// different format, keeping the compatibility version the client asked for so
+// Elasticsearch does not reject a mismatch with its Accept header.
+func setBodyContentType(r *http.Request, mediaType string) {
+	r.Header.Set("Content-Type", compatibleMediaType(mediaType, compatibleWith(r.Header)))
+}
+
+// productWriter instates the headers official clients check before they accept
+// a response: X-Elastic-Product on every response, and the vendor media type
+// for JSON bodies of requests that asked for a compatibility version. Headers
+// are settled when the status is written, so responses written by the proxy and
+// by the upstream are treated alike and upstream values are not duplicated.
+type productWriter struct {
+	http.ResponseWriter
+	compatible  string
+	wroteHeader bool
+}
+
+func (w *productWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		header := w.Header()
+		header.Set(productHeader, productName)
+		if w.compatible != "" {
+			mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+			if err == nil && (mediaType == mediaTypeJSON || mediaType == mediaTypeNDJSON) {
+				header.Set("Content-Type", compatibleMediaType(mediaType, w.compatible))
+			}
+		}
+	}
+	if status >= http.StatusOK {
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *productWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *productWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *productWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
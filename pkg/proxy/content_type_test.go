@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestContentTypeHandling(t *testing.T) {
+	bulk := "{\"index\":{\"_index\":\"orders-tenant1\"}}\n{\"a\":1}\n"
+	msearch := "{\"index\":\"orders-tenant1\"}\n{\"query\":{\"match_all\":{}}}\n"
+	search := `{"query":{"match_all":{}}}`
+
+	tests := []struct {
+		name        string
+		path        string
+		body        string
+		contentType string
+		status      int
+		message     string
+	}{
+		{name: "json search", path: "/orders-tenant1/_search", body: search, contentType: "application/json", status: http.StatusOK},
+		{name: "json with charset", path: "/orders-tenant1/_search", body: search, contentType: "application/json; charset=UTF-8", status: http.StatusOK},
+		{name: "vendor json", path: "/orders-tenant1/_search", body: search, contentType: "application/vnd.elasticsearch+json; compatible-with=8", status: http.StatusOK},
+		{name: "missing content type", path: "/orders-tenant1/_search", body: search, status: http.StatusOK},
+		{name: "ndjson bulk", path: "/_bulk", body: bulk, contentType: "application/x-ndjson; charset=utf-8", status: http.StatusOK},
+		{name: "vendor ndjson msearch", path: "/_msearch", body: msearch, contentType: "application/vnd.elasticsearch+x-ndjson; compatible-with=8", status: http.StatusOK},
+		{name: "ndjson search", path: "/orders-tenant1/_search", body: search, contentType: "application/x-ndjson", status: http.StatusUnsupportedMediaType, message: "only supported for _bulk and _msearch"},
+		{name: "cbor", path: "/orders-tenant1/_doc/1", body: "\xa1aa\x01", contentType: "application/cbor", status: http.StatusUnsupportedMediaType, message: "application/cbor is not supported"},
+		{name: "smile bulk", path: "/_bulk", body: ":)\n", contentType: "application/smile", status: http.StatusUnsupportedMediaType, message: "application/smile is not supported"},
+		{name: "latin1 charset", path: "/orders-tenant1/_search", body: search, contentType: "application/json; charset=ISO-8859-1", status: http.StatusUnsupportedMediaType, message: "unsupported charset"},
+		{name: "malformed header", path: "/orders-tenant1/_search", body: search, contentType: "application/json; charset", status: http.StatusUnsupportedMediaType, message: "invalid Content-Type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, config.Default())
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.message != "" {
+				if !strings.Contains(rec.Body.String(), tt.message) {
+					t.Fatalf("expected %q in response, got %s", tt.message, rec.Body.String())
+				}
+				if _, _, _, _, count := capture.snapshot(); count != 0 {
+					t.Fatalf("expected no upstream call, got %d", count)
+				}
+			}
+		})
+	}
+}
+
+func TestProductAndCompatibilityHeaders(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(productHeader, productName)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		_, _ = w.Write([]byte(`{"hits":{"hits":[]}}`))
+	})
+	proxyHandler := newProxyWithUpstream(t, config.Default(), upstream)
+	compatible := "application/vnd.elasticsearch+json; compatible-with=8"
+
+	tests := []struct {
+		name        string
+		path        string
+		compatible  bool
+		status      int
+		contentType string
+	}{
+		{name: "rewritten", path: "/orders-tenant1/_search", status: http.StatusOK, contentType: "application/json"},
+		{name: "rewritten compatible", path: "/orders-tenant1/_search", compatible: true, status: http.StatusOK, contentType: compatible},
+		{name: "rejected", path: "/_unknown", status: http.StatusNotFound, contentType: "application/json"},
+		{name: "rejected compatible", path: "/_unknown", compatible: true, status: http.StatusNotFound, contentType: "application/vnd.elasticsearch+json;compatible-with=8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.compatible {
+				req.Header.Set("Accept", compatible)
+				req.Header.Set("Content-Type", compatible)
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if values := rec.Header().Values(productHeader); len(values) != 1 || values[0] != productName {
+				t.Fatalf("expected a single product header, got %q", values)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Fatalf("expected Content-Type %q, got %q", tt.contentType, got)
+			}
+		})
+	}
+}
+
+func TestRewrittenBodyKeepsCompatibility(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, config.Default())
+	req := httptest.NewRequest(http.MethodPost, "/_mget", strings.NewReader(`{"docs":[{"_index":"orders-tenant1","_id":"1"}]}`))
+	req.Header.Set("Accept", "application/vnd.elasticsearch+json; compatible-with=8")
+	req.Header.Set("Content-Type", "application/vnd.elasticsearch+json; compatible-with=8")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	if got := capture.header.Get("Content-Type"); got != "application/vnd.elasticsearch+x-ndjson;compatible-with=8" {
+		t.Fatalf("unexpected upstream Content-Type %q", got)
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+)
+
+// registerDiagnostics adds the pprof handlers under /admin/debug/pprof/, the
+// runtime stats, and the goroutine dump to the control endpoints.
+func registerDiagnostics(mux *http.ServeMux) {
+	// pprof.Index serves named profiles only under /debug/pprof/.
+	mux.Handle("/admin/debug/pprof/", http.StripPrefix("/admin", http.HandlerFunc(pprof.Index)))
+	mux.HandleFunc("/admin/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/admin/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/admin/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/admin/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/admin/runtime", handleRuntime)
+	mux.HandleFunc("/admin/goroutines", handleGoroutines)
+}
+
+// handleRuntime reports goroutine, memory, and garbage collector statistics.
+func handleRuntime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for runtime")
+		return
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	var lastGC string
+	if mem.LastGC > 0 {
+		lastGC = time.Unix(0, int64(mem.LastGC)).UTC().Format(time.RFC3339Nano)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"go_version": runtime.Version(),
+		"goroutines": runtime.NumGoroutine(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"num_cpu":    runtime.NumCPU(),
+		"memory": map[string]uint64{
+			"heap_alloc_bytes":   mem.HeapAlloc,
+			"heap_inuse_bytes":   mem.HeapInuse,
+			"heap_objects":       mem.HeapObjects,
+			"stack_inuse_bytes":  mem.StackInuse,
+			"sys_bytes":          mem.Sys,
+			"total_alloc_bytes":  mem.TotalAlloc,
+			"mallocs":            mem.Mallocs,
+			"frees":              mem.Frees,
+			"next_gc_heap_bytes": mem.NextGC,
+		},
+		"gc": map[string]interface{}{
+			"cycles":         mem.NumGC,
+			"forced_cycles":  mem.NumForcedGC,
+			"pause_total_ns": mem.PauseTotalNs,
+			"last_pause_ns":  mem.PauseNs[(mem.NumGC+255)%256],
+			"last_gc":        lastGC,
+			"cpu_fraction":   mem.GCCPUFraction,
+		},
+	})
+}
+
+// handleGoroutines writes the stacks of every goroutine as text, in the format
+// of an unrecovered panic.
+func handleGoroutines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for goroutines")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
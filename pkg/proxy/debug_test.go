@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestDiagnosticsEndpoints(t *testing.T) {
+	cfg := config.Default()
+	cfg.Admin.Diagnostics = true
+	admin := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{}`)).AdminHandler()
+	tests := []struct {
+		path     string
+		wantBody string
+	}{
+		{path: "/admin/runtime", wantBody: `"goroutines":`},
+		{path: "/admin/goroutines", wantBody: "goroutine "},
+		{path: "/admin/debug/pprof/", wantBody: "heap"},
+		{path: "/admin/debug/pprof/goroutine?debug=1", wantBody: "goroutine profile:"},
+		{path: "/admin/debug/pprof/cmdline", wantBody: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("expected 200 with %q, got %d: %s", tt.wantBody, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDiagnosticsDisabledAndAuthenticated(t *testing.T) {
+	admin := newProxyWithUpstream(t, config.Default(), jsonUpstream(http.StatusOK, `{}`)).AdminHandler()
+	for _, path := range []string{"/admin/runtime", "/admin/goroutines", "/admin/debug/pprof/"} {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected %s to be off by default, got %d", path, rec.Code)
+		}
+	}
+
+	cfg := config.Default()
+	cfg.Admin.Diagnostics = true
+	cfg.Admin.Token = "secret"
+	admin = newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{}`)).AdminHandler()
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/debug/pprof/heap", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected profiles to require the admin token, got %d", rec.Code)
+	}
+}
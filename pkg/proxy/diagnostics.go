@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// setDiagnostics records the index a search named when it asks for query
+// profiles or score explanations, so that their output can be mapped back to
+// the tenant's view of the index. It reads the rewritten body, so it must run
+// after rewriteQueryRequest.
+func (p *Proxy) setDiagnostics(r *http.Request, index string) {
+	state := requestStateFrom(r)
+	if state == nil {
+		return
+	}
+	if r.URL.Query().Get("explain") != "true" &&
+		!bytes.Contains(state.queryBody, []byte(`"profile"`)) &&
+		!bytes.Contains(state.queryBody, []byte(`"explain"`)) {
+		return
+	}
+	state.diagnostics = true
+	state.index = index
+}
+
+// diagnosticsScrubber maps profile and explanation output back to the tenant's
+// view: the indices searched upstream are reported under the name the client
+// used, and in index-per-tenant mode field names lose their base index prefix.
+type diagnosticsScrubber struct {
+	targets     []string
+	index       string
+	fieldPrefix string
+}
+
+func (p *Proxy) newDiagnosticsScrubber(state *requestState) diagnosticsScrubber {
+	scrubber := diagnosticsScrubber{index: state.index}
+	if p.wrapSource() {
+		scrubber.fieldPrefix = state.baseIndex + "."
+	}
+	for _, render := range []func(string, string) (string, error){p.renderTargetIndex, p.renderQueryIndex} {
+		target, err := render(state.baseIndex, state.tenantID)
+		if err == nil && target != "" && target != state.index && !containsString(scrubber.targets, target) {
+			scrubber.targets = append(scrubber.targets, target)
+		}
+	}
+	return scrubber
+}
+
+// scrubSearch scrubs the profile of a search response and the explanations and
+// shard references of its hits.
+func (s diagnosticsScrubber) scrubSearch(payload map[string]interface{}) bool {
+	changed := false
+	if profile, ok := payload["profile"]; ok {
+		payload["profile"], ok = s.scrub(profile)
+		changed = changed || ok
+	}
+	hits, _ := payload["hits"].(map[string]interface{})
+	list, _ := hits["hits"].([]interface{})
+	for _, item := range list {
+		hit, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, key := range []string{"_explanation", "_shard"} {
+			if value, ok := hit[key]; ok {
+				hit[key], ok = s.scrub(value)
+				changed = changed || ok
+			}
+		}
+	}
+	return changed
+}
+
+// scrubExplain scrubs the response of the explain API.
+func (s diagnosticsScrubber) scrubExplain(payload map[string]interface{}) bool {
+	changed := false
+	for _, key := range []string{"_index", "explanation"} {
+		if value, ok := payload[key]; ok {
+			payload[key], ok = s.scrub(value)
+			changed = changed || ok
+		}
+	}
+	return changed
+}
+
+func (s diagnosticsScrubber) scrub(value interface{}) (interface{}, bool) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		changed := false
+		for key, item := range typed {
+			scrubbed, ok := s.scrub(item)
+			if ok {
+				typed[key] = scrubbed
+				changed = true
+			}
+		}
+		return typed, changed
+	case []interface{}:
+		changed := false
+		for i, item := range typed {
+			scrubbed, ok := s.scrub(item)
+			if ok {
+				typed[i] = scrubbed
+				changed = true
+			}
+		}
+		return typed, changed
+	case string:
+		scrubbed := s.text(typed)
+		return scrubbed, scrubbed != typed
+	default:
+		return value, false
+	}
+}
+
+// text rewrites a single value: an index name on its own, index references in
+// brackets as in shard IDs like [node][index][0], and prefixed field names in
+// query descriptions like +orders.status:open.
+func (s diagnosticsScrubber) text(value string) string {
+	for _, target := range s.targets {
+		if value == target {
+			return s.index
+		}
+		value = replaceBracketedIndex(value, target, s.index)
+	}
+	return stripFieldPrefix(value, s.fieldPrefix)
+}
+
+// stripFieldPrefix removes prefix where it starts a field name in text, that
+// is, where it does not follow a character that can be part of a field name.
+func stripFieldPrefix(text, prefix string) string {
+	if prefix == "" || !strings.Contains(text, prefix) {
+		return text
+	}
+	var builder strings.Builder
+	for {
+		i := strings.Index(text, prefix)
+		if i < 0 {
+			builder.WriteString(text)
+			return builder.String()
+		}
+		if i > 0 && isFieldNameByte(text[i-1]) {
+			builder.WriteString(text[:i+len(prefix)])
+		} else {
+			builder.WriteString(text[:i])
+		}
+		text = text[i+len(prefix):]
+	}
+}
+
+func isFieldNameByte(c byte) bool {
+	return c == '_' || c == '.' || c == '@' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
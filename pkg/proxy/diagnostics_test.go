@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestSearchProfileAndExplanationScrubbed(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.tenant}}_{{.index}}"
+	upstreamBody := `{"took":1,"hits":{"total":{"value":1,"relation":"eq"},"hits":[` +
+		`{"_shard":"[n1][tenant1_orders][0]","_node":"n1","_index":"tenant1_orders","_id":"1","_source":{"orders":{"status":"open"}},` +
+		`"_explanation":{"value":1.2,"description":"weight(orders.status:open in 0) [PerFieldSimilarity], result of:","details":[]}}]},` +
+		`"profile":{"shards":[{"id":"[n1][tenant1_orders][0]","index":"tenant1_orders","searches":[{"query":[` +
+		`{"type":"BooleanQuery","description":"+orders.status:open #orders.total:[1 TO 5] -myorders.flag:true","time_in_nanos":10,"children":[]}]}]}]}}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, upstreamBody))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search?explain=true", strings.NewReader(`{"profile":true,"query":{"term":{"status":"open"}}}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, leaked := range []string{"[tenant1_orders]", `"index":"tenant1_orders"`, "orders.status", "orders.total"} {
+		if strings.Contains(body, leaked) {
+			t.Fatalf("expected %q scrubbed, got %s", leaked, body)
+		}
+	}
+	for _, want := range []string{
+		`"id":"[n1][orders-tenant1][0]"`,
+		`"index":"orders-tenant1"`,
+		`"_shard":"[n1][orders-tenant1][0]"`,
+		`+status:open #total:[1 TO 5] -myorders.flag:true`,
+		`weight(status:open in 0)`,
+		`"_source":{"status":"open"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %s in %s", want, body)
+		}
+	}
+}
+
+func TestSearchWithoutDiagnosticsUntouched(t *testing.T) {
+	upstreamBody := `{"hits":{"hits":[{"_index":"orders","_id":"1","_shard":"[n1][orders][0]"}]}}`
+	proxyHandler := newProxyWithUpstream(t, config.Default(), jsonUpstream(http.StatusOK, upstreamBody))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search", strings.NewReader(`{"query":{"match_all":{}}}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Body.String() != upstreamBody {
+		t.Fatalf("expected the response forwarded unchanged, got %s", rec.Body.String())
+	}
+}
+
+func TestExplainResponseScrubbed(t *testing.T) {
+	upstreamBody := `{"_index":"orders","_id":"1","matched":true,"explanation":{"value":1,"description":"sum of:",` +
+		`"details":[{"value":1,"description":"weight(status:open in 0) [orders]","details":[]}]}}`
+	proxyHandler := newProxyWithUpstream(t, config.Default(), jsonUpstream(http.StatusOK, upstreamBody))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_explain/1", strings.NewReader(`{"query":{"term":{"status":"open"}}}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	var payload struct {
+		Index       string `json:"_index"`
+		Explanation struct {
+			Details []struct {
+				Description string `json:"description"`
+			} `json:"details"`
+		} `json:"explanation"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response %q: %v", rec.Body.String(), err)
+	}
+	if payload.Index != "orders-tenant1" || payload.Explanation.Details[0].Description != "weight(status:open in 0) [orders-tenant1]" {
+		t.Fatalf("expected the explanation scrubbed, got %s", rec.Body.String())
+	}
+}
+
+func TestStripFieldPrefix(t *testing.T) {
+	cases := map[string]string{
+		"orders.total:[1 TO 5]":          "total:[1 TO 5]",
+		"+orders.a:x -orders.b:y":        "+a:x -b:y",
+		"weight(orders.a:x in 0)":        "weight(a:x in 0)",
+		"myorders.a:x meta.orders.b:y":   "myorders.a:x meta.orders.b:y",
+		"ConstantScore(orders.tags:red)": "ConstantScore(tags:red)",
+	}
+	for text, want := range cases {
+		if got := stripFieldPrefix(text, "orders."); got != want {
+			t.Fatalf("stripFieldPrefix(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
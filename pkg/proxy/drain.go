@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// drainTracker counts in-flight requests so shutdown can wait for them. Once
+// draining starts no new requests are admitted.
+type drainTracker struct {
+	mu       sync.Mutex
+	draining bool
+	active   int
+	idle     chan struct{}
+}
+
+func newDrainTracker() *drainTracker {
+	return &drainTracker{idle: make(chan struct{})}
+}
+
+// begin admits a request, returning false once draining has started.
+func (d *drainTracker) begin() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.active++
+	return true
+}
+
+func (d *drainTracker) end() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active--
+	if d.draining && d.active == 0 {
+		close(d.idle)
+	}
+}
+
+func (d *drainTracker) inFlight() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.active
+}
+
+func (d *drainTracker) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// drain stops admitting requests and waits until the in-flight ones have
+// completed or ctx is done.
+func (d *drainTracker) drain(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.draining {
+		d.draining = true
+		if d.active == 0 {
+			close(d.idle)
+		}
+	}
+	d.mu.Unlock()
+	select {
+	case <-d.idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("drain: %d requests still in flight: %w", d.inFlight(), ctx.Err())
+	}
+}
+
+// Drain rejects new requests with 503 and waits for in-flight requests to
+// finish. It returns an error if ctx is done first.
+func (p *Proxy) Drain(ctx context.Context) error {
+	return p.drain.drain(ctx)
+}
+
+// Close stops the proxy's background work and flushes the usage counters to
+// the usage sink a last time. Call it after Drain so the drained requests are
+// counted.
+func (p *Proxy) Close() error {
+	if p.usageFlush == nil {
+		return nil
+	}
+	if err := p.usageFlush.close(); err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
+	return nil
+}
+
+func (p *Proxy) rejectDraining(w http.ResponseWriter) {
+	w.Header().Set("Connection", "close")
+	w.Header().Set("Retry-After", "1")
+	p.writeError(w, http.StatusServiceUnavailable, "service_unavailable", codeShuttingDown, "proxy is shutting down")
+}
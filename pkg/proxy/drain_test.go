@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestDrainWaitsForInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		jsonUpstream(http.StatusOK, `{}`).ServeHTTP(w, r)
+	})
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	inFlight := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/products-tenant1/_bulk", strings.NewReader("{\"index\":{}}\n{\"name\":\"a\"}\n"))
+		proxyHandler.ServeHTTP(inFlight, req)
+		close(served)
+	}()
+	<-started
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- proxyHandler.Drain(context.Background())
+	}()
+	for !proxyHandler.drain.isDraining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "service_unavailable") {
+		t.Fatalf("expected 503 while draining, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"in_flight":1`) {
+		t.Fatalf("expected draining healthz, got %d: %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned before the in-flight request finished: %v", err)
+	default:
+	}
+
+	close(release)
+	<-served
+	if err := <-drained; err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if inFlight.Code != http.StatusOK {
+		t.Fatalf("expected in-flight bulk to complete, got %d", inFlight.Code)
+	}
+}
+
+func TestDrainTimesOut(t *testing.T) {
+	tracker := newDrainTracker()
+	if !tracker.begin() {
+		t.Fatal("expected request to be admitted")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := tracker.drain(ctx)
+	if err == nil || !strings.Contains(err.Error(), "1 requests still in flight") {
+		t.Fatalf("expected drain timeout, got %v", err)
+	}
+	if tracker.begin() {
+		t.Fatal("expected new requests to be rejected while draining")
+	}
+	tracker.end()
+	if err := tracker.drain(context.Background()); err != nil {
+		t.Fatalf("expected drain to finish once idle, got %v", err)
+	}
+}
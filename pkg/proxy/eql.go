@@ -0,0 +1,367 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// eqlSearchKeepAlive is how long an async EQL search id is remembered. It
+// matches the default keep_alive of async searches upstream.
+const eqlSearchKeepAlive = 5 * 24 * time.Hour
+
+// eqlSearch records the tenant an async EQL search was submitted for so that
+// follow-up status, result, and delete requests stay with that tenant.
+type eqlSearch struct {
+	TenantID  string `json:"tenant"`
+	BaseIndex string `json:"base_index"`
+}
+
+// eqlSearchTracker maps async EQL search ids returned by the upstream to the
+// tenant that started them. The ids are kept in the state store so that any
+// replica can serve the follow-up requests.
+type eqlSearchTracker struct {
+	store stateStore
+}
+
+func newEQLSearchTracker(store stateStore) *eqlSearchTracker {
+	return &eqlSearchTracker{store: store}
+}
+
+func (t *eqlSearchTracker) add(id string, search eqlSearch) error {
+	value, err := json.Marshal(search)
+	if err != nil {
+		return err
+	}
+	return t.store.Set("eql:"+id, string(value), eqlSearchKeepAlive)
+}
+
+func (t *eqlSearchTracker) get(id string) (eqlSearch, bool, error) {
+	value, ok, err := t.store.Get("eql:" + id)
+	if err != nil || !ok {
+		return eqlSearch{}, false, err
+	}
+	var search eqlSearch
+	if err := json.Unmarshal([]byte(value), &search); err != nil {
+		return eqlSearch{}, false, fmt.Errorf("decode eql search %s: %w", id, err)
+	}
+	return search, true, nil
+}
+
+func (t *eqlSearchTracker) remove(id string) error {
+	return t.store.Delete("eql:" + id)
+}
+
+// eqlKeywords are the EQL words that are never field names.
+var eqlKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "where": true, "sequence": true, "sample": true,
+	"by": true, "with": true, "maxspan": true, "until": true, "join": true, "any": true,
+	"true": true, "false": true, "null": true, "in": true, "like": true, "regex": true, "runs": true,
+}
+
+// handleEQLSearch serves /{index}/_eql/search. The index is routed like a
+// search and, in index-per-tenant mode, field names in the EQL query and the
+// body parameters naming fields are prefixed with the base index.
+func (p *Proxy) handleEQLSearch(w http.ResponseWriter, r *http.Request, index string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		p.rejectMethod(w, "unsupported method for eql search", http.MethodGet, http.MethodPost)
+		return
+	}
+	cluster, baseIndex, tenantID, err := p.parseClusterIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	target, err := p.renderQueryIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	target = withCluster(cluster, target)
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	rewritten, err := p.rewriteEQLBody(body, baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	if state := requestStateFrom(r); state != nil {
+		state.queryBody = rewritten
+	}
+	p.rewriteIndexPath(r, index, target)
+	p.setResponseKind(r, responseKindEQL, baseIndex, tenantID)
+	p.setUsage(r, tenantID, tenantUsage{Searches: 1})
+	p.setSlowQuery(r, slowQuerySearch, tenantID, target)
+	p.proxy.ServeHTTP(w, r)
+}
+
+// handleEQLAsync serves GET and DELETE /_eql/search/{id} and GET
+// /_eql/search/status/{id}. Only ids of searches started through the proxy are
+// accepted, and only from the tenant that started them when the request is
+// authenticated.
+func (p *Proxy) handleEQLAsync(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		p.rejectMethod(w, "unsupported method for eql search", http.MethodDelete, http.MethodGet)
+		return
+	}
+	search, ok, err := p.eql.get(id)
+	if err != nil {
+		p.writeError(w, http.StatusServiceUnavailable, "service_unavailable", codeStateUnavailable, err.Error())
+		return
+	}
+	if !ok || checkAuthTenant(r, search.TenantID) != nil {
+		p.reject(w, codeInvalidRequest, "unknown EQL search id")
+		return
+	}
+	if err := p.checkTenantAccess(r, search.TenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.setResponseKind(r, responseKindEQL, search.BaseIndex, search.TenantID)
+	if state := requestStateFrom(r); state != nil {
+		state.asyncID = id
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// rewriteEQLBody scopes an EQL search body to the tenant. Shared mode relies on
+// the tenant alias and adds a tenant filter when filters are enforced;
+// index-per-tenant mode prefixes the query's fields.
+func (p *Proxy) rewriteEQLBody(body []byte, baseIndex, tenantID string) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	query, _ := payload["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return nil, errors.New("EQL query is required")
+	}
+	if filter, ok := payload["filter"]; ok {
+		if err := p.validateQueryValue(filter); err != nil {
+			return nil, err
+		}
+	}
+	if isSharedMode(p.cfg.Mode) {
+		if p.enforceTenantFilter() {
+			payload["filter"] = addTenantFilter(payload["filter"], p.tenantField(baseIndex), tenantID)
+		}
+		return json.Marshal(payload)
+	}
+	if !p.wrapSource() {
+		return body, nil
+	}
+	rewritten, err := p.rewriteEQLQuery(query, baseIndex)
+	if err != nil {
+		return nil, err
+	}
+	payload["query"] = rewritten
+	if filter, ok := payload["filter"]; ok {
+		payload["filter"] = p.rewriteQueryValue(filter, baseIndex)
+	}
+	// The upstream defaults name unwrapped fields, so they are always set.
+	defaults := map[string]string{"event_category_field": "event.category", "timestamp_field": "@timestamp"}
+	for _, key := range []string{"event_category_field", "timestamp_field", "tiebreaker_field"} {
+		field, ok := payload[key].(string)
+		if !ok {
+			field = defaults[key]
+		}
+		if field != "" {
+			payload[key] = p.prefixField(baseIndex, field)
+		}
+	}
+	if fields, ok := payload["fields"].([]interface{}); ok {
+		for i, item := range fields {
+			switch typed := item.(type) {
+			case string:
+				fields[i] = p.prefixField(baseIndex, typed)
+			case map[string]interface{}:
+				if field, ok := typed["field"].(string); ok {
+					typed["field"] = p.prefixField(baseIndex, field)
+				}
+			}
+		}
+	}
+	return json.Marshal(payload)
+}
+
+// rewriteEQLQuery prefixes the field names of an EQL query with the base index.
+// Event categories, function names, pipe commands, keywords, and literals are
+// left alone. Comments are rejected since they would hide fields from the
+// rewrite.
+func (p *Proxy) rewriteEQLQuery(query, baseIndex string) (string, error) {
+	var output strings.Builder
+	afterPipe := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case strings.HasPrefix(query[i:], "//"), strings.HasPrefix(query[i:], "/*"):
+			return "", errors.New("EQL comments are not supported")
+		case c == '"' || c == '\'' || strings.HasPrefix(query[i:], `?"`):
+			end, err := eqlStringEnd(query, i)
+			if err != nil {
+				return "", err
+			}
+			output.WriteString(query[i:end])
+			i = end
+			afterPipe = false
+		case c == '`':
+			end := i + 1
+			for ; end < len(query); end++ {
+				if query[end] == '`' {
+					if end+1 < len(query) && query[end+1] == '`' {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			if end >= len(query) {
+				return "", errors.New("unterminated EQL field name")
+			}
+			field := strings.ReplaceAll(query[i+1:end], "``", "`")
+			output.WriteString("`" + strings.ReplaceAll(p.prefixField(baseIndex, field), "`", "``") + "`")
+			i = end + 1
+			afterPipe = false
+		case isEQLWordByte(c):
+			end := i
+			for end < len(query) && isEQLWordByte(query[end]) {
+				end++
+			}
+			word := query[i:end]
+			if isEQLField(word, query[end:], afterPipe) {
+				word = p.prefixField(baseIndex, word)
+			}
+			output.WriteString(word)
+			i = end
+			afterPipe = false
+		default:
+			if c == '|' {
+				afterPipe = true
+			} else if !isSQLSpace(c) {
+				afterPipe = false
+			}
+			output.WriteByte(c)
+			i++
+		}
+	}
+	return output.String(), nil
+}
+
+// isEQLField reports whether word, followed by rest, names a field.
+func isEQLField(word, rest string, afterPipe bool) bool {
+	if afterPipe || eqlKeywords[strings.ToLower(word)] {
+		return false
+	}
+	if first := word[0]; first >= '0' && first <= '9' {
+		return false
+	}
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	if strings.HasPrefix(rest, "(") || strings.HasPrefix(rest, "~(") {
+		return false
+	}
+	next := 0
+	for next < len(rest) && isEQLWordByte(rest[next]) {
+		next++
+	}
+	return !strings.EqualFold(rest[:next], "where")
+}
+
+// eqlStringEnd returns the offset just past the string literal starting at
+// start, which may be a triple-quoted or ?-prefixed raw string.
+func eqlStringEnd(query string, start int) (int, error) {
+	i := start
+	raw := false
+	if query[i] == '?' {
+		raw = true
+		i++
+	}
+	if strings.HasPrefix(query[i:], `"""`) {
+		end := strings.Index(query[i+3:], `"""`)
+		if end < 0 {
+			return 0, errors.New("unterminated EQL string")
+		}
+		return i + 3 + end + 3, nil
+	}
+	quote := query[i]
+	for i++; i < len(query); i++ {
+		if query[i] == '\\' && !raw {
+			i++
+			continue
+		}
+		if query[i] == quote {
+			return i + 1, nil
+		}
+	}
+	return 0, errors.New("unterminated EQL string")
+}
+
+func isEQLWordByte(c byte) bool {
+	return c == '_' || c == '.' || c == '@' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// rewriteEQLResponse remembers the id of an async EQL search for its tenant,
+// or forgets it once the search was deleted or has expired, and unwraps the
+// returned events in index-per-tenant mode.
+func (p *Proxy) rewriteEQLResponse(resp *http.Response, state *requestState) error {
+	if state.asyncID != "" {
+		if resp.StatusCode == http.StatusNotFound || (resp.Request.Method == http.MethodDelete && resp.StatusCode == http.StatusOK) {
+			if err := p.eql.remove(state.asyncID); err != nil {
+				log.Printf("state: %v", err)
+			}
+		}
+	}
+	return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+		if id, ok := payload["id"].(string); ok && id != "" && state.asyncID == "" {
+			if err := p.eql.add(id, eqlSearch{TenantID: state.tenantID, BaseIndex: state.baseIndex}); err != nil {
+				log.Printf("state: %v", err)
+			}
+		}
+		if !p.wrapSource() {
+			return payload, false
+		}
+		return payload, unwrapEQLHits(payload["hits"], state.baseIndex)
+	})
+}
+
+// unwrapEQLHits restores the flat document shape of the events in an EQL
+// response, both the top-level events and those of sequences.
+func unwrapEQLHits(value interface{}, baseIndex string) bool {
+	hits, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	changed := unwrapEQLEvents(hits["events"], baseIndex)
+	sequences, _ := hits["sequences"].([]interface{})
+	for _, item := range sequences {
+		if sequence, ok := item.(map[string]interface{}); ok && unwrapEQLEvents(sequence["events"], baseIndex) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func unwrapEQLEvents(value interface{}, baseIndex string) bool {
+	events, _ := value.([]interface{})
+	changed := false
+	for _, item := range events {
+		if event, ok := item.(map[string]interface{}); ok && unwrapHit(event, baseIndex) {
+			changed = true
+		}
+	}
+	return changed
+}
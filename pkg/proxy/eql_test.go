@@ -0,0 +1,232 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestEQLSearchIndexPerTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"query":"process where process.name == \"cmd.exe\" and length(user.name) > 0","filter":{"term":{"host.os":"linux"}},"fields":["user.name",{"field":"@timestamp"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/logs-tenant1/_eql/search", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, _, _ := capture.snapshot()
+	if path != "/logs-tenant1/_eql/search" {
+		t.Fatalf("expected per-tenant index path, got %s", path)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(captured, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	wantQuery := `process where logs.process.name == "cmd.exe" and length(logs.user.name) > 0`
+	if payload["query"] != wantQuery {
+		t.Fatalf("expected query %q, got %q", wantQuery, payload["query"])
+	}
+	if payload["event_category_field"] != "logs.event.category" || payload["timestamp_field"] != "logs.@timestamp" {
+		t.Fatalf("expected prefixed default fields, got %v", payload)
+	}
+	filter, _ := json.Marshal(payload["filter"])
+	if string(filter) != `{"term":{"logs.host.os":"linux"}}` {
+		t.Fatalf("expected prefixed filter, got %s", filter)
+	}
+	fields, _ := json.Marshal(payload["fields"])
+	if string(fields) != `["logs.user.name",{"field":"logs.@timestamp"}]` {
+		t.Fatalf("expected prefixed fields, got %s", fields)
+	}
+}
+
+func TestEQLSearchSharedMode(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.EnforceFilter = true
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"query":"process where process.name == \"cmd.exe\""}`
+	req := httptest.NewRequest(http.MethodPost, "/logs-tenant1/_eql/search", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, _, _ := capture.snapshot()
+	if path != "/alias-logs-tenant1/_eql/search" {
+		t.Fatalf("expected alias path, got %s", path)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(captured, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	if payload["query"] != `process where process.name == "cmd.exe"` {
+		t.Fatalf("expected query unchanged, got %q", payload["query"])
+	}
+	filter, _ := json.Marshal(payload["filter"])
+	if !strings.Contains(string(filter), `{"term":{"tenant_id":"tenant1"}}`) {
+		t.Fatalf("expected tenant filter, got %s", filter)
+	}
+}
+
+func TestEQLAsyncSearchTrackedPerTenant(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodDelete:
+			_, _ = io.WriteString(w, `{"acknowledged":true}`)
+		case strings.HasPrefix(r.URL.Path, "/_eql/search/status/"):
+			_, _ = io.WriteString(w, `{"id":"abc","is_running":false}`)
+		default:
+			_, _ = io.WriteString(w, `{"id":"abc","is_running":false,"hits":{"events":[{"_index":"logs-tenant1","_id":"1","_source":{"logs":{"user":"a"}}}],"sequences":[{"events":[{"_index":"logs-tenant1","_id":"2","_source":{"logs":{"user":"b"}}}]}]}}`)
+		}
+	})
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_eql/search/abc", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unknown EQL search id") {
+		t.Fatalf("expected unknown id rejection, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	body := `{"query":"any where true","wait_for_completion_timeout":"1ms","keep_on_completion":true}`
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/logs-tenant1/_eql/search", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if search, ok, _ := proxyHandler.eql.get("abc"); !ok || search.TenantID != "tenant1" || search.BaseIndex != "logs" {
+		t.Fatalf("expected async search tracked for tenant1, got %+v %v", search, ok)
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_eql/search/abc", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"_source":{"user":"a"}`) || !strings.Contains(rec.Body.String(), `"_source":{"user":"b"}`) {
+		t.Fatalf("expected unwrapped events, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_eql/search/status/abc", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/_eql/search/abc", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected delete 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok, _ := proxyHandler.eql.get("abc"); ok {
+		t.Fatal("expected deleted async search to be forgotten")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"POST /logs-tenant1/_eql/search", "GET /_eql/search/abc", "GET /_eql/search/status/abc", "DELETE /_eql/search/abc"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected upstream calls %v, got %v", want, paths)
+	}
+}
+
+func TestEQLAsyncSearchHiddenFromOtherTenants(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.BasicAuth = config.BasicAuth{
+		Enabled: true,
+		Users: []config.BasicAuthUser{
+			{Username: "alice", Password: "{PLAIN}secret", Tenant: "tenant1"},
+			{Username: "bob", Password: "{PLAIN}secret", Tenant: "tenant2"},
+		},
+	}
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	if err := proxyHandler.eql.add("abc", eqlSearch{TenantID: "tenant1", BaseIndex: "logs"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	for _, call := range []string{"GET /_eql/search/abc", "GET /_eql/search/status/abc", "DELETE /_eql/search/abc"} {
+		method, path, _ := strings.Cut(call, " ")
+		req := httptest.NewRequest(method, path, nil)
+		req.SetBasicAuth("bob", "secret")
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unknown EQL search id") {
+			t.Fatalf("%s: expected unknown id rejection, got %d: %s", call, rec.Code, rec.Body.String())
+		}
+	}
+	if _, _, _, _, calls := capture.snapshot(); calls != 0 {
+		t.Fatalf("expected no upstream calls, got %d", calls)
+	}
+	if _, ok, _ := proxyHandler.eql.get("abc"); !ok {
+		t.Fatal("expected search kept after another tenant's delete")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_eql/search/status/abc", nil)
+	req.SetBasicAuth("alice", "secret")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected owner to read status, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRewriteEQLQuery(t *testing.T) {
+	p := setupTestProxy("index-per-tenant")
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{name: "category and field", query: `process where process.name == "cmd.exe"`, want: `process where logs.process.name == "cmd.exe"`},
+		{name: "already prefixed", query: `any where logs.user == "a"`, want: `any where logs.user == "a"`},
+		{name: "function", query: `file where startsWith~(file.path, "C:\\")`, want: `file where startsWith~(logs.file.path, "C:\\")`},
+		{name: "sequence", query: "sequence by host.id with maxspan=1h [process where true] [network where dest.port in (80, 443)] until [process where ?user.id == null]", want: "sequence by logs.host.id with maxspan=1h [process where true] [network where logs.dest.port in (80, 443)] until [process where ?logs.user.id == null]"},
+		{name: "pipes", query: "process where true | unique process.name | head 5", want: "process where true | unique logs.process.name | head 5"},
+		{name: "strings", query: `any where msg : """a "b" c""" or path like ?"C:\x"`, want: `any where logs.msg : """a "b" c""" or logs.path like ?"C:\x"`},
+		{name: "quoted field", query: "any where `my field` == 1", want: "any where `logs.my field` == 1"},
+		{name: "comment", query: "any where true // x", wantErr: "comments are not supported"},
+		{name: "unterminated", query: `any where a == "x`, wantErr: "unterminated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.rewriteEQLQuery(tt.query, "logs")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// handleESQLQuery serves POST /_query. Bodies whose query is an ES|QL string
+// have their FROM sources rewritten to the tenant's index; other bodies are
+// handled as JSON query requests.
+func (p *Proxy) handleESQLQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		p.handleQueryEndpoint(w, r, "")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	var payload map[string]json.RawMessage
+	var query string
+	if json.Unmarshal(body, &payload) == nil {
+		_ = json.Unmarshal(payload["query"], &query)
+	}
+	if strings.TrimSpace(query) == "" {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		p.handleQueryEndpoint(w, r, "")
+		return
+	}
+	rewritten, tenantID, targets, err := p.rewriteESQL(r, query)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	payload["query"], err = json.Marshal(rewritten)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	body, err = json.Marshal(payload)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	if state := requestStateFrom(r); state != nil {
+		state.queryBody = body
+	}
+	p.logRequestVerbose(r, "esql rewrite: %s -> %s", query, rewritten)
+	if tenantID != "" {
+		p.setUsage(r, tenantID, tenantUsage{Searches: 1})
+		p.setSlowQuery(r, slowQuerySearch, tenantID, strings.Join(targets, ","))
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// rewriteESQL rewrites the FROM sources of an ES|QL query to the tenant's
+// alias or index, and in shared mode filters rows to the tenant right after
+// FROM. Every source must belong to the same tenant. Queries that could reach
+// other indices through ENRICH or LOOKUP JOIN are rejected, as are comments,
+// which would hide commands from this rewrite.
+func (p *Proxy) rewriteESQL(r *http.Request, query string) (string, string, []string, error) {
+	commands, err := splitESQLCommands(query)
+	if err != nil {
+		return "", "", nil, err
+	}
+	for _, command := range commands[1:] {
+		switch strings.ToUpper(esqlKeyword(command)) {
+		case "ENRICH", "LOOKUP":
+			return "", "", nil, fmt.Errorf("ES|QL %s is not supported", strings.ToUpper(esqlKeyword(command)))
+		}
+	}
+	switch strings.ToUpper(esqlKeyword(commands[0])) {
+	case "FROM":
+	case "ROW", "SHOW":
+		return strings.Join(commands, " | "), "", nil, nil
+	default:
+		return "", "", nil, errors.New("ES|QL query must start with FROM, ROW, or SHOW")
+	}
+	sources, remainder, err := parseESQLSources(strings.TrimSpace(commands[0][len("FROM"):]))
+	if err != nil {
+		return "", "", nil, err
+	}
+	var tenantID string
+	targets := make([]string, 0, len(sources))
+	bases := make([]string, 0, len(sources))
+	for _, source := range sources {
+		baseIndex, sourceTenant, err := p.parseIndex(r, source)
+		if err != nil {
+			return "", "", nil, err
+		}
+		bases = append(bases, baseIndex)
+		if tenantID == "" {
+			tenantID = sourceTenant
+		} else if tenantID != sourceTenant {
+			return "", "", nil, withCode(codeMultipleTenants, fmt.Errorf("ES|QL query contains multiple tenants: %s and %s", tenantID, sourceTenant))
+		}
+		target, err := p.renderQueryIndex(baseIndex, tenantID)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if !containsString(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	from := "FROM " + strings.Join(targets, ", ")
+	if remainder != "" {
+		from += " " + remainder
+	}
+	rewritten := []string{from}
+	if isSharedMode(p.cfg.Mode) {
+		tenantField, err := p.commonTenantField(bases)
+		if err != nil {
+			return "", "", nil, err
+		}
+		rewritten = append(rewritten, fmt.Sprintf("WHERE %s == %s", esqlIdentifier(tenantField), esqlString(tenantID)))
+	}
+	rewritten = append(rewritten, commands[1:]...)
+	return strings.Join(rewritten, " | "), tenantID, targets, nil
+}
+
+// splitESQLCommands splits a query into its trimmed, pipe-separated commands,
+// ignoring pipes inside string literals and quoted identifiers.
+func splitESQLCommands(query string) ([]string, error) {
+	var commands []string
+	start := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case strings.HasPrefix(query[i:], `"""`):
+			end := strings.Index(query[i+3:], `"""`)
+			if end < 0 {
+				return nil, errors.New("unterminated ES|QL string")
+			}
+			i += end + 5
+		case c == '"':
+			for i++; i < len(query) && query[i] != '"'; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(query) {
+				return nil, errors.New("unterminated ES|QL string")
+			}
+		case c == '`':
+			end := strings.IndexByte(query[i+1:], '`')
+			if end < 0 {
+				return nil, errors.New("unterminated ES|QL identifier")
+			}
+			i += end + 1
+		case strings.HasPrefix(query[i:], "//"), strings.HasPrefix(query[i:], "/*"):
+			return nil, errors.New("ES|QL comments are not supported")
+		case c == '|':
+			commands = append(commands, strings.TrimSpace(query[start:i]))
+			start = i + 1
+		}
+	}
+	commands = append(commands, strings.TrimSpace(query[start:]))
+	for _, command := range commands {
+		if command == "" {
+			return nil, errors.New("empty ES|QL command")
+		}
+	}
+	return commands, nil
+}
+
+func esqlKeyword(command string) string {
+	if idx := strings.IndexAny(command, " \t\r\n"); idx >= 0 {
+		return command[:idx]
+	}
+	return command
+}
+
+// parseESQLSources reads the comma-separated index list of a FROM command and
+// returns it with the rest of the command, such as a METADATA clause.
+func parseESQLSources(text string) ([]string, string, error) {
+	var sources []string
+	for {
+		text = strings.TrimSpace(text)
+		var source string
+		if strings.HasPrefix(text, `"`) {
+			end := strings.IndexByte(text[1:], '"')
+			if end < 0 {
+				return nil, "", errors.New("unterminated ES|QL index name")
+			}
+			source, text = text[1:end+1], text[end+2:]
+		} else {
+			end := strings.IndexAny(text, ", \t\r\n")
+			if end < 0 {
+				end = len(text)
+			}
+			source, text = text[:end], text[end:]
+		}
+		if source == "" {
+			return nil, "", errors.New("ES|QL FROM requires an index")
+		}
+		if strings.ContainsAny(source, "*:,") {
+			return nil, "", fmt.Errorf("ES|QL index %s is not supported", source)
+		}
+		sources = append(sources, source)
+		text = strings.TrimSpace(text)
+		if !strings.HasPrefix(text, ",") {
+			break
+		}
+		text = text[1:]
+	}
+	if text != "" && !strings.EqualFold(esqlKeyword(text), "METADATA") {
+		return nil, "", fmt.Errorf("unexpected ES|QL FROM clause: %s", text)
+	}
+	return sources, text, nil
+}
+
+func esqlIdentifier(name string) string {
+	for _, c := range name {
+		if !(c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+		}
+	}
+	return name
+}
+
+func esqlString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestESQLQuerySharedMode(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"query":"FROM logs-tenant1 | WHERE status == 500 | LIMIT 10","columnar":true}`
+	req := httptest.NewRequest(http.MethodPost, "/_query", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, _, _ := capture.snapshot()
+	if path != "/_query" {
+		t.Fatalf("expected /_query, got %s", path)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(captured, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	want := `FROM alias-logs-tenant1 | WHERE tenant_id == "tenant1" | WHERE status == 500 | LIMIT 10`
+	if payload["query"] != want {
+		t.Fatalf("expected query %q, got %q", want, payload["query"])
+	}
+	if payload["columnar"] != true {
+		t.Fatalf("expected other body fields to be kept, got %v", payload)
+	}
+}
+
+func TestESQLQueryIndexPerTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.tenant}}-{{.index}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"query":"from logs-tenant1, \"metrics-tenant1\" METADATA _id | STATS c = COUNT(*)"}`
+	req := httptest.NewRequest(http.MethodPost, "/_query", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	_, _, captured, _, _ := capture.snapshot()
+	var payload map[string]interface{}
+	if err := json.Unmarshal(captured, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	want := `FROM tenant1-logs, tenant1-metrics METADATA _id | STATS c = COUNT(*)`
+	if payload["query"] != want {
+		t.Fatalf("expected query %q, got %q", want, payload["query"])
+	}
+}
+
+func TestESQLQueryRejected(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"query":"FROM logs-tenant1, logs-tenant2"}`
+	req := httptest.NewRequest(http.MethodPost, "/_query", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "multiple tenants") {
+		t.Fatalf("expected multiple tenant rejection, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+}
+
+func TestRewriteESQL(t *testing.T) {
+	p := setupTestProxy("shared")
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{name: "pipe in string", query: `FROM logs-tenant1 | WHERE msg == "a|b"`, want: `FROM alias-logs-tenant1 | WHERE tenant_id == "tenant1" | WHERE msg == "a|b"`},
+		{name: "pipe in triple quoted string", query: `FROM logs-tenant1 | WHERE msg == """a|"b"""`, want: `FROM alias-logs-tenant1 | WHERE tenant_id == "tenant1" | WHERE msg == """a|"b"""`},
+		{name: "row", query: "ROW a = 1 | EVAL b = a + 1", want: "ROW a = 1 | EVAL b = a + 1"},
+		{name: "multiple tenants", query: "FROM logs-tenant1,logs-tenant2", wantErr: "multiple tenants"},
+		{name: "enrich", query: "FROM logs-tenant1 | ENRICH policy ON host", wantErr: "ENRICH is not supported"},
+		{name: "lookup join", query: "FROM logs-tenant1 | LOOKUP JOIN hosts-tenant2 ON host", wantErr: "LOOKUP is not supported"},
+		{name: "comment", query: "FROM logs-tenant1 // | x", wantErr: "comments are not supported"},
+		{name: "wildcard", query: "FROM logs-*", wantErr: "not supported"},
+		{name: "remote cluster", query: "FROM remote:logs-tenant1", wantErr: "not supported"},
+		{name: "other source", query: "TS metrics-tenant1", wantErr: "must start with FROM"},
+		{name: "unterminated string", query: `FROM logs-tenant1 | WHERE msg == "a`, wantErr: "unterminated"},
+		{name: "empty command", query: "FROM logs-tenant1 | | LIMIT 1", wantErr: "empty ES|QL command"},
+		{name: "missing index", query: "FROM ", wantErr: "requires an index"},
+		{name: "unexpected clause", query: "FROM logs-tenant1 OPTIONS x", wantErr: "unexpected ES|QL FROM clause"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, _, err := p.rewriteESQL(nil, tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestESQLIdentifierAndString(t *testing.T) {
+	if got := esqlIdentifier("tenant_id"); got != "tenant_id" {
+		t.Fatalf("expected plain identifier, got %s", got)
+	}
+	if got := esqlIdentifier("tenant-id"); got != "`tenant-id`" {
+		t.Fatalf("expected quoted identifier, got %s", got)
+	}
+	if got := esqlString(`a"b\c`); got != `"a\"b\\c"` {
+		t.Fatalf("expected escaped string, got %s", got)
+	}
+}
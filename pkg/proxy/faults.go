@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+const defaultFaultStatus = http.StatusServiceUnavailable
+
+var errInjectedDrop = errors.New("connection dropped by fault injection")
+
+// faultInjector is the upstream transport when fault injection is enabled. It
+// delays, drops, or answers upstream calls as the fault rules say, so the
+// responses still pass through modifyResponse and the errors through
+// handleProxyError.
+type faultInjector struct {
+	rules []config.FaultRule
+	next  http.RoundTripper
+}
+
+// newFaultInjector returns nil when fault injection is disabled.
+func newFaultInjector(cfg config.Faults, next http.RoundTripper) *faultInjector {
+	if !cfg.Enabled || len(cfg.Rules) == 0 {
+		return nil
+	}
+	rules := make([]config.FaultRule, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+		if rule.Status == 0 {
+			rule.Status = defaultFaultStatus
+		}
+		rules[i] = rule
+	}
+	log.Printf("faults: fault injection enabled with %d rules", len(rules))
+	return &faultInjector{rules: rules, next: next}
+}
+
+func (f *faultInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	tenantID := faultTenant(req)
+	rule, ok := f.fire(tenantID)
+	if !ok {
+		return f.next.RoundTrip(req)
+	}
+	log.Printf("faults: injecting %s: request_id=%s tenant=%s method=%s path=%s", rule.Action, requestIDFrom(req), tenantID, req.Method, req.URL.Path)
+	switch rule.Action {
+	case "delay":
+		timer := time.NewTimer(time.Duration(rule.DelayMs) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			closeRequestBody(req)
+			return nil, req.Context().Err()
+		}
+		return f.next.RoundTrip(req)
+	case "drop":
+		closeRequestBody(req)
+		return nil, errInjectedDrop
+	default:
+		closeRequestBody(req)
+		return faultResponse(req, rule.Status), nil
+	}
+}
+
+// fire returns the first rule for tenantID that fires for this call. Requests
+// whose tenant is not known before they are sent only match rules without a
+// tenant.
+func (f *faultInjector) fire(tenantID string) (config.FaultRule, bool) {
+	for _, rule := range f.rules {
+		if rule.Tenant != "" && rule.Tenant != tenantID {
+			continue
+		}
+		if rule.Percent > 0 && rand.Intn(100) < rule.Percent {
+			return rule, true
+		}
+	}
+	return config.FaultRule{}, false
+}
+
+// faultTenant returns the tenant a handler resolved for the request, or the
+// tenant of the index in its path.
+func faultTenant(req *http.Request) string {
+	state := requestStateFrom(req)
+	if state == nil {
+		return ""
+	}
+	if state.tenantID != "" {
+		return state.tenantID
+	}
+	return state.pathTenant
+}
+
+// faultResponse is an Elasticsearch-style error answered in place of the
+// upstream.
+func faultResponse(req *http.Request, status int) *http.Response {
+	body := fmt.Sprintf(`{"error":{"root_cause":[{"type":"fault_injection_exception","reason":"injected by fault rule"}],"type":"fault_injection_exception","reason":"injected by fault rule"},"status":%d}`, status)
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	header.Set("X-ES-TMNT-Fault", "error")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// closeRequestBody closes the body of a request that is not sent, as
+// RoundTrip must, which also stops a bulk body being rewritten into it.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
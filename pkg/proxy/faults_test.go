@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestFaultInjection(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       config.FaultRule
+		timeout    int
+		path       string
+		wantStatus int
+		wantCalls  int
+	}{
+		{name: "error", rule: config.FaultRule{Percent: 100, Action: "error"}, path: "/orders-tenant1/_search", wantStatus: http.StatusServiceUnavailable},
+		{name: "error status", rule: config.FaultRule{Percent: 100, Action: "error", Status: 429}, path: "/orders-tenant1/_search", wantStatus: http.StatusTooManyRequests},
+		{name: "drop", rule: config.FaultRule{Percent: 100, Action: "drop"}, path: "/orders-tenant1/_search", wantStatus: http.StatusBadGateway},
+		{name: "delay", rule: config.FaultRule{Percent: 100, Action: "delay", DelayMs: 10}, path: "/orders-tenant1/_search", wantStatus: http.StatusOK, wantCalls: 1},
+		{name: "delay past deadline", rule: config.FaultRule{Percent: 100, Action: "delay", DelayMs: 5000}, timeout: 1, path: "/orders-tenant1/_search", wantStatus: http.StatusGatewayTimeout},
+		{name: "other tenant", rule: config.FaultRule{Tenant: "tenant2", Percent: 100, Action: "error"}, path: "/orders-tenant1/_search", wantStatus: http.StatusOK, wantCalls: 1},
+		{name: "matching tenant", rule: config.FaultRule{Tenant: "tenant1", Percent: 100, Action: "error"}, path: "/orders-tenant1/_search", wantStatus: http.StatusServiceUnavailable},
+		{name: "zero percent", rule: config.FaultRule{Percent: 0, Action: "drop"}, path: "/orders-tenant1/_search", wantStatus: http.StatusOK, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Faults = config.Faults{Enabled: true, Rules: []config.FaultRule{tt.rule}}
+			cfg.Timeouts.SearchSeconds = tt.timeout
+			proxyHandler, capture := newProxyWithServer(t, cfg)
+			proxyHandler.proxy.Transport = newFaultInjector(cfg.Faults, proxyHandler.proxy.Transport)
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"query":{"match_all":{}}}`))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if _, _, _, _, count := capture.snapshot(); count != tt.wantCalls {
+				t.Fatalf("expected %d upstream calls, got %d", tt.wantCalls, count)
+			}
+			if tt.rule.Action == "error" && tt.wantCalls == 0 {
+				if rec.Header().Get("X-ES-TMNT-Fault") != "error" || !strings.Contains(rec.Body.String(), "fault_injection_exception") {
+					t.Fatalf("expected an injected error, got %v %s", rec.Header(), rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestFaultInjectionOnlyWhenEnabled(t *testing.T) {
+	cfg := config.Default()
+	cfg.Faults = config.Faults{Rules: []config.FaultRule{{Percent: 100, Action: "drop"}}}
+	proxyHandler, err := New(cfg)
+	if err != nil {
+		t.Fatalf("new proxy: %v", err)
+	}
+	if _, ok := proxyHandler.proxy.Transport.(*faultInjector); ok {
+		t.Fatalf("expected no fault injection while disabled")
+	}
+
+	cfg.Faults.Enabled = true
+	proxyHandler, err = New(cfg)
+	if err != nil {
+		t.Fatalf("new proxy: %v", err)
+	}
+	if _, ok := proxyHandler.proxy.Transport.(*faultInjector); !ok {
+		t.Fatalf("expected fault injection once enabled, got %T", proxyHandler.proxy.Transport)
+	}
+}
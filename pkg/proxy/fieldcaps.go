@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// fieldManifest lists, per tenant ID, the fields _field_caps may report in
+// shared mode. Entries name a field and its sub-fields, or end in "*" to match
+// by prefix. Tenants without an entry see every field but the tenant field.
+type fieldManifest map[string][]string
+
+// loadFieldManifest reads the manifest at path once. An empty path disables
+// it.
+func loadFieldManifest(path string) (fieldManifest, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read field manifest: %w", err)
+	}
+	var manifest fieldManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse field manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// manifestAllows reports whether the manifest entries let field be reported, either
+// as a listed field or sub-field or as an object containing one.
+func manifestAllows(entries []string, field string) bool {
+	if strings.HasPrefix(field, "_") {
+		return true
+	}
+	for _, entry := range entries {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(field, prefix) || strings.HasPrefix(prefix, field+".") {
+				return true
+			}
+			continue
+		}
+		if field == entry || strings.HasPrefix(field, entry+".") || strings.HasPrefix(entry, field+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) handleFieldCaps(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.setIndexResponse(r, baseIndex, tenantID, index, targetIndex)
+	p.setResponseKind(r, responseKindFieldCaps, baseIndex, tenantID)
+	p.proxy.ServeHTTP(w, r)
+}
+
+// filterFieldCaps reports a _field_caps response under the index the client
+// named. In shared mode the tenant field is removed, since every document of
+// the tenant holds the same value, and the fields are limited to the tenant's
+// field manifest entry, if any, so tenants sharing an index do not learn each
+// other's fields.
+func (p *Proxy) filterFieldCaps(payload map[string]interface{}, state *requestState) bool {
+	changed := renameIndexList(payload, "indices", state.target, state.index)
+	fields, ok := payload["fields"].(map[string]interface{})
+	if !ok {
+		return changed
+	}
+	tenantField := ""
+	entries, restricted := []string(nil), false
+	if isSharedMode(p.cfg.Mode) {
+		tenantField = p.tenantField(state.baseIndex)
+		entries, restricted = p.fieldManifest[state.tenantID]
+	}
+	for name, value := range fields {
+		isTenantField := tenantField != "" && (name == tenantField || strings.HasPrefix(name, tenantField+"."))
+		if isTenantField || (restricted && !manifestAllows(entries, name)) {
+			delete(fields, name)
+			changed = true
+			continue
+		}
+		types, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, caps := range types {
+			capsObject, ok := caps.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, key := range []string{"indices", "non_searchable_indices", "non_aggregatable_indices"} {
+				changed = renameIndexList(capsObject, key, state.target, state.index) || changed
+			}
+		}
+	}
+	return changed
+}
+
+// renameIndexList replaces target with index in the list of index names under
+// key.
+func renameIndexList(section map[string]interface{}, key, target, index string) bool {
+	list, ok := section[key].([]interface{})
+	if !ok || target == index {
+		return false
+	}
+	changed := false
+	for i, item := range list {
+		if item == target {
+			list[i] = index
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+const fieldCapsUpstream = `{"indices":["shared-products"],"fields":{` +
+	`"_id":{"_id":{"type":"_id","searchable":true,"aggregatable":false}},` +
+	`"tenant_id":{"keyword":{"type":"keyword","searchable":true,"aggregatable":true}},` +
+	`"name":{"text":{"type":"text","searchable":true,"aggregatable":false}},` +
+	`"name.raw":{"keyword":{"type":"keyword","searchable":true,"aggregatable":true}},` +
+	`"price":{"long":{"type":"long","searchable":true,"aggregatable":true,"indices":["shared-products"]}},` +
+	`"attributes":{"object":{"type":"object","searchable":false,"aggregatable":false}},` +
+	`"attributes.color":{"keyword":{"type":"keyword","searchable":true,"aggregatable":true}},` +
+	`"internal_score":{"float":{"type":"float","searchable":true,"aggregatable":true}}}}`
+
+func TestFieldCapsSharedMode(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "fields.json")
+	if err := os.WriteFile(manifestPath, []byte(`{"tenant1":["name","price","attributes.*"]}`), 0o600); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	cfg := config.Default()
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	cfg.SharedIndex.FieldManifestPath = manifestPath
+
+	tests := []struct {
+		tenant string
+		want   []string
+	}{
+		{tenant: "tenant1", want: []string{"_id", "attributes", "attributes.color", "name", "name.raw", "price"}},
+		{tenant: "tenant2", want: []string{"_id", "attributes", "attributes.color", "internal_score", "name", "name.raw", "price"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tenant, func(t *testing.T) {
+			proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, fieldCapsUpstream))
+			req := httptest.NewRequest(http.MethodGet, "/products-"+tt.tenant+"/_field_caps?fields=*", nil)
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+			var payload struct {
+				Indices []string                                     `json:"indices"`
+				Fields  map[string]map[string]map[string]interface{} `json:"fields"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+				t.Fatalf("parse response %q: %v", rec.Body.String(), err)
+			}
+			var names []string
+			for name := range payload.Fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected fields %v, got %v", tt.want, names)
+			}
+			index := "products-" + tt.tenant
+			if len(payload.Indices) != 1 || payload.Indices[0] != index {
+				t.Fatalf("expected indices [%s], got %v", index, payload.Indices)
+			}
+			if indices := payload.Fields["price"]["long"]["indices"].([]interface{}); indices[0] != index {
+				t.Fatalf("expected field indices renamed, got %v", indices)
+			}
+		})
+	}
+}
+
+func TestFieldCapsManifestErrors(t *testing.T) {
+	cfg := config.Default()
+	cfg.SharedIndex.FieldManifestPath = filepath.Join(t.TempDir(), "missing.json")
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "read field manifest") {
+		t.Fatalf("expected a missing manifest to fail, got %v", err)
+	}
+	invalid := filepath.Join(t.TempDir(), "fields.json")
+	if err := os.WriteFile(invalid, []byte(`{"tenant1":"name"}`), 0o600); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	cfg.SharedIndex.FieldManifestPath = invalid
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "parse field manifest") {
+		t.Fatalf("expected an invalid manifest to fail, got %v", err)
+	}
+}
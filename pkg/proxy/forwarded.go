@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustedProxies are the load balancers and ingresses whose forwarding
+// headers describe the client. Only the header family they maintain is read:
+// X-Forwarded-For with X-Forwarded-Proto and X-Forwarded-Host, or Forwarded.
+// Most proxies pass the other family through from the client unchanged, so it
+// is ignored. Headers from other peers are ignored and, on the way upstream,
+// replaced.
+type trustedProxies struct {
+	prefixes  []netip.Prefix
+	forwarded bool
+}
+
+func newTrustedProxies(values []string, header string) (trustedProxies, error) {
+	prefixes, err := parsePrefixes(values)
+	if err != nil {
+		return trustedProxies{}, err
+	}
+	return trustedProxies{prefixes: prefixes, forwarded: strings.EqualFold(header, "Forwarded")}, nil
+}
+
+// peerAddr returns the address of the connection r came in on.
+func peerAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+func (t trustedProxies) trusts(r *http.Request) bool {
+	return len(t.prefixes) > 0 && containsAddr(t.prefixes, peerAddr(r))
+}
+
+// clientAddr returns the address of the client of r: the peer address, or,
+// when the peer is a trusted proxy, the last address of the trusted header's
+// chain that is not one. The zero address is returned when an address that
+// needs checking does not parse, which no tenant range contains.
+func (t trustedProxies) clientAddr(r *http.Request) netip.Addr {
+	addr := peerAddr(r)
+	if !addr.IsValid() || !t.trusts(r) {
+		return addr
+	}
+	var hops []string
+	if t.forwarded {
+		hops = forwardedFor(r.Header.Values("Forwarded"))
+	} else {
+		hops = splitHeaderList(r.Header.Values("X-Forwarded-For"))
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		forwarded, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			return netip.Addr{}
+		}
+		addr = forwarded.Unmap()
+		if !containsAddr(t.prefixes, addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// clientProto returns the scheme the client used: the first
+// X-Forwarded-Proto value or Forwarded proto, whichever family is trusted,
+// which the outermost proxy set, when the peer is trusted, and the scheme of
+// the connection otherwise.
+func (t trustedProxies) clientProto(r *http.Request) string {
+	if t.trusts(r) {
+		if t.forwarded {
+			if proto := forwardedParam(r.Header.Values("Forwarded"), "proto"); proto != "" {
+				return strings.ToLower(proto)
+			}
+		} else if protos := splitHeaderList(r.Header.Values("X-Forwarded-Proto")); len(protos) > 0 {
+			return strings.ToLower(protos[0])
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// clientHost returns the host the client asked for, as clientProto does the
+// scheme.
+func (t trustedProxies) clientHost(r *http.Request) string {
+	if t.trusts(r) {
+		if t.forwarded {
+			if host := forwardedParam(r.Header.Values("Forwarded"), "host"); host != "" {
+				return host
+			}
+		} else if hosts := splitHeaderList(r.Header.Values("X-Forwarded-Host")); len(hosts) > 0 {
+			return hosts[0]
+		}
+	}
+	return r.Host
+}
+
+// setForwardedHeaders describes the client to the upstream. The trusted
+// forwarding header of trusted peers is extended with the peer; other
+// forwarding headers could be forged and are replaced. The reverse proxy
+// appends the peer to X-Forwarded-For itself.
+func (p *Proxy) setForwardedHeaders(outbound *http.Request) {
+	header := outbound.Header
+	proto, host := p.trusted.clientProto(outbound), p.trusted.clientHost(outbound)
+	trusted := p.trusted.trusts(outbound)
+	if !trusted || p.trusted.forwarded {
+		header.Del("X-Forwarded-For")
+	}
+	if !trusted || !p.trusted.forwarded {
+		header.Del("Forwarded")
+	}
+	header.Set("X-Forwarded-Proto", proto)
+	header.Set("X-Forwarded-Host", host)
+	element := "for=" + forwardedNode(peerAddr(outbound))
+	if host != "" {
+		element += ";host=" + quoteForwarded(host)
+	}
+	element += ";proto=" + proto
+	if previous := strings.Join(header.Values("Forwarded"), ", "); previous != "" {
+		element = previous + ", " + element
+	}
+	header.Set("Forwarded", element)
+}
+
+// forwardedFor returns the for= addresses of Forwarded header values, without
+// ports and IPv6 brackets. Unknown and obfuscated nodes are returned as they
+// are, so they do not parse as addresses.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range splitHeaderList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || !strings.EqualFold(key, "for") {
+				continue
+			}
+			value = strings.Trim(value, `"`)
+			if strings.HasPrefix(value, "[") {
+				value, _, _ = strings.Cut(value[1:], "]")
+			} else if host, _, ok := strings.Cut(value, ":"); ok {
+				value = host
+			}
+			hops = append(hops, value)
+		}
+	}
+	return hops
+}
+
+// forwardedParam returns the value of key in the first Forwarded element
+// that has it.
+func forwardedParam(values []string, key string) string {
+	for _, element := range splitHeaderList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(name, key) {
+				return strings.Trim(value, `"`)
+			}
+		}
+	}
+	return ""
+}
+
+// forwardedNode formats an address as a Forwarded node, which quotes IPv6
+// addresses in brackets.
+func forwardedNode(addr netip.Addr) string {
+	switch {
+	case !addr.IsValid():
+		return "unknown"
+	case addr.Is6():
+		return `"[` + addr.String() + `]"`
+	default:
+		return addr.String()
+	}
+}
+
+func quoteForwarded(value string) string {
+	if strings.ContainsAny(value, ":[]") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// splitHeaderList splits comma-separated header values, dropping empty items.
+func splitHeaderList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestClientAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		remote  string
+		header  string
+		headers map[string][]string
+		want    string
+	}{
+		{name: "direct", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted peer ignores forwarded", remote: "203.0.113.7:5000", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, want: "203.0.113.7"},
+		{name: "trusted peer", remote: "10.1.2.3:5000", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "trusted hops skipped", remote: "10.1.2.3:5000", headers: map[string][]string{"X-Forwarded-For": {"6.6.6.6, 198.51.100.1, 192.0.2.1"}}, want: "198.51.100.1"},
+		{name: "multiple headers", remote: "10.1.2.3:5000", headers: map[string][]string{"X-Forwarded-For": {"6.6.6.6", "198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "ipv4 mapped", remote: "[::ffff:203.0.113.7]:5000", want: "203.0.113.7"},
+		{name: "garbage hop", remote: "10.1.2.3:5000", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1, unknown"}}, want: "invalid IP"},
+		{name: "forwarded", remote: "10.1.2.3:5000", header: "Forwarded", headers: map[string][]string{"Forwarded": {`for=6.6.6.6, for="[2001:db8::7]:4711";proto=https`, "for=192.0.2.1"}}, want: "2001:db8::7"},
+		{name: "forwarded with port", remote: "10.1.2.3:5000", header: "Forwarded", headers: map[string][]string{"Forwarded": {`for="198.51.100.1:5555"`}}, want: "198.51.100.1"},
+		{name: "forwarded obfuscated", remote: "10.1.2.3:5000", header: "Forwarded", headers: map[string][]string{"Forwarded": {"for=_hidden"}}, want: "invalid IP"},
+		{name: "forwarded ignored by default", remote: "10.1.2.3:5000", headers: map[string][]string{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"6.6.6.6"}}, want: "6.6.6.6"},
+		{name: "forwarded without x-forwarded-for", remote: "10.1.2.3:5000", headers: map[string][]string{"Forwarded": {"for=198.51.100.1"}}, want: "10.1.2.3"},
+		{name: "x-forwarded-for ignored", remote: "10.1.2.3:5000", header: "Forwarded", headers: map[string][]string{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"6.6.6.6"}}, want: "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for name, values := range tt.headers {
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+			header := tt.header
+			if header == "" {
+				header = "X-Forwarded-For"
+			}
+			trusted, err := newTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}, header)
+			if err != nil {
+				t.Fatalf("parse trusted proxies: %v", err)
+			}
+			if got := trusted.clientAddr(req).String(); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	cfg := config.Default()
+	cfg.TrustedProxies = []string{"10.0.0.0/8"}
+	var mu sync.Mutex
+	var upstreamHeader http.Header
+	proxyHandler := newProxyWithUpstream(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		upstreamHeader = r.Header.Clone()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"count":0}`))
+	}))
+
+	tests := []struct {
+		name          string
+		remote        string
+		tls           bool
+		headers       map[string]string
+		wantFor       string
+		wantProto     string
+		wantHost      string
+		wantForwarded string
+	}{
+		{
+			name:          "direct client",
+			remote:        "203.0.113.7:5000",
+			tls:           true,
+			wantFor:       "203.0.113.7",
+			wantProto:     "https",
+			wantHost:      "example.com",
+			wantForwarded: "for=203.0.113.7;host=example.com;proto=https",
+		},
+		{
+			name:          "spoofed headers",
+			remote:        "203.0.113.7:5000",
+			headers:       map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https", "Forwarded": "for=198.51.100.1"},
+			wantFor:       "203.0.113.7",
+			wantProto:     "http",
+			wantHost:      "example.com",
+			wantForwarded: "for=203.0.113.7;host=example.com;proto=http",
+		},
+		{
+			name:          "trusted ingress",
+			remote:        "10.0.0.5:5000",
+			headers:       map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "search.example.com", "Forwarded": "for=198.51.100.1;proto=https"},
+			wantFor:       "198.51.100.1, 10.0.0.5",
+			wantProto:     "https",
+			wantHost:      "search.example.com",
+			wantForwarded: "for=10.0.0.5;host=search.example.com;proto=https",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders-tenant1/_count", nil)
+			req.RemoteAddr = tt.remote
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if got := upstreamHeader.Get("X-Forwarded-For"); got != tt.wantFor {
+				t.Fatalf("expected X-Forwarded-For %q, got %q", tt.wantFor, got)
+			}
+			if got := upstreamHeader.Get("X-Forwarded-Proto"); got != tt.wantProto {
+				t.Fatalf("expected X-Forwarded-Proto %q, got %q", tt.wantProto, got)
+			}
+			if got := upstreamHeader.Get("X-Forwarded-Host"); got != tt.wantHost {
+				t.Fatalf("expected X-Forwarded-Host %q, got %q", tt.wantHost, got)
+			}
+			if got := upstreamHeader.Get("Forwarded"); got != tt.wantForwarded {
+				t.Fatalf("expected Forwarded %q, got %q", tt.wantForwarded, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// writeFreeze rejects writes of every tenant while set. It starts from the
+// freeze config and is toggled at runtime through the admin endpoint.
+type writeFreeze struct {
+	mu             sync.Mutex
+	frozen         bool
+	message        string
+	since          time.Time
+	defaultMessage string
+}
+
+// freezeState is the admin view of the write freeze.
+type freezeState struct {
+	Frozen  bool       `json:"frozen"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+func newWriteFreeze(frozen bool, message string) *writeFreeze {
+	f := &writeFreeze{defaultMessage: message}
+	if frozen {
+		f.set("")
+	}
+	return f
+}
+
+// set freezes writes, rejecting them with message or the configured message
+// when it is empty.
+func (f *writeFreeze) set(message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if message == "" {
+		message = f.defaultMessage
+	}
+	if !f.frozen {
+		f.since = time.Now().UTC()
+	}
+	f.frozen = true
+	f.message = message
+}
+
+func (f *writeFreeze) clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frozen = false
+	f.message = ""
+	f.since = time.Time{}
+}
+
+// rejection returns the message writes are rejected with while frozen.
+func (f *writeFreeze) rejection() (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.message, f.frozen
+}
+
+func (f *writeFreeze) state() freezeState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.frozen {
+		return freezeState{}
+	}
+	since := f.since
+	return freezeState{Frozen: true, Message: f.message, Since: &since}
+}
+
+// readEndpoints are the endpoints that only read even when called with POST.
+// They are matched at the root or after the index.
+var readEndpoints = map[string]bool{
+	"_search": true, "_msearch": true, "_count": true, "_explain": true, "_validate": true,
+	"_field_caps": true, "_terms_enum": true, "_search_shards": true, "_analyze": true,
+	"_mget": true, "_termvectors": true, "_mtermvectors": true, "_eql": true, "_sql": true,
+	"_query": true, "_rank_eval": true, "_render": true,
+}
+
+// isWriteRequest reports whether the request may change data or cluster state.
+// GET and HEAD requests, POST requests to read endpoints, and pipeline
+// simulations are reads; everything else is treated as a write.
+func isWriteRequest(r *http.Request, segments []string) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return false
+	case http.MethodPost:
+		for i := 0; i < len(segments) && i < 2; i++ {
+			if readEndpoints[segments[i]] {
+				return false
+			}
+		}
+		if len(segments) > 0 && segments[len(segments)-1] == "_simulate" {
+			return false
+		}
+	}
+	return true
+}
+
+// rejectFrozen answers a write made during a write freeze the way
+// Elasticsearch answers writes to a read-only cluster.
+func (p *Proxy) rejectFrozen(w http.ResponseWriter, message string) {
+	p.writeError(w, http.StatusForbidden, "cluster_block_exception", codeWritesFrozen, message)
+}
+
+// handleFreeze reports the write freeze on GET, freezes writes on POST with an
+// optional {"message": "..."} body, and lifts the freeze on DELETE.
+func (p *Proxy) handleFreeze(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var payload struct {
+			Message string `json:"message"`
+		}
+		if r.Body != nil {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "bad_request", "failed to read body")
+				return
+			}
+			if len(strings.TrimSpace(string(body))) > 0 {
+				if err := json.Unmarshal(body, &payload); err != nil {
+					writeJSONError(w, http.StatusBadRequest, "bad_request", "invalid JSON body")
+					return
+				}
+			}
+		}
+		p.freeze.set(strings.TrimSpace(payload.Message))
+		message, _ := p.freeze.rejection()
+		log.Printf("freeze: writes frozen: %s", message)
+	case http.MethodDelete:
+		p.freeze.clear()
+		log.Printf("freeze: writes unfrozen")
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for freeze")
+		return
+	}
+	writeJSON(w, http.StatusOK, p.freeze.state())
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestFreezeRejectsWritesAllowsReads(t *testing.T) {
+	cfg := config.Default()
+	cfg.Freeze.Writes = true
+	cfg.Freeze.Message = "reindex window"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	writes := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodPut, path: "/products-tenant1/_doc/1", body: `{"a":1}`},
+		{method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"products-tenant1\"}}\n{\"a\":1}\n"},
+		{method: http.MethodPost, path: "/products-tenant1/_update_by_query", body: `{}`},
+		{method: http.MethodDelete, path: "/products-tenant1"},
+		{method: http.MethodPut, path: "/products-tenant1/_doc/_search", body: `{"a":1}`},
+	}
+	for _, tt := range writes {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "reindex window") {
+			t.Fatalf("expected %s %s to be frozen, got %d: %s", tt.method, tt.path, rec.Code, rec.Body.String())
+		}
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+
+	reads := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodPost, path: "/products-tenant1/_search", body: `{}`},
+		{method: http.MethodGet, path: "/products-tenant1/_count"},
+		{method: http.MethodPost, path: "/_msearch", body: "{\"index\":\"products-tenant1\"}\n{}\n"},
+		{method: http.MethodPost, path: "/_ingest/pipeline/enrich-tenant1/_simulate", body: `{"docs":[]}`},
+	}
+	for _, tt := range reads {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected %s %s to be allowed, got %d: %s", tt.method, tt.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestAdminFreezeEndpoint(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+	admin := proxyHandler.AdminHandler()
+	write := func() int {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/products-tenant1/_doc/1", strings.NewReader(`{"a":1}`)))
+		return rec.Code
+	}
+
+	if code := write(); code != http.StatusOK {
+		t.Fatalf("expected write before freeze, got %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/freeze", strings.NewReader(`{"message":"upgrading"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var state freezeState
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !state.Frozen || state.Message != "upgrading" || state.Since == nil {
+		t.Fatalf("unexpected freeze state: %s", rec.Body.String())
+	}
+	if code := write(); code != http.StatusForbidden {
+		t.Fatalf("expected write to be frozen, got %d", code)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/freeze", nil))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"frozen":false}` {
+		t.Fatalf("expected unfrozen state, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if code := write(); code != http.StatusOK {
+		t.Fatalf("expected write after unfreeze, got %d", code)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/freeze", nil))
+	if !strings.Contains(rec.Body.String(), `"message":"writes are frozen for cluster maintenance"`) {
+		t.Fatalf("expected configured message, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/freeze", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+}
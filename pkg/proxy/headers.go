@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"es-tmnt/pkg/config"
+)
+
+const corsExposedHeaders = "X-ES-TMNT, X-Request-ID, X-Elastic-Product"
+
+// headerPolicy is the compiled response_headers configuration.
+type headerPolicy struct {
+	strip   []string
+	set     map[string]string
+	origins map[string]*corsRule
+	maxAge  string
+}
+
+// corsRule is what an allowed origin may do.
+type corsRule struct {
+	methods     string
+	methodSet   map[string]bool
+	headers     string
+	headerSet   map[string]bool
+	credentials bool
+}
+
+func newHeaderPolicy(cfg config.ResponseHeaders) *headerPolicy {
+	cors := cfg.CORS
+	policy := &headerPolicy{
+		set:     make(map[string]string, len(cfg.Set)),
+		origins: make(map[string]*corsRule, len(cors.AllowedOrigins)+len(cors.Origins)),
+		maxAge:  strconv.Itoa(cors.MaxAgeSeconds),
+	}
+	for _, name := range cfg.Strip {
+		policy.strip = append(policy.strip, http.CanonicalHeaderKey(strings.TrimSpace(name)))
+	}
+	for name, value := range cfg.Set {
+		policy.set[http.CanonicalHeaderKey(strings.TrimSpace(name))] = value
+	}
+	defaults := newCORSRule(cors.AllowedMethods, cors.AllowedHeaders, cors.AllowCredentials)
+	for _, origin := range cors.AllowedOrigins {
+		policy.origins[strings.TrimSpace(origin)] = defaults
+	}
+	for _, origin := range cors.Origins {
+		methods, headers, credentials := origin.AllowedMethods, origin.AllowedHeaders, cors.AllowCredentials
+		if len(methods) == 0 {
+			methods = cors.AllowedMethods
+		}
+		if len(headers) == 0 {
+			headers = cors.AllowedHeaders
+		}
+		if origin.AllowCredentials != nil {
+			credentials = *origin.AllowCredentials
+		}
+		policy.origins[strings.TrimSpace(origin.Origin)] = newCORSRule(methods, headers, credentials)
+	}
+	return policy
+}
+
+func newCORSRule(methods, headers []string, credentials bool) *corsRule {
+	rule := &corsRule{
+		methods:     strings.Join(methods, ", "),
+		methodSet:   make(map[string]bool, len(methods)),
+		headers:     strings.Join(headers, ", "),
+		headerSet:   make(map[string]bool, len(headers)),
+		credentials: credentials,
+	}
+	for _, method := range methods {
+		rule.methodSet[strings.TrimSpace(method)] = true
+	}
+	for _, header := range headers {
+		rule.headerSet[http.CanonicalHeaderKey(strings.TrimSpace(header))] = true
+	}
+	return rule
+}
+
+// corsOrigin returns the Access-Control-Allow-Origin value for the Origin of r
+// and the rule of that origin, or "" when r is not a CORS request from an
+// allowed origin. Origins configured by name take precedence over "*".
+func (h *headerPolicy) corsOrigin(r *http.Request) (string, *corsRule) {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(h.origins) == 0 {
+		return "", nil
+	}
+	if rule, ok := h.origins[origin]; ok {
+		return origin, rule
+	}
+	if rule, ok := h.origins["*"]; ok {
+		return "*", rule
+	}
+	return "", nil
+}
+
+// isPreflight reports whether r is a CORS preflight request, which browsers
+// send before requests with custom headers or methods and which Elasticsearch
+// would otherwise reject as an unknown OPTIONS request.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// servePreflight answers preflight requests before they are routed when CORS
+// is configured: with the allowed methods and headers when the origin may
+// send the request, and with a CORS_DENIED error otherwise.
+func (p *Proxy) servePreflight(w http.ResponseWriter, r *http.Request) bool {
+	if len(p.headers.origins) == 0 || !isPreflight(r) {
+		return false
+	}
+	p.setResponseMode(w, responseModeHandled)
+	origin, rule := p.headers.corsOrigin(r)
+	if rule == nil {
+		p.rejectStatus(w, http.StatusForbidden, codeCORSDenied, fmt.Sprintf("origin %s is not allowed", r.Header.Get("Origin")))
+		return true
+	}
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !rule.methodSet[method] {
+		p.rejectStatus(w, http.StatusForbidden, codeCORSDenied, fmt.Sprintf("method %s is not allowed for origin %s", method, origin))
+		return true
+	}
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header != "" && !rule.headerSet[header] {
+			p.rejectStatus(w, http.StatusForbidden, codeCORSDenied, fmt.Sprintf("header %s is not allowed for origin %s", header, origin))
+			return true
+		}
+	}
+	header := w.Header()
+	header.Set("Access-Control-Allow-Methods", rule.methods)
+	if rule.headers != "" {
+		header.Set("Access-Control-Allow-Headers", rule.headers)
+	}
+	header.Set("Access-Control-Max-Age", p.headers.maxAge)
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// headerWriter applies the response header policy when the status is written,
+// like productWriter, so it covers upstream responses as well as errors and
+// other responses the proxy writes itself. Upstream headers that reveal the
+// cluster are stripped, the X-ES-TMNT mode header is kept to the single value
+// the proxy set or, on paths that answer before a mode is chosen, set to
+// handled, and configured and CORS headers are added.
+type headerWriter struct {
+	http.ResponseWriter
+	policy      *headerPolicy
+	origin      string
+	cors        *corsRule
+	wroteHeader bool
+}
+
+func (w *headerWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		header := w.Header()
+		for _, name := range w.policy.strip {
+			header.Del(name)
+		}
+		if modes := header.Values(responseModeHeader); len(modes) == 0 {
+			header.Set(responseModeHeader, responseModeHandled)
+		} else if len(modes) > 1 {
+			header.Set(responseModeHeader, modes[0])
+		}
+		for name, value := range w.policy.set {
+			header.Set(name, value)
+		}
+		if w.cors != nil {
+			header.Set("Access-Control-Allow-Origin", w.origin)
+			header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			if w.origin != "*" {
+				header.Add("Vary", "Origin")
+			}
+			if w.cors.credentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+	}
+	if status >= http.StatusOK {
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestResponseHeaderPolicy(t *testing.T) {
+	cfg := config.Default()
+	cfg.ResponseHeaders.Set = map[string]string{"x-served-by": "es-tmnt"}
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Found-Handling-Cluster", "abc123")
+		w.Header().Set("X-Found-Handling-Instance", "instance-0000000001")
+		w.Header().Set(responseModeHeader, "upstream")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"count":0}`))
+	})
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders-tenant1/_count", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	header := rec.Header()
+	if header.Get("X-Found-Handling-Cluster") != "" || header.Get("X-Found-Handling-Instance") != "" {
+		t.Fatalf("expected cluster headers stripped, got %v", header)
+	}
+	if modes := header.Values(responseModeHeader); len(modes) != 1 || modes[0] != responseModeHandled {
+		t.Fatalf("expected a single handled mode header, got %v", modes)
+	}
+	if got := header.Get("X-Served-By"); got != "es-tmnt" {
+		t.Fatalf("expected configured header, got %q", got)
+	}
+	if header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no CORS headers without allowed origins")
+	}
+}
+
+func TestResponseModeHeaderOnEarlyRejection(t *testing.T) {
+	proxyHandler := newProxyWithUpstream(t, config.Default(), jsonUpstream(http.StatusOK, `{}`))
+	if err := proxyHandler.Drain(context.Background()); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/orders-tenant1/_search", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected draining rejection, got %d", rec.Code)
+	}
+	if got := rec.Header().Get(responseModeHeader); got != responseModeHandled {
+		t.Fatalf("expected mode header %q, got %q", responseModeHandled, got)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	cfg := config.Default()
+	cfg.ResponseHeaders.CORS.AllowedOrigins = []string{"https://dashboard.example.com"}
+	cfg.ResponseHeaders.CORS.AllowCredentials = true
+	var upstreamCalls int
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"count":0}`))
+	})
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	t.Run("preflight", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/orders-tenant1/_search", nil)
+		req.Header.Set("Origin", "https://dashboard.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if upstreamCalls != 0 {
+			t.Fatalf("expected preflight answered by the proxy")
+		}
+		header := rec.Header()
+		if header.Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" || header.Get("Access-Control-Allow-Credentials") != "true" {
+			t.Fatalf("unexpected CORS headers: %v", header)
+		}
+		if header.Get("Access-Control-Allow-Methods") != "GET, HEAD, POST, PUT, DELETE" || header.Get("Access-Control-Allow-Headers") != "Authorization, Content-Type, X-Request-ID" || header.Get("Access-Control-Max-Age") != "600" {
+			t.Fatalf("unexpected preflight headers: %v", header)
+		}
+	})
+
+	t.Run("allowed origin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/orders-tenant1/_count", nil)
+		req.Header.Set("Origin", "https://dashboard.example.com")
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+		}
+		header := rec.Header()
+		if header.Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" || header.Get("Vary") != "Origin" {
+			t.Fatalf("unexpected CORS headers: %v", header)
+		}
+		if header.Get("Access-Control-Expose-Headers") != corsExposedHeaders {
+			t.Fatalf("unexpected exposed headers %q", header.Get("Access-Control-Expose-Headers"))
+		}
+	})
+
+	t.Run("other origin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/orders-tenant1/_search", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), string(codeCORSDenied)) {
+			t.Fatalf("expected CORS_DENIED, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("expected no CORS headers for other origins, got %v", rec.Header())
+		}
+	})
+
+	t.Run("preflight without cors", func(t *testing.T) {
+		proxyHandler := newProxyWithUpstream(t, config.Default(), jsonUpstream(http.StatusOK, `{}`))
+		req := httptest.NewRequest(http.MethodOptions, "/orders-tenant1/_search", nil)
+		req.Header.Set("Origin", "https://dashboard.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code == http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("expected preflight not to be answered without cors, got %d %v", rec.Code, rec.Header())
+		}
+	})
+}
+
+func TestCORSPerOrigin(t *testing.T) {
+	cfg := config.Default()
+	cfg.ResponseHeaders.CORS.AllowedOrigins = []string{"*"}
+	noCredentials := false
+	cfg.ResponseHeaders.CORS.Origins = []config.CORSOrigin{{
+		Origin:           "https://admin.example.com",
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Tenant-ID"},
+		AllowCredentials: &noCredentials,
+	}, {
+		Origin:         "https://reports.example.com",
+		AllowedMethods: []string{"GET", "POST"},
+	}}
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{}`))
+
+	tests := []struct {
+		name       string
+		origin     string
+		method     string
+		headers    string
+		wantStatus int
+		wantOrigin string
+		wantAllow  string
+	}{
+		{name: "named origin", origin: "https://admin.example.com", method: "PUT", headers: "x-tenant-id", wantStatus: http.StatusNoContent, wantOrigin: "https://admin.example.com", wantAllow: "Authorization, Content-Type, X-Tenant-ID"},
+		{name: "named origin method", origin: "https://reports.example.com", method: "DELETE", wantStatus: http.StatusForbidden},
+		{name: "named origin header", origin: "https://reports.example.com", method: "POST", headers: "X-Tenant-ID", wantStatus: http.StatusForbidden},
+		{name: "any origin", origin: "https://other.example.com", method: "DELETE", headers: "Content-Type", wantStatus: http.StatusNoContent, wantOrigin: "*", wantAllow: "Authorization, Content-Type, X-Request-ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/orders-tenant1/_doc/1", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusNoContent {
+				return
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Fatalf("expected origin %q, got %q", tt.wantOrigin, got)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Headers"); got != tt.wantAllow {
+				t.Fatalf("expected allowed headers %q, got %q", tt.wantAllow, got)
+			}
+			if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Fatalf("expected no credentials")
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import "net/http"
+
+// Hooks lets programs embedding the proxy observe and adjust the requests it
+// serves. Every hook is optional and must be safe for concurrent use.
+type Hooks struct {
+	// OnTenantResolved is called before routing a request whose path or
+	// ?index= parameter names a tenant index, with the tenant and base index
+	// parsed from it.
+	OnTenantResolved func(r *http.Request, tenantID, baseIndex string)
+	// OnRewrite is called with each request the proxy is about to send
+	// upstream, after it was rewritten, and the request URI the client sent.
+	// It may adjust the outbound request, for example by adding headers.
+	OnRewrite func(outbound *http.Request, originalURI string)
+	// OnReject is called when the proxy answers a request with an error of its
+	// own instead of forwarding it.
+	OnReject func(r *http.Request, status int, errorType, message string)
+}
+
+// Option configures a Proxy built by New.
+type Option func(*Proxy)
+
+// WithHooks installs hooks on the proxy.
+func WithHooks(hooks Hooks) Option {
+	return func(p *Proxy) {
+		p.hooks = hooks
+	}
+}
+
+// rejectWriter reports the errors the proxy answers a request with to the
+// OnReject hook.
+type rejectWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	onReject func(r *http.Request, status int, errorType, message string)
+}
+
+func (w *rejectWriter) rejected(status int, errorType, message string) {
+	w.onReject(w.r, status, errorType, message)
+}
+
+// rejectWriterOf returns the rejectWriter w is or wraps, if any.
+func rejectWriterOf(w http.ResponseWriter) *rejectWriter {
+	for w != nil {
+		if hooked, ok := w.(*rejectWriter); ok {
+			return hooked
+		}
+		wrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = wrapper.Unwrap()
+	}
+	return nil
+}
+
+func (w *rejectWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *rejectWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// tenantResolved calls the OnTenantResolved hook for the index a request
+// names, when it parses as a tenant index.
+func (p *Proxy) tenantResolved(r *http.Request, indexName string) (string, string) {
+	if indexName == "" {
+		return "", ""
+	}
+	_, baseIndex, tenantID, err := p.parseClusterIndex(r, indexName)
+	if err != nil {
+		return "", ""
+	}
+	if p.hooks.OnTenantResolved != nil {
+		p.hooks.OnTenantResolved(r, tenantID, baseIndex)
+	}
+	return baseIndex, tenantID
+}
+
+// rewritten calls the OnRewrite hook for a request about to be sent upstream.
+func (p *Proxy) rewritten(outbound *http.Request) {
+	if p.hooks.OnRewrite == nil {
+		return
+	}
+	originalURI := ""
+	if state := requestStateFrom(outbound); state != nil {
+		originalURI = state.originalURI
+	}
+	p.hooks.OnRewrite(outbound, originalURI)
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestHooks(t *testing.T) {
+	var mu sync.Mutex
+	var resolved, rewrites, rejects []string
+	var upstreamHeader string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		upstreamHeader = r.Header.Get("X-Embedded-Tenant")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+	cfg := config.Default()
+	hooks := Hooks{
+		OnTenantResolved: func(r *http.Request, tenantID, baseIndex string) {
+			mu.Lock()
+			defer mu.Unlock()
+			resolved = append(resolved, tenantID+"/"+baseIndex)
+		},
+		OnRewrite: func(outbound *http.Request, originalURI string) {
+			mu.Lock()
+			defer mu.Unlock()
+			rewrites = append(rewrites, originalURI+" -> "+outbound.URL.Path)
+			outbound.Header.Set("X-Embedded-Tenant", "set")
+		},
+		OnReject: func(r *http.Request, status int, errorType, message string) {
+			mu.Lock()
+			defer mu.Unlock()
+			rejects = append(rejects, r.URL.Path+" "+errorType+" "+message)
+		},
+	}
+	var handler http.Handler = newProxyWithUpstream(t, cfg, upstream, WithHooks(hooks))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/products-tenant1/_unknown", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(resolved, ",") != "tenant1/products,tenant1/products" {
+		t.Fatalf("unexpected resolved tenants: %v", resolved)
+	}
+	if strings.Join(rewrites, ",") != "/products-tenant1/_search -> /alias-products-tenant1/_search" {
+		t.Fatalf("unexpected rewrites: %v", rewrites)
+	}
+	if upstreamHeader != "set" {
+		t.Fatalf("expected OnRewrite to adjust the outbound request, got %q", upstreamHeader)
+	}
+	if strings.Join(rejects, ",") != "/products-tenant1/_unknown unsupported_request unsupported endpoint" {
+		t.Fatalf("unexpected rejects: %v", rejects)
+	}
+}
+
+func TestNewCompilesConfigBuiltInCode(t *testing.T) {
+	cfg := config.Default()
+	cfg.SharedIndex.DenyPatterns = []string{"^shared-index$"}
+	proxyHandler, err := New(cfg)
+	if err != nil {
+		t.Fatalf("new proxy: %v", err)
+	}
+	if !proxyHandler.isBlockedSharedIndex("shared-index") {
+		t.Fatal("expected deny patterns to be compiled")
+	}
+
+	cfg.TenantRegex.Pattern = "("
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "tenant_regex.pattern is invalid") {
+		t.Fatalf("expected invalid regex error, got %v", err)
+	}
+}
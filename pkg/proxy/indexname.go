@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkIndexName enforces the index_names policy on an index a tenant creates.
+// The base index must match the configured pattern, and neither it nor the
+// upstream name it renders to may start with a reserved prefix. The rendered
+// name, the tenant alias in shared mode and the tenant index otherwise, may not
+// exceed the length limit, name a denied shared index, be an alias of another
+// tenant, or be the shared index itself.
+func (p *Proxy) checkIndexName(baseIndex, tenantID, targetIndex, aliasName string) error {
+	policy := p.cfg.IndexNames
+	if p.indexNamePattern != nil && !p.indexNamePattern.MatchString(baseIndex) {
+		return withCode(codeInvalidIndexName, fmt.Errorf("index name '%s' does not match the index name pattern", baseIndex))
+	}
+	rendered := targetIndex
+	if aliasName != "" {
+		rendered = aliasName
+	}
+	for _, name := range []string{baseIndex, rendered} {
+		for _, prefix := range policy.ReservedPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				return withCode(codeInvalidIndexName, fmt.Errorf("index name '%s' starts with the reserved prefix '%s'", name, prefix))
+			}
+		}
+	}
+	if policy.MaxLength > 0 && len(rendered) > policy.MaxLength {
+		return withCode(codeInvalidIndexName, fmt.Errorf("index name '%s' exceeds the limit of %d bytes", rendered, policy.MaxLength))
+	}
+	if aliasName != "" && aliasName == targetIndex {
+		return withCode(codeInvalidIndexName, fmt.Errorf("alias '%s' collides with the shared index", aliasName))
+	}
+	if _, denied := p.deniedIndex(rendered); denied {
+		return withCode(codeInvalidIndexName, fmt.Errorf("index name '%s' collides with a shared index", rendered))
+	}
+	if owner, ok := p.tenantIDFromAliasPatterns(rendered); ok && owner != tenantID {
+		return withCode(codeInvalidIndexName, fmt.Errorf("index name '%s' collides with an alias of another tenant", rendered))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestIndexNamePolicy(t *testing.T) {
+	shared := config.Default()
+	shared.SharedIndex.DenyCompiled = []*regexp.Regexp{regexp.MustCompile("^shared-index$"), regexp.MustCompile("^alias-secret")}
+	perTenant := config.Default()
+	perTenant.Mode = "index-per-tenant"
+	perTenant.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	perTenant.IndexNames.MaxLength = 16
+	perTenant.IndexNames.Pattern = "^[a-z_.]+$"
+
+	tests := []struct {
+		name   string
+		cfg    config.Config
+		method string
+		path   string
+		body   string
+		reject bool
+	}{
+		{name: "shared create", cfg: shared, method: http.MethodPut, path: "/orders-tenant1"},
+		{name: "shared reserved prefix", cfg: shared, method: http.MethodPut, path: "/.kibana-tenant1", reject: true},
+		{name: "shared denied alias", cfg: shared, method: http.MethodPut, path: "/secret-tenant1", reject: true},
+		{name: "per-tenant write", cfg: perTenant, method: http.MethodPut, path: "/orders-tenant1/_doc/1", body: `{"total":1}`},
+		{name: "per-tenant reserved prefix", cfg: perTenant, method: http.MethodPut, path: "/.tasks-tenant1/_doc/1", body: `{"total":1}`, reject: true},
+		{name: "per-tenant pattern", cfg: perTenant, method: http.MethodPut, path: "/Orders-tenant1/_doc/1", body: `{"total":1}`, reject: true},
+		{name: "per-tenant length", cfg: perTenant, method: http.MethodPut, path: "/shipments-tenant1/_doc/1", body: `{"total":1}`, reject: true},
+		{name: "per-tenant bulk", cfg: perTenant, method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\".tasks-tenant1\"}}\n{\"total\":1}\n", reject: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, tt.cfg)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if !tt.reject {
+				if rec.Code != http.StatusOK {
+					t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+				}
+				return
+			}
+			var payload struct {
+				Code rejectCode `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+				t.Fatalf("parse response %q: %v", rec.Body.String(), err)
+			}
+			if rec.Code != http.StatusBadRequest || payload.Code != codeInvalidIndexName {
+				t.Fatalf("expected %s, got %d: %s", codeInvalidIndexName, rec.Code, rec.Body.String())
+			}
+			if tt.path != "/_bulk" {
+				if _, _, _, _, count := capture.snapshot(); count != 0 {
+					t.Fatalf("expected no upstream call, got %d", count)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexNamePolicyAliasOfAnotherTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "alias-{{.index}}-{{.tenant}}"
+	proxyHandler, err := New(cfg)
+	if err != nil {
+		t.Fatalf("new proxy: %v", err)
+	}
+	if err := proxyHandler.checkIndexName("orders", "tenant1", "alias-orders-tenant1", ""); err != nil {
+		t.Fatalf("expected the tenant's own alias name to pass, got %v", err)
+	}
+	err = proxyHandler.checkIndexName("orders", "tenant1", "alias-orders-tenant2", "")
+	if codeOf(err, "") != codeInvalidIndexName {
+		t.Fatalf("expected an alias collision, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// indexRenderer renders the upstream name of a tenant's base index, such as
+// renderQueryIndex for reads and renderTargetIndex for writes.
+type indexRenderer func(baseIndex, tenantID string) (string, error)
+
+// indexParamEntry is one index of a root endpoint's index parameter.
+type indexParamEntry struct {
+	cluster   string
+	baseIndex string
+}
+
+// indexParam is the index parameter of a root endpoint, such as
+// /_search?index=orders-tenant1,products-tenant1, resolved to a single tenant.
+type indexParam struct {
+	entries  []indexParamEntry
+	tenantID string
+}
+
+// parseIndexParam resolves the comma-separated index parameter of a root
+// endpoint, and returns nil when it is absent. The indices must belong to one
+// tenant and, in index-per-tenant mode, share a base index, since bodies are
+// rewritten for a single base index. Remote cluster indices are accepted when
+// remote is set.
+func (p *Proxy) parseIndexParam(r *http.Request, remote bool) (*indexParam, error) {
+	value := strings.TrimSpace(r.URL.Query().Get("index"))
+	if value == "" {
+		return nil, nil
+	}
+	param := &indexParam{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, errors.New("index parameter names must not be empty")
+		}
+		var entry indexParamEntry
+		var tenantID string
+		var err error
+		if remote {
+			entry.cluster, entry.baseIndex, tenantID, err = p.parseClusterIndex(r, name)
+		} else {
+			entry.baseIndex, tenantID, err = p.parseIndex(r, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(param.entries) == 0 {
+			param.tenantID = tenantID
+		} else if tenantID != param.tenantID {
+			return nil, withCode(codeMultipleTenants, fmt.Errorf("index parameter contains multiple tenants: %s and %s", param.tenantID, tenantID))
+		} else if entry.baseIndex != param.baseIndex() && !isSharedMode(p.cfg.Mode) {
+			return nil, withCode(codeMultiIndexUnsupported, fmt.Errorf("index parameter indices must share a base index in index-per-tenant mode: %s and %s", param.baseIndex(), entry.baseIndex))
+		}
+		param.entries = append(param.entries, entry)
+	}
+	return param, nil
+}
+
+// baseIndex returns the base index of the first index, which bodies are
+// rewritten for.
+func (param *indexParam) baseIndex() string {
+	return param.entries[0].baseIndex
+}
+
+// cluster returns the remote cluster of the first index.
+func (param *indexParam) cluster() string {
+	return param.entries[0].cluster
+}
+
+// render returns the comma-separated upstream names of the indices, keeping
+// their remote cluster. Indices rendering to the same name are listed once.
+func (param *indexParam) render(render indexRenderer) (string, error) {
+	targets := make([]string, 0, len(param.entries))
+	for _, entry := range param.entries {
+		target, err := render(entry.baseIndex, param.tenantID)
+		if err != nil {
+			return "", err
+		}
+		target = withCluster(entry.cluster, target)
+		if !containsString(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return strings.Join(targets, ","), nil
+}
+
+// rewriteIndexParam replaces the indices of the index parameter with their
+// upstream names from render, and returns them.
+func (p *Proxy) rewriteIndexParam(r *http.Request, param *indexParam, render indexRenderer) (string, error) {
+	targets, err := param.render(render)
+	if err != nil {
+		return "", err
+	}
+	p.setIndexQueryParam(r, targets)
+	return targets, nil
+}
+
+// resolveIndexParam parses and rewrites the index parameter of a root endpoint
+// that requires one, and returns the cluster, base index, and tenant of its
+// first index.
+func (p *Proxy) resolveIndexParam(r *http.Request, remote bool, render indexRenderer) (string, string, string, error) {
+	param, err := p.parseIndexParam(r, remote)
+	if err != nil {
+		return "", "", "", err
+	}
+	if param == nil {
+		return "", "", "", withCode(codeMissingIndex, errors.New("missing index"))
+	}
+	if _, err := p.rewriteIndexParam(r, param, render); err != nil {
+		return "", "", "", err
+	}
+	return param.cluster(), param.baseIndex(), param.tenantID, nil
+}
+
+// takeIndexParam removes the index parameter from r and returns its value, for
+// root endpoints that read it as the default index of their body.
+func takeIndexParam(r *http.Request) string {
+	query := r.URL.Query()
+	value := strings.TrimSpace(query.Get("index"))
+	if value == "" {
+		return ""
+	}
+	query.Del("index")
+	r.URL.RawQuery = query.Encode()
+	r.RequestURI = r.URL.RequestURI()
+	return value
+}
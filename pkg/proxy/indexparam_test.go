@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestRootEndpointsRewriteIndexParam(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		wantPath  string
+		wantQuery string
+		wantBody  string
+	}{
+		{name: "search", method: http.MethodPost, path: "/_search?index=orders-tenant1,products-tenant1", body: `{}`, wantPath: "/_search", wantQuery: "index=alias-orders-tenant1%2Calias-products-tenant1"},
+		{name: "search template", method: http.MethodPost, path: "/_search/template?index=orders-tenant1,products-tenant1", body: `{"id":"t1"}`, wantPath: "/_search/template", wantQuery: "index=alias-orders-tenant1%2Calias-products-tenant1"},
+		{name: "validate query", method: http.MethodPost, path: "/_validate/query?index=orders-tenant1", body: `{"query":{"match_all":{}}}`, wantPath: "/_validate/query", wantQuery: "index=alias-orders-tenant1"},
+		{name: "explain", method: http.MethodPost, path: "/_explain?index=orders-tenant1", body: `{"query":{"match_all":{}}}`, wantPath: "/_explain", wantQuery: "index=alias-orders-tenant1"},
+		{name: "rank eval", method: http.MethodPost, path: "/_rank_eval?index=orders-tenant1,products-tenant1", body: `{"requests":[]}`, wantPath: "/_rank_eval", wantQuery: "index=alias-orders-tenant1%2Calias-products-tenant1"},
+		{name: "analyze", method: http.MethodGet, path: "/_analyze?index=orders-tenant1,products-tenant1", wantPath: "/_analyze", wantQuery: "index=orders%2Cproducts"},
+		{name: "delete by query", method: http.MethodPost, path: "/_delete_by_query?index=orders-tenant1,products-tenant1", body: `{"query":{"match_all":{}}}`, wantPath: "/alias-orders-tenant1,alias-products-tenant1/_delete_by_query"},
+		{name: "msearch", method: http.MethodPost, path: "/_msearch?index=orders-tenant1", body: "{}\n{}\n", wantPath: "/_msearch", wantBody: `{"index":"alias-orders-tenant1"}`},
+		{name: "bulk", method: http.MethodPost, path: "/_bulk?index=orders-tenant1", body: "{\"index\":{\"_id\":\"1\"}}\n{}\n", wantPath: "/_bulk", wantBody: `"_index":"orders"`},
+		{name: "mget", method: http.MethodPost, path: "/_mget?index=orders-tenant1", body: `{"docs":[{"_id":"1"}]}`, wantPath: "/_msearch", wantBody: `{"index":"alias-orders-tenant1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, config.Default())
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if strings.Contains(tt.body, "\n") {
+				req.Header.Set("Content-Type", "application/x-ndjson")
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+			path, query, body, _, _ := capture.snapshot()
+			if path != tt.wantPath {
+				t.Fatalf("expected path %q, got %q", tt.wantPath, path)
+			}
+			if tt.wantQuery != "" && query != tt.wantQuery {
+				t.Fatalf("expected query %q, got %q", tt.wantQuery, query)
+			}
+			if tt.wantQuery == "" && strings.Contains(query, "index=") {
+				t.Fatalf("expected the index parameter removed, got %q", query)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Fatalf("expected body containing %s, got %s", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestRootEndpointsRejectMixedTenantIndexParam(t *testing.T) {
+	for _, path := range []string{"/_search", "/_validate/query", "/_analyze", "/_delete_by_query", "/_update_by_query"} {
+		proxyHandler, capture := newProxyWithServer(t, config.Default())
+		req := httptest.NewRequest(http.MethodPost, path+"?index=orders-tenant1,orders-tenant2", strings.NewReader(`{"query":{"match_all":{}}}`))
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "multiple tenants") {
+			t.Fatalf("%s: expected 400 for mixed tenants, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+		if _, _, _, _, count := capture.snapshot(); count != 0 {
+			t.Fatalf("%s: expected request to stay off the upstream", path)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// setIndexResponse records the index a request named and the index it was
+// routed to, so that a response keyed by index name can be reported under the
+// name the client used.
+func (p *Proxy) setIndexResponse(r *http.Request, baseIndex, tenantID, index, target string) {
+	p.setResponseKind(r, responseKindIndexKeyed, baseIndex, tenantID)
+	if state := requestStateFrom(r); state != nil {
+		state.index = index
+		state.target = target
+	}
+}
+
+// rekeyIndexResponse re-keys the responses of _settings, _mapping, _stats,
+// _segments, _recovery, and the like from the shared or per-tenant index to
+// the index the client named, at the top level or under "indices". Settings
+// report the named index as their provided_name and mappings are shown the way
+// the tenant submitted them (see tenantMapping).
+func (p *Proxy) rekeyIndexResponse(payload map[string]interface{}, state *requestState) bool {
+	changed := rekeyIndex(payload, state.target, state.index)
+	if indices, ok := payload["indices"].(map[string]interface{}); ok {
+		changed = rekeyIndex(indices, state.target, state.index) || changed
+	}
+	entry, ok := payload[state.index].(map[string]interface{})
+	if !ok {
+		return changed
+	}
+	settings, _ := entry["settings"].(map[string]interface{})
+	if indexSettings, ok := settings["index"].(map[string]interface{}); ok {
+		if name, ok := indexSettings["provided_name"].(string); ok && name != state.index {
+			indexSettings["provided_name"] = state.index
+			changed = true
+		}
+	}
+	if mappings, ok := entry["mappings"].(map[string]interface{}); ok {
+		changed = p.tenantMapping(mappings, state.baseIndex) || changed
+	}
+	return changed
+}
+
+// tenantMapping undoes what the proxy adds to a tenant's mapping. In
+// index-per-tenant mode with wrapped sources the fields lose the base index
+// object they are nested under, completion context paths and the field names
+// of _mapping/field lose the base index prefix; in shared mode the tenant
+// field is dropped.
+func (p *Proxy) tenantMapping(mappings map[string]interface{}, baseIndex string) bool {
+	switch {
+	case p.wrapSource():
+		changed := unwrapProperties(mappings, baseIndex)
+		if props, ok := mappings["properties"].(map[string]interface{}); ok {
+			changed = unprefixContextPaths(props, baseIndex) || changed
+		}
+		return unprefixFieldMappings(mappings, baseIndex) || changed
+	case isSharedMode(p.cfg.Mode):
+		field := p.tenantField(baseIndex)
+		changed := false
+		if props, ok := mappings["properties"].(map[string]interface{}); ok {
+			if _, ok := props[field]; ok {
+				delete(props, field)
+				changed = true
+			}
+		}
+		if entry, ok := mappings[field].(map[string]interface{}); ok {
+			if _, ok := entry["full_name"]; ok {
+				delete(mappings, field)
+				changed = true
+			}
+		}
+		return changed
+	}
+	return false
+}
+
+func rekeyIndex(section map[string]interface{}, target, index string) bool {
+	value, ok := section[target]
+	if !ok || target == index {
+		return false
+	}
+	delete(section, target)
+	section[index] = value
+	return true
+}
+
+// unwrapProperties undoes wrapProperties on a mapping, lifting the fields
+// nested under the base index back to the top level next to the fields that
+// are kept there.
+func unwrapProperties(mappings map[string]interface{}, baseIndex string) bool {
+	props, ok := mappings["properties"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	wrapper, ok := props[baseIndex].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	inner, ok := wrapper["properties"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	unwrapped := make(map[string]interface{}, len(props)-1+len(inner))
+	for name, value := range props {
+		if name != baseIndex {
+			unwrapped[name] = value
+		}
+	}
+	for name, value := range inner {
+		unwrapped[name] = value
+	}
+	mappings["properties"] = unwrapped
+	return true
+}
+
+// unprefixContextPaths undoes prefixContextPaths on the unwrapped properties.
+func unprefixContextPaths(props map[string]interface{}, baseIndex string) bool {
+	changed := false
+	for _, value := range props {
+		field, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if contexts, ok := field["contexts"].([]interface{}); ok && field["type"] == "completion" {
+			for _, item := range contexts {
+				context, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if path, ok := context["path"].(string); ok && strings.HasPrefix(path, baseIndex+".") {
+					context["path"] = strings.TrimPrefix(path, baseIndex+".")
+					changed = true
+				}
+			}
+		}
+		for _, key := range []string{"properties", "fields"} {
+			if nested, ok := field[key].(map[string]interface{}); ok {
+				changed = unprefixContextPaths(nested, baseIndex) || changed
+			}
+		}
+	}
+	return changed
+}
+
+// unprefixFieldMappings strips the base index prefix from the entries of a
+// _mapping/field response, which are keyed by full field name.
+func unprefixFieldMappings(mappings map[string]interface{}, baseIndex string) bool {
+	prefix := baseIndex + "."
+	changed := false
+	for name, value := range mappings {
+		entry, ok := value.(map[string]interface{})
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		fullName, ok := entry["full_name"].(string)
+		if !ok {
+			continue
+		}
+		entry["full_name"] = strings.TrimPrefix(fullName, prefix)
+		delete(mappings, name)
+		mappings[strings.TrimPrefix(name, prefix)] = entry
+		changed = true
+	}
+	return changed
+}
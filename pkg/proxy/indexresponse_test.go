@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestIndexResponsesKeyedByNamedIndex(t *testing.T) {
+	shared := config.Default()
+	shared.SharedIndex.Name = "shared-{{.index}}"
+	perTenant := config.Default()
+	perTenant.Mode = "index-per-tenant"
+	perTenant.IndexPerTenant.IndexTemplate = "{{.tenant}}_{{.index}}"
+
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		path     string
+		upstream string
+		want     string
+	}{
+		{
+			name:     "shared settings",
+			cfg:      shared,
+			path:     "/products-tenant1/_settings",
+			upstream: `{"shared-products":{"settings":{"index":{"number_of_shards":"1","provided_name":"shared-products"}}}}`,
+			want:     `{"products-tenant1":{"settings":{"index":{"number_of_shards":"1","provided_name":"products-tenant1"}}}}`,
+		},
+		{
+			name:     "shared stats",
+			cfg:      shared,
+			path:     "/products-tenant1/_stats",
+			upstream: `{"_shards":{"total":1},"_all":{"primaries":{}},"indices":{"shared-products":{"uuid":"x","primaries":{}}}}`,
+			want:     `{"_shards":{"total":1},"_all":{"primaries":{}},"indices":{"products-tenant1":{"uuid":"x","primaries":{}}}}`,
+		},
+		{
+			name:     "per-tenant mapping",
+			cfg:      perTenant,
+			path:     "/products-tenant1/_mapping",
+			upstream: `{"tenant1_products":{"mappings":{"properties":{"@timestamp":{"type":"date"},"products":{"properties":{"name":{"type":"text"}}}}}}}`,
+			want:     `{"products-tenant1":{"mappings":{"properties":{"@timestamp":{"type":"date"},"name":{"type":"text"}}}}}`,
+		},
+		{
+			name:     "shared mapping without tenant field",
+			cfg:      shared,
+			path:     "/products-tenant1/_mapping",
+			upstream: `{"shared-products":{"mappings":{"properties":{"name":{"type":"text"},"tenant_id":{"type":"keyword"}}}}}`,
+			want:     `{"products-tenant1":{"mappings":{"properties":{"name":{"type":"text"}}}}}`,
+		},
+		{
+			name:     "per-tenant completion context path",
+			cfg:      perTenant,
+			path:     "/products-tenant1/_mapping",
+			upstream: `{"tenant1_products":{"mappings":{"properties":{"products":{"properties":{"suggest":{"type":"completion","contexts":[{"name":"cat","type":"category","path":"products.category"}]}}}}}}}`,
+			want:     `{"products-tenant1":{"mappings":{"properties":{"suggest":{"type":"completion","contexts":[{"name":"cat","type":"category","path":"category"}]}}}}}`,
+		},
+		{
+			name:     "per-tenant field mapping",
+			cfg:      perTenant,
+			path:     "/products-tenant1/_mapping/field/name",
+			upstream: `{"tenant1_products":{"mappings":{"products.name":{"full_name":"products.name","mapping":{"name":{"type":"text"}}}}}}`,
+			want:     `{"products-tenant1":{"mappings":{"name":{"full_name":"name","mapping":{"name":{"type":"text"}}}}}}`,
+		},
+		{
+			name:     "per-tenant segments",
+			cfg:      perTenant,
+			path:     "/products-tenant1/_segments",
+			upstream: `{"_shards":{"total":1},"indices":{"tenant1_products":{"shards":{}}}}`,
+			want:     `{"_shards":{"total":1},"indices":{"products-tenant1":{"shards":{}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler := newProxyWithUpstream(t, tt.cfg, jsonUpstream(http.StatusOK, tt.upstream))
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("parse response %q: %v", rec.Body.String(), err)
+			}
+			_ = json.Unmarshal([]byte(tt.want), &want)
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Fatalf("expected %s, got %s", wantJSON, gotJSON)
+			}
+		})
+	}
+}
+
+func TestGetFieldMappingPrefixesFields(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.tenant}}_{{.index}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	req := httptest.NewRequest(http.MethodGet, "/products-tenant1/_mapping/field/name,price", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, _, _, _ := capture.snapshot()
+	if path != "/tenant1_products/_mapping/field/products.name,products.price" {
+		t.Fatalf("unexpected upstream path %q", path)
+	}
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// noPipeline is the pipeline id that disables a default pipeline.
+const noPipeline = "_none"
+
+// handleIngestPipeline serves /_ingest/pipeline. Pipeline ids follow the tenant
+// regex like index names and are rendered from the pipeline template; listings
+// are filtered to the tenant identified the same way as for _cat requests.
+func (p *Proxy) handleIngestPipeline(w http.ResponseWriter, r *http.Request, segments []string) {
+	if len(segments) < 2 || segments[1] != "pipeline" {
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "unsupported ingest endpoint")
+		return
+	}
+	if len(segments) == 2 {
+		if r.Method != http.MethodGet {
+			p.rejectMethod(w, "unsupported method for ingest pipelines", http.MethodGet)
+			return
+		}
+		tenantID := p.catTenant(r)
+		if tenantID == "" {
+			p.reject(w, codeTenantRequired, "listing ingest pipelines requires a tenant")
+			return
+		}
+		p.setResponseKind(r, responseKindPipelines, "", tenantID)
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	if segments[2] == "_simulate" || len(segments) > 4 || (len(segments) == 4 && segments[3] != "_simulate") {
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "unsupported ingest endpoint")
+		return
+	}
+	pipeline, tenantID, err := p.renderPipeline(r, segments[2], "")
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Method == http.MethodPut && len(segments) == 3 {
+		if r.Body == nil {
+			p.reject(w, codeMissingBody, "missing body")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		var payload interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			p.reject(w, codeInvalidJSON, "invalid JSON body")
+			return
+		}
+		if err := p.rewritePipelineProcessors(r, payload, tenantID); err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		body, err = json.Marshal(payload)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+	p.setPathSegments(r, append([]string{segments[0], segments[1], pipeline}, segments[3:]...))
+	p.logRequestVerbose(r, "pipeline rewrite: %s -> %s", segments[2], pipeline)
+	p.proxy.ServeHTTP(w, r)
+}
+
+// renderPipeline resolves a pipeline id with the tenant regex and renders the
+// id stored upstream. When tenantID is set the pipeline must belong to that
+// tenant. The _none pipeline is returned unchanged.
+func (p *Proxy) renderPipeline(r *http.Request, name, tenantID string) (string, string, error) {
+	if name == noPipeline {
+		return name, tenantID, nil
+	}
+	if strings.ContainsAny(name, "*?,") {
+		return "", "", fmt.Errorf("pipeline id patterns are not supported: %s", name)
+	}
+	baseName, nameTenant, err := p.parseIndex(r, name)
+	if err != nil {
+		return "", "", err
+	}
+	if tenantID != "" && nameTenant != tenantID {
+		return "", "", withCode(codeTenantMismatch, fmt.Errorf("pipeline %s belongs to a different tenant", name))
+	}
+	pipeline, err := p.renderIndex(p.pipelineTmpl, baseName, nameTenant)
+	if err != nil {
+		return "", "", err
+	}
+	return pipeline, nameTenant, nil
+}
+
+// rewritePipelineProcessors namespaces the pipelines called by pipeline
+// processors, including those nested in on_failure and foreach processors.
+func (p *Proxy) rewritePipelineProcessors(r *http.Request, value interface{}, tenantID string) error {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, val := range typed {
+			if processor, ok := val.(map[string]interface{}); ok && key == "pipeline" {
+				if name, ok := processor["name"].(string); ok {
+					rendered, _, err := p.renderPipeline(r, name, tenantID)
+					if err != nil {
+						return err
+					}
+					processor["name"] = rendered
+				}
+			}
+			if err := p.rewritePipelineProcessors(r, val, tenantID); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range typed {
+			if err := p.rewritePipelineProcessors(r, item, tenantID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rewritePipelineParam namespaces the pipeline query parameter of an indexing
+// request. An empty tenantID accepts the pipeline's own tenant, which is
+// returned so the caller can check it against the documents.
+func (p *Proxy) rewritePipelineParam(r *http.Request, tenantID string) (string, error) {
+	query := r.URL.Query()
+	name := query.Get("pipeline")
+	if name == "" {
+		return "", nil
+	}
+	pipeline, pipelineTenant, err := p.renderPipeline(r, name, tenantID)
+	if err != nil {
+		return "", err
+	}
+	setQueryParam(r, query, "pipeline", pipeline)
+	return pipelineTenant, nil
+}
+
+// filterTenantNames drops the entries of other tenants, and those not rendered
+// from the template pattern, from a policy or pipeline listing.
+func filterTenantNames(payload map[string]interface{}, pattern *regexp.Regexp, tenantID string) bool {
+	changed := false
+	for name := range payload {
+		if pattern != nil {
+			if matches := pattern.FindStringSubmatch(name); matches != nil && matches[pattern.SubexpIndex("tenant")] == tenantID {
+				continue
+			}
+		}
+		delete(payload, name)
+		changed = true
+	}
+	return changed
+}
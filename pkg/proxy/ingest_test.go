@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestIngestPipelineNamespaced(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"processors":[{"set":{"field":"a","value":1}},{"pipeline":{"name":"common-tenant1"}},{"pipeline":{"name":"_none"}}],"on_failure":[{"pipeline":{"name":"errors-tenant1"}}]}`
+	req := httptest.NewRequest(http.MethodPut, "/_ingest/pipeline/enrich-tenant1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, _, _ := capture.snapshot()
+	if path != "/_ingest/pipeline/tenant1-enrich" {
+		t.Fatalf("expected namespaced pipeline path, got %s", path)
+	}
+	for _, want := range []string{`{"pipeline":{"name":"tenant1-common"}}`, `{"pipeline":{"name":"_none"}}`, `{"pipeline":{"name":"tenant1-errors"}}`} {
+		if !strings.Contains(string(captured), want) {
+			t.Fatalf("expected %s in body, got %s", want, captured)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/_ingest/pipeline/enrich-tenant1/_simulate", strings.NewReader(`{"docs":[]}`))
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if path, _, _, _, _ := capture.snapshot(); path != "/_ingest/pipeline/tenant1-enrich/_simulate" {
+		t.Fatalf("expected namespaced simulate path, got %s", path)
+	}
+}
+
+func TestIngestPipelineRejected(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		wantErr string
+		status  int
+	}{
+		{name: "cross tenant processor", method: http.MethodPut, path: "/_ingest/pipeline/enrich-tenant1", body: `{"processors":[{"pipeline":{"name":"common-tenant2"}}]}`, wantErr: "belongs to a different tenant"},
+		{name: "pattern", method: http.MethodGet, path: "/_ingest/pipeline/enrich-*", wantErr: "patterns are not supported"},
+		{name: "list without tenant", method: http.MethodGet, path: "/_ingest/pipeline", wantErr: "requires a tenant"},
+		{name: "root simulate", method: http.MethodPost, path: "/_ingest/pipeline/_simulate", body: `{}`, wantErr: "unsupported ingest endpoint", status: http.StatusNotFound},
+		{name: "other endpoint", method: http.MethodGet, path: "/_ingest/geoip/stats", wantErr: "unsupported ingest endpoint", status: http.StatusNotFound},
+		{name: "cross tenant doc pipeline", method: http.MethodPut, path: "/orders-tenant1/_doc/1?pipeline=enrich-tenant2", body: `{"a":1}`, wantErr: "belongs to a different tenant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			status := tt.status
+			if status == 0 {
+				status = http.StatusBadRequest
+			}
+			if rec.Code != status || !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Fatalf("expected rejection containing %q, got %d: %s", tt.wantErr, rec.Code, rec.Body.String())
+			}
+		})
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+}
+
+func TestIngestPipelineListFilteredToTenant(t *testing.T) {
+	upstream := jsonUpstream(http.StatusOK, `{"tenant1-enrich":{"processors":[]},"tenant2-enrich":{"processors":[]},"xpack_monitoring_7":{"processors":[]}}`)
+	proxyHandler := newProxyWithUpstream(t, config.Default(), upstream)
+
+	req := httptest.NewRequest(http.MethodGet, "/_ingest/pipeline", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Body.String() != `{"tenant1-enrich":{"processors":[]}}` {
+		t.Fatalf("expected only tenant1 pipelines, got %s", rec.Body.String())
+	}
+}
+
+func TestPipelineParamRewritten(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		wantQuery string
+		wantBody  string
+	}{
+		{name: "doc", path: "/orders-tenant1/_doc/1?pipeline=enrich-tenant1", body: `{"a":1}`, wantQuery: "pipeline=tenant1-enrich&"},
+		{name: "none", path: "/orders-tenant1/_doc/1?pipeline=_none", body: `{"a":1}`, wantQuery: "pipeline=_none&"},
+		{name: "bulk", path: "/_bulk?pipeline=enrich-tenant1", body: "{\"index\":{\"_index\":\"orders-tenant1\"}}\n{\"a\":1}\n", wantQuery: "pipeline=tenant1-enrich&"},
+		{name: "bulk action", path: "/_bulk", body: "{\"index\":{\"_index\":\"orders-tenant1\",\"pipeline\":\"enrich-tenant1\"}}\n{\"a\":1}\n", wantBody: `"pipeline":"tenant1-enrich"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body))
+			if strings.Contains(tt.path, "_bulk") {
+				req.Method = http.MethodPost
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			_, query, captured, _, _ := capture.snapshot()
+			if !strings.Contains(query, tt.wantQuery) {
+				t.Fatalf("expected query containing %q, got %q", tt.wantQuery, query)
+			}
+			if !strings.Contains(string(captured), tt.wantBody) {
+				t.Fatalf("expected %s in body, got %s", tt.wantBody, captured)
+			}
+		})
+	}
+}
+
+func TestBulkRejectsPipelineOfOtherTenant(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	// The mismatch is reported for the first action, before the invalid line
+	// that follows is read.
+	bulkPayload := "{\"index\":{\"_index\":\"orders-tenant1\"}}\n{\"a\":1}\nnot json\n"
+	req := httptest.NewRequest(http.MethodPost, "/_bulk?pipeline=enrich-tenant2", strings.NewReader(bulkPayload))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "bulk operation 1: pipeline enrich-tenant2 belongs to a different tenant") {
+		t.Fatalf("expected pipeline tenant rejection, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected request to stay off the upstream, got %d calls", count)
+	}
+}
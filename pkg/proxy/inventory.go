@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// tenantInventory describes a tenant found on the upstream cluster. In shared
+// mode Indices lists the shared indices behind the tenant's Aliases and the
+// storage size is not reported, since tenants share the index storage.
+type tenantInventory struct {
+	Tenant         string   `json:"tenant"`
+	Indices        []string `json:"indices"`
+	Aliases        []string `json:"aliases,omitempty"`
+	DocsCount      int64    `json:"docs_count"`
+	StoreSizeBytes int64    `json:"store_size_bytes,omitempty"`
+}
+
+// handleTenants lists the tenants derived from the upstream indices (index per
+// tenant mode) or tenant aliases (shared mode) of every upstream cluster,
+// optionally limited to the tenant given by the tenant query parameter.
+func (p *Proxy) handleTenants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for tenants")
+		return
+	}
+	filter := strings.TrimSpace(r.URL.Query().Get("tenant"))
+	upstreams := p.inventoryUpstreams()
+	if filter != "" {
+		upstreams = []*upstreamClient{p.upstreamFor(filter)}
+	}
+	var list []*tenantInventory
+	for _, upstream := range upstreams {
+		var tenants map[string]*tenantInventory
+		var err error
+		if isSharedMode(p.cfg.Mode) {
+			tenants, err = p.sharedTenantInventory(r.Context(), upstream, filter)
+		} else {
+			tenants, err = p.perTenantInventory(r.Context(), upstream, filter)
+		}
+		if err != nil {
+			log.Printf("tenants: list: %v", err)
+			writeJSONError(w, http.StatusBadGateway, "upstream_error", err.Error())
+			return
+		}
+		for _, tenant := range tenants {
+			sort.Strings(tenant.Indices)
+			sort.Strings(tenant.Aliases)
+			list = append(list, tenant)
+		}
+	}
+	if list == nil {
+		list = []*tenantInventory{}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Tenant < list[j].Tenant })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tenants": list})
+}
+
+// inventoryUpstreams returns the client of upstream_url and those of
+// upstreams.
+func (p *Proxy) inventoryUpstreams() []*upstreamClient {
+	upstreams := []*upstreamClient{p.upstream}
+	for _, upstream := range p.upstreams {
+		upstreams = append(upstreams, upstream)
+	}
+	return upstreams
+}
+
+// perTenantInventory reads the document count and storage size of every index
+// on upstream rendered from the per-tenant index template. Indices of tenants
+// routed to another cluster are skipped.
+func (p *Proxy) perTenantInventory(ctx context.Context, upstream *upstreamClient, filter string) (map[string]*tenantInventory, error) {
+	var stats struct {
+		Indices map[string]struct {
+			Primaries struct {
+				Docs struct {
+					Count int64 `json:"count"`
+				} `json:"docs"`
+			} `json:"primaries"`
+			Total struct {
+				Store struct {
+					SizeInBytes int64 `json:"size_in_bytes"`
+				} `json:"store"`
+			} `json:"total"`
+		} `json:"indices"`
+	}
+	if err := upstreamJSON(ctx, upstream, "/_stats/docs,store", &stats); err != nil {
+		return nil, err
+	}
+	pattern := templatePattern(p.cfg.IndexPerTenant.IndexTemplate)
+	tenants := make(map[string]*tenantInventory)
+	for index, indexStats := range stats.Indices {
+		if strings.HasPrefix(index, ".") {
+			continue
+		}
+		tenantID, ok := tenantFromPattern(pattern, index)
+		if !ok {
+			tenantID, ok = p.tenantIDForIndex(index)
+		}
+		if !ok || (filter != "" && tenantID != filter) || p.upstreamFor(tenantID) != upstream {
+			continue
+		}
+		tenant := inventoryEntry(tenants, tenantID)
+		tenant.Indices = append(tenant.Indices, index)
+		tenant.DocsCount += indexStats.Primaries.Docs.Count
+		tenant.StoreSizeBytes += indexStats.Total.Store.SizeInBytes
+	}
+	return tenants, nil
+}
+
+// sharedTenantInventory finds the tenant aliases of the shared indices on
+// upstream and counts the documents visible through each of them. Aliases of
+// tenants routed to another cluster are skipped.
+func (p *Proxy) sharedTenantInventory(ctx context.Context, upstream *upstreamClient, filter string) (map[string]*tenantInventory, error) {
+	var aliases map[string]struct {
+		Aliases map[string]json.RawMessage `json:"aliases"`
+	}
+	if err := upstreamJSON(ctx, upstream, "/_alias", &aliases); err != nil {
+		return nil, err
+	}
+	tenants := make(map[string]*tenantInventory)
+	for index, entry := range aliases {
+		if strings.HasPrefix(index, ".") {
+			continue
+		}
+		for alias := range entry.Aliases {
+			tenantID, ok := p.tenantIDForAlias(alias)
+			if !ok || (filter != "" && tenantID != filter) || p.upstreamFor(tenantID) != upstream {
+				continue
+			}
+			var count struct {
+				Count int64 `json:"count"`
+			}
+			if err := upstreamJSON(ctx, upstream, "/"+url.PathEscape(alias)+"/_count", &count); err != nil {
+				return nil, err
+			}
+			tenant := inventoryEntry(tenants, tenantID)
+			if !containsString(tenant.Indices, index) {
+				tenant.Indices = append(tenant.Indices, index)
+			}
+			tenant.Aliases = append(tenant.Aliases, alias)
+			tenant.DocsCount += count.Count
+		}
+	}
+	return tenants, nil
+}
+
+func inventoryEntry(tenants map[string]*tenantInventory, tenantID string) *tenantInventory {
+	tenant, ok := tenants[tenantID]
+	if !ok {
+		tenant = &tenantInventory{Tenant: tenantID, Indices: []string{}}
+		tenants[tenantID] = tenant
+	}
+	return tenant
+}
+
+func tenantFromPattern(pattern *regexp.Regexp, name string) (string, bool) {
+	if pattern == nil {
+		return "", false
+	}
+	matches := pattern.FindStringSubmatch(name)
+	if matches == nil {
+		return "", false
+	}
+	tenantID := matches[pattern.SubexpIndex("tenant")]
+	return tenantID, tenantID != ""
+}
+
+// upstreamJSON issues a GET to the upstream cluster and decodes the JSON
+// response into target.
+func upstreamJSON(ctx context.Context, upstream *upstreamClient, pathValue string, target interface{}) error {
+	resp, err := upstream.do(ctx, nil, http.MethodGet, pathValue, nil)
+	if err != nil {
+		return fmt.Errorf("get %s: %w", pathValue, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("get %s: %w", pathValue, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s: unexpected status %d: %s", pathValue, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("get %s: %w", pathValue, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestTenantInventory(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/_stats/docs,store":
+			_, _ = io.WriteString(w, `{"indices":{
+				"orders-tenant1":{"primaries":{"docs":{"count":3}},"total":{"store":{"size_in_bytes":100}}},
+				"products-tenant1":{"primaries":{"docs":{"count":2}},"total":{"store":{"size_in_bytes":50}}},
+				"orders-tenant2":{"primaries":{"docs":{"count":7}},"total":{"store":{"size_in_bytes":300}}},
+				".kibana":{"primaries":{"docs":{"count":1}},"total":{"store":{"size_in_bytes":10}}},
+				"metrics":{"primaries":{"docs":{"count":1}},"total":{"store":{"size_in_bytes":10}}}}}`)
+		case "/_alias":
+			_, _ = io.WriteString(w, `{"shared-index":{"aliases":{"alias-orders-tenant1":{},"alias-products-tenant1":{},"alias-orders-tenant2":{}}},"metrics":{"aliases":{}}}`)
+		case "/alias-orders-tenant1/_count", "/alias-products-tenant1/_count":
+			_, _ = io.WriteString(w, `{"count":4}`)
+		case "/alias-orders-tenant2/_count":
+			_, _ = io.WriteString(w, `{"count":1}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	perTenant := config.Default()
+	perTenant.Mode = "index-per-tenant"
+	perTenant.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	shared := config.Default()
+	shared.SharedIndex.Name = "shared-index"
+
+	tests := []struct {
+		name  string
+		cfg   config.Config
+		query string
+		want  []tenantInventory
+	}{
+		{
+			name: "index per tenant",
+			cfg:  perTenant,
+			want: []tenantInventory{
+				{Tenant: "tenant1", Indices: []string{"orders-tenant1", "products-tenant1"}, DocsCount: 5, StoreSizeBytes: 150},
+				{Tenant: "tenant2", Indices: []string{"orders-tenant2"}, DocsCount: 7, StoreSizeBytes: 300},
+			},
+		},
+		{
+			name: "shared",
+			cfg:  shared,
+			want: []tenantInventory{
+				{Tenant: "tenant1", Indices: []string{"shared-index"}, Aliases: []string{"alias-orders-tenant1", "alias-products-tenant1"}, DocsCount: 8},
+				{Tenant: "tenant2", Indices: []string{"shared-index"}, Aliases: []string{"alias-orders-tenant2"}, DocsCount: 1},
+			},
+		},
+		{
+			name:  "filtered",
+			cfg:   perTenant,
+			query: "?tenant=tenant2",
+			want: []tenantInventory{
+				{Tenant: "tenant2", Indices: []string{"orders-tenant2"}, DocsCount: 7, StoreSizeBytes: 300},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := newProxyWithUpstream(t, tt.cfg, upstream).AdminHandler()
+			rec := httptest.NewRecorder()
+			admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/tenants"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+			var payload struct {
+				Tenants []tenantInventory `json:"tenants"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+				t.Fatalf("parse response: %v", err)
+			}
+			if !reflect.DeepEqual(payload.Tenants, tt.want) {
+				t.Fatalf("expected %+v, got %+v", tt.want, payload.Tenants)
+			}
+		})
+	}
+}
+
+func TestTenantInventoryAcrossUpstreams(t *testing.T) {
+	stats := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, body)
+		})
+	}
+	eu := httptest.NewServer(stats(`{"indices":{
+		"orders-tenant2":{"primaries":{"docs":{"count":7}},"total":{"store":{"size_in_bytes":300}}},
+		"orders-tenant1":{"primaries":{"docs":{"count":9}},"total":{"store":{"size_in_bytes":900}}}}}`))
+	t.Cleanup(eu.Close)
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	cfg.Upstreams = []config.Upstream{{Name: "eu", URL: eu.URL}}
+	cfg.Tenants = map[string]config.TenantSettings{"tenant2": {Upstream: "eu"}}
+	admin := newProxyWithUpstream(t, cfg, stats(`{"indices":{
+		"orders-tenant1":{"primaries":{"docs":{"count":3}},"total":{"store":{"size_in_bytes":100}}},
+		"orders-tenant2":{"primaries":{"docs":{"count":1}},"total":{"store":{"size_in_bytes":10}}}}}`)).AdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/tenants", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	var payload struct {
+		Tenants []tenantInventory `json:"tenants"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	want := []tenantInventory{
+		{Tenant: "tenant1", Indices: []string{"orders-tenant1"}, DocsCount: 3, StoreSizeBytes: 100},
+		{Tenant: "tenant2", Indices: []string{"orders-tenant2"}, DocsCount: 7, StoreSizeBytes: 300},
+	}
+	if !reflect.DeepEqual(payload.Tenants, want) {
+		t.Fatalf("expected each tenant counted on its own upstream, got %+v", payload.Tenants)
+	}
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// handleLifecyclePolicy serves the _ilm and _slm policy endpoints when policy
+// namespacing is enabled. Policy names follow the tenant regex like index names
+// and are rendered from the policy template; listings are filtered to the tenant
+// identified the same way as for _cat requests.
+func (p *Proxy) handleLifecyclePolicy(w http.ResponseWriter, r *http.Request, segments []string) {
+	if len(segments) < 2 || segments[1] != "policy" {
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "unsupported lifecycle endpoint")
+		return
+	}
+	if len(segments) == 2 {
+		if r.Method != http.MethodGet {
+			p.rejectMethod(w, "unsupported method for lifecycle policies", http.MethodGet)
+			return
+		}
+		tenantID := p.catTenant(r)
+		if tenantID == "" {
+			p.reject(w, codeTenantRequired, "listing lifecycle policies requires a tenant")
+			return
+		}
+		p.setResponseKind(r, responseKindPolicies, "", tenantID)
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	slm := segments[0] == "_slm"
+	switch {
+	case len(segments) == 3:
+	case len(segments) == 4 && slm && segments[3] == "_execute":
+	default:
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "unsupported lifecycle endpoint")
+		return
+	}
+	baseName, tenantID, err := p.parsePolicyName(r, segments[2], "")
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	policy, err := p.renderIndex(p.policyTmpl, baseName, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Method == http.MethodPut || (r.Method == http.MethodPost && len(segments) == 3) {
+		if r.Body == nil {
+			p.reject(w, codeMissingBody, "missing body")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		if slm {
+			body, err = p.rewriteSLMPolicyBody(r, body, tenantID)
+		} else {
+			body, err = p.rewriteILMPolicyBody(r, body, tenantID)
+		}
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+	rewritten := append([]string{segments[0], segments[1], policy}, segments[3:]...)
+	p.setPathSegments(r, rewritten)
+	p.logRequestVerbose(r, "policy rewrite: %s -> %s", segments[2], policy)
+	p.proxy.ServeHTTP(w, r)
+}
+
+// parsePolicyName resolves a policy name with the tenant regex. When tenantID
+// is set the policy must belong to that tenant.
+func (p *Proxy) parsePolicyName(r *http.Request, name, tenantID string) (string, string, error) {
+	if strings.ContainsAny(name, "*?,") {
+		return "", "", fmt.Errorf("policy name patterns are not supported: %s", name)
+	}
+	baseName, nameTenant, err := p.parseIndex(r, name)
+	if err != nil {
+		return "", "", err
+	}
+	if tenantID != "" && nameTenant != tenantID {
+		return "", "", withCode(codeTenantMismatch, fmt.Errorf("policy %s belongs to a different tenant", name))
+	}
+	return baseName, nameTenant, nil
+}
+
+// rewriteILMPolicyBody namespaces the SLM policies referenced by
+// wait_for_snapshot actions.
+func (p *Proxy) rewriteILMPolicyBody(r *http.Request, body []byte, tenantID string) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	policy, _ := payload["policy"].(map[string]interface{})
+	phases, _ := policy["phases"].(map[string]interface{})
+	for _, value := range phases {
+		phase, _ := value.(map[string]interface{})
+		actions, _ := phase["actions"].(map[string]interface{})
+		wait, ok := actions["wait_for_snapshot"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := wait["policy"].(string)
+		baseName, _, err := p.parsePolicyName(r, name, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		wait["policy"], err = p.renderIndex(p.policyTmpl, baseName, tenantID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(payload)
+}
+
+// rewriteSLMPolicyBody rewrites the indices a snapshot policy covers to the
+// tenant's indices. A policy must list its indices, since the default covers
+// every index. Shared mode is rejected as snapshots of the shared index would
+// include other tenants' documents.
+func (p *Proxy) rewriteSLMPolicyBody(r *http.Request, body []byte, tenantID string) ([]byte, error) {
+	if isSharedMode(p.cfg.Mode) {
+		return nil, errors.New("SLM policies are not supported in shared mode")
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	slmConfig, _ := payload["config"].(map[string]interface{})
+	value, ok := slmConfig["indices"]
+	if !ok {
+		return nil, errors.New("SLM policies must list their indices")
+	}
+	names, err := aliasActionNames(value)
+	if err != nil {
+		return nil, errors.New("SLM policy indices must be strings")
+	}
+	indices := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		for _, index := range strings.Split(name, ",") {
+			if strings.ContainsAny(index, "*?") {
+				return nil, fmt.Errorf("SLM policy index patterns are not supported: %s", index)
+			}
+			baseIndex, indexTenant, err := p.parseIndex(r, strings.TrimSpace(index))
+			if err != nil {
+				return nil, err
+			}
+			if indexTenant != tenantID {
+				return nil, withCode(codeTenantMismatch, fmt.Errorf("index %s belongs to a different tenant", index))
+			}
+			target, err := p.renderTargetIndex(baseIndex, tenantID)
+			if err != nil {
+				return nil, err
+			}
+			indices = append(indices, target)
+		}
+	}
+	slmConfig["indices"] = indices
+	return json.Marshal(payload)
+}
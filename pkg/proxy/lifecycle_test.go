@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func newLifecycleTestConfig(mode string) config.Config {
+	cfg := config.Default()
+	cfg.Mode = mode
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	cfg.Lifecycle.NamespacePolicies = true
+	return cfg
+}
+
+func TestILMPolicyNamespaced(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, newLifecycleTestConfig("shared"))
+
+	body := `{"policy":{"phases":{"delete":{"min_age":"30d","actions":{"wait_for_snapshot":{"policy":"nightly-tenant1"},"delete":{}}}}}}`
+	req := httptest.NewRequest(http.MethodPut, "/_ilm/policy/logs-tenant1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, _, _ := capture.snapshot()
+	if path != "/_ilm/policy/tenant1-logs" {
+		t.Fatalf("expected namespaced policy path, got %s", path)
+	}
+	if !strings.Contains(string(captured), `"wait_for_snapshot":{"policy":"tenant1-nightly"}`) {
+		t.Fatalf("expected namespaced snapshot policy, got %s", captured)
+	}
+}
+
+func TestILMPolicyRejected(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, newLifecycleTestConfig("shared"))
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		wantErr string
+		status  int
+	}{
+		{name: "cross tenant snapshot policy", method: http.MethodPut, path: "/_ilm/policy/logs-tenant1", body: `{"policy":{"phases":{"delete":{"actions":{"wait_for_snapshot":{"policy":"nightly-tenant2"}}}}}}`, wantErr: "belongs to a different tenant"},
+		{name: "pattern", method: http.MethodGet, path: "/_ilm/policy/logs-*", wantErr: "patterns are not supported"},
+		{name: "list without tenant", method: http.MethodGet, path: "/_ilm/policy", wantErr: "requires a tenant"},
+		{name: "other endpoint", method: http.MethodPost, path: "/_ilm/stop", wantErr: "unsupported lifecycle endpoint", status: http.StatusNotFound},
+		{name: "slm shared mode", method: http.MethodPut, path: "/_slm/policy/nightly-tenant1", body: `{"config":{"indices":["logs-tenant1"]}}`, wantErr: "not supported in shared mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			status := tt.status
+			if status == 0 {
+				status = http.StatusBadRequest
+			}
+			if rec.Code != status || !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Fatalf("expected rejection containing %q, got %d: %s", tt.wantErr, rec.Code, rec.Body.String())
+			}
+		})
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+}
+
+func TestILMPolicyListFilteredToTenant(t *testing.T) {
+	upstream := jsonUpstream(http.StatusOK, `{"tenant1-logs":{"version":1},"tenant2-logs":{"version":1},"7-days-default":{"version":1}}`)
+	proxyHandler := newProxyWithUpstream(t, newLifecycleTestConfig("shared"), upstream)
+
+	req := httptest.NewRequest(http.MethodGet, "/_ilm/policy", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Body.String() != `{"tenant1-logs":{"version":1}}` {
+		t.Fatalf("expected only tenant1 policies, got %s", rec.Body.String())
+	}
+}
+
+func TestSLMPolicyIndexPerTenant(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, newLifecycleTestConfig("index-per-tenant"))
+
+	body := `{"schedule":"0 30 1 * * ?","name":"<nightly-{now/d}>","repository":"backups","config":{"indices":["logs-tenant1","orders-tenant1"]}}`
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/_slm/policy/nightly-tenant1", strings.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, _, _ := capture.snapshot()
+	if path != "/_slm/policy/tenant1-nightly" {
+		t.Fatalf("expected namespaced policy path, got %s", path)
+	}
+	if !strings.Contains(string(captured), `"indices":["logs-tenant1","orders-tenant1"]`) {
+		t.Fatalf("expected tenant indices, got %s", captured)
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_slm/policy/nightly-tenant1/_execute", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if path, _, _, _, _ := capture.snapshot(); path != "/_slm/policy/tenant1-nightly/_execute" {
+		t.Fatalf("expected namespaced execute path, got %s", path)
+	}
+
+	for _, body := range []string{`{"config":{}}`, `{"config":{"indices":["logs-tenant2"]}}`, `{"config":{"indices":"logs-*"}}`} {
+		rec = httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/_slm/policy/nightly-tenant1", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestLifecyclePassthroughWithoutNamespacing(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_ilm/stop", nil))
+
+	if rec.Header().Get(responseModeHeader) != responseModePassthrough {
+		t.Fatalf("expected passthrough, got %q", rec.Header().Get(responseModeHeader))
+	}
+	if path, _, _, _, _ := capture.snapshot(); path != "/_ilm/stop" {
+		t.Fatalf("expected /_ilm/stop, got %s", path)
+	}
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// bodyLimit returns the maximum request body size for the path, or zero when
+// the body is not limited.
+func (p *Proxy) bodyLimit(segments []string) int64 {
+	if isBulkPath(segments) {
+		return p.cfg.Limits.MaxBulkBodyBytes
+	}
+	return p.cfg.Limits.MaxBodyBytes
+}
+
+func isBulkPath(segments []string) bool {
+	return (len(segments) == 1 && segments[0] == "_bulk") ||
+		(len(segments) == 2 && segments[1] == "_bulk")
+}
+
+// enforceBodyLimit answers oversized requests with a 413 and reports whether the
+// request may continue. Other bodies without a declared length are buffered up
+// to the limit so the check happens before anything reaches the upstream
+// cluster.
+func (p *Proxy) enforceBodyLimit(w http.ResponseWriter, r *http.Request, segments []string) bool {
+	limit := p.bodyLimit(segments)
+	if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	if r.ContentLength > limit {
+		p.setResponseMode(w, responseModeHandled)
+		p.rejectTooLarge(w, limit)
+		return false
+	}
+	if r.ContentLength >= 0 {
+		return true
+	}
+	if isBulkPath(segments) {
+		// Bulk bodies are spooled rather than buffered, so the limit is checked
+		// as handleBulk reads them, still before anything is sent upstream.
+		r.Body = &limitedBody{ReadCloser: r.Body, limit: limit}
+		return true
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		p.setResponseMode(w, responseModeHandled)
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return false
+	}
+	if int64(len(body)) > limit {
+		p.setResponseMode(w, responseModeHandled)
+		p.rejectTooLarge(w, limit)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return true
+}
+
+func (p *Proxy) rejectTooLarge(w http.ResponseWriter, limit int64) {
+	p.writeError(w, http.StatusRequestEntityTooLarge, "request_entity_too_large", codeBodyTooLarge, (&bodyTooLargeError{limit: limit}).Error())
+}
+
+type bodyTooLargeError struct {
+	limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body exceeds the limit of %d bytes", e.limit)
+}
+
+// limitedBody fails reads once more than limit bytes have been read.
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(data []byte) (int, error) {
+	n, err := b.ReadCloser.Read(data)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return n, &bodyTooLargeError{limit: b.limit}
+	}
+	return n, err
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestBodyLimitRejectsOversizedRequests(t *testing.T) {
+	cfg := config.Default()
+	cfg.Limits.MaxBodyBytes = 16
+	cfg.Limits.MaxBulkBodyBytes = 64
+	bulk := "{\"index\":{\"_index\":\"orders-tenant1\"}}\n{\"a\":1}\n"
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{name: "search within limit", path: "/orders-tenant1/_search", body: `{"size":1}`, status: http.StatusOK},
+		{name: "search over limit", path: "/orders-tenant1/_search", body: `{"query":{"match_all":{}}}`, status: http.StatusRequestEntityTooLarge},
+		{name: "chunked search over limit", path: "/orders-tenant1/_search", body: `{"query":{"match_all":{}}}`, chunked: true, status: http.StatusRequestEntityTooLarge},
+		{name: "bulk uses bulk limit", path: "/_bulk", body: bulk, status: http.StatusOK},
+		{name: "bulk over limit", path: "/orders-tenant1/_bulk", body: bulk + bulk, status: http.StatusRequestEntityTooLarge},
+		{name: "chunked bulk over limit", path: "/_bulk", body: bulk + bulk, chunked: true, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, cfg)
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path, body)
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			_, _, _, _, count := capture.snapshot()
+			if tt.status == http.StatusRequestEntityTooLarge {
+				if count != 0 {
+					t.Fatalf("expected no upstream call, got %d", count)
+				}
+				var payload map[string]string
+				if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+					t.Fatalf("parse response: %v", err)
+				}
+				if payload["error"] != "request_entity_too_large" {
+					t.Fatalf("unexpected error payload: %v", payload)
+				}
+			} else if count != 1 {
+				t.Fatalf("expected one upstream call, got %d", count)
+			}
+		})
+	}
+}
+
+func TestBodyLimitDisabled(t *testing.T) {
+	cfg := config.Default()
+	cfg.Limits.MaxBodyBytes = 0
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search", strings.NewReader(`{"query":{"match_all":{}}}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+}
+
+func TestMultiSearchLineLimits(t *testing.T) {
+	cfg := config.Default()
+	cfg.Limits.MaxMultiSearchLineBytes = 64
+	cfg.Limits.MaxMultiSearchLines = 4
+	search := "{\"index\":\"orders-tenant1\"}\n{\"size\":1}\n"
+
+	tests := []struct {
+		name string
+		body string
+		code rejectCode
+	}{
+		{name: "within limits", body: search + search},
+		{name: "line over limit", body: "{\"index\":\"orders-tenant1\"}\n{\"query\":{\"match\":{\"title\":\"" + strings.Repeat("a", 64) + "\"}}}\n", code: codeLineTooLarge},
+		{name: "too many lines", body: search + search + search, code: codeTooManyLines},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, cfg)
+			req := httptest.NewRequest(http.MethodPost, "/_msearch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-ndjson")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if tt.code == "" {
+				if rec.Code != http.StatusOK {
+					t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+				}
+				if _, _, body, _, _ := capture.snapshot(); strings.Count(string(body), "\n") != 4 {
+					t.Fatalf("expected four forwarded lines, got %q", body)
+				}
+				return
+			}
+			var payload struct {
+				Code rejectCode `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+				t.Fatalf("parse response %q: %v", rec.Body.String(), err)
+			}
+			if rec.Code != http.StatusBadRequest || payload.Code != tt.code {
+				t.Fatalf("expected %s, got %d: %s", tt.code, rec.Code, rec.Body.String())
+			}
+			if _, _, _, _, count := capture.snapshot(); count != 0 {
+				t.Fatalf("expected no upstream call, got %d", count)
+			}
+		})
+	}
+}
+
+func TestReadMultiSearchLineStopsAtLimit(t *testing.T) {
+	src := strings.NewReader(strings.Repeat("a", 1<<20) + "\n")
+	line, _, err := readMultiSearchLine(bufio.NewReaderSize(src, 16), nil, 64, 1)
+	if codeOf(err, "") != codeLineTooLarge || line != nil {
+		t.Fatalf("expected a line size error, got %q: %v", line, err)
+	}
+	if consumed := src.Size() - int64(src.Len()); consumed > 128 {
+		t.Fatalf("expected the line to be read no further than the limit, read %d bytes", consumed)
+	}
+}
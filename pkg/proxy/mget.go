@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// mgetDoc is a document requested by a root _mget, looked up by the search
+// at index search of the msearch the request is translated into.
+type mgetDoc struct {
+	index     string
+	baseIndex string
+	id        string
+	search    int
+}
+
+// mgetSearch is the ids search of one index named by a root _mget.
+type mgetSearch struct {
+	target    string
+	baseIndex string
+	ids       []string
+}
+
+// handleRootMget serves POST /_mget, whose docs may name several indices of one
+// tenant. It is translated into an msearch with an ids search per index, and
+// the responses are merged back into the mget format in request order.
+func (p *Proxy) handleRootMget(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	entries, err := extractRootMgetDocs(body, takeIndexParam(r))
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	var tenantID string
+	var searches []*mgetSearch
+	searchByIndex := make(map[string]int)
+	docs := make([]mgetDoc, 0, len(entries))
+	for _, entry := range entries {
+		search, ok := searchByIndex[entry.index]
+		if !ok {
+			baseIndex, entryTenant, err := p.parseIndex(r, entry.index)
+			if err != nil {
+				p.rejectError(w, err)
+				return
+			}
+			if tenantID == "" {
+				tenantID = entryTenant
+			} else if tenantID != entryTenant {
+				p.reject(w, codeMultipleTenants, fmt.Sprintf("mget request contains multiple tenants: %s and %s", tenantID, entryTenant))
+				return
+			}
+			target, err := p.renderQueryIndex(baseIndex, entryTenant)
+			if err != nil {
+				p.rejectError(w, err)
+				return
+			}
+			search = len(searches)
+			searchByIndex[entry.index] = search
+			searches = append(searches, &mgetSearch{target: target, baseIndex: baseIndex})
+		}
+		searches[search].ids = append(searches[search].ids, entry.id)
+		docs = append(docs, mgetDoc{index: entry.index, baseIndex: searches[search].baseIndex, id: entry.id, search: search})
+	}
+	var msearch bytes.Buffer
+	for _, search := range searches {
+		header := map[string]interface{}{"index": search.target}
+		if p.routeByTenant() {
+			header["routing"] = tenantID
+		}
+		headerLine, err := json.Marshal(header)
+		if err != nil {
+			p.reject(w, codeInvalidRequest, "failed to build query")
+			return
+		}
+		query, err := buildVersionedIDsQuery(search.ids)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		query, err = p.rewriteTenantQueryBody(r, query, search.baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		msearch.Write(headerLine)
+		msearch.WriteByte('\n')
+		msearch.Write(query)
+		msearch.WriteByte('\n')
+	}
+	deleteQueryParams(r, getOnlyQueryParams...)
+	r.Body = io.NopCloser(bytes.NewReader(msearch.Bytes()))
+	r.ContentLength = int64(msearch.Len())
+	r.Method = http.MethodPost
+	setBodyContentType(r, mediaTypeNDJSON)
+	p.setPathSegments(r, []string{"_msearch"})
+	p.setResponseKind(r, responseKindRootMget, "", tenantID)
+	if state := requestStateFrom(r); state != nil {
+		state.mgetDocs = docs
+	}
+	p.setUsage(r, tenantID, tenantUsage{})
+	p.proxy.ServeHTTP(w, r)
+}
+
+// extractRootMgetDocs returns the index and id of every entry of a root _mget
+// body. Entries without an index use defaultIndex, the index parameter.
+func extractRootMgetDocs(body []byte, defaultIndex string) ([]mgetDoc, error) {
+	var payload struct {
+		IDs  json.RawMessage          `json:"ids"`
+		Docs []map[string]interface{} `json:"docs"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	if payload.IDs != nil {
+		return nil, errors.New("mget ids require an index in the path")
+	}
+	if len(payload.Docs) == 0 {
+		return nil, errors.New("mget body requires docs")
+	}
+	docs := make([]mgetDoc, 0, len(payload.Docs))
+	for _, entry := range payload.Docs {
+		index, ok := entry["_index"].(string)
+		if _, set := entry["_index"]; !set && defaultIndex != "" {
+			index, ok = defaultIndex, true
+		}
+		if !ok || index == "" {
+			return nil, errors.New("mget docs entries must include _index")
+		}
+		id, ok := entry["_id"].(string)
+		if !ok || id == "" {
+			return nil, errors.New("mget docs entries must include _id")
+		}
+		docs = append(docs, mgetDoc{index: index, id: id})
+	}
+	return docs, nil
+}
+
+// msearchToMgetResponse merges the responses of the msearch a root _mget was
+// translated into. Documents of a failed search carry its error.
+func (p *Proxy) msearchToMgetResponse(payload map[string]interface{}, state *requestState) map[string]interface{} {
+	responses, _ := payload["responses"].([]interface{})
+	hits := make(map[int]map[string]map[string]interface{})
+	docs := make([]interface{}, 0, len(state.mgetDocs))
+	for _, doc := range state.mgetDocs {
+		var response map[string]interface{}
+		if doc.search < len(responses) {
+			response, _ = responses[doc.search].(map[string]interface{})
+		}
+		if errValue, ok := response["error"]; ok {
+			docs = append(docs, map[string]interface{}{"_index": doc.index, "_id": doc.id, "error": errValue})
+			continue
+		}
+		hitsByID, ok := hits[doc.search]
+		if !ok {
+			hitsByID = searchHitsByID(response)
+			hits[doc.search] = hitsByID
+		}
+		docs = append(docs, p.getResponseFromHit(hitsByID[doc.id], doc.index, doc.baseIndex, doc.id))
+	}
+	return map[string]interface{}{"docs": docs}
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestRootMget(t *testing.T) {
+	var mu sync.Mutex
+	var upstreamPath, upstreamBody, upstreamType string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		upstreamPath, upstreamBody, upstreamType = r.URL.Path, string(body), r.Header.Get("Content-Type")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"took":1,"responses":[
+			{"hits":{"hits":[{"_index":"orders","_id":"2","_version":3,"_seq_no":5,"_primary_term":1,"_source":{"orders":{"total":10}}},{"_index":"orders","_id":"1","_version":1,"_source":{"orders":{"total":5}}}]},"status":200},
+			{"error":{"type":"index_not_found_exception","reason":"no such index [users-tenant1]"},"status":404}
+		]}`))
+	})
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	body := `{"docs":[{"_index":"orders-tenant1","_id":"1"},{"_index":"users-tenant1","_id":"7"},{"_index":"orders-tenant1","_id":"2"},{"_index":"orders-tenant1","_id":"9"}]}`
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_mget?realtime=true", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	mu.Lock()
+	if upstreamPath != "/_msearch" || upstreamType != "application/x-ndjson" {
+		t.Fatalf("expected msearch upstream, got %s (%s)", upstreamPath, upstreamType)
+	}
+	lines := strings.Split(strings.TrimSuffix(upstreamBody, "\n"), "\n")
+	mu.Unlock()
+	if len(lines) != 4 || lines[0] != `{"index":"orders-tenant1"}` || lines[2] != `{"index":"users-tenant1"}` {
+		t.Fatalf("unexpected msearch body: %q", lines)
+	}
+	if !strings.Contains(lines[1], `"values":["1","2","9"]`) || !strings.Contains(lines[3], `"values":["7"]`) {
+		t.Fatalf("expected ids grouped by index, got %q", lines)
+	}
+
+	var payload struct {
+		Docs []map[string]interface{} `json:"docs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(payload.Docs) != 4 {
+		t.Fatalf("expected 4 docs, got %s", rec.Body.String())
+	}
+	want := []struct {
+		index string
+		id    string
+		found interface{}
+	}{
+		{"orders-tenant1", "1", true},
+		{"users-tenant1", "7", nil},
+		{"orders-tenant1", "2", true},
+		{"orders-tenant1", "9", false},
+	}
+	for i, doc := range payload.Docs {
+		if doc["_index"] != want[i].index || doc["_id"] != want[i].id || doc["found"] != want[i].found {
+			t.Fatalf("doc %d: unexpected %v", i, doc)
+		}
+	}
+	if source, _ := payload.Docs[2]["_source"].(map[string]interface{}); source["total"] != float64(10) || payload.Docs[2]["_seq_no"] != float64(5) {
+		t.Fatalf("expected unwrapped source and metadata, got %v", payload.Docs[2])
+	}
+	if payload.Docs[1]["error"] == nil {
+		t.Fatalf("expected search error on missing index doc, got %v", payload.Docs[1])
+	}
+}
+
+func TestRootMgetErrors(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, config.Default())
+	cases := []struct {
+		body    string
+		wantErr string
+	}{
+		{body: `{"ids":["1"]}`, wantErr: "mget ids require an index in the path"},
+		{body: `{"docs":[]}`, wantErr: "mget body requires docs"},
+		{body: `{"docs":[{"_id":"1"}]}`, wantErr: "mget docs entries must include _index"},
+		{body: `{"docs":[{"_index":"orders-tenant1"}]}`, wantErr: "mget docs entries must include _id"},
+		{body: `{"docs":[{"_index":"orders-tenant1","_id":"1"},{"_index":"orders-tenant2","_id":"1"}]}`, wantErr: "mget request contains multiple tenants"},
+		{body: `{"docs":[{"_index":"nodashes","_id":"1"}]}`, wantErr: "does not match tenant regex"},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_mget", strings.NewReader(tc.body)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tc.wantErr) {
+			t.Fatalf("%s: expected %q, got %d: %s", tc.body, tc.wantErr, rec.Code, rec.Body.String())
+		}
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream requests, got %d", count)
+	}
+}
+
+func TestRootMgetSharedMode(t *testing.T) {
+	cfg := config.Default()
+	cfg.SharedIndex.EnforceFilter = true
+	cfg.SharedIndex.RouteByTenant = true
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"docs":[{"_index":"orders-tenant1","_id":"1"},{"_index":"users-tenant1","_id":"2"}]}`
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_mget", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	_, _, captured, _, _ := capture.snapshot()
+	lines := strings.Split(strings.TrimSuffix(string(captured), "\n"), "\n")
+	if len(lines) != 4 || lines[0] != `{"index":"alias-orders-tenant1","routing":"tenant1"}` || lines[2] != `{"index":"alias-users-tenant1","routing":"tenant1"}` {
+		t.Fatalf("unexpected msearch headers: %q", lines)
+	}
+	if !strings.Contains(lines[1], `"tenant_id":"tenant1"`) {
+		t.Fatalf("expected tenant filter on ids search, got %s", lines[1])
+	}
+}
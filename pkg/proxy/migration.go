@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// migrationCompareBytes bounds how much of a primary write response is kept to
+// compare it with the secondary one.
+const migrationCompareBytes = 64 << 10
+
+// migration dual-writes the tenants moving between modes. Their requests are
+// served by primary, and their writes are repeated on secondary, a copy of the
+// proxy in the other mode that records no audit events, usage, slow queries,
+// or cached responses.
+type migration struct {
+	tenants   map[string]bool
+	primary   *Proxy
+	secondary *Proxy
+}
+
+func (p *Proxy) newMigration() *migration {
+	mode := strings.ToLower(strings.TrimSpace(p.cfg.Mode))
+	primaryMode := strings.ToLower(strings.TrimSpace(p.cfg.Migration.Primary))
+	if primaryMode == "" {
+		primaryMode = mode
+	}
+	secondaryMode := "shared"
+	if isSharedMode(primaryMode) {
+		secondaryMode = "index-per-tenant"
+	}
+	m := &migration{tenants: make(map[string]bool), primary: p}
+	for _, tenantID := range p.cfg.Migration.Tenants {
+		m.tenants[strings.TrimSpace(tenantID)] = true
+	}
+	if primaryMode != mode {
+		m.primary = p.modeClone(primaryMode)
+	}
+	secondary := p.modeClone(secondaryMode)
+	secondary.audit = nil
+	secondary.usage = nil
+	secondary.slowLog = nil
+	secondary.cache = nil
+	secondary.hooks = Hooks{}
+	m.secondary = secondary
+	return m
+}
+
+// serveMigrating serves a request of a migrating tenant and reports whether it
+// did. Reads are served in the primary mode; writes in the primary mode and
+// then in the secondary one, logging responses that diverge. Root bulk
+// requests name their tenant in the body, so it is read from the first action.
+func (p *Proxy) serveMigrating(w http.ResponseWriter, r *http.Request, segments []string, tenantID string) bool {
+	m := p.migration
+	write := isWriteRequest(r, segments)
+	var body []byte
+	if write && tenantID == "" && isBulkPath(segments) && r.Body != nil {
+		var ok bool
+		if body, ok = p.readMigrationBody(w, r); !ok {
+			return true
+		}
+		tenantID = p.bulkTenant(r, body)
+	}
+	if !m.tenants[tenantID] {
+		return false
+	}
+	if !write {
+		if m.primary == p {
+			return false
+		}
+		m.primary.dispatch(w, r, segments)
+		return true
+	}
+	if body == nil && r.Body != nil {
+		var ok bool
+		if body, ok = p.readMigrationBody(w, r); !ok {
+			return true
+		}
+	}
+	mirror := withRequestState(r.Clone(r.Context()))
+	if state := requestStateFrom(mirror); state != nil {
+		state.requestID = requestIDFrom(r)
+	}
+	if r.Body != nil {
+		mirror.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	primary := &migrationWriter{ResponseWriter: w}
+	m.primary.dispatch(primary, r, segments)
+	secondary := httptest.NewRecorder()
+	m.secondary.dispatch(secondary, mirror, segments)
+	primaryOutcome := migrationOutcome(primary.status, primary.body.Bytes())
+	secondaryOutcome := migrationOutcome(secondary.Code, secondary.Body.Bytes())
+	if primaryOutcome != secondaryOutcome {
+		log.Printf("migration: divergence: request_id=%s tenant=%s method=%s path=%s %s=%q %s=%q",
+			requestIDFrom(r), tenantID, r.Method, r.URL.Path,
+			m.primary.cfg.Mode, primaryOutcome, m.secondary.cfg.Mode, secondaryOutcome)
+	}
+	return true
+}
+
+// readMigrationBody buffers the body of r, which is replayed in both modes,
+// and reports whether it could be read.
+func (p *Proxy) readMigrationBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.setResponseMode(w, responseModeHandled)
+		var tooLarge *bodyTooLargeError
+		if errors.As(err, &tooLarge) {
+			p.rejectTooLarge(w, tooLarge.limit)
+			return nil, false
+		}
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// bulkTenant returns the tenant of the first action of a bulk body, or an
+// empty string when it names none.
+func (p *Proxy) bulkTenant(r *http.Request, body []byte) string {
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var action map[string]struct {
+			Index string `json:"_index"`
+		}
+		if json.Unmarshal(line, &action) != nil {
+			return ""
+		}
+		for _, meta := range action {
+			if meta.Index == "" {
+				return ""
+			}
+			_, tenantID, err := p.parseIndex(r, meta.Index)
+			if err != nil {
+				return ""
+			}
+			return tenantID
+		}
+		return ""
+	}
+	return ""
+}
+
+// migrationOutcome summarizes a write response for comparison across modes:
+// its status and, for JSON bodies, the result of a document write or the
+// errors flag of a bulk request.
+func migrationOutcome(status int, body []byte) string {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	outcome := fmt.Sprintf("status=%d", status)
+	var summary struct {
+		Result string `json:"result"`
+		Errors *bool  `json:"errors"`
+	}
+	if json.Unmarshal(body, &summary) != nil {
+		return outcome
+	}
+	if summary.Result != "" {
+		outcome += " result=" + summary.Result
+	}
+	if summary.Errors != nil {
+		outcome += fmt.Sprintf(" errors=%t", *summary.Errors)
+	}
+	return outcome
+}
+
+// migrationWriter records the status and the start of the body of the primary
+// response of a dual write while it is written to the client.
+type migrationWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *migrationWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *migrationWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if remaining := migrationCompareBytes - w.body.Len(); remaining > 0 {
+		w.body.Write(b[:min(len(b), remaining)])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *migrationWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *migrationWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
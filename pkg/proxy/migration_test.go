@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+type migrationUpstream struct {
+	mu    sync.Mutex
+	calls []capturedCall
+}
+
+func (u *migrationUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	u.mu.Lock()
+	u.calls = append(u.calls, capturedCall{method: r.Method, path: r.URL.Path, body: body})
+	u.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_bulk"):
+		_, _ = io.WriteString(w, `{"errors":false,"items":[]}`)
+	case r.URL.Path == "/orders/_doc/1":
+		_, _ = io.WriteString(w, `{"_index":"orders","result":"updated"}`)
+	default:
+		_, _ = io.WriteString(w, `{"_index":"orders-tenant1","result":"created"}`)
+	}
+}
+
+func (u *migrationUpstream) paths() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	paths := make([]string, 0, len(u.calls))
+	for _, call := range u.calls {
+		paths = append(paths, call.method+" "+call.path)
+	}
+	return paths
+}
+
+func newMigrationProxy(t *testing.T) (*Proxy, *migrationUpstream) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	cfg.Migration.Tenants = []string{"tenant1"}
+	cfg.Migration.Primary = "index-per-tenant"
+	upstream := &migrationUpstream{}
+	return newProxyWithUpstream(t, cfg, upstream), upstream
+}
+
+func TestMigrationDualWritesMigratingTenants(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   []string
+	}{
+		{name: "document write", method: http.MethodPut, path: "/orders-tenant1/_doc/1", body: `{"title":"a"}`, want: []string{"PUT /orders-tenant1/_doc/1", "PUT /orders/_doc/1"}},
+		{name: "root bulk", method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"orders-tenant1\",\"_id\":\"1\"}}\n{}\n", want: []string{"POST /_bulk", "POST /_bulk"}},
+		{name: "read in primary mode", method: http.MethodPost, path: "/orders-tenant1/_search", body: `{}`, want: []string{"POST /orders-tenant1/_search"}},
+		{name: "other tenant", method: http.MethodPut, path: "/orders-tenant2/_doc/1", body: `{}`, want: []string{"PUT /orders/_doc/1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, upstream := newMigrationProxy(t)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if strings.Contains(tt.body, "\n") {
+				req.Header.Set("Content-Type", "application/x-ndjson")
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+			if got := upstream.paths(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected upstream calls %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMigrationBulkRewritesBothModes(t *testing.T) {
+	proxyHandler, upstream := newMigrationProxy(t)
+	req := httptest.NewRequest(http.MethodPost, "/_bulk", strings.NewReader("{\"index\":{\"_index\":\"orders-tenant1\",\"_id\":\"1\"}}\n{\"title\":\"a\"}\n"))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	upstream.mu.Lock()
+	defer upstream.mu.Unlock()
+	if len(upstream.calls) != 2 {
+		t.Fatalf("expected two bulk requests, got %d", len(upstream.calls))
+	}
+	if !bytes.Contains(upstream.calls[0].body, []byte(`"_index":"orders-tenant1"`)) || !bytes.Contains(upstream.calls[1].body, []byte(`"tenant_id":"tenant1"`)) {
+		t.Fatalf("unexpected bulk bodies %s and %s", upstream.calls[0].body, upstream.calls[1].body)
+	}
+}
+
+func TestMigrationLogsDivergence(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	proxyHandler, _ := newMigrationProxy(t)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/orders-tenant1/_doc/1", strings.NewReader(`{}`)))
+	if !strings.Contains(rec.Body.String(), `"result":"created"`) {
+		t.Fatalf("expected the primary response, got %s", rec.Body.String())
+	}
+	if !strings.Contains(logs.String(), `migration: divergence`) || !strings.Contains(logs.String(), `shared="status=200 result=updated"`) {
+		t.Fatalf("expected a divergence log line, got %s", logs.String())
+	}
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var errModeOverrideDenied = withCode(codeModeOverrideDenied, errors.New("mode override requires a valid token"))
+
+// newModeOverrides returns a copy of p for each mode other than the configured
+// one, which requests select with the mode_override header.
+func (p *Proxy) newModeOverrides() map[string]*Proxy {
+	overrides := make(map[string]*Proxy)
+	for _, mode := range []string{"shared", "index-per-tenant"} {
+		if strings.EqualFold(strings.TrimSpace(p.cfg.Mode), mode) {
+			continue
+		}
+		overrides[mode] = p.modeClone(mode)
+	}
+	return overrides
+}
+
+// modeClone returns a copy of p serving requests in mode. The copy shares the
+// upstream, caches, trackers, and sinks of p.
+func (p *Proxy) modeClone(mode string) *Proxy {
+	clone := *p
+	clone.cfg.Mode = mode
+	clone.modeOverrides = nil
+	clone.migration = nil
+	clone.systemRoutes = clone.newSystemRoutes()
+	clone.indexRoutes = clone.newIndexRoutes()
+	clone.proxy = clone.newReverseProxy(p.upstream.base)
+	clone.proxy.Transport = p.proxy.Transport
+	return &clone
+}
+
+// modeTarget returns the proxy serving r in the mode its mode_override header
+// asks for, or p without one. The override headers are removed so they never
+// reach the upstream.
+func (p *Proxy) modeTarget(r *http.Request) (*Proxy, error) {
+	if !p.cfg.ModeOverride.Enabled || p.modeOverrides == nil {
+		return p, nil
+	}
+	settings := p.cfg.ModeOverride
+	mode := strings.ToLower(strings.TrimSpace(r.Header.Get(settings.Header)))
+	token := r.Header.Get(settings.TokenHeader)
+	r.Header.Del(settings.Header)
+	if settings.Token != "" {
+		r.Header.Del(settings.TokenHeader)
+	}
+	if mode == "" || strings.EqualFold(strings.TrimSpace(p.cfg.Mode), mode) {
+		return p, nil
+	}
+	if settings.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(settings.Token)) != 1 {
+		return nil, errModeOverrideDenied
+	}
+	target, ok := p.modeOverrides[mode]
+	if !ok {
+		return nil, fmt.Errorf("mode override must be \"shared\" or \"index-per-tenant\" (got %q)", mode)
+	}
+	p.logRequestVerbose(r, "mode override: %s", mode)
+	return target, nil
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+type headerCapture struct {
+	mu     sync.Mutex
+	path   string
+	header http.Header
+}
+
+func (c *headerCapture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, r.Body)
+	c.mu.Lock()
+	c.path = r.URL.Path
+	c.header = r.Header.Clone()
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = io.WriteString(w, `{}`)
+}
+
+func TestModeOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		mode     string
+		token    string
+		status   int
+		wantPath string
+		wantCode rejectCode
+	}{
+		{name: "configured mode", enabled: true, status: http.StatusOK, wantPath: "/alias-orders-tenant1/_search"},
+		{name: "override", enabled: true, mode: "index-per-tenant", token: "canary", status: http.StatusOK, wantPath: "/orders-tenant1/_search"},
+		{name: "override disabled", mode: "index-per-tenant", token: "canary", status: http.StatusOK, wantPath: "/alias-orders-tenant1/_search"},
+		{name: "wrong token", enabled: true, mode: "index-per-tenant", token: "guess", status: http.StatusForbidden, wantCode: codeModeOverrideDenied},
+		{name: "unknown mode", enabled: true, mode: "hybrid", token: "canary", status: http.StatusBadRequest, wantCode: codeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+			cfg.ModeOverride.Enabled = tt.enabled
+			cfg.ModeOverride.Token = "canary"
+			upstream := &headerCapture{}
+			proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+			req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search", strings.NewReader(`{"query":{"match_all":{}}}`))
+			if tt.mode != "" {
+				req.Header.Set(cfg.ModeOverride.Header, tt.mode)
+				req.Header.Set(cfg.ModeOverride.TokenHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.wantCode != "" && !strings.Contains(rec.Body.String(), string(tt.wantCode)) {
+				t.Fatalf("expected code %s, got %s", tt.wantCode, rec.Body.String())
+			}
+			upstream.mu.Lock()
+			defer upstream.mu.Unlock()
+			if upstream.path != tt.wantPath {
+				t.Fatalf("expected upstream path %q, got %q", tt.wantPath, upstream.path)
+			}
+			if tt.enabled && upstream.header != nil && (upstream.header.Get(cfg.ModeOverride.Header) != "" || upstream.header.Get(cfg.ModeOverride.TokenHeader) != "") {
+				t.Fatalf("expected override headers removed, got %v", upstream.header)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"es-tmnt/pkg/config"
+)
+
+// networkPolicy is the compiled network_policy configuration.
+type networkPolicy struct {
+	tenants map[string][]netip.Prefix
+}
+
+func newNetworkPolicy(cfg config.NetworkPolicy) (*networkPolicy, error) {
+	policy := &networkPolicy{tenants: make(map[string][]netip.Prefix, len(cfg.Tenants))}
+	for tenantID, ranges := range cfg.Tenants {
+		prefixes, err := parsePrefixes(ranges)
+		if err != nil {
+			return nil, fmt.Errorf("network policy of tenant %s: %w", tenantID, err)
+		}
+		policy.tenants[strings.TrimSpace(tenantID)] = prefixes
+	}
+	return policy, nil
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		prefix, err := config.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNetwork rejects a tenant confined to networks the client of r is not
+// in.
+func (p *Proxy) checkNetwork(r *http.Request, tenantID string) error {
+	state := requestStateFrom(r)
+	if state == nil || p.network == nil {
+		return nil
+	}
+	allowed, ok := p.network.tenants[tenantID]
+	if !ok {
+		return nil
+	}
+	if !state.clientAddr.IsValid() || !containsAddr(allowed, state.clientAddr) {
+		return withCode(codeNetworkDenied, fmt.Errorf("tenant '%s' may not be accessed from %s", tenantID, clientAddrString(state.clientAddr)))
+	}
+	return nil
+}
+
+func clientAddrString(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return "an unknown address"
+	}
+	return addr.String()
+}
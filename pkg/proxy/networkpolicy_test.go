@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestNetworkPolicy(t *testing.T) {
+	cfg := config.Default()
+	cfg.NetworkPolicy = config.NetworkPolicy{
+		Tenants: map[string][]string{"tenant1": {"198.51.100.0/24", "2001:db8::/32"}},
+	}
+	cfg.TrustedProxies = []string{"10.0.0.0/8"}
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name       string
+		path       string
+		remote     string
+		forwarded  string
+		wantStatus int
+	}{
+		{name: "allowed range", path: "/orders-tenant1/_search", remote: "198.51.100.20:4000", wantStatus: http.StatusOK},
+		{name: "allowed ipv6", path: "/orders-tenant1/_search", remote: "[2001:db8::1]:4000", wantStatus: http.StatusOK},
+		{name: "other range", path: "/orders-tenant1/_search", remote: "203.0.113.7:4000", wantStatus: http.StatusForbidden},
+		{name: "forwarded by trusted proxy", path: "/orders-tenant1/_search", remote: "10.0.0.5:4000", forwarded: "198.51.100.20", wantStatus: http.StatusOK},
+		{name: "spoofed forwarded", path: "/orders-tenant1/_search", remote: "203.0.113.7:4000", forwarded: "198.51.100.20", wantStatus: http.StatusForbidden},
+		{name: "unconfined tenant", path: "/orders-tenant2/_search", remote: "203.0.113.7:4000", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, _, before := capture.snapshot()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusForbidden {
+				return
+			}
+			if !strings.Contains(rec.Body.String(), string(codeNetworkDenied)) {
+				t.Fatalf("expected %s, got %s", codeNetworkDenied, rec.Body.String())
+			}
+			if _, _, _, _, after := capture.snapshot(); after != before {
+				t.Fatalf("expected rejected request not to reach the upstream")
+			}
+		})
+	}
+}
+
+func TestTenantSettingsOverrideNetworks(t *testing.T) {
+	cfg := config.Default()
+	cfg.NetworkPolicy = config.NetworkPolicy{
+		Tenants: map[string][]string{"tenant1": {"198.51.100.0/24"}},
+	}
+	cfg.Tenants = map[string]config.TenantSettings{
+		"tenant1": {Networks: []string{"203.0.113.0/24"}},
+		"tenant2": {Networks: []string{"198.51.100.0/24"}},
+	}
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name       string
+		path       string
+		remote     string
+		wantStatus int
+	}{
+		{name: "override replaces policy range", path: "/orders-tenant1/_search", remote: "198.51.100.20:4000", wantStatus: http.StatusForbidden},
+		{name: "override range", path: "/orders-tenant1/_search", remote: "203.0.113.7:4000", wantStatus: http.StatusOK},
+		{name: "override confines tenant", path: "/orders-tenant2/_search", remote: "203.0.113.7:4000", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remote
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusForbidden && !strings.Contains(rec.Body.String(), string(codeNetworkDenied)) {
+				t.Fatalf("expected %s, got %s", codeNetworkDenied, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyCoversStoredIDs(t *testing.T) {
+	cfg := config.Default()
+	cfg.NetworkPolicy = config.NetworkPolicy{Tenants: map[string][]string{"tenant1": {"10.0.0.0/8"}}}
+	cfg.Tasks.ScopeTasks = true
+	cfg.Auth.BasicAuth = config.BasicAuth{
+		Enabled: true,
+		Users:   []config.BasicAuthUser{{Username: "tenant1", Password: "{PLAIN}secret"}},
+	}
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	if err := proxyHandler.eql.add("eql1", eqlSearch{TenantID: "tenant1", BaseIndex: "logs"}); err != nil {
+		t.Fatalf("add eql search: %v", err)
+	}
+	if err := proxyHandler.tasks.add("node1:1", tenantTask{TenantID: "tenant1"}); err != nil {
+		t.Fatalf("add task: %v", err)
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		remote     string
+		wantStatus int
+	}{
+		{method: http.MethodGet, path: "/_eql/search/eql1", remote: "192.168.1.1:4000", wantStatus: http.StatusForbidden},
+		{method: http.MethodGet, path: "/_eql/search/status/eql1", remote: "192.168.1.1:4000", wantStatus: http.StatusForbidden},
+		{method: http.MethodDelete, path: "/_eql/search/eql1", remote: "192.168.1.1:4000", wantStatus: http.StatusForbidden},
+		{method: http.MethodGet, path: "/_tasks/node1:1", remote: "192.168.1.1:4000", wantStatus: http.StatusForbidden},
+		{method: http.MethodPost, path: "/_tasks/node1:1/_cancel", remote: "192.168.1.1:4000", wantStatus: http.StatusForbidden},
+		{method: http.MethodGet, path: "/_eql/search/status/eql1", remote: "10.1.2.3:4000", wantStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/_tasks/node1:1", remote: "10.1.2.3:4000", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path+" from "+tt.remote, func(t *testing.T) {
+			_, _, _, _, before := capture.snapshot()
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.RemoteAddr = tt.remote
+			req.SetBasicAuth("tenant1", "secret")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusForbidden {
+				return
+			}
+			if !strings.Contains(rec.Body.String(), string(codeNetworkDenied)) {
+				t.Fatalf("expected %s, got %s", codeNetworkDenied, rec.Body.String())
+			}
+			if _, _, _, _, after := capture.snapshot(); after != before {
+				t.Fatalf("expected rejected request not to reach the upstream")
+			}
+		})
+	}
+	if _, ok, _ := proxyHandler.eql.get("eql1"); !ok {
+		t.Fatal("expected denied delete to keep the EQL search")
+	}
+}
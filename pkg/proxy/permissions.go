@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"es-tmnt/pkg/config"
+)
+
+// Operations a request performs, as named in the permissions config.
+const (
+	operationSearch        = "search"
+	operationIndex         = "index"
+	operationDelete        = "delete"
+	operationMappingChange = "mapping_change"
+	operationIndexCreate   = "index_create"
+	operationIndexDelete   = "index_delete"
+	operationManage        = "manage"
+)
+
+// documentWriteEndpoints are the endpoints that write documents rather than
+// indices or cluster state, matched anywhere in the path.
+var documentWriteEndpoints = map[string]bool{
+	"_doc": true, "_create": true, "_update": true, "_bulk": true, "_update_by_query": true,
+	"_delete_by_query": true, "_reindex": true,
+}
+
+// requestOperation classifies a request for the permission matrix. Reads are
+// searches whatever the endpoint, and writes other than document, mapping,
+// and index writes, such as alias, settings, and pipeline changes, are manage.
+func requestOperation(r *http.Request, segments []string) string {
+	if !isWriteRequest(r, segments) {
+		return operationSearch
+	}
+	if len(segments) == 1 && !strings.HasPrefix(segments[0], "_") {
+		switch r.Method {
+		case http.MethodPut:
+			return operationIndexCreate
+		case http.MethodDelete:
+			return operationIndexDelete
+		}
+	}
+	for _, segment := range segments {
+		switch {
+		case segment == "_mapping" || segment == "_mappings":
+			return operationMappingChange
+		case segment == "_delete_by_query" || segment == "_doc" && r.Method == http.MethodDelete:
+			return operationDelete
+		case documentWriteEndpoints[segment]:
+			return operationIndex
+		}
+	}
+	return operationManage
+}
+
+// permissionMatrix is the compiled permissions config. A nil operation set
+// allows every operation.
+type permissionMatrix struct {
+	defaults map[string]bool
+	tenants  map[string]map[string]bool
+}
+
+func newPermissionMatrix(cfg config.Permissions) *permissionMatrix {
+	matrix := &permissionMatrix{defaults: operationSet(cfg.Default), tenants: make(map[string]map[string]bool, len(cfg.Tenants))}
+	for tenantID, operations := range cfg.Tenants {
+		allowed := operationSet(operations)
+		if allowed == nil {
+			allowed = map[string]bool{}
+		}
+		matrix.tenants[strings.TrimSpace(tenantID)] = allowed
+	}
+	return matrix
+}
+
+func operationSet(operations []string) map[string]bool {
+	if len(operations) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(operations))
+	for _, operation := range operations {
+		set[strings.TrimSpace(operation)] = true
+	}
+	return set
+}
+
+func (m *permissionMatrix) allows(tenantID, operation string) bool {
+	if m == nil {
+		return true
+	}
+	allowed, ok := m.tenants[tenantID]
+	if !ok {
+		allowed = m.defaults
+	}
+	return allowed == nil || allowed[operation]
+}
+
+// checkOperation rejects a tenant that may not perform the operation of r,
+// or whose API key may not.
+func (p *Proxy) checkOperation(r *http.Request, tenantID string) error {
+	state := requestStateFrom(r)
+	if state == nil || state.operation == "" {
+		return nil
+	}
+	if !p.permissions.allows(tenantID, state.operation) {
+		return withCode(codePermissionDenied, fmt.Errorf("tenant '%s' is not allowed the %s operation", tenantID, state.operation))
+	}
+	if state.keyOps != nil && !state.keyOps[state.operation] {
+		return withCode(codePermissionDenied, fmt.Errorf("api key is not allowed the %s operation", state.operation))
+	}
+	return nil
+}
+
+// checkTenantAccess applies the permission matrix and network policy of
+// tenantID to r and routes r to the tenant's upstream cluster. resolveTenant
+// calls it for tenants named by indices; handlers call it directly for stored
+// state of a tenant, such as an async search or task id.
+func (p *Proxy) checkTenantAccess(r *http.Request, tenantID string) error {
+	if err := p.checkOperation(r, tenantID); err != nil {
+		return err
+	}
+	if err := p.checkNetwork(r, tenantID); err != nil {
+		return err
+	}
+	return p.routeTenant(r, tenantID)
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestRequestOperation(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodGet, path: "/orders-tenant1/_doc/1", want: operationSearch},
+		{method: http.MethodPost, path: "/orders-tenant1/_search", want: operationSearch},
+		{method: http.MethodPut, path: "/orders-tenant1/_doc/1", want: operationIndex},
+		{method: http.MethodPost, path: "/_bulk", want: operationIndex},
+		{method: http.MethodDelete, path: "/orders-tenant1/_doc/1", want: operationDelete},
+		{method: http.MethodPost, path: "/orders-tenant1/_delete_by_query", want: operationDelete},
+		{method: http.MethodPut, path: "/orders-tenant1/_mapping", want: operationMappingChange},
+		{method: http.MethodPut, path: "/orders-tenant1", want: operationIndexCreate},
+		{method: http.MethodDelete, path: "/orders-tenant1", want: operationIndexDelete},
+		{method: http.MethodPost, path: "/_aliases", want: operationManage},
+		{method: http.MethodPut, path: "/orders-tenant1/_settings", want: operationManage},
+		{method: http.MethodGet, path: "/_eql/search/abc", want: operationSearch},
+		{method: http.MethodDelete, path: "/_eql/search/abc", want: operationManage},
+		{method: http.MethodGet, path: "/_tasks/node1:1", want: operationSearch},
+		{method: http.MethodPost, path: "/_tasks/node1:1/_cancel", want: operationManage},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requestOperation(req, splitPath(tt.path)); got != tt.want {
+			t.Fatalf("%s %s: expected %s, got %s", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestPermissionMatrix(t *testing.T) {
+	cfg := config.Default()
+	cfg.Permissions = config.Permissions{
+		Default: []string{"search", "index", "delete"},
+		Tenants: map[string][]string{"analytics": {"search"}, "ops": {"search", "index_create", "index_delete"}},
+	}
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "read-only search", method: http.MethodPost, path: "/orders-analytics/_search", body: `{}`, wantStatus: http.StatusOK},
+		{name: "read-only index", method: http.MethodPut, path: "/orders-analytics/_doc/1", body: `{"a":1}`, wantStatus: http.StatusForbidden},
+		{name: "read-only bulk line", method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"orders-analytics\",\"_id\":\"1\"}}\n{\"a\":1}\n", wantStatus: http.StatusForbidden},
+		{name: "listed create", method: http.MethodPut, path: "/orders-ops", body: `{}`, wantStatus: http.StatusOK},
+		{name: "default index", method: http.MethodPut, path: "/orders-tenant1/_doc/1", body: `{"a":1}`, wantStatus: http.StatusOK},
+		{name: "default mapping change", method: http.MethodPut, path: "/orders-tenant1/_mapping", body: `{"properties":{}}`, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, _, before := capture.snapshot()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if strings.HasPrefix(tt.path, "/_bulk") {
+				req.Header.Set("Content-Type", "application/x-ndjson")
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusForbidden {
+				return
+			}
+			if !strings.Contains(rec.Body.String(), string(codePermissionDenied)) {
+				t.Fatalf("expected %s, got %s", codePermissionDenied, rec.Body.String())
+			}
+			if _, _, _, _, after := capture.snapshot(); after != before {
+				t.Fatalf("expected rejected request not to reach the upstream")
+			}
+		})
+	}
+}
+
+func TestTenantSettingsOverridePermissions(t *testing.T) {
+	cfg := config.Default()
+	cfg.Permissions = config.Permissions{
+		Default: []string{"search"},
+		Tenants: map[string][]string{"analytics": {"search"}},
+	}
+	cfg.Tenants = map[string]config.TenantSettings{
+		"analytics": {Permissions: []string{"search", "index"}},
+		"frozen":    {Permissions: []string{}},
+	}
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "override adds an operation", method: http.MethodPut, path: "/orders-analytics/_doc/1", body: `{"a":1}`, wantStatus: http.StatusOK},
+		{name: "empty override denies all", method: http.MethodPost, path: "/orders-frozen/_search", body: `{}`, wantStatus: http.StatusForbidden},
+		{name: "default without override", method: http.MethodPut, path: "/orders-tenant1/_doc/1", body: `{"a":1}`, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusForbidden && !strings.Contains(rec.Body.String(), string(codePermissionDenied)) {
+				t.Fatalf("expected %s, got %s", codePermissionDenied, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPermissionMatrixCoversStoredIDs(t *testing.T) {
+	cfg := config.Default()
+	cfg.Permissions = config.Permissions{
+		Tenants: map[string][]string{"analytics": {"search"}, "writer": {"index"}},
+	}
+	cfg.Tasks.ScopeTasks = true
+	cfg.Auth.BasicAuth = config.BasicAuth{
+		Enabled: true,
+		Users: []config.BasicAuthUser{
+			{Username: "analytics", Password: "{PLAIN}secret"},
+			{Username: "writer", Password: "{PLAIN}secret"},
+		},
+	}
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	for _, tenantID := range []string{"analytics", "writer"} {
+		if err := proxyHandler.eql.add("eql-"+tenantID, eqlSearch{TenantID: tenantID, BaseIndex: "logs"}); err != nil {
+			t.Fatalf("add eql search: %v", err)
+		}
+		if err := proxyHandler.tasks.add("node1:"+tenantID, tenantTask{TenantID: tenantID}); err != nil {
+			t.Fatalf("add task: %v", err)
+		}
+	}
+
+	tests := []struct {
+		user       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{user: "analytics", method: http.MethodGet, path: "/_eql/search/eql-analytics", wantStatus: http.StatusOK},
+		{user: "analytics", method: http.MethodDelete, path: "/_eql/search/eql-analytics", wantStatus: http.StatusForbidden},
+		{user: "analytics", method: http.MethodGet, path: "/_tasks/node1:analytics", wantStatus: http.StatusOK},
+		{user: "analytics", method: http.MethodPost, path: "/_tasks/node1:analytics/_cancel", wantStatus: http.StatusForbidden},
+		{user: "analytics", method: http.MethodPost, path: "/_delete_by_query/node1:analytics/_rethrottle", wantStatus: http.StatusForbidden},
+		{user: "writer", method: http.MethodGet, path: "/_eql/search/status/eql-writer", wantStatus: http.StatusForbidden},
+		{user: "writer", method: http.MethodGet, path: "/_tasks/node1:writer", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user+" "+tt.method+" "+tt.path, func(t *testing.T) {
+			_, _, _, _, before := capture.snapshot()
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.SetBasicAuth(tt.user, "secret")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusForbidden {
+				return
+			}
+			if !strings.Contains(rec.Body.String(), string(codePermissionDenied)) {
+				t.Fatalf("expected %s, got %s", codePermissionDenied, rec.Body.String())
+			}
+			if _, _, _, _, after := capture.snapshot(); after != before {
+				t.Fatalf("expected rejected request not to reach the upstream")
+			}
+		})
+	}
+	if _, ok, _ := proxyHandler.eql.get("eql-analytics"); !ok {
+		t.Fatal("expected denied delete to keep the EQL search")
+	}
+}
+
+func TestAPIKeyOperations(t *testing.T) {
+	cfg := config.Default()
+	cfg.APIKeys = config.APIKeys{Enabled: true, Store: "file", Path: filepath.Join(t.TempDir(), "api_keys.json")}
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+	key := mintTestAPIKey(t, proxyHandler, `{"tenant":"tenant1","permissions":["read","write"],"operations":["search","index"]}`)["encoded"].(string)
+
+	for _, tt := range []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{method: http.MethodPut, path: "/orders-tenant1/_doc/1", wantStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/orders-tenant1/_delete_by_query", wantStatus: http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"a":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "ApiKey "+key)
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.wantStatus, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/api_keys", strings.NewReader(`{"tenant":"tenant1","permissions":["read"],"operations":["everything"]}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown operation to be rejected, got %d", rec.Code)
+	}
+}
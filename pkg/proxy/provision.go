@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// tenantProvisionRequest is the optional body of the tenant admin endpoints.
+// Indices lists base indices; without it the keys of Mappings are used. Mappings
+// hold index create bodies as tenants see them, keyed by base index.
+type tenantProvisionRequest struct {
+	Indices  []string                   `json:"indices"`
+	Mappings map[string]json.RawMessage `json:"mappings"`
+}
+
+// handleTenant provisions a tenant on POST /admin/tenants/{id} and
+// deprovisions it on DELETE. Provisioning creates the shared or per-tenant
+// indices of the given base indices and, in shared mode, the tenant aliases.
+// Deprovisioning removes the tenant aliases in shared mode, leaving the shared
+// indices in place, and deletes the per-tenant indices otherwise.
+func (p *Proxy) handleTenant(w http.ResponseWriter, r *http.Request) {
+	tenantID := strings.TrimPrefix(r.URL.Path, "/admin/tenants/")
+	if id, ok := strings.CutSuffix(tenantID, "/data"); ok && id != "" && !strings.Contains(id, "/") {
+		p.handleTenantData(w, r, id)
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for tenants")
+		return
+	}
+	if tenantID == "" || strings.Contains(tenantID, "/") {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "expected /admin/tenants/{id}")
+		return
+	}
+	var payload tenantProvisionRequest
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad_request", "failed to read body")
+			return
+		}
+		if len(strings.TrimSpace(string(body))) > 0 {
+			if err := json.Unmarshal(body, &payload); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "bad_request", "invalid JSON body")
+				return
+			}
+		}
+	}
+	if value := r.URL.Query().Get("indices"); value != "" {
+		payload.Indices = strings.Split(value, ",")
+	}
+	targets, err := p.tenantTargets(tenantID, payload)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	var result map[string]interface{}
+	if r.Method == http.MethodPost {
+		result, err = p.provisionTenant(r.Context(), targets, payload.Mappings)
+	} else {
+		result, err = p.deprovisionTenant(r.Context(), targets)
+	}
+	if err != nil {
+		log.Printf("tenants: %s %s: %v", strings.ToLower(r.Method), tenantID, err)
+		writeJSONError(w, http.StatusBadGateway, "upstream_error", err.Error())
+		return
+	}
+	result["tenant"] = tenantID
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (p *Proxy) tenantTargets(tenantID string, payload tenantProvisionRequest) ([]*bootstrapTarget, error) {
+	bases := payload.Indices
+	if len(bases) == 0 {
+		for baseIndex := range payload.Mappings {
+			bases = append(bases, baseIndex)
+		}
+	}
+	if len(bases) == 0 {
+		return nil, errors.New("at least one base index is required")
+	}
+	tenants := make([]bootstrapTenant, 0, len(bases))
+	for i, baseIndex := range bases {
+		baseIndex = strings.TrimSpace(baseIndex)
+		if baseIndex == "" {
+			return nil, fmt.Errorf("indices[%d] must not be empty", i)
+		}
+		tenants = append(tenants, bootstrapTenant{baseIndex: baseIndex, tenantID: tenantID})
+	}
+	return p.groupBootstrapTargets(tenants)
+}
+
+func (p *Proxy) provisionTenant(ctx context.Context, targets []*bootstrapTarget, mappings map[string]json.RawMessage) (map[string]interface{}, error) {
+	bodies := make(map[string][]byte, len(mappings))
+	for baseIndex, body := range mappings {
+		bodies[baseIndex] = body
+	}
+	if p.creator != nil && len(p.creator.body) != 0 {
+		for _, target := range targets {
+			for _, baseIndex := range target.bases {
+				if _, ok := bodies[baseIndex]; !ok {
+					bodies[baseIndex] = p.creator.body
+				}
+			}
+		}
+	}
+	indices := []string{}
+	aliases := []string{}
+	for _, target := range targets {
+		body, err := p.mergedCreateBody(target, bodies)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.bootstrapCreateIndex(ctx, target.upstream, target.index, body); err != nil {
+			return nil, err
+		}
+		indices = append(indices, target.index)
+		if !isSharedMode(p.cfg.Mode) {
+			if p.creator != nil {
+				p.creator.remember(target.index)
+			}
+			continue
+		}
+		for _, tenant := range target.tenants {
+			if err := p.bootstrapAlias(ctx, target.index, tenant); err != nil {
+				return nil, err
+			}
+			aliasName, _ := p.renderAlias(tenant.baseIndex, tenant.tenantID)
+			aliases = append(aliases, aliasName)
+		}
+	}
+	return map[string]interface{}{"indices": indices, "aliases": aliases}, nil
+}
+
+func (p *Proxy) deprovisionTenant(ctx context.Context, targets []*bootstrapTarget) (map[string]interface{}, error) {
+	indices := []string{}
+	aliases := []string{}
+	for _, target := range targets {
+		if !isSharedMode(p.cfg.Mode) {
+			if err := p.deleteTenantIndex(ctx, target.upstream, target.index); err != nil {
+				return nil, err
+			}
+			p.creator.forget(target.index)
+			indices = append(indices, target.index)
+			continue
+		}
+		for _, tenant := range target.tenants {
+			aliasName, err := p.renderAlias(tenant.baseIndex, tenant.tenantID)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.tenantAliases(tenant.tenantID).remove(ctx, nil, target.index, aliasName); err != nil {
+				return nil, fmt.Errorf("remove tenant alias %s: %w", aliasName, err)
+			}
+			log.Printf("tenants: removed alias %s", aliasName)
+			aliases = append(aliases, aliasName)
+		}
+	}
+	return map[string]interface{}{"indices": indices, "aliases": aliases}, nil
+}
+
+// deleteTenantIndex deletes a per-tenant index. A missing index is not an error.
+func (p *Proxy) deleteTenantIndex(ctx context.Context, upstream *upstreamClient, index string) error {
+	resp, err := upstream.do(ctx, nil, http.MethodDelete, "/"+url.PathEscape(index), nil)
+	if err != nil {
+		return fmt.Errorf("delete index %s: %w", index, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("delete index %s: unexpected status %d: %s", index, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	log.Printf("tenants: deleted index %s", index)
+	return nil
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestProvisionTenantSharedMode(t *testing.T) {
+	cfg := config.Default()
+	cfg.SharedIndex.Name = "shared-index"
+	upstream := &bootstrapUpstream{existing: map[string]bool{"_alias/alias-orders-tenant1": true}}
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+	admin := proxyHandler.AdminHandler()
+
+	body := `{"indices":["products","orders"],"mappings":{"products":{"properties":{"name":{"type":"text"}}}}}`
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/tenants/tenant1", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	var result struct {
+		Tenant  string   `json:"tenant"`
+		Indices []string `json:"indices"`
+		Aliases []string `json:"aliases"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if result.Tenant != "tenant1" || len(result.Indices) != 1 || result.Indices[0] != "shared-index" || len(result.Aliases) != 2 {
+		t.Fatalf("unexpected provision result %+v", result)
+	}
+	creates := upstream.find(http.MethodPut, "/shared-index")
+	if len(creates) != 1 || !strings.Contains(string(creates[0].body), `"tenant_id":{"type":"keyword"}`) {
+		t.Fatalf("expected shared index created with the tenant field, got %+v", creates)
+	}
+	aliasCalls := upstream.find(http.MethodPost, "/_aliases")
+	if len(aliasCalls) != 1 || !strings.Contains(string(aliasCalls[0].body), `"alias":"alias-products-tenant1"`) {
+		t.Fatalf("expected only the missing alias to be created, got %d calls", len(aliasCalls))
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/tenants/tenant1?indices=products,orders", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if removes := upstream.find(http.MethodPost, "/_aliases"); len(removes) != 3 || !strings.Contains(string(removes[2].body), `"remove"`) {
+		t.Fatalf("expected both tenant aliases removed, got %d alias calls", len(removes))
+	}
+	if deletes := upstream.find(http.MethodDelete, "/shared-index"); len(deletes) != 0 {
+		t.Fatalf("expected the shared index to be kept, got %d deletes", len(deletes))
+	}
+}
+
+func TestProvisionTenantIndexPerTenant(t *testing.T) {
+	cfg := autoCreateConfig(t)
+	upstream := &bootstrapUpstream{existing: map[string]bool{}}
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+	admin := proxyHandler.AdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/tenants/tenant1", strings.NewReader(`{"indices":["orders"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	creates := upstream.find(http.MethodPut, "/orders-tenant1")
+	if len(creates) != 1 || !strings.Contains(string(creates[0].body), `"orders":{"properties":{"total":{"type":"long"}}}`) {
+		t.Fatalf("expected per-tenant index created from the create template, got %+v", creates)
+	}
+	if upstream.find(http.MethodHead, "/orders-tenant1") != nil {
+		t.Fatalf("expected provisioned index to skip the auto create check")
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/tenants/tenant1", strings.NewReader(`{"indices":["orders"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if deletes := upstream.find(http.MethodDelete, "/orders-tenant1"); len(deletes) != 1 {
+		t.Fatalf("expected per-tenant index deleted, got %d", len(deletes))
+	}
+}
+
+func TestProvisionTenantErrors(t *testing.T) {
+	proxyHandler := newProxyWithUpstream(t, config.Default(), &bootstrapUpstream{})
+	admin := proxyHandler.AdminHandler()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "method", method: http.MethodGet, path: "/admin/tenants/tenant1", status: http.StatusMethodNotAllowed},
+		{name: "missing tenant", method: http.MethodPost, path: "/admin/tenants/", body: `{"indices":["orders"]}`, status: http.StatusBadRequest},
+		{name: "missing indices", method: http.MethodPost, path: "/admin/tenants/tenant1", status: http.StatusBadRequest},
+		{name: "empty index", method: http.MethodPost, path: "/admin/tenants/tenant1", body: `{"indices":[" "]}`, status: http.StatusBadRequest},
+		{name: "invalid body", method: http.MethodPost, path: "/admin/tenants/tenant1", body: `{`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			admin.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
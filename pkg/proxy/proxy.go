@@ -0,0 +1,2479 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+type Proxy struct {
+	cfg              config.Config
+	proxy            *httputil.ReverseProxy
+	aliasTmpl        *template.Template
+	aliasPattern     *regexp.Regexp
+	sharedIndex      *template.Template
+	sharedGroups     []sharedGroup
+	perTenantIdx     *template.Template
+	indexGroup       int
+	tenantGroup      int
+	prefixGroup      int
+	postfixGroup     int
+	passthroughs     []string
+	denyPatterns     []*regexp.Regexp
+	upstream         *upstreamClient
+	upstreams        map[string]*upstreamClient
+	tenantUpstreams  map[string]*upstreamClient
+	aliases          *aliasManager
+	audit            auditSink
+	names            *nameCache
+	matches          *matchCache
+	usage            *usageTracker
+	usageFlush       *usageFlusher
+	slowLog          *slowLog
+	drain            *drainTracker
+	eql              *eqlSearchTracker
+	purges           *purgeTracker
+	tasks            *taskTracker
+	policyTmpl       *template.Template
+	policyPattern    *regexp.Regexp
+	scriptTmpl       *template.Template
+	pipelineTmpl     *template.Template
+	pipelinePattern  *regexp.Regexp
+	freeze           *writeFreeze
+	creator          *indexCreator
+	fieldManifest    fieldManifest
+	headers          *headerPolicy
+	basicAuth        *basicAuthenticator
+	apiKeys          apiKeyStore
+	permissions      *permissionMatrix
+	network          *networkPolicy
+	trusted          trustedProxies
+	cache            *responseCache
+	customRoutes     *router
+	systemRoutes     []*router
+	indexRoutes      []*router
+	hooks            Hooks
+	resolver         TenantResolver
+	indexNamePattern *regexp.Regexp
+	modeOverrides    map[string]*Proxy
+	migration        *migration
+	shadow           *shadowTraffic
+	bodyPreview      *bodyPreview
+}
+
+const (
+	responseModeHeader      = "X-ES-TMNT"
+	responseModeHandled     = "handled"
+	responseModePassthrough = "pass-through"
+	requestCategoryTenanted = "tenanted-index"
+	requestCategoryShared   = "shared-index"
+	requestCategoryPass     = "pass-through"
+)
+
+// New builds a proxy for cfg. The returned Proxy is an http.Handler serving the
+// tenant-facing API; AdminHandler serves the admin endpoints.
+func New(cfg config.Config, opts ...Option) (*Proxy, error) {
+	if cfg.TenantRegex.Compiled == nil {
+		if err := cfg.Compile(); err != nil {
+			return nil, err
+		}
+	}
+	parsed, err := url.Parse(cfg.UpstreamURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse upstream url: %w", err)
+	}
+	aliasTmpl, err := template.New("alias").Parse(cfg.SharedIndex.AliasTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parse alias template: %w", err)
+	}
+	sharedIndex, err := template.New("shared").Parse(cfg.SharedIndex.Name)
+	if err != nil {
+		return nil, fmt.Errorf("parse shared index template: %w", err)
+	}
+	sharedGroups, err := newSharedGroups(cfg.SharedIndex)
+	if err != nil {
+		return nil, err
+	}
+	if isSharedMode(cfg.Mode) {
+		if err := checkAliasCollisions(cfg.SharedIndex); err != nil {
+			return nil, err
+		}
+	}
+	perTenantIdx, err := template.New("index-per-tenant").Parse(cfg.IndexPerTenant.IndexTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parse index per tenant template: %w", err)
+	}
+	indexGroup, tenantGroup, prefixGroup, postfixGroup, err := groupIndexes(cfg.TenantRegex.Compiled)
+	if err != nil {
+		return nil, err
+	}
+	var indexNamePattern *regexp.Regexp
+	if cfg.IndexNames.Pattern != "" {
+		indexNamePattern, err = regexp.Compile(cfg.IndexNames.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("parse index name pattern: %w", err)
+		}
+	}
+	store, err := newStateStore(cfg.State)
+	if err != nil {
+		return nil, fmt.Errorf("state store: %w", err)
+	}
+	upstream := newUpstreamClient(parsed)
+	proxy := &Proxy{
+		cfg:              cfg,
+		aliasTmpl:        aliasTmpl,
+		aliasPattern:     templatePattern(cfg.SharedIndex.AliasTemplate),
+		indexNamePattern: indexNamePattern,
+		sharedIndex:      sharedIndex,
+		sharedGroups:     sharedGroups,
+		perTenantIdx:     perTenantIdx,
+		indexGroup:       indexGroup,
+		tenantGroup:      tenantGroup,
+		prefixGroup:      prefixGroup,
+		postfixGroup:     postfixGroup,
+		passthroughs:     cfg.PassthroughPaths,
+		denyPatterns:     cfg.SharedIndex.DenyCompiled,
+		upstream:         upstream,
+		aliases:          newAliasManager(upstream),
+		names:            newNameCache(nameCacheSize),
+		matches:          newMatchCache(matchCacheSize),
+		usage:            newUsageTracker(),
+		slowLog:          newSlowLog(cfg.SlowLog),
+		drain:            newDrainTracker(),
+		eql:              newEQLSearchTracker(store),
+		purges:           newPurgeTracker(store),
+		tasks:            newTaskTracker(store),
+		freeze:           newWriteFreeze(cfg.Freeze.Writes, cfg.Freeze.Reason()),
+		cache:            newResponseCache(cfg.ResponseCache),
+		headers:          newHeaderPolicy(cfg.ResponseHeaders),
+	}
+	proxy.proxy = proxy.newReverseProxy(parsed)
+	if faults := newFaultInjector(cfg.Faults, http.DefaultTransport); faults != nil {
+		proxy.proxy.Transport = faults
+	}
+	proxy.pipelineTmpl, err = template.New("pipeline").Parse(cfg.Ingest.Template())
+	if err != nil {
+		return nil, fmt.Errorf("parse pipeline template: %w", err)
+	}
+	proxy.pipelinePattern = templatePattern(cfg.Ingest.Template())
+	if cfg.Lifecycle.NamespacePolicies {
+		proxy.policyTmpl, err = template.New("policy").Parse(cfg.Lifecycle.PolicyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("parse policy template: %w", err)
+		}
+		proxy.policyPattern = templatePattern(cfg.Lifecycle.PolicyTemplate)
+	}
+	if cfg.Scripts.NamespaceScripts {
+		proxy.scriptTmpl, err = template.New("script").Parse(cfg.Scripts.ScriptTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("parse script template: %w", err)
+		}
+	}
+	proxy.creator, err = newIndexCreator(cfg.IndexPerTenant, upstream)
+	if err != nil {
+		return nil, err
+	}
+	proxy.fieldManifest, err = loadFieldManifest(cfg.SharedIndex.FieldManifestPath)
+	if err != nil {
+		return nil, err
+	}
+	proxy.basicAuth, err = newBasicAuthenticator(cfg.Auth.BasicAuth)
+	if err != nil {
+		return nil, err
+	}
+	proxy.apiKeys, err = newAPIKeyStore(cfg.APIKeys, upstream)
+	if err != nil {
+		return nil, err
+	}
+	proxy.upstreams, err = newNamedUpstreams(cfg.Upstreams)
+	if err != nil {
+		return nil, err
+	}
+	proxy.tenantUpstreams, err = newTenantUpstreams(proxy.upstreams, cfg.Tenants)
+	if err != nil {
+		return nil, err
+	}
+	proxy.permissions = newPermissionMatrix(config.Permissions{Default: cfg.Permissions.Default, Tenants: cfg.TenantPermissions()})
+	proxy.network, err = newNetworkPolicy(config.NetworkPolicy{Tenants: cfg.TenantNetworks()})
+	if err != nil {
+		return nil, err
+	}
+	proxy.trusted, err = newTrustedProxies(cfg.TrustedProxies, cfg.TrustedProxyHeader)
+	if err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	proxy.audit, err = newAuditSink(cfg.Audit, upstream)
+	if err != nil {
+		return nil, err
+	}
+	usageSink, err := newUsageSink(cfg.Usage, upstream)
+	if err != nil {
+		return nil, err
+	}
+	if usageSink != nil {
+		if err := proxy.startUsageFlush(usageSink, time.Duration(cfg.Usage.FlushIntervalSeconds)*time.Second); err != nil {
+			return nil, err
+		}
+	}
+	proxy.shadow, err = newShadowTraffic(cfg.Shadow)
+	if err != nil {
+		return nil, err
+	}
+	proxy.bodyPreview, err = newBodyPreview(cfg.BodyPreview)
+	if err != nil {
+		return nil, err
+	}
+	proxy.resolver, err = newTenantResolver(cfg.TenantResolver, proxy)
+	if err != nil {
+		return nil, err
+	}
+	proxy.customRoutes = newRouter("custom")
+	proxy.systemRoutes = proxy.newSystemRoutes()
+	proxy.indexRoutes = proxy.newIndexRoutes()
+	for _, opt := range opts {
+		opt(proxy)
+	}
+	if cfg.ModeOverride.Enabled {
+		proxy.modeOverrides = proxy.newModeOverrides()
+	}
+	if len(cfg.Migration.Tenants) > 0 {
+		proxy.migration = proxy.newMigration()
+	}
+	return proxy, nil
+}
+
+// newReverseProxy forwards requests to target with headers describing the
+// client, passing them through the OnRewrite hook, body previews, shadow
+// sampling, and the proxy's response rewriting.
+func (p *Proxy) newReverseProxy(target *url.URL) *httputil.ReverseProxy {
+	reverseProxy := httputil.NewSingleHostReverseProxy(target)
+	director := reverseProxy.Director
+	reverseProxy.Director = func(outbound *http.Request) {
+		if state := requestStateFrom(outbound); state != nil && state.upstream != nil {
+			state.upstream.direct(outbound)
+		} else {
+			director(outbound)
+		}
+		p.setForwardedHeaders(outbound)
+		p.rewritten(outbound)
+		p.previewBody(outbound)
+		p.shadowRequest(outbound)
+	}
+	reverseProxy.ModifyResponse = p.modifyResponse
+	reverseProxy.ErrorHandler = p.handleProxyError
+	return reverseProxy
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = withRequestState(r)
+	if state := requestStateFrom(r); state != nil {
+		state.originalURI = r.URL.RequestURI()
+		state.clientAddr = p.trusted.clientAddr(r)
+	}
+	w = &productWriter{ResponseWriter: w, compatible: compatibleWith(r.Header)}
+	origin, cors := p.headers.corsOrigin(r)
+	w = &headerWriter{ResponseWriter: w, policy: p.headers, origin: origin, cors: cors}
+	if p.hooks.OnReject != nil {
+		w = &rejectWriter{ResponseWriter: w, r: r, onReject: p.hooks.OnReject}
+	}
+	p.assignRequestID(w, r)
+	if p.servePreflight(w, r) {
+		return
+	}
+	if p.drain != nil {
+		if !p.drain.begin() {
+			p.rejectDraining(w)
+			return
+		}
+		defer p.drain.end()
+	}
+	target, err := p.modeTarget(r)
+	if err != nil {
+		p.setResponseMode(w, responseModeHandled)
+		status := http.StatusBadRequest
+		if errors.Is(err, errModeOverrideDenied) {
+			status = http.StatusForbidden
+		}
+		p.rejectStatus(w, status, codeOf(err, codeInvalidRequest), err.Error())
+		return
+	}
+	target.serve(w, r)
+}
+
+// serve handles a request ServeHTTP has set up, in the mode of p.
+func (p *Proxy) serve(w http.ResponseWriter, r *http.Request) {
+	p.countRequestBytes(r)
+	if _, err := p.normalizeRequestPath(r); err != nil {
+		p.setResponseMode(w, responseModeHandled)
+		p.rejectError(w, err)
+		return
+	}
+	if p.isIgnoredPath(r.URL.Path) {
+		p.setResponseMode(w, responseModeHandled)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if p.cfg.Auth.Required && strings.TrimSpace(r.Header.Get(p.cfg.Auth.Header)) == "" {
+		p.setResponseMode(w, responseModeHandled)
+		p.rejectStatus(w, http.StatusUnauthorized, codeAuthenticationRequired, "authentication required")
+		return
+	}
+	if !p.authenticate(w, r) {
+		return
+	}
+	indexName, err := p.requestIndexCandidate(r)
+	if err != nil {
+		// Non-fatal: if we cannot determine an index candidate, proceed without shared index check.
+	} else if _, denied := p.deniedIndex(indexName); denied {
+		p.logRequest(r, requestCategoryShared, indexName)
+		p.setResponseMode(w, responseModeHandled)
+		p.rejectStatus(w, http.StatusForbidden, codeSharedIndexDenied, errSharedIndexAccess.Error())
+		return
+	}
+	segments := splitPath(r.URL.Path)
+	if state := requestStateFrom(r); state != nil {
+		state.operation = requestOperation(r, segments)
+	}
+	if p.isScrollOrPitPath(segments) {
+		p.logRequest(r, requestCategoryTenanted, "")
+		p.setResponseMode(w, responseModeHandled)
+		p.reject(w, codeUnsupportedFeature, "scroll and PIT endpoints are not supported")
+		return
+	}
+	if p.isPassthrough(r.URL.Path) {
+		p.logRequest(r, requestCategoryPass, "")
+		if p.rejectUnscopedAPIKey(w, r) {
+			return
+		}
+		p.setResponseMode(w, responseModePassthrough)
+		r, cancel := p.withRouteTimeout(r, segments, true)
+		defer cancel()
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	p.logRequestWithCategory(r)
+	baseIndex, tenantID := p.tenantResolved(r, indexName)
+	if state := requestStateFrom(r); state != nil {
+		state.pathTenant = tenantID
+	}
+	if isWriteRequest(r, segments) {
+		if message, frozen := p.freeze.rejection(); frozen {
+			p.setResponseMode(w, responseModeHandled)
+			p.rejectFrozen(w, message)
+			return
+		}
+		p.setCacheInvalidation(r, tenantID, baseIndex)
+	}
+	r, cancel := p.withRouteTimeout(r, segments, false)
+	defer cancel()
+	if !p.enforceBodyLimit(w, r, segments) {
+		return
+	}
+	if err := checkContentType(r, segments); err != nil {
+		p.setResponseMode(w, responseModeHandled)
+		p.writeError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", codeUnsupportedMediaType, err.Error())
+		return
+	}
+	if p.migration != nil && p.serveMigrating(w, r, segments, tenantID) {
+		return
+	}
+	p.dispatch(w, r, segments)
+}
+
+// dispatch sends a request serve has checked to its handler.
+func (p *Proxy) dispatch(w http.ResponseWriter, r *http.Request, segments []string) {
+	if len(segments) == 0 {
+		p.handleRoot(w, r)
+		return
+	}
+	p.route(w, r, segments)
+}
+
+func (p *Proxy) handleSearch(w http.ResponseWriter, r *http.Request, index string) {
+	cluster, baseIndex, tenantID, err := p.resolveClusterIndex(index, r, p.renderQueryIndex)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	aliasIndex := index
+	if isSharedMode(p.cfg.Mode) {
+		aliasIndex, err = p.renderAlias(baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	} else {
+		aliasIndex, err = p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	}
+	aliasIndex = withCluster(cluster, aliasIndex)
+	if err := p.rewriteQueryRequest(r, baseIndex, tenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if !isSharedMode(p.cfg.Mode) {
+		p.prefixSortQueryParam(r, baseIndex)
+	}
+	p.routeToTenant(r, tenantID)
+	p.rewriteIndexPath(r, index, aliasIndex)
+	p.setResponseKind(r, responseKindSearch, baseIndex, tenantID)
+	p.setDiagnostics(r, index)
+	p.setUsage(r, tenantID, tenantUsage{Searches: 1})
+	p.setSlowQuery(r, slowQuerySearch, tenantID, aliasIndex)
+	if r.Method == http.MethodGet {
+		p.forwardCached(w, r, tenantID)
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleSearchTemplate(w http.ResponseWriter, r *http.Request, index string) {
+	cluster, baseIndex, tenantID, err := p.resolveClusterIndex(index, r, p.renderQueryIndex)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	aliasIndex := index
+	if isSharedMode(p.cfg.Mode) {
+		aliasIndex, err = p.renderAlias(baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	} else {
+		aliasIndex, err = p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	}
+	aliasIndex = withCluster(cluster, aliasIndex)
+	if err := p.rewriteSearchTemplateID(r, tenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if err := p.rewriteQueryRequest(r, baseIndex, tenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.routeToTenant(r, tenantID)
+	p.rewriteIndexPath(r, index, aliasIndex)
+	p.setResponseKind(r, responseKindSearch, baseIndex, tenantID)
+	p.setDiagnostics(r, index)
+	p.setUsage(r, tenantID, tenantUsage{Searches: 1})
+	p.setSlowQuery(r, slowQuerySearch, tenantID, aliasIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleDoc(w http.ResponseWriter, r *http.Request, index string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		p.rejectMethod(w, "unsupported method for _doc", http.MethodPost, http.MethodPut)
+		return
+	}
+	p.ensureRefreshWaitFor(r)
+	if err := checkConditionalWrite(r.URL.Query(), false); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if _, err := p.rewritePipelineParam(r, tenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	rewritten, err := p.rewriteDocumentBody(body, baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	targetIndex, err := p.renderSharedIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if !isSharedMode(p.cfg.Mode) {
+		targetIndex, err = p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		if err := p.checkIndexName(baseIndex, tenantID, targetIndex, ""); err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		p.ensureTenantIndex(r, targetIndex, baseIndex)
+	}
+	p.setAuditEvent(r, "index", index, tenantID, targetIndex, pathDocIDs(r.URL.Path, 2))
+	p.setUsage(r, tenantID, tenantUsage{DocumentsIndexed: 1})
+	p.routeToTenant(r, tenantID)
+	p.setWriteResponse(r, index, baseIndex, tenantID)
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleUpdate(w http.ResponseWriter, r *http.Request, index string) {
+	if r.Method != http.MethodPost {
+		p.rejectMethod(w, "unsupported method for _update", http.MethodPost)
+		return
+	}
+	p.ensureRefreshWaitFor(r)
+	if err := checkConditionalWrite(r.URL.Query(), true); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	rewritten, err := p.rewriteUpdateBody(body, baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	targetIndex, err := p.renderSharedIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if !isSharedMode(p.cfg.Mode) {
+		targetIndex, err = p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		if err := p.checkIndexName(baseIndex, tenantID, targetIndex, ""); err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		p.ensureTenantIndex(r, targetIndex, baseIndex)
+	}
+	p.setAuditEvent(r, "update", index, tenantID, targetIndex, pathDocIDs(r.URL.Path, 2))
+	p.routeToTenant(r, tenantID)
+	p.setWriteResponse(r, index, baseIndex, tenantID)
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleAnalyze(w http.ResponseWriter, r *http.Request, index string) {
+	targetIndex := index
+	if index == "" {
+		param, err := p.parseIndexParam(r, false)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		if param != nil {
+			targetIndex, err = p.rewriteIndexParam(r, param, p.renderTargetIndex)
+			if err != nil {
+				p.rejectError(w, err)
+				return
+			}
+		}
+	} else {
+		baseIndex, tenantID, err := p.parseIndex(r, index)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		targetIndex, err = p.renderTargetIndex(baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	}
+	if targetIndex == "" {
+		p.reject(w, codeMissingIndex, "missing index for _analyze")
+		return
+	}
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleQueryEndpoint(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.resolveIndex(index, r, p.renderQueryIndex)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex := index
+	if isSharedMode(p.cfg.Mode) {
+		targetIndex, err = p.renderAlias(baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	} else {
+		targetIndex, err = p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	}
+	if err := p.rewriteQueryRequest(r, baseIndex, tenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.routeToTenant(r, tenantID)
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleExplain(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.resolveIndex(index, r, p.renderQueryIndex)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex := index
+	if isSharedMode(p.cfg.Mode) {
+		targetIndex, err = p.renderAlias(baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	} else {
+		targetIndex, err = p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	}
+	if err := p.rewriteQueryRequest(r, baseIndex, tenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.routeToTenant(r, tenantID)
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.setResponseKind(r, responseKindExplain, baseIndex, tenantID)
+	if state := requestStateFrom(r); state != nil {
+		state.index = index
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleValidateQuery(w http.ResponseWriter, r *http.Request, index string) {
+	if index == "" && strings.TrimSpace(r.URL.Query().Get("index")) == "" {
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	baseIndex, tenantID, err := p.resolveIndex(index, r, p.renderQueryIndex)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex, err := p.renderQueryIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if err := p.rewriteQueryRequest(r, baseIndex, tenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleMultiSearch(w http.ResponseWriter, r *http.Request, index string) {
+	if r.Method != http.MethodPost {
+		p.rejectMethod(w, "unsupported method for msearch", http.MethodPost)
+		return
+	}
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	if index == "" {
+		index = takeIndexParam(r)
+	}
+	// The body is rewritten as it is read, one line at a time, and forwarded
+	// only once every search has been checked, so rejected requests never
+	// reach the upstream.
+	var rewritten bytes.Buffer
+	if err := p.rewriteMultiSearchStream(r, r.Body, &rewritten, index, p.rewriteTenantQueryBody); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten.Bytes()))
+	r.ContentLength = int64(rewritten.Len())
+	p.proxy.ServeHTTP(w, r)
+}
+
+// handleMultiSearchTemplate rewrites an _msearch/template body like an msearch
+// body: header indices are rendered for their tenant and each template request
+// is rewritten like a _search/template body, namespacing stored template ids.
+func (p *Proxy) handleMultiSearchTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		p.rejectMethod(w, "unsupported method for msearch template", http.MethodPost)
+		return
+	}
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	var rewritten bytes.Buffer
+	if err := p.rewriteMultiSearchStream(r, r.Body, &rewritten, takeIndexParam(r), p.rewriteSearchTemplateBody); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten.Bytes()))
+	r.ContentLength = int64(rewritten.Len())
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleBulk(w http.ResponseWriter, r *http.Request, index string) {
+	if r.Method != http.MethodPost {
+		p.rejectMethod(w, "unsupported method for bulk", http.MethodPost)
+		return
+	}
+	p.ensureRefreshWaitFor(r)
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	if index == "" {
+		index = takeIndexParam(r)
+	}
+	pathTenant := ""
+	if index != "" {
+		baseIndex, tenantID, err := p.parseIndex(r, index)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		p.rewriteIndexPath(r, index, targetIndex)
+		pathTenant = tenantID
+	}
+	pipeline := r.URL.Query().Get("pipeline")
+	pipelineTenant, err := p.rewritePipelineParam(r, pathTenant)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	// A pipeline of another tenant is rejected as soon as the first action
+	// names the tenant of the body.
+	var checkTenant func(string) error
+	if pipelineTenant != "" {
+		checkTenant = func(tenantID string) error {
+			if tenantID != pipelineTenant {
+				return withCode(codeTenantMismatch, fmt.Errorf("pipeline %s belongs to a different tenant", pipeline))
+			}
+			return nil
+		}
+	}
+	summary := &bulkSummary{}
+	// The body is rewritten line by line into a spool and forwarded only once
+	// every action has been checked, so rejected and oversized bodies never
+	// reach the upstream. Large bodies spill from memory to a temporary file.
+	spool := newBodySpool(p.cfg.Bulk.SpoolMemoryBytes, p.cfg.Bulk.SpoolDir)
+	defer spool.Close()
+	tenantID, err := p.rewriteBulkStream(r, r.Body, spool, index, checkTenant, summary)
+	if err != nil {
+		var tooLarge *bodyTooLargeError
+		if errors.As(err, &tooLarge) {
+			p.rejectTooLarge(w, tooLarge.limit)
+			return
+		}
+		p.rejectError(w, err)
+		return
+	}
+	body, err := spool.Reader()
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	r.Body = body
+	r.ContentLength = spool.Len()
+	targets := strings.Join(summary.targets, ",")
+	p.setAuditEvent(r, "bulk", index, tenantID, targets, summary.ids)
+	p.setUsage(r, tenantID, tenantUsage{DocumentsIndexed: summary.indexed, Deletes: summary.deletes})
+	p.setSlowQuery(r, slowQueryBulk, tenantID, targets)
+	p.setCacheInvalidation(r, tenantID, "")
+	p.setBulkResponse(r, summary)
+	p.proxy.ServeHTTP(w, r)
+}
+
+// handleProxyError answers requests the upstream round trip failed for as a
+// bad gateway, or a gateway timeout once the route's deadline has passed.
+func (p *Proxy) handleProxyError(w http.ResponseWriter, r *http.Request, err error) {
+	if state := requestStateFrom(r); state != nil && state.timeout > 0 && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		log.Printf("http: upstream timeout: request_id=%s after %s", requestIDFrom(r), state.timeout)
+		p.writeError(w, http.StatusGatewayTimeout, "timeout_exception", codeUpstreamTimeout, fmt.Sprintf("upstream did not respond within %s", state.timeout))
+		return
+	}
+	log.Printf("http: proxy error: request_id=%s %v", requestIDFrom(r), err)
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+func (p *Proxy) handleIndexRoot(w http.ResponseWriter, r *http.Request, index string) {
+	switch r.Method {
+	case http.MethodPut:
+		p.handleIndexCreate(w, r, index)
+	case http.MethodDelete:
+		p.handleIndexDelete(w, r, index)
+	case http.MethodHead:
+		p.handleIndexHead(w, r, index)
+	default:
+		p.rejectMethod(w, "unsupported index endpoint", http.MethodDelete, http.MethodHead, http.MethodPut)
+	}
+}
+
+func (p *Proxy) handleIndexCreate(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		if len(bytes.TrimSpace(body)) != 0 {
+			rewritten, err := p.rewriteMappingBody(body, baseIndex)
+			if err != nil {
+				p.rejectError(w, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(rewritten))
+			r.ContentLength = int64(len(rewritten))
+		}
+	}
+	targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	aliasName := ""
+	if isSharedMode(p.cfg.Mode) {
+		aliasName, err = p.renderAlias(baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	}
+	if err := p.checkIndexName(baseIndex, tenantID, targetIndex, aliasName); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if isSharedMode(p.cfg.Mode) {
+		if state := requestStateFrom(r); state != nil {
+			state.index = index
+			state.target = targetIndex
+			state.alias = aliasName
+		}
+		p.setResponseKind(r, responseKindIndexCreate, baseIndex, tenantID)
+	}
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleIndexDelete(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if isSharedMode(p.cfg.Mode) {
+		// The shared index holds every tenant's documents, so deleting a tenant
+		// index only removes the tenant alias.
+		aliasName, err := p.renderAlias(baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		body, err := p.aliases.removeAliasBody(targetIndex, aliasName)
+		if err != nil {
+			p.reject(w, codeInvalidRequest, "failed to build alias request")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		setBodyContentType(r, mediaTypeJSON)
+		r.Method = http.MethodPost
+		r.URL.RawQuery = ""
+		p.setPathSegments(r, []string{"_aliases"})
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	p.creator.forget(targetIndex)
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleIndexHead(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex, err := p.renderQueryIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleMapping(w http.ResponseWriter, r *http.Request, index string) {
+	if r.Method == http.MethodGet {
+		p.handleGetMapping(w, r, index)
+		return
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		p.rejectMethod(w, "unsupported method for _mapping", http.MethodGet, http.MethodPost, http.MethodPut)
+		return
+	}
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	rewritten, err := p.rewriteMappingBody(body, baseIndex)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleTransform(w http.ResponseWriter, r *http.Request) {
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		if len(bytes.TrimSpace(body)) != 0 {
+			rewritten, err := p.rewriteTransformBody(r, body)
+			if err != nil {
+				p.rejectError(w, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(rewritten))
+			r.ContentLength = int64(len(rewritten))
+		}
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleRollup(w http.ResponseWriter, r *http.Request) {
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		if len(bytes.TrimSpace(body)) != 0 {
+			rewritten, err := p.rewriteRollupBody(r, body)
+			if err != nil {
+				p.rejectError(w, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(rewritten))
+			r.ContentLength = int64(len(rewritten))
+		}
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleReindex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		p.rejectMethod(w, "unsupported method for _reindex", http.MethodPost)
+		return
+	}
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	rewritten, baseIndex, tenantID, err := p.rewriteReindexBody(r, body)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	p.trackTask(r, baseIndex, tenantID, reindexTaskIndices(body, rewritten))
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleIndexPassthrough(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.setIndexResponse(r, baseIndex, tenantID, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+// handleGetMapping forwards GET _mapping and GET _mapping/field/{fields}. In
+// index-per-tenant mode with wrapped sources the requested fields are prefixed
+// with the base index; the response is reshaped by rekeyIndexResponse.
+func (p *Proxy) handleGetMapping(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if p.wrapSource() {
+		segments := splitPath(r.URL.Path)
+		if len(segments) == 4 && segments[1] == "_mapping" && segments[2] == "field" {
+			fields := strings.Split(segments[3], ",")
+			for i, field := range fields {
+				fields[i] = p.prefixField(baseIndex, field)
+			}
+			segments[3] = strings.Join(fields, ",")
+			r.URL.Path = joinPath(segments)
+			r.RequestURI = r.URL.Path
+		}
+	}
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.setIndexResponse(r, baseIndex, tenantID, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleTermVectors(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		if len(bytes.TrimSpace(body)) != 0 {
+			body, err = p.rewriteTermVectorsBody(body, baseIndex, tenantID)
+			if err != nil {
+				p.rejectError(w, err)
+				return
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+	if !isSharedMode(p.cfg.Mode) {
+		p.prefixFieldsQueryParam(r, baseIndex)
+	}
+	targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.routeToTenant(r, tenantID)
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleMultiTermVectors(w http.ResponseWriter, r *http.Request, index string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	rewritten, err := p.rewriteMultiTermVectorsBody(r, body, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	if !isSharedMode(p.cfg.Mode) {
+		p.prefixFieldsQueryParam(r, baseIndex)
+	}
+	targetIndex, err := p.renderTargetIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.rewriteIndexPath(r, index, targetIndex)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleNamedQueryEndpoint(w http.ResponseWriter, r *http.Request, index, endpoint string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex, err := p.renderQueryIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.forwardNamedQuery(w, r, index, baseIndex, tenantID, targetIndex, endpoint)
+}
+
+// forwardNamedQuery sends a by-query request of tenantID for index to
+// targetIndex, with its query rewritten for baseIndex.
+func (p *Proxy) forwardNamedQuery(w http.ResponseWriter, r *http.Request, index, baseIndex, tenantID, targetIndex, endpoint string) {
+	if _, err := p.rewritePipelineParam(r, tenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	rewritten, err := p.rewriteTenantQueryBody(r, body, baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	r.Method = http.MethodPost
+	p.setPathSegments(r, []string{targetIndex, endpoint})
+	indices := map[string]string{}
+	taskIndexNames(indices, index, targetIndex)
+	p.trackTask(r, baseIndex, tenantID, indices)
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleGet(w http.ResponseWriter, r *http.Request, index, docID string) {
+	if docID == "" {
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "missing document id")
+		return
+	}
+	query, err := buildIDsQuery([]string{docID})
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.handleQuerySearch(w, r, index, query, responseKindSearch)
+}
+
+func (p *Proxy) handleDocGet(w http.ResponseWriter, r *http.Request, index, docID string) {
+	if docID == "" {
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "missing document id")
+		return
+	}
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	state := requestStateFrom(r)
+	if state != nil {
+		state.index = index
+		state.docIDs = []string{docID}
+	}
+	if !isSharedMode(p.cfg.Mode) {
+		targetIndex, err := p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		p.prefixSourceQueryParams(r, baseIndex)
+		p.rewriteIndexPath(r, index, targetIndex)
+		p.setResponseKind(r, responseKindDoc, baseIndex, tenantID)
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	query, err := buildVersionedIDsQuery([]string{docID})
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	deleteQueryParams(r, getOnlyQueryParams...)
+	p.handleQuerySearch(w, r, index, query, responseKindGet)
+}
+
+func (p *Proxy) handleDocHead(w http.ResponseWriter, r *http.Request, index, docID string) {
+	if docID == "" {
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "missing document id")
+		return
+	}
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if !isSharedMode(p.cfg.Mode) {
+		targetIndex, err := p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+		if err != nil {
+			p.rejectError(w, err)
+			return
+		}
+		p.rewriteIndexPath(r, index, targetIndex)
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	query, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{"values": []string{docID}},
+		},
+		"size": 0,
+	})
+	if err != nil {
+		p.reject(w, codeInvalidRequest, "failed to build query")
+		return
+	}
+	deleteQueryParams(r, getOnlyQueryParams...)
+	p.handleQuerySearch(w, r, index, query, responseKindExists)
+}
+
+func (p *Proxy) handleSource(w http.ResponseWriter, r *http.Request, index, docID string) {
+	if docID == "" {
+		if r.Body == nil {
+			p.reject(w, codeMissingBody, "missing body")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			p.reject(w, codeMissingBody, "missing body")
+			return
+		}
+		p.handleQuerySearch(w, r, index, body, responseKindSearch)
+		return
+	}
+	query, err := buildIDsQuery([]string{docID})
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.handleQuerySearch(w, r, index, query, responseKindSearch)
+}
+
+func (p *Proxy) handleMget(w http.ResponseWriter, r *http.Request, index string) {
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	ids, err := extractMgetIDs(body, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	query, err := buildVersionedIDsQuery(ids)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if state := requestStateFrom(r); state != nil {
+		state.index = index
+		state.docIDs = ids
+	}
+	p.handleQuerySearch(w, r, index, query, responseKindMget)
+}
+
+func (p *Proxy) handleDelete(w http.ResponseWriter, r *http.Request, index, docID string) {
+	if docID == "" {
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "missing document id")
+		return
+	}
+	query, err := buildIDsQuery([]string{docID})
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if baseIndex, tenantID, err := p.parseIndex(r, index); err == nil {
+		if targetIndex, err := p.renderTargetIndex(baseIndex, tenantID); err == nil {
+			p.setAuditEvent(r, "delete", index, tenantID, targetIndex, []string{docID})
+			p.setUsage(r, tenantID, tenantUsage{Deletes: 1})
+		}
+	}
+	p.handleQueryEndpointWithBody(w, r, index, "_delete_by_query", query)
+}
+
+func (p *Proxy) handleCount(w http.ResponseWriter, r *http.Request, index string) {
+	var payload map[string]interface{}
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		if len(bytes.TrimSpace(body)) != 0 {
+			if err := json.Unmarshal(body, &payload); err != nil {
+				p.reject(w, codeInvalidJSON, "invalid JSON body")
+				return
+			}
+		}
+	}
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	if _, ok := payload["query"]; !ok {
+		payload["query"] = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	payload["size"] = 0
+	payload["track_total_hits"] = true
+	queryBody, err := json.Marshal(payload)
+	if err != nil {
+		p.reject(w, codeInvalidRequest, "failed to build query")
+		return
+	}
+	p.handleQuerySearch(w, r, index, queryBody, responseKindCount)
+}
+
+func (p *Proxy) handleQuerySearch(w http.ResponseWriter, r *http.Request, index string, queryBody []byte, kind responseKind) {
+	cacheable := r.Method == http.MethodGet && kind == responseKindCount
+	cluster, baseIndex, tenantID, err := p.parseClusterIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	rewritten, err := p.rewriteTenantQueryBody(r, queryBody, baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	r.Method = http.MethodPost
+	if state := requestStateFrom(r); state != nil {
+		state.queryBody = rewritten
+	}
+	targetIndex, err := p.renderQueryIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	targetIndex = withCluster(cluster, targetIndex)
+	p.routeToTenant(r, tenantID)
+	p.setPathSegments(r, []string{targetIndex, "_search"})
+	p.setResponseKind(r, kind, baseIndex, tenantID)
+	p.setUsage(r, tenantID, tenantUsage{})
+	p.setSlowQuery(r, slowQuerySearch, tenantID, targetIndex)
+	if cacheable {
+		p.forwardCached(w, r, tenantID)
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleQueryEndpointWithBody(w http.ResponseWriter, r *http.Request, index, endpoint string, queryBody []byte) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	rewritten, err := p.rewriteTenantQueryBody(r, queryBody, baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	r.Method = http.MethodPost
+	targetIndex, err := p.renderQueryIndex(baseIndex, tenantID)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.routeToTenant(r, tenantID)
+	p.setPathSegments(r, []string{targetIndex, endpoint})
+	p.proxy.ServeHTTP(w, r)
+}
+
+// handleRootQueryByIndex serves the root form of a by-query endpoint, moving
+// the indices of the index parameter into the path.
+func (p *Proxy) handleRootQueryByIndex(w http.ResponseWriter, r *http.Request, endpoint string) {
+	param, err := p.parseIndexParam(r, false)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if param == nil {
+		p.reject(w, codeMissingIndex, "missing index")
+		return
+	}
+	targets, err := param.render(p.renderQueryIndex)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	index := takeIndexParam(r)
+	p.forwardNamedQuery(w, r, index, param.baseIndex(), param.tenantID, targets, endpoint)
+}
+
+func (p *Proxy) rewriteIndexPath(r *http.Request, original, replacement string) {
+	rewritten, ok := replaceFirstSegment(r.URL.Path, original, replacement)
+	if !ok {
+		return
+	}
+	r.URL.Path = rewritten
+	r.RequestURI = r.URL.Path
+	if original != replacement {
+		p.logRequestVerbose(r, "index path rewrite: %s -> %s", original, replacement)
+	}
+}
+
+// resolveIndex resolves the base index and tenant of the path index or, at
+// root endpoints, of the index parameter, whose indices are replaced with their
+// upstream names from render.
+func (p *Proxy) resolveIndex(pathIndex string, r *http.Request, render indexRenderer) (string, string, error) {
+	if pathIndex != "" {
+		return p.parseIndex(r, pathIndex)
+	}
+	_, baseIndex, tenantID, err := p.resolveIndexParam(r, false, render)
+	return baseIndex, tenantID, err
+}
+
+// resolveClusterIndex is resolveIndex for searches, which also accept indices
+// of remote clusters.
+func (p *Proxy) resolveClusterIndex(pathIndex string, r *http.Request, render indexRenderer) (string, string, string, error) {
+	if pathIndex != "" {
+		return p.parseClusterIndex(r, pathIndex)
+	}
+	return p.resolveIndexParam(r, true, render)
+}
+
+func (p *Proxy) setIndexQueryParam(r *http.Request, replacement string) {
+	setQueryParam(r, r.URL.Query(), "index", replacement)
+	r.RequestURI = r.URL.RequestURI()
+	p.logRequestVerbose(r, "index query rewrite: index -> %s", replacement)
+}
+
+func (p *Proxy) ensureRefreshWaitFor(r *http.Request) {
+	q := r.URL.Query()
+	if strings.TrimSpace(q.Get("refresh")) != "" {
+		return
+	}
+	setQueryParam(r, q, "refresh", "wait_for")
+	r.RequestURI = r.URL.RequestURI()
+}
+
+func (p *Proxy) rewriteQueryRequest(r *http.Request, baseIndex, tenantID string) error {
+	var body []byte
+	if r.Body == nil {
+		if r.Method == http.MethodPost || r.Method == http.MethodPut {
+			return withCode(codeMissingBody, errors.New("missing body"))
+		}
+		if !p.enforceTenantFilter() {
+			return nil
+		}
+	} else {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return withCode(codeBodyReadFailed, errors.New("failed to read body"))
+		}
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if !p.enforceTenantFilter() {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			return nil
+		}
+		body = []byte("{}")
+	}
+	rewritten, err := p.rewriteTenantQueryBody(r, body, baseIndex, tenantID)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	if state := requestStateFrom(r); state != nil {
+		state.queryBody = rewritten
+	}
+	return nil
+}
+
+func (p *Proxy) setPathSegments(r *http.Request, segments []string) {
+	r.URL.Path = joinPath(segments)
+	r.RequestURI = r.URL.Path
+}
+
+// parseIndex resolves the tenant and base index of an index named by r with
+// the tenant resolver.
+func (p *Proxy) parseIndex(r *http.Request, index string) (string, string, error) {
+	if _, denied := p.deniedIndex(index); denied {
+		return "", "", errSharedIndexAccess
+	}
+	if strings.Contains(index, ":") {
+		return "", "", withCode(codeUnsupportedFeature, fmt.Errorf("remote cluster index '%s' is only supported for searches", index))
+	}
+	if strings.ContainsAny(index, "*?,") {
+		return "", "", withCode(codeMultiIndexUnsupported, fmt.Errorf("index patterns and lists are not supported: %s", index))
+	}
+	baseIndex, tenantID, err := p.resolveTenant(r, index)
+	if err != nil {
+		return "", "", err
+	}
+	if p.reservedTenant(tenantID) {
+		return "", "", withCode(codeTenantReserved, fmt.Errorf("tenant '%s' is reserved", tenantID))
+	}
+	return baseIndex, tenantID, nil
+}
+
+// resolveTenant finds the base index and tenant of index with the tenant
+// resolver, or the tenant regex when there is none.
+func (p *Proxy) resolveTenant(r *http.Request, index string) (string, string, error) {
+	if p.resolver == nil {
+		baseIndex, tenantID, err := p.matchTenantRegex(index)
+		if err == nil {
+			err = checkAuthTenant(r, tenantID)
+		}
+		if err == nil {
+			err = p.checkTenantAccess(r, tenantID)
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return baseIndex, tenantID, nil
+	}
+	resolver := p.resolver
+	if _, ok := resolver.(regexTenantResolver); !ok {
+		// The tenant the request authenticated as overrides tenants taken
+		// from request metadata. Tenants in index names are only checked.
+		if state := requestStateFrom(r); state != nil && state.authTenant != "" {
+			resolver = authTenantResolver{}
+		}
+	}
+	tenantID, baseIndex, err := resolver.ResolveTenant(r, index)
+	if err != nil {
+		return "", "", withCode(codeTenantUnresolved, err)
+	}
+	if baseIndex == "" || tenantID == "" {
+		return "", "", withCode(codeTenantUnresolved, fmt.Errorf("invalid index '%s'", index))
+	}
+	if err := checkAuthTenant(r, tenantID); err != nil {
+		return "", "", err
+	}
+	if err := p.checkTenantAccess(r, tenantID); err != nil {
+		return "", "", err
+	}
+	p.logVerbose("index resolve: %s -> base=%s tenant=%s", index, baseIndex, tenantID)
+	return baseIndex, tenantID, nil
+}
+
+// reservedTenant reports whether tenantID is one of reserved_tenants, which no
+// request may act as.
+func (p *Proxy) reservedTenant(tenantID string) bool {
+	for _, reserved := range p.cfg.ReservedTenants {
+		if strings.EqualFold(tenantID, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTenantRegex parses the tenant and base index out of an index name with
+// the tenant regex.
+func (p *Proxy) matchTenantRegex(index string) (string, string, error) {
+	match, err := p.tenantRegexMatch(index)
+	if err != nil {
+		return "", "", err
+	}
+	if !match.matched {
+		return "", "", withCode(codeTenantRegexMismatch, fmt.Errorf("index '%s' does not match tenant regex", index))
+	}
+	if match.baseIndex == "" || match.tenantID == "" {
+		return "", "", withCode(codeTenantRegexMismatch, fmt.Errorf("invalid index '%s'", index))
+	}
+	p.logVerbose("index parse: %s -> base=%s tenant=%s", index, match.baseIndex, match.tenantID)
+	return match.baseIndex, match.tenantID, nil
+}
+
+// tenantRegexMatch matches an index name against the tenant regex, serving hot
+// names from the match cache.
+func (p *Proxy) tenantRegexMatch(index string) (tenantMatch, error) {
+	regex := p.cfg.TenantRegex.Compiled
+	key := matchKey{regex: regex, index: index}
+	if match, ok := p.matches.get(key); ok {
+		return match, nil
+	}
+	matches := regex.FindStringSubmatch(index)
+	if matches == nil {
+		p.matches.add(key, tenantMatch{})
+		return tenantMatch{}, nil
+	}
+	if p.indexGroup >= len(matches) || p.tenantGroup >= len(matches) ||
+		p.prefixGroup >= len(matches) || p.postfixGroup >= len(matches) {
+		return tenantMatch{}, errors.New("tenant regex missing required groups")
+	}
+	match := tenantMatch{matched: true, tenantID: matches[p.tenantGroup]}
+	if p.indexGroup >= 0 {
+		match.baseIndex = matches[p.indexGroup]
+	}
+	if match.baseIndex == "" {
+		match.baseIndex = matches[p.prefixGroup] + matches[p.postfixGroup]
+	}
+	p.matches.add(key, match)
+	return match, nil
+}
+
+// parseClusterIndex parses an index that may name a remote cluster for cross
+// cluster search, such as remote1:orders-tenant1. Only the index part is matched
+// against the tenant regex; the cluster is returned so it can be kept in front
+// of the rendered index with withCluster.
+func (p *Proxy) parseClusterIndex(r *http.Request, index string) (string, string, string, error) {
+	cluster, name, found := strings.Cut(index, ":")
+	if !found {
+		baseIndex, tenantID, err := p.parseIndex(r, index)
+		return "", baseIndex, tenantID, err
+	}
+	if cluster == "" || name == "" {
+		return "", "", "", fmt.Errorf("invalid remote cluster index '%s'", index)
+	}
+	baseIndex, tenantID, err := p.parseIndex(r, name)
+	if err != nil {
+		return "", "", "", err
+	}
+	p.logVerbose("remote index parse: %s -> cluster=%s", index, cluster)
+	return cluster, baseIndex, tenantID, nil
+}
+
+// withCluster prefixes a rendered index with the remote cluster it was
+// requested from.
+func withCluster(cluster, index string) string {
+	if cluster == "" {
+		return index
+	}
+	return cluster + ":" + index
+}
+
+func (p *Proxy) renderAlias(index, tenant string) (string, error) {
+	tmpl := p.sharedGroupFor(index).alias
+	key := nameKey{tmpl: tmpl, index: index, tenant: tenant}
+	if name, ok := p.names.get(key); ok {
+		return name, nil
+	}
+	var builder strings.Builder
+	data := map[string]string{"index": index, "tenant": tenant}
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", fmt.Errorf("render alias: %w", err)
+	}
+	p.names.add(key, builder.String())
+	return builder.String(), nil
+}
+
+func (p *Proxy) renderIndex(tmpl *template.Template, index, tenant string) (string, error) {
+	key := nameKey{tmpl: tmpl, index: index, tenant: tenant}
+	if name, ok := p.names.get(key); ok {
+		return name, nil
+	}
+	var builder strings.Builder
+	data := map[string]string{"index": index, "tenant": tenant}
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", fmt.Errorf("render index: %w", err)
+	}
+	p.names.add(key, builder.String())
+	return builder.String(), nil
+}
+
+func (p *Proxy) isPassthrough(pathValue string) bool {
+	return matchesPathList(p.passthroughs, pathValue)
+}
+
+// isIgnoredPath reports whether the path is in unknown_paths.ignore, such as
+// /favicon.ico requested by browsers and scanners.
+func (p *Proxy) isIgnoredPath(pathValue string) bool {
+	return matchesPathList(p.cfg.UnknownPaths.Ignore, pathValue)
+}
+
+// matchesPathList reports whether the path equals an entry of paths, or starts
+// with an entry ending in *.
+func matchesPathList(paths []string, pathValue string) bool {
+	for _, allowed := range paths {
+		if allowed == "" {
+			continue
+		}
+		if strings.HasSuffix(allowed, "*") {
+			prefix := strings.TrimSuffix(allowed, "*")
+			if strings.HasPrefix(pathValue, prefix) {
+				return true
+			}
+			continue
+		}
+		if pathValue == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) reject(w http.ResponseWriter, code rejectCode, message string) {
+	p.rejectStatus(w, http.StatusBadRequest, code, message)
+}
+
+// rejectError answers a request the proxy cannot rewrite with 403 when it names
+// a denied shared index or a tenant it may not act on and 400 otherwise, with
+// the code err is tagged with.
+func (p *Proxy) rejectError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errSharedIndexAccess) {
+		p.rejectStatus(w, http.StatusForbidden, codeSharedIndexDenied, err.Error())
+		return
+	}
+	switch code := codeOf(err, codeInvalidRequest); code {
+	case codeTenantForbidden, codePermissionDenied, codeNetworkDenied:
+		p.rejectStatus(w, http.StatusForbidden, code, err.Error())
+		return
+	}
+	p.reject(w, codeOf(err, codeInvalidRequest), err.Error())
+}
+
+// rejectStatus answers an unsupported request with a status telling clients
+// why, such as 404 for an unknown endpoint or 403 for a denied index.
+func (p *Proxy) rejectStatus(w http.ResponseWriter, status int, code rejectCode, message string) {
+	p.writeError(w, status, "unsupported_request", code, message)
+}
+
+// rejectMethod answers a method the endpoint does not take with 405 and the
+// methods it does take.
+func (p *Proxy) rejectMethod(w http.ResponseWriter, message string, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	p.rejectStatus(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, message)
+}
+
+// writeError answers with an error in the configured error_format.
+func (p *Proxy) writeError(w http.ResponseWriter, status int, errorType string, code rejectCode, message string) {
+	if !p.elasticsearchErrors() {
+		writeCodedJSONError(w, status, errorType, code, message)
+		return
+	}
+	writeElasticsearchError(w, status, elasticsearchErrorType(status, errorType), code, message)
+}
+
+func (p *Proxy) elasticsearchErrors() bool {
+	return strings.EqualFold(strings.TrimSpace(p.cfg.ErrorFormat), "elasticsearch")
+}
+
+func writeJSONError(w http.ResponseWriter, status int, errorType, message string) {
+	writeCodedJSONError(w, status, errorType, "", message)
+}
+
+// writeCodedJSONError is writeJSONError with the reject code of the error,
+// which is left out when empty.
+func writeCodedJSONError(w http.ResponseWriter, status int, errorType string, code rejectCode, message string) {
+	if hooked := rejectWriterOf(w); hooked != nil {
+		hooked.rejected(status, errorType, message)
+	}
+	payload := map[string]string{
+		"error":   errorType,
+		"message": message,
+	}
+	if code != "" {
+		payload["code"] = string(code)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// writeElasticsearchError writes the error envelope Elasticsearch answers with,
+// which client libraries parse into their exception types. The reject code is
+// added to the error object, where clients ignore unknown fields.
+func writeElasticsearchError(w http.ResponseWriter, status int, errorType string, code rejectCode, reason string) {
+	if hooked := rejectWriterOf(w); hooked != nil {
+		hooked.rejected(status, errorType, reason)
+	}
+	cause := map[string]string{"type": errorType, "reason": reason}
+	envelope := map[string]interface{}{
+		"root_cause": []map[string]string{cause},
+		"type":       errorType,
+		"reason":     reason,
+	}
+	if code != "" {
+		envelope["code"] = string(code)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  envelope,
+		"status": status,
+	})
+}
+
+// elasticsearchErrorType names the Elasticsearch exception closest to an
+// error the proxy answers with.
+func elasticsearchErrorType(status int, errorType string) string {
+	switch errorType {
+	case "unsupported_request":
+		switch status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return "security_exception"
+		case http.StatusNotFound:
+			return "resource_not_found_exception"
+		case http.StatusMethodNotAllowed:
+			return "method_not_allowed_exception"
+		}
+		return "illegal_argument_exception"
+	case "unsupported_media_type":
+		return "media_type_header_exception"
+	}
+	return errorType
+}
+
+func splitPath(pathValue string) []string {
+	trimmed := strings.Trim(pathValue, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+func (p *Proxy) normalizeRequestPath(r *http.Request) (string, error) {
+	rawPath := r.URL.EscapedPath()
+	if rawPath == "" {
+		rawPath = r.URL.Path
+	}
+	decoded, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return "", withCode(codeInvalidPath, errors.New("invalid path encoding"))
+	}
+	if strings.Contains(decoded, "%") {
+		return "", withCode(codeInvalidPath, errors.New("double-encoded path segments are not allowed"))
+	}
+	if hasDotSegments(decoded) {
+		return "", withCode(codeInvalidPath, errors.New("path traversal segments are not allowed"))
+	}
+	cleaned := path.Clean(decoded)
+	if cleaned == "." {
+		cleaned = "/"
+	}
+	r.URL.Path = cleaned
+	r.URL.RawPath = cleaned
+	r.RequestURI = r.URL.RequestURI()
+	return cleaned, nil
+}
+
+func hasDotSegments(pathValue string) bool {
+	for _, segment := range strings.Split(pathValue, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) isScrollOrPitPath(segments []string) bool {
+	if len(segments) == 0 {
+		return false
+	}
+	for i, segment := range segments {
+		if segment == "_pit" {
+			return true
+		}
+		if segment == "_search" && i+1 < len(segments) && segments[i+1] == "scroll" {
+			return true
+		}
+	}
+	return false
+}
+
+func groupIndexes(regex *regexp.Regexp) (int, int, int, int, error) {
+	indexGroup := -1
+	tenantGroup := -1
+	prefixGroup := -1
+	postfixGroup := -1
+	for idx, name := range regex.SubexpNames() {
+		if name == "index" {
+			indexGroup = idx
+		}
+		if name == "tenant" {
+			tenantGroup = idx
+		}
+		if name == "prefix" {
+			prefixGroup = idx
+		}
+		if name == "postfix" {
+			postfixGroup = idx
+		}
+	}
+	if tenantGroup == -1 || prefixGroup == -1 || postfixGroup == -1 {
+		return 0, 0, 0, 0, errors.New("TENANT_REGEX must include named groups 'prefix', 'tenant', and 'postfix'")
+	}
+	return indexGroup, tenantGroup, prefixGroup, postfixGroup, nil
+}
+
+func isSharedMode(mode string) bool {
+	return strings.EqualFold(mode, "shared")
+}
+
+func (p *Proxy) renderTargetIndex(baseIndex, tenantID string) (string, error) {
+	if isSharedMode(p.cfg.Mode) {
+		return p.renderSharedIndex(baseIndex, tenantID)
+	}
+	return p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+}
+
+func (p *Proxy) renderQueryIndex(baseIndex, tenantID string) (string, error) {
+	if isSharedMode(p.cfg.Mode) {
+		return p.renderAlias(baseIndex, tenantID)
+	}
+	return p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+}
+
+func extractMgetIDs(body []byte, index string) ([]string, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	if idsValue, ok := payload["ids"]; ok {
+		ids, err := coerceStringList(idsValue)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, errors.New("mget ids list is empty")
+		}
+		return ids, nil
+	}
+	docsValue, ok := payload["docs"]
+	if !ok {
+		return nil, errors.New("mget body requires docs or ids")
+	}
+	docs, ok := docsValue.([]interface{})
+	if !ok {
+		return nil, errors.New("mget docs must be an array")
+	}
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		entry, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("mget docs entries must be objects")
+		}
+		if idxValue, ok := entry["_index"]; ok {
+			idx, ok := idxValue.(string)
+			if !ok || idx == "" {
+				return nil, errors.New("mget _index must be a string")
+			}
+			if idx != index {
+				return nil, fmt.Errorf("mget _index %q does not match request index %q", idx, index)
+			}
+		}
+		idValue, ok := entry["_id"]
+		if !ok {
+			return nil, errors.New("mget docs entries must include _id")
+		}
+		id, ok := idValue.(string)
+		if !ok || id == "" {
+			return nil, errors.New("mget _id must be a string")
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("mget ids list is empty")
+	}
+	return ids, nil
+}
+
+func buildIDsQuery(ids []string) ([]byte, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("ids query requires at least one id")
+	}
+	payload := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{
+				"values": ids,
+			},
+		},
+		"size": len(ids),
+	}
+	return json.Marshal(payload)
+}
+
+// getOnlyQueryParams are accepted by the get API but rejected by _search, so they
+// are dropped when a get is translated into a search.
+var getOnlyQueryParams = []string{"realtime", "refresh", "version", "version_type"}
+
+// buildVersionedIDsQuery builds an ids search that also returns the version and
+// sequence metadata needed to answer get and mget requests.
+func buildVersionedIDsQuery(ids []string) ([]byte, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("ids query requires at least one id")
+	}
+	payload := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{
+				"values": ids,
+			},
+		},
+		"size":                len(ids),
+		"version":             true,
+		"seq_no_primary_term": true,
+	}
+	return json.Marshal(payload)
+}
+
+// prefixSourceQueryParams prefixes source filtering query parameters with the
+// base index so they match the wrapped document structure.
+func (p *Proxy) prefixSourceQueryParams(r *http.Request, baseIndex string) {
+	q := r.URL.Query()
+	changed := false
+	for _, key := range []string{"_source", "_source_includes", "_source_excludes", "stored_fields"} {
+		value := q.Get(key)
+		if value == "" || value == "true" || value == "false" {
+			continue
+		}
+		fields := strings.Split(value, ",")
+		for i, field := range fields {
+			fields[i] = p.prefixField(baseIndex, strings.TrimSpace(field))
+		}
+		if prefixed := strings.Join(fields, ","); prefixed != value {
+			q.Set(key, prefixed)
+			changed = true
+		}
+	}
+	if changed {
+		r.URL.RawQuery = q.Encode()
+		r.RequestURI = r.URL.RequestURI()
+	}
+}
+
+func (p *Proxy) prefixFieldsQueryParam(r *http.Request, baseIndex string) {
+	q := r.URL.Query()
+	value := q.Get("fields")
+	if value == "" {
+		return
+	}
+	fields := strings.Split(value, ",")
+	for i, field := range fields {
+		fields[i] = p.prefixField(baseIndex, strings.TrimSpace(field))
+	}
+	if setQueryParam(r, q, "fields", strings.Join(fields, ",")) {
+		r.RequestURI = r.URL.RequestURI()
+	}
+}
+
+// prefixSortQueryParam prefixes the fields of a sort query parameter, given as
+// a comma-separated list of field or field:order entries.
+func (p *Proxy) prefixSortQueryParam(r *http.Request, baseIndex string) {
+	q := r.URL.Query()
+	value := q.Get("sort")
+	if value == "" {
+		return
+	}
+	entries := strings.Split(value, ",")
+	for i, entry := range entries {
+		field, order, hasOrder := strings.Cut(strings.TrimSpace(entry), ":")
+		entries[i] = p.prefixField(baseIndex, field)
+		if hasOrder {
+			entries[i] += ":" + order
+		}
+	}
+	if setQueryParam(r, q, "sort", strings.Join(entries, ",")) {
+		r.RequestURI = r.URL.RequestURI()
+	}
+}
+
+// pathDocIDs returns the document id at segment position pos of the request
+// path, if present.
+func pathDocIDs(pathValue string, pos int) []string {
+	segments := splitPath(pathValue)
+	if len(segments) <= pos || segments[pos] == "" {
+		return nil
+	}
+	return []string{segments[pos]}
+}
+
+func coerceStringList(value interface{}) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("ids must be an array")
+	}
+	output := make([]string, 0, len(list))
+	for _, entry := range list {
+		item, ok := entry.(string)
+		if !ok || item == "" {
+			return nil, errors.New("ids must be non-empty strings")
+		}
+		output = append(output, item)
+	}
+	return output, nil
+}
+
+func (p *Proxy) isSystemPassthrough(pathValue string) bool {
+	return strings.HasPrefix(pathValue, "/_cluster") ||
+		strings.HasPrefix(pathValue, "/_cat") ||
+		strings.HasPrefix(pathValue, "/_nodes") ||
+		strings.HasPrefix(pathValue, "/_snapshot") ||
+		strings.HasPrefix(pathValue, "/_searchable_snapshots") ||
+		strings.HasPrefix(pathValue, "/_slm") ||
+		strings.HasPrefix(pathValue, "/_ilm") ||
+		strings.HasPrefix(pathValue, "/_tasks") ||
+		strings.HasPrefix(pathValue, "/_scripts") ||
+		strings.HasPrefix(pathValue, "/_autoscaling") ||
+		strings.HasPrefix(pathValue, "/_migration") ||
+		strings.HasPrefix(pathValue, "/_features") ||
+		strings.HasPrefix(pathValue, "/_security") ||
+		strings.HasPrefix(pathValue, "/_license") ||
+		strings.HasPrefix(pathValue, "/_ml") ||
+		strings.HasPrefix(pathValue, "/_watcher") ||
+		strings.HasPrefix(pathValue, "/_graph") ||
+		strings.HasPrefix(pathValue, "/_ccr") ||
+		strings.HasPrefix(pathValue, "/_alias") ||
+		strings.HasPrefix(pathValue, "/_aliases") ||
+		strings.HasPrefix(pathValue, "/_template") ||
+		strings.HasPrefix(pathValue, "/_index_template") ||
+		strings.HasPrefix(pathValue, "/_component_template") ||
+		strings.HasPrefix(pathValue, "/_query_rules") ||
+		strings.HasPrefix(pathValue, "/_synonyms") ||
+		strings.HasPrefix(pathValue, "/_resolve") ||
+		strings.HasPrefix(pathValue, "/_data_stream") ||
+		strings.HasPrefix(pathValue, "/_dangling")
+}
+
+func (p *Proxy) requestCategory(r *http.Request) (string, string) {
+	if p.isSystemPassthrough(r.URL.Path) || p.isTemplatePassthrough(r.URL.Path) {
+		return requestCategoryPass, ""
+	}
+	indexName, err := p.requestIndexCandidate(r)
+	if err != nil {
+		return requestCategoryTenanted, ""
+	}
+	if _, denied := p.deniedIndex(indexName); denied {
+		return requestCategoryShared, indexName
+	}
+	return requestCategoryTenanted, indexName
+}
+
+func (p *Proxy) requestIndexCandidate(r *http.Request) (string, error) {
+	segments := splitPath(r.URL.Path)
+	if len(segments) == 0 {
+		return "", nil
+	}
+	if strings.HasPrefix(segments[0], "_") {
+		return strings.TrimSpace(r.URL.Query().Get("index")), nil
+	}
+	return segments[0], nil
+}
+
+func (p *Proxy) isTemplatePassthrough(pathValue string) bool {
+	segments := splitPath(pathValue)
+	return len(segments) == 2 && segments[0] == "_render" && segments[1] == "template"
+}
+
+func (p *Proxy) setResponseMode(w http.ResponseWriter, mode string) {
+	w.Header().Set(responseModeHeader, mode)
+}
+
+func (p *Proxy) isCatIndices(pathValue string) bool {
+	segments := splitPath(pathValue)
+	return len(segments) == 2 && segments[0] == "_cat" && segments[1] == "indices"
+}
+
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	if resp == nil {
+		return nil
+	}
+	state := requestStateFrom(resp.Request)
+	if state != nil && state.shadow != nil {
+		p.sendShadow(resp, state.shadow)
+	}
+	if state != nil && state.slow != nil {
+		p.recordSlowQuery(resp, state.slow)
+	}
+	if err := p.rewriteResponse(resp); err != nil {
+		return err
+	}
+	if state != nil && state.cacheKey != "" {
+		if err := p.storeCachedResponse(resp, state); err != nil {
+			return err
+		}
+	}
+	if state != nil && state.invalidate != nil {
+		p.invalidateCache(state.invalidate)
+	}
+	if state != nil && state.usage != nil {
+		p.recordUsage(resp, state)
+	}
+	return nil
+}
+
+func (p *Proxy) rewriteResponse(resp *http.Response) error {
+	if resp == nil || resp.Request == nil {
+		return nil
+	}
+	if state := requestStateFrom(resp.Request); state != nil {
+		if state.audit != nil {
+			p.recordAudit(resp, state.audit)
+		}
+		if state.kind != responseKindNone {
+			return p.rewriteStateResponse(resp, state)
+		}
+	}
+	endpoint := p.catEndpoint(resp.Request.URL.Path)
+	if endpoint == "" || resp.Request.Method != http.MethodGet {
+		return nil
+	}
+	if endpoint != catIndices || p.catTenant(resp.Request) != "" {
+		return p.rewriteCatResponse(resp, endpoint)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if len(body) == 0 {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+	if isJSONMediaType(resp.Header.Get("Content-Type")) {
+		rewritten, err := p.addTenantToCatIndicesJSON(body)
+		if err != nil {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return nil
+		}
+		p.replaceResponseBody(resp, rewritten)
+		return nil
+	}
+	rewritten := p.addTenantToCatIndicesText(body)
+	p.replaceResponseBody(resp, rewritten)
+	return nil
+}
+
+func (p *Proxy) logRequestWithCategory(r *http.Request) {
+	category, indexName := p.requestCategory(r)
+	p.logRequest(r, category, indexName)
+}
+
+func (p *Proxy) logRequest(r *http.Request, category, indexName string) {
+	client := "unknown"
+	if state := requestStateFrom(r); state != nil && state.clientAddr.IsValid() {
+		client = state.clientAddr.String()
+	}
+	if indexName == "" {
+		log.Printf("request: request_id=%s method=%s path=%s category=%s mode=%s client=%s", requestIDFrom(r), r.Method, r.URL.Path, category, p.cfg.Mode, client)
+		return
+	}
+	log.Printf("request: request_id=%s method=%s path=%s category=%s index=%s mode=%s client=%s", requestIDFrom(r), r.Method, r.URL.Path, category, indexName, p.cfg.Mode, client)
+}
+
+func (p *Proxy) logVerbose(format string, args ...interface{}) {
+	if !p.cfg.Verbose {
+		return
+	}
+	log.Printf("verbose: "+format, args...)
+}
+
+// logRequestVerbose is logVerbose for lines about a single request.
+func (p *Proxy) logRequestVerbose(r *http.Request, format string, args ...interface{}) {
+	if !p.cfg.Verbose {
+		return
+	}
+	log.Printf("verbose: request_id=%s "+format, append([]interface{}{requestIDFrom(r)}, args...)...)
+}
+
+// errSharedIndexAccess rejects index names matching shared_index.deny_patterns.
+var errSharedIndexAccess = errors.New("direct access to shared indices is not allowed")
+
+// deniedIndex returns the first index of an index expression taken from a
+// request, such as a comma-separated list or a remote cluster index, that
+// matches a deny pattern. Every index name read from a path, parameter, or body
+// is checked with it, directly or through parseIndex.
+func (p *Proxy) deniedIndex(value string) (string, bool) {
+	if len(p.denyPatterns) == 0 {
+		return "", false
+	}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if _, index, found := strings.Cut(name, ":"); found {
+			name = index
+		}
+		if name != "" && p.isBlockedSharedIndex(name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (p *Proxy) isBlockedSharedIndex(indexName string) bool {
+	for _, pattern := range p.denyPatterns {
+		if pattern != nil && pattern.MatchString(indexName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) addTenantToCatIndicesJSON(body []byte) ([]byte, error) {
+	var payload []map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	for _, item := range payload {
+		indexValue, ok := item["index"].(string)
+		if !ok {
+			continue
+		}
+		if tenantID, ok := p.tenantIDForIndex(indexValue); ok {
+			item["tenant_id"] = tenantID
+		}
+	}
+	return json.Marshal(payload)
+}
+
+func (p *Proxy) addTenantToCatIndicesText(body []byte) []byte {
+	text := string(body)
+	trailingNewline := strings.HasSuffix(text, "\n")
+	trimmed := strings.TrimRight(text, "\n")
+	if trimmed == "" {
+		return body
+	}
+	lines := strings.Split(trimmed, "\n")
+	headerAdded := false
+	for idx, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if !headerAdded && strings.Contains(line, "index") && strings.Contains(line, "health") {
+			lines[idx] = line + " TENANT_ID"
+			headerAdded = true
+			continue
+		}
+		indexValue := fields[len(fields)-1]
+		tenantID, ok := p.tenantIDForIndex(indexValue)
+		if ok {
+			lines[idx] = line + " " + tenantID
+			if !headerAdded {
+				headerAdded = true
+			}
+		} else if headerAdded {
+			lines[idx] = line + " -"
+		}
+	}
+	rewritten := strings.Join(lines, "\n")
+	if trailingNewline {
+		rewritten += "\n"
+	}
+	return []byte(rewritten)
+}
+
+func (p *Proxy) tenantIDForIndex(index string) (string, bool) {
+	match, err := p.tenantRegexMatch(index)
+	if err != nil || !match.matched || match.tenantID == "" {
+		return "", false
+	}
+	return match.tenantID, true
+}
+
+func (p *Proxy) replaceResponseBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
@@ -6,11 +6,12 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path"
 	"regexp"
 	"testing"
 	"text/template"
 
-	"es-tmnt/internal/config"
+	"es-tmnt/pkg/config"
 )
 
 // setupBenchProxy creates a proxy instance for benchmarking
@@ -59,7 +60,7 @@ func BenchmarkParseIndex(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _, err := p.parseIndex(indexName)
+		_, _, err := p.parseIndex(nil, indexName)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -101,6 +102,60 @@ func BenchmarkRenderTemplates(b *testing.B) {
 	})
 }
 
+// BenchmarkRenderNameCache compares rendering names on every request with
+// serving them from the rendered-name cache
+func BenchmarkRenderNameCache(b *testing.B) {
+	for _, cached := range []bool{false, true} {
+		name := "Uncached"
+		if cached {
+			name = "Cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			p := setupBenchProxy("shared")
+			if cached {
+				p.names = newNameCache(nameCacheSize)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.renderAlias("logs", "acme"); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := p.renderTargetIndex("logs", "acme"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMatchCache compares running the tenant regex on every lookup with
+// serving hot index names from the match cache
+func BenchmarkMatchCache(b *testing.B) {
+	for _, cached := range []bool{false, true} {
+		name := "Uncached"
+		if cached {
+			name = "Cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			p := setupBenchProxy("shared")
+			if cached {
+				p.matches = newMatchCache(matchCacheSize)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := p.matchTenantRegex("logs-acme-prod"); err != nil {
+					b.Fatal(err)
+				}
+				if _, ok := p.tenantIDForIndex("logs-acme-prod"); !ok {
+					b.Fatal("expected a tenant")
+				}
+			}
+		})
+	}
+}
+
 // BenchmarkRewriteDocumentBody tests document rewriting overhead
 func BenchmarkRewriteDocumentBody(b *testing.B) {
 	doc := []byte(`{"message":"test log message","level":"info","timestamp":"2024-01-01T00:00:00Z","user_id":"user123","request_id":"req456"}`)
@@ -179,7 +234,7 @@ func BenchmarkRewriteBulkBody(b *testing.B) {
 		p := setupBenchProxy("shared")
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
-			_, err := p.rewriteBulkBody(bulk, "logs-acme-prod")
+			_, err := p.rewriteBulkBody(nil, bulk, "logs-acme-prod")
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -190,7 +245,7 @@ func BenchmarkRewriteBulkBody(b *testing.B) {
 		p := setupBenchProxy("per-tenant")
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
-			_, err := p.rewriteBulkBody(bulk, "logs-acme-prod")
+			_, err := p.rewriteBulkBody(nil, bulk, "logs-acme-prod")
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -204,7 +259,7 @@ func BenchmarkRewriteBulkBody(b *testing.B) {
 		p := setupBenchProxy("shared")
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
-			_, err := p.rewriteBulkBody(bulk100, "logs-acme-prod")
+			_, err := p.rewriteBulkBody(nil, bulk100, "logs-acme-prod")
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -215,7 +270,7 @@ func BenchmarkRewriteBulkBody(b *testing.B) {
 		p := setupBenchProxy("per-tenant")
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
-			_, err := p.rewriteBulkBody(bulk100, "logs-acme-prod")
+			_, err := p.rewriteBulkBody(nil, bulk100, "logs-acme-prod")
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -386,6 +441,65 @@ func BenchmarkIOOperations(b *testing.B) {
 	})
 }
 
+// BenchmarkURLRewrite compares the URL manipulation helpers with splitting and
+// re-joining paths and re-encoding queries on every request
+func BenchmarkURLRewrite(b *testing.B) {
+	segments := []string{"alias-logs-acme", "_doc", "1"}
+
+	b.Run("PathJoin", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = "/" + path.Join(segments...)
+		}
+	})
+
+	b.Run("JoinPath", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = joinPath(segments)
+		}
+	})
+
+	b.Run("SplitAndJoinIndex", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			parts := splitPath("/logs-acme-prod/_search/template")
+			parts[0] = "alias-logs-acme"
+			_ = "/" + path.Join(parts...)
+		}
+	})
+
+	b.Run("ReplaceFirstSegment", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = replaceFirstSegment("/logs-acme-prod/_search/template", "logs-acme-prod", "alias-logs-acme")
+		}
+	})
+
+	req := httptest.NewRequest("GET", "/logs-acme-prod/_doc/1?routing=acme&_source=message&preference=_local", nil)
+	rawQuery := req.URL.RawQuery
+
+	b.Run("EncodeUnchangedQuery", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req.URL.RawQuery = rawQuery
+			q := req.URL.Query()
+			for _, key := range getOnlyQueryParams {
+				q.Del(key)
+			}
+			req.URL.RawQuery = q.Encode()
+		}
+	})
+
+	b.Run("DeleteAbsentQueryParams", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req.URL.RawQuery = rawQuery
+			deleteQueryParams(req, getOnlyQueryParams...)
+		}
+	})
+}
+
 // Helper function to generate bulk payloads
 func generateBulkPayload(numOps int) []byte {
 	var buf bytes.Buffer
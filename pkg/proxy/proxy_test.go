@@ -12,7 +12,7 @@ import (
 	"sync"
 	"testing"
 
-	"es-tmnt/internal/config"
+	"es-tmnt/pkg/config"
 )
 
 type capturedRequest struct {
@@ -21,7 +21,15 @@ type capturedRequest struct {
 	query  string
 	body   []byte
 	method string
+	header http.Header
 	count  int
+	calls  []capturedCall
+}
+
+type capturedCall struct {
+	method string
+	path   string
+	body   []byte
 }
 
 func (c *capturedRequest) handler(w http.ResponseWriter, r *http.Request) {
@@ -33,10 +41,18 @@ func (c *capturedRequest) handler(w http.ResponseWriter, r *http.Request) {
 	c.query = r.URL.RawQuery
 	c.body = body
 	c.method = r.Method
+	c.header = r.Header.Clone()
 	c.count++
+	c.calls = append(c.calls, capturedCall{method: r.Method, path: r.URL.Path, body: body})
 	w.WriteHeader(http.StatusOK)
 }
 
+func (c *capturedRequest) history() []capturedCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]capturedCall(nil), c.calls...)
+}
+
 func (c *capturedRequest) snapshot() (path string, query string, body []byte, method string, count int) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -54,7 +70,12 @@ func queryValue(rawQuery, key string) string {
 func newProxyWithServer(t *testing.T, cfg config.Config) (*Proxy, *capturedRequest) {
 	t.Helper()
 	capture := &capturedRequest{}
-	server := httptest.NewServer(http.HandlerFunc(capture.handler))
+	return newProxyWithUpstream(t, cfg, http.HandlerFunc(capture.handler)), capture
+}
+
+func newProxyWithUpstream(t *testing.T, cfg config.Config, upstream http.Handler, opts ...Option) *Proxy {
+	t.Helper()
+	server := httptest.NewServer(upstream)
 	t.Cleanup(server.Close)
 	cfg.UpstreamURL = server.URL
 	if cfg.TenantRegex.Compiled == nil {
@@ -64,14 +85,14 @@ func newProxyWithServer(t *testing.T, cfg config.Config) (*Proxy, *capturedReque
 		}
 		cfg.TenantRegex.Compiled = compiled
 	}
-	proxyHandler, err := New(cfg)
+	proxyHandler, err := New(cfg, opts...)
 	if err != nil {
 		t.Fatalf("new proxy: %v", err)
 	}
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	transport.Proxy = nil
 	proxyHandler.proxy.Transport = transport
-	return proxyHandler, capture
+	return proxyHandler
 }
 
 func TestSharedIndexSearchRewrite(t *testing.T) {
@@ -181,7 +202,7 @@ func TestIndexPerTenantRejectsUnsupportedQueryType(t *testing.T) {
 	if string(bytes.TrimSpace(capturedBody)) != string(bytes.TrimSpace(expectedBody)) {
 		t.Fatalf("expected body unchanged, got %s", string(capturedBody))
 	}
-	
+
 }
 
 func TestIndexPerTenantBulkRewrite(t *testing.T) {
@@ -242,6 +263,9 @@ func TestBulkRejectsMultipleTenants(t *testing.T) {
 	if rec.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", rec.Code)
 	}
+	if !strings.Contains(rec.Body.String(), "bulk request contains multiple tenants") {
+		t.Fatalf("expected multiple tenants error, got %s", rec.Body.String())
+	}
 }
 
 func TestSharedIndexCreateRewrite(t *testing.T) {
@@ -258,15 +282,21 @@ func TestSharedIndexCreateRewrite(t *testing.T) {
 	if rec.Code != http.StatusOK {
 		t.Fatalf("unexpected status: %d", rec.Code)
 	}
-	path, _, capturedBody, method, _ := capture.snapshot()
-	if method != http.MethodPut {
-		t.Fatalf("expected method PUT, got %s", method)
+	calls := capture.history()
+	if len(calls) != 2 {
+		t.Fatalf("expected index create and alias requests, got %d", len(calls))
 	}
-	if path != "/shared-products" {
-		t.Fatalf("expected path /shared-products, got %q", path)
+	if calls[0].method != http.MethodPut {
+		t.Fatalf("expected method PUT, got %s", calls[0].method)
 	}
-	if string(bytes.TrimSpace(capturedBody)) != string(bytes.TrimSpace(body)) {
-		t.Fatalf("expected body unchanged, got %s", string(capturedBody))
+	if calls[0].path != "/shared-products" {
+		t.Fatalf("expected path /shared-products, got %q", calls[0].path)
+	}
+	if string(bytes.TrimSpace(calls[0].body)) != string(bytes.TrimSpace(body)) {
+		t.Fatalf("expected body unchanged, got %s", string(calls[0].body))
+	}
+	if calls[1].method != http.MethodPost || calls[1].path != "/_aliases" {
+		t.Fatalf("expected alias creation, got %s %s", calls[1].method, calls[1].path)
 	}
 }
 
@@ -547,6 +577,140 @@ func TestRollupIndexPatternRejectsWildcards(t *testing.T) {
 	}
 }
 
+func TestReindexSharedModeRewrite(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	cfg.SharedIndex.AliasTemplate = "alias-{{.index}}-{{.tenant}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"source":{"index":["orders-tenant1","archive-tenant1"],"query":{"match":{"status":"open"}}},"dest":{"index":"orders2-tenant1"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/_reindex", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	path, _, capturedBody, _, _ := capture.snapshot()
+	if path != "/_reindex" {
+		t.Fatalf("expected path /_reindex, got %q", path)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(capturedBody, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	source := payload["source"].(map[string]interface{})
+	indices := source["index"].([]interface{})
+	if indices[0] != "alias-orders-tenant1" || indices[1] != "alias-archive-tenant1" {
+		t.Fatalf("expected source aliases, got %v", indices)
+	}
+	dest := payload["dest"].(map[string]interface{})
+	if dest["index"] != "shared-orders2" {
+		t.Fatalf("expected dest index shared-orders2, got %v", dest["index"])
+	}
+	boolQuery := source["query"].(map[string]interface{})["bool"].(map[string]interface{})
+	filter := boolQuery["filter"].([]interface{})[0].(map[string]interface{})
+	term := filter["term"].(map[string]interface{})
+	if term["tenant_id"] != "tenant1" {
+		t.Fatalf("expected tenant filter, got %v", filter)
+	}
+	must := boolQuery["must"].([]interface{})[0].(map[string]interface{})
+	if _, ok := must["match"]; !ok {
+		t.Fatalf("expected original query under must, got %v", must)
+	}
+}
+
+func TestReindexSharedModeWithoutQuery(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"source":{"index":"orders-tenant1"},"dest":{"index":"orders2-tenant1"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/_reindex", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	_, _, capturedBody, _, _ := capture.snapshot()
+	var payload map[string]interface{}
+	if err := json.Unmarshal(capturedBody, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	source := payload["source"].(map[string]interface{})
+	boolQuery := source["query"].(map[string]interface{})["bool"].(map[string]interface{})
+	if _, ok := boolQuery["must"]; ok {
+		t.Fatalf("expected no must clause, got %v", boolQuery)
+	}
+}
+
+func TestReindexIndexPerTenantRewrite(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}-v1"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"source":{"index":"orders-tenant2","query":{"term":{"status":"open"}}},"dest":{"index":"orders-tenant2"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/_reindex", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	_, _, capturedBody, _, _ := capture.snapshot()
+	var payload map[string]interface{}
+	if err := json.Unmarshal(capturedBody, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	source := payload["source"].(map[string]interface{})
+	if source["index"] != "orders-tenant2-v1" {
+		t.Fatalf("expected source index orders-tenant2-v1, got %v", source["index"])
+	}
+	term := source["query"].(map[string]interface{})["term"].(map[string]interface{})
+	if _, ok := term["orders.status"]; !ok {
+		t.Fatalf("expected prefixed field in source query, got %v", term)
+	}
+}
+
+func TestReindexRejectsInvalidBodies(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	cases := []struct {
+		name   string
+		method string
+		body   string
+	}{
+		{"empty body", http.MethodPost, ``},
+		{"missing source", http.MethodPost, `{"dest":{"index":"orders-tenant1"}}`},
+		{"remote source", http.MethodPost, `{"source":{"remote":{"host":"http://other:9200"},"index":"orders-tenant1"},"dest":{"index":"orders-tenant1"}}`},
+		{"cross tenant", http.MethodPost, `{"source":{"index":"orders-tenant1"},"dest":{"index":"orders-tenant2"}}`},
+		{"mixed source tenants", http.MethodPost, `{"source":{"index":["orders-tenant1","orders-tenant2"]},"dest":{"index":"orders-tenant1"}}`},
+		{"wildcard source", http.MethodPost, `{"source":{"index":"orders-*"},"dest":{"index":"orders-tenant1"}}`},
+		{"different base index", http.MethodPost, `{"source":{"index":"orders-tenant1"},"dest":{"index":"archive-tenant1"}}`},
+		{"missing dest index", http.MethodPost, `{"source":{"index":"orders-tenant1"},"dest":{}}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/_reindex", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream calls, got %d", count)
+	}
+}
+
 func TestMultiSearchRewrite(t *testing.T) {
 	cfg := config.Default()
 	cfg.Mode = "index-per-tenant"
@@ -588,6 +752,76 @@ func TestMultiSearchRewrite(t *testing.T) {
 	}
 }
 
+func TestCrossClusterSearchRewrite(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		wantPath  string
+		wantQuery string
+		wantBody  string
+	}{
+		{name: "search", method: http.MethodPost, path: "/remote1:products-tenant1/_search", body: `{}`, wantPath: "/remote1:alias-products-tenant1/_search"},
+		{name: "root search", method: http.MethodPost, path: "/_search?index=remote1:products-tenant1", body: `{}`, wantPath: "/_search", wantQuery: "index=remote1%3Aalias-products-tenant1"},
+		{name: "count", method: http.MethodGet, path: "/remote1:products-tenant1/_count", wantPath: "/remote1:alias-products-tenant1/_search"},
+		{name: "msearch", method: http.MethodPost, path: "/_msearch", body: "{\"index\":\"remote1:products-tenant1\"}\n{}\n", wantPath: "/_msearch", wantBody: `{"index":"remote1:alias-products-tenant1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			path, query, capturedBody, _, _ := capture.snapshot()
+			if path != tt.wantPath {
+				t.Fatalf("expected path %s, got %s", tt.wantPath, path)
+			}
+			if !strings.Contains(query, tt.wantQuery) {
+				t.Fatalf("expected query containing %s, got %s", tt.wantQuery, query)
+			}
+			if !strings.Contains(string(capturedBody), tt.wantBody) {
+				t.Fatalf("expected body containing %s, got %s", tt.wantBody, capturedBody)
+			}
+		})
+	}
+}
+
+func TestCrossClusterIndexRejected(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		wantErr string
+	}{
+		{name: "write", method: http.MethodPut, path: "/remote1:products-tenant1/_doc/1", body: `{}`, wantErr: "only supported for searches"},
+		{name: "index create", method: http.MethodPut, path: "/remote1:products-tenant1", wantErr: "only supported for searches"},
+		{name: "missing cluster", method: http.MethodPost, path: "/:products-tenant1/_search", body: `{}`, wantErr: "invalid remote cluster index"},
+		{name: "index without tenant", method: http.MethodPost, path: "/remote1:products/_search", body: `{}`, wantErr: "does not match tenant regex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Fatalf("expected rejection containing %q, got %d: %s", tt.wantErr, rec.Code, rec.Body.String())
+			}
+		})
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+}
+
 func TestMultiSearchRejectsEmptyLines(t *testing.T) {
 	cfg := config.Default()
 	cfg.Mode = "index-per-tenant"
@@ -873,6 +1107,74 @@ func TestUpdateEndpoint(t *testing.T) {
 	}
 }
 
+func TestRoutingParam(t *testing.T) {
+	cases := []struct {
+		method string
+		target string
+		body   string
+		path   string
+	}{
+		{method: http.MethodPut, target: "/products-tenant1/_doc/1?routing=user7", body: `{"field":"value"}`, path: "/products/_doc/1"},
+		{method: http.MethodPost, target: "/products-tenant1/_update/1?routing=user7", body: `{"doc":{"field":"value"}}`, path: "/products/_update/1"},
+		{method: http.MethodGet, target: "/products-tenant1/_doc/1?routing=user7", path: "/alias-products-tenant1/_search"},
+		{method: http.MethodPost, target: "/products-tenant1/_delete/1?routing=user7", path: "/alias-products-tenant1/_delete_by_query"},
+		{method: http.MethodPost, target: "/products-tenant1/_search?routing=user7", body: `{}`, path: "/alias-products-tenant1/_search"},
+	}
+	for _, routeByTenant := range []bool{false, true} {
+		cfg := config.Default()
+		cfg.SharedIndex.RouteByTenant = routeByTenant
+		proxyHandler, capture := newProxyWithServer(t, cfg)
+		want := "routing=user7"
+		if routeByTenant {
+			want = "routing=tenant1"
+		}
+		for _, tc := range cases {
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s %s: unexpected status %d: %s", tc.method, tc.target, rec.Code, rec.Body.String())
+			}
+			path, query, _, _, _ := capture.snapshot()
+			if path != tc.path || !strings.Contains(query, want) {
+				t.Fatalf("%s %s (route by tenant %v): expected %s?%s, got %s?%s", tc.method, tc.target, routeByTenant, tc.path, want, path, query)
+			}
+		}
+	}
+
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.SharedIndex.RouteByTenant = true
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/products-tenant1/_doc/1", strings.NewReader(`{"field":"value"}`)))
+	if _, query, _, _, _ := capture.snapshot(); strings.Contains(query, "routing") {
+		t.Fatalf("expected no routing in index-per-tenant mode, got %q", query)
+	}
+}
+
+func TestMultiSearchRoutingByTenant(t *testing.T) {
+	body := "{\"index\":\"products-tenant1\",\"routing\":\"user7\"}\n{}\n{\"index\":\"orders-tenant2\"}\n{}\n"
+	for _, routeByTenant := range []bool{false, true} {
+		cfg := config.Default()
+		cfg.SharedIndex.RouteByTenant = routeByTenant
+		proxyHandler, capture := newProxyWithServer(t, cfg)
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_msearch", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+		}
+		_, _, upstreamBody, _, _ := capture.snapshot()
+		lines := strings.Split(strings.TrimSpace(string(upstreamBody)), "\n")
+		first, second := `"routing":"user7"`, `"index":"alias-orders-tenant2"}`
+		if routeByTenant {
+			first, second = `"routing":"tenant1"`, `"routing":"tenant2"`
+		}
+		if len(lines) != 4 || !strings.Contains(lines[0], first) || !strings.Contains(lines[2], second) {
+			t.Fatalf("route by tenant %v: unexpected msearch headers %q", routeByTenant, lines)
+		}
+	}
+}
+
 func TestUpdateEndpointIndexPerTenant(t *testing.T) {
 	cfg := config.Default()
 	cfg.Mode = "index-per-tenant"
@@ -902,6 +1204,58 @@ func TestUpdateEndpointIndexPerTenant(t *testing.T) {
 	}
 }
 
+func TestIndexPerTenantWithoutSourceWrapping(t *testing.T) {
+	wrapSource := false
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	cfg.IndexPerTenant.WrapSource = &wrapSource
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantPath string
+	}{
+		{name: "index", method: http.MethodPut, path: "/orders-tenant2/_doc/1", body: `{"field1":"a"}`, wantPath: "/orders-tenant2/_doc/1"},
+		{name: "update", method: http.MethodPost, path: "/orders-tenant2/_update/1", body: `{"doc":{"field1":"b"}}`, wantPath: "/orders-tenant2/_update/1"},
+		{name: "search", method: http.MethodPost, path: "/orders-tenant2/_search", body: `{"query":{"term":{"field1":"a"}},"sort":["field2"]}`, wantPath: "/orders-tenant2/_search"},
+		{name: "mapping", method: http.MethodPut, path: "/orders-tenant2/_mapping", body: `{"properties":{"field1":{"type":"keyword"}}}`, wantPath: "/orders-tenant2/_mapping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, cfg)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+			path, _, body, _, _ := capture.snapshot()
+			if path != tt.wantPath {
+				t.Fatalf("expected path %s, got %s", tt.wantPath, path)
+			}
+			if string(body) != tt.body {
+				t.Fatalf("expected body %s to pass through, got %s", tt.body, body)
+			}
+		})
+	}
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"hits":{"hits":[{"_id":"1","_source":{"orders":{"field1":"a"}}}]}}`))
+	})
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders-tenant2/_search", strings.NewReader(`{}`)))
+	if !strings.Contains(rec.Body.String(), `"_source":{"orders":{"field1":"a"}}`) {
+		t.Fatalf("expected source to be returned as stored, got %s", rec.Body.String())
+	}
+}
+
 func TestUpdateEndpointInvalidMethod(t *testing.T) {
 	cfg := config.Default()
 	proxyHandler, _ := newProxyWithServer(t, cfg)
@@ -910,8 +1264,8 @@ func TestUpdateEndpointInvalidMethod(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
 	}
 }
 
@@ -1280,11 +1634,8 @@ func TestSearchTemplateRootEndpoint(t *testing.T) {
 	if path != "/_search/template" {
 		t.Fatalf("expected path /_search/template, got %q", path)
 	}
-	// Note: search template root endpoint doesn't rewrite the index query param
-	// It uses resolveIndex which gets from query, but rewriteIndexPath is called with empty index
-	// So the query param remains unchanged
-	if got := queryValue(query, "index"); got != "orders-tenant2" {
-		t.Fatalf("expected index orders-tenant2 (not rewritten), got %q", got)
+	if got := queryValue(query, "index"); got != "shared-index" {
+		t.Fatalf("expected index shared-index, got %q", got)
 	}
 }
 
@@ -1311,12 +1662,12 @@ func TestDocEndpointInvalidMethod(t *testing.T) {
 	cfg := config.Default()
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	req := httptest.NewRequest(http.MethodGet, "/products-tenant1/_doc/1", nil)
+	req := httptest.NewRequest(http.MethodDelete, "/products-tenant1/_doc/1", nil)
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
 	}
 }
 
@@ -1365,8 +1716,8 @@ func TestBulkRootEndpointInvalidMethod(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
 	}
 }
 
@@ -1393,8 +1744,8 @@ func TestMultiSearchRootEndpointInvalidMethod(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
 	}
 }
 
@@ -1488,8 +1839,8 @@ func TestDeleteEndpointMissingID(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1497,12 +1848,12 @@ func TestMappingEndpointInvalidMethod(t *testing.T) {
 	cfg := config.Default()
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	req := httptest.NewRequest(http.MethodGet, "/products-tenant1/_mapping", nil)
+	req := httptest.NewRequest(http.MethodDelete, "/products-tenant1/_mapping", nil)
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
 	}
 }
 
@@ -1529,8 +1880,8 @@ func TestIndexRootInvalidMethod(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
 	}
 }
 
@@ -1542,8 +1893,8 @@ func TestUpdateEndpointMissingID(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1555,8 +1906,8 @@ func TestGetEndpointMissingID(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1641,8 +1992,8 @@ func TestUnsupportedEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1654,8 +2005,8 @@ func TestUnsupportedSystemEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1667,8 +2018,8 @@ func TestUnsupportedSearchEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1680,8 +2031,8 @@ func TestUnsupportedRenderEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1693,8 +2044,8 @@ func TestUnsupportedValidateEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1706,8 +2057,8 @@ func TestUnsupportedMsearchEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1719,8 +2070,8 @@ func TestUnsupportedQueryEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1732,8 +2083,8 @@ func TestUnsupportedExplainEndpoint(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -1741,12 +2092,12 @@ func TestEmptyPath(t *testing.T) {
 	cfg := config.Default()
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
 	}
 }
 
@@ -2227,23 +2578,47 @@ func TestRenderTemplatePassthrough(t *testing.T) {
 	if path != "/_render/template" {
 		t.Fatalf("expected path /_render/template, got %q", path)
 	}
+	if mode := rec.Header().Get(responseModeHeader); mode != responseModeHandled {
+		t.Fatalf("expected %s mode, got %q", responseModeHandled, mode)
+	}
 }
 
-func TestMsearchTemplatePassthrough(t *testing.T) {
+func TestMsearchTemplateRewritesHeaders(t *testing.T) {
 	cfg := config.Default()
 	proxyHandler, capture := newProxyWithServer(t, cfg)
 
-	req := httptest.NewRequest(http.MethodPost, "/_msearch/template", nil)
+	body := "{\"index\":\"products-tenant1\"}\n{\"id\":\"search\",\"params\":{\"q\":\"shoes\"}}\n"
+	req := httptest.NewRequest(http.MethodPost, "/_msearch/template", strings.NewReader(body))
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
 	if rec.Code != http.StatusOK {
 		t.Fatalf("unexpected status: %d", rec.Code)
 	}
-	path, _, _, _, _ := capture.snapshot()
+	path, _, captured, _, _ := capture.snapshot()
 	if path != "/_msearch/template" {
 		t.Fatalf("expected path /_msearch/template, got %q", path)
 	}
+	if !strings.Contains(string(captured), `"index":"alias-products-tenant1"`) || !strings.Contains(string(captured), `"id":"search"`) {
+		t.Fatalf("expected rewritten header and unchanged id, got %s", captured)
+	}
+}
+
+func TestMsearchTemplateRejectsMixedTenants(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := "{\"index\":[\"products-tenant1\",\"products-tenant2\"]}\n{\"id\":\"search\"}\n"
+	req := httptest.NewRequest(http.MethodPost, "/_msearch/template", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected request to stay off the upstream")
+	}
 }
 
 func TestIndexCreateWithEmptyBody(t *testing.T) {
@@ -2260,9 +2635,9 @@ func TestIndexCreateWithEmptyBody(t *testing.T) {
 	if rec.Code != http.StatusOK {
 		t.Fatalf("unexpected status: %d", rec.Code)
 	}
-	path, _, _, _, _ := capture.snapshot()
-	if path != "/shared-products" {
-		t.Fatalf("expected path /shared-products, got %q", path)
+	calls := capture.history()
+	if len(calls) == 0 || calls[0].path != "/shared-products" {
+		t.Fatalf("expected path /shared-products, got %v", calls)
 	}
 }
 
@@ -2416,8 +2791,8 @@ func TestHandleGetErrorCases(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -2430,8 +2805,8 @@ func TestHandleDeleteErrorCases(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
 	}
 }
 
@@ -2736,62 +3111,76 @@ func TestRewriteIndexQueryParam(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	req := httptest.NewRequest(http.MethodGet, "/_analyze?index=products-tenant1", nil)
-	index, err := proxyHandler.rewriteIndexQueryParam(req, "index")
+	param, err := proxyHandler.parseIndexParam(req, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	index, err := proxyHandler.rewriteIndexParam(req, param, proxyHandler.renderTargetIndex)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if index != "shared-products" {
+	if index != "shared-products" || req.URL.Query().Get("index") != "shared-products" {
 		t.Fatalf("expected shared-products, got %q", index)
 	}
 }
 
-func TestRewriteIndexQueryParamEmpty(t *testing.T) {
+func TestParseIndexParamEmpty(t *testing.T) {
 	cfg := config.Default()
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	req := httptest.NewRequest(http.MethodGet, "/_analyze", nil)
-	index, err := proxyHandler.rewriteIndexQueryParam(req, "index")
+	param, err := proxyHandler.parseIndexParam(req, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if index != "" {
-		t.Fatalf("expected empty string, got %q", index)
-	}
-}
-
-func TestRewriteIndexQueryParamMultiple(t *testing.T) {
-	cfg := config.Default()
-	proxyHandler, _ := newProxyWithServer(t, cfg)
-
-	req := httptest.NewRequest(http.MethodGet, "/_analyze?index=idx1,idx2", nil)
-	_, err := proxyHandler.rewriteIndexQueryParam(req, "index")
-	if err == nil {
-		t.Fatalf("expected error for multiple indices")
-	}
-}
-
-func TestIndexFromQueryMultiple(t *testing.T) {
-	cfg := config.Default()
-	proxyHandler, _ := newProxyWithServer(t, cfg)
-
-	req := httptest.NewRequest(http.MethodGet, "/_search?index=idx1,idx2", nil)
-	_, err := proxyHandler.indexFromQuery(req, "index")
-	if err == nil {
-		t.Fatalf("expected error for multiple indices")
+	if param != nil {
+		t.Fatalf("expected no index parameter, got %+v", param)
 	}
 }
 
-func TestIndexFromQueryEmpty(t *testing.T) {
-	cfg := config.Default()
-	proxyHandler, _ := newProxyWithServer(t, cfg)
-
-	req := httptest.NewRequest(http.MethodGet, "/_search", nil)
-	index, err := proxyHandler.indexFromQuery(req, "index")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if index != "" {
-		t.Fatalf("expected empty string, got %q", index)
+func TestParseIndexParamLists(t *testing.T) {
+	perTenant := config.Default()
+	perTenant.Mode = "index-per-tenant"
+	perTenant.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		value   string
+		remote  bool
+		want    string
+		wantErr string
+	}{
+		{name: "shared list", cfg: config.Default(), value: "orders-tenant1,products-tenant1", want: "alias-orders-tenant1,alias-products-tenant1"},
+		{name: "remote list", cfg: config.Default(), value: "orders-tenant1,remote1:orders-tenant1", remote: true, want: "alias-orders-tenant1,remote1:alias-orders-tenant1"},
+		{name: "duplicate targets", cfg: perTenant, value: "orders-tenant1, orders-tenant1", want: "orders-tenant1"},
+		{name: "multiple tenants", cfg: config.Default(), value: "orders-tenant1,orders-tenant2", wantErr: "multiple tenants"},
+		{name: "different bases per tenant", cfg: perTenant, value: "orders-tenant1,products-tenant1", wantErr: "must share a base index"},
+		{name: "empty name", cfg: config.Default(), value: "orders-tenant1,", wantErr: "must not be empty"},
+		{name: "remote not accepted", cfg: config.Default(), value: "remote1:orders-tenant1", wantErr: "only supported for searches"},
+		{name: "invalid", cfg: config.Default(), value: "idx1,idx2", wantErr: "does not match tenant regex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, _ := newProxyWithServer(t, tt.cfg)
+			req := httptest.NewRequest(http.MethodGet, "/_search?index="+url.QueryEscape(tt.value), nil)
+			param, err := proxyHandler.parseIndexParam(req, tt.remote)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := param.render(proxyHandler.renderQueryIndex)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
 	}
 }
 
@@ -2812,10 +3201,13 @@ func TestResolveIndexFromQuery(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	req := httptest.NewRequest(http.MethodGet, "/_search?index=orders-tenant2", nil)
-	baseIndex, tenantID, err := proxyHandler.resolveIndex("", req)
+	baseIndex, tenantID, err := proxyHandler.resolveIndex("", req, proxyHandler.renderQueryIndex)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if got := req.URL.Query().Get("index"); got != "alias-orders-tenant2" {
+		t.Fatalf("expected the index parameter rewritten, got %q", got)
+	}
 	if baseIndex != "orders" {
 		t.Fatalf("expected orders, got %q", baseIndex)
 	}
@@ -2829,7 +3221,7 @@ func TestResolveIndexFromPath(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	req := httptest.NewRequest(http.MethodGet, "/orders-tenant2/_search", nil)
-	baseIndex, tenantID, err := proxyHandler.resolveIndex("orders-tenant2", req)
+	baseIndex, tenantID, err := proxyHandler.resolveIndex("orders-tenant2", req, proxyHandler.renderQueryIndex)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -2846,35 +3238,23 @@ func TestResolveIndexMissing(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	req := httptest.NewRequest(http.MethodGet, "/_search", nil)
-	_, _, err := proxyHandler.resolveIndex("", req)
+	_, _, err := proxyHandler.resolveIndex("", req, proxyHandler.renderQueryIndex)
 	if err == nil {
 		t.Fatalf("expected error for missing index")
 	}
 }
 
-func TestApplyIndexRewriteWithOriginal(t *testing.T) {
+func TestRewriteIndexPathWithOriginal(t *testing.T) {
 	cfg := config.Default()
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	req := httptest.NewRequest(http.MethodGet, "/orders-tenant2/_search", nil)
-	proxyHandler.applyIndexRewrite(req, "orders-tenant2", "target-index")
+	proxyHandler.rewriteIndexPath(req, "orders-tenant2", "target-index")
 	if req.URL.Path != "/target-index/_search" {
 		t.Fatalf("expected /target-index/_search, got %q", req.URL.Path)
 	}
 }
 
-func TestApplyIndexRewriteWithoutOriginal(t *testing.T) {
-	cfg := config.Default()
-	proxyHandler, _ := newProxyWithServer(t, cfg)
-
-	req := httptest.NewRequest(http.MethodGet, "/_search", nil)
-	proxyHandler.applyIndexRewrite(req, "", "target-index")
-	query := req.URL.Query()
-	if query.Get("index") != "target-index" {
-		t.Fatalf("expected target-index, got %q", query.Get("index"))
-	}
-}
-
 func TestRewriteIndexValueArray(t *testing.T) {
 	cfg := config.Default()
 	cfg.Mode = "shared"
@@ -2882,7 +3262,7 @@ func TestRewriteIndexValueArray(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	value := []interface{}{"orders-tenant1", "products-tenant2"}
-	result, err := proxyHandler.rewriteIndexValue(value, true, false)
+	result, err := proxyHandler.rewriteIndexValue(nil, value, true, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -2903,7 +3283,7 @@ func TestRewriteIndexValueArrayInvalidType(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	value := []interface{}{123}
-	_, err := proxyHandler.rewriteIndexValue(value, true, false)
+	_, err := proxyHandler.rewriteIndexValue(nil, value, true, false)
 	if err == nil {
 		t.Fatalf("expected error for non-string item")
 	}
@@ -2914,7 +3294,7 @@ func TestRewriteIndexValueInvalidType(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	value := 123
-	_, err := proxyHandler.rewriteIndexValue(value, true, false)
+	_, err := proxyHandler.rewriteIndexValue(nil, value, true, false)
 	if err == nil {
 		t.Fatalf("expected error for invalid type")
 	}
@@ -2927,7 +3307,7 @@ func TestRewriteIndexValueArrayIndexPerTenant(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	value := []interface{}{"orders-tenant1"}
-	result, err := proxyHandler.rewriteIndexValue(value, false, false)
+	result, err := proxyHandler.rewriteIndexValue(nil, value, false, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -2946,7 +3326,7 @@ func TestRewriteSourceIndexValueString(t *testing.T) {
 	cfg.SharedIndex.AliasTemplate = "alias-{{.index}}-{{.tenant}}"
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	result, err := proxyHandler.rewriteSourceIndexValue("orders-tenant1")
+	result, err := proxyHandler.rewriteSourceIndexValue(nil, "orders-tenant1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -2961,7 +3341,7 @@ func TestRewriteTargetIndexValueString(t *testing.T) {
 	cfg.SharedIndex.Name = "shared-{{.index}}"
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	result, err := proxyHandler.rewriteTargetIndexValue("orders-tenant1")
+	result, err := proxyHandler.rewriteTargetIndexValue(nil, "orders-tenant1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -2976,7 +3356,7 @@ func TestRewriteIndexNameIndexPerTenant(t *testing.T) {
 	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	result, err := proxyHandler.rewriteIndexName("orders-tenant1", false)
+	result, err := proxyHandler.rewriteIndexName(nil, "orders-tenant1", false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -2991,7 +3371,7 @@ func TestRewriteIndexNameSharedModeAlias(t *testing.T) {
 	cfg.SharedIndex.AliasTemplate = "alias-{{.index}}-{{.tenant}}"
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	result, err := proxyHandler.rewriteIndexName("orders-tenant1", true)
+	result, err := proxyHandler.rewriteIndexName(nil, "orders-tenant1", true)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -3006,7 +3386,7 @@ func TestRewriteIndexNameSharedModeIndex(t *testing.T) {
 	cfg.SharedIndex.Name = "shared-{{.index}}"
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	result, err := proxyHandler.rewriteIndexName("orders-tenant1", false)
+	result, err := proxyHandler.rewriteIndexName(nil, "orders-tenant1", false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -3019,7 +3399,7 @@ func TestRewriteIndexNameInvalidIndex(t *testing.T) {
 	cfg := config.Default()
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	_, err := proxyHandler.rewriteIndexName("invalid", false)
+	_, err := proxyHandler.rewriteIndexName(nil, "invalid", false)
 	if err == nil {
 		t.Fatalf("expected error for invalid index")
 	}
@@ -3095,8 +3475,10 @@ func TestRewriteFieldObjectNonObject(t *testing.T) {
 
 func TestRewriteSortValueNonList(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, config.Default())
-	result := proxyHandler.rewriteSortValue("not a list", "orders")
-	if result != "not a list" {
+	if result := proxyHandler.rewriteSortValue("total", "orders"); result != "orders.total" {
+		t.Fatalf("expected a single sort field prefixed, got %v", result)
+	}
+	if result := proxyHandler.rewriteSortValue(42.0, "orders"); result != 42.0 {
 		t.Fatalf("expected unchanged value, got %v", result)
 	}
 }
@@ -3202,8 +3584,8 @@ func TestAuthRequiredRejectsMissingHeader(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
 	}
 }
 
@@ -3372,7 +3754,7 @@ func TestParseIndexInvalidIndex(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	// Test with index that doesn't match the tenant regex (no dash at all)
-	_, _, err := proxyHandler.parseIndex("nodashes")
+	_, _, err := proxyHandler.parseIndex(nil, "nodashes")
 	if err == nil {
 		t.Fatalf("expected error for invalid index format")
 	}
@@ -3387,7 +3769,7 @@ func TestParseIndexBlockedSharedIndex(t *testing.T) {
 	cfg.SharedIndex.DenyCompiled = []*regexp.Regexp{regexp.MustCompile("^shared-index$")}
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
-	_, _, err := proxyHandler.parseIndex("shared-index")
+	_, _, err := proxyHandler.parseIndex(nil, "shared-index")
 	if err == nil {
 		t.Fatalf("expected error for shared index access")
 	}
@@ -3406,8 +3788,8 @@ func TestRejectDirectSharedIndexAccess(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
 	}
 }
 
@@ -3421,8 +3803,47 @@ func TestRejectEncodedSharedIndexAccess(t *testing.T) {
 	rec := httptest.NewRecorder()
 	proxyHandler.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", rec.Code)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+}
+
+func TestRejectSharedIndexNamedAnywhere(t *testing.T) {
+	cfg := config.Default()
+	cfg.SharedIndex.DenyPatterns = []string{"^shared-index$"}
+	cfg.SharedIndex.DenyCompiled = []*regexp.Regexp{regexp.MustCompile("^shared-index$")}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "index parameter", method: http.MethodPost, path: "/_search?index=shared-index", body: `{}`},
+		{name: "remote cluster", method: http.MethodPost, path: "/remote1:shared-index/_search", body: `{}`},
+		{name: "msearch header", method: http.MethodPost, path: "/_msearch", body: "{\"index\":\"orders-tenant1\"}\n{}\n{\"index\":[\"shared-index\"]}\n{}\n"},
+		{name: "msearch template header", method: http.MethodPost, path: "/_msearch/template", body: "{\"index\":\"shared-index\"}\n{\"id\":\"template\"}\n"},
+		{name: "bulk metadata", method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"shared-index\"}}\n{}\n"},
+		{name: "bulk metadata after valid actions", method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"orders-tenant1\"}}\n{}\n{\"delete\":{\"_index\":\"shared-index\",\"_id\":\"1\"}}\n"},
+		{name: "mget docs", method: http.MethodPost, path: "/_mget", body: `{"docs":[{"_index":"shared-index","_id":"1"}]}`},
+		{name: "reindex source", method: http.MethodPost, path: "/_reindex", body: `{"source":{"index":"shared-index"},"dest":{"index":"orders-tenant1"}}`},
+		{name: "transform source", method: http.MethodPut, path: "/_transform/t1", body: `{"source":{"index":["shared-index"]},"dest":{"index":"orders-tenant1"}}`},
+		{name: "rollup index", method: http.MethodPut, path: "/_rollup/job/r1", body: `{"index_pattern":"orders-tenant1","rollup_index":"shared-index"}`},
+		{name: "system passthrough", method: http.MethodGet, path: "/_alias/shared-index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, cfg)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("expected status 403, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if _, _, _, _, count := capture.snapshot(); count != 0 {
+				t.Fatalf("expected request to stay off the upstream")
+			}
+		})
 	}
 }
 
@@ -3436,7 +3857,7 @@ func TestParseIndexEmptyGroups(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	// Test with index that matches but results in empty baseIndex and tenantID
-	_, _, err := proxyHandler.parseIndex("--")
+	_, _, err := proxyHandler.parseIndex(nil, "--")
 	if err == nil {
 		t.Fatalf("expected error for empty baseIndex/tenantID")
 	}
@@ -3523,7 +3944,7 @@ func TestReject(t *testing.T) {
 	proxyHandler, _ := newProxyWithServer(t, cfg)
 
 	rec := httptest.NewRecorder()
-	proxyHandler.reject(rec, "test error")
+	proxyHandler.reject(rec, codeInvalidRequest, "test error")
 
 	if rec.Code != http.StatusBadRequest {
 		t.Fatalf("expected status 400, got %d", rec.Code)
@@ -3539,6 +3960,9 @@ func TestReject(t *testing.T) {
 	if response["error"] != "unsupported_request" {
 		t.Fatalf("expected unsupported_request error, got %v", response["error"])
 	}
+	if response["code"] != string(codeInvalidRequest) {
+		t.Fatalf("expected INVALID_REQUEST code, got %v", response["code"])
+	}
 }
 
 func TestIsPassthroughEmpty(t *testing.T) {
@@ -3783,3 +4207,281 @@ func TestIsBlockedSharedIndexEmptyPatterns(t *testing.T) {
 		t.Fatalf("expected any-index to not be blocked when no patterns configured")
 	}
 }
+
+func TestTermVectorsRewriteIndexPerTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"fields":["title"],"per_field_analyzer":{"title":"standard"},"doc":{"title":"hello"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_termvectors?fields=title,body", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	path, rawQuery, capturedBody, _, _ := capture.snapshot()
+	if path != "/orders-tenant1/_termvectors" {
+		t.Fatalf("expected path /orders-tenant1/_termvectors, got %q", path)
+	}
+	if queryValue(rawQuery, "fields") != "orders.title,orders.body" {
+		t.Fatalf("expected prefixed fields param, got %q", rawQuery)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(capturedBody, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	if payload["fields"].([]interface{})[0] != "orders.title" {
+		t.Fatalf("expected prefixed fields, got %v", payload["fields"])
+	}
+	if _, ok := payload["per_field_analyzer"].(map[string]interface{})["orders.title"]; !ok {
+		t.Fatalf("expected prefixed per_field_analyzer, got %v", payload["per_field_analyzer"])
+	}
+	doc := payload["doc"].(map[string]interface{})
+	if doc["orders"].(map[string]interface{})["title"] != "hello" {
+		t.Fatalf("expected wrapped doc, got %v", doc)
+	}
+}
+
+func TestTermVectorsByIDWithoutBody(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders-tenant1/_termvectors/1", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	path, _, _, method, _ := capture.snapshot()
+	if method != http.MethodGet || path != "/orders-tenant1/_termvectors/1" {
+		t.Fatalf("unexpected forward: %s %s", method, path)
+	}
+}
+
+func TestMultiTermVectorsRewriteDocs(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}-v1"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"docs":[{"_id":"1","fields":["title"]},{"_index":"users-tenant1","_id":"2","fields":["name"]}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_mtermvectors", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	path, _, capturedBody, _, _ := capture.snapshot()
+	if path != "/orders-tenant1-v1/_mtermvectors" {
+		t.Fatalf("expected path /orders-tenant1-v1/_mtermvectors, got %q", path)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(capturedBody, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	docs := payload["docs"].([]interface{})
+	first := docs[0].(map[string]interface{})
+	if first["fields"].([]interface{})[0] != "orders.title" {
+		t.Fatalf("expected first doc fields prefixed, got %v", first)
+	}
+	second := docs[1].(map[string]interface{})
+	if second["_index"] != "users-tenant1-v1" {
+		t.Fatalf("expected _index rewritten, got %v", second["_index"])
+	}
+	if second["fields"].([]interface{})[0] != "users.name" {
+		t.Fatalf("expected second doc fields prefixed with its index, got %v", second)
+	}
+}
+
+func TestMultiTermVectorsRejectsInvalidBodies(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "cross tenant index", body: `{"docs":[{"_index":"orders-tenant2","_id":"1"}]}`},
+		{name: "index not string", body: `{"docs":[{"_index":5,"_id":"1"}]}`},
+		{name: "docs not array", body: `{"docs":{"_id":"1"}}`},
+		{name: "entry not object", body: `{"docs":["1"]}`},
+		{name: "missing docs and ids", body: `{}`},
+		{name: "empty body", body: ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_mtermvectors", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream requests, got %d", count)
+	}
+}
+
+func TestMultiTermVectorsSharedRewritesIndex(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"docs":[{"_index":"orders-tenant1","_id":"1","fields":["title"]}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_mtermvectors", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	path, _, capturedBody, _, _ := capture.snapshot()
+	if path != "/orders/_mtermvectors" {
+		t.Fatalf("expected path /orders/_mtermvectors, got %q", path)
+	}
+	if !strings.Contains(string(capturedBody), `"_index":"orders"`) || !strings.Contains(string(capturedBody), `"fields":["title"]`) {
+		t.Fatalf("unexpected body: %s", capturedBody)
+	}
+}
+
+func TestSearchKnnSharedAddsTenantFilter(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"knn":{"field":"embedding","query_vector":[0.1,0.2],"k":5,"num_candidates":9007199254740993,"filter":{"term":{"status":"ok"}}}}`)
+	req := httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	_, _, capturedBody, _, _ := capture.snapshot()
+	if !strings.Contains(string(capturedBody), `9007199254740993`) {
+		t.Fatalf("expected large numbers preserved, got %s", capturedBody)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(capturedBody, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	knn := payload["knn"].(map[string]interface{})
+	if knn["field"] != "embedding" {
+		t.Fatalf("expected knn field untouched in shared mode, got %v", knn["field"])
+	}
+	boolQuery := knn["filter"].(map[string]interface{})["bool"].(map[string]interface{})
+	term := boolQuery["filter"].([]interface{})[0].(map[string]interface{})["term"].(map[string]interface{})
+	if term["tenant_id"] != "tenant1" {
+		t.Fatalf("expected tenant term in knn filter, got %v", boolQuery)
+	}
+	if len(boolQuery["must"].([]interface{})) != 1 {
+		t.Fatalf("expected original knn filter kept, got %v", boolQuery)
+	}
+}
+
+func TestMultiSearchKnnSharedAddsTenantFilter(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := []byte("{\"index\":\"products-tenant2\"}\n{\"knn\":[{\"field\":\"embedding\",\"query_vector\":[1],\"k\":1}]}\n")
+	req := httptest.NewRequest(http.MethodPost, "/_msearch", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	_, _, capturedBody, _, _ := capture.snapshot()
+	lines := strings.Split(strings.TrimSpace(string(capturedBody)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two msearch lines, got %q", capturedBody)
+	}
+	if !strings.Contains(lines[1], `{"term":{"tenant_id":"tenant2"}}`) {
+		t.Fatalf("expected tenant term in knn filter, got %s", lines[1])
+	}
+}
+
+func TestSharedEnforceFilterInjectsTenantFilter(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.EnforceFilter = true
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantPath   string
+		wantMust   bool
+		lastNDJSON bool
+	}{
+		{name: "search", method: http.MethodPost, path: "/products-tenant1/_search", body: `{"query":{"match":{"name":"shoe"}}}`, wantPath: "/alias-products-tenant1/_search", wantMust: true},
+		{name: "search without body", method: http.MethodGet, path: "/products-tenant1/_search", wantPath: "/alias-products-tenant1/_search"},
+		{name: "count", method: http.MethodPost, path: "/products-tenant1/_count", body: `{"query":{"match":{"name":"shoe"}}}`, wantPath: "/alias-products-tenant1/_search", wantMust: true},
+		{name: "delete by query", method: http.MethodPost, path: "/products-tenant1/_delete_by_query", body: `{"query":{"match":{"name":"shoe"}}}`, wantPath: "/alias-products-tenant1/_delete_by_query", wantMust: true},
+		{name: "update by query", method: http.MethodPost, path: "/products-tenant1/_update_by_query", body: `{"query":{"match_all":{}},"script":{"source":"ctx._source.n++"}}`, wantPath: "/alias-products-tenant1/_update_by_query", wantMust: true},
+		{name: "msearch", method: http.MethodPost, path: "/_msearch", body: "{\"index\":\"products-tenant1\"}\n{\"query\":{\"match_all\":{}}}\n", wantPath: "/_msearch", wantMust: true, lastNDJSON: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reqBody io.Reader
+			if tt.body != "" {
+				reqBody = strings.NewReader(tt.body)
+			}
+			req := httptest.NewRequest(tt.method, tt.path, reqBody)
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status: %d", rec.Code)
+			}
+			path, _, capturedBody, _, _ := capture.snapshot()
+			if path != tt.wantPath {
+				t.Fatalf("expected path %s, got %q", tt.wantPath, path)
+			}
+			if tt.lastNDJSON {
+				lines := strings.Split(strings.TrimSpace(string(capturedBody)), "\n")
+				capturedBody = []byte(lines[len(lines)-1])
+			}
+			var payload map[string]interface{}
+			if err := json.Unmarshal(capturedBody, &payload); err != nil {
+				t.Fatalf("parse body: %v", err)
+			}
+			boolQuery := payload["query"].(map[string]interface{})["bool"].(map[string]interface{})
+			term := boolQuery["filter"].([]interface{})[0].(map[string]interface{})["term"].(map[string]interface{})
+			if term["tenant_id"] != "tenant1" {
+				t.Fatalf("expected tenant filter, got %v", boolQuery)
+			}
+			if _, ok := boolQuery["must"]; ok != tt.wantMust {
+				t.Fatalf("unexpected must clause presence in %v", boolQuery)
+			}
+		})
+	}
+}
+
+func TestSharedEnforceFilterDisabledLeavesQuery(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"query":{"match":{"name":"shoe"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	_, _, capturedBody, _, _ := capture.snapshot()
+	if string(capturedBody) != body {
+		t.Fatalf("expected body untouched, got %s", capturedBody)
+	}
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// purgeKeepAlive is how long a tenant purge is remembered for progress reports.
+const purgeKeepAlive = 7 * 24 * time.Hour
+
+// tenantPurge records a purge of a tenant's documents: the upstream delete by
+// query tasks in shared mode, the deleted indices in index-per-tenant mode.
+type tenantPurge struct {
+	Tenant         string    `json:"tenant"`
+	StartedAt      time.Time `json:"started_at"`
+	Tasks          []string  `json:"tasks"`
+	DeletedIndices []string  `json:"deleted_indices"`
+}
+
+// purgeTracker keeps the latest purge of every tenant in the state store, so
+// that any replica can report its progress.
+type purgeTracker struct {
+	store stateStore
+}
+
+func newPurgeTracker(store stateStore) *purgeTracker {
+	return &purgeTracker{store: store}
+}
+
+func (t *purgeTracker) add(purge tenantPurge) error {
+	value, err := json.Marshal(purge)
+	if err != nil {
+		return err
+	}
+	return t.store.Set("purge:"+purge.Tenant, string(value), purgeKeepAlive)
+}
+
+func (t *purgeTracker) get(tenantID string) (tenantPurge, bool, error) {
+	value, ok, err := t.store.Get("purge:" + tenantID)
+	if err != nil || !ok {
+		return tenantPurge{}, false, err
+	}
+	var purge tenantPurge
+	if err := json.Unmarshal([]byte(value), &purge); err != nil {
+		return tenantPurge{}, false, fmt.Errorf("decode purge of %s: %w", tenantID, err)
+	}
+	return purge, true, nil
+}
+
+// purgeTaskProgress is the progress of one upstream delete by query task.
+type purgeTaskProgress struct {
+	Task      string          `json:"task"`
+	Completed bool            `json:"completed"`
+	Total     int64           `json:"total"`
+	Deleted   int64           `json:"deleted"`
+	Error     json.RawMessage `json:"error,omitempty"`
+}
+
+// handleTenantData erases a tenant's documents on DELETE
+// /admin/tenants/{id}/data and reports the progress of the latest erasure on
+// GET. Shared mode starts an asynchronous _delete_by_query, filtered by the
+// tenant field, on every shared index the tenant has an alias on.
+// Index-per-tenant mode deletes the tenant's indices.
+func (p *Proxy) handleTenantData(w http.ResponseWriter, r *http.Request, tenantID string) {
+	switch r.Method {
+	case http.MethodDelete:
+		purge, err := p.purgeTenant(r.Context(), tenantID)
+		if err != nil {
+			log.Printf("tenants: purge %s: %v", tenantID, err)
+			writeJSONError(w, http.StatusBadGateway, "upstream_error", err.Error())
+			return
+		}
+		if err := p.purges.add(purge); err != nil {
+			log.Printf("state: %v", err)
+		}
+		log.Printf("tenants: purge of %s started: tasks=%v deleted_indices=%v", tenantID, purge.Tasks, purge.DeletedIndices)
+		writeJSON(w, http.StatusAccepted, purge)
+	case http.MethodGet:
+		purge, ok, err := p.purges.get(tenantID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "state_error", err.Error())
+			return
+		}
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "not_found", fmt.Sprintf("no purge of tenant %s", tenantID))
+			return
+		}
+		tasks := make([]purgeTaskProgress, 0, len(purge.Tasks))
+		completed := true
+		for _, task := range purge.Tasks {
+			progress, err := p.purgeTaskProgress(r.Context(), p.upstreamFor(tenantID), task)
+			if err != nil {
+				writeJSONError(w, http.StatusBadGateway, "upstream_error", err.Error())
+				return
+			}
+			completed = completed && progress.Completed
+			tasks = append(tasks, progress)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"tenant":          purge.Tenant,
+			"started_at":      purge.StartedAt,
+			"completed":       completed,
+			"tasks":           tasks,
+			"deleted_indices": purge.DeletedIndices,
+		})
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for tenant data")
+	}
+}
+
+func (p *Proxy) purgeTenant(ctx context.Context, tenantID string) (tenantPurge, error) {
+	purge := tenantPurge{Tenant: tenantID, StartedAt: time.Now().UTC(), Tasks: []string{}, DeletedIndices: []string{}}
+	upstream := p.upstreamFor(tenantID)
+	if !isSharedMode(p.cfg.Mode) {
+		tenants, err := p.perTenantInventory(ctx, upstream, tenantID)
+		if err != nil {
+			return purge, err
+		}
+		if tenant, ok := tenants[tenantID]; ok {
+			for _, index := range tenant.Indices {
+				if err := p.deleteTenantIndex(ctx, upstream, index); err != nil {
+					return purge, err
+				}
+				p.creator.forget(index)
+				purge.DeletedIndices = append(purge.DeletedIndices, index)
+			}
+		}
+		return purge, nil
+	}
+	tenants, err := p.sharedTenantInventory(ctx, upstream, tenantID)
+	if err != nil {
+		return purge, err
+	}
+	tenant, ok := tenants[tenantID]
+	if !ok {
+		return purge, nil
+	}
+	for _, index := range tenant.Indices {
+		// Each shared index is filtered by its own group's tenant field, so a
+		// data field of another tenant named like some other group's tenant
+		// field never matches.
+		tenantField := p.sharedGroupForIndex(index).tenantField
+		body, err := json.Marshal(map[string]interface{}{
+			"query": map[string]interface{}{"term": map[string]interface{}{tenantField: tenantID}},
+		})
+		if err != nil {
+			return purge, err
+		}
+		task, err := p.startDeleteByQuery(ctx, upstream, index, body)
+		if err != nil {
+			return purge, err
+		}
+		purge.Tasks = append(purge.Tasks, task)
+	}
+	return purge, nil
+}
+
+func (p *Proxy) startDeleteByQuery(ctx context.Context, upstream *upstreamClient, index string, body []byte) (string, error) {
+	pathValue := "/" + url.PathEscape(index) + "/_delete_by_query?conflicts=proceed&wait_for_completion=false"
+	resp, err := upstream.do(ctx, nil, http.MethodPost, pathValue, body)
+	if err != nil {
+		return "", fmt.Errorf("delete by query on %s: %w", index, err)
+	}
+	defer resp.Body.Close()
+	message, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("delete by query on %s: %w", index, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("delete by query on %s: unexpected status %d: %s", index, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	var result struct {
+		Task string `json:"task"`
+	}
+	if err := json.Unmarshal(message, &result); err != nil || result.Task == "" {
+		return "", fmt.Errorf("delete by query on %s: missing task in response", index)
+	}
+	return result.Task, nil
+}
+
+func (p *Proxy) purgeTaskProgress(ctx context.Context, upstream *upstreamClient, task string) (purgeTaskProgress, error) {
+	var result struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Status struct {
+				Total   int64 `json:"total"`
+				Deleted int64 `json:"deleted"`
+			} `json:"status"`
+		} `json:"task"`
+		Error json.RawMessage `json:"error"`
+	}
+	if err := upstreamJSON(ctx, upstream, "/_tasks/"+url.PathEscape(task), &result); err != nil {
+		return purgeTaskProgress{}, err
+	}
+	return purgeTaskProgress{
+		Task:      task,
+		Completed: result.Completed,
+		Total:     result.Task.Status.Total,
+		Deleted:   result.Task.Status.Deleted,
+		Error:     result.Error,
+	}, nil
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+type purgeUpstream struct {
+	mu      sync.Mutex
+	calls   []capturedCall
+	query   []string
+	aliases string
+}
+
+func (u *purgeUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	u.mu.Lock()
+	u.calls = append(u.calls, capturedCall{method: r.Method, path: r.URL.Path, body: body})
+	u.query = append(u.query, r.URL.RawQuery)
+	u.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/_alias" && u.aliases != "":
+		_, _ = io.WriteString(w, u.aliases)
+	case r.URL.Path == "/_alias":
+		_, _ = io.WriteString(w, `{"shared-index":{"aliases":{"alias-orders-tenant1":{},"alias-orders-tenant2":{}}}}`)
+	case strings.HasSuffix(r.URL.Path, "/_count"):
+		_, _ = io.WriteString(w, `{"count":2}`)
+	case strings.HasSuffix(r.URL.Path, "/_delete_by_query"):
+		_, _ = io.WriteString(w, `{"task":"node1:42"}`)
+	case r.URL.Path == "/_tasks/node1:42":
+		_, _ = io.WriteString(w, `{"completed":false,"task":{"status":{"total":10,"deleted":4}}}`)
+	case r.URL.Path == "/_stats/docs,store":
+		_, _ = io.WriteString(w, `{"indices":{"orders-tenant1":{},"products-tenant1":{},"orders-tenant2":{}}}`)
+	default:
+		_, _ = io.WriteString(w, `{"acknowledged":true}`)
+	}
+}
+
+func (u *purgeUpstream) find(method, path string) (capturedCall, string, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i, call := range u.calls {
+		if call.method == method && call.path == path {
+			return call, u.query[i], true
+		}
+	}
+	return capturedCall{}, "", false
+}
+
+func TestPurgeTenantDataSharedMode(t *testing.T) {
+	cfg := config.Default()
+	cfg.SharedIndex.Name = "shared-index"
+	upstream := &purgeUpstream{}
+	admin := newProxyWithUpstream(t, cfg, upstream).AdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/tenants/tenant1/data", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	call, query, ok := upstream.find(http.MethodPost, "/shared-index/_delete_by_query")
+	if !ok {
+		t.Fatalf("expected a delete by query on the shared index")
+	}
+	if string(call.body) != `{"query":{"term":{"tenant_id":"tenant1"}}}` {
+		t.Fatalf("unexpected delete by query body %s", call.body)
+	}
+	if !strings.Contains(query, "wait_for_completion=false") || !strings.Contains(query, "conflicts=proceed") {
+		t.Fatalf("expected an async delete by query, got %q", query)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/tenants/tenant1/data", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	var progress struct {
+		Completed bool                `json:"completed"`
+		Tasks     []purgeTaskProgress `json:"tasks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &progress); err != nil {
+		t.Fatalf("parse progress: %v", err)
+	}
+	if progress.Completed || len(progress.Tasks) != 1 || progress.Tasks[0].Task != "node1:42" || progress.Tasks[0].Deleted != 4 || progress.Tasks[0].Total != 10 {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/tenants/tenant2/data", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a purge, got %d", rec.Code)
+	}
+}
+
+func TestPurgeTenantDataUsesEachGroupsTenantField(t *testing.T) {
+	cfg := config.Default()
+	cfg.SharedIndex.Name = "shared-index"
+	cfg.SharedIndex.Groups = []config.SharedGroup{
+		{Pattern: "logs-*", Name: "shared-{{.index}}", AliasTemplate: "logs-alias-{{.index}}-{{.tenant}}", TenantField: "org"},
+		{Pattern: "metrics", Name: "shared-metrics", AliasTemplate: "metrics-alias-{{.tenant}}", TenantField: "account"},
+	}
+	upstream := &purgeUpstream{aliases: `{
+		"shared-index":{"aliases":{"alias-orders-tenant1":{}}},
+		"shared-logs-app":{"aliases":{"logs-alias-logs-app-tenant1":{}}},
+		"shared-metrics":{"aliases":{"metrics-alias-tenant1":{}}}
+	}`}
+	admin := newProxyWithUpstream(t, cfg, upstream).AdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/tenants/tenant1/data", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	for index, want := range map[string]string{
+		"shared-index":    `{"query":{"term":{"tenant_id":"tenant1"}}}`,
+		"shared-logs-app": `{"query":{"term":{"org":"tenant1"}}}`,
+		"shared-metrics":  `{"query":{"term":{"account":"tenant1"}}}`,
+	} {
+		call, _, ok := upstream.find(http.MethodPost, "/"+index+"/_delete_by_query")
+		if !ok {
+			t.Fatalf("expected a delete by query on %s", index)
+		}
+		if string(call.body) != want {
+			t.Fatalf("expected %s on %s, got %s", want, index, call.body)
+		}
+	}
+}
+
+func TestPurgeTenantDataIndexPerTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	upstream := &purgeUpstream{}
+	admin := newProxyWithUpstream(t, cfg, upstream).AdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/tenants/tenant1/data", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	var purge tenantPurge
+	if err := json.Unmarshal(rec.Body.Bytes(), &purge); err != nil {
+		t.Fatalf("parse purge: %v", err)
+	}
+	if len(purge.DeletedIndices) != 2 {
+		t.Fatalf("expected both tenant indices deleted, got %v", purge.DeletedIndices)
+	}
+	for _, index := range []string{"/orders-tenant1", "/products-tenant1"} {
+		if _, _, ok := upstream.find(http.MethodDelete, index); !ok {
+			t.Fatalf("expected %s deleted", index)
+		}
+	}
+	if _, _, ok := upstream.find(http.MethodDelete, "/orders-tenant2"); ok {
+		t.Fatalf("expected other tenants' indices kept")
+	}
+}
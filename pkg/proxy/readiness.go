@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// readinessProbeName is the index and tenant the name templates are rendered
+// for by the readiness check.
+const readinessProbeName = "readyz"
+
+// upstreamReadiness is the result of probing one upstream cluster.
+type upstreamReadiness struct {
+	URL        string `json:"url"`
+	Required   bool   `json:"required"`
+	Status     string `json:"status"`
+	HTTPStatus int    `json:"http_status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	LatencyMs  int64  `json:"latency_ms"`
+}
+
+// handleReadyz reports whether the proxy can serve requests: it is not
+// draining, the upstream and the clusters of upstreams answer, and the name
+// templates render valid index names. Unlike /healthz, a failed check reports 503 so load balancers hold
+// traffic until the upstream is back. The shadow cluster is probed and
+// reported too, but does not affect readiness since shadow copies are best
+// effort.
+func (p *Proxy) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if p.drain != nil && p.drain.isDraining() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":    "draining",
+			"in_flight": p.drain.inFlight(),
+		})
+		return
+	}
+	upstreams := p.probeUpstreams(r.Context())
+	checks := map[string]string{"upstream": "ok", "templates": "ok"}
+	ready := true
+	if primary := upstreams["primary"]; primary.Status != "ok" {
+		checks["upstream"] = primary.Error
+		ready = false
+	}
+	for name := range p.upstreams {
+		if result := upstreams[name]; result.Status != "ok" {
+			checks["upstream "+name] = result.Error
+			ready = false
+		}
+	}
+	if err := p.checkTemplates(); err != nil {
+		checks["templates"] = err.Error()
+		ready = false
+	}
+	status, body := http.StatusOK, map[string]interface{}{"status": "ready", "checks": checks, "upstreams": upstreams}
+	if !ready {
+		status, body["status"] = http.StatusServiceUnavailable, "not_ready"
+	}
+	writeJSON(w, status, body)
+}
+
+// probeUpstreams probes the upstream, the clusters of upstreams and, when
+// configured, the shadow cluster concurrently, keyed "primary", the upstream
+// name, and "shadow".
+func (p *Proxy) probeUpstreams(ctx context.Context) map[string]upstreamReadiness {
+	timeout := p.cfg.Admin.ReadinessTimeout()
+	upstreams := map[string]upstreamReadiness{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	probe := func(name string, client *http.Client, base *url.URL, required bool) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := probeUpstream(ctx, client, base, timeout)
+			result.Required = required
+			mu.Lock()
+			upstreams[name] = result
+			mu.Unlock()
+		}()
+	}
+	if p.upstream == nil {
+		upstreams["primary"] = upstreamReadiness{Required: true, Status: "unavailable", Error: "no upstream configured"}
+	} else {
+		probe("primary", p.upstream.client, p.upstream.base, true)
+	}
+	for name, upstream := range p.upstreams {
+		probe(name, upstream.client, upstream.base, true)
+	}
+	if p.shadow != nil {
+		probe("shadow", p.shadow.client, p.shadow.base, false)
+	}
+	wg.Wait()
+	return upstreams
+}
+
+// probeUpstream sends HEAD / to the cluster at base. Any answer other than a
+// server error counts as available, since the proxy has no credentials of its
+// own and the cluster may answer 401.
+func probeUpstream(ctx context.Context, client *http.Client, base *url.URL, timeout time.Duration) upstreamReadiness {
+	result := upstreamReadiness{URL: base.Redacted(), Status: "unavailable"}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	target := *base
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/"
+	target.RawPath = ""
+	target.RawQuery = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target.String(), nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	started := time.Now()
+	resp, err := client.Do(req)
+	result.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		result.Error = fmt.Sprintf("upstream unreachable: %v", err)
+		return result
+	}
+	resp.Body.Close()
+	result.HTTPStatus = resp.StatusCode
+	if resp.StatusCode >= http.StatusInternalServerError {
+		result.Error = fmt.Sprintf("upstream answered %d", resp.StatusCode)
+		return result
+	}
+	result.Status = "ok"
+	return result
+}
+
+// checkTemplates renders the alias and index templates of the mode, and the
+// pipeline, policy, and script templates when configured, for a probe index
+// and tenant and checks that the results are valid index names.
+func (p *Proxy) checkTemplates() error {
+	type rendered struct {
+		kind string
+		name string
+		err  error
+	}
+	var names []rendered
+	queryIndex, err := p.renderQueryIndex(readinessProbeName, readinessProbeName)
+	names = append(names, rendered{"query index", queryIndex, err})
+	targetIndex, err := p.renderTargetIndex(readinessProbeName, readinessProbeName)
+	names = append(names, rendered{"target index", targetIndex, err})
+	for _, optional := range []struct {
+		kind string
+		tmpl *template.Template
+	}{{"pipeline", p.pipelineTmpl}, {"policy", p.policyTmpl}, {"script", p.scriptTmpl}} {
+		if optional.tmpl == nil {
+			continue
+		}
+		name, err := p.renderIndex(optional.tmpl, readinessProbeName, readinessProbeName)
+		names = append(names, rendered{optional.kind, name, err})
+	}
+	for _, name := range names {
+		if name.err != nil {
+			return fmt.Errorf("%s template: %w", name.kind, name.err)
+		}
+		if err := validIndexName(name.name); err != nil {
+			return fmt.Errorf("%s template: %w", name.kind, err)
+		}
+	}
+	if isSharedMode(p.cfg.Mode) && queryIndex == targetIndex {
+		return fmt.Errorf("alias template renders the shared index '%s'", targetIndex)
+	}
+	return nil
+}
+
+// validIndexName applies the Elasticsearch naming rules to a rendered name.
+func validIndexName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("renders an empty name")
+	case name != strings.ToLower(name):
+		return fmt.Errorf("name '%s' is not lowercase", name)
+	case strings.ContainsAny(name, "\\/*?\"<>| ,#:"):
+		return fmt.Errorf("name '%s' contains an invalid character", name)
+	case strings.ContainsAny(name[:1], "-_+"):
+		return fmt.Errorf("name '%s' starts with an invalid character", name)
+	}
+	return nil
+}
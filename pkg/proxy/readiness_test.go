@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		mutate     func(*config.Config)
+		upstream   int
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "ready", upstream: http.StatusOK, wantStatus: http.StatusOK, wantBody: `"status":"ready"`},
+		{name: "primary upstream reported", upstream: http.StatusOK, wantStatus: http.StatusOK, wantBody: `"http_status":200,"latency_ms":`},
+		{name: "upstream requires credentials", upstream: http.StatusUnauthorized, wantStatus: http.StatusOK, wantBody: `"upstream":"ok"`},
+		{name: "upstream failing", upstream: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable, wantBody: `"upstream":"upstream answered 503"`},
+		{
+			name: "invalid index template",
+			mutate: func(cfg *config.Config) {
+				cfg.Mode = "index-per-tenant"
+				cfg.IndexPerTenant.IndexTemplate = "{{.index}}/{{.tenant}}"
+			},
+			upstream:   http.StatusOK,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "invalid character",
+		},
+		{
+			name: "alias renders the shared index",
+			mutate: func(cfg *config.Config) {
+				cfg.Mode = "shared"
+				cfg.SharedIndex.AliasTemplate = cfg.SharedIndex.Name
+			},
+			upstream:   http.StatusOK,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "renders the shared index",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			if tt.mutate != nil {
+				tt.mutate(&cfg)
+			}
+			proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(tt.upstream, `{}`))
+			rec := httptest.NewRecorder()
+			proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("expected %d with %s, got %d: %s", tt.wantStatus, tt.wantBody, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestReadyzUpstreamUnreachable(t *testing.T) {
+	proxyHandler := newProxyWithUpstream(t, config.Default(), jsonUpstream(http.StatusOK, `{}`))
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("parse url: %v", err)
+	}
+	proxyHandler.upstream = newUpstreamClient(base)
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "upstream unreachable") {
+		t.Fatalf("expected unreachable upstream, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReadyzProbesUpstreamWithHead(t *testing.T) {
+	methods := make(chan string, 1)
+	proxyHandler := newProxyWithUpstream(t, config.Default(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods <- r.Method + " " + r.URL.Path
+	}))
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected ready, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := <-methods; got != "HEAD /" {
+		t.Fatalf("expected HEAD /, got %s", got)
+	}
+}
+
+func TestReadyzReportsShadowWithoutFailing(t *testing.T) {
+	shadow := httptest.NewServer(http.NotFoundHandler())
+	shadow.Close()
+	cfg := config.Default()
+	cfg.Shadow = config.Shadow{UpstreamURL: shadow.URL, Percent: 10}
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected ready with the shadow down, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Upstreams map[string]upstreamReadiness `json:"upstreams"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode readiness: %v", err)
+	}
+	primary, shadowStatus := body.Upstreams["primary"], body.Upstreams["shadow"]
+	if primary.Status != "ok" || !primary.Required {
+		t.Fatalf("unexpected primary status %+v", primary)
+	}
+	if shadowStatus.Status != "unavailable" || shadowStatus.Required || !strings.Contains(shadowStatus.Error, "upstream unreachable") {
+		t.Fatalf("unexpected shadow status %+v", shadowStatus)
+	}
+}
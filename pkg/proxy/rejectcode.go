@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// rejectCode is the stable, machine-readable cause of an error the proxy
+// answers with, sent in the code field of the error body so clients need not
+// match messages, which may change.
+type rejectCode string
+
+const (
+	codeInvalidRequest         rejectCode = "INVALID_REQUEST"
+	codeInvalidPath            rejectCode = "INVALID_PATH"
+	codeUnsupportedEndpoint    rejectCode = "UNSUPPORTED_ENDPOINT"
+	codeMethodNotAllowed       rejectCode = "METHOD_NOT_ALLOWED"
+	codeUnsupportedFeature     rejectCode = "UNSUPPORTED_FEATURE"
+	codeAuthenticationRequired rejectCode = "AUTHENTICATION_REQUIRED"
+	codeModeOverrideDenied     rejectCode = "MODE_OVERRIDE_DENIED"
+	codeTenantRegexMismatch    rejectCode = "TENANT_REGEX_MISMATCH"
+	codeTenantUnresolved       rejectCode = "TENANT_UNRESOLVED"
+	codeTenantRequired         rejectCode = "TENANT_REQUIRED"
+	codeTenantReserved         rejectCode = "TENANT_RESERVED"
+	codeTenantMismatch         rejectCode = "TENANT_MISMATCH"
+	codeTenantForbidden        rejectCode = "TENANT_FORBIDDEN"
+	codePermissionDenied       rejectCode = "PERMISSION_DENIED"
+	codeNetworkDenied          rejectCode = "NETWORK_DENIED"
+	codeMultipleTenants        rejectCode = "MULTIPLE_TENANTS"
+	codeMultiIndexUnsupported  rejectCode = "MULTI_INDEX_UNSUPPORTED"
+	codeMissingIndex           rejectCode = "MISSING_INDEX"
+	codeInvalidIndexName       rejectCode = "INVALID_INDEX_NAME"
+	codeSharedIndexDenied      rejectCode = "SHARED_INDEX_DENIED"
+	codeMissingBody            rejectCode = "MISSING_BODY"
+	codeBodyReadFailed         rejectCode = "BODY_READ_FAILED"
+	codeInvalidJSON            rejectCode = "INVALID_JSON"
+	codeBodyTooLarge           rejectCode = "BODY_TOO_LARGE"
+	codeLineTooLarge           rejectCode = "LINE_TOO_LARGE"
+	codeTooManyLines           rejectCode = "TOO_MANY_LINES"
+	codeUnsupportedMediaType   rejectCode = "UNSUPPORTED_MEDIA_TYPE"
+	codeWritesFrozen           rejectCode = "WRITES_FROZEN"
+	codeShuttingDown           rejectCode = "SHUTTING_DOWN"
+	codeStateUnavailable       rejectCode = "STATE_UNAVAILABLE"
+	codeUpstreamTimeout        rejectCode = "UPSTREAM_TIMEOUT"
+	codeCORSDenied             rejectCode = "CORS_DENIED"
+)
+
+// rejectCodeInfo documents a reject code in the catalogue served on GET
+// /admin/errors.
+type rejectCodeInfo struct {
+	Code        rejectCode `json:"code"`
+	Status      int        `json:"status"`
+	Description string     `json:"description"`
+}
+
+// rejectCatalogue lists every reject code with the status it is answered with.
+var rejectCatalogue = []rejectCodeInfo{
+	{Code: codeInvalidRequest, Status: http.StatusBadRequest, Description: "The request cannot be rewritten for its tenant; the message tells why."},
+	{Code: codeInvalidPath, Status: http.StatusBadRequest, Description: "The path is badly encoded, double-encoded, or contains traversal segments."},
+	{Code: codeUnsupportedEndpoint, Status: http.StatusNotFound, Description: "The proxy does not support the endpoint."},
+	{Code: codeMethodNotAllowed, Status: http.StatusMethodNotAllowed, Description: "The endpoint does not take the method; the Allow header lists those it takes."},
+	{Code: codeUnsupportedFeature, Status: http.StatusBadRequest, Description: "The request uses a feature that cannot be scoped to a tenant, such as scrolls or SQL cursors."},
+	{Code: codeAuthenticationRequired, Status: http.StatusUnauthorized, Description: "The auth header is required and missing, or the basic auth credentials or API key are not valid."},
+	{Code: codeModeOverrideDenied, Status: http.StatusForbidden, Description: "The request asks for a mode override without the mode override token."},
+	{Code: codeTenantRegexMismatch, Status: http.StatusBadRequest, Description: "An index name does not match the tenant regex."},
+	{Code: codeTenantUnresolved, Status: http.StatusBadRequest, Description: "The tenant resolver found no valid tenant in the request."},
+	{Code: codeTenantRequired, Status: http.StatusBadRequest, Description: "The endpoint lists tenant resources and the request names no tenant."},
+	{Code: codeTenantReserved, Status: http.StatusBadRequest, Description: "The tenant of the request is one of the reserved tenant IDs."},
+	{Code: codeTenantMismatch, Status: http.StatusBadRequest, Description: "A pipeline, policy, or index named by the request belongs to another tenant."},
+	{Code: codeTenantForbidden, Status: http.StatusForbidden, Description: "The request names an index of a tenant other than the one its basic auth user or API key belongs to."},
+	{Code: codePermissionDenied, Status: http.StatusForbidden, Description: "The tenant or API key of the request is not allowed the operation or permission the request needs."},
+	{Code: codeNetworkDenied, Status: http.StatusForbidden, Description: "The tenant of the request is confined to network ranges the client address is not in."},
+	{Code: codeMultipleTenants, Status: http.StatusBadRequest, Description: "The request names indices of more than one tenant."},
+	{Code: codeMultiIndexUnsupported, Status: http.StatusBadRequest, Description: "The request uses an index pattern or list where a single index is required."},
+	{Code: codeMissingIndex, Status: http.StatusBadRequest, Description: "The endpoint requires an index and the request names none."},
+	{Code: codeInvalidIndexName, Status: http.StatusBadRequest, Description: "An index the request would create breaks the index naming policy or collides with a shared index or another tenant's alias."},
+	{Code: codeSharedIndexDenied, Status: http.StatusForbidden, Description: "The request names a shared index directly."},
+	{Code: codeMissingBody, Status: http.StatusBadRequest, Description: "The endpoint requires a body and the request has none."},
+	{Code: codeBodyReadFailed, Status: http.StatusBadRequest, Description: "The request body could not be read."},
+	{Code: codeInvalidJSON, Status: http.StatusBadRequest, Description: "The request body is not valid JSON."},
+	{Code: codeBodyTooLarge, Status: http.StatusRequestEntityTooLarge, Description: "The request body exceeds the configured size limit."},
+	{Code: codeLineTooLarge, Status: http.StatusBadRequest, Description: "An NDJSON line of an _msearch body exceeds the configured size limit."},
+	{Code: codeTooManyLines, Status: http.StatusBadRequest, Description: "An _msearch body has more NDJSON lines than the configured limit."},
+	{Code: codeUnsupportedMediaType, Status: http.StatusUnsupportedMediaType, Description: "The Content-Type of the body is not supported by the endpoint."},
+	{Code: codeWritesFrozen, Status: http.StatusForbidden, Description: "Writes are frozen for maintenance."},
+	{Code: codeShuttingDown, Status: http.StatusServiceUnavailable, Description: "The proxy is draining before shutdown."},
+	{Code: codeStateUnavailable, Status: http.StatusServiceUnavailable, Description: "The shared state store could not be reached."},
+	{Code: codeUpstreamTimeout, Status: http.StatusGatewayTimeout, Description: "The upstream did not answer within the route timeout."},
+	{Code: codeCORSDenied, Status: http.StatusForbidden, Description: "A CORS preflight request comes from an origin, or asks for a method or header, that is not allowed."},
+}
+
+// codedError tags an error with the reject code clients receive for it.
+type codedError struct {
+	code rejectCode
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// withCode tags err with code, unless it already carries one.
+func withCode(code rejectCode, err error) error {
+	var coded *codedError
+	if err == nil || errors.As(err, &coded) {
+		return err
+	}
+	return &codedError{code: code, err: err}
+}
+
+// invalidJSONError reports a body that is not valid JSON.
+func invalidJSONError(err error) error {
+	return withCode(codeInvalidJSON, fmt.Errorf("invalid JSON body: %w", err))
+}
+
+// codeOf returns the reject code err is tagged with, or fallback.
+func codeOf(err error, fallback rejectCode) rejectCode {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return fallback
+}
+
+// handleErrorCatalogue lists the reject codes the proxy answers with.
+func (p *Proxy) handleErrorCatalogue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for errors")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"codes": rejectCatalogue})
+}
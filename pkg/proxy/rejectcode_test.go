@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestRejectCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   rejectCode
+	}{
+		{name: "tenant regex mismatch", method: http.MethodPost, path: "/orders/_search", body: `{}`, code: codeTenantRegexMismatch},
+		{name: "index list", method: http.MethodPut, path: "/orders-tenant1,orders-tenant2/_doc/1", body: `{}`, code: codeMultiIndexUnsupported},
+		{name: "multiple tenants", method: http.MethodPost, path: "/_search?index=orders-tenant1,orders-tenant2", body: `{}`, code: codeMultipleTenants},
+		{name: "missing body", method: http.MethodPost, path: "/orders-tenant1/_delete_by_query", code: codeMissingBody},
+		{name: "invalid JSON", method: http.MethodPut, path: "/orders-tenant1/_doc/1", body: `{`, code: codeInvalidJSON},
+		{name: "shared index", method: http.MethodGet, path: "/shared-index/_search", code: codeSharedIndexDenied},
+		{name: "shared index in bulk", method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"shared-index\"}}\n{}\n", code: codeSharedIndexDenied},
+		{name: "unsupported endpoint", method: http.MethodGet, path: "/_unknown", code: codeUnsupportedEndpoint},
+		{name: "method not allowed", method: http.MethodGet, path: "/_msearch", code: codeMethodNotAllowed},
+		{name: "scroll", method: http.MethodPost, path: "/_search/scroll", body: `{}`, code: codeUnsupportedFeature},
+		{name: "path traversal", method: http.MethodGet, path: "/orders-tenant1/%2e%2e/_search", code: codeInvalidPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.SharedIndex.DenyCompiled = []*regexp.Regexp{regexp.MustCompile("^shared-index$")}
+			proxyHandler, _ := newProxyWithServer(t, cfg)
+			var req *http.Request
+			if tt.body == "" {
+				req = httptest.NewRequest(tt.method, tt.path, nil)
+			} else {
+				req = httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			}
+			if strings.Contains(tt.body, "\n") {
+				req.Header.Set("Content-Type", "application/x-ndjson")
+			}
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			var payload struct {
+				Code rejectCode `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+				t.Fatalf("parse error body %q: %v", rec.Body.String(), err)
+			}
+			if payload.Code != tt.code {
+				t.Fatalf("expected code %s, got %s: %s", tt.code, payload.Code, rec.Body.String())
+			}
+			info, ok := catalogueEntry(tt.code)
+			if !ok {
+				t.Fatalf("code %s missing from the catalogue", tt.code)
+			}
+			if info.Status != rec.Code {
+				t.Fatalf("expected status %d for %s, got %d", info.Status, tt.code, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRejectCodeElasticsearchFormat(t *testing.T) {
+	cfg := config.Default()
+	cfg.ErrorFormat = "elasticsearch"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders/_search", strings.NewReader(`{}`)))
+	var payload struct {
+		Error struct {
+			Type string     `json:"type"`
+			Code rejectCode `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse error body: %v", err)
+	}
+	if payload.Error.Type != "illegal_argument_exception" || payload.Error.Code != codeTenantRegexMismatch {
+		t.Fatalf("unexpected error %+v", payload.Error)
+	}
+}
+
+func TestErrorCatalogueEndpoint(t *testing.T) {
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/errors", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	var payload struct {
+		Codes []rejectCodeInfo `json:"codes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse catalogue: %v", err)
+	}
+	if len(payload.Codes) != len(rejectCatalogue) {
+		t.Fatalf("expected %d codes, got %d", len(rejectCatalogue), len(payload.Codes))
+	}
+	seen := map[rejectCode]bool{}
+	for _, info := range payload.Codes {
+		if seen[info.Code] || info.Status == 0 || info.Description == "" {
+			t.Fatalf("invalid catalogue entry %+v", info)
+		}
+		seen[info.Code] = true
+	}
+}
+
+func catalogueEntry(code rejectCode) (rejectCodeInfo, bool) {
+	for _, info := range rejectCatalogue {
+		if info.Code == code {
+			return info, true
+		}
+	}
+	return rejectCodeInfo{}, false
+}
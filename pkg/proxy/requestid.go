@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	opaqueIDHeader     = "X-Opaque-Id"
+	maxRequestIDLength = 128
+)
+
+// assignRequestID takes the request id from the X-Request-ID header, or
+// generates one, so proxy logs can be matched with Elasticsearch task
+// management and slow logs. The id is forwarded upstream as X-Opaque-Id and
+// echoed back to the client.
+func (p *Proxy) assignRequestID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.Header.Get(requestIDHeader))
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	if state := requestStateFrom(r); state != nil {
+		state.requestID = id
+	}
+	r.Header.Set(opaqueIDHeader, id)
+	w.Header().Set(requestIDHeader, id)
+}
+
+// validRequestID accepts client ids made of characters that are safe to write
+// to log lines and headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(id[:])
+}
+
+func requestIDFrom(r *http.Request) string {
+	if state := requestStateFrom(r); state != nil {
+		return state.requestID
+	}
+	return ""
+}
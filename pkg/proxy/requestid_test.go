@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestRequestIDGeneratedAndForwarded(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	id := rec.Header().Get(requestIDHeader)
+	if len(id) != 32 {
+		t.Fatalf("expected generated request id, got %q", id)
+	}
+	capture.mu.Lock()
+	forwarded := capture.header.Get(opaqueIDHeader)
+	capture.mu.Unlock()
+	if forwarded != id {
+		t.Fatalf("expected upstream X-Opaque-Id %q, got %q", id, forwarded)
+	}
+}
+
+func TestRequestIDAcceptedFromClient(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(`{}`))
+	req.Header.Set(requestIDHeader, "client-id.42")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(requestIDHeader); got != "client-id.42" {
+		t.Fatalf("expected client request id echoed, got %q", got)
+	}
+	capture.mu.Lock()
+	forwarded := capture.header.Get(opaqueIDHeader)
+	capture.mu.Unlock()
+	if forwarded != "client-id.42" {
+		t.Fatalf("expected client request id forwarded, got %q", forwarded)
+	}
+}
+
+func TestRequestIDReplacesInvalidClientID(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	for _, id := range []string{"bad id", "line\nbreak", strings.Repeat("a", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/_unknown", nil)
+		req.Header.Set(requestIDHeader, id)
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		got := rec.Header().Get(requestIDHeader)
+		if got == id || len(got) != 32 {
+			t.Fatalf("expected invalid id %q to be replaced, got %q", id, got)
+		}
+	}
+}
+
+func TestRequestIDOnRejectedRequest(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/_unknown", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound || rec.Header().Get(requestIDHeader) == "" {
+		t.Fatalf("expected rejected request to carry a request id, got %d %v", rec.Code, rec.Header())
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+}
+
+func TestUpstreamClientForwardsRequestID(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	header := http.Header{}
+	header.Set(opaqueIDHeader, "abc123")
+	resp, err := proxyHandler.upstream.do(context.Background(), header, http.MethodHead, "/_alias/alias", nil)
+	if err != nil {
+		t.Fatalf("upstream request: %v", err)
+	}
+	resp.Body.Close()
+	capture.mu.Lock()
+	forwarded := capture.header.Get(opaqueIDHeader)
+	capture.mu.Unlock()
+	if forwarded != "abc123" {
+		t.Fatalf("expected X-Opaque-Id forwarded, got %q", forwarded)
+	}
+}
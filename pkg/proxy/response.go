@@ -0,0 +1,485 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+type responseKind int
+
+const (
+	responseKindNone responseKind = iota
+	responseKindSearch
+	responseKindDoc
+	responseKindGet
+	responseKindExists
+	responseKindMget
+	responseKindCount
+	responseKindIndexCreate
+	responseKindEQL
+	responseKindAliases
+	responseKindPolicies
+	responseKindPipelines
+	responseKindWrite
+	responseKindRootMget
+	responseKindBulk
+	responseKindExplain
+	responseKindIndexKeyed
+	responseKindFieldCaps
+	responseKindRenderTemplate
+	responseKindTask
+)
+
+type requestStateKey struct{}
+
+// requestState carries details resolved while routing a request through to
+// modifyResponse. The reverse proxy clones the inbound context onto the upstream
+// request, so handlers can record state on the inbound request and read it back
+// from resp.Request.
+type requestState struct {
+	requestID   string
+	kind        responseKind
+	baseIndex   string
+	tenantID    string
+	index       string
+	docIDs      []string
+	target      string
+	alias       string
+	audit       *auditEvent
+	usage       *usageRecord
+	bytesIn     *countingBody
+	slow        *slowQuery
+	queryBody   []byte
+	asyncID     string
+	taskIndices map[string]string
+	cacheKey    string
+	invalidate  *cacheScope
+	timeout     time.Duration
+	params      map[string]string
+	originalURI string
+	mgetDocs    []mgetDoc
+	shadow      *shadowCopy
+	pathTenant  string
+	bulk        *bulkSummary
+	diagnostics bool
+	authTenant  string
+	operation   string
+	keyOps      map[string]bool
+	apiKeyID    string
+	clientAddr  netip.Addr
+	upstream    *upstreamClient
+}
+
+func withRequestState(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestStateKey{}, &requestState{}))
+}
+
+func requestStateFrom(r *http.Request) *requestState {
+	if r == nil {
+		return nil
+	}
+	state, _ := r.Context().Value(requestStateKey{}).(*requestState)
+	return state
+}
+
+func (p *Proxy) setResponseKind(r *http.Request, kind responseKind, baseIndex, tenantID string) {
+	state := requestStateFrom(r)
+	if state == nil {
+		return
+	}
+	state.kind = kind
+	state.baseIndex = baseIndex
+	state.tenantID = tenantID
+}
+
+func (p *Proxy) rewriteStateResponse(resp *http.Response, state *requestState) error {
+	switch state.kind {
+	case responseKindSearch:
+		if !p.wrapSource() && !state.diagnostics {
+			return nil
+		}
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			diagnostics := state.diagnostics && p.newDiagnosticsScrubber(state).scrubSearch(payload)
+			if !p.wrapSource() {
+				return payload, diagnostics
+			}
+			hits := unwrapSearchHits(payload["hits"], state.baseIndex)
+			suggest := unwrapSuggestOptions(payload["suggest"], state.baseIndex)
+			return payload, hits || suggest || diagnostics
+		})
+	case responseKindIndexKeyed:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, p.rekeyIndexResponse(payload, state)
+		})
+	case responseKindFieldCaps:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, p.filterFieldCaps(payload, state)
+		})
+	case responseKindRenderTemplate:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, p.rewriteRenderedTemplate(payload, state.baseIndex)
+		})
+	case responseKindExplain:
+		return p.rewriteJSONBody(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, p.newDiagnosticsScrubber(state).scrubExplain(payload)
+		})
+	case responseKindDoc:
+		if !p.wrapSource() {
+			return nil
+		}
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, unwrapHit(payload, state.baseIndex)
+		})
+	case responseKindGet:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			doc, found := p.searchToGetResponse(payload, state)
+			if !found {
+				resp.StatusCode = http.StatusNotFound
+			}
+			return doc, true
+		})
+	case responseKindExists:
+		return p.rewriteExistsResponse(resp)
+	case responseKindCount:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return searchToCountResponse(payload), true
+		})
+	case responseKindIndexCreate:
+		return p.ensureTenantAlias(resp, state)
+	case responseKindMget:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return p.searchToMgetResponse(payload, state), true
+		})
+	case responseKindRootMget:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return p.msearchToMgetResponse(payload, state), true
+		})
+	case responseKindEQL:
+		return p.rewriteEQLResponse(resp, state)
+	case responseKindTask:
+		return p.rewriteTaskResponse(resp, state)
+	case responseKindAliases:
+		if !isSharedMode(p.cfg.Mode) {
+			return nil
+		}
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, p.filterTenantAliases(payload, state.tenantID)
+		})
+	case responseKindPolicies:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, filterTenantNames(payload, p.policyPattern, state.tenantID)
+		})
+	case responseKindPipelines:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, filterTenantNames(payload, p.pipelinePattern, state.tenantID)
+		})
+	case responseKindWrite:
+		if resp.StatusCode != http.StatusConflict {
+			return nil
+		}
+		return p.rewriteJSONBody(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, rewriteConflictIndex(payload, state.index)
+		})
+	case responseKindBulk:
+		return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, rewriteBulkItems(payload, state.bulk.indices)
+		})
+	}
+	return nil
+}
+
+// rewriteExistsResponse turns a size-0 search into the empty 200/404 response of
+// a HEAD existence check. Upstream errors are forwarded unchanged.
+func (p *Proxy) rewriteExistsResponse(resp *http.Response) error {
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	var payload map[string]interface{}
+	if err := unmarshalResponseJSON(body, &payload); err != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+	if searchHitsTotal(payload) > 0 {
+		resp.StatusCode = http.StatusOK
+	} else {
+		resp.StatusCode = http.StatusNotFound
+	}
+	p.replaceResponseBody(resp, nil)
+	return nil
+}
+
+// searchToCountResponse converts a size-0 search response into the count API
+// response shape.
+func searchToCountResponse(payload map[string]interface{}) map[string]interface{} {
+	count := map[string]interface{}{"count": searchHitsTotal(payload)}
+	if shards, ok := payload["_shards"]; ok {
+		count["_shards"] = shards
+	}
+	return count
+}
+
+// searchHitsTotal reads hits.total from a search response in either the object
+// or the rest_total_hits_as_int form.
+func searchHitsTotal(payload map[string]interface{}) int64 {
+	hits, ok := payload["hits"].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	total := hits["total"]
+	if obj, ok := total.(map[string]interface{}); ok {
+		total = obj["value"]
+	}
+	switch typed := total.(type) {
+	case json.Number:
+		value, err := typed.Int64()
+		if err != nil {
+			return 0
+		}
+		return value
+	case float64:
+		return int64(typed)
+	default:
+		return 0
+	}
+}
+
+// searchToGetResponse reshapes an ids search issued for a single document into
+// the get API response format.
+func (p *Proxy) searchToGetResponse(payload map[string]interface{}, state *requestState) (map[string]interface{}, bool) {
+	docID := ""
+	if len(state.docIDs) > 0 {
+		docID = state.docIDs[0]
+	}
+	doc := p.getResponseFromHit(firstSearchHit(payload), state.index, state.baseIndex, docID)
+	return doc, doc["found"] == true
+}
+
+// searchToMgetResponse reshapes an ids search into the mget response format,
+// listing documents in request order and reporting absent ids as not found.
+func (p *Proxy) searchToMgetResponse(payload map[string]interface{}, state *requestState) map[string]interface{} {
+	hitsByID := searchHitsByID(payload)
+	docs := make([]interface{}, 0, len(state.docIDs))
+	for _, id := range state.docIDs {
+		docs = append(docs, p.getResponseFromHit(hitsByID[id], state.index, state.baseIndex, id))
+	}
+	return map[string]interface{}{"docs": docs}
+}
+
+// searchHitsByID indexes the hits of a search response by document id.
+func searchHitsByID(payload map[string]interface{}) map[string]map[string]interface{} {
+	hitsByID := make(map[string]map[string]interface{})
+	hits, ok := payload["hits"].(map[string]interface{})
+	if !ok {
+		return hitsByID
+	}
+	list, _ := hits["hits"].([]interface{})
+	for _, item := range list {
+		hit, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if id, ok := hit["_id"].(string); ok {
+			hitsByID[id] = hit
+		}
+	}
+	return hitsByID
+}
+
+func (p *Proxy) getResponseFromHit(hit map[string]interface{}, index, baseIndex, docID string) map[string]interface{} {
+	doc := map[string]interface{}{
+		"_index": index,
+		"_id":    docID,
+		"found":  false,
+	}
+	if hit == nil {
+		return doc
+	}
+	if p.wrapSource() {
+		unwrapHit(hit, baseIndex)
+	}
+	for _, key := range []string{"_id", "_version", "_seq_no", "_primary_term", "_routing", "_source", "fields"} {
+		if value, ok := hit[key]; ok {
+			doc[key] = value
+		}
+	}
+	doc["found"] = true
+	return doc
+}
+
+func firstSearchHit(payload map[string]interface{}) map[string]interface{} {
+	hits, ok := payload["hits"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	list, ok := hits["hits"].([]interface{})
+	if !ok || len(list) == 0 {
+		return nil
+	}
+	hit, _ := list[0].(map[string]interface{})
+	return hit
+}
+
+// rewriteJSONResponse decodes a successful JSON response body, applies rewrite,
+// and encodes the returned value when rewrite reports a change. Non-JSON,
+// compressed, or unparsable responses are forwarded untouched.
+func (p *Proxy) rewriteJSONResponse(resp *http.Response, rewrite func(map[string]interface{}) (interface{}, bool)) error {
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil
+	}
+	return p.rewriteJSONBody(resp, rewrite)
+}
+
+// rewriteJSONBody is rewriteJSONResponse for responses of any status.
+func (p *Proxy) rewriteJSONBody(resp *http.Response, rewrite func(map[string]interface{}) (interface{}, bool)) error {
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return nil
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	var payload map[string]interface{}
+	if err := unmarshalResponseJSON(body, &payload); err != nil || payload == nil {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+	result, changed := rewrite(payload)
+	if !changed {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+	rewritten, err := json.Marshal(result)
+	if err != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+	p.replaceResponseBody(resp, rewritten)
+	return nil
+}
+
+// unmarshalResponseJSON decodes upstream JSON keeping numbers as json.Number so
+// large document values survive a round trip unchanged.
+func unmarshalResponseJSON(body []byte, target interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
+
+// unwrapSearchHits restores the flat document shape for every hit in a search
+// hits section, including inner hits.
+func unwrapSearchHits(value interface{}, baseIndex string) bool {
+	hits, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	list, ok := hits["hits"].([]interface{})
+	if !ok {
+		return false
+	}
+	changed := false
+	for _, item := range list {
+		hit, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if unwrapHit(hit, baseIndex) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// unwrapSuggestOptions restores the flat document shape of the documents
+// completion suggestions return with their options.
+func unwrapSuggestOptions(value interface{}, baseIndex string) bool {
+	suggest, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	changed := false
+	for _, entries := range suggest {
+		list, ok := entries.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			options, ok := entry["options"].([]interface{})
+			if !ok {
+				continue
+			}
+			for _, option := range options {
+				hit, ok := option.(map[string]interface{})
+				if ok && unwrapHit(hit, baseIndex) {
+					changed = true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+func unwrapHit(hit map[string]interface{}, baseIndex string) bool {
+	changed := false
+	if source, ok := hit["_source"].(map[string]interface{}); ok && len(source) == 1 {
+		if inner, ok := source[baseIndex].(map[string]interface{}); ok {
+			hit["_source"] = inner
+			changed = true
+		}
+	}
+	for _, key := range []string{"fields", "highlight"} {
+		values, ok := hit[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if stripped, ok := stripFieldPrefixes(values, baseIndex); ok {
+			hit[key] = stripped
+			changed = true
+		}
+	}
+	if innerHits, ok := hit["inner_hits"].(map[string]interface{}); ok {
+		for _, inner := range innerHits {
+			innerResult, ok := inner.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if unwrapSearchHits(innerResult["hits"], baseIndex) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func stripFieldPrefixes(values map[string]interface{}, baseIndex string) (map[string]interface{}, bool) {
+	prefix := baseIndex + "."
+	changed := false
+	output := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if strings.HasPrefix(key, prefix) {
+			output[strings.TrimPrefix(key, prefix)] = value
+			changed = true
+			continue
+		}
+		output[key] = value
+	}
+	return output, changed
+}
@@ -0,0 +1,511 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func jsonUpstream(status int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	})
+}
+
+func TestSearchResponseUnwrapIndexPerTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	upstreamBody := `{"took":1,"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_index":"orders-tenant1","_id":"1","_source":{"orders":{"field1":"value","big":9007199254740993}},"fields":{"orders.field1":["value"]},"highlight":{"orders.field1":["<em>value</em>"]},"inner_hits":{"latest":{"hits":{"hits":[{"_id":"2","_source":{"orders":{"field1":"other"}}}]}}}}]}}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, upstreamBody))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search", strings.NewReader(`{"query":{"match":{"field1":"value"}}}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"big":9007199254740993`) {
+		t.Fatalf("expected large numbers preserved, got %s", rec.Body.String())
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	hit := payload["hits"].(map[string]interface{})["hits"].([]interface{})[0].(map[string]interface{})
+	source := hit["_source"].(map[string]interface{})
+	if source["field1"] != "value" {
+		t.Fatalf("expected unwrapped _source, got %v", source)
+	}
+	if _, ok := hit["fields"].(map[string]interface{})["field1"]; !ok {
+		t.Fatalf("expected unprefixed fields, got %v", hit["fields"])
+	}
+	if _, ok := hit["highlight"].(map[string]interface{})["field1"]; !ok {
+		t.Fatalf("expected unprefixed highlight, got %v", hit["highlight"])
+	}
+	inner := hit["inner_hits"].(map[string]interface{})["latest"].(map[string]interface{})
+	innerHit := inner["hits"].(map[string]interface{})["hits"].([]interface{})[0].(map[string]interface{})
+	if innerHit["_source"].(map[string]interface{})["field1"] != "other" {
+		t.Fatalf("expected unwrapped inner hit, got %v", innerHit)
+	}
+}
+
+func TestSearchResponseUnwrapsCompletionSuggestions(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	upstreamBody := `{"took":1,"hits":{"hits":[]},"suggest":{"names":[{"text":"jo","offset":0,"length":2,"options":[{"text":"John","_index":"orders-tenant1","_id":"1","_score":1,"_source":{"orders":{"name":"John"}}}]}],"spelling":[{"text":"tset","offset":0,"length":4,"options":[{"text":"test","score":0.75,"freq":3}]}]}}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, upstreamBody))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search", strings.NewReader(`{"suggest":{"names":{"prefix":"jo","completion":{"field":"name_suggest"}}}}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	var payload struct {
+		Suggest map[string][]struct {
+			Options []map[string]interface{} `json:"options"`
+		} `json:"suggest"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	option := payload.Suggest["names"][0].Options[0]
+	if source, _ := option["_source"].(map[string]interface{}); source["name"] != "John" {
+		t.Fatalf("expected unwrapped suggestion source, got %s", rec.Body.String())
+	}
+	if payload.Suggest["spelling"][0].Options[0]["text"] != "test" {
+		t.Fatalf("expected term suggestions kept, got %s", rec.Body.String())
+	}
+}
+
+func TestGetResponseUnwrapIndexPerTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	upstreamBody := `{"hits":{"hits":[{"_id":"1","_source":{"orders":{"field1":"value"}}}]}}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, upstreamBody))
+
+	req := httptest.NewRequest(http.MethodGet, "/orders-tenant1/_get/1", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if !strings.Contains(rec.Body.String(), `"_source":{"field1":"value"}`) {
+		t.Fatalf("expected unwrapped _source, got %s", rec.Body.String())
+	}
+}
+
+func TestSearchResponseSharedModeUntouched(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	upstreamBody := `{"hits":{"hits":[{"_id":"1","_source":{"orders":{"field1":"value"}}}]}}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, upstreamBody))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Body.String() != upstreamBody {
+		t.Fatalf("expected body untouched, got %s", rec.Body.String())
+	}
+}
+
+func TestSearchResponseErrorUntouched(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	upstreamBody := `{"error":{"type":"index_not_found_exception"},"status":404}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusNotFound, upstreamBody))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+	if rec.Body.String() != upstreamBody {
+		t.Fatalf("expected body untouched, got %s", rec.Body.String())
+	}
+}
+
+func TestRewriteJSONResponseSkipsCompressedBodies(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	body := []byte{0x1f, 0x8b, 0x08}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Encoding", "gzip")
+	called := false
+	if err := proxyHandler.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+		called = true
+		return payload, true
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if called {
+		t.Fatalf("expected compressed body to be skipped")
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(got, body) {
+		t.Fatalf("expected body untouched, got %v", got)
+	}
+}
+
+func TestUnwrapHitLeavesForeignSourceAlone(t *testing.T) {
+	hit := map[string]interface{}{
+		"_source": map[string]interface{}{"orders": map[string]interface{}{"a": 1}, "other": 2},
+	}
+	if unwrapHit(hit, "orders") {
+		t.Fatalf("expected no change for multi-key source")
+	}
+}
+
+func TestDocGetSharedModeTranslatesToSearch(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	var capturedPath, capturedQuery string
+	var capturedBody []byte
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedPath = r.URL.Path
+		capturedQuery = r.URL.RawQuery
+		capturedBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"hits":{"hits":[{"_index":"products","_id":"1","_version":3,"_seq_no":7,"_primary_term":1,"_source":{"name":"shoe","tenant_id":"tenant1"}}]}}`)
+	})
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	req := httptest.NewRequest(http.MethodGet, "/products-tenant1/_doc/1?realtime=true&_source_includes=name", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if capturedPath != "/alias-products-tenant1/_search" {
+		t.Fatalf("expected alias search path, got %q", capturedPath)
+	}
+	if queryValue(capturedQuery, "realtime") != "" {
+		t.Fatalf("expected realtime param dropped, got %q", capturedQuery)
+	}
+	if queryValue(capturedQuery, "_source_includes") != "name" {
+		t.Fatalf("expected _source_includes kept, got %q", capturedQuery)
+	}
+	if !strings.Contains(string(capturedBody), `"seq_no_primary_term":true`) {
+		t.Fatalf("expected seq_no_primary_term in search body, got %s", capturedBody)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if payload["found"] != true || payload["_id"] != "1" || payload["_index"] != "products-tenant1" {
+		t.Fatalf("unexpected get response: %v", payload)
+	}
+	if payload["_seq_no"] != float64(7) || payload["_version"] != float64(3) {
+		t.Fatalf("expected version metadata, got %v", payload)
+	}
+	if payload["_source"].(map[string]interface{})["name"] != "shoe" {
+		t.Fatalf("expected _source, got %v", payload["_source"])
+	}
+	if _, ok := payload["hits"]; ok {
+		t.Fatalf("expected search envelope removed, got %v", payload)
+	}
+}
+
+func TestDocGetSharedModeNotFound(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{"hits":{"total":{"value":0},"hits":[]}}`))
+
+	req := httptest.NewRequest(http.MethodGet, "/products-tenant1/_doc/missing", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if payload["found"] != false || payload["_id"] != "missing" {
+		t.Fatalf("unexpected get response: %v", payload)
+	}
+}
+
+func TestDocGetIndexPerTenantForwardsGet(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}-v1"
+	var capturedMethod, capturedPath, capturedQuery string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedMethod = r.Method
+		capturedPath = r.URL.Path
+		capturedQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"_index":"orders-tenant2-v1","_id":"1","found":true,"_source":{"orders":{"field1":"value"}}}`)
+	})
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders-tenant2/_doc/1?_source_includes=field1,orders.field2", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if capturedMethod != http.MethodGet || capturedPath != "/orders-tenant2-v1/_doc/1" {
+		t.Fatalf("expected GET /orders-tenant2-v1/_doc/1, got %s %s", capturedMethod, capturedPath)
+	}
+	if got := queryValue(capturedQuery, "_source_includes"); got != "orders.field1,orders.field2" {
+		t.Fatalf("expected prefixed _source_includes, got %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), `"_source":{"field1":"value"}`) {
+		t.Fatalf("expected unwrapped _source, got %s", rec.Body.String())
+	}
+}
+
+func TestDocGetMissingID(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/products-tenant1/_doc", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+}
+
+func TestDocHeadSharedModeExists(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"found", `{"hits":{"total":{"value":1,"relation":"eq"},"hits":[]}}`, http.StatusOK},
+		{"found as int", `{"hits":{"total":1,"hits":[]}}`, http.StatusOK},
+		{"missing", `{"hits":{"total":{"value":0,"relation":"eq"},"hits":[]}}`, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Mode = "shared"
+			var capturedMethod, capturedPath string
+			upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				capturedMethod = r.Method
+				capturedPath = r.URL.Path
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, tc.body)
+			})
+			proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+			req := httptest.NewRequest(http.MethodHead, "/products-tenant1/_doc/1", nil)
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if capturedMethod != http.MethodPost || capturedPath != "/alias-products-tenant1/_search" {
+				t.Fatalf("expected POST alias search, got %s %s", capturedMethod, capturedPath)
+			}
+			if rec.Body.Len() != 0 {
+				t.Fatalf("expected empty body, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDocHeadIndexPerTenantForwardsHead(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}-v1"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodHead, "/orders-tenant2/_doc/1", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	path, _, _, method, _ := capture.snapshot()
+	if method != http.MethodHead || path != "/orders-tenant2-v1/_doc/1" {
+		t.Fatalf("expected HEAD /orders-tenant2-v1/_doc/1, got %s %s", method, path)
+	}
+}
+
+func TestIndexHeadRewrite(t *testing.T) {
+	cases := []struct {
+		mode     string
+		wantPath string
+	}{
+		{"shared", "/alias-products-tenant1"},
+		{"index-per-tenant", "/products-tenant1-v1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.mode, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Mode = tc.mode
+			cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}-v1"
+			proxyHandler, capture := newProxyWithServer(t, cfg)
+
+			req := httptest.NewRequest(http.MethodHead, "/products-tenant1", nil)
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status: %d", rec.Code)
+			}
+			path, _, _, method, _ := capture.snapshot()
+			if method != http.MethodHead || path != tc.wantPath {
+				t.Fatalf("expected HEAD %s, got %s %s", tc.wantPath, method, path)
+			}
+		})
+	}
+}
+
+func TestMgetResponseSharedModeOrdersDocs(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	upstreamBody := `{"hits":{"hits":[{"_index":"products","_id":"3","_version":1,"_source":{"name":"hat"}},{"_index":"products","_id":"1","_version":2,"_seq_no":4,"_primary_term":1,"_source":{"name":"shoe"}}]}}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, upstreamBody))
+
+	req := httptest.NewRequest(http.MethodPost, "/products-tenant1/_mget", strings.NewReader(`{"ids":["1","2","3"]}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	docs, ok := payload["docs"].([]interface{})
+	if !ok || len(docs) != 3 {
+		t.Fatalf("expected three docs, got %v", payload)
+	}
+	first := docs[0].(map[string]interface{})
+	if first["_id"] != "1" || first["found"] != true || first["_index"] != "products-tenant1" || first["_seq_no"] != float64(4) {
+		t.Fatalf("unexpected first doc: %v", first)
+	}
+	second := docs[1].(map[string]interface{})
+	if second["_id"] != "2" || second["found"] != false {
+		t.Fatalf("expected missing doc reported as not found, got %v", second)
+	}
+	if _, ok := second["_source"]; ok {
+		t.Fatalf("expected no _source for missing doc, got %v", second)
+	}
+	third := docs[2].(map[string]interface{})
+	if third["_id"] != "3" || third["found"] != true || third["_source"].(map[string]interface{})["name"] != "hat" {
+		t.Fatalf("unexpected third doc: %v", third)
+	}
+	if _, ok := payload["hits"]; ok {
+		t.Fatalf("expected search envelope removed, got %v", payload)
+	}
+}
+
+func TestMgetResponseIndexPerTenantUnwrapsSource(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	var capturedBody []byte
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"hits":{"hits":[{"_index":"orders-tenant1","_id":"a","_source":{"orders":{"field1":"value"}}}]}}`)
+	})
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_mget", strings.NewReader(`{"docs":[{"_id":"a"},{"_id":"b"}]}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if !strings.Contains(string(capturedBody), `"version":true`) {
+		t.Fatalf("expected version in search body, got %s", capturedBody)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	docs := payload["docs"].([]interface{})
+	first := docs[0].(map[string]interface{})
+	if first["_source"].(map[string]interface{})["field1"] != "value" {
+		t.Fatalf("expected unwrapped _source, got %v", first)
+	}
+	if docs[1].(map[string]interface{})["found"] != false {
+		t.Fatalf("expected missing doc reported as not found, got %v", docs[1])
+	}
+}
+
+func TestCountResponseReshaped(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	var capturedBody []byte
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"took":2,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},"hits":{"total":{"value":12345,"relation":"eq"},"hits":[]}}`)
+	})
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	req := httptest.NewRequest(http.MethodGet, "/products-tenant1/_count", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if !strings.Contains(string(capturedBody), `"track_total_hits":true`) {
+		t.Fatalf("expected track_total_hits in search body, got %s", capturedBody)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if payload["count"] != float64(12345) {
+		t.Fatalf("expected count 12345, got %v", payload)
+	}
+	if _, ok := payload["_shards"]; !ok {
+		t.Fatalf("expected _shards kept, got %v", payload)
+	}
+	if _, ok := payload["hits"]; ok {
+		t.Fatalf("expected search envelope removed, got %v", payload)
+	}
+}
+
+func TestCountResponseIntTotal(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{"hits":{"total":7,"hits":[]}}`))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_count?rest_total_hits_as_int=true", strings.NewReader(`{"query":{"match":{"field1":"value"}}}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if strings.TrimSpace(rec.Body.String()) != `{"count":7}` {
+		t.Fatalf("unexpected count response: %s", rec.Body.String())
+	}
+}
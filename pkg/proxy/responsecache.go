@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+const responseCacheHeader = "X-ES-TMNT-Cache"
+
+// cachedResponse is a search response kept for the tenant that made it.
+type cachedResponse struct {
+	key         string
+	tenantID    string
+	baseIndex   string
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// responseCacheStats is the admin view of the response cache.
+type responseCacheStats struct {
+	Entries int     `json:"entries"`
+	Bytes   int64   `json:"bytes"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// responseCache is an LRU cache of search responses whose entries expire after
+// a TTL. It is bounded by the number of entries and the cached body bytes. A
+// nil cache never hits.
+type responseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	bytes      int64
+	order      *list.List
+	entries    map[string]*list.Element
+	hits       int64
+	misses     int64
+	now        func() time.Time
+}
+
+func newResponseCache(cfg config.ResponseCache) *responseCache {
+	if cfg.MaxEntries <= 0 {
+		return nil
+	}
+	return &responseCache{
+		maxEntries: cfg.MaxEntries,
+		maxBytes:   cfg.MaxBytes,
+		ttl:        time.Duration(cfg.TTLSeconds) * time.Second,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+func (c *responseCache) get(key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if ok && c.now().After(element.Value.(*cachedResponse).expires) {
+		c.remove(element)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*cachedResponse), true
+}
+
+func (c *responseCache) add(entry *cachedResponse) {
+	size := int64(len(entry.body))
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[entry.key]; ok {
+		c.remove(element)
+	}
+	entry.expires = c.now().Add(c.ttl)
+	c.entries[entry.key] = c.order.PushFront(entry)
+	c.bytes += size
+	for c.order.Len() > c.maxEntries || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.order.Back())
+	}
+}
+
+// invalidate drops the cached responses of a tenant, limited to those of
+// baseIndex when it is set. An empty tenant drops every response.
+func (c *responseCache) invalidate(tenantID, baseIndex string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*cachedResponse)
+		if (tenantID == "" || entry.tenantID == tenantID) && (baseIndex == "" || entry.baseIndex == baseIndex) {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+func (c *responseCache) remove(element *list.Element) {
+	entry := element.Value.(*cachedResponse)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(len(entry.body))
+}
+
+func (c *responseCache) stats() responseCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := responseCacheStats{Entries: c.order.Len(), Bytes: c.bytes, Hits: c.hits, Misses: c.misses}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// cacheScope names the cached responses a write invalidates once the upstream
+// answered it.
+type cacheScope struct {
+	tenantID  string
+	baseIndex string
+}
+
+// forwardCached forwards a search, answering it from the response cache when
+// the tenant made the same rewritten request before with the same credentials.
+// Keying on the credentials keeps a cached response from being replayed to a
+// caller the upstream never authorized. Misses are cached once the upstream
+// responds.
+func (p *Proxy) forwardCached(w http.ResponseWriter, r *http.Request, tenantID string) {
+	state := requestStateFrom(r)
+	if p.cache == nil || state == nil {
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(body)
+	credentials := sha256.Sum256([]byte(r.Header.Get(p.credentialsHeader())))
+	key := strings.Join([]string{p.cfg.Mode, tenantID, hex.EncodeToString(credentials[:]), r.Method, r.URL.Path, r.URL.RawQuery, hex.EncodeToString(sum[:])}, "\x00")
+	if entry, ok := p.cache.get(key); ok {
+		p.logRequestVerbose(r, "response cache hit")
+		w.Header().Set("Content-Type", entry.contentType)
+		w.Header().Set(responseCacheHeader, "hit")
+		w.WriteHeader(entry.status)
+		_, _ = w.Write(entry.body)
+		return
+	}
+	w.Header().Set(responseCacheHeader, "miss")
+	state.cacheKey = key
+	p.proxy.ServeHTTP(w, r)
+}
+
+// credentialsHeader is the header holding the caller's credentials.
+func (p *Proxy) credentialsHeader() string {
+	if p.cfg.Auth.Header != "" {
+		return p.cfg.Auth.Header
+	}
+	return "Authorization"
+}
+
+// storeCachedResponse caches a successful, rewritten search response.
+func (p *Proxy) storeCachedResponse(resp *http.Response, state *requestState) error {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	p.cache.add(&cachedResponse{
+		key:         state.cacheKey,
+		tenantID:    state.tenantID,
+		baseIndex:   state.baseIndex,
+		status:      resp.StatusCode,
+		contentType: resp.Header.Get("Content-Type"),
+		body:        body,
+	})
+	return nil
+}
+
+// setCacheInvalidation marks a write whose response invalidates the tenant's
+// cached responses. It returns nil when the cache is disabled.
+func (p *Proxy) setCacheInvalidation(r *http.Request, tenantID, baseIndex string) *cacheScope {
+	if p.cache == nil {
+		return nil
+	}
+	state := requestStateFrom(r)
+	if state == nil {
+		return nil
+	}
+	state.invalidate = &cacheScope{tenantID: tenantID, baseIndex: baseIndex}
+	return state.invalidate
+}
+
+// invalidateCache drops the cached responses a write may have changed.
+func (p *Proxy) invalidateCache(scope *cacheScope) {
+	p.cache.invalidate(scope.tenantID, scope.baseIndex)
+}
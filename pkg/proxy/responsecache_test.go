@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+func newResponseCacheTestProxy(t *testing.T) (*Proxy, *capturedRequest) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.ResponseCache.MaxEntries = 10
+	return newProxyWithServer(t, cfg)
+}
+
+func TestResponseCacheServesRepeatedGetSearches(t *testing.T) {
+	proxyHandler, capture := newResponseCacheTestProxy(t)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %s %s, got %d: %s", method, path, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	upstreamCalls := func() int {
+		_, _, _, _, count := capture.snapshot()
+		return count
+	}
+
+	first := serve(http.MethodGet, "/products-tenant1/_search", `{"query":{"match_all":{}}}`)
+	second := serve(http.MethodGet, "/products-tenant1/_search", `{"query":{"match_all":{}}}`)
+	if first.Header().Get(responseCacheHeader) != "miss" || second.Header().Get(responseCacheHeader) != "hit" {
+		t.Fatalf("expected miss then hit, got %q and %q", first.Header().Get(responseCacheHeader), second.Header().Get(responseCacheHeader))
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Fatalf("expected cached body %s, got %s", first.Body.String(), second.Body.String())
+	}
+	if calls := upstreamCalls(); calls != 1 {
+		t.Fatalf("expected one upstream call, got %d", calls)
+	}
+
+	serve(http.MethodGet, "/products-tenant1/_search", `{"query":{"term":{"a":1}}}`)
+	serve(http.MethodGet, "/products-tenant2/_search", `{"query":{"match_all":{}}}`)
+	serve(http.MethodPost, "/products-tenant1/_search", `{"query":{"match_all":{}}}`)
+	serve(http.MethodPost, "/products-tenant1/_search", `{"query":{"match_all":{}}}`)
+	if calls := upstreamCalls(); calls != 5 {
+		t.Fatalf("expected other bodies, tenants, and POST searches to miss, got %d upstream calls", calls)
+	}
+
+	serve(http.MethodGet, "/products-tenant1/_count", "")
+	serve(http.MethodGet, "/products-tenant1/_count", "")
+	if calls := upstreamCalls(); calls != 6 {
+		t.Fatalf("expected repeated count to hit, got %d upstream calls", calls)
+	}
+}
+
+func TestResponseCacheInvalidatedByTenantWrites(t *testing.T) {
+	proxyHandler, capture := newResponseCacheTestProxy(t)
+	serve := func(method, path, body string) {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %s %s, got %d: %s", method, path, rec.Code, rec.Body.String())
+		}
+	}
+	search := func(tenantID string) {
+		serve(http.MethodGet, "/products-"+tenantID+"/_search", "")
+	}
+
+	search("tenant1")
+	search("tenant2")
+	serve(http.MethodPut, "/products-tenant1/_doc/1", `{"a":1}`)
+	search("tenant1")
+	search("tenant2")
+	if _, _, _, _, count := capture.snapshot(); count != 4 {
+		t.Fatalf("expected only tenant1 to be invalidated, got %d upstream calls", count)
+	}
+
+	serve(http.MethodPost, "/_bulk", "{\"index\":{\"_index\":\"orders-tenant2\"}}\n{\"a\":1}\n")
+	search("tenant1")
+	search("tenant2")
+	if _, _, _, _, count := capture.snapshot(); count != 6 {
+		t.Fatalf("expected root bulk to invalidate only tenant2, got %d upstream calls", count)
+	}
+	if stats := proxyHandler.cache.stats(); stats.Entries != 2 {
+		t.Fatalf("expected two cached searches, got %+v", stats)
+	}
+}
+
+func TestResponseCacheLimitsAndTTL(t *testing.T) {
+	cache := newResponseCache(config.ResponseCache{MaxEntries: 2, MaxBytes: 10, TTLSeconds: 30})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.add(&cachedResponse{key: "a", body: []byte("1234")})
+	cache.add(&cachedResponse{key: "b", body: []byte("1234")})
+	cache.get("a")
+	cache.add(&cachedResponse{key: "c", body: []byte("1234")})
+	if _, ok := cache.get("b"); ok {
+		t.Fatal("expected least recently used entry to be evicted")
+	}
+	cache.add(&cachedResponse{key: "d", body: []byte("12345678")})
+	if stats := cache.stats(); stats.Entries != 1 || stats.Bytes != 8 {
+		t.Fatalf("expected byte limit to evict, got %+v", stats)
+	}
+	cache.add(&cachedResponse{key: "e", body: []byte("12345678901")})
+	if _, ok := cache.get("e"); ok {
+		t.Fatal("expected oversized response not to be cached")
+	}
+
+	now = now.Add(31 * time.Second)
+	if _, ok := cache.get("d"); ok {
+		t.Fatal("expected expired entry to miss")
+	}
+	if stats := cache.stats(); stats.Entries != 0 || stats.Hits != 1 || stats.Misses != 3 || stats.HitRate != 0.25 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestAdminCacheEndpoint(t *testing.T) {
+	proxyHandler, _ := newResponseCacheTestProxy(t)
+	for _, path := range []string{"/products-tenant1/_search", "/products-tenant1/_search", "/products-tenant2/_search"} {
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	admin := proxyHandler.AdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cache", nil))
+	var stats responseCacheStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if stats.Entries != 2 || stats.Hits != 1 || stats.Misses != 2 {
+		t.Fatalf("unexpected stats: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/cache?tenant=tenant1", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if stats.Entries != 1 {
+		t.Fatalf("expected tenant1 entries dropped, got %s", rec.Body.String())
+	}
+
+	disabled, _ := newProxyWithServer(t, config.Default())
+	rec = httptest.NewRecorder()
+	disabled.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cache", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when disabled, got %d", rec.Code)
+	}
+}
+
+func TestResponseCacheKeyedByCredentials(t *testing.T) {
+	proxyHandler, capture := newResponseCacheTestProxy(t)
+	search := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/products-tenant1/_search", strings.NewReader(`{"query":{"match_all":{}}}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	search("Basic dGVuYW50MTpzZWNyZXQ=")
+	if rec := search("Basic dGVuYW50MTpzZWNyZXQ="); rec.Header().Get(responseCacheHeader) != "hit" {
+		t.Fatalf("expected same credentials to hit, got %q", rec.Header().Get(responseCacheHeader))
+	}
+	for _, authorization := range []string{"", "Basic b3RoZXI6d3Jvbmc="} {
+		if rec := search(authorization); rec.Header().Get(responseCacheHeader) != "miss" {
+			t.Fatalf("expected credentials %q to miss, got %q", authorization, rec.Header().Get(responseCacheHeader))
+		}
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 3 {
+		t.Fatalf("expected other credentials to reach the upstream, got %d upstream calls", count)
+	}
+}
@@ -0,0 +1,1888 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fastjson"
+)
+
+var (
+	scriptDocFieldPattern    = regexp.MustCompile(`doc\[\s*(['"])([^'"]+)(['"])\s*\]`)
+	scriptSourceFieldPattern = regexp.MustCompile(`params\._source\.([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+func (p *Proxy) rewriteDocumentBody(body []byte, baseIndex, tenantID string) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	if isSharedMode(p.cfg.Mode) {
+		doc[p.tenantField(baseIndex)] = tenantID
+		return json.Marshal(doc)
+	}
+	if !p.wrapSource() {
+		return body, nil
+	}
+	p.rewritePercolatorFields(doc, baseIndex)
+	return json.Marshal(map[string]interface{}{baseIndex: doc})
+}
+
+func (p *Proxy) rewriteUpdateBody(body []byte, baseIndex, tenantID string) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	docValue, ok := payload["doc"]
+	if !ok {
+		return nil, errors.New("update body requires doc payload")
+	}
+	docMap, ok := docValue.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("update doc must be an object")
+	}
+	if isSharedMode(p.cfg.Mode) {
+		docMap[p.tenantField(baseIndex)] = tenantID
+		payload["doc"] = docMap
+		return json.Marshal(payload)
+	}
+	if !p.wrapSource() {
+		return body, nil
+	}
+	p.rewritePercolatorFields(docMap, baseIndex)
+	payload["doc"] = map[string]interface{}{baseIndex: docMap}
+	return json.Marshal(payload)
+}
+
+// rewritePercolatorFields prefixes the field references of the stored queries
+// held by the configured percolator fields, so they match the wrapped documents
+// that are percolated against them.
+func (p *Proxy) rewritePercolatorFields(doc map[string]interface{}, baseIndex string) {
+	for _, field := range p.cfg.IndexPerTenant.PercolatorFields {
+		if query, ok := doc[field].(map[string]interface{}); ok {
+			doc[field] = p.rewriteQueryValue(query, baseIndex)
+		}
+	}
+}
+
+func (p *Proxy) rewriteBulkBody(r *http.Request, body []byte, pathIndex string) ([]byte, error) {
+	var output bytes.Buffer
+	if _, err := p.rewriteBulkStream(r, bytes.NewReader(body), &output, pathIndex, nil, nil); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// bulkSummary collects the target indices and document ids of a bulk body for
+// the audit trail, the index and delete counts for usage accounting, and the
+// index each action named, in order, for the items of the response. Actions
+// without an _id are recorded with an empty id.
+type bulkSummary struct {
+	targets []string
+	ids     []string
+	indices []string
+	indexed int64
+	deletes int64
+}
+
+// metadataFields are Elasticsearch metadata fields. They live outside the
+// document source, so they are never prefixed with the base index.
+var metadataFields = map[string]struct{}{
+	"_id": {}, "_index": {}, "_score": {}, "_doc": {}, "_routing": {}, "_seq_no": {},
+	"_primary_term": {}, "_version": {}, "_shard_doc": {}, "_ignored": {}, "_tier": {},
+}
+
+var (
+	bulkReaderPool = sync.Pool{New: func() interface{} { return bufio.NewReaderSize(nil, 64<<10) }}
+	bulkWriterPool = sync.Pool{New: func() interface{} { return bufio.NewWriterSize(nil, 64<<10) }}
+	bulkParserPool fastjson.ParserPool
+	bulkArenaPool  fastjson.ArenaPool
+)
+
+// rewriteBulkStream rewrites a bulk body from src into dst one line at a time,
+// so the payload is never held in memory as a whole. Every action must belong
+// to the same tenant, which is returned once the body has been consumed. Action
+// lines keep their metadata, key order, and number formatting; only _index,
+// pipeline, and tenant routing are replaced. checkTenant, if set, is called
+// with the tenant of the first action before anything is written to dst.
+// Errors name the failing operation, counted from one.
+func (p *Proxy) rewriteBulkStream(r *http.Request, src io.Reader, dst io.Writer, pathIndex string, checkTenant func(tenantID string) error, summary *bulkSummary) (tenantID string, err error) {
+	reader := bulkReaderPool.Get().(*bufio.Reader)
+	reader.Reset(src)
+	writer := bulkWriterPool.Get().(*bufio.Writer)
+	writer.Reset(dst)
+	defer func() {
+		reader.Reset(nil)
+		bulkReaderPool.Put(reader)
+		writer.Reset(nil)
+		bulkWriterPool.Put(writer)
+	}()
+	parser := bulkParserPool.Get()
+	defer bulkParserPool.Put(parser)
+	arena := bulkArenaPool.Get()
+	defer bulkArenaPool.Put(arena)
+	operation := 0
+	defer func() {
+		if err != nil && operation > 0 {
+			err = fmt.Errorf("bulk operation %d: %w", operation, err)
+		}
+	}()
+	if prefix, _ := reader.Peek(len(utf8BOM)); bytes.Equal(prefix, utf8BOM) {
+		_, _ = reader.Discard(len(utf8BOM))
+	}
+	repair := p.cfg.Bulk.RepairPrettyPrinted
+	var encoded []byte
+	for {
+		line, err := readBulkValue(reader, repair)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		operation++
+		action, err := parser.ParseBytes(line)
+		if err != nil {
+			return "", fmt.Errorf("invalid bulk action line: %w", err)
+		}
+		actionObject, err := action.Object()
+		if err != nil {
+			return "", fmt.Errorf("invalid bulk action line: %w", err)
+		}
+		if actionObject.Len() != 1 {
+			return "", errors.New("bulk action must contain a single operation")
+		}
+		var op string
+		var metaValue *fastjson.Value
+		actionObject.Visit(func(key []byte, v *fastjson.Value) {
+			op = string(key)
+			metaValue = v
+		})
+		meta, err := metaValue.Object()
+		if err != nil {
+			return "", fmt.Errorf("invalid bulk action line: %w", err)
+		}
+		indexName, err := p.bulkIndexName(meta, pathIndex)
+		if err != nil {
+			return "", err
+		}
+		baseIndex, actionTenant, err := p.parseIndex(r, indexName)
+		if err != nil {
+			return "", err
+		}
+		if tenantID == "" {
+			if checkTenant != nil {
+				if err := checkTenant(actionTenant); err != nil {
+					return "", err
+				}
+			}
+			tenantID = actionTenant
+		} else if tenantID != actionTenant {
+			return "", withCode(codeMultipleTenants, fmt.Errorf("bulk request contains multiple tenants: %s and %s", tenantID, actionTenant))
+		}
+		targetIndex, err := p.renderTargetIndex(baseIndex, actionTenant)
+		if err != nil {
+			return "", err
+		}
+		if op != "delete" && !isSharedMode(p.cfg.Mode) {
+			if err := p.checkIndexName(baseIndex, actionTenant, targetIndex, ""); err != nil {
+				return "", err
+			}
+			p.ensureTenantIndex(r, targetIndex, baseIndex)
+		}
+		arena.Reset()
+		meta.Set("_index", arena.NewString(targetIndex))
+		if p.routeByTenant() {
+			meta.Del("_routing")
+			meta.Set("routing", arena.NewString(actionTenant))
+		}
+		if pipeline := meta.Get("pipeline"); pipeline != nil && pipeline.Type() == fastjson.TypeString {
+			rendered, _, err := p.renderPipeline(r, string(pipeline.GetStringBytes()), actionTenant)
+			if err != nil {
+				return "", err
+			}
+			meta.Set("pipeline", arena.NewString(rendered))
+		}
+		encoded = action.MarshalTo(encoded[:0])
+		if summary != nil {
+			if !containsString(summary.targets, targetIndex) {
+				summary.targets = append(summary.targets, targetIndex)
+			}
+			id := ""
+			if idValue := meta.Get("_id"); idValue != nil && idValue.Type() == fastjson.TypeString {
+				id = string(idValue.GetStringBytes())
+			}
+			summary.ids = append(summary.ids, id)
+			summary.indices = append(summary.indices, indexName)
+			switch op {
+			case "index", "create":
+				summary.indexed++
+			case "delete":
+				summary.deletes++
+			}
+		}
+		if err := writeBulkLine(writer, encoded); err != nil {
+			return "", err
+		}
+		if op != "index" && op != "create" && op != "update" {
+			continue
+		}
+		sourceLine, err := readBulkValue(reader, repair)
+		if err == io.EOF {
+			return "", errors.New("bulk payload missing source")
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(sourceLine) == 0 {
+			return "", errors.New("bulk source line empty")
+		}
+		var rewritten []byte
+		if op == "update" {
+			rewritten, err = p.rewriteUpdateBody(sourceLine, baseIndex, actionTenant)
+		} else {
+			rewritten, err = p.rewriteDocumentBody(sourceLine, baseIndex, actionTenant)
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := writeBulkLine(writer, rewritten); err != nil {
+			return "", err
+		}
+	}
+	operation = 0
+	if tenantID == "" {
+		return "", errors.New("bulk request missing index")
+	}
+	return tenantID, writer.Flush()
+}
+
+func writeBulkLine(writer *bufio.Writer, line []byte) error {
+	if _, err := writer.Write(line); err != nil {
+		return err
+	}
+	return writer.WriteByte('\n')
+}
+
+// readBulkLine returns the next line without surrounding whitespace. A final
+// line without a trailing newline is returned before io.EOF.
+func readBulkLine(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(line), nil
+}
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// readBulkValue returns the next bulk line. With repair, a line opening a JSON
+// object or array it does not close is joined with the lines that follow until
+// the value is complete, and compacted back onto one line.
+func readBulkValue(reader *bufio.Reader, repair bool) ([]byte, error) {
+	line, err := readBulkLine(reader)
+	if err != nil || !repair || len(line) == 0 || (line[0] != '{' && line[0] != '[') {
+		return line, err
+	}
+	depth, inString := jsonNesting(line, 0, false)
+	if depth <= 0 {
+		return line, nil
+	}
+	value := line
+	for depth > 0 {
+		next, err := readBulkLine(reader)
+		if err == io.EOF {
+			return nil, errors.New("bulk payload ends inside a JSON value")
+		}
+		if err != nil {
+			return nil, err
+		}
+		value = append(append(value, '\n'), next...)
+		depth, inString = jsonNesting(next, depth, inString)
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, value); err != nil {
+		return nil, fmt.Errorf("invalid pretty-printed bulk line: %w", err)
+	}
+	return compacted.Bytes(), nil
+}
+
+// jsonNesting scans line and returns the object and array depth after it,
+// starting from depth, and whether it ends inside a string.
+func jsonNesting(line []byte, depth int, inString bool) (int, bool) {
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return depth, inString
+}
+
+// msearchHeaderIndices returns the indices an msearch header targets, given as
+// a comma-separated string or a list, and whether they were given as a list.
+func msearchHeaderIndices(value interface{}) ([]string, bool, error) {
+	var names []string
+	isList := false
+	switch typed := value.(type) {
+	case string:
+		if typed != "" {
+			names = strings.Split(typed, ",")
+		}
+	case []interface{}:
+		isList = true
+		for _, item := range typed {
+			name, ok := item.(string)
+			if !ok {
+				return nil, false, errors.New("msearch index list values must be strings")
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, false, errors.New("msearch index must be a string or list")
+	}
+	if len(names) == 0 {
+		return nil, false, errors.New("msearch request missing index")
+	}
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+		if names[i] == "" {
+			return nil, false, errors.New("msearch index names must not be empty")
+		}
+	}
+	return names, isList, nil
+}
+
+func (p *Proxy) rewriteMultiSearchBody(r *http.Request, body []byte, pathIndex string) ([]byte, error) {
+	var output bytes.Buffer
+	if err := p.rewriteMultiSearchStream(r, bytes.NewReader(body), &output, pathIndex, p.rewriteTenantQueryBody); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// rewriteMultiSearchStream rewrites an msearch body from src into dst one line
+// at a time, so the body is never split in memory as a whole. Body lines are
+// rewritten by rewriteBody for the tenant of their header. Lines longer than
+// the line size limit, and bodies with more lines than the line count limit,
+// are rejected before they are read in full.
+func (p *Proxy) rewriteMultiSearchStream(r *http.Request, src io.Reader, dst io.Writer, pathIndex string, rewriteBody func(*http.Request, []byte, string, string) ([]byte, error)) error {
+	reader := bulkReaderPool.Get().(*bufio.Reader)
+	reader.Reset(src)
+	writer := bulkWriterPool.Get().(*bufio.Writer)
+	writer.Reset(dst)
+	defer func() {
+		reader.Reset(nil)
+		bulkReaderPool.Put(reader)
+		writer.Reset(nil)
+		bulkWriterPool.Put(writer)
+	}()
+
+	expectHeader := true
+	var baseIndex, tenantID string
+	var buf []byte
+
+	for lineNumber := 1; ; lineNumber++ {
+		var last bool
+		var err error
+		buf, last, err = readMultiSearchLine(reader, buf[:0], p.cfg.Limits.MaxMultiSearchLineBytes, lineNumber)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if limit := p.cfg.Limits.MaxMultiSearchLines; limit > 0 && lineNumber > limit && !(last && len(bytes.TrimSpace(buf)) == 0) {
+			return withCode(codeTooManyLines, fmt.Errorf("msearch body exceeds the limit of %d lines", limit))
+		}
+		line := bytes.TrimSpace(buf)
+
+		if expectHeader {
+			if len(line) == 0 {
+				if last {
+					break
+				}
+				return errors.New("msearch header line empty")
+			}
+
+			var header map[string]interface{}
+			if err := json.Unmarshal(line, &header); err != nil {
+				return fmt.Errorf("invalid msearch header: %w", err)
+			}
+
+			var indexValue interface{} = pathIndex
+			if value, ok := header["index"]; ok {
+				indexValue = value
+			}
+			names, isList, err := msearchHeaderIndices(indexValue)
+			if err != nil {
+				return err
+			}
+			targets := make([]string, 0, len(names))
+			for j, name := range names {
+				cluster, nameBase, nameTenant, err := p.parseClusterIndex(r, name)
+				if err != nil {
+					return err
+				}
+				if j == 0 {
+					baseIndex, tenantID = nameBase, nameTenant
+				} else if nameTenant != tenantID {
+					return withCode(codeMultipleTenants, fmt.Errorf("msearch header contains multiple tenants: %s and %s", tenantID, nameTenant))
+				} else if nameBase != baseIndex && !isSharedMode(p.cfg.Mode) {
+					return fmt.Errorf("msearch header indices must share a base index in index-per-tenant mode: %s and %s", baseIndex, nameBase)
+				}
+				target, err := p.renderQueryIndex(nameBase, nameTenant)
+				if err != nil {
+					return err
+				}
+				targets = append(targets, withCluster(cluster, target))
+			}
+			if isList {
+				header["index"] = targets
+			} else {
+				header["index"] = strings.Join(targets, ",")
+			}
+			if p.routeByTenant() {
+				header["routing"] = tenantID
+			}
+			encodedHeader, err := json.Marshal(header)
+			if err != nil {
+				return err
+			}
+			writer.Write(encodedHeader)
+			writer.WriteByte('\n')
+
+			// Next non-empty line must be the body for this header.
+			expectHeader = false
+			continue
+		}
+
+		// Expecting body line corresponding to the last header.
+		if len(line) == 0 {
+			// A header followed only by the trailing newline is missing its
+			// body; an empty line anywhere else is an empty body line.
+			if lineNumber == 2 && last {
+				return errors.New("msearch payload missing body")
+			}
+			return errors.New("msearch body line empty")
+		}
+
+		rewrittenBody, err := rewriteBody(r, line, baseIndex, tenantID)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite msearch body at NDJSON line %d: %w", lineNumber, err)
+		}
+		writer.Write(rewrittenBody)
+		writer.WriteByte('\n')
+
+		// After a body, the next non-empty line should be a header.
+		expectHeader = true
+		baseIndex = ""
+		tenantID = ""
+	}
+
+	if !expectHeader {
+		// We ended after a header without seeing its body.
+		return errors.New("msearch payload missing body")
+	}
+	return writer.Flush()
+}
+
+// readMultiSearchLine appends the next line of reader to buf, without its
+// newline, and reports whether it was the last line, which has none. It fails
+// once the line grows beyond limit bytes, unless limit is zero.
+func readMultiSearchLine(reader *bufio.Reader, buf []byte, limit int64, lineNumber int) ([]byte, bool, error) {
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		buf = append(buf, chunk...)
+		if limit > 0 && int64(len(bytes.TrimRight(buf, "\r\n"))) > limit {
+			return nil, false, withCode(codeLineTooLarge, fmt.Errorf("msearch NDJSON line %d exceeds the limit of %d bytes", lineNumber, limit))
+		}
+		switch err {
+		case nil:
+			return buf[:len(buf)-1], false, nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			if len(buf) == 0 {
+				return buf, false, io.EOF
+			}
+			return buf, true, nil
+		default:
+			return nil, false, withCode(codeBodyReadFailed, errors.New("failed to read body"))
+		}
+	}
+}
+
+func (p *Proxy) bulkIndexName(meta *fastjson.Object, pathIndex string) (string, error) {
+	if value := meta.Get("_index"); value != nil {
+		if value.Type() == fastjson.TypeString && len(value.GetStringBytes()) > 0 {
+			return string(value.GetStringBytes()), nil
+		}
+		return "", errors.New("bulk _index must be a string")
+	}
+	if pathIndex != "" {
+		return pathIndex, nil
+	}
+	return "", errors.New("bulk request missing index")
+}
+
+// rewriteQueryBody rewrites a query body with the configured rewriter. The
+// default ("auto") uses fastjson and falls back to encoding/json for bodies
+// fastjson cannot parse.
+func (p *Proxy) rewriteQueryBody(body []byte, baseIndex string) ([]byte, error) {
+	switch strings.ToLower(p.cfg.Rewriter) {
+	case "stdlib":
+		return p.rewriteQueryBodyStdlib(body, baseIndex)
+	case "fastjson":
+		return p.rewriteQueryBodyFastJSON(body, baseIndex)
+	}
+	rewritten, err := p.rewriteQueryBodyFastJSON(body, baseIndex)
+	if err != nil {
+		p.logVerbose("fastjson rewrite failed, falling back to stdlib: %v", err)
+		return p.rewriteQueryBodyStdlib(body, baseIndex)
+	}
+	return rewritten, nil
+}
+
+// rewriteTenantQueryBody scopes a search body to the tenant: field paths are
+// prefixed in index-per-tenant mode, while shared mode adds tenant filters on top
+// of the alias routing.
+func (p *Proxy) rewriteTenantQueryBody(r *http.Request, body []byte, baseIndex, tenantID string) ([]byte, error) {
+	if err := checkSearchAfter(body); err != nil {
+		return nil, err
+	}
+	body, err := p.rewritePercolateIndices(r, body, baseIndex, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !isSharedMode(p.cfg.Mode) {
+		return p.rewriteQueryBody(body, baseIndex)
+	}
+	rewritten, err := p.addKnnTenantFilter(body, baseIndex, tenantID)
+	if err != nil || !p.enforceTenantFilter() {
+		return rewritten, err
+	}
+	return p.addQueryTenantFilter(rewritten, baseIndex, tenantID)
+}
+
+// checkSearchAfter checks that a search_after cursor holds one sort value per
+// sort field. The sort fields are rewritten for the tenant while the cursor
+// values are passed through as they are, so a cursor that does not line up with
+// its sort is rejected here rather than paging from the wrong place upstream.
+func checkSearchAfter(body []byte) error {
+	if !bytes.Contains(body, []byte(`"search_after"`)) {
+		return nil
+	}
+	payload, err := fastjson.ParseBytes(body)
+	if err != nil {
+		// Invalid JSON is reported by the rewriters.
+		return nil
+	}
+	after := payload.Get("search_after")
+	if after == nil {
+		return nil
+	}
+	values, err := after.Array()
+	if err != nil {
+		return errors.New("search_after must be an array of sort values")
+	}
+	for _, value := range values {
+		if kind := value.Type(); kind == fastjson.TypeObject || kind == fastjson.TypeArray {
+			return errors.New("search_after values must be strings, numbers, booleans, or null")
+		}
+	}
+	sort := payload.Get("sort")
+	if sort == nil {
+		return nil
+	}
+	fields := 1
+	if sort.Type() == fastjson.TypeArray {
+		fields = len(sort.GetArray())
+	}
+	if len(values) != fields {
+		return fmt.Errorf("search_after has %d values but sort has %d fields", len(values), fields)
+	}
+	return nil
+}
+
+// enforceTenantFilter reports whether shared-mode query bodies must carry an
+// explicit tenant filter in addition to the tenant alias.
+func (p *Proxy) enforceTenantFilter() bool {
+	return isSharedMode(p.cfg.Mode) && p.cfg.SharedIndex.EnforceFilter
+}
+
+// wrapSource reports whether index-per-tenant documents are nested under their
+// base index, with query fields prefixed to match.
+func (p *Proxy) wrapSource() bool {
+	return !isSharedMode(p.cfg.Mode) && p.cfg.IndexPerTenant.SourceWrapped()
+}
+
+// routeByTenant reports whether shared-mode documents are routed by tenant, so
+// each tenant's documents live on a single shard of the shared index.
+func (p *Proxy) routeByTenant() bool {
+	return isSharedMode(p.cfg.Mode) && p.cfg.SharedIndex.RouteByTenant
+}
+
+// routeToTenant replaces the ?routing= parameter of a request with the tenant
+// when documents are routed by tenant. Otherwise the client's routing is kept.
+func (p *Proxy) routeToTenant(r *http.Request, tenantID string) {
+	if !p.routeByTenant() {
+		return
+	}
+	q := r.URL.Query()
+	if routing := q.Get("routing"); routing != "" && routing != tenantID {
+		p.logRequestVerbose(r, "routing rewrite: %s -> %s", routing, tenantID)
+	}
+	setQueryParam(r, q, "routing", tenantID)
+}
+
+func (p *Proxy) addQueryTenantFilter(body []byte, baseIndex, tenantID string) ([]byte, error) {
+	var payload map[string]interface{}
+	if len(bytes.TrimSpace(body)) != 0 {
+		if err := unmarshalResponseJSON(body, &payload); err != nil {
+			return nil, invalidJSONError(err)
+		}
+	}
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	payload["query"] = addTenantFilter(payload["query"], p.tenantField(baseIndex), tenantID)
+	return json.Marshal(payload)
+}
+
+// rewriteQueryBodyStdlib is the original implementation using encoding/json.
+// It is selected with rewriter "stdlib" and used as the "auto" fallback.
+func (p *Proxy) rewriteQueryBodyStdlib(body []byte, baseIndex string) ([]byte, error) {
+	if !p.wrapSource() {
+		return body, nil
+	}
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	if err := p.validateQueryPayload(payload); err != nil {
+		return nil, err
+	}
+	rewritten := p.rewriteQueryValue(payload, baseIndex)
+	return json.Marshal(rewritten)
+}
+
+func (p *Proxy) rewriteMappingBody(body []byte, baseIndex string) ([]byte, error) {
+	if !p.wrapSource() {
+		return body, nil
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	if mappingsValue, ok := payload["mappings"]; ok {
+		mappings, ok := mappingsValue.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("mappings must be an object")
+		}
+		if propsValue, ok := mappings["properties"]; ok {
+			props, ok := propsValue.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("mappings.properties must be an object")
+			}
+			p.prefixContextPaths(props, baseIndex)
+			mappings["properties"] = wrapProperties(props, baseIndex)
+			payload["mappings"] = mappings
+		}
+		return json.Marshal(payload)
+	}
+	if propsValue, ok := payload["properties"]; ok {
+		props, ok := propsValue.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("properties must be an object")
+		}
+		p.prefixContextPaths(props, baseIndex)
+		payload["properties"] = wrapProperties(props, baseIndex)
+	}
+	return json.Marshal(payload)
+}
+
+func (p *Proxy) rewriteTransformBody(r *http.Request, body []byte) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	if sourceValue, ok := payload["source"]; ok {
+		source, ok := sourceValue.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("transform source must be an object")
+		}
+		if indexValue, ok := source["index"]; ok {
+			rewritten, err := p.rewriteSourceIndexValue(r, indexValue)
+			if err != nil {
+				return nil, err
+			}
+			source["index"] = rewritten
+			payload["source"] = source
+		}
+	}
+	if destValue, ok := payload["dest"]; ok {
+		dest, ok := destValue.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("transform dest must be an object")
+		}
+		if indexValue, ok := dest["index"]; ok {
+			rewritten, err := p.rewriteTargetIndexValue(r, indexValue)
+			if err != nil {
+				return nil, err
+			}
+			dest["index"] = rewritten
+			payload["dest"] = dest
+		}
+	}
+	return json.Marshal(payload)
+}
+
+func (p *Proxy) rewriteRollupBody(r *http.Request, body []byte) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	if patternValue, ok := payload["index_pattern"]; ok {
+		rewritten, err := p.rewriteSourceIndexValue(r, patternValue)
+		if err != nil {
+			return nil, err
+		}
+		payload["index_pattern"] = rewritten
+	}
+	if rollupIndexValue, ok := payload["rollup_index"]; ok {
+		rewritten, err := p.rewriteTargetIndexValue(r, rollupIndexValue)
+		if err != nil {
+			return nil, err
+		}
+		payload["rollup_index"] = rewritten
+	}
+	return json.Marshal(payload)
+}
+
+// rewriteReindexBody rewrites the source and dest indices of a reindex body and
+// returns the base index and tenant of its destination.
+func (p *Proxy) rewriteReindexBody(r *http.Request, body []byte) ([]byte, string, string, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, "", "", invalidJSONError(err)
+	}
+	sourceValue, ok := payload["source"]
+	if !ok {
+		return nil, "", "", errors.New("reindex body requires source")
+	}
+	source, ok := sourceValue.(map[string]interface{})
+	if !ok {
+		return nil, "", "", errors.New("reindex source must be an object")
+	}
+	if _, ok := source["remote"]; ok {
+		return nil, "", "", errors.New("reindex from remote clusters is not supported")
+	}
+	sourceIndexValue, ok := source["index"]
+	if !ok {
+		return nil, "", "", errors.New("reindex source requires index")
+	}
+	destValue, ok := payload["dest"]
+	if !ok {
+		return nil, "", "", errors.New("reindex body requires dest")
+	}
+	dest, ok := destValue.(map[string]interface{})
+	if !ok {
+		return nil, "", "", errors.New("reindex dest must be an object")
+	}
+	destIndex, ok := dest["index"].(string)
+	if !ok || destIndex == "" {
+		return nil, "", "", errors.New("reindex dest index must be a string")
+	}
+
+	rewrittenSource, err := p.rewriteSourceIndexValue(r, sourceIndexValue)
+	if err != nil {
+		return nil, "", "", err
+	}
+	sourceNames, err := indexValueNames(sourceIndexValue)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if len(sourceNames) == 0 {
+		return nil, "", "", errors.New("reindex source requires index")
+	}
+	destBase, destTenant, err := p.parseIndex(r, destIndex)
+	if err != nil {
+		return nil, "", "", err
+	}
+	var sourceBase, sourceTenant string
+	for _, name := range sourceNames {
+		sourceBase, sourceTenant, err = p.parseIndex(r, name)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if sourceTenant != destTenant {
+			return nil, "", "", fmt.Errorf("reindex dest tenant %s does not match source tenant %s", destTenant, sourceTenant)
+		}
+		if p.wrapSource() && sourceBase != destBase {
+			return nil, "", "", fmt.Errorf("reindex from %s to %s is not supported in index-per-tenant mode", sourceBase, destBase)
+		}
+	}
+	rewrittenDest, err := p.rewriteTargetIndexValue(r, destIndex)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if pipeline, ok := dest["pipeline"].(string); ok {
+		dest["pipeline"], _, err = p.renderPipeline(r, pipeline, destTenant)
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	if isSharedMode(p.cfg.Mode) {
+		source["query"] = addTenantFilter(source["query"], p.tenantField(sourceBase), sourceTenant)
+	} else {
+		delete(source, "index")
+		if len(source) != 0 {
+			encoded, err := json.Marshal(source)
+			if err != nil {
+				return nil, "", "", err
+			}
+			rewritten, err := p.rewriteQueryBody(encoded, sourceBase)
+			if err != nil {
+				return nil, "", "", err
+			}
+			source = nil
+			if err := json.Unmarshal(rewritten, &source); err != nil {
+				return nil, "", "", invalidJSONError(err)
+			}
+		}
+	}
+	source["index"] = rewrittenSource
+	dest["index"] = rewrittenDest
+	payload["source"] = source
+	payload["dest"] = dest
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return rewritten, destBase, destTenant, nil
+}
+
+func (p *Proxy) rewriteTermVectorsBody(body []byte, baseIndex, tenantID string) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	p.rewriteTermVectorsRequest(payload, baseIndex, tenantID)
+	return json.Marshal(payload)
+}
+
+func (p *Proxy) rewriteMultiTermVectorsBody(r *http.Request, body []byte, pathIndex string) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	baseIndex, tenantID, err := p.parseIndex(r, pathIndex)
+	if err != nil {
+		return nil, err
+	}
+	docsValue, ok := payload["docs"]
+	if !ok {
+		if _, ok := payload["ids"]; !ok {
+			return nil, errors.New("mtermvectors body requires docs or ids")
+		}
+		return json.Marshal(payload)
+	}
+	docs, ok := docsValue.([]interface{})
+	if !ok {
+		return nil, errors.New("mtermvectors docs must be an array")
+	}
+	for _, item := range docs {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("mtermvectors docs entries must be objects")
+		}
+		docBase := baseIndex
+		if indexValue, ok := entry["_index"]; ok {
+			indexName, ok := indexValue.(string)
+			if !ok || indexName == "" {
+				return nil, errors.New("mtermvectors _index must be a string")
+			}
+			entryBase, entryTenant, err := p.parseIndex(r, indexName)
+			if err != nil {
+				return nil, err
+			}
+			if entryTenant != tenantID {
+				return nil, fmt.Errorf("mtermvectors _index %q does not match request tenant %s", indexName, tenantID)
+			}
+			targetIndex, err := p.renderTargetIndex(entryBase, entryTenant)
+			if err != nil {
+				return nil, err
+			}
+			entry["_index"] = targetIndex
+			docBase = entryBase
+		}
+		p.rewriteTermVectorsRequest(entry, docBase, tenantID)
+	}
+	return json.Marshal(payload)
+}
+
+// rewriteTermVectorsRequest rewrites the field references of a single term
+// vectors request in place. Artificial documents are shaped like indexed ones.
+func (p *Proxy) rewriteTermVectorsRequest(payload map[string]interface{}, baseIndex, tenantID string) {
+	if isSharedMode(p.cfg.Mode) {
+		if doc, ok := payload["doc"].(map[string]interface{}); ok {
+			doc[p.tenantField(baseIndex)] = tenantID
+		}
+		return
+	}
+	if !p.wrapSource() {
+		return
+	}
+	if fields, ok := payload["fields"]; ok {
+		payload["fields"] = p.rewriteFieldList(fields, baseIndex)
+	}
+	if analyzers, ok := payload["per_field_analyzer"].(map[string]interface{}); ok {
+		rewritten := make(map[string]interface{}, len(analyzers))
+		for field, analyzer := range analyzers {
+			rewritten[p.prefixField(baseIndex, field)] = analyzer
+		}
+		payload["per_field_analyzer"] = rewritten
+	}
+	if doc, ok := payload["doc"].(map[string]interface{}); ok {
+		payload["doc"] = map[string]interface{}{baseIndex: doc}
+	}
+}
+
+// rewritePercolateIndices rewrites the index of percolate queries that fetch the
+// percolated document by index and id. The document must belong to the searched
+// tenant and base index, since its fields are wrapped under that base index.
+// Shared mode rejects such lookups: a GET by id ignores the tenant alias filter.
+func (p *Proxy) rewritePercolateIndices(r *http.Request, body []byte, baseIndex, tenantID string) ([]byte, error) {
+	if !bytes.Contains(body, []byte(`"percolate"`)) {
+		return body, nil
+	}
+	var payload interface{}
+	if err := unmarshalResponseJSON(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	changed := false
+	err := walkPercolateQueries(payload, func(percolate map[string]interface{}) error {
+		indexValue, hasIndex := percolate["index"]
+		if !hasIndex {
+			if _, hasID := percolate["id"]; hasID {
+				return errors.New("percolate by id requires an index")
+			}
+			return nil
+		}
+		if isSharedMode(p.cfg.Mode) {
+			return errors.New("percolate by index and id is not supported in shared mode; pass the document instead")
+		}
+		index, ok := indexValue.(string)
+		if !ok {
+			return errors.New("percolate index must be a string")
+		}
+		docBase, docTenant, err := p.parseIndex(r, index)
+		if err != nil {
+			return err
+		}
+		if docTenant != tenantID || (docBase != baseIndex && p.wrapSource()) {
+			return fmt.Errorf("percolate index '%s' must match the searched index", index)
+		}
+		target, err := p.renderIndex(p.perTenantIdx, docBase, docTenant)
+		if err != nil {
+			return err
+		}
+		percolate["index"] = target
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return body, nil
+	}
+	return json.Marshal(payload)
+}
+
+// walkPercolateQueries calls fn for every percolate query object in value.
+func walkPercolateQueries(value interface{}, fn func(map[string]interface{}) error) error {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, val := range typed {
+			if percolate, ok := val.(map[string]interface{}); ok && key == "percolate" {
+				if err := fn(percolate); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := walkPercolateQueries(val, fn); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range typed {
+			if err := walkPercolateQueries(item, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addKnnTenantFilter adds the tenant term to the filter of every top-level knn
+// section so approximate kNN candidates are pre-filtered to the tenant instead of
+// being post-filtered by the alias.
+func (p *Proxy) addKnnTenantFilter(body []byte, baseIndex, tenantID string) ([]byte, error) {
+	if !bytes.Contains(body, []byte(`"knn"`)) {
+		return body, nil
+	}
+	var payload map[string]interface{}
+	if err := unmarshalResponseJSON(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	knnValue, ok := payload["knn"]
+	if !ok {
+		return body, nil
+	}
+	tenantField := p.tenantField(baseIndex)
+	switch typed := knnValue.(type) {
+	case map[string]interface{}:
+		typed["filter"] = addTenantFilter(typed["filter"], tenantField, tenantID)
+	case []interface{}:
+		for _, item := range typed {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("knn entries must be objects")
+			}
+			entry["filter"] = addTenantFilter(entry["filter"], tenantField, tenantID)
+		}
+	default:
+		return nil, errors.New("knn must be an object or an array")
+	}
+	return json.Marshal(payload)
+}
+
+// addTenantFilter wraps query in a bool query that only matches documents whose
+// tenant field equals tenantID. A nil query matches all of the tenant's documents.
+func addTenantFilter(query interface{}, tenantField, tenantID string) map[string]interface{} {
+	boolQuery := map[string]interface{}{
+		"filter": []interface{}{
+			map[string]interface{}{
+				"term": map[string]interface{}{tenantField: tenantID},
+			},
+		},
+	}
+	if query != nil {
+		boolQuery["must"] = []interface{}{query}
+	}
+	return map[string]interface{}{"bool": boolQuery}
+}
+
+func indexValueNames(value interface{}) ([]string, error) {
+	switch typed := value.(type) {
+	case string:
+		return []string{typed}, nil
+	case []interface{}:
+		names := make([]string, 0, len(typed))
+		for _, item := range typed {
+			name, ok := item.(string)
+			if !ok {
+				return nil, errors.New("index list values must be strings")
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	default:
+		return nil, errors.New("index must be a string or list")
+	}
+}
+
+func (p *Proxy) rewriteSourceIndexValue(r *http.Request, value interface{}) (interface{}, error) {
+	return p.rewriteIndexValue(r, value, true, true)
+}
+
+func (p *Proxy) rewriteTargetIndexValue(r *http.Request, value interface{}) (interface{}, error) {
+	return p.rewriteIndexValue(r, value, false, false)
+}
+
+func (p *Proxy) rewriteIndexValue(r *http.Request, value interface{}, aliasForShared bool, enforceSingleTenant bool) (interface{}, error) {
+	switch typed := value.(type) {
+	case string:
+		if enforceSingleTenant {
+			if err := validateSourceIndexPattern(typed); err != nil {
+				return nil, err
+			}
+		}
+		rewritten, tenantID, err := p.rewriteIndexNameWithTenant(r, typed, aliasForShared)
+		if err != nil {
+			return nil, err
+		}
+		if enforceSingleTenant && tenantID == "" {
+			return nil, errors.New("source index must include tenant")
+		}
+		return rewritten, nil
+	case []interface{}:
+		output := make([]interface{}, 0, len(typed))
+		var tenantID string
+		for _, item := range typed {
+			itemString, ok := item.(string)
+			if !ok {
+				return nil, errors.New("index list values must be strings")
+			}
+			if enforceSingleTenant {
+				if err := validateSourceIndexPattern(itemString); err != nil {
+					return nil, err
+				}
+			}
+			rewritten, itemTenant, err := p.rewriteIndexNameWithTenant(r, itemString, aliasForShared)
+			if err != nil {
+				return nil, err
+			}
+			if enforceSingleTenant {
+				if tenantID == "" {
+					tenantID = itemTenant
+				} else if tenantID != itemTenant {
+					return nil, withCode(codeMultipleTenants, fmt.Errorf("source indices contain multiple tenants: %s and %s", tenantID, itemTenant))
+				}
+			}
+			output = append(output, rewritten)
+		}
+		return output, nil
+	default:
+		return nil, errors.New("index must be a string or list")
+	}
+}
+
+func (p *Proxy) rewriteIndexName(r *http.Request, index string, aliasForShared bool) (string, error) {
+	rewritten, _, err := p.rewriteIndexNameWithTenant(r, index, aliasForShared)
+	return rewritten, err
+}
+
+func (p *Proxy) rewriteIndexNameWithTenant(r *http.Request, index string, aliasForShared bool) (string, string, error) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		return "", "", err
+	}
+	if isSharedMode(p.cfg.Mode) {
+		if aliasForShared {
+			alias, err := p.renderAlias(baseIndex, tenantID)
+			if err == nil && alias != index {
+				p.logVerbose("index rewrite (alias): %s -> %s", index, alias)
+			}
+			return alias, tenantID, err
+		}
+		target, err := p.renderSharedIndex(baseIndex, tenantID)
+		if err == nil && target != index {
+			p.logVerbose("index rewrite (shared): %s -> %s", index, target)
+		}
+		return target, tenantID, err
+	}
+	target, err := p.renderIndex(p.perTenantIdx, baseIndex, tenantID)
+	if err == nil && target != index {
+		p.logVerbose("index rewrite (per-tenant): %s -> %s", index, target)
+	}
+	return target, tenantID, err
+}
+
+func validateSourceIndexPattern(indexName string) error {
+	if strings.ContainsAny(indexName, "*?") || strings.ContainsAny(indexName, "[]") || strings.Contains(indexName, ",") {
+		return errors.New("source index patterns must not contain wildcards or lists")
+	}
+	return nil
+}
+
+func (p *Proxy) rewriteQueryValue(value interface{}, baseIndex string) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		output := make(map[string]interface{}, len(typed))
+		for key, val := range typed {
+			switch key {
+			case "match", "term", "range", "prefix", "wildcard", "regexp":
+				output[key] = p.rewriteFieldObject(val, baseIndex)
+			case "fields", "docvalue_fields":
+				output[key] = p.rewriteFieldList(val, baseIndex)
+			case "stored_fields":
+				output[key] = p.rewriteStoredFields(val, baseIndex)
+			case "runtime_mappings":
+				output[key] = p.rewriteRuntimeMappings(val, baseIndex)
+			case "sort":
+				output[key] = p.rewriteSortValue(val, baseIndex)
+			case "_source":
+				output[key] = p.rewriteSourceFilter(val, baseIndex)
+			case "script":
+				output[key] = p.rewriteScriptValue(val, baseIndex)
+			case "highlight":
+				output[key] = p.rewriteHighlight(val, baseIndex)
+			case "collapse":
+				output[key] = p.rewriteCollapse(val, baseIndex)
+			case "knn":
+				output[key] = p.rewriteKnn(val, baseIndex)
+			case "suggest":
+				output[key] = p.rewriteSuggest(val, baseIndex)
+			case "percolate":
+				output[key] = p.rewritePercolate(val, baseIndex)
+			case "nested", "reverse_nested":
+				output[key] = p.rewriteNested(val, baseIndex)
+			default:
+				output[key] = p.rewriteQueryValue(val, baseIndex)
+			}
+		}
+		return output
+	case []interface{}:
+		items := make([]interface{}, 0, len(typed))
+		for _, item := range typed {
+			items = append(items, p.rewriteQueryValue(item, baseIndex))
+		}
+		return items
+	default:
+		return typed
+	}
+}
+
+func (p *Proxy) validateQueryPayload(payload interface{}) error {
+	switch typed := payload.(type) {
+	case map[string]interface{}:
+		for key, val := range typed {
+			if key == "query" || key == "post_filter" || key == "filter" {
+				if err := p.validateQueryValue(val); err != nil {
+					return err
+				}
+			}
+			if err := p.validateQueryPayload(val); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range typed {
+			if err := p.validateQueryPayload(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Proxy) validateQueryValue(value interface{}) error {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, val := range typed {
+			if isUnsupportedQueryKey(key) {
+				return fmt.Errorf("unsupported query type: %s", key)
+			}
+			if err := p.validateQueryValue(val); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range typed {
+			if err := p.validateQueryValue(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isUnsupportedQueryKey(key string) bool {
+	switch key {
+	case "match_phrase", "match_phrase_prefix", "multi_match", "query_string", "simple_query_string",
+		"exists", "fuzzy", "more_like_this", "function_score",
+		"has_child", "has_parent":
+		return true
+	default:
+		return strings.HasPrefix(key, "geo_") || strings.HasPrefix(key, "span_")
+	}
+}
+
+func (p *Proxy) rewriteFieldObject(value interface{}, baseIndex string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	output := make(map[string]interface{}, len(obj))
+	for key, val := range obj {
+		output[p.prefixField(baseIndex, key)] = p.rewriteQueryValue(val, baseIndex)
+	}
+	return output
+}
+
+func (p *Proxy) rewriteFieldList(value interface{}, baseIndex string) interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	output := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		switch typed := item.(type) {
+		case string:
+			output = append(output, p.prefixField(baseIndex, typed))
+		case map[string]interface{}:
+			// {"field": ..., "format": ...} entries of fields and docvalue_fields
+			entry := make(map[string]interface{}, len(typed))
+			for key, val := range typed {
+				entry[key] = val
+			}
+			if field, ok := typed["field"].(string); ok {
+				entry["field"] = p.prefixField(baseIndex, field)
+			}
+			output = append(output, entry)
+		default:
+			output = append(output, item)
+		}
+	}
+	return output
+}
+
+// rewriteStoredFields prefixes stored_fields, given as a single field name or a
+// list of them. The _none_ value disables stored fields and is kept.
+func (p *Proxy) rewriteStoredFields(value interface{}, baseIndex string) interface{} {
+	switch typed := value.(type) {
+	case string:
+		if typed == "_none_" {
+			return typed
+		}
+		return p.prefixField(baseIndex, typed)
+	case []interface{}:
+		output := make([]interface{}, 0, len(typed))
+		for _, item := range typed {
+			output = append(output, p.rewriteStoredFields(item, baseIndex))
+		}
+		return output
+	default:
+		return value
+	}
+}
+
+// rewriteRuntimeMappings prefixes the names of search-time runtime fields, which
+// queries address like source fields, and the field references of their scripts
+// and lookup input fields.
+func (p *Proxy) rewriteRuntimeMappings(value interface{}, baseIndex string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	output := make(map[string]interface{}, len(obj))
+	for name, val := range obj {
+		definition, ok := val.(map[string]interface{})
+		if !ok {
+			output[p.prefixField(baseIndex, name)] = val
+			continue
+		}
+		rewritten := make(map[string]interface{}, len(definition))
+		for key, option := range definition {
+			switch key {
+			case "script":
+				rewritten[key] = p.rewriteScriptValue(option, baseIndex)
+			case "input_field":
+				if field, ok := option.(string); ok {
+					rewritten[key] = p.prefixField(baseIndex, field)
+					continue
+				}
+				rewritten[key] = option
+			default:
+				rewritten[key] = option
+			}
+		}
+		output[p.prefixField(baseIndex, name)] = rewritten
+	}
+	return output
+}
+
+func (p *Proxy) rewriteSourceFilter(value interface{}, baseIndex string) interface{} {
+	switch typed := value.(type) {
+	case []interface{}:
+		output := make([]interface{}, 0, len(typed))
+		for _, item := range typed {
+			s, ok := item.(string)
+			if ok {
+				output = append(output, p.prefixField(baseIndex, s))
+				continue
+			}
+			output = append(output, item)
+		}
+		return output
+	case map[string]interface{}:
+		includes, ok := typed["includes"]
+		if ok {
+			typed["includes"] = p.rewriteSourceFilter(includes, baseIndex)
+		}
+		excludes, ok := typed["excludes"]
+		if ok {
+			typed["excludes"] = p.rewriteSourceFilter(excludes, baseIndex)
+		}
+		return typed
+	default:
+		return typed
+	}
+}
+
+// geoDistanceSortOptions are the keys of a _geo_distance sort that are options
+// rather than the name of the sorted field.
+var geoDistanceSortOptions = map[string]struct{}{
+	"order": {}, "unit": {}, "mode": {}, "distance_type": {}, "ignore_unmapped": {},
+	"validation_method": {}, "nested": {},
+}
+
+// rewriteSortValue prefixes the fields of a sort, given as a list or as a
+// single field name or object, leaving the metadata fields used as tiebreakers
+// such as _doc and _shard_doc as they are.
+func (p *Proxy) rewriteSortValue(value interface{}, baseIndex string) interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return p.rewriteSortItem(value, baseIndex)
+	}
+	output := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		output = append(output, p.rewriteSortItem(item, baseIndex))
+	}
+	return output
+}
+
+func (p *Proxy) rewriteSortItem(item interface{}, baseIndex string) interface{} {
+	switch typed := item.(type) {
+	case string:
+		return p.prefixField(baseIndex, typed)
+	case map[string]interface{}:
+		rewritten := make(map[string]interface{}, len(typed))
+		for key, val := range typed {
+			switch key {
+			case "_script":
+				rewritten[key] = p.rewriteQueryValue(val, baseIndex)
+			case "_geo_distance":
+				rewritten[key] = p.rewriteGeoDistanceSort(val, baseIndex)
+			default:
+				rewritten[p.prefixField(baseIndex, key)] = p.rewriteQueryValue(val, baseIndex)
+			}
+		}
+		return rewritten
+	default:
+		return item
+	}
+}
+
+// rewriteGeoDistanceSort prefixes the field a _geo_distance sort measures from,
+// which is the one key that is not an option.
+func (p *Proxy) rewriteGeoDistanceSort(value interface{}, baseIndex string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	output := make(map[string]interface{}, len(obj))
+	for key, val := range obj {
+		if _, option := geoDistanceSortOptions[key]; option {
+			output[key] = p.rewriteQueryValue(val, baseIndex)
+			continue
+		}
+		output[p.prefixField(baseIndex, key)] = val
+	}
+	return output
+}
+
+// rewriteHighlight prefixes the field names of a highlight section. Fields may be
+// given as an object keyed by field name or as an ordered list of such objects.
+func (p *Proxy) rewriteHighlight(value interface{}, baseIndex string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	output := make(map[string]interface{}, len(obj))
+	for key, val := range obj {
+		switch key {
+		case "fields":
+			output[key] = p.rewriteHighlightFields(val, baseIndex)
+		case "highlight_query":
+			output[key] = p.rewriteQueryValue(val, baseIndex)
+		default:
+			output[key] = val
+		}
+	}
+	return output
+}
+
+func (p *Proxy) rewriteHighlightFields(value interface{}, baseIndex string) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		output := make(map[string]interface{}, len(typed))
+		for field, options := range typed {
+			output[p.prefixField(baseIndex, field)] = p.rewriteHighlightFieldOptions(options, baseIndex)
+		}
+		return output
+	case []interface{}:
+		output := make([]interface{}, 0, len(typed))
+		for _, item := range typed {
+			output = append(output, p.rewriteHighlightFields(item, baseIndex))
+		}
+		return output
+	default:
+		return value
+	}
+}
+
+func (p *Proxy) rewriteHighlightFieldOptions(value interface{}, baseIndex string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	output := make(map[string]interface{}, len(obj))
+	for key, val := range obj {
+		switch key {
+		case "matched_fields":
+			output[key] = p.rewriteFieldList(val, baseIndex)
+		case "highlight_query":
+			output[key] = p.rewriteQueryValue(val, baseIndex)
+		default:
+			output[key] = val
+		}
+	}
+	return output
+}
+
+// rewriteCollapse prefixes the collapse field and rewrites any inner_hits
+// definitions, which may themselves sort, filter _source, or collapse.
+func (p *Proxy) rewriteCollapse(value interface{}, baseIndex string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	output := make(map[string]interface{}, len(obj))
+	for key, val := range obj {
+		switch key {
+		case "field":
+			if field, ok := val.(string); ok {
+				output[key] = p.prefixField(baseIndex, field)
+				continue
+			}
+			output[key] = val
+		case "inner_hits":
+			output[key] = p.rewriteQueryValue(val, baseIndex)
+		default:
+			output[key] = val
+		}
+	}
+	return output
+}
+
+// rewriteKnn rewrites a knn section or query. The Elasticsearch form names the
+// vector field in "field"; the OpenSearch form keys the options by field name.
+func (p *Proxy) rewriteKnn(value interface{}, baseIndex string) interface{} {
+	switch typed := value.(type) {
+	case []interface{}:
+		items := make([]interface{}, 0, len(typed))
+		for _, item := range typed {
+			items = append(items, p.rewriteKnn(item, baseIndex))
+		}
+		return items
+	case map[string]interface{}:
+		if _, ok := typed["field"].(string); ok {
+			return p.rewriteKnnOptions(typed, baseIndex)
+		}
+		output := make(map[string]interface{}, len(typed))
+		for field, val := range typed {
+			options, ok := val.(map[string]interface{})
+			if !ok {
+				output[p.prefixField(baseIndex, field)] = val
+				continue
+			}
+			output[p.prefixField(baseIndex, field)] = p.rewriteKnnOptions(options, baseIndex)
+		}
+		return output
+	default:
+		return value
+	}
+}
+
+func (p *Proxy) rewriteKnnOptions(obj map[string]interface{}, baseIndex string) map[string]interface{} {
+	output := make(map[string]interface{}, len(obj))
+	for key, val := range obj {
+		switch key {
+		case "field":
+			if field, ok := val.(string); ok {
+				output[key] = p.prefixField(baseIndex, field)
+				continue
+			}
+			output[key] = val
+		case "filter", "inner_hits":
+			output[key] = p.rewriteQueryValue(val, baseIndex)
+		default:
+			output[key] = val
+		}
+	}
+	return output
+}
+
+// rewriteSuggest prefixes the fields of the term, phrase, and completion
+// suggesters in a suggest section. Other entries, such as the global "text"
+// and the text, prefix, or regex of a suggestion, are kept.
+func (p *Proxy) rewriteSuggest(value interface{}, baseIndex string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	output := make(map[string]interface{}, len(obj))
+	for name, val := range obj {
+		suggestion, ok := val.(map[string]interface{})
+		if !ok {
+			output[name] = val
+			continue
+		}
+		rewritten := make(map[string]interface{}, len(suggestion))
+		for key, options := range suggestion {
+			switch key {
+			case "term", "phrase", "completion":
+				rewritten[key] = p.rewriteSuggester(options, baseIndex)
+			default:
+				rewritten[key] = options
+			}
+		}
+		output[name] = rewritten
+	}
+	return output
+}
+
+// rewriteSuggester rewrites the options of a single suggester: its field, the
+// fields of phrase direct generators, and the query that collates phrase
+// suggestions. Completion contexts are keyed by context name and kept.
+func (p *Proxy) rewriteSuggester(value interface{}, baseIndex string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	output := make(map[string]interface{}, len(obj))
+	for key, val := range obj {
+		switch key {
+		case "field":
+			if field, ok := val.(string); ok {
+				output[key] = p.prefixField(baseIndex, field)
+				continue
+			}
+			output[key] = val
+		case "direct_generator":
+			list, ok := val.([]interface{})
+			if !ok {
+				output[key] = val
+				continue
+			}
+			generators := make([]interface{}, 0, len(list))
+			for _, item := range list {
+				generators = append(generators, p.rewriteSuggester(item, baseIndex))
+			}
+			output[key] = generators
+		case "collate":
+			output[key] = p.rewriteQueryValue(val, baseIndex)
+		default:
+			output[key] = val
+		}
+	}
+	return output
+}
+
+// rewritePercolate prefixes the percolator field of a percolate query and wraps
+// the percolated documents under the base index, like indexed documents.
+func (p *Proxy) rewritePercolate(value interface{}, baseIndex string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	output := make(map[string]interface{}, len(obj))
+	for key, val := range obj {
+		switch key {
+		case "field":
+			if field, ok := val.(string); ok {
+				output[key] = p.prefixField(baseIndex, field)
+				continue
+			}
+			output[key] = val
+		case "document":
+			output[key] = wrapPercolateDocument(val, baseIndex)
+		case "documents":
+			list, ok := val.([]interface{})
+			if !ok {
+				output[key] = val
+				continue
+			}
+			docs := make([]interface{}, 0, len(list))
+			for _, item := range list {
+				docs = append(docs, wrapPercolateDocument(item, baseIndex))
+			}
+			output[key] = docs
+		default:
+			output[key] = val
+		}
+	}
+	return output
+}
+
+// rewriteNested prefixes the path of nested queries, nested sort options, and
+// nested and reverse_nested aggregations, along with their inner fields.
+func (p *Proxy) rewriteNested(value interface{}, baseIndex string) interface{} {
+	rewritten := p.rewriteQueryValue(value, baseIndex)
+	obj, ok := rewritten.(map[string]interface{})
+	if !ok {
+		return rewritten
+	}
+	if path, ok := obj["path"].(string); ok {
+		obj["path"] = p.prefixField(baseIndex, path)
+	}
+	return obj
+}
+
+func wrapPercolateDocument(value interface{}, baseIndex string) interface{} {
+	if doc, ok := value.(map[string]interface{}); ok {
+		return map[string]interface{}{baseIndex: doc}
+	}
+	return value
+}
+
+// rewriteScriptValue rewrites a script definition, either an inline source string
+// or an object with source and params, so field references resolve against the
+// wrapped document. A script query nests the definition under another "script"
+// key, which is handled by recursing.
+func (p *Proxy) rewriteScriptValue(value interface{}, baseIndex string) interface{} {
+	switch typed := value.(type) {
+	case string:
+		return p.rewriteScriptSource(typed, baseIndex)
+	case map[string]interface{}:
+		output := make(map[string]interface{}, len(typed))
+		for key, val := range typed {
+			switch key {
+			case "source", "inline":
+				if source, ok := val.(string); ok {
+					output[key] = p.rewriteScriptSource(source, baseIndex)
+					continue
+				}
+				output[key] = val
+			case "script":
+				output[key] = p.rewriteScriptValue(val, baseIndex)
+			case "params", "lang", "id", "options":
+				output[key] = val
+			default:
+				output[key] = p.rewriteQueryValue(val, baseIndex)
+			}
+		}
+		return output
+	default:
+		return value
+	}
+}
+
+// rewriteScriptSource prefixes doc['field'] and params._source.field references
+// in painless source with the base index.
+func (p *Proxy) rewriteScriptSource(source, baseIndex string) string {
+	rewritten := scriptDocFieldPattern.ReplaceAllStringFunc(source, func(match string) string {
+		parts := scriptDocFieldPattern.FindStringSubmatch(match)
+		if parts[1] != parts[3] {
+			return match
+		}
+		return "doc[" + parts[1] + p.prefixField(baseIndex, parts[2]) + parts[3] + "]"
+	})
+	return scriptSourceFieldPattern.ReplaceAllStringFunc(rewritten, func(match string) string {
+		field := strings.TrimPrefix(match, "params._source.")
+		if field == baseIndex || p.skipField(field) {
+			return match
+		}
+		return "params._source." + baseIndex + "." + field
+	})
+}
+
+func (p *Proxy) prefixField(baseIndex, field string) string {
+	if field == "" || p.skipField(field) {
+		return field
+	}
+	if strings.HasPrefix(field, baseIndex+".") {
+		return field
+	}
+	rewritten := baseIndex + "." + field
+	if p.cfg.Verbose {
+		p.logVerbose("field rewrite: %s -> %s", field, rewritten)
+	}
+	return rewritten
+}
+
+// skipField reports whether field is left unprefixed: every field when sources
+// are not wrapped, metadata fields, and the configured skip fields, where an
+// entry ending in "*" matches by prefix.
+func (p *Proxy) skipField(field string) bool {
+	if !p.cfg.IndexPerTenant.SourceWrapped() {
+		return true
+	}
+	if _, ok := metadataFields[field]; ok {
+		return true
+	}
+	for _, entry := range p.cfg.IndexPerTenant.SkipFields {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(field, prefix) {
+				return true
+			}
+			continue
+		}
+		if field == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixContextPaths prefixes the path of completion field contexts, which
+// names the field a context value is read from relative to the document root
+// and so must point into the wrapped document.
+func (p *Proxy) prefixContextPaths(props map[string]interface{}, baseIndex string) {
+	for _, value := range props {
+		field, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if contexts, ok := field["contexts"].([]interface{}); ok && field["type"] == "completion" {
+			for _, item := range contexts {
+				context, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if path, ok := context["path"].(string); ok {
+					context["path"] = p.prefixField(baseIndex, path)
+				}
+			}
+		}
+		for _, key := range []string{"properties", "fields"} {
+			if nested, ok := field[key].(map[string]interface{}); ok {
+				p.prefixContextPaths(nested, baseIndex)
+			}
+		}
+	}
+}
+
+func wrapProperties(props map[string]interface{}, baseIndex string) map[string]interface{} {
+	if existing, ok := props[baseIndex]; ok {
+		if inner, ok := existing.(map[string]interface{}); ok {
+			if _, ok := inner["properties"]; ok {
+				return props
+			}
+		}
+	}
+	return map[string]interface{}{
+		baseIndex: map[string]interface{}{
+			"properties": props,
+		},
+	}
+}
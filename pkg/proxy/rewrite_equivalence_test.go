@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// Queries both rewriters support must produce the same body.
+func TestRewriteQueryBodyEquivalence(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	queries := map[string]string{
+		"match":     `{"query":{"match":{"message":"error"}}}`,
+		"term":      `{"query":{"term":{"status":{"value":"active"}}}}`,
+		"range":     `{"query":{"range":{"age":{"gte":10,"lt":20}}}}`,
+		"prefix":    `{"query":{"prefix":{"name":"jo"}}}`,
+		"bool":      `{"query":{"bool":{"must":[{"match":{"title":"go"}}],"filter":[{"term":{"lang":"en"}}],"should":[{"range":{"stars":{"gt":5}}}],"must_not":[{"term":{"deleted":true}}]}}}`,
+		"sort":      `{"query":{"match_all":{}},"sort":["date",{"score":{"order":"desc"}}]}`,
+		"source":    `{"_source":["title","author"],"query":{"match_all":{}}}`,
+		"sourceObj": `{"_source":{"includes":["title"],"excludes":["body"]}}`,
+		"fields":    `{"fields":["title",{"field":"date","format":"epoch_millis"}]}`,
+		"highlight": `{"query":{"match":{"body":"x"}},"highlight":{"fields":{"body":{}}}}`,
+		"collapse":  `{"query":{"match_all":{}},"collapse":{"field":"user"}}`,
+		"aggs":      `{"size":0,"aggs":{"by_user":{"terms":{"field":"user"},"aggs":{"avg_age":{"avg":{"field":"age"}}}}}}`,
+		"knn":       `{"knn":{"field":"vector","query_vector":[0.1,0.2],"k":3,"num_candidates":10}}`,
+		"script":    `{"script_fields":{"double":{"script":{"source":"doc['price'].value * 2"}}}}`,
+		"suggest":   `{"suggest":{"text":"tset","spelling":{"phrase":{"field":"title.trigram","direct_generator":[{"field":"title.trigram"}],"collate":{"query":{"source":{"match":{"title":"{{suggestion}}"}}}}}},"names":{"prefix":"jo","completion":{"field":"name_suggest","contexts":{"place":["cafe"]}}}}}`,
+		"percolate": `{"query":{"percolate":{"field":"query","document":{"title":"outage","tags":["a"]}}}}`,
+		"nested":    `{"query":{"nested":{"path":"lines","query":{"match":{"lines.sku":"a1"}}}},"sort":["_score",{"lines.price":{"nested":{"path":"lines"}}}]}`,
+		"runtime":   `{"runtime_mappings":{"day":{"type":"keyword","script":{"source":"emit(doc['created'].value.toString())"}}},"docvalue_fields":[{"field":"created","format":"epoch_millis"}],"stored_fields":"_none_"}`,
+		"empty":     `{}`,
+	}
+	for name, query := range queries {
+		t.Run(name, func(t *testing.T) {
+			fast, err := p.rewriteQueryBodyFastJSON([]byte(query), "logs")
+			if err != nil {
+				t.Fatalf("fastjson: %v", err)
+			}
+			std, err := p.rewriteQueryBodyStdlib([]byte(query), "logs")
+			if err != nil {
+				t.Fatalf("stdlib: %v", err)
+			}
+			var fastOut, stdOut interface{}
+			if err := json.Unmarshal(fast, &fastOut); err != nil {
+				t.Fatalf("fastjson output: %v", err)
+			}
+			if err := json.Unmarshal(std, &stdOut); err != nil {
+				t.Fatalf("stdlib output: %v", err)
+			}
+			if !reflect.DeepEqual(fastOut, stdOut) {
+				t.Fatalf("rewriters differ:\nfastjson: %s\nstdlib:   %s", fast, std)
+			}
+		})
+	}
+}
+
+func TestRewriteQueryBodySelectsRewriter(t *testing.T) {
+	query := []byte(`{"query":{"multi_match":{"query":"x","fields":["title"]}}}`)
+
+	p := setupTestProxy("per-tenant")
+	p.cfg.Rewriter = "stdlib"
+	if _, err := p.rewriteQueryBody(query, "logs"); err == nil {
+		t.Fatal("expected stdlib rewriter to reject multi_match")
+	}
+
+	for _, rewriter := range []string{"", "auto", "fastjson", "FastJSON"} {
+		p.cfg.Rewriter = rewriter
+		if _, err := p.rewriteQueryBody(query, "logs"); err != nil {
+			t.Fatalf("rewriter %q: unexpected error: %v", rewriter, err)
+		}
+	}
+}
+
+func TestRewriteQueryBodyInvalidJSONAllRewriters(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	for _, rewriter := range []string{"auto", "fastjson", "stdlib"} {
+		p.cfg.Rewriter = rewriter
+		_, err := p.rewriteQueryBody([]byte(`{invalid`), "logs")
+		if err == nil || !contains(err.Error(), "invalid JSON body") {
+			t.Fatalf("rewriter %q: expected invalid JSON error, got %v", rewriter, err)
+		}
+	}
+}
@@ -0,0 +1,684 @@
+package proxy
+
+import "github.com/valyala/fastjson"
+
+var (
+	queryParserPool fastjson.ParserPool
+	queryArenaPool  fastjson.ArenaPool
+)
+
+// rewriteQueryBodyFastJSON rewrites query bodies using fastjson for better performance.
+// This implementation uses zero-allocation parsing and efficient field rewriting.
+func (p *Proxy) rewriteQueryBodyFastJSON(body []byte, baseIndex string) ([]byte, error) {
+	if !p.wrapSource() {
+		return body, nil
+	}
+
+	parser := queryParserPool.Get()
+	defer queryParserPool.Put(parser)
+	v, err := parser.ParseBytes(body)
+	if err != nil {
+		return nil, invalidJSONError(err)
+	}
+
+	// Fast path: empty query
+	if v.Type() == fastjson.TypeObject && len(v.GetObject().String()) == 2 { // "{}"
+		return body, nil
+	}
+
+	// Use a pooled arena for efficient memory allocation. The rewritten value is
+	// marshaled into a fresh slice before the arena is reused.
+	arena := queryArenaPool.Get()
+	defer queryArenaPool.Put(arena)
+	rewritten := p.rewriteQueryValueFastJSON(v, baseIndex, arena)
+
+	return rewritten.MarshalTo(make([]byte, 0, len(body)+len(body)/4)), nil
+}
+
+// rewriteQueryValueFastJSON recursively rewrites a fastjson Value
+func (p *Proxy) rewriteQueryValueFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	switch v.Type() {
+	case fastjson.TypeObject:
+		return p.rewriteObjectFastJSON(v, baseIndex, arena)
+	case fastjson.TypeArray:
+		return p.rewriteArrayFastJSON(v, baseIndex, arena)
+	default:
+		// Primitive values (string, number, bool, null) are returned as-is
+		return v
+	}
+}
+
+// rewriteObjectFastJSON rewrites a JSON object
+func (p *Proxy) rewriteObjectFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		keyStr := string(key)
+
+		switch keyStr {
+		case "match", "term", "range", "prefix", "wildcard", "regexp":
+			// Rewrite field names in query clauses
+			rewritten := p.rewriteFieldObjectFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "fields", "docvalue_fields":
+			// Rewrite field list
+			rewritten := p.rewriteFieldListFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "stored_fields":
+			// Rewrite stored field names
+			rewritten := p.rewriteStoredFieldsFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "runtime_mappings":
+			// Rewrite runtime field names and scripts
+			rewritten := p.rewriteRuntimeMappingsFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "sort":
+			// Rewrite sort fields
+			rewritten := p.rewriteSortValueFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "_source":
+			// Rewrite _source filter
+			rewritten := p.rewriteSourceFilterFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "script":
+			// Rewrite field references inside painless scripts
+			rewritten := p.rewriteScriptFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "highlight":
+			// Rewrite highlighted field names
+			rewritten := p.rewriteHighlightFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "collapse":
+			// Rewrite collapse field and inner_hits
+			rewritten := p.rewriteCollapseFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "knn":
+			// Rewrite the vector field and its filter
+			rewritten := p.rewriteKnnFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "suggest":
+			// Rewrite suggester fields
+			rewritten := p.rewriteSuggestFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "percolate":
+			// Rewrite the percolator field and wrap percolated documents
+			rewritten := p.rewritePercolateFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		case "nested", "reverse_nested":
+			// Rewrite the nested path and inner fields
+			rewritten := p.rewriteNestedFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+
+		default:
+			// Recursively rewrite nested values
+			rewritten := p.rewriteQueryValueFastJSON(v, baseIndex, arena)
+			result.Set(keyStr, rewritten)
+		}
+	})
+
+	return result
+}
+
+// rewriteArrayFastJSON rewrites a JSON array
+func (p *Proxy) rewriteArrayFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	arr := v.GetArray()
+	if arr == nil {
+		return v
+	}
+
+	result := arena.NewArray()
+	for _, item := range arr {
+		rewritten := p.rewriteQueryValueFastJSON(item, baseIndex, arena)
+		result.SetArrayItem(len(result.GetArray()), rewritten)
+	}
+
+	return result
+}
+
+// rewriteFieldObjectFastJSON rewrites field objects (match, term, range, etc.)
+func (p *Proxy) rewriteFieldObjectFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		// Prefix the field name with baseIndex
+		fieldName := string(key)
+		prefixedField := p.prefixField(baseIndex, fieldName)
+
+		// Recursively rewrite the value
+		rewritten := p.rewriteQueryValueFastJSON(v, baseIndex, arena)
+		result.Set(prefixedField, rewritten)
+	})
+
+	return result
+}
+
+// rewriteFieldListFastJSON rewrites a list of field names
+func (p *Proxy) rewriteFieldListFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	arr := v.GetArray()
+	if arr == nil {
+		return v
+	}
+
+	result := arena.NewArray()
+	for _, item := range arr {
+		switch item.Type() {
+		case fastjson.TypeString:
+			fieldName := string(item.GetStringBytes())
+			prefixedField := p.prefixField(baseIndex, fieldName)
+			result.SetArrayItem(len(result.GetArray()), arena.NewString(prefixedField))
+		case fastjson.TypeObject:
+			// {"field": ..., "format": ...} entries of fields and docvalue_fields
+			entry := arena.NewObject()
+			item.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+				if string(key) == "field" && v.Type() == fastjson.TypeString {
+					entry.Set("field", arena.NewString(p.prefixField(baseIndex, string(v.GetStringBytes()))))
+					return
+				}
+				entry.Set(string(key), v)
+			})
+			result.SetArrayItem(len(result.GetArray()), entry)
+		default:
+			result.SetArrayItem(len(result.GetArray()), item)
+		}
+	}
+
+	return result
+}
+
+// rewriteStoredFieldsFastJSON rewrites stored_fields (string or array), keeping _none_
+func (p *Proxy) rewriteStoredFieldsFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	switch v.Type() {
+	case fastjson.TypeString:
+		field := string(v.GetStringBytes())
+		if field == "_none_" {
+			return v
+		}
+		return arena.NewString(p.prefixField(baseIndex, field))
+	case fastjson.TypeArray:
+		result := arena.NewArray()
+		for i, item := range v.GetArray() {
+			result.SetArrayItem(i, p.rewriteStoredFieldsFastJSON(item, baseIndex, arena))
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// rewriteRuntimeMappingsFastJSON rewrites runtime field names, scripts, and lookup input fields
+func (p *Proxy) rewriteRuntimeMappingsFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+
+	obj.Visit(func(name []byte, definition *fastjson.Value) {
+		prefixedName := p.prefixField(baseIndex, string(name))
+		if definition.Type() != fastjson.TypeObject {
+			result.Set(prefixedName, definition)
+			return
+		}
+		rewritten := arena.NewObject()
+		definition.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+			keyStr := string(key)
+			switch keyStr {
+			case "script":
+				rewritten.Set(keyStr, p.rewriteScriptFastJSON(v, baseIndex, arena))
+			case "input_field":
+				if v.Type() == fastjson.TypeString {
+					rewritten.Set(keyStr, arena.NewString(p.prefixField(baseIndex, string(v.GetStringBytes()))))
+					return
+				}
+				rewritten.Set(keyStr, v)
+			default:
+				rewritten.Set(keyStr, v)
+			}
+		})
+		result.Set(prefixedName, rewritten)
+	})
+
+	return result
+}
+
+// rewriteSourceFilterFastJSON rewrites _source filter (string, array, or object)
+func (p *Proxy) rewriteSourceFilterFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	switch v.Type() {
+	case fastjson.TypeArray:
+		return p.rewriteFieldListFastJSON(v, baseIndex, arena)
+
+	case fastjson.TypeObject:
+		obj := v.GetObject()
+		if obj == nil {
+			return v
+		}
+
+		result := arena.NewObject()
+
+		obj.Visit(func(key []byte, v *fastjson.Value) {
+			keyStr := string(key)
+			if keyStr == "includes" || keyStr == "excludes" {
+				rewritten := p.rewriteSourceFilterFastJSON(v, baseIndex, arena)
+				result.Set(keyStr, rewritten)
+			} else {
+				result.Set(keyStr, v)
+			}
+		})
+
+		return result
+
+	default:
+		return v
+	}
+}
+
+// rewriteSortValueFastJSON rewrites sort specification, given as a list or a
+// single field name or object
+func (p *Proxy) rewriteSortValueFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	if v.Type() != fastjson.TypeArray {
+		return p.rewriteSortItemFastJSON(v, baseIndex, arena)
+	}
+
+	result := arena.NewArray()
+	for i, item := range v.GetArray() {
+		result.SetArrayItem(i, p.rewriteSortItemFastJSON(item, baseIndex, arena))
+	}
+
+	return result
+}
+
+// rewriteSortItemFastJSON rewrites a single sort field name or object
+func (p *Proxy) rewriteSortItemFastJSON(item *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	switch item.Type() {
+	case fastjson.TypeString:
+		// Simple string sort field
+		fieldName := string(item.GetStringBytes())
+		return arena.NewString(p.prefixField(baseIndex, fieldName))
+
+	case fastjson.TypeObject:
+		// Object with field name as key
+		rewritten := arena.NewObject()
+		item.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+			fieldName := string(key)
+			switch fieldName {
+			case "_script":
+				rewritten.Set(fieldName, p.rewriteQueryValueFastJSON(v, baseIndex, arena))
+			case "_geo_distance":
+				rewritten.Set(fieldName, p.rewriteGeoDistanceSortFastJSON(v, baseIndex, arena))
+			default:
+				prefixedField := p.prefixField(baseIndex, fieldName)
+				rewritten.Set(prefixedField, p.rewriteQueryValueFastJSON(v, baseIndex, arena))
+			}
+		})
+		return rewritten
+
+	default:
+		return item
+	}
+}
+
+// rewriteGeoDistanceSortFastJSON prefixes the field a _geo_distance sort measures from
+func (p *Proxy) rewriteGeoDistanceSortFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		fieldName := string(key)
+		if _, option := geoDistanceSortOptions[fieldName]; option {
+			result.Set(fieldName, p.rewriteQueryValueFastJSON(v, baseIndex, arena))
+			return
+		}
+		result.Set(p.prefixField(baseIndex, fieldName), v)
+	})
+
+	return result
+}
+
+// rewriteScriptFastJSON rewrites a script definition (inline string or object)
+func (p *Proxy) rewriteScriptFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	switch v.Type() {
+	case fastjson.TypeString:
+		source := p.rewriteScriptSource(string(v.GetStringBytes()), baseIndex)
+		return arena.NewString(source)
+
+	case fastjson.TypeObject:
+		obj := v.GetObject()
+		if obj == nil {
+			return v
+		}
+
+		result := arena.NewObject()
+
+		obj.Visit(func(key []byte, v *fastjson.Value) {
+			keyStr := string(key)
+			switch keyStr {
+			case "source", "inline":
+				if v.Type() == fastjson.TypeString {
+					source := p.rewriteScriptSource(string(v.GetStringBytes()), baseIndex)
+					result.Set(keyStr, arena.NewString(source))
+					return
+				}
+				result.Set(keyStr, v)
+			case "script":
+				// Script queries nest the definition under another "script" key
+				result.Set(keyStr, p.rewriteScriptFastJSON(v, baseIndex, arena))
+			case "params", "lang", "id", "options":
+				result.Set(keyStr, v)
+			default:
+				result.Set(keyStr, p.rewriteQueryValueFastJSON(v, baseIndex, arena))
+			}
+		})
+
+		return result
+
+	default:
+		return v
+	}
+}
+
+// rewriteHighlightFastJSON rewrites the fields of a highlight section
+func (p *Proxy) rewriteHighlightFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		keyStr := string(key)
+		switch keyStr {
+		case "fields":
+			result.Set(keyStr, p.rewriteHighlightFieldsFastJSON(v, baseIndex, arena))
+		case "highlight_query":
+			result.Set(keyStr, p.rewriteQueryValueFastJSON(v, baseIndex, arena))
+		default:
+			result.Set(keyStr, v)
+		}
+	})
+
+	return result
+}
+
+// rewriteHighlightFieldsFastJSON rewrites highlight fields given as an object or a list of objects
+func (p *Proxy) rewriteHighlightFieldsFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	switch v.Type() {
+	case fastjson.TypeObject:
+		result := arena.NewObject()
+		v.GetObject().Visit(func(key []byte, options *fastjson.Value) {
+			prefixedField := p.prefixField(baseIndex, string(key))
+			result.Set(prefixedField, p.rewriteHighlightFieldOptionsFastJSON(options, baseIndex, arena))
+		})
+		return result
+
+	case fastjson.TypeArray:
+		result := arena.NewArray()
+		for _, item := range v.GetArray() {
+			result.SetArrayItem(len(result.GetArray()), p.rewriteHighlightFieldsFastJSON(item, baseIndex, arena))
+		}
+		return result
+
+	default:
+		return v
+	}
+}
+
+// rewriteHighlightFieldOptionsFastJSON rewrites per-field highlight options
+func (p *Proxy) rewriteHighlightFieldOptionsFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		keyStr := string(key)
+		switch keyStr {
+		case "matched_fields":
+			result.Set(keyStr, p.rewriteFieldListFastJSON(v, baseIndex, arena))
+		case "highlight_query":
+			result.Set(keyStr, p.rewriteQueryValueFastJSON(v, baseIndex, arena))
+		default:
+			result.Set(keyStr, v)
+		}
+	})
+
+	return result
+}
+
+// rewriteCollapseFastJSON rewrites the collapse field and inner_hits
+func (p *Proxy) rewriteCollapseFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		keyStr := string(key)
+		switch keyStr {
+		case "field":
+			if v.Type() == fastjson.TypeString {
+				prefixedField := p.prefixField(baseIndex, string(v.GetStringBytes()))
+				result.Set(keyStr, arena.NewString(prefixedField))
+				return
+			}
+			result.Set(keyStr, v)
+		case "inner_hits":
+			result.Set(keyStr, p.rewriteQueryValueFastJSON(v, baseIndex, arena))
+		default:
+			result.Set(keyStr, v)
+		}
+	})
+
+	return result
+}
+
+// rewriteKnnFastJSON rewrites a knn section or query in either the Elasticsearch
+// ("field" key) or OpenSearch (keyed by field name) form
+func (p *Proxy) rewriteKnnFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	switch v.Type() {
+	case fastjson.TypeArray:
+		result := arena.NewArray()
+		for i, item := range v.GetArray() {
+			result.SetArrayItem(i, p.rewriteKnnFastJSON(item, baseIndex, arena))
+		}
+		return result
+	case fastjson.TypeObject:
+		if field := v.Get("field"); field != nil && field.Type() == fastjson.TypeString {
+			return p.rewriteKnnOptionsFastJSON(v, baseIndex, arena)
+		}
+		result := arena.NewObject()
+		v.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+			prefixedField := p.prefixField(baseIndex, string(key))
+			if v.Type() != fastjson.TypeObject {
+				result.Set(prefixedField, v)
+				return
+			}
+			result.Set(prefixedField, p.rewriteKnnOptionsFastJSON(v, baseIndex, arena))
+		})
+		return result
+	default:
+		return v
+	}
+}
+
+// rewriteKnnOptionsFastJSON rewrites the options of a single knn search
+func (p *Proxy) rewriteKnnOptionsFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	result := arena.NewObject()
+
+	v.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+		keyStr := string(key)
+		switch keyStr {
+		case "field":
+			if v.Type() == fastjson.TypeString {
+				prefixedField := p.prefixField(baseIndex, string(v.GetStringBytes()))
+				result.Set(keyStr, arena.NewString(prefixedField))
+				return
+			}
+			result.Set(keyStr, v)
+		case "filter", "inner_hits":
+			result.Set(keyStr, p.rewriteQueryValueFastJSON(v, baseIndex, arena))
+		default:
+			result.Set(keyStr, v)
+		}
+	})
+
+	return result
+}
+
+// rewriteSuggestFastJSON rewrites the term, phrase, and completion suggesters of a suggest section
+func (p *Proxy) rewriteSuggestFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+
+	obj.Visit(func(name []byte, suggestion *fastjson.Value) {
+		if suggestion.Type() != fastjson.TypeObject {
+			result.Set(string(name), suggestion)
+			return
+		}
+		rewritten := arena.NewObject()
+		suggestion.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+			keyStr := string(key)
+			switch keyStr {
+			case "term", "phrase", "completion":
+				rewritten.Set(keyStr, p.rewriteSuggesterFastJSON(v, baseIndex, arena))
+			default:
+				rewritten.Set(keyStr, v)
+			}
+		})
+		result.Set(string(name), rewritten)
+	})
+
+	return result
+}
+
+// rewriteSuggesterFastJSON rewrites the field, direct generators, and collate query of a suggester
+func (p *Proxy) rewriteSuggesterFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		keyStr := string(key)
+		switch keyStr {
+		case "field":
+			if v.Type() == fastjson.TypeString {
+				prefixedField := p.prefixField(baseIndex, string(v.GetStringBytes()))
+				result.Set(keyStr, arena.NewString(prefixedField))
+				return
+			}
+			result.Set(keyStr, v)
+		case "direct_generator":
+			if v.Type() != fastjson.TypeArray {
+				result.Set(keyStr, v)
+				return
+			}
+			generators := arena.NewArray()
+			for i, item := range v.GetArray() {
+				generators.SetArrayItem(i, p.rewriteSuggesterFastJSON(item, baseIndex, arena))
+			}
+			result.Set(keyStr, generators)
+		case "collate":
+			result.Set(keyStr, p.rewriteQueryValueFastJSON(v, baseIndex, arena))
+		default:
+			result.Set(keyStr, v)
+		}
+	})
+
+	return result
+}
+
+// rewritePercolateFastJSON rewrites the percolator field and wraps the documents of a percolate query
+func (p *Proxy) rewritePercolateFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	obj := v.GetObject()
+	if obj == nil {
+		return v
+	}
+
+	result := arena.NewObject()
+
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		keyStr := string(key)
+		switch keyStr {
+		case "field":
+			if v.Type() == fastjson.TypeString {
+				prefixedField := p.prefixField(baseIndex, string(v.GetStringBytes()))
+				result.Set(keyStr, arena.NewString(prefixedField))
+				return
+			}
+			result.Set(keyStr, v)
+		case "document":
+			result.Set(keyStr, wrapPercolateDocumentFastJSON(v, baseIndex, arena))
+		case "documents":
+			if v.Type() != fastjson.TypeArray {
+				result.Set(keyStr, v)
+				return
+			}
+			docs := arena.NewArray()
+			for i, item := range v.GetArray() {
+				docs.SetArrayItem(i, wrapPercolateDocumentFastJSON(item, baseIndex, arena))
+			}
+			result.Set(keyStr, docs)
+		default:
+			result.Set(keyStr, v)
+		}
+	})
+
+	return result
+}
+
+// rewriteNestedFastJSON rewrites the path and inner fields of nested queries, sorts, and aggregations
+func (p *Proxy) rewriteNestedFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	rewritten := p.rewriteQueryValueFastJSON(v, baseIndex, arena)
+	path := rewritten.Get("path")
+	if path == nil || path.Type() != fastjson.TypeString {
+		return rewritten
+	}
+	rewritten.Set("path", arena.NewString(p.prefixField(baseIndex, string(path.GetStringBytes()))))
+	return rewritten
+}
+
+func wrapPercolateDocumentFastJSON(v *fastjson.Value, baseIndex string, arena *fastjson.Arena) *fastjson.Value {
+	if v.Type() != fastjson.TypeObject {
+		return v
+	}
+	wrapped := arena.NewObject()
+	wrapped.Set(baseIndex, v)
+	return wrapped
+}
@@ -5,7 +5,7 @@ import (
 	"testing"
 	"text/template"
 
-	"es-tmnt/internal/config"
+	"es-tmnt/pkg/config"
 )
 
 // setupProxyForBench creates a proxy instance for benchmarking query rewrites
@@ -252,9 +252,9 @@ func TestRewriteQueryBodyFastJSON_SortNonArray(t *testing.T) {
 		t.Fatalf("failed to unmarshal result: %v", err)
 	}
 
-	// Non-array sort should be preserved as-is
-	if output["sort"].(string) != "timestamp" {
-		t.Errorf("expected timestamp, got: %v", output["sort"])
+	// A single sort field is prefixed like a list entry
+	if output["sort"].(string) != "logs.timestamp" {
+		t.Errorf("expected logs.timestamp, got: %v", output["sort"])
 	}
 }
 
@@ -6,7 +6,7 @@ import (
 	"testing"
 	"text/template"
 
-	"es-tmnt/internal/config"
+	"es-tmnt/pkg/config"
 )
 
 // setupTestProxy creates a minimal proxy for testing
@@ -512,3 +512,172 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestRewriteQueryBodyFastJSON_ScriptFields(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	query := []byte(`{"script_fields":{"double_price":{"script":{"source":"doc['price'].value * params.factor","params":{"factor":2}}}}}`)
+
+	result, err := p.rewriteQueryBodyFastJSON(query, "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	field := output["script_fields"].(map[string]interface{})["double_price"].(map[string]interface{})
+	script := field["script"].(map[string]interface{})
+	if script["source"] != "doc['logs.price'].value * params.factor" {
+		t.Errorf("expected prefixed doc reference, got: %v", script["source"])
+	}
+	params := script["params"].(map[string]interface{})
+	if params["factor"] != float64(2) {
+		t.Errorf("expected params untouched, got: %v", params)
+	}
+}
+
+func TestRewriteQueryBodyFastJSON_ScriptQueryAndSort(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	query := []byte(`{"query":{"script":{"script":"params._source.count > 1 && doc[\"level\"].value == 'x'"}},"sort":[{"_script":{"type":"number","script":{"source":"doc['logs.rank'].value"}}}]}`)
+
+	result, err := p.rewriteQueryBodyFastJSON(query, "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	scriptQuery := output["query"].(map[string]interface{})["script"].(map[string]interface{})
+	expected := "params._source.logs.count > 1 && doc[\"logs.level\"].value == 'x'"
+	if scriptQuery["script"] != expected {
+		t.Errorf("expected %q, got: %v", expected, scriptQuery["script"])
+	}
+	sort := output["sort"].([]interface{})[0].(map[string]interface{})
+	sortScript, ok := sort["_script"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected _script sort key to be preserved, got: %v", sort)
+	}
+	source := sortScript["script"].(map[string]interface{})["source"]
+	if source != "doc['logs.rank'].value" {
+		t.Errorf("expected already-prefixed reference untouched, got: %v", source)
+	}
+}
+
+func TestRewriteQueryBodyFastJSON_HighlightCollapseRescore(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	query := []byte(`{
+		"highlight":{"pre_tags":["<em>"],"fields":{"title":{"matched_fields":["title","title.plain"]},"body":{}}},
+		"collapse":{"field":"user","inner_hits":{"name":"latest","sort":["date"]}},
+		"rescore":{"window_size":10,"query":{"rescore_query":{"match":{"title":"x"}}}}
+	}`)
+
+	result, err := p.rewriteQueryBodyFastJSON(query, "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	highlight := output["highlight"].(map[string]interface{})
+	fields := highlight["fields"].(map[string]interface{})
+	title, ok := fields["logs.title"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected logs.title highlight field, got: %v", fields)
+	}
+	if _, ok := fields["logs.body"]; !ok {
+		t.Errorf("expected logs.body highlight field, got: %v", fields)
+	}
+	matched := title["matched_fields"].([]interface{})
+	if matched[0] != "logs.title" || matched[1] != "logs.title.plain" {
+		t.Errorf("expected prefixed matched_fields, got: %v", matched)
+	}
+	if tags := highlight["pre_tags"].([]interface{}); tags[0] != "<em>" {
+		t.Errorf("expected pre_tags untouched, got: %v", tags)
+	}
+
+	collapse := output["collapse"].(map[string]interface{})
+	if collapse["field"] != "logs.user" {
+		t.Errorf("expected logs.user collapse field, got: %v", collapse["field"])
+	}
+	innerHits := collapse["inner_hits"].(map[string]interface{})
+	if innerHits["name"] != "latest" {
+		t.Errorf("expected inner_hits name untouched, got: %v", innerHits["name"])
+	}
+	if sort := innerHits["sort"].([]interface{}); sort[0] != "logs.date" {
+		t.Errorf("expected prefixed inner_hits sort, got: %v", sort)
+	}
+
+	rescore := output["rescore"].(map[string]interface{})
+	rescoreQuery := rescore["query"].(map[string]interface{})["rescore_query"].(map[string]interface{})
+	if _, ok := rescoreQuery["match"].(map[string]interface{})["logs.title"]; !ok {
+		t.Errorf("expected prefixed rescore query field, got: %v", rescoreQuery)
+	}
+}
+
+func TestRewriteQueryBodyFastJSON_HighlightFieldsArray(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	query := []byte(`{"highlight":{"fields":[{"title":{}},{"body":{"highlight_query":{"term":{"body":"x"}}}}]}}`)
+
+	result, err := p.rewriteQueryBodyFastJSON(query, "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	fields := output["highlight"].(map[string]interface{})["fields"].([]interface{})
+	if _, ok := fields[0].(map[string]interface{})["logs.title"]; !ok {
+		t.Errorf("expected logs.title in first highlight entry, got: %v", fields[0])
+	}
+	body := fields[1].(map[string]interface{})["logs.body"].(map[string]interface{})
+	term := body["highlight_query"].(map[string]interface{})["term"].(map[string]interface{})
+	if _, ok := term["logs.body"]; !ok {
+		t.Errorf("expected prefixed highlight_query, got: %v", term)
+	}
+}
+
+func TestRewriteQueryBodyFastJSON_Knn(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	query := []byte(`{"knn":[{"field":"embedding","query_vector":[0.1,0.2],"k":5,"num_candidates":50,"filter":{"term":{"status":"ok"}}}],"query":{"knn":{"title_vector":{"vector":[1,2],"k":3,"filter":{"match":{"title":"x"}}}}}}`)
+
+	result, err := p.rewriteQueryBodyFastJSON(query, "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	knn := output["knn"].([]interface{})[0].(map[string]interface{})
+	if knn["field"] != "logs.embedding" {
+		t.Errorf("expected prefixed knn field, got: %v", knn["field"])
+	}
+	if vector := knn["query_vector"].([]interface{}); len(vector) != 2 || vector[0] != 0.1 {
+		t.Errorf("expected query_vector untouched, got: %v", vector)
+	}
+	if _, ok := knn["filter"].(map[string]interface{})["term"].(map[string]interface{})["logs.status"]; !ok {
+		t.Errorf("expected prefixed knn filter, got: %v", knn["filter"])
+	}
+
+	knnQuery := output["query"].(map[string]interface{})["knn"].(map[string]interface{})
+	options, ok := knnQuery["logs.title_vector"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected prefixed knn query field, got: %v", knnQuery)
+	}
+	if _, ok := options["filter"].(map[string]interface{})["match"].(map[string]interface{})["logs.title"]; !ok {
+		t.Errorf("expected prefixed knn query filter, got: %v", options["filter"])
+	}
+}
@@ -332,10 +332,15 @@ func TestRewriteSortValue_MixedTypes(t *testing.T) {
 func TestRewriteSortValue_NonArray(t *testing.T) {
 	p := setupTestProxy("per-tenant")
 
-	// Non-array should be returned as-is
+	// A single field name is prefixed like a list entry
 	result := p.rewriteSortValue("field1", "logs")
-	if result.(string) != "field1" {
-		t.Errorf("expected field1, got: %v", result)
+	if result.(string) != "logs.field1" {
+		t.Errorf("expected logs.field1, got: %v", result)
+	}
+
+	result = p.rewriteSortValue(map[string]interface{}{"field1": "desc"}, "logs")
+	if _, ok := result.(map[string]interface{})["logs.field1"]; !ok {
+		t.Errorf("expected logs.field1 key, got: %v", result)
 	}
 
 	result = p.rewriteSortValue(123, "logs")
@@ -511,3 +516,94 @@ func TestRewriteQueryValue_Source(t *testing.T) {
 		t.Errorf("expected logs.field1 in includes, got: %v", includes[0])
 	}
 }
+
+func TestRewriteQueryBodyStdlib_ScriptQuery(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	query := []byte(`{"query":{"script":{"script":{"source":"doc['level'].value == params.level && params._source.logs.count > 0","params":{"level":"error"}}}}}`)
+
+	result, err := p.rewriteQueryBodyStdlib(query, "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	scriptQuery := output["query"].(map[string]interface{})["script"].(map[string]interface{})
+	script := scriptQuery["script"].(map[string]interface{})
+	expected := "doc['logs.level'].value == params.level && params._source.logs.count > 0"
+	if script["source"] != expected {
+		t.Errorf("expected %q, got: %v", expected, script["source"])
+	}
+}
+
+func TestRewriteQueryBodyStdlib_ScriptSort(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	query := []byte(`{"sort":[{"_script":{"type":"number","script":"doc['rank'].value"}}]}`)
+
+	result, err := p.rewriteQueryBodyStdlib(query, "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	sort := output["sort"].([]interface{})[0].(map[string]interface{})
+	sortScript := sort["_script"].(map[string]interface{})
+	if sortScript["script"] != "doc['logs.rank'].value" {
+		t.Errorf("expected prefixed script sort, got: %v", sortScript["script"])
+	}
+}
+
+func TestRewriteQueryBodyStdlib_HighlightAndCollapse(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	query := []byte(`{"query":{"match":{"title":"x"}},"highlight":{"fields":{"title":{}}},"collapse":{"field":"user"}}`)
+
+	result, err := p.rewriteQueryBodyStdlib(query, "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	fields := output["highlight"].(map[string]interface{})["fields"].(map[string]interface{})
+	if _, ok := fields["logs.title"]; !ok {
+		t.Errorf("expected logs.title highlight field, got: %v", fields)
+	}
+	collapse := output["collapse"].(map[string]interface{})
+	if collapse["field"] != "logs.user" {
+		t.Errorf("expected logs.user collapse field, got: %v", collapse["field"])
+	}
+}
+
+func TestRewriteQueryBodyStdlib_Knn(t *testing.T) {
+	p := setupTestProxy("per-tenant")
+	query := []byte(`{"knn":{"field":"embedding","query_vector":[0.1,0.2],"k":5,"filter":[{"term":{"status":"ok"}}]}}`)
+
+	result, err := p.rewriteQueryBodyStdlib(query, "logs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	knn := output["knn"].(map[string]interface{})
+	if knn["field"] != "logs.embedding" {
+		t.Errorf("expected prefixed knn field, got: %v", knn["field"])
+	}
+	filter := knn["filter"].([]interface{})[0].(map[string]interface{})
+	if _, ok := filter["term"].(map[string]interface{})["logs.status"]; !ok {
+		t.Errorf("expected prefixed knn filter, got: %v", filter)
+	}
+}
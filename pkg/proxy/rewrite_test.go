@@ -0,0 +1,811 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fastjson"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestRewriteDocumentBodyInvalidJSON(t *testing.T) {
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+
+	_, err := proxyHandler.rewriteDocumentBody([]byte("{"), "orders", "tenant1")
+	if err == nil {
+		t.Fatalf("expected error for invalid JSON body")
+	}
+}
+
+func TestRewriteUpdateBodyErrors(t *testing.T) {
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+
+	_, err := proxyHandler.rewriteUpdateBody([]byte(`{"script":"noop"}`), "orders", "tenant1")
+	if err == nil || !strings.Contains(err.Error(), "update body requires doc payload") {
+		t.Fatalf("expected missing doc error, got %v", err)
+	}
+
+	_, err = proxyHandler.rewriteUpdateBody([]byte(`{"doc":"bad"}`), "orders", "tenant1")
+	if err == nil || !strings.Contains(err.Error(), "update doc must be an object") {
+		t.Fatalf("expected doc object error, got %v", err)
+	}
+}
+
+func TestRewriteDocumentBodyPercolatorFields(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.PercolatorFields = []string{"query"}
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	rewritten, err := proxyHandler.rewriteDocumentBody([]byte(`{"owner":"ops","query":{"bool":{"must":[{"match":{"title":"outage"}},{"range":{"priority":{"gte":2}}}]}}}`), "alerts", "tenant1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"alerts":{"owner":"ops","query":{"bool":{"must":[{"match":{"alerts.title":"outage"}},{"range":{"alerts.priority":{"gte":2}}}]}}}}`
+	if string(rewritten) != want {
+		t.Fatalf("unexpected document:\n%s\nwant:\n%s", rewritten, want)
+	}
+
+	rewritten, err = proxyHandler.rewriteUpdateBody([]byte(`{"doc":{"query":{"term":{"level":"high"}}}}`), "alerts", "tenant1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = `{"doc":{"alerts":{"query":{"term":{"alerts.level":"high"}}}}}`
+	if string(rewritten) != want {
+		t.Fatalf("unexpected update:\n%s\nwant:\n%s", rewritten, want)
+	}
+}
+
+func TestRewriteBulkBodyErrors(t *testing.T) {
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+
+	cases := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "invalid action json",
+			body:    "{not-json}\n",
+			wantErr: "invalid bulk action line",
+		},
+		{
+			name:    "multiple actions",
+			body:    `{"index":{},"delete":{}}` + "\n",
+			wantErr: "bulk action must contain a single operation",
+		},
+		{
+			name:    "missing source",
+			body:    `{"index":{"_id":"1"}}`,
+			wantErr: "bulk payload missing source",
+		},
+		{
+			name:    "empty source line",
+			body:    `{"index":{"_id":"1"}}` + "\n\n",
+			wantErr: "bulk source line empty",
+		},
+		{
+			name:    "update doc error",
+			body:    `{"update":{"_id":"1"}}` + "\n" + `{"doc":"bad"}` + "\n",
+			wantErr: "update doc must be an object",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxyHandler.rewriteBulkBody(nil, []byte(tc.body), "orders-tenant1")
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected %q error, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRewriteBulkBodyLineTolerance(t *testing.T) {
+	want := `{"index":{"_index":"orders","_id":"1"}}` + "\n" + `{"tenant_id":"tenant1","total":1}` + "\n" +
+		`{"delete":{"_index":"orders","_id":"2"}}` + "\n"
+	crlf := "\ufeff" + `{"index":{"_index":"orders-tenant1","_id":"1"}}` + "\r\n" + `{"total":1}` + "\r\n" +
+		`{"delete":{"_index":"orders-tenant1","_id":"2"}}` + "\r\n"
+	pretty := "{\r\n  \"index\": {\r\n    \"_index\": \"orders-tenant1\",\r\n    \"_id\": \"1\"\r\n  }\r\n}\r\n" +
+		"{\n  \"total\": 1\n}\n" +
+		`{"delete":{"_index":"orders-tenant1","_id":"2"}}` + "\n"
+
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+	output, err := proxyHandler.rewriteBulkBody(nil, []byte(crlf), "")
+	if err != nil || string(output) != want {
+		t.Fatalf("expected CRLF and BOM to be accepted, got %q, %v", output, err)
+	}
+	if _, err := proxyHandler.rewriteBulkBody(nil, []byte(pretty), ""); err == nil || !strings.Contains(err.Error(), "bulk operation 1: invalid bulk action line") {
+		t.Fatalf("expected pretty-printed bulk to be rejected without repair, got %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.Bulk.RepairPrettyPrinted = true
+	proxyHandler, _ = newProxyWithServer(t, cfg)
+	output, err = proxyHandler.rewriteBulkBody(nil, []byte(pretty), "")
+	if err != nil || string(output) != want {
+		t.Fatalf("expected pretty-printed bulk to be repaired, got %q, %v", output, err)
+	}
+	if _, err := proxyHandler.rewriteBulkBody(nil, []byte("{\n  \"index\": {}\n"), "orders-tenant1"); err == nil || !strings.Contains(err.Error(), "bulk payload ends inside a JSON value") {
+		t.Fatalf("expected an unterminated value to be rejected, got %v", err)
+	}
+}
+
+func TestRewriteBulkBodyErrorNamesOperation(t *testing.T) {
+	body := `{"index":{"_index":"orders-tenant1"}}` + "\n" + `{"total":1}` + "\n" +
+		`{"delete":{"_index":"orders-tenant1","_id":"2"}}` + "\n" +
+		`{"create":{"_index":"orders-tenant1"}}` + "\n" + `{"total":` + "\n"
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+	_, err := proxyHandler.rewriteBulkBody(nil, []byte(body), "")
+	if err == nil || !strings.HasPrefix(err.Error(), "bulk operation 3: ") {
+		t.Fatalf("expected the third operation to be named, got %v", err)
+	}
+}
+
+func TestRewriteBulkStreamSummary(t *testing.T) {
+	cfg := config.Default()
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	body := strings.Join([]string{
+		`{"index":{"_index":"orders-tenant1","_id":"1"}}`,
+		`{"field":"value"}`,
+		`{"delete":{"_index":"users-tenant1","_id":"2"}}`,
+		`{"create":{"_index":"orders-tenant1"}}`,
+		`{"field":"value"}`,
+	}, "\n")
+	var output strings.Builder
+	summary := &bulkSummary{}
+	tenantID, err := proxyHandler.rewriteBulkStream(nil, strings.NewReader(body), &output, "", nil, summary)
+	if err != nil {
+		t.Fatalf("rewrite bulk: %v", err)
+	}
+	if tenantID != "tenant1" {
+		t.Fatalf("expected tenant1, got %q", tenantID)
+	}
+	if strings.Join(summary.targets, ",") != "shared-orders,shared-users" {
+		t.Fatalf("unexpected targets: %v", summary.targets)
+	}
+	if strings.Join(summary.ids, ",") != "1,2," {
+		t.Fatalf("unexpected ids: %v", summary.ids)
+	}
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[4], `"tenant_id":"tenant1"`) {
+		t.Fatalf("unexpected rewritten body: %q", output.String())
+	}
+}
+
+func TestRewriteBulkBodyRouting(t *testing.T) {
+	body := strings.Join([]string{
+		`{"index":{"_index":"orders-tenant1","_id":"1","routing":"user7"}}`,
+		`{"field":"value"}`,
+		`{"delete":{"_index":"orders-tenant1","_id":"2","_routing":"user8"}}`,
+	}, "\n")
+
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+	output, err := proxyHandler.rewriteBulkBody(nil, []byte(body), "")
+	if err != nil {
+		t.Fatalf("rewrite bulk: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	if !strings.Contains(lines[0], `"routing":"user7"`) || !strings.Contains(lines[2], `"_routing":"user8"`) {
+		t.Fatalf("expected client routing to be kept, got %q", output)
+	}
+
+	cfg := config.Default()
+	cfg.SharedIndex.RouteByTenant = true
+	proxyHandler, _ = newProxyWithServer(t, cfg)
+	output, err = proxyHandler.rewriteBulkBody(nil, []byte(body), "")
+	if err != nil {
+		t.Fatalf("rewrite bulk: %v", err)
+	}
+	lines = strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	for _, i := range []int{0, 2} {
+		var action map[string]map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &action); err != nil {
+			t.Fatalf("decode action: %v", err)
+		}
+		for _, meta := range action {
+			if meta["routing"] != "tenant1" || meta["_routing"] != nil {
+				t.Fatalf("expected routing forced to tenant1, got %s", lines[i])
+			}
+		}
+	}
+}
+
+func TestRewriteBulkBodyPreservesMetadata(t *testing.T) {
+	body := strings.Join([]string{
+		`{"index":{"_id":"1","_index":"orders-tenant1","if_seq_no":9007199254740993,"if_primary_term":3,"require_alias":false,"dynamic_templates":{"f":"t"}}}`,
+		`{"field":"value"}`,
+		`{"delete":{"_index":"orders-tenant1","_id":"2","version":1700000000000000001,"version_type":"external_gte"}}`,
+		`{"update":{"_index":"orders-tenant1","_id":"3","retry_on_conflict":3,"_source":["a"]}}`,
+		`{"doc":{"field":"value"}}`,
+	}, "\n")
+	want := []string{
+		`{"index":{"_id":"1","_index":"orders","if_seq_no":9007199254740993,"if_primary_term":3,"require_alias":false,"dynamic_templates":{"f":"t"}}}`,
+		`{"delete":{"_index":"orders","_id":"2","version":1700000000000000001,"version_type":"external_gte"}}`,
+		`{"update":{"_index":"orders","_id":"3","retry_on_conflict":3,"_source":["a"]}}`,
+	}
+
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+	output, err := proxyHandler.rewriteBulkBody(nil, []byte(body), "")
+	if err != nil {
+		t.Fatalf("rewrite bulk: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("unexpected rewritten body: %q", output)
+	}
+	for i, line := range []string{lines[0], lines[2], lines[3]} {
+		if line != want[i] {
+			t.Fatalf("expected action line %s, got %s", want[i], line)
+		}
+	}
+
+	for _, invalid := range []string{`{"index":[]}`, `["index"]`, `{"index":{},"delete":{}}`} {
+		if _, err := proxyHandler.rewriteBulkBody(nil, []byte(invalid), "orders-tenant1"); err == nil {
+			t.Fatalf("expected error for action line %s", invalid)
+		}
+	}
+}
+
+func TestBulkIndexNameErrors(t *testing.T) {
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+
+	meta := fastjson.MustParse(`{"_index":42}`).GetObject()
+	_, err := proxyHandler.bulkIndexName(meta, "")
+	if err == nil || !strings.Contains(err.Error(), "bulk _index must be a string") {
+		t.Fatalf("expected bulk _index error, got %v", err)
+	}
+
+	_, err = proxyHandler.bulkIndexName(fastjson.MustParse(`{}`).GetObject(), "")
+	if err == nil || !strings.Contains(err.Error(), "bulk request missing index") {
+		t.Fatalf("expected missing index error, got %v", err)
+	}
+}
+
+func TestRewriteQueryBodyInvalidJSON(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	_, err := proxyHandler.rewriteQueryBody([]byte("{"), "orders")
+	if err == nil || !strings.Contains(err.Error(), "invalid JSON body") {
+		t.Fatalf("expected invalid JSON error, got %v", err)
+	}
+}
+
+func TestRewriteQueryBodySortWithSearchAfter(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	body := []byte(`{"query":{"match_all":{}},"sort":[` +
+		`{"created_at":"desc"},` +
+		`{"_geo_distance":{"location":[-70,40],"order":"asc","unit":"km"}},` +
+		`{"_shard_doc":"asc"},"_doc"],` +
+		`"search_after":[1700000000000,12.5,"shard-7",42]}`)
+	wantSort := `[{"orders.created_at":"desc"},{"_geo_distance":{"orders.location":[-70,40],"order":"asc","unit":"km"}},{"_shard_doc":"asc"},"_doc"]`
+
+	for _, rewriter := range []string{"stdlib", "fastjson"} {
+		t.Run(rewriter, func(t *testing.T) {
+			cfg.Rewriter = rewriter
+			proxyHandler, _ := newProxyWithServer(t, cfg)
+			rewritten, err := proxyHandler.rewriteQueryBody(body, "orders")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var payload map[string]json.RawMessage
+			if err := json.Unmarshal(rewritten, &payload); err != nil {
+				t.Fatalf("parse rewritten body: %v", err)
+			}
+			var gotSort, want interface{}
+			_ = json.Unmarshal(payload["sort"], &gotSort)
+			_ = json.Unmarshal([]byte(wantSort), &want)
+			if !reflect.DeepEqual(gotSort, want) {
+				t.Fatalf("expected sort %s, got %s", wantSort, payload["sort"])
+			}
+			if string(payload["search_after"]) != `[1700000000000,12.5,"shard-7",42]` {
+				t.Fatalf("expected search_after passed through, got %s", payload["search_after"])
+			}
+
+			rewritten, err = proxyHandler.rewriteQueryBody([]byte(`{"sort":{"created_at":"desc"},"search_after":[1]}`), "orders")
+			if err != nil || !strings.Contains(string(rewritten), `"sort":{"orders.created_at":"desc"}`) {
+				t.Fatalf("expected a single sort object prefixed, got %s, %v", rewritten, err)
+			}
+		})
+	}
+}
+
+func TestCheckSearchAfter(t *testing.T) {
+	cases := map[string]string{
+		`{"sort":["a","b"],"search_after":[1,"x"]}`:        "",
+		`{"sort":"a","search_after":[1]}`:                  "",
+		`{"search_after":[1]}`:                             "",
+		`{"query":{"match_all":{}}}`:                       "",
+		`{"sort":["a","b"],"search_after":[1]}`:            "search_after has 1 values but sort has 2 fields",
+		`{"sort":["a"],"search_after":"1"}`:                "search_after must be an array of sort values",
+		`{"sort":["a"],"search_after":[{"a":1}]}`:          "search_after values must be strings, numbers, booleans, or null",
+		`{"sort":[{"a":"asc"},"_doc"],"search_after":[1]}`: "search_after has 1 values but sort has 2 fields",
+	}
+	for body, wantErr := range cases {
+		err := checkSearchAfter([]byte(body))
+		if wantErr == "" && err != nil {
+			t.Fatalf("%s: unexpected error %v", body, err)
+		}
+		if wantErr != "" && (err == nil || err.Error() != wantErr) {
+			t.Fatalf("%s: expected %q, got %v", body, wantErr, err)
+		}
+	}
+}
+
+func TestRewriteQueryBodyComplex(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	body := []byte(`{
+		"query": {
+			"bool": {
+				"must": [
+					{"match": {"field1": "value"}},
+					{"range": {"created_at": {"gte": "now-1d"}}}
+				],
+				"filter": {"term": {"status": "open"}}
+			}
+		},
+		"fields": ["field1", "field2"],
+		"_source": {
+			"includes": ["field1", "nested.field2"],
+			"excludes": ["field3"]
+		},
+		"sort": ["field1", {"field2": {"order": "desc"}}]
+	}`)
+
+	rewritten, err := proxyHandler.rewriteQueryBody(body, "orders")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(rewritten, &payload); err != nil {
+		t.Fatalf("parse rewritten body: %v", err)
+	}
+	query := payload["query"].(map[string]interface{})
+	boolQuery := query["bool"].(map[string]interface{})
+	must := boolQuery["must"].([]interface{})
+	firstMatch := must[0].(map[string]interface{})["match"].(map[string]interface{})
+	if firstMatch["orders.field1"] == nil {
+		t.Fatalf("expected orders.field1 in match query, got %v", firstMatch)
+	}
+	secondRange := must[1].(map[string]interface{})["range"].(map[string]interface{})
+	if secondRange["orders.created_at"] == nil {
+		t.Fatalf("expected orders.created_at in range query, got %v", secondRange)
+	}
+	filter := boolQuery["filter"].(map[string]interface{})["term"].(map[string]interface{})
+	if filter["orders.status"] == nil {
+		t.Fatalf("expected orders.status in filter query, got %v", filter)
+	}
+	fields := payload["fields"].([]interface{})
+	if fields[0].(string) != "orders.field1" || fields[1].(string) != "orders.field2" {
+		t.Fatalf("expected prefixed fields, got %v", fields)
+	}
+	source := payload["_source"].(map[string]interface{})
+	includes := source["includes"].([]interface{})
+	excludes := source["excludes"].([]interface{})
+	if includes[0].(string) != "orders.field1" || includes[1].(string) != "orders.nested.field2" {
+		t.Fatalf("expected prefixed includes, got %v", includes)
+	}
+	if excludes[0].(string) != "orders.field3" {
+		t.Fatalf("expected prefixed excludes, got %v", excludes)
+	}
+	sort := payload["sort"].([]interface{})
+	if sort[0].(string) != "orders.field1" {
+		t.Fatalf("expected prefixed sort field, got %v", sort[0])
+	}
+	sortObj := sort[1].(map[string]interface{})
+	if sortObj["orders.field2"] == nil {
+		t.Fatalf("expected prefixed sort object, got %v", sortObj)
+	}
+}
+
+func TestRewriteQueryBodySuggest(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"suggest":{
+		"text":"tset",
+		"spelling":{"term":{"field":"title","suggest_mode":"popular"}},
+		"phrases":{"phrase":{"field":"title.trigram","direct_generator":[{"field":"title.trigram","suggest_mode":"always"}],"collate":{"query":{"source":{"match":{"title":"{{suggestion}}"}}}}}},
+		"names":{"prefix":"jo","completion":{"field":"name_suggest","contexts":{"place":["cafe"]}}}
+	}}`)
+	for _, rewriter := range []string{"fastjson", "stdlib"} {
+		t.Run(rewriter, func(t *testing.T) {
+			proxyHandler.cfg.Rewriter = rewriter
+			rewritten, err := proxyHandler.rewriteQueryBody(body, "orders")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var payload struct {
+				Suggest struct {
+					Text     string `json:"text"`
+					Spelling struct {
+						Term map[string]interface{} `json:"term"`
+					} `json:"spelling"`
+					Phrases struct {
+						Phrase struct {
+							Field           string                   `json:"field"`
+							DirectGenerator []map[string]interface{} `json:"direct_generator"`
+							Collate         struct {
+								Query struct {
+									Source struct {
+										Match map[string]interface{} `json:"match"`
+									} `json:"source"`
+								} `json:"query"`
+							} `json:"collate"`
+						} `json:"phrase"`
+					} `json:"phrases"`
+					Names struct {
+						Prefix     string `json:"prefix"`
+						Completion struct {
+							Field    string                 `json:"field"`
+							Contexts map[string]interface{} `json:"contexts"`
+						} `json:"completion"`
+					} `json:"names"`
+				} `json:"suggest"`
+			}
+			if err := json.Unmarshal(rewritten, &payload); err != nil {
+				t.Fatalf("parse rewritten body: %v", err)
+			}
+			suggest := payload.Suggest
+			if suggest.Text != "tset" || suggest.Names.Prefix != "jo" {
+				t.Fatalf("expected suggestion text kept, got %s", rewritten)
+			}
+			if suggest.Spelling.Term["field"] != "orders.title" || suggest.Spelling.Term["suggest_mode"] != "popular" {
+				t.Fatalf("expected prefixed term suggester, got %v", suggest.Spelling.Term)
+			}
+			phrase := suggest.Phrases.Phrase
+			if phrase.Field != "orders.title.trigram" || phrase.DirectGenerator[0]["field"] != "orders.title.trigram" {
+				t.Fatalf("expected prefixed phrase suggester, got %s", rewritten)
+			}
+			if _, ok := phrase.Collate.Query.Source.Match["orders.title"]; !ok {
+				t.Fatalf("expected prefixed collate query, got %s", rewritten)
+			}
+			if suggest.Names.Completion.Field != "orders.name_suggest" || suggest.Names.Completion.Contexts["place"] == nil {
+				t.Fatalf("expected prefixed completion suggester with contexts kept, got %s", rewritten)
+			}
+		})
+	}
+}
+
+func TestRewriteQueryBodyPercolate(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"query":{"bool":{"filter":[{"term":{"owner":"ops"}}],"must":{"percolate":{"field":"query","documents":[{"title":"outage"},{"title":"latency"}],"name":"batch"}}}}}`)
+	want := `{"query":{"bool":{"filter":[{"term":{"alerts.owner":"ops"}}],"must":{"percolate":{"documents":[{"alerts":{"title":"outage"}},{"alerts":{"title":"latency"}}],"field":"alerts.query","name":"batch"}}}}}`
+	for _, rewriter := range []string{"fastjson", "stdlib"} {
+		t.Run(rewriter, func(t *testing.T) {
+			proxyHandler.cfg.Rewriter = rewriter
+			rewritten, err := proxyHandler.rewriteQueryBody(body, "alerts")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var payload interface{}
+			if err := json.Unmarshal(rewritten, &payload); err != nil {
+				t.Fatalf("parse rewritten body: %v", err)
+			}
+			normalized, _ := json.Marshal(payload)
+			if string(normalized) != want {
+				t.Fatalf("unexpected query:\n%s\nwant:\n%s", normalized, want)
+			}
+		})
+	}
+}
+
+func TestRewriteQueryBodyNestedAndSkipFields(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.SkipFields = []string{"@timestamp", "orders_meta.*"}
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	body := []byte(`{
+		"query":{"bool":{"must":[
+			{"nested":{"path":"lines","query":{"term":{"lines.sku":"a1"}},"inner_hits":{"_source":["lines.sku"]}}},
+			{"term":{"_id":"1"}},
+			{"range":{"@timestamp":{"gte":"now-1d"}}},
+			{"term":{"orders_meta.source":"web"}}
+		]}},
+		"sort":["_score",{"_doc":"asc"},{"lines.price":{"order":"asc","nested":{"path":"lines"}}}],
+		"aggs":{"lines":{"nested":{"path":"lines"},"aggs":{"back":{"reverse_nested":{}}}}}
+	}`)
+	want := `{"aggs":{"lines":{"aggs":{"back":{"reverse_nested":{}}},"nested":{"path":"orders.lines"}}},` +
+		`"query":{"bool":{"must":[{"nested":{"inner_hits":{"_source":["orders.lines.sku"]},"path":"orders.lines","query":{"term":{"orders.lines.sku":"a1"}}}},` +
+		`{"term":{"_id":"1"}},{"range":{"@timestamp":{"gte":"now-1d"}}},{"term":{"orders_meta.source":"web"}}]}},` +
+		`"sort":["_score",{"_doc":"asc"},{"orders.lines.price":{"nested":{"path":"orders.lines"},"order":"asc"}}]}`
+	for _, rewriter := range []string{"fastjson", "stdlib"} {
+		t.Run(rewriter, func(t *testing.T) {
+			proxyHandler.cfg.Rewriter = rewriter
+			rewritten, err := proxyHandler.rewriteQueryBody(body, "orders")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var payload interface{}
+			if err := json.Unmarshal(rewritten, &payload); err != nil {
+				t.Fatalf("parse rewritten body: %v", err)
+			}
+			normalized, _ := json.Marshal(payload)
+			if string(normalized) != want {
+				t.Fatalf("unexpected query:\n%s\nwant:\n%s", normalized, want)
+			}
+		})
+	}
+}
+
+func TestRewriteQueryBodyRuntimeAndFieldSections(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	body := []byte(`{
+		"runtime_mappings":{
+			"day":{"type":"keyword","script":{"source":"emit(doc['created'].value.dayOfWeekEnum.toString())"}},
+			"total":{"type":"double","script":"emit(params._source.price * doc['qty'].value)"},
+			"customer":{"type":"lookup","target_index":"customers","input_field":"customer_id","target_field":"id","fetch_fields":["name"]}
+		},
+		"query":{"term":{"day":"MONDAY"}},
+		"docvalue_fields":["qty",{"field":"created","format":"epoch_millis"}],
+		"fields":[{"field":"total"},"day"],
+		"stored_fields":["title","_none_"]
+	}`)
+	want := `{"docvalue_fields":["orders.qty",{"field":"orders.created","format":"epoch_millis"}],"fields":[{"field":"orders.total"},"orders.day"],` +
+		`"query":{"term":{"orders.day":"MONDAY"}},"runtime_mappings":{` +
+		`"orders.customer":{"fetch_fields":["name"],"input_field":"orders.customer_id","target_field":"id","target_index":"customers","type":"lookup"},` +
+		`"orders.day":{"script":{"source":"emit(doc['orders.created'].value.dayOfWeekEnum.toString())"},"type":"keyword"},` +
+		`"orders.total":{"script":"emit(params._source.orders.price * doc['orders.qty'].value)","type":"double"}},` +
+		`"stored_fields":["orders.title","_none_"]}`
+	for _, rewriter := range []string{"fastjson", "stdlib"} {
+		t.Run(rewriter, func(t *testing.T) {
+			proxyHandler.cfg.Rewriter = rewriter
+			rewritten, err := proxyHandler.rewriteQueryBody(body, "orders")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var payload interface{}
+			if err := json.Unmarshal(rewritten, &payload); err != nil {
+				t.Fatalf("parse rewritten body: %v", err)
+			}
+			normalized, _ := json.Marshal(payload)
+			if string(normalized) != want {
+				t.Fatalf("unexpected query:\n%s\nwant:\n%s", normalized, want)
+			}
+		})
+	}
+}
+
+func TestPercolateIndexReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		index   string
+		status  int
+		want    string
+		message string
+	}{
+		{name: "same tenant", mode: "index-per-tenant", index: "alerts-tenant1", status: http.StatusOK, want: "tenant1-alerts"},
+		{name: "other tenant", mode: "index-per-tenant", index: "alerts-tenant2", status: http.StatusBadRequest, message: "must match the searched index"},
+		{name: "other index", mode: "index-per-tenant", index: "events-tenant1", status: http.StatusBadRequest, message: "must match the searched index"},
+		{name: "shared mode", mode: "shared", index: "alerts-tenant1", status: http.StatusBadRequest, message: "not supported in shared mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Mode = tt.mode
+			cfg.IndexPerTenant.IndexTemplate = "{{.tenant}}-{{.index}}"
+			proxyHandler, capture := newProxyWithServer(t, cfg)
+
+			body := `{"query":{"percolate":{"field":"query","index":"` + tt.index + `","id":"1"}}}`
+			req := httptest.NewRequest(http.MethodPost, "/alerts-tenant1/_search", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			_, _, upstreamBody, _, count := capture.snapshot()
+			if tt.message != "" {
+				if !strings.Contains(rec.Body.String(), tt.message) {
+					t.Fatalf("expected %q in response, got %s", tt.message, rec.Body.String())
+				}
+				if count != 0 {
+					t.Fatalf("expected no upstream call, got %d", count)
+				}
+				return
+			}
+			var payload struct {
+				Query struct {
+					Percolate map[string]interface{} `json:"percolate"`
+				} `json:"query"`
+			}
+			if err := json.Unmarshal([]byte(upstreamBody), &payload); err != nil {
+				t.Fatalf("parse upstream body: %v", err)
+			}
+			percolate := payload.Query.Percolate
+			if percolate["index"] != tt.want || percolate["id"] != "1" || percolate["field"] != "alerts.query" {
+				t.Fatalf("unexpected percolate query: %s", upstreamBody)
+			}
+		})
+	}
+}
+
+func TestRewriteMappingBodyCompletionContexts(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	body := []byte(`{"mappings":{"properties":{"category":{"type":"keyword"},"name":{"type":"text","fields":{"suggest":{"type":"completion","contexts":[{"name":"place","type":"category","path":"category"},{"name":"location","type":"geo","precision":4}]}}}}}}`)
+	rewritten, err := proxyHandler.rewriteMappingBody(body, "orders")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"mappings":{"properties":{"orders":{"properties":{"category":{"type":"keyword"},"name":{"fields":{"suggest":{"contexts":[{"name":"place","path":"orders.category","type":"category"},{"name":"location","precision":4,"type":"geo"}],"type":"completion"}},"type":"text"}}}}}}`
+	if string(rewritten) != want {
+		t.Fatalf("unexpected mapping:\n%s\nwant:\n%s", rewritten, want)
+	}
+}
+
+func TestRewriteMappingBodyErrors(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	_, err := proxyHandler.rewriteMappingBody([]byte(`{"mappings":"bad"}`), "orders")
+	if err == nil || !strings.Contains(err.Error(), "mappings must be an object") {
+		t.Fatalf("expected mappings object error, got %v", err)
+	}
+
+	_, err = proxyHandler.rewriteMappingBody([]byte(`{"mappings":{"properties":"bad"}}`), "orders")
+	if err == nil || !strings.Contains(err.Error(), "mappings.properties must be an object") {
+		t.Fatalf("expected mappings.properties error, got %v", err)
+	}
+
+	_, err = proxyHandler.rewriteMappingBody([]byte(`{"properties":"bad"}`), "orders")
+	if err == nil || !strings.Contains(err.Error(), "properties must be an object") {
+		t.Fatalf("expected properties object error, got %v", err)
+	}
+}
+
+func TestRewriteMultiSearchBodyMultipleIndices(t *testing.T) {
+	body := strings.Join([]string{
+		`{"index":["orders-tenant1","users-tenant1"]}`,
+		`{"query":{"match_all":{}}}`,
+		`{"index":"orders-tenant1,remote1:users-tenant1"}`,
+		`{"query":{"match_all":{}}}`,
+	}, "\n") + "\n"
+
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+	output, err := proxyHandler.rewriteMultiSearchBody(nil, []byte(body), "")
+	if err != nil {
+		t.Fatalf("rewrite msearch: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	if lines[0] != `{"index":["alias-orders-tenant1","alias-users-tenant1"]}` {
+		t.Fatalf("unexpected list header: %s", lines[0])
+	}
+	if lines[2] != `{"index":"alias-orders-tenant1,remote1:alias-users-tenant1"}` {
+		t.Fatalf("unexpected comma-separated header: %s", lines[2])
+	}
+
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	proxyHandler, _ = newProxyWithServer(t, cfg)
+	output, err = proxyHandler.rewriteMultiSearchBody(nil, []byte(`{"index":"logs-tenant1-a,logs-tenant1-a"}`+"\n"+`{"query":{"term":{"level":"error"}}}`+"\n"), "")
+	if err != nil {
+		t.Fatalf("rewrite msearch: %v", err)
+	}
+	if !strings.Contains(string(output), `"logs-a.level"`) {
+		t.Fatalf("expected body fields prefixed with the shared base index, got %s", output)
+	}
+	_, err = proxyHandler.rewriteMultiSearchBody(nil, []byte(`{"index":["logs-tenant1-a","logs-tenant1-b"]}`+"\n"+`{}`+"\n"), "")
+	if err == nil || !strings.Contains(err.Error(), "must share a base index") {
+		t.Fatalf("expected base index error, got %v", err)
+	}
+}
+
+func TestRewriteMultiSearchBodyErrors(t *testing.T) {
+	proxyHandler, _ := newProxyWithServer(t, config.Default())
+
+	cases := []struct {
+		name      string
+		body      string
+		pathIndex string
+		wantErr   string
+	}{
+		{
+			name:    "invalid header json",
+			body:    "{bad}\n",
+			wantErr: "invalid msearch header",
+		},
+		{
+			name:    "index not string",
+			body:    `{"index":1}` + "\n" + `{"query":{"match_all":{}}}` + "\n",
+			wantErr: "msearch index must be a string",
+		},
+		{
+			name:    "index list with non-string",
+			body:    `{"index":["orders-tenant1",1]}` + "\n" + `{"query":{"match_all":{}}}` + "\n",
+			wantErr: "msearch index list values must be strings",
+		},
+		{
+			name:    "index list with multiple tenants",
+			body:    `{"index":"orders-tenant1,orders-tenant2"}` + "\n" + `{"query":{"match_all":{}}}` + "\n",
+			wantErr: "msearch header contains multiple tenants",
+		},
+		{
+			name:    "empty index in list",
+			body:    `{"index":"orders-tenant1,"}` + "\n" + `{"query":{"match_all":{}}}` + "\n",
+			wantErr: "msearch index names must not be empty",
+		},
+		{
+			name:    "missing index",
+			body:    "{}\n" + `{"query":{"match_all":{}}}` + "\n",
+			wantErr: "msearch request missing index",
+		},
+		{
+			name:    "empty body line",
+			body:    `{"index":"orders-tenant1"}` + "\n\n",
+			wantErr: "msearch body line empty",
+		},
+		{
+			name:    "missing body",
+			body:    `{"index":"orders-tenant1"}`,
+			wantErr: "msearch payload missing body",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxyHandler.rewriteMultiSearchBody(nil, []byte(tc.body), tc.pathIndex)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected %q error, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSearchSortParamAndSearchAfter(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search?sort=created_at:desc,_doc", strings.NewReader(`{"search_after":[1700000000000,3]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	_, query, body, _, _ := capture.snapshot()
+	if query != "sort=orders.created_at%3Adesc%2C_doc" {
+		t.Fatalf("expected the sort parameter prefixed, got %q", query)
+	}
+	if !strings.Contains(string(body), `"search_after":[1700000000000,3]`) {
+		t.Fatalf("expected search_after passed through, got %s", body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search", strings.NewReader(`{"sort":["created_at","_doc"],"search_after":[1700000000000]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "search_after has 1 values but sort has 2 fields") {
+		t.Fatalf("expected a search_after mismatch to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+
+	"es-tmnt/pkg/config"
+)
+
+// handleRoot answers GET and HEAD /, which clients call on startup to check the
+// product header and version of the cluster. The upstream answers unless
+// root_info.synthesize is set, in which case the proxy describes itself with
+// the configured cluster name and version.
+func (p *Proxy) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		p.setResponseMode(w, responseModeHandled)
+		p.rejectMethod(w, "unsupported path", http.MethodGet, http.MethodHead)
+		return
+	}
+	if !p.cfg.RootInfo.Synthesize {
+		p.setResponseMode(w, responseModePassthrough)
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	p.setResponseMode(w, responseModeHandled)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	writeJSON(w, http.StatusOK, rootInfoResponse(p.cfg.RootInfo))
+}
+
+func rootInfoResponse(info config.RootInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"name":         "es-tmnt",
+		"cluster_name": info.ClusterName,
+		"cluster_uuid": "_na_",
+		"version": map[string]interface{}{
+			"number":       info.Version,
+			"build_flavor": "default",
+		},
+		"tagline": "You Know, for Search",
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestRootPassthrough(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(method, "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", method, rec.Code, rec.Body.String())
+		}
+		path, _, _, upstreamMethod, _ := capture.snapshot()
+		if path != "/" || upstreamMethod != method {
+			t.Fatalf("%s: expected root forwarded, got %s %q", method, upstreamMethod, path)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Fatalf("expected 405 for POST /, got %d %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func TestRootSynthesized(t *testing.T) {
+	cfg := config.Default()
+	cfg.RootInfo = config.RootInfo{Synthesize: true, ClusterName: "search-prod", Version: "8.15.0"}
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Elastic-Product") != "Elasticsearch" {
+		t.Fatalf("expected product header, got %v", rec.Header())
+	}
+	var info struct {
+		ClusterName string `json:"cluster_name"`
+		Version     struct {
+			Number      string `json:"number"`
+			BuildFlavor string `json:"build_flavor"`
+		} `json:"version"`
+		Tagline string `json:"tagline"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if info.ClusterName != "search-prod" || info.Version.Number != "8.15.0" || info.Version.BuildFlavor != "default" || info.Tagline != "You Know, for Search" {
+		t.Fatalf("unexpected root info: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("expected empty 200 for HEAD, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream requests, got %d", count)
+	}
+}
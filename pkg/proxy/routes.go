@@ -0,0 +1,451 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// routeHandler serves a request matched by a route.
+type routeHandler func(w http.ResponseWriter, r *http.Request, match routeMatch)
+
+// routeMatch holds the request's path segments and the values of the route
+// pattern's placeholders.
+type routeMatch struct {
+	segments []string
+	params   map[string]string
+}
+
+func (m routeMatch) param(name string) string {
+	return m.params[name]
+}
+
+// route serves requests whose method is one of methods, or any method when
+// methods is empty, and whose path matches pattern.
+type route struct {
+	methods []string
+	pattern []string
+	mode    string
+	handler routeHandler
+}
+
+// router is a named family of routes, such as the search or document APIs.
+// The first route matching a request serves it.
+//
+// Patterns are slash-separated segments: a literal segment matches itself,
+// {name} matches any one segment, and a trailing {name...} matches the
+// remaining segments, including none.
+type router struct {
+	name   string
+	routes []route
+}
+
+func newRouter(name string) *router {
+	return &router{name: name}
+}
+
+// handle adds a route. methods is a comma-separated list such as "GET,HEAD",
+// or empty for any method.
+func (rt *router) handle(methods, pattern, mode string, handler routeHandler) {
+	var methodList []string
+	for _, method := range strings.Split(methods, ",") {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			methodList = append(methodList, method)
+		}
+	}
+	rt.routes = append(rt.routes, route{methods: methodList, pattern: splitPath(pattern), mode: mode, handler: handler})
+}
+
+func (rt *router) match(method string, segments []string) (*route, routeMatch, bool) {
+	for i := range rt.routes {
+		candidate := &rt.routes[i]
+		if !candidate.allows(method) {
+			continue
+		}
+		if params, ok := matchRoutePattern(candidate.pattern, segments); ok {
+			return candidate, routeMatch{segments: segments, params: params}, true
+		}
+	}
+	return nil, routeMatch{}, false
+}
+
+// allowedMethods lists the methods of the routes whose pattern matches the
+// segments, for answering requests with another method.
+func (rt *router) allowedMethods(segments []string) []string {
+	var methods []string
+	for i := range rt.routes {
+		if _, ok := matchRoutePattern(rt.routes[i].pattern, segments); ok {
+			methods = append(methods, rt.routes[i].methods...)
+		}
+	}
+	return methods
+}
+
+func (r *route) allows(method string) bool {
+	if len(r.methods) == 0 {
+		return true
+	}
+	for _, allowed := range r.methods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRoutePattern(pattern, segments []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for i, part := range pattern {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "...}") {
+			params[strings.TrimSuffix(part[1:], "...}")] = strings.Join(segments[min(i, len(segments)):], "/")
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params[part[1:len(part)-1]] = segments[i]
+			continue
+		}
+		if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, len(pattern) == len(segments)
+}
+
+// HandleFunc registers a custom endpoint that is matched ahead of the built-in
+// routes. methods is a comma-separated list of methods, or empty for any
+// method, and pattern uses the route syntax, for example
+// "{index}/_my_endpoint/{id}". Custom endpoints run after authentication,
+// the write freeze, body limits, and route timeouts, like the built-in ones,
+// and read their placeholders with RouteParam. HandleFunc must be called
+// before the proxy serves requests.
+func (p *Proxy) HandleFunc(methods, pattern string, handler http.HandlerFunc) {
+	p.customRoutes.handle(methods, pattern, responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		handler(w, r)
+	})
+}
+
+// RouteParam returns the path segment the {name} placeholder of the route
+// serving r matched.
+func RouteParam(r *http.Request, name string) string {
+	state := requestStateFrom(r)
+	if state == nil {
+		return ""
+	}
+	return state.params[name]
+}
+
+// Forward sends the request to the upstream cluster unchanged.
+func (p *Proxy) Forward(w http.ResponseWriter, r *http.Request) {
+	p.proxy.ServeHTTP(w, r)
+}
+
+// route dispatches the request to the first matching custom route, then to the
+// built-in API families. Paths starting with an underscore are system
+// endpoints; all other paths start with an index.
+func (p *Proxy) route(w http.ResponseWriter, r *http.Request, segments []string) {
+	system := strings.HasPrefix(segments[0], "_")
+	routers := append([]*router{p.customRoutes}, p.indexRoutes...)
+	if system {
+		routers = append([]*router{p.customRoutes}, p.systemRoutes...)
+	}
+	for _, rt := range routers {
+		matched, match, ok := rt.match(r.Method, segments)
+		if !ok {
+			continue
+		}
+		p.logRequestVerbose(r, "route family=%s", rt.name)
+		p.setResponseMode(w, matched.mode)
+		if state := requestStateFrom(r); state != nil {
+			state.params = match.params
+		}
+		matched.handler(w, r, match)
+		return
+	}
+	if system && p.isSystemPassthrough(r.URL.Path) {
+		p.forwardUnrouted(w, r, segments)
+		return
+	}
+	message := "unsupported endpoint"
+	if system {
+		message = "unsupported system endpoint"
+	}
+	var allowed []string
+	for _, rt := range routers {
+		allowed = append(allowed, rt.allowedMethods(segments)...)
+	}
+	if len(allowed) > 0 {
+		p.setResponseMode(w, responseModeHandled)
+		slices.Sort(allowed)
+		p.rejectMethod(w, message, slices.Compact(allowed)...)
+		return
+	}
+	switch p.cfg.UnknownPaths.Action {
+	case "passthrough":
+		p.forwardUnrouted(w, r, segments)
+	case "not_found":
+		p.setResponseMode(w, responseModeHandled)
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		p.setResponseMode(w, responseModeHandled)
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, message)
+	}
+}
+
+// forwardUnrouted sends a request no route matched upstream unchanged, unless
+// a path segment names a denied shared index or the request uses an API key.
+func (p *Proxy) forwardUnrouted(w http.ResponseWriter, r *http.Request, segments []string) {
+	if p.rejectUnscopedAPIKey(w, r) {
+		return
+	}
+	for _, segment := range segments {
+		if _, denied := p.deniedIndex(segment); denied {
+			p.setResponseMode(w, responseModeHandled)
+			p.rejectError(w, errSharedIndexAccess)
+			return
+		}
+	}
+	p.setResponseMode(w, responseModePassthrough)
+	p.proxy.ServeHTTP(w, r)
+}
+
+// rejectRoute answers a matched path the proxy does not support.
+func (p *Proxy) rejectRoute(status int, message string) routeHandler {
+	return func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.rejectStatus(w, status, codeUnsupportedEndpoint, message)
+	}
+}
+
+// forwardRoute sends matched requests upstream unchanged.
+func (p *Proxy) forwardRoute(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+	p.proxy.ServeHTTP(w, r)
+}
+
+// newSystemRoutes returns the families of endpoints at the root of the path.
+// System paths no route matches are passed through when they are known
+// cluster-level APIs and rejected otherwise.
+func (p *Proxy) newSystemRoutes() []*router {
+	const unsupported = "unsupported system endpoint"
+
+	search := newRouter("search")
+	search.handle("", "_search", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleSearch(w, r, "")
+	})
+	search.handle("", "_search/template", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleSearchTemplate(w, r, "")
+	})
+	search.handle("", "_search/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "_msearch", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleMultiSearch(w, r, "")
+	})
+	search.handle("", "_msearch/template", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleMultiSearchTemplate(w, r)
+	})
+	search.handle("", "_msearch/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "_render/template", responseModeHandled, p.handleRenderTemplate)
+	search.handle("", "_render/template/{id}", responseModeHandled, p.handleRenderTemplate)
+	search.handle("", "_render/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "_validate/query", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleValidateQuery(w, r, "")
+	})
+	search.handle("", "_validate/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "_query", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleESQLQuery(w, r)
+	})
+	search.handle("", "_query/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "_rank_eval", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleQueryEndpoint(w, r, "")
+	})
+	search.handle("", "_rank_eval/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "_explain", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleExplain(w, r, "")
+	})
+	search.handle("", "_explain/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "_eql/search/{id}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+		p.handleEQLAsync(w, r, match.param("id"))
+	})
+	search.handle(http.MethodGet, "_eql/search/status/{id}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+		p.handleEQLAsync(w, r, match.param("id"))
+	})
+	search.handle("", "_eql/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "_sql", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleSQL(w, r)
+	})
+	search.handle("", "_sql/translate", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleSQL(w, r)
+	})
+	search.handle("", "_sql/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+
+	document := newRouter("document")
+	document.handle("", "_bulk/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleBulk(w, r, "")
+	})
+	document.handle("GET,POST", "_mget", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleRootMget(w, r)
+	})
+	document.handle("", "_mget/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	for _, endpoint := range []string{"_delete_by_query", "_update_by_query", "_reindex"} {
+		document.handle(http.MethodPost, endpoint+"/{task}/_rethrottle", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+			p.handleRethrottle(w, r, match.param("task"))
+		})
+	}
+	document.handle("", "_delete_by_query/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleRootQueryByIndex(w, r, "_delete_by_query")
+	})
+	document.handle("", "_update_by_query/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleRootQueryByIndex(w, r, "_update_by_query")
+	})
+	document.handle("", "_reindex", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleReindex(w, r)
+	})
+	document.handle("", "_reindex/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+
+	indices := newRouter("indices")
+	indices.handle("", "_analyze/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleAnalyze(w, r, "")
+	})
+	indices.handle("POST,PUT", "_aliases", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleAliasActions(w, r)
+	})
+
+	ingest := newRouter("ingest")
+	ingest.handle("", "_ingest/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+		p.handleIngestPipeline(w, r, match.segments)
+	})
+
+	lifecycle := newRouter("lifecycle")
+	if p.cfg.Lifecycle.NamespacePolicies {
+		for _, prefix := range []string{"_ilm", "_slm"} {
+			lifecycle.handle("", prefix+"/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+				p.handleLifecyclePolicy(w, r, match.segments)
+			})
+		}
+	}
+
+	scripts := newRouter("scripts")
+	if p.scriptTmpl != nil {
+		scripts.handle("", "_scripts/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+			p.handleStoredScript(w, r, match.segments)
+		})
+	}
+
+	tasks := newRouter("tasks")
+	if p.cfg.Tasks.ScopeTasks {
+		tasks.handle(http.MethodGet, "_tasks/{id}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+			p.handleTask(w, r, match.param("id"))
+		})
+		tasks.handle(http.MethodPost, "_tasks/{id}/_cancel", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+			p.handleTask(w, r, match.param("id"))
+		})
+		tasks.handle("", "_tasks/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+			p.reject(w, codeUnsupportedFeature, "only tasks started by the tenant can be retrieved or cancelled by id")
+		})
+	}
+
+	cat := newRouter("cat")
+	for _, pattern := range []string{"_cat/indices", "_cat/aliases", "_cat/aliases/{name}", "_cat/shards", "_cat/shards/{name}", "_cat/count/{name}"} {
+		cat.handle("", pattern, responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+			if p.cfg.Cat.TenantScoped && p.catTenant(r) == "" {
+				p.reject(w, codeTenantRequired, "tenant is required for _cat requests")
+				return
+			}
+			if match.segments[1] == catCount {
+				p.handleCatCount(w, r)
+				return
+			}
+			p.proxy.ServeHTTP(w, r)
+		})
+	}
+
+	jobs := newRouter("jobs")
+	jobs.handle("", "_transform/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleTransform(w, r)
+	})
+	jobs.handle("", "_rollup/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, _ routeMatch) {
+		p.handleRollup(w, r)
+	})
+
+	return []*router{search, document, indices, ingest, lifecycle, scripts, tasks, cat, jobs}
+}
+
+// newIndexRoutes returns the families of endpoints below an index.
+func (p *Proxy) newIndexRoutes() []*router {
+	const unsupported = "unsupported endpoint"
+	withIndex := func(handler func(w http.ResponseWriter, r *http.Request, index string)) routeHandler {
+		return func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+			handler(w, r, match.param("index"))
+		}
+	}
+	// withDocID serves both the path without a document id and the paths
+	// whose third segment is one.
+	withDocID := func(rt *router, methods, endpoint string, handler func(w http.ResponseWriter, r *http.Request, index, docID string)) {
+		serve := func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+			handler(w, r, match.param("index"), match.param("id"))
+		}
+		rt.handle(methods, "{index}/"+endpoint, responseModeHandled, serve)
+		rt.handle(methods, "{index}/"+endpoint+"/{id}/{rest...}", responseModeHandled, serve)
+	}
+	// requireDocID rejects the path without a document id.
+	requireDocID := func(rt *router, endpoint string, handler func(w http.ResponseWriter, r *http.Request, index, docID string)) {
+		rt.handle("", "{index}/"+endpoint, responseModeHandled, p.rejectRoute(http.StatusNotFound, "missing document id"))
+		withDocID(rt, "", endpoint, handler)
+	}
+
+	search := newRouter("search")
+	search.handle("", "{index}/_search/template", responseModeHandled, withIndex(p.handleSearchTemplate))
+	search.handle("", "{index}/_search/template/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "{index}/_search/{rest...}", responseModeHandled, withIndex(p.handleSearch))
+	search.handle("", "{index}/_count/{rest...}", responseModeHandled, withIndex(p.handleCount))
+	search.handle("", "{index}/_query/{rest...}", responseModeHandled, withIndex(p.handleQueryEndpoint))
+	search.handle("", "{index}/_rank_eval/{rest...}", responseModeHandled, withIndex(p.handleQueryEndpoint))
+	search.handle("", "{index}/_explain/{rest...}", responseModeHandled, withIndex(p.handleExplain))
+	search.handle("", "{index}/_eql/search", responseModeHandled, withIndex(p.handleEQLSearch))
+	search.handle("", "{index}/_eql/{rest...}", responseModeHandled, p.rejectRoute(http.StatusNotFound, unsupported))
+	search.handle("", "{index}/_validate/query/{rest...}", responseModeHandled, withIndex(p.handleValidateQuery))
+	for _, endpoint := range []string{"_search_shards", "_terms_enum"} {
+		search.handle("", "{index}/"+endpoint+"/{rest...}", responseModeHandled, withIndex(p.handleIndexPassthrough))
+	}
+	search.handle("", "{index}/_field_caps/{rest...}", responseModeHandled, withIndex(p.handleFieldCaps))
+
+	document := newRouter("document")
+	withDocID(document, http.MethodGet, "_doc", p.handleDocGet)
+	withDocID(document, http.MethodHead, "_doc", p.handleDocHead)
+	document.handle("", "{index}/_doc/{rest...}", responseModeHandled, withIndex(p.handleDoc))
+	requireDocID(document, "_update", func(w http.ResponseWriter, r *http.Request, index, _ string) {
+		p.handleUpdate(w, r, index)
+	})
+	requireDocID(document, "_create", func(w http.ResponseWriter, r *http.Request, index, _ string) {
+		p.handleDoc(w, r, index)
+	})
+	requireDocID(document, "_get", p.handleGet)
+	requireDocID(document, "_delete", p.handleDelete)
+	withDocID(document, "", "_source", p.handleSource)
+	document.handle("", "{index}/_bulk/{rest...}", responseModeHandled, withIndex(p.handleBulk))
+	document.handle("", "{index}/_mget/{rest...}", responseModeHandled, withIndex(p.handleMget))
+	document.handle("", "{index}/_termvectors/{rest...}", responseModeHandled, withIndex(p.handleTermVectors))
+	document.handle("", "{index}/_mtermvectors/{rest...}", responseModeHandled, withIndex(p.handleMultiTermVectors))
+	for _, endpoint := range []string{"_delete_by_query", "_update_by_query"} {
+		endpoint := endpoint
+		document.handle("", "{index}/"+endpoint+"/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+			p.handleNamedQueryEndpoint(w, r, match.param("index"), endpoint)
+		})
+	}
+
+	indices := newRouter("indices")
+	indices.handle("", "{index}", responseModeHandled, withIndex(p.handleIndexRoot))
+	indices.handle("", "{index}/_mapping/{rest...}", responseModeHandled, withIndex(p.handleMapping))
+	indices.handle("", "{index}/_analyze/{rest...}", responseModeHandled, withIndex(p.handleAnalyze))
+	for _, endpoint := range []string{"_alias", "_aliases"} {
+		indices.handle("", "{index}/"+endpoint+"/{rest...}", responseModeHandled, func(w http.ResponseWriter, r *http.Request, match routeMatch) {
+			p.handleIndexAlias(w, r, match.param("index"), match.segments)
+		})
+	}
+	for _, endpoint := range []string{"_settings", "_stats", "_segments", "_recovery", "_refresh", "_flush", "_forcemerge",
+		"_open", "_close", "_shrink", "_split", "_rollover", "_clone", "_freeze", "_unfreeze", "_upgrade", "_cache/clear"} {
+		indices.handle("", "{index}/"+endpoint+"/{rest...}", responseModeHandled, withIndex(p.handleIndexPassthrough))
+	}
+
+	return []*router{search, document, indices}
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// handleStoredScript serves /_scripts/{id} and /_scripts/{id}/{context} when
+// script namespacing is enabled. Script ids follow the tenant regex like index
+// names and are rendered from the script template.
+func (p *Proxy) handleStoredScript(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 2:
+	case len(segments) == 3 && (r.Method == http.MethodPut || r.Method == http.MethodPost):
+	default:
+		p.rejectStatus(w, http.StatusNotFound, codeUnsupportedEndpoint, "unsupported scripts endpoint")
+		return
+	}
+	script, _, err := p.renderScriptID(r, segments[1], "")
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.setPathSegments(r, append([]string{segments[0], script}, segments[2:]...))
+	p.logRequestVerbose(r, "script rewrite: %s -> %s", segments[1], script)
+	p.proxy.ServeHTTP(w, r)
+}
+
+// renderScriptID resolves a script id with the tenant regex and renders the id
+// stored upstream. When tenantID is set the script must belong to that tenant.
+func (p *Proxy) renderScriptID(r *http.Request, id, tenantID string) (string, string, error) {
+	if strings.ContainsAny(id, "*?,") {
+		return "", "", fmt.Errorf("script id patterns are not supported: %s", id)
+	}
+	baseName, idTenant, err := p.parseIndex(r, id)
+	if err != nil {
+		return "", "", err
+	}
+	if tenantID != "" && idTenant != tenantID {
+		return "", "", withCode(codeTenantMismatch, fmt.Errorf("script %s belongs to a different tenant", id))
+	}
+	script, err := p.renderIndex(p.scriptTmpl, baseName, idTenant)
+	if err != nil {
+		return "", "", err
+	}
+	return script, idTenant, nil
+}
+
+// rewriteSearchTemplateID namespaces the stored template a search template
+// request runs by id, which must belong to the tenant searched.
+func (p *Proxy) rewriteSearchTemplateID(r *http.Request, tenantID string) error {
+	if p.scriptTmpl == nil || r.Body == nil {
+		return nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return withCode(codeBodyReadFailed, fmt.Errorf("failed to read body"))
+	}
+	if body, err = p.namespaceTemplateID(r, body, tenantID); err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return nil
+}
+
+// rewriteSearchTemplateBody rewrites one search template request of an
+// _msearch/template body as handleSearchTemplate does a whole body.
+func (p *Proxy) rewriteSearchTemplateBody(r *http.Request, body []byte, baseIndex, tenantID string) ([]byte, error) {
+	body, err := p.namespaceTemplateID(r, body, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return p.rewriteTenantQueryBody(r, body, baseIndex, tenantID)
+}
+
+// namespaceTemplateID renders the id of a search template request when
+// scripts are namespaced.
+func (p *Proxy) namespaceTemplateID(r *http.Request, body []byte, tenantID string) ([]byte, error) {
+	if p.scriptTmpl == nil || !bytes.Contains(body, []byte(`"id"`)) {
+		return body, nil
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, invalidJSONError(err)
+	}
+	id, ok := payload["id"].(string)
+	if !ok {
+		return body, nil
+	}
+	script, _, err := p.renderScriptID(r, id, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	payload["id"] = script
+	p.logRequestVerbose(r, "search template rewrite: %s -> %s", id, script)
+	return json.Marshal(payload)
+}
+
+// handleRenderTemplate serves _render/template and _render/template/{id}. With
+// an index parameter the template is rendered for the index's tenant: stored
+// template ids are namespaced and, in index-per-tenant mode, the rendered query
+// is rewritten like a search body. Without one the request is passed through,
+// rejecting stored templates when scripts are namespaced since the request
+// names no tenant.
+func (p *Proxy) handleRenderTemplate(w http.ResponseWriter, r *http.Request, match routeMatch) {
+	if index := takeIndexParam(r); index != "" {
+		p.renderTenantTemplate(w, r, match.segments, index)
+		return
+	}
+	if p.scriptTmpl != nil && len(match.segments) == 3 {
+		p.reject(w, codeTenantRequired, "rendering a stored template requires the index parameter")
+		return
+	}
+	if p.scriptTmpl != nil && r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			p.reject(w, codeBodyReadFailed, "failed to read body")
+			return
+		}
+		if storedTemplateUsed(body) {
+			p.reject(w, codeTenantRequired, "rendering a stored template requires the index parameter")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) renderTenantTemplate(w http.ResponseWriter, r *http.Request, segments []string, index string) {
+	baseIndex, tenantID, err := p.parseIndex(r, index)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	if p.scriptTmpl != nil {
+		if len(segments) == 3 {
+			script, _, err := p.renderScriptID(r, segments[2], tenantID)
+			if err != nil {
+				p.rejectError(w, err)
+				return
+			}
+			p.setPathSegments(r, []string{segments[0], segments[1], script})
+			p.logRequestVerbose(r, "render template rewrite: %s -> %s", segments[2], script)
+		}
+		if err := p.rewriteSearchTemplateID(r, tenantID); err != nil {
+			p.rejectError(w, err)
+			return
+		}
+	}
+	p.setResponseMode(w, responseModeHandled)
+	if p.wrapSource() {
+		p.setResponseKind(r, responseKindRenderTemplate, baseIndex, tenantID)
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// rewriteRenderedTemplate rewrites the query a template rendered to as the
+// proxy rewrites search bodies, so the output shows the query the upstream
+// would run for the tenant.
+func (p *Proxy) rewriteRenderedTemplate(payload map[string]interface{}, baseIndex string) bool {
+	output, ok := payload["template_output"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	payload["template_output"] = p.rewriteQueryValue(output, baseIndex)
+	return true
+}
+
+// storedTemplateUsed reports whether a render template body runs a stored
+// template by id.
+func storedTemplateUsed(body []byte) bool {
+	if !bytes.Contains(body, []byte(`"id"`)) {
+		return false
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return false
+	}
+	_, ok := payload["id"].(string)
+	return ok
+}
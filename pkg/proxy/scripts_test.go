@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func newScriptsTestConfig() config.Config {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.Scripts.NamespaceScripts = true
+	return cfg
+}
+
+func TestStoredScriptNamespaced(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantPath string
+	}{
+		{name: "store", method: http.MethodPut, path: "/_scripts/search-tenant1", body: `{"script":{"lang":"mustache","source":{"query":{"match_all":{}}}}}`, wantPath: "/_scripts/tenant1-search"},
+		{name: "store with context", method: http.MethodPost, path: "/_scripts/score-tenant1/score", body: `{"script":{"lang":"painless","source":"1"}}`, wantPath: "/_scripts/tenant1-score/score"},
+		{name: "retrieve", method: http.MethodGet, path: "/_scripts/search-tenant1", wantPath: "/_scripts/tenant1-search"},
+		{name: "delete", method: http.MethodDelete, path: "/_scripts/search-tenant1", wantPath: "/_scripts/tenant1-search"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, newScriptsTestConfig())
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if path, _, _, method, _ := capture.snapshot(); path != tt.wantPath || method != tt.method {
+				t.Fatalf("expected %s %s, got %s %s", tt.method, tt.wantPath, method, path)
+			}
+		})
+	}
+}
+
+func TestStoredScriptRejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "id without tenant", method: http.MethodGet, path: "/_scripts/search", wantStatus: http.StatusBadRequest},
+		{name: "id pattern", method: http.MethodGet, path: "/_scripts/search-*", wantStatus: http.StatusBadRequest},
+		{name: "context on retrieve", method: http.MethodGet, path: "/_scripts/search-tenant1/score", wantStatus: http.StatusNotFound},
+		{name: "no id", method: http.MethodGet, path: "/_scripts", wantStatus: http.StatusNotFound},
+		{name: "other tenant template", method: http.MethodPost, path: "/products-tenant1/_search/template", body: `{"id":"search-tenant2"}`, wantStatus: http.StatusBadRequest},
+		{name: "upstream template name", method: http.MethodPost, path: "/products-tenant1/_search/template", body: `{"id":"tenant2-search"}`, wantStatus: http.StatusBadRequest},
+		{name: "msearch template other tenant", method: http.MethodPost, path: "/_msearch/template", body: "{\"index\":\"products-tenant1\"}\n{\"id\":\"search-tenant2\"}\n", wantStatus: http.StatusBadRequest},
+		{name: "render stored template", method: http.MethodPost, path: "/_render/template", body: `{"id":"search-tenant2","params":{}}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, newScriptsTestConfig())
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if _, _, _, _, count := capture.snapshot(); count != 0 {
+				t.Fatalf("expected request to stay off the upstream")
+			}
+		})
+	}
+}
+
+func TestSearchTemplateIDNamespaced(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, newScriptsTestConfig())
+	rec := httptest.NewRecorder()
+	body := `{"id":"search-tenant1","params":{"q":"shoes"}}`
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/products-tenant1/_search/template", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, _, _ := capture.snapshot()
+	if path != "/alias-products-tenant1/_search/template" || !strings.Contains(string(captured), `"id":"tenant1-search"`) {
+		t.Fatalf("expected the namespaced template, got %s %s", path, captured)
+	}
+}
+
+func TestMultiSearchTemplateIDNamespaced(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, newScriptsTestConfig())
+	rec := httptest.NewRecorder()
+	body := "{\"index\":\"products-tenant1\"}\n{\"id\":\"search-tenant1\",\"params\":{\"q\":\"shoes\"}}\n{}\n{\"source\":{\"query\":{\"match_all\":{}}}}\n"
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_msearch/template?index=orders-tenant1", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	_, _, captured, _, _ := capture.snapshot()
+	lines := strings.Split(strings.TrimSpace(string(captured)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %q", captured)
+	}
+	if !strings.Contains(lines[0], `"alias-products-tenant1"`) || !strings.Contains(lines[1], `"id":"tenant1-search"`) {
+		t.Fatalf("expected the first search namespaced, got %s / %s", lines[0], lines[1])
+	}
+	if !strings.Contains(lines[2], `"alias-orders-tenant1"`) {
+		t.Fatalf("expected the second search scoped to the index parameter, got %s", lines[2])
+	}
+}
+
+func TestScriptsPassthroughWithoutNamespacing(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, config.Default())
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/products-tenant1/_search/template", strings.NewReader(`{"id":"search"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, _, captured, _, _ := capture.snapshot(); !strings.Contains(string(captured), `"id":"search"`) {
+		t.Fatalf("expected the template id unchanged, got %s", captured)
+	}
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_scripts/search", nil))
+	if path, _, _, _, _ := capture.snapshot(); rec.Code != http.StatusOK || path != "/_scripts/search" {
+		t.Fatalf("expected passthrough, got %d %s", rec.Code, path)
+	}
+}
+
+func TestRenderTemplateForTenant(t *testing.T) {
+	var gotPath, gotQuery, gotBody string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotQuery, gotBody = r.URL.Path, r.URL.RawQuery, string(body)
+		jsonUpstream(http.StatusOK, `{"template_output":{"query":{"match":{"title":"shoes"}},"size":10}}`).ServeHTTP(w, r)
+	})
+	cfg := newScriptsTestConfig()
+	cfg.Mode = "index-per-tenant"
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantPath string
+		wantBody string
+	}{
+		{name: "id in path", path: "/_render/template/search-tenant1?index=products-tenant1", body: `{"params":{"q":"shoes"}}`, wantPath: "/_render/template/tenant1-search", wantBody: `{"params":{"q":"shoes"}}`},
+		{name: "id in body", path: "/_render/template?index=products-tenant1", body: `{"id":"search-tenant1","params":{"q":"shoes"}}`, wantPath: "/_render/template", wantBody: `"id":"tenant1-search"`},
+		{name: "inline source", path: "/_render/template?index=products-tenant1", body: `{"source":{"query":{"match":{"title":"{{q}}"}}},"params":{"q":"shoes"}}`, wantPath: "/_render/template", wantBody: `"source"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if gotPath != tt.wantPath || gotQuery != "" || !strings.Contains(gotBody, tt.wantBody) {
+				t.Fatalf("unexpected upstream request %s?%s %s", gotPath, gotQuery, gotBody)
+			}
+			if !strings.Contains(rec.Body.String(), `"match":{"products.title":"shoes"}`) {
+				t.Fatalf("expected the rendered query to be rewritten, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRenderTemplateRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantCode rejectCode
+	}{
+		{name: "stored id without index", path: "/_render/template/search-tenant1", body: `{}`, wantCode: codeTenantRequired},
+		{name: "other tenant template", path: "/_render/template/search-tenant2?index=products-tenant1", body: `{}`, wantCode: codeTenantMismatch},
+		{name: "other tenant template in body", path: "/_render/template?index=products-tenant1", body: `{"id":"search-tenant2"}`, wantCode: codeTenantMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, newScriptsTestConfig())
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), string(tt.wantCode)) {
+				t.Fatalf("expected %s, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if _, _, _, _, count := capture.snapshot(); count != 0 {
+				t.Fatalf("expected request to stay off the upstream")
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// selfTestProbe is a synthetic request that must not reach another tenant's
+// data. Probes run against a copy of the proxy whose upstream is replaced by
+// a recorder, so they never reach the cluster.
+type selfTestProbe struct {
+	name   string
+	method string
+	path   string
+	body   string
+	ndjson bool
+	// forbidden, when set, is the only upstream name the probe must not
+	// reach. Otherwise every name outside the probing tenant's is a leak.
+	forbidden string
+}
+
+// selfTestResult reports whether a probe was blocked: either rejected by the
+// proxy or forwarded only to the probing tenant's indices.
+type selfTestResult struct {
+	Name    string `json:"name"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Status  int    `json:"status"`
+	Blocked bool   `json:"blocked"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// selfTestTransport records the requests the proxy sends upstream and answers
+// them with an empty JSON object.
+type selfTestTransport struct {
+	mu       sync.Mutex
+	requests []capturedSelfTestRequest
+}
+
+type capturedSelfTestRequest struct {
+	path string
+	body []byte
+}
+
+func (t *selfTestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.mu.Lock()
+	t.requests = append(t.requests, capturedSelfTestRequest{path: req.URL.Path, body: body})
+	t.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}, productHeader: []string{productName}},
+		Body:       io.NopCloser(strings.NewReader(`{}`)),
+		Request:    req,
+	}, nil
+}
+
+// handleSelfTest runs the cross-tenant isolation probes on POST
+// /admin/selftest?index=<tenant index>&other=<index of another tenant> and
+// reports which of them the proxy blocks. It answers 200 when every probe is
+// blocked and 409 otherwise.
+func (p *Proxy) handleSelfTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for selftest")
+		return
+	}
+	if _, ok := p.resolver.(regexTenantResolver); p.resolver != nil && !ok {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "selftest requires the regex tenant resolver")
+		return
+	}
+	index := strings.TrimSpace(r.URL.Query().Get("index"))
+	other := strings.TrimSpace(r.URL.Query().Get("other"))
+	if index == "" || other == "" {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "index and other query parameters are required")
+		return
+	}
+	baseIndex, tenantID, err := p.matchTenantRegex(index)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	_, otherTenant, err := p.matchTenantRegex(other)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	if otherTenant == tenantID {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "index and other must belong to different tenants")
+		return
+	}
+	allowed, err := p.selfTestAllowedNames(baseIndex, tenantID)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	probes := selfTestProbes(index, other)
+	if isSharedMode(p.cfg.Mode) {
+		sharedIndex, err := p.renderSharedIndex(baseIndex, tenantID)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		probes = append(probes, selfTestProbe{name: "direct shared index access", method: http.MethodPost, path: "/" + sharedIndex + "/_search", body: `{}`, forbidden: sharedIndex})
+	}
+	results := make([]selfTestResult, 0, len(probes))
+	passed := true
+	for _, probe := range probes {
+		result := p.runSelfTestProbe(r, probe, allowed)
+		passed = passed && result.Blocked
+		results = append(results, result)
+	}
+	status := http.StatusOK
+	if !passed {
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, map[string]interface{}{"passed": passed, "probes": results})
+}
+
+func selfTestProbes(index, other string) []selfTestProbe {
+	return []selfTestProbe{
+		{name: "root search without index", method: http.MethodPost, path: "/_search", body: `{"query":{"match_all":{}}}`},
+		{name: "wildcard search", method: http.MethodPost, path: "/*/_search", body: `{}`},
+		{name: "_all search", method: http.MethodPost, path: "/_all/_search", body: `{}`},
+		{name: "search across tenants", method: http.MethodPost, path: "/" + index + "," + other + "/_search", body: `{}`},
+		{name: "encoded index list", method: http.MethodPost, path: "/" + index + "%2C" + other + "/_search", body: `{}`},
+		{name: "dot segment escape", method: http.MethodPost, path: "/" + index + "/../" + other + "/_search", body: `{}`},
+		{name: "msearch with mixed tenants", method: http.MethodPost, path: "/_msearch", body: "{\"index\":[\"" + index + "\",\"" + other + "\"]}\n{}\n", ndjson: true},
+		{name: "msearch without index", method: http.MethodPost, path: "/_msearch", body: "{}\n{}\n", ndjson: true},
+		{name: "mget with mixed tenants", method: http.MethodPost, path: "/_mget", body: `{"docs":[{"_index":"` + index + `","_id":"1"},{"_index":"` + other + `","_id":"1"}]}`},
+		{name: "bulk with mixed tenants", method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"" + index + "\"}}\n{}\n{\"index\":{\"_index\":\"" + other + "\"}}\n{}\n", ndjson: true},
+		{name: "alias pointing at another tenant", method: http.MethodPut, path: "/" + index + "/_alias/" + other, body: `{}`},
+	}
+}
+
+// selfTestAllowedNames lists the upstream names a probe by a tenant may reach:
+// its own write and search targets of baseIndex.
+func (p *Proxy) selfTestAllowedNames(baseIndex, tenantID string) ([]string, error) {
+	var names []string
+	for _, render := range []func(string, string) (string, error){p.renderTargetIndex, p.renderQueryIndex} {
+		name, err := render(baseIndex, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (p *Proxy) runSelfTestProbe(r *http.Request, probe selfTestProbe, allowed []string) selfTestResult {
+	transport := &selfTestTransport{}
+	clone := p.selfTestProxy(transport)
+	req := httptest.NewRequest(probe.method, probe.path, strings.NewReader(probe.body))
+	req.Header.Set("Content-Type", "application/json")
+	if probe.ndjson {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rec := httptest.NewRecorder()
+	clone.ServeHTTP(rec, req)
+	result := selfTestResult{Name: probe.name, Method: probe.method, Path: probe.path, Status: rec.Code, Blocked: true, Detail: "rejected"}
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	for _, upstream := range transport.requests {
+		for _, name := range selfTestUpstreamNames(upstream) {
+			leak := !containsString(allowed, name)
+			if probe.forbidden != "" {
+				leak = name == probe.forbidden
+			}
+			if leak {
+				result.Blocked = false
+				result.Detail = fmt.Sprintf("forwarded to %s", name)
+				return result
+			}
+		}
+		result.Detail = "forwarded to the tenant's own indices"
+	}
+	return result
+}
+
+// selfTestUpstreamNames returns the index names an upstream request targets:
+// the index list of its path and the index and _index values of its JSON or
+// NDJSON body.
+func selfTestUpstreamNames(upstream capturedSelfTestRequest) []string {
+	var names []string
+	segments := splitPath(upstream.path)
+	if len(segments) > 0 && (segments[0] == "_all" || !strings.HasPrefix(segments[0], "_")) {
+		names = append(names, strings.Split(segments[0], ",")...)
+	}
+	for _, line := range bytes.Split(upstream.body, []byte("\n")) {
+		var value interface{}
+		if json.Unmarshal(line, &value) == nil {
+			names = appendSelfTestBodyNames(names, value)
+		}
+	}
+	return names
+}
+
+func appendSelfTestBodyNames(names []string, value interface{}) []string {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			if key != "index" && key != "_index" {
+				names = appendSelfTestBodyNames(names, item)
+				continue
+			}
+			switch index := item.(type) {
+			case string:
+				names = append(names, strings.Split(index, ",")...)
+			case []interface{}:
+				for _, entry := range index {
+					if name, ok := entry.(string); ok {
+						names = append(names, name)
+					}
+				}
+			default:
+				names = appendSelfTestBodyNames(names, item)
+			}
+		}
+	case []interface{}:
+		for _, item := range typed {
+			names = appendSelfTestBodyNames(names, item)
+		}
+	}
+	return names
+}
+
+// selfTestProxy returns a copy of p that sends upstream requests to transport
+// and records no audit events, usage, slow queries, cached responses, or shadow
+// traffic. It does not create missing tenant indices either, which would reach
+// the cluster.
+func (p *Proxy) selfTestProxy(transport http.RoundTripper) *Proxy {
+	clone := *p
+	clone.creator = nil
+	clone.audit = nil
+	clone.usage = nil
+	clone.slowLog = nil
+	clone.cache = nil
+	clone.modeOverrides = nil
+	clone.migration = nil
+	clone.shadow = nil
+	clone.systemRoutes = clone.newSystemRoutes()
+	clone.indexRoutes = clone.newIndexRoutes()
+	clone.proxy = clone.newReverseProxy(p.upstream.base)
+	clone.proxy.Transport = transport
+	return &clone
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestSelfTestBlocksCrossTenantProbes(t *testing.T) {
+	shared := config.Default()
+	shared.SharedIndex.Name = "shared-index"
+	perTenant := config.Default()
+	perTenant.Mode = "index-per-tenant"
+	perTenant.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+
+	for name, cfg := range map[string]config.Config{"shared": shared, "index per tenant": perTenant} {
+		t.Run(name, func(t *testing.T) {
+			proxy, capture := newProxyWithServer(t, cfg)
+			rec := httptest.NewRecorder()
+			proxy.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/selftest?index=orders-tenant1&other=orders-tenant2", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+			var payload struct {
+				Passed bool             `json:"passed"`
+				Probes []selfTestResult `json:"probes"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+				t.Fatalf("parse response: %v", err)
+			}
+			if !payload.Passed || len(payload.Probes) == 0 {
+				t.Fatalf("expected all probes blocked, got %+v", payload)
+			}
+			for _, probe := range payload.Probes {
+				if !probe.Blocked {
+					t.Fatalf("expected probe %q blocked, got %+v", probe.Name, probe)
+				}
+			}
+			if _, _, _, _, count := capture.snapshot(); count != 0 {
+				t.Fatalf("expected probes to stay off the upstream, got %d requests", count)
+			}
+		})
+	}
+}
+
+func TestSelfTestUpstreamNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream capturedSelfTestRequest
+		want     []string
+	}{
+		{name: "path list", upstream: capturedSelfTestRequest{path: "/orders-tenant1,orders/_search"}, want: []string{"orders-tenant1", "orders"}},
+		{name: "all", upstream: capturedSelfTestRequest{path: "/_all/_search"}, want: []string{"_all"}},
+		{name: "msearch", upstream: capturedSelfTestRequest{path: "/_msearch", body: []byte("{\"index\":[\"orders-tenant1\",\"orders-tenant2\"]}\n{}\n")}, want: []string{"orders-tenant1", "orders-tenant2"}},
+		{name: "bulk", upstream: capturedSelfTestRequest{path: "/_bulk", body: []byte("{\"index\":{\"_index\":\"orders-tenant2\"}}\n{}\n")}, want: []string{"orders-tenant2"}},
+		{name: "mget", upstream: capturedSelfTestRequest{path: "/_mget", body: []byte(`{"docs":[{"_index":"orders-tenant2","_id":"1"}]}`)}, want: []string{"orders-tenant2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selfTestUpstreamNames(tt.upstream); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSelfTestRejectsSameTenant(t *testing.T) {
+	proxy, _ := newProxyWithServer(t, config.Default())
+	rec := httptest.NewRecorder()
+	proxy.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/selftest?index=orders-tenant1&other=products-tenant1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
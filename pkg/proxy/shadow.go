@@ -0,0 +1,282 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+const (
+	// shadowMaxBodyBytes bounds the request bodies kept to replay on the
+	// shadow upstream; requests with larger bodies are skipped.
+	shadowMaxBodyBytes = 10 << 20
+	// shadowMaxInFlight bounds the shadow requests awaiting an answer so a slow
+	// shadow cluster cannot pile up goroutines; further copies are skipped.
+	shadowMaxInFlight = 64
+	shadowTimeout     = 30 * time.Second
+	shadowRecentDiffs = 100
+)
+
+// shadowDiff records a shadow request whose status differed from the
+// upstream's, or that failed.
+type shadowDiff struct {
+	Timestamp         time.Time `json:"@timestamp"`
+	RequestID         string    `json:"request_id,omitempty"`
+	Method            string    `json:"method"`
+	Path              string    `json:"path"`
+	UpstreamStatus    int       `json:"upstream_status"`
+	ShadowStatus      int       `json:"shadow_status,omitempty"`
+	Error             string    `json:"error,omitempty"`
+	UpstreamLatencyMs int64     `json:"upstream_latency_ms"`
+	ShadowLatencyMs   int64     `json:"shadow_latency_ms"`
+}
+
+// shadowStats are the counters reported on GET /admin/shadow.
+type shadowStats struct {
+	Mirrored             int64   `json:"mirrored"`
+	Skipped              int64   `json:"skipped"`
+	Failed               int64   `json:"failed"`
+	StatusMismatches     int64   `json:"status_mismatches"`
+	AvgUpstreamLatencyMs float64 `json:"avg_upstream_latency_ms"`
+	AvgShadowLatencyMs   float64 `json:"avg_shadow_latency_ms"`
+}
+
+// shadowTraffic copies a share of the rewritten requests to a second cluster
+// and compares its answers with the upstream's. It is safe for concurrent use.
+type shadowTraffic struct {
+	base     *url.URL
+	percent  int
+	client   *http.Client
+	inFlight chan struct{}
+
+	mu            sync.Mutex
+	stats         shadowStats
+	upstreamNanos int64
+	shadowNanos   int64
+	diffs         []shadowDiff
+	next          int
+}
+
+// newShadowTraffic returns nil when no shadow upstream is configured.
+func newShadowTraffic(cfg config.Shadow) (*shadowTraffic, error) {
+	if cfg.UpstreamURL == "" || cfg.Percent <= 0 {
+		return nil, nil
+	}
+	base, err := url.Parse(cfg.UpstreamURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse shadow upstream url: %w", err)
+	}
+	return &shadowTraffic{
+		base:     base,
+		percent:  cfg.Percent,
+		client:   &http.Client{Timeout: shadowTimeout},
+		inFlight: make(chan struct{}, shadowMaxInFlight),
+	}, nil
+}
+
+// shadowCopy keeps the body of an upstream request while the transport sends
+// it, so the request can be replayed once the upstream has answered.
+type shadowCopy struct {
+	start time.Time
+	body  *shadowBody
+}
+
+type shadowBody struct {
+	io.ReadCloser
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	eof      bool
+	overflow bool
+}
+
+func (b *shadowBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > 0 && !b.overflow {
+		if b.buf.Len()+n > shadowMaxBodyBytes {
+			b.overflow = true
+			b.buf.Reset()
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// bytes returns the body read so far and whether it is the whole body of a
+// request declaring contentLength bytes.
+func (b *shadowBody) bytes(contentLength int64) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.overflow {
+		return nil, false
+	}
+	complete := b.eof || (contentLength >= 0 && int64(b.buf.Len()) == contentLength)
+	return bytes.Clone(b.buf.Bytes()), complete
+}
+
+// shadowRequest samples an upstream request for the shadow cluster, keeping
+// its body as it is sent.
+func (p *Proxy) shadowRequest(outbound *http.Request) {
+	if p.shadow == nil || rand.Intn(100) >= p.shadow.percent {
+		return
+	}
+	state := requestStateFrom(outbound)
+	if state == nil {
+		return
+	}
+	shadow := &shadowCopy{start: time.Now()}
+	if outbound.Body != nil && outbound.Body != http.NoBody {
+		shadow.body = &shadowBody{ReadCloser: outbound.Body}
+		outbound.Body = shadow.body
+	}
+	state.shadow = shadow
+}
+
+// sendShadow replays the upstream request of resp on the shadow cluster in the
+// background and records how the answers differ.
+func (p *Proxy) sendShadow(resp *http.Response, shadow *shadowCopy) {
+	s := p.shadow
+	upstreamLatency := time.Since(shadow.start)
+	var body []byte
+	if shadow.body != nil {
+		var complete bool
+		body, complete = shadow.body.bytes(resp.Request.ContentLength)
+		if !complete {
+			s.record(func(stats *shadowStats) { stats.Skipped++ })
+			return
+		}
+	}
+	select {
+	case s.inFlight <- struct{}{}:
+	default:
+		s.record(func(stats *shadowStats) { stats.Skipped++ })
+		return
+	}
+	target := *resp.Request.URL
+	target.Scheme = s.base.Scheme
+	target.Host = s.base.Host
+	header := resp.Request.Header.Clone()
+	diff := shadowDiff{
+		RequestID:         requestIDFrom(resp.Request),
+		Method:            resp.Request.Method,
+		Path:              target.Path,
+		UpstreamStatus:    resp.StatusCode,
+		UpstreamLatencyMs: upstreamLatency.Milliseconds(),
+	}
+	go func() {
+		defer func() { <-s.inFlight }()
+		s.replay(target.String(), header, body, upstreamLatency, diff)
+	}()
+}
+
+func (s *shadowTraffic) replay(target string, header http.Header, body []byte, upstreamLatency time.Duration, diff shadowDiff) {
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, diff.Method, target, bytes.NewReader(body))
+	if err != nil {
+		s.record(func(stats *shadowStats) { stats.Failed++ })
+		return
+	}
+	req.Header = header
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	latency := time.Since(start)
+	diff.ShadowLatencyMs = latency.Milliseconds()
+	if err != nil {
+		diff.Error = err.Error()
+		s.record(func(stats *shadowStats) { stats.Failed++ })
+		s.addDiff(diff)
+		log.Printf("shadow: request failed: request_id=%s method=%s path=%s error=%q", diff.RequestID, diff.Method, diff.Path, diff.Error)
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	mismatch := resp.StatusCode != diff.UpstreamStatus
+	s.record(func(stats *shadowStats) {
+		stats.Mirrored++
+		if mismatch {
+			stats.StatusMismatches++
+		}
+		s.upstreamNanos += int64(upstreamLatency)
+		s.shadowNanos += int64(latency)
+	})
+	if !mismatch {
+		return
+	}
+	diff.ShadowStatus = resp.StatusCode
+	s.addDiff(diff)
+	log.Printf("shadow: status mismatch: request_id=%s method=%s path=%s upstream=%d shadow=%d",
+		diff.RequestID, diff.Method, diff.Path, diff.UpstreamStatus, diff.ShadowStatus)
+}
+
+func (s *shadowTraffic) record(update func(stats *shadowStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
+
+func (s *shadowTraffic) addDiff(diff shadowDiff) {
+	diff.Timestamp = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.diffs) < shadowRecentDiffs {
+		s.diffs = append(s.diffs, diff)
+		return
+	}
+	s.diffs[s.next] = diff
+	s.next = (s.next + 1) % len(s.diffs)
+}
+
+// recent returns the kept diffs, newest first.
+func (s *shadowTraffic) recent() []shadowDiff {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	diffs := make([]shadowDiff, 0, len(s.diffs))
+	for i := len(s.diffs) - 1; i >= 0; i-- {
+		diffs = append(diffs, s.diffs[(s.next+i)%len(s.diffs)])
+	}
+	return diffs
+}
+
+func (s *shadowTraffic) snapshot() shadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	if stats.Mirrored > 0 {
+		stats.AvgUpstreamLatencyMs = float64(s.upstreamNanos) / float64(stats.Mirrored) / float64(time.Millisecond)
+		stats.AvgShadowLatencyMs = float64(s.shadowNanos) / float64(stats.Mirrored) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+// handleShadow reports the shadow traffic counters and the most recent
+// requests whose shadow status differed or that failed, newest first.
+func (p *Proxy) handleShadow(w http.ResponseWriter, r *http.Request) {
+	if p.shadow == nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "shadow traffic is disabled")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method for shadow")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"shadow": p.shadow.snapshot(),
+		"diffs":  p.shadow.recent(),
+	})
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestShadowTraffic(t *testing.T) {
+	calls := make(chan capturedCall, 4)
+	shadowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls <- capturedCall{method: r.Method, path: r.URL.Path, body: body}
+		if strings.HasSuffix(r.URL.Path, "/_search") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	t.Cleanup(shadowServer.Close)
+
+	cfg := config.Default()
+	cfg.Shadow.UpstreamURL = shadowServer.URL
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/orders-tenant1/_doc/1", strings.NewReader(`{"name":"a"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	call := awaitShadowCall(t, calls)
+	path, _, body, _, _ := capture.snapshot()
+	if call.method != http.MethodPut || call.path != path {
+		t.Fatalf("expected shadow PUT %s, got %s %s", path, call.method, call.path)
+	}
+	if string(call.body) != string(body) || !strings.Contains(string(call.body), `"tenant_id":"tenant1"`) {
+		t.Fatalf("expected the rewritten body %s, got %s", body, call.body)
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders-tenant1/_search", strings.NewReader(`{"query":{"match_all":{}}}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("shadow failures must not reach the client, got %d", rec.Code)
+	}
+	awaitShadowCall(t, calls)
+
+	var payload struct {
+		Shadow shadowStats  `json:"shadow"`
+		Diffs  []shadowDiff `json:"diffs"`
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec = httptest.NewRecorder()
+		proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/shadow", nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("parse shadow stats %q: %v", rec.Body.String(), err)
+		}
+		if payload.Shadow.Mirrored == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if payload.Shadow.Mirrored != 2 || payload.Shadow.StatusMismatches != 1 {
+		t.Fatalf("unexpected shadow stats %+v", payload.Shadow)
+	}
+	if len(payload.Diffs) != 1 || payload.Diffs[0].UpstreamStatus != http.StatusOK || payload.Diffs[0].ShadowStatus != http.StatusInternalServerError {
+		t.Fatalf("unexpected shadow diffs %+v", payload.Diffs)
+	}
+}
+
+func TestShadowTrafficDisabled(t *testing.T) {
+	cfg := config.Default()
+	cfg.Shadow.UpstreamURL = "http://127.0.0.1:1"
+	cfg.Shadow.Percent = 0
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/shadow", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with shadowing disabled, got %d", rec.Code)
+	}
+}
+
+func awaitShadowCall(t *testing.T, calls <-chan capturedCall) capturedCall {
+	t.Helper()
+	select {
+	case call := <-calls:
+		return call
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the shadow request")
+		return capturedCall{}
+	}
+}
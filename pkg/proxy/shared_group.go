@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"es-tmnt/pkg/config"
+)
+
+// sharedGroup is a compiled shared_index group: the shared index, the tenant
+// alias, and the tenant field used for the base indices matching pattern.
+// indexPattern parses the base index back out of a shared index name.
+type sharedGroup struct {
+	pattern      string
+	index        *template.Template
+	indexPattern *regexp.Regexp
+	alias        *template.Template
+	aliasPattern *regexp.Regexp
+	tenantField  string
+}
+
+// newSharedGroups compiles the configured shared index groups. Groups without
+// an alias template or tenant field inherit the top-level ones.
+func newSharedGroups(cfg config.SharedIndex) ([]sharedGroup, error) {
+	groups := make([]sharedGroup, 0, len(cfg.Groups))
+	for i, group := range cfg.Groups {
+		aliasTemplate := group.AliasTemplate
+		if aliasTemplate == "" {
+			aliasTemplate = cfg.AliasTemplate
+		}
+		tenantField := group.TenantField
+		if tenantField == "" {
+			tenantField = cfg.TenantField
+		}
+		index, err := template.New("shared").Parse(group.Name)
+		if err != nil {
+			return nil, fmt.Errorf("parse shared index template of group %d: %w", i, err)
+		}
+		alias, err := template.New("alias").Parse(aliasTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("parse alias template of group %d: %w", i, err)
+		}
+		groups = append(groups, sharedGroup{
+			pattern:      group.Pattern,
+			index:        index,
+			indexPattern: indexTemplatePattern(group.Name),
+			alias:        alias,
+			aliasPattern: templatePattern(aliasTemplate),
+			tenantField:  tenantField,
+		})
+	}
+	return groups, nil
+}
+
+// checkAliasCollisions rejects alias templates of shared index groups that
+// render the alias of one tenant as the alias of another, such as
+// "{{.tenant}}-{{.index}}" next to "{{.index}}-{{.tenant}}". Each template is
+// rendered for a probe tenant and the alias parsed back with the others.
+func checkAliasCollisions(cfg config.SharedIndex) error {
+	templates := []string{cfg.AliasTemplate}
+	for _, group := range cfg.Groups {
+		if group.AliasTemplate != "" && !containsString(templates, group.AliasTemplate) {
+			templates = append(templates, group.AliasTemplate)
+		}
+	}
+	for _, text := range templates {
+		tmpl, err := template.New("alias").Parse(text)
+		if err != nil {
+			return fmt.Errorf("parse alias template: %w", err)
+		}
+		var builder strings.Builder
+		if err := tmpl.Execute(&builder, map[string]string{"index": "index", "tenant": "tenant"}); err != nil {
+			return fmt.Errorf("render alias template: %w", err)
+		}
+		for _, other := range templates {
+			pattern := templatePattern(other)
+			if other == text || pattern == nil {
+				continue
+			}
+			match := pattern.FindStringSubmatch(builder.String())
+			if match != nil && match[pattern.SubexpIndex("tenant")] != "tenant" {
+				return fmt.Errorf("alias templates %q and %q render the same aliases for different tenants", text, other)
+			}
+		}
+	}
+	return nil
+}
+
+// sharedGroupFor returns the first group whose pattern matches baseIndex, or
+// the top-level shared_index settings when none does.
+func (p *Proxy) sharedGroupFor(baseIndex string) sharedGroup {
+	for _, group := range p.sharedGroups {
+		if matched, _ := path.Match(group.pattern, baseIndex); matched {
+			return group
+		}
+	}
+	return p.defaultSharedGroup()
+}
+
+// sharedGroupForIndex returns the group the shared index named index belongs
+// to: the first group whose index template renders it from a base index the
+// group's pattern matches, or the top-level shared_index settings when none
+// does.
+func (p *Proxy) sharedGroupForIndex(index string) sharedGroup {
+	for _, group := range p.sharedGroups {
+		if group.indexPattern == nil {
+			continue
+		}
+		matches := group.indexPattern.FindStringSubmatch(index)
+		if matches == nil {
+			continue
+		}
+		if i := group.indexPattern.SubexpIndex("index"); i < 0 {
+			return group
+		} else if matched, _ := path.Match(group.pattern, matches[i]); matched {
+			return group
+		}
+	}
+	return p.defaultSharedGroup()
+}
+
+func (p *Proxy) defaultSharedGroup() sharedGroup {
+	return sharedGroup{
+		index:        p.sharedIndex,
+		alias:        p.aliasTmpl,
+		aliasPattern: p.aliasPattern,
+		tenantField:  p.cfg.SharedIndex.TenantField,
+	}
+}
+
+// tenantField returns the field that stores the tenant of baseIndex documents
+// in shared mode.
+func (p *Proxy) tenantField(baseIndex string) string {
+	return p.sharedGroupFor(baseIndex).tenantField
+}
+
+// commonTenantField returns the tenant field of baseIndices. A single term
+// cannot filter shared indices that store the tenant in different fields, so
+// those are rejected.
+func (p *Proxy) commonTenantField(baseIndices []string) (string, error) {
+	field := p.cfg.SharedIndex.TenantField
+	if !isSharedMode(p.cfg.Mode) {
+		return field, nil
+	}
+	for i, baseIndex := range baseIndices {
+		indexField := p.tenantField(baseIndex)
+		if i == 0 {
+			field = indexField
+			continue
+		}
+		if indexField != field {
+			return "", fmt.Errorf("indices %s and %s store the tenant in different fields", baseIndices[0], baseIndex)
+		}
+	}
+	return field, nil
+}
+
+func (p *Proxy) renderSharedIndex(baseIndex, tenantID string) (string, error) {
+	return p.renderIndex(p.sharedGroupFor(baseIndex).index, baseIndex, tenantID)
+}
+
+// indexTemplatePattern turns a shared index template such as
+// shared-{{.index}} into a regexp with an index group, or a literal match when
+// the template has no fields. Templates using any other action return nil.
+func indexTemplatePattern(text string) *regexp.Regexp {
+	var builder strings.Builder
+	builder.WriteString("^")
+	hasIndex := false
+	last := 0
+	for _, loc := range templateFieldPattern.FindAllStringSubmatchIndex(text, -1) {
+		literal := text[last:loc[0]]
+		if strings.Contains(literal, "{{") || text[loc[2]:loc[3]] != "index" {
+			return nil
+		}
+		builder.WriteString(regexp.QuoteMeta(literal))
+		if hasIndex {
+			builder.WriteString(".+")
+		} else {
+			builder.WriteString("(?P<index>.+)")
+			hasIndex = true
+		}
+		last = loc[1]
+	}
+	if strings.Contains(text[last:], "{{") {
+		return nil
+	}
+	builder.WriteString(regexp.QuoteMeta(text[last:]))
+	builder.WriteString("$")
+	pattern, err := regexp.Compile(builder.String())
+	if err != nil {
+		return nil
+	}
+	return pattern
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func sharedGroupConfig() config.Config {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-default"
+	cfg.SharedIndex.EnforceFilter = true
+	cfg.SharedIndex.Groups = []config.SharedGroup{
+		{Pattern: "logs-*", Name: "shared-logs", TenantField: "org"},
+		{Pattern: "orders", Name: "shared-{{.index}}", AliasTemplate: "orders-view-{{.tenant}}"},
+	}
+	return cfg
+}
+
+func TestSharedGroupRouting(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantPath string
+		wantBody string
+	}{
+		{name: "grouped write", method: http.MethodPut, path: "/logs-tenant1-app/_doc/1", body: `{"msg":"up"}`, wantPath: "/shared-logs/_doc/1", wantBody: `"org":"tenant1"`},
+		{name: "grouped search", method: http.MethodPost, path: "/logs-tenant1-app/_search", body: `{}`, wantPath: "/alias-logs-app-tenant1/_search", wantBody: `{"term":{"org":"tenant1"}}`},
+		{name: "group alias template", method: http.MethodPost, path: "/orders-tenant1/_search", body: `{}`, wantPath: "/orders-view-tenant1/_search", wantBody: `{"term":{"tenant_id":"tenant1"}}`},
+		{name: "group index template", method: http.MethodPut, path: "/orders-tenant1/_doc/1", body: `{"total":3}`, wantPath: "/shared-orders/_doc/1", wantBody: `"tenant_id":"tenant1"`},
+		{name: "ungrouped write", method: http.MethodPut, path: "/users-tenant1/_doc/1", body: `{"name":"a"}`, wantPath: "/shared-default/_doc/1", wantBody: `"tenant_id":"tenant1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, capture := newProxyWithServer(t, sharedGroupConfig())
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+			path, _, body, _, _ := capture.snapshot()
+			if path != tt.wantPath {
+				t.Fatalf("expected path %s, got %s", tt.wantPath, path)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Fatalf("expected %s in upstream body, got %s", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestSharedGroupTenantFieldConflicts(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, sharedGroupConfig())
+	body := `{"query":"SELECT * FROM \"logs-tenant1-app\" WHERE msg IN (SELECT msg FROM \"users-tenant1\")"}`
+	req := httptest.NewRequest(http.MethodPost, "/_sql", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "store the tenant in different fields") {
+		t.Fatalf("expected tenant field conflict, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+}
+
+func TestSharedGroupAliasTenant(t *testing.T) {
+	proxyHandler, _ := newProxyWithServer(t, sharedGroupConfig())
+	for alias, want := range map[string]string{
+		"orders-view-tenant2":    "tenant2",
+		"alias-logs-app-tenant3": "tenant3",
+	} {
+		if got, ok := proxyHandler.tenantIDForAlias(alias); !ok || got != want {
+			t.Fatalf("expected tenant %s for %s, got %q", want, alias, got)
+		}
+	}
+}
+
+func TestSharedGroupAliasCollisions(t *testing.T) {
+	cfg := sharedGroupConfig()
+	cfg.SharedIndex.Groups = append(cfg.SharedIndex.Groups, config.SharedGroup{Pattern: "metrics-*", Name: "shared-metrics", AliasTemplate: "alias-{{.tenant}}-{{.index}}"})
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "render the same aliases for different tenants") {
+		t.Fatalf("expected an alias template collision, got %v", err)
+	}
+	if _, err := New(sharedGroupConfig()); err != nil {
+		t.Fatalf("expected distinct alias templates to pass, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+const (
+	slowQuerySearch = "search"
+	slowQueryBulk   = "bulk"
+)
+
+// slowQuery describes an upstream search or bulk request that took longer than
+// its slow log threshold.
+type slowQuery struct {
+	Timestamp  time.Time `json:"@timestamp"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Kind       string    `json:"kind"`
+	Tenant     string    `json:"tenant"`
+	Index      string    `json:"index"`
+	Query      string    `json:"query,omitempty"`
+	QueryHash  string    `json:"query_hash,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Status     int       `json:"status"`
+
+	start time.Time
+	body  []byte
+}
+
+// slowLog logs slow upstream requests and keeps the most recent ones for the
+// admin endpoint. It is safe for concurrent use.
+type slowLog struct {
+	cfg config.SlowLog
+
+	mu      sync.Mutex
+	entries []slowQuery
+	next    int
+}
+
+// newSlowLog returns nil when no threshold is configured.
+func newSlowLog(cfg config.SlowLog) *slowLog {
+	if cfg.SearchThresholdMs <= 0 && cfg.BulkThresholdMs <= 0 {
+		return nil
+	}
+	return &slowLog{cfg: cfg}
+}
+
+func (l *slowLog) threshold(kind string) time.Duration {
+	switch kind {
+	case slowQuerySearch:
+		return time.Duration(l.cfg.SearchThresholdMs) * time.Millisecond
+	case slowQueryBulk:
+		return time.Duration(l.cfg.BulkThresholdMs) * time.Millisecond
+	}
+	return 0
+}
+
+// formatQuery fills in the logged form of the request body.
+func (l *slowLog) formatQuery(query *slowQuery) {
+	if len(query.body) == 0 {
+		return
+	}
+	switch strings.ToLower(strings.TrimSpace(l.cfg.Query)) {
+	case "none":
+	case "hash":
+		sum := sha256.Sum256(query.body)
+		query.QueryHash = hex.EncodeToString(sum[:])
+	case "full":
+		query.Query = string(query.body)
+	default:
+		body := query.body
+		if len(body) > l.cfg.MaxQueryBytes {
+			body = body[:l.cfg.MaxQueryBytes]
+		}
+		query.Query = string(body)
+	}
+}
+
+func (l *slowLog) add(query slowQuery) {
+	if l.cfg.Recent <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < l.cfg.Recent {
+		l.entries = append(l.entries, query)
+		return
+	}
+	l.entries[l.next] = query
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// recent returns the kept slow queries, newest first, optionally limited to a
+// single tenant.
+func (l *slowLog) recent(tenantID string) []slowQuery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	queries := make([]slowQuery, 0, len(l.entries))
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		query := l.entries[(l.next+i)%len(l.entries)]
+		if tenantID == "" || query.Tenant == tenantID {
+			queries = append(queries, query)
+		}
+	}
+	return queries
+}
+
+// setSlowQuery starts timing an upstream request for the slow log, logging the
+// rewritten query body recorded on the request state. It returns nil when the
+// slow log is disabled for kind.
+func (p *Proxy) setSlowQuery(r *http.Request, kind, tenantID, index string) *slowQuery {
+	if p.slowLog == nil || p.slowLog.threshold(kind) <= 0 {
+		return nil
+	}
+	state := requestStateFrom(r)
+	if state == nil {
+		return nil
+	}
+	state.slow = &slowQuery{
+		RequestID: state.requestID,
+		Kind:      kind,
+		Tenant:    tenantID,
+		Index:     index,
+		start:     time.Now(),
+		body:      state.queryBody,
+	}
+	return state.slow
+}
+
+// recordSlowQuery logs the request once the upstream has responded if it took
+// longer than its threshold.
+func (p *Proxy) recordSlowQuery(resp *http.Response, query *slowQuery) {
+	elapsed := time.Since(query.start)
+	if elapsed < p.slowLog.threshold(query.Kind) {
+		return
+	}
+	query.Timestamp = time.Now().UTC()
+	query.DurationMs = elapsed.Milliseconds()
+	query.Status = resp.StatusCode
+	p.slowLog.formatQuery(query)
+	switch {
+	case query.QueryHash != "":
+		log.Printf("slowlog: request_id=%s kind=%s tenant=%s index=%s took=%s status=%d query_hash=%s", query.RequestID, query.Kind, query.Tenant, query.Index, elapsed, query.Status, query.QueryHash)
+	case query.Query != "":
+		log.Printf("slowlog: request_id=%s kind=%s tenant=%s index=%s took=%s status=%d query=%s", query.RequestID, query.Kind, query.Tenant, query.Index, elapsed, query.Status, query.Query)
+	default:
+		log.Printf("slowlog: request_id=%s kind=%s tenant=%s index=%s took=%s status=%d", query.RequestID, query.Kind, query.Tenant, query.Index, elapsed, query.Status)
+	}
+	kept := *query
+	kept.body = nil
+	p.slowLog.add(kept)
+}
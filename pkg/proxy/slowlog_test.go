@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+func slowUpstream(delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		jsonUpstream(http.StatusOK, `{}`).ServeHTTP(w, r)
+	})
+}
+
+func TestSlowLogRecordsSlowSearch(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SlowLog.SearchThresholdMs = 1
+	cfg.SlowLog.MaxQueryBytes = 10
+	proxyHandler := newProxyWithUpstream(t, cfg, slowUpstream(5*time.Millisecond))
+
+	req := httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(`{"query":{"match_all":{}}}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	queries := proxyHandler.slowLog.recent("")
+	if len(queries) != 1 {
+		t.Fatalf("expected one slow query, got %d", len(queries))
+	}
+	query := queries[0]
+	if query.Kind != slowQuerySearch || query.Tenant != "tenant1" || query.Index != "alias-products-tenant1" {
+		t.Fatalf("unexpected slow query: %+v", query)
+	}
+	if query.Query != `{"query":{` || query.DurationMs < 1 || query.Status != http.StatusOK || query.RequestID != rec.Header().Get(requestIDHeader) {
+		t.Fatalf("unexpected slow query details: %+v", query)
+	}
+}
+
+func TestSlowLogSkipsFastAndDisabledKinds(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SlowLog.SearchThresholdMs = 60000
+	proxyHandler := newProxyWithUpstream(t, cfg, slowUpstream(0))
+
+	for _, tt := range []struct {
+		path string
+		body string
+	}{
+		{path: "/products-tenant1/_search", body: `{}`},
+		{path: "/_bulk", body: "{\"index\":{\"_index\":\"products-tenant1\"}}\n{\"name\":\"a\"}\n"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if queries := proxyHandler.slowLog.recent(""); len(queries) != 0 {
+		t.Fatalf("expected no slow queries, got %+v", queries)
+	}
+}
+
+func TestSlowLogRecordsSlowBulk(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.SharedIndex.Name = "shared-{{.index}}"
+	cfg.SlowLog.BulkThresholdMs = 1
+	proxyHandler := newProxyWithUpstream(t, cfg, slowUpstream(5*time.Millisecond))
+
+	body := "{\"index\":{\"_index\":\"products-tenant2\",\"_id\":\"1\"}}\n{\"name\":\"a\"}\n"
+	req := httptest.NewRequest(http.MethodPost, "/_bulk", strings.NewReader(body))
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	queries := proxyHandler.slowLog.recent("tenant2")
+	if len(queries) != 1 {
+		t.Fatalf("expected one slow bulk, got %d", len(queries))
+	}
+	if queries[0].Kind != slowQueryBulk || queries[0].Index != "shared-products" || queries[0].Query != "" {
+		t.Fatalf("unexpected slow bulk: %+v", queries[0])
+	}
+}
+
+func TestSlowLogFormatQuery(t *testing.T) {
+	body := []byte(`{"query":{"term":{"user":"kimchy"}}}`)
+	sum := sha256.Sum256(body)
+	tests := []struct {
+		mode  string
+		query string
+		hash  string
+	}{
+		{mode: "full", query: string(body)},
+		{mode: "truncate", query: string(body[:8])},
+		{mode: "hash", hash: hex.EncodeToString(sum[:])},
+		{mode: "none"},
+	}
+	for _, tt := range tests {
+		l := &slowLog{cfg: config.SlowLog{Query: tt.mode, MaxQueryBytes: 8}}
+		query := &slowQuery{body: body}
+		l.formatQuery(query)
+		if query.Query != tt.query || query.QueryHash != tt.hash {
+			t.Fatalf("%s: unexpected query %q hash %q", tt.mode, query.Query, query.QueryHash)
+		}
+	}
+}
+
+func TestSlowLogKeepsMostRecent(t *testing.T) {
+	l := &slowLog{cfg: config.SlowLog{Recent: 2}}
+	for _, tenantID := range []string{"a", "b", "c"} {
+		l.add(slowQuery{Tenant: tenantID})
+	}
+	queries := l.recent("")
+	if len(queries) != 2 || queries[0].Tenant != "c" || queries[1].Tenant != "b" {
+		t.Fatalf("unexpected recent queries: %+v", queries)
+	}
+	if queries := l.recent("b"); len(queries) != 1 || queries[0].Tenant != "b" {
+		t.Fatalf("unexpected tenant queries: %+v", queries)
+	}
+}
+
+func TestAdminSlowLogEndpoint(t *testing.T) {
+	cfg := config.Default()
+	cfg.SlowLog.SearchThresholdMs = 100
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{}`))
+	proxyHandler.slowLog.add(slowQuery{Kind: slowQuerySearch, Tenant: "tenant1", Index: "alias-products-tenant1", DurationMs: 250})
+	proxyHandler.slowLog.add(slowQuery{Kind: slowQuerySearch, Tenant: "tenant2", DurationMs: 300})
+
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/slowlog?tenant=tenant1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var payload struct {
+		SlowQueries []map[string]interface{} `json:"slow_queries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(payload.SlowQueries) != 1 || payload.SlowQueries[0]["index"] != "alias-products-tenant1" || payload.SlowQueries[0]["duration_ms"] != float64(250) {
+		t.Fatalf("unexpected slow log response: %s", rec.Body.String())
+	}
+
+	disabled := newProxyWithUpstream(t, config.Default(), jsonUpstream(http.StatusOK, `{}`))
+	rec = httptest.NewRecorder()
+	disabled.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/slowlog", nil))
+	if strings.TrimSpace(rec.Body.String()) != `{"slow_queries":[]}` {
+		t.Fatalf("expected empty slow log, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// bodySpool holds a rewritten request body until it is forwarded. The first
+// memoryLimit bytes are kept in memory and the rest is written to a temporary
+// file in dir, so large bodies can be checked whole before the upstream sees
+// any of them without being held in memory.
+type bodySpool struct {
+	memoryLimit int64
+	dir         string
+	buf         bytes.Buffer
+	file        *os.File
+	size        int64
+	closeOnce   sync.Once
+}
+
+func newBodySpool(memoryLimit int64, dir string) *bodySpool {
+	return &bodySpool{memoryLimit: memoryLimit, dir: dir}
+}
+
+func (s *bodySpool) Write(data []byte) (int, error) {
+	if s.file == nil && int64(s.buf.Len()+len(data)) > s.memoryLimit {
+		file, err := os.CreateTemp(s.dir, "es-tmnt-bulk-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file = file
+		if _, err := file.Write(s.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		s.buf = bytes.Buffer{}
+	}
+	var n int
+	var err error
+	if s.file != nil {
+		n, err = s.file.Write(data)
+	} else {
+		n, err = s.buf.Write(data)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// Len returns the number of bytes written to the spool.
+func (s *bodySpool) Len() int64 {
+	return s.size
+}
+
+// Reader returns the spooled body from its start. Closing it discards the
+// spool.
+func (s *bodySpool) Reader() (io.ReadCloser, error) {
+	if s.file == nil {
+		return io.NopCloser(bytes.NewReader(s.buf.Bytes())), nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return spoolReader{s}, nil
+}
+
+// Close discards the spooled body and removes its temporary file, if any. It
+// may be called more than once.
+func (s *bodySpool) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		if s.file != nil {
+			err = s.file.Close()
+			os.Remove(s.file.Name())
+		}
+	})
+	return err
+}
+
+type spoolReader struct {
+	spool *bodySpool
+}
+
+func (r spoolReader) Read(data []byte) (int, error) {
+	return r.spool.file.Read(data)
+}
+
+func (r spoolReader) Close() error {
+	return r.spool.Close()
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBodySpool(t *testing.T) {
+	tests := []struct {
+		name        string
+		memoryLimit int64
+		wantFile    bool
+	}{
+		{name: "in memory", memoryLimit: 1 << 10},
+		{name: "spills to file", memoryLimit: 8, wantFile: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			spool := newBodySpool(tt.memoryLimit, dir)
+			lines := []string{"{\"index\":{}}\n", "{\"a\":1}\n", "{\"index\":{}}\n", "{\"a\":2}\n"}
+			for _, line := range lines {
+				if _, err := io.WriteString(spool, line); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+			}
+			want := strings.Join(lines, "")
+			if spool.Len() != int64(len(want)) {
+				t.Fatalf("expected length %d, got %d", len(want), spool.Len())
+			}
+			entries, _ := os.ReadDir(dir)
+			if (len(entries) == 1) != tt.wantFile {
+				t.Fatalf("unexpected spool files: %v", entries)
+			}
+			body, err := spool.Reader()
+			if err != nil {
+				t.Fatalf("reader: %v", err)
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if string(got) != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+			body.Close()
+			if err := spool.Close(); err != nil {
+				t.Fatalf("second close: %v", err)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Fatalf("expected spool file removed, got %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// handleSQL serves POST /_sql and /_sql/translate. Table references in the SQL
+// query are rewritten to the tenant's alias or index and, in shared mode, the
+// request filter is narrowed to the tenant.
+func (p *Proxy) handleSQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		p.rejectMethod(w, "unsupported method for sql", http.MethodGet, http.MethodPost)
+		return
+	}
+	if r.Body == nil {
+		p.reject(w, codeMissingBody, "missing body")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.reject(w, codeBodyReadFailed, "failed to read body")
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		p.reject(w, codeInvalidJSON, "invalid JSON body")
+		return
+	}
+	if _, ok := payload["cursor"]; ok {
+		p.reject(w, codeUnsupportedFeature, "SQL cursors are not supported")
+		return
+	}
+	query, _ := payload["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		p.reject(w, codeInvalidRequest, "SQL query is required")
+		return
+	}
+	rewritten, tenantID, tenantField, targets, err := p.rewriteSQL(r, query)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	payload["query"] = rewritten
+	if tenantID != "" && isSharedMode(p.cfg.Mode) {
+		payload["filter"] = addTenantFilter(payload["filter"], tenantField, tenantID)
+	}
+	body, err = json.Marshal(payload)
+	if err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	if state := requestStateFrom(r); state != nil {
+		state.queryBody = body
+	}
+	p.logRequestVerbose(r, "sql rewrite: %s -> %s", query, rewritten)
+	if tenantID != "" {
+		p.setUsage(r, tenantID, tenantUsage{Searches: 1})
+		p.setSlowQuery(r, slowQuerySearch, tenantID, strings.Join(targets, ","))
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// rewriteSQL replaces the table of every FROM clause, including those of
+// subqueries, with the tenant's alias or index. Only SELECT statements are
+// accepted since SHOW and DESCRIBE list indices of every tenant, and all tables
+// must belong to the same tenant. Comments and parenthesized tables are
+// rejected so they cannot hide table references from the rewrite, as is a
+// query with a FROM clause that resolved no tenant. The tenant field of the
+// tables is returned for the shared mode filter.
+func (p *Proxy) rewriteSQL(r *http.Request, query string) (string, string, string, []string, error) {
+	if first := sqlFirstWord(query); !strings.EqualFold(first, "SELECT") {
+		return "", "", "", nil, errors.New("only SQL SELECT statements are supported")
+	}
+	var output strings.Builder
+	var tenantID string
+	var targets, bases []string
+	hasFrom := false
+	// subqueries tracks, for every open parenthesis, whether it starts a
+	// subquery; FROM inside other parentheses, as in EXTRACT(YEAR FROM x), is
+	// not a table reference.
+	var subqueries []bool
+	last := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end, err := sqlQuotedEnd(query, i)
+			if err != nil {
+				return "", "", "", nil, err
+			}
+			i = end
+		case strings.HasPrefix(query[i:], "--"), strings.HasPrefix(query[i:], "/*"):
+			return "", "", "", nil, errors.New("SQL comments are not supported")
+		case c == '(':
+			subqueries = append(subqueries, strings.EqualFold(sqlFirstWord(query[i+1:]), "SELECT"))
+		case c == ')':
+			if len(subqueries) > 0 {
+				subqueries = subqueries[:len(subqueries)-1]
+			}
+		case isSQLWordByte(c):
+			start := i
+			for i < len(query) && isSQLWordByte(query[i]) {
+				i++
+			}
+			word := query[start:i]
+			i--
+			if strings.EqualFold(word, "JOIN") {
+				return "", "", "", nil, errors.New("SQL joins are not supported")
+			}
+			if !strings.EqualFold(word, "FROM") || (len(subqueries) > 0 && !subqueries[len(subqueries)-1]) {
+				continue
+			}
+			tableStart := i + 1
+			for tableStart < len(query) && isSQLSpace(query[tableStart]) {
+				tableStart++
+			}
+			hasFrom = true
+			if tableStart < len(query) && query[tableStart] == '(' {
+				if !strings.EqualFold(sqlFirstWord(query[tableStart+1:]), "SELECT") {
+					return "", "", "", nil, errors.New("SQL FROM must name a table or a SELECT subquery")
+				}
+				continue
+			}
+			table, tableEnd, err := sqlTableName(query, tableStart)
+			if err != nil {
+				return "", "", "", nil, err
+			}
+			baseIndex, tableTenant, err := p.parseIndex(r, table)
+			if err != nil {
+				return "", "", "", nil, err
+			}
+			if tenantID == "" {
+				tenantID = tableTenant
+			} else if tenantID != tableTenant {
+				return "", "", "", nil, withCode(codeMultipleTenants, fmt.Errorf("SQL query contains multiple tenants: %s and %s", tenantID, tableTenant))
+			}
+			bases = append(bases, baseIndex)
+			target, err := p.renderQueryIndex(baseIndex, tableTenant)
+			if err != nil {
+				return "", "", "", nil, err
+			}
+			if !containsString(targets, target) {
+				targets = append(targets, target)
+			}
+			output.WriteString(query[last:tableStart])
+			output.WriteString(`"` + strings.ReplaceAll(target, `"`, `""`) + `"`)
+			last = tableEnd
+			i = tableEnd - 1
+		}
+	}
+	output.WriteString(query[last:])
+	if hasFrom && tenantID == "" {
+		return "", "", "", nil, errors.New("SQL query does not name a tenant table")
+	}
+	tenantField, err := p.commonTenantField(bases)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	return output.String(), tenantID, tenantField, targets, nil
+}
+
+// sqlTableName reads the table reference starting at start and returns it
+// unquoted with the offset just past it.
+func sqlTableName(query string, start int) (string, int, error) {
+	if start >= len(query) {
+		return "", 0, errors.New("SQL FROM requires a table")
+	}
+	var table string
+	end := start
+	if c := query[start]; c == '"' || c == '`' {
+		quoteEnd, err := sqlQuotedEnd(query, start)
+		if err != nil {
+			return "", 0, err
+		}
+		quote := string(c)
+		table = strings.ReplaceAll(query[start+1:quoteEnd], quote+quote, quote)
+		end = quoteEnd + 1
+	} else {
+		for end < len(query) && !isSQLSpace(query[end]) && !strings.ContainsRune(",();", rune(query[end])) {
+			end++
+		}
+		table = query[start:end]
+		if strings.Contains(table, "--") || strings.Contains(table, "/*") {
+			return "", 0, errors.New("SQL comments are not supported")
+		}
+	}
+	if table == "" {
+		return "", 0, errors.New("SQL FROM requires a table")
+	}
+	if strings.ContainsAny(table, "*:,") {
+		return "", 0, fmt.Errorf("SQL table %s is not supported", table)
+	}
+	next := end
+	for next < len(query) && isSQLSpace(query[next]) {
+		next++
+	}
+	if next < len(query) && query[next] == ',' {
+		return "", 0, errors.New("SQL queries over multiple tables are not supported")
+	}
+	return table, end, nil
+}
+
+// sqlQuotedEnd returns the offset of the quote closing the literal or quoted
+// identifier that starts at start. Doubled quotes are escapes.
+func sqlQuotedEnd(query string, start int) (int, error) {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i, nil
+	}
+	return 0, errors.New("unterminated SQL string or identifier")
+}
+
+func sqlFirstWord(text string) string {
+	text = strings.TrimLeft(text, " \t\r\n(")
+	end := 0
+	for end < len(text) && isSQLWordByte(text[end]) {
+		end++
+	}
+	return text[:end]
+}
+
+func isSQLWordByte(c byte) bool {
+	return c == '_' || c == '@' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestSQLSharedMode(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"query":"SELECT name FROM \"products-tenant1\" WHERE price > 10","filter":{"term":{"color":"red"}},"fetch_size":5}`
+	req := httptest.NewRequest(http.MethodPost, "/_sql?format=json", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, query, captured, _, _ := capture.snapshot()
+	if path != "/_sql" || query != "format=json" {
+		t.Fatalf("expected /_sql?format=json, got %s?%s", path, query)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(captured, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	want := `SELECT name FROM "alias-products-tenant1" WHERE price > 10`
+	if payload["query"] != want {
+		t.Fatalf("expected query %q, got %q", want, payload["query"])
+	}
+	filter, _ := json.Marshal(payload["filter"])
+	if !strings.Contains(string(filter), `{"term":{"tenant_id":"tenant1"}}`) || !strings.Contains(string(filter), `"color":"red"`) {
+		t.Fatalf("expected tenant filter combined with the request filter, got %s", filter)
+	}
+	if payload["fetch_size"] != float64(5) {
+		t.Fatalf("expected other body fields to be kept, got %v", payload)
+	}
+}
+
+func TestSQLTranslateIndexPerTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.tenant}}-{{.index}}"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	body := `{"query":"select count(*) from products-tenant1"}`
+	req := httptest.NewRequest(http.MethodPost, "/_sql/translate", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, captured, _, _ := capture.snapshot()
+	if path != "/_sql/translate" {
+		t.Fatalf("expected /_sql/translate, got %s", path)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(captured, &payload); err != nil {
+		t.Fatalf("parse body: %v", err)
+	}
+	if payload["query"] != `select count(*) from "tenant1-products"` {
+		t.Fatalf("unexpected query %q", payload["query"])
+	}
+	if _, ok := payload["filter"]; ok {
+		t.Fatalf("expected no tenant filter in index-per-tenant mode, got %v", payload["filter"])
+	}
+}
+
+func TestSQLRejected(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		wantErr string
+		status  int
+	}{
+		{name: "cursor", path: "/_sql", body: `{"cursor":"abc"}`, wantErr: "cursors are not supported"},
+		{name: "missing query", path: "/_sql", body: `{}`, wantErr: "SQL query is required"},
+		{name: "close", path: "/_sql/close", body: `{"cursor":"abc"}`, wantErr: "unsupported system endpoint", status: http.StatusNotFound},
+		{name: "show tables", path: "/_sql", body: `{"query":"SHOW TABLES"}`, wantErr: "only SQL SELECT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			status := tt.status
+			if status == 0 {
+				status = http.StatusBadRequest
+			}
+			if rec.Code != status || !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Fatalf("expected rejection containing %q, got %d: %s", tt.wantErr, rec.Code, rec.Body.String())
+			}
+		})
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+}
+
+func TestRewriteSQL(t *testing.T) {
+	p := setupTestProxy("shared")
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{name: "backtick table", query: "SELECT * FROM `logs-tenant1` LIMIT 5", want: `SELECT * FROM "alias-logs-tenant1" LIMIT 5`},
+		{name: "from in string", query: `SELECT 'FROM x' AS s FROM logs-tenant1`, want: `SELECT 'FROM x' AS s FROM "alias-logs-tenant1"`},
+		{name: "from in quoted field", query: `SELECT "from" FROM logs-tenant1`, want: `SELECT "from" FROM "alias-logs-tenant1"`},
+		{name: "extract from", query: "SELECT EXTRACT(YEAR FROM ts) FROM logs-tenant1", want: `SELECT EXTRACT(YEAR FROM ts) FROM "alias-logs-tenant1"`},
+		{name: "subquery", query: "SELECT a FROM (SELECT a FROM logs-tenant1) WHERE a > 1", want: `SELECT a FROM (SELECT a FROM "alias-logs-tenant1") WHERE a > 1`},
+		{name: "without from", query: "SELECT 1 + 1", want: "SELECT 1 + 1"},
+		{name: "multiple tenants", query: "SELECT a FROM (SELECT a FROM logs-tenant1) WHERE a IN (SELECT a FROM logs-tenant2)", wantErr: "multiple tenants"},
+		{name: "join", query: "SELECT * FROM logs-tenant1 JOIN logs-tenant2 ON a = b", wantErr: "joins are not supported"},
+		{name: "multiple tables", query: "SELECT * FROM logs-tenant1, logs-tenant1", wantErr: "multiple tables"},
+		{name: "wildcard", query: `SELECT * FROM "logs-*"`, wantErr: "not supported"},
+		{name: "remote cluster", query: `SELECT * FROM "remote:logs-tenant1"`, wantErr: "not supported"},
+		{name: "line comment", query: "SELECT * FROM logs-tenant1 -- x", wantErr: "comments are not supported"},
+		{name: "block comment", query: "SELECT * FROM /* x */ logs-tenant1", wantErr: "comments are not supported"},
+		{name: "unterminated", query: "SELECT 'a FROM logs-tenant1", wantErr: "unterminated"},
+		{name: "describe", query: "DESCRIBE logs-tenant1", wantErr: "only SQL SELECT"},
+		{name: "missing table", query: "SELECT a FROM ", wantErr: "requires a table"},
+		{name: "parenthesized table", query: `SELECT * FROM ("shared-index")`, wantErr: "must name a table or a SELECT subquery"},
+		{name: "subquery without table", query: "SELECT a FROM (SELECT 1 AS a)", wantErr: "does not name a tenant table"},
+		{name: "parenthesized table in subquery", query: `SELECT a FROM (SELECT a FROM (logs-tenant1))`, wantErr: "must name a table or a SELECT subquery"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, _, _, err := p.rewriteSQL(nil, tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+// stateStore keeps state that replicas of the proxy behind a load balancer
+// must share, so that a follow-up request can be served by any replica: the
+// owners of async EQL searches and tasks, and purge progress. The proxy has no
+// rate limiter and rejects scroll and PIT requests, so there are no counters
+// or scroll ownership to keep. Implementations must be safe for concurrent
+// use.
+type stateStore interface {
+	// Get returns the value of key and whether it is set.
+	Get(key string) (string, bool, error)
+	// Set stores value under key until ttl has passed.
+	Set(key, value string, ttl time.Duration) error
+	Delete(key string) error
+}
+
+func newStateStore(cfg config.State) (stateStore, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Store)) {
+	case "", "memory":
+		return newMemoryStateStore(), nil
+	case "redis":
+		return newRedisStateStore(cfg.RedisURL, cfg.KeyPrefix)
+	default:
+		return nil, fmt.Errorf("unsupported state store %q", cfg.Store)
+	}
+}
+
+type memoryStateEntry struct {
+	value   string
+	expires time.Time
+}
+
+// memoryStateSweepInterval is how often Set removes expired entries that were
+// never read again. Get drops an expired entry as soon as it is read.
+const memoryStateSweepInterval = time.Minute
+
+// memoryStateStore keeps state in the process, so it is not shared between
+// replicas.
+type memoryStateStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryStateEntry
+	now       func() time.Time
+	nextSweep time.Time
+}
+
+func newMemoryStateStore() *memoryStateStore {
+	return &memoryStateStore{entries: make(map[string]memoryStateEntry), now: time.Now}
+}
+
+func (s *memoryStateStore) Get(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return "", false, nil
+	}
+	if s.now().After(entry.expires) {
+		delete(s.entries, key)
+		return "", false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (s *memoryStateStore) Set(key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.After(s.nextSweep) {
+		for existing, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, existing)
+			}
+		}
+		s.nextSweep = now.Add(memoryStateSweepInterval)
+	}
+	s.entries[key] = memoryStateEntry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *memoryStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisTimeout   = 5 * time.Second
+	redisIdleConns = 8
+)
+
+// redisError is an error reply from the Redis server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisStateStore keeps state in a Redis server shared by every replica. It
+// speaks the Redis protocol directly over a small pool of connections.
+type redisStateStore struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	prefix   string
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRedisStateStore(rawURL, prefix string) (*redisStateStore, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	store := &redisStateStore{
+		addr:   parsed.Host,
+		prefix: prefix,
+		idle:   make(chan *redisConn, redisIdleConns),
+	}
+	switch parsed.Scheme {
+	case "redis":
+	case "rediss":
+		store.tls = &tls.Config{ServerName: parsed.Hostname()}
+	default:
+		return nil, fmt.Errorf("unsupported redis url scheme %q", parsed.Scheme)
+	}
+	if parsed.Port() == "" {
+		store.addr = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if parsed.User != nil {
+		store.username = parsed.User.Username()
+		store.password, _ = parsed.User.Password()
+	}
+	if db := strings.Trim(parsed.Path, "/"); db != "" {
+		store.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	return store, nil
+}
+
+func (s *redisStateStore) Get(key string) (string, bool, error) {
+	reply, err := s.do("GET", s.prefix+key)
+	if err != nil {
+		return "", false, err
+	}
+	if reply == nil {
+		return "", false, nil
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", false, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return value, true, nil
+}
+
+func (s *redisStateStore) Set(key, value string, ttl time.Duration) error {
+	_, err := s.do("SET", s.prefix+key, value, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (s *redisStateStore) Delete(key string) error {
+	_, err := s.do("DEL", s.prefix+key)
+	return err
+}
+
+// do sends a command and reads its reply. Connections are reused unless the
+// exchange failed, which leaves them in an unknown state.
+func (s *redisStateStore) do(args ...string) (interface{}, error) {
+	conn, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		_ = conn.conn.Close()
+		return nil, err
+	}
+	select {
+	case s.idle <- conn:
+	default:
+		_ = conn.conn.Close()
+	}
+	return reply, err
+}
+
+func (s *redisStateStore) conn() (*redisConn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if s.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, s.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: connect to %s: %w", s.addr, err)
+	}
+	redis := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if s.password != "" {
+		auth := []string{"AUTH", s.password}
+		if s.username != "" {
+			auth = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := redis.do(auth...); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := redis.do("SELECT", strconv.Itoa(s.db)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return redis, nil
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return nil, err
+	}
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, command.String()); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return readRedisReply(c.reader)
+}
+
+// readRedisReply reads one reply. Bulk strings are returned as strings, nil
+// bulk strings and arrays as nil, integers as int64, and arrays as slices.
+func readRedisReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line[1:])
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line[1:])
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := readRedisReply(reader)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+// fakeRedis serves the subset of the Redis protocol the state store uses.
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	ttls     map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) (*fakeRedis, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	server := &fakeRedis{values: make(map[string]string), ttls: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server, "redis://:secret@" + listener.Addr().String() + "/2"
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		reply, err := readRedisReply(reader)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, 0, len(items))
+		for _, item := range items {
+			args = append(args, item.(string))
+		}
+		_, _ = io.WriteString(conn, f.handle(args))
+	}
+}
+
+func (f *fakeRedis) handle(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, args[0])
+	switch args[0] {
+	case "AUTH":
+		if args[len(args)-1] != "secret" {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		f.values[args[1]] = args[2]
+		f.ttls[args[1]] = strings.Join(args[3:], " ")
+		return "+OK\r\n"
+	case "DEL":
+		delete(f.values, args[1])
+		return ":1\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func TestMemoryStateStoreExpires(t *testing.T) {
+	store := newMemoryStateStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	if err := store.Set("a", "1", time.Minute); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if value, ok, _ := store.Get("a"); !ok || value != "1" {
+		t.Fatalf("expected stored value, got %q %v", value, ok)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := store.Get("a"); ok {
+		t.Fatal("expected expired value to be gone")
+	}
+	_ = store.Set("b", "2", time.Minute)
+	_ = store.Delete("b")
+	if _, ok, _ := store.Get("b"); ok {
+		t.Fatal("expected deleted value to be gone")
+	}
+}
+
+func TestMemoryStateStoreSweepsPeriodically(t *testing.T) {
+	store := newMemoryStateStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	_ = store.Set("a", "1", time.Second)
+	now = now.Add(2 * time.Second)
+	_ = store.Set("b", "2", time.Hour)
+	if len(store.entries) != 2 {
+		t.Fatalf("expected no sweep within the interval, got %d entries", len(store.entries))
+	}
+	now = now.Add(memoryStateSweepInterval)
+	_ = store.Set("c", "3", time.Hour)
+	if _, ok := store.entries["a"]; ok || len(store.entries) != 2 {
+		t.Fatalf("expected the expired entry swept, got %v", store.entries)
+	}
+}
+
+func TestRedisStateStore(t *testing.T) {
+	server, redisURL := newFakeRedis(t)
+	store, err := newStateStore(config.State{Store: "redis", RedisURL: redisURL, KeyPrefix: "test:"})
+	if err != nil {
+		t.Fatalf("new state store: %v", err)
+	}
+
+	if _, ok, err := store.Get("a"); err != nil || ok {
+		t.Fatalf("expected missing key, got %v %v", ok, err)
+	}
+	if err := store.Set("a", "line\r\nbreak", 90*time.Second); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if value, ok, err := store.Get("a"); err != nil || !ok || value != "line\r\nbreak" {
+		t.Fatalf("expected stored value, got %q %v %v", value, ok, err)
+	}
+	if err := store.Delete("a"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.ttls["test:a"] != "PX 90000" {
+		t.Fatalf("expected prefixed key with ttl, got %+v", server.ttls)
+	}
+	if _, ok := server.values["test:a"]; ok {
+		t.Fatal("expected key to be deleted")
+	}
+	if got := strings.Join(server.commands, ","); got != "AUTH,SELECT,GET,SET,GET,DEL" {
+		t.Fatalf("expected one connection to be reused, got %s", got)
+	}
+}
+
+func TestRedisStateStoreErrors(t *testing.T) {
+	_, redisURL := newFakeRedis(t)
+	store, err := newRedisStateStore(strings.Replace(redisURL, "secret", "wrong", 1), "")
+	if err != nil {
+		t.Fatalf("new redis store: %v", err)
+	}
+	if _, _, err := store.Get("a"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("expected auth error, got %v", err)
+	}
+
+	if _, err := newRedisStateStore("redis://localhost/db", ""); err == nil {
+		t.Fatal("expected invalid database error")
+	}
+	if _, err := newStateStore(config.State{Store: "etcd"}); err == nil {
+		t.Fatal("expected unsupported store error")
+	}
+}
+
+func TestEQLAsyncSearchSharedAcrossReplicas(t *testing.T) {
+	_, redisURL := newFakeRedis(t)
+	cfg := config.Default()
+	cfg.State = config.State{Store: "redis", RedisURL: redisURL, KeyPrefix: "es-tmnt:"}
+	upstream := jsonUpstream(http.StatusOK, `{"id":"abc","is_running":true}`)
+	first := newProxyWithUpstream(t, cfg, upstream)
+	second := newProxyWithUpstream(t, cfg, upstream)
+
+	rec := httptest.NewRecorder()
+	first.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/logs-tenant1/_eql/search", strings.NewReader(`{"query":"any where true"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	second.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_eql/search/abc", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected other replica to know the search, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// taskKeepAlive is how long the tenant of a task is remembered. Task results
+// stay in the upstream .tasks index until they are deleted, so this only bounds
+// how long a tenant can look up a task it started.
+const taskKeepAlive = 7 * 24 * time.Hour
+
+// tenantTask records the tenant an asynchronous by-query or reindex request
+// was sent for, and the index names the proxy rewrote in it, keyed by the name
+// sent upstream, so that task status can be reported in the tenant's names.
+type tenantTask struct {
+	TenantID string            `json:"tenant"`
+	Indices  map[string]string `json:"indices,omitempty"`
+}
+
+// taskTracker maps the ids of tasks started by asynchronous by-query and
+// reindex requests to the tenant that started them. The ids are kept in the
+// state store so that any replica can serve the follow-up requests.
+type taskTracker struct {
+	store stateStore
+}
+
+func newTaskTracker(store stateStore) *taskTracker {
+	return &taskTracker{store: store}
+}
+
+func (t *taskTracker) add(id string, task tenantTask) error {
+	value, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return t.store.Set("task:"+id, string(value), taskKeepAlive)
+}
+
+func (t *taskTracker) get(id string) (tenantTask, bool, error) {
+	value, ok, err := t.store.Get("task:" + id)
+	if err != nil || !ok {
+		return tenantTask{}, false, err
+	}
+	var task tenantTask
+	if err := json.Unmarshal([]byte(value), &task); err != nil {
+		return tenantTask{}, false, fmt.Errorf("decode task %s: %w", id, err)
+	}
+	return task, true, nil
+}
+
+func (t *taskTracker) remove(id string) error {
+	return t.store.Delete("task:" + id)
+}
+
+// trackTask records the task an asynchronous request of tenantID starts when
+// tasks are scoped to tenants. indices maps the index names sent upstream to
+// the names the client used.
+func (p *Proxy) trackTask(r *http.Request, baseIndex, tenantID string, indices map[string]string) {
+	if !p.cfg.Tasks.ScopeTasks || r.URL.Query().Get("wait_for_completion") != "false" {
+		return
+	}
+	p.setResponseKind(r, responseKindTask, baseIndex, tenantID)
+	if state := requestStateFrom(r); state != nil {
+		state.taskIndices = indices
+	}
+}
+
+// rewriteTaskResponse remembers the task id an asynchronous request returned
+// for the request's tenant. For requests polling or cancelling a task it
+// reports the task in the tenant's index names, and forgets tasks the upstream
+// no longer knows.
+func (p *Proxy) rewriteTaskResponse(resp *http.Response, state *requestState) error {
+	if state.asyncID != "" {
+		if resp.StatusCode == http.StatusNotFound {
+			if err := p.tasks.remove(state.asyncID); err != nil {
+				log.Printf("state: %v", err)
+			}
+		}
+		if len(state.taskIndices) == 0 {
+			return nil
+		}
+		return p.rewriteJSONBody(resp, func(payload map[string]interface{}) (interface{}, bool) {
+			return payload, rewriteTaskIndices(payload, newTaskIndexReplacer(state.taskIndices), state.taskIndices)
+		})
+	}
+	return p.rewriteJSONResponse(resp, func(payload map[string]interface{}) (interface{}, bool) {
+		if id, ok := payload["task"].(string); ok && id != "" {
+			if err := p.tasks.add(id, tenantTask{TenantID: state.tenantID, Indices: state.taskIndices}); err != nil {
+				log.Printf("state: %v", err)
+			}
+		}
+		return payload, false
+	})
+}
+
+// newTaskIndexReplacer replaces the upstream index names in task descriptions,
+// longest first so that a name is not replaced inside a longer one.
+func newTaskIndexReplacer(indices map[string]string) *strings.Replacer {
+	targets := make([]string, 0, len(indices))
+	for target := range indices {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return len(targets[i]) > len(targets[j]) })
+	pairs := make([]string, 0, 2*len(targets))
+	for _, target := range targets {
+		pairs = append(pairs, target, indices[target])
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// rewriteTaskIndices walks a task status or cancel response, replacing the
+// upstream index names in task descriptions and the index of failures and
+// errors.
+func rewriteTaskIndices(value interface{}, replacer *strings.Replacer, indices map[string]string) bool {
+	changed := false
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			switch text, _ := item.(string); {
+			case key == "description" && text != "":
+				if rewritten := replacer.Replace(text); rewritten != text {
+					typed[key] = rewritten
+					changed = true
+				}
+			case key == "index" && indices[text] != "":
+				typed[key] = indices[text]
+				changed = true
+			default:
+				changed = rewriteTaskIndices(item, replacer, indices) || changed
+			}
+		}
+	case []interface{}:
+		for _, item := range typed {
+			changed = rewriteTaskIndices(item, replacer, indices) || changed
+		}
+	}
+	return changed
+}
+
+// taskIndexNames pairs the comma-separated index names sent upstream with the
+// names the client used, when both list the same number of names.
+func taskIndexNames(indices map[string]string, client, target string) {
+	clientNames, targetNames := strings.Split(client, ","), strings.Split(target, ",")
+	if len(clientNames) != len(targetNames) {
+		return
+	}
+	for i, name := range targetNames {
+		if name, original := strings.TrimSpace(name), strings.TrimSpace(clientNames[i]); name != "" && name != original {
+			indices[name] = original
+		}
+	}
+}
+
+// reindexTaskIndices pairs the source and dest indices of a rewritten reindex
+// body with those of the body the client sent.
+func reindexTaskIndices(body, rewritten []byte) map[string]string {
+	type reindexIndices struct {
+		Source struct {
+			Index interface{} `json:"index"`
+		} `json:"source"`
+		Dest struct {
+			Index string `json:"index"`
+		} `json:"dest"`
+	}
+	var client, target reindexIndices
+	if json.Unmarshal(body, &client) != nil || json.Unmarshal(rewritten, &target) != nil {
+		return nil
+	}
+	indices := map[string]string{}
+	clientSource, _ := indexValueNames(client.Source.Index)
+	targetSource, _ := indexValueNames(target.Source.Index)
+	taskIndexNames(indices, strings.Join(clientSource, ","), strings.Join(targetSource, ","))
+	taskIndexNames(indices, client.Dest.Index, target.Dest.Index)
+	return indices
+}
+
+// taskTenant returns the tenant a _tasks request is made for: the tenant the
+// proxy authenticated the request as. Request headers are not trusted, since
+// any client could set them to reach another tenant's tasks.
+func (p *Proxy) taskTenant(r *http.Request) string {
+	if state := requestStateFrom(r); state != nil {
+		return state.authTenant
+	}
+	return ""
+}
+
+// handleRethrottle serves POST /_delete_by_query/{task}/_rethrottle and its
+// _update_by_query and _reindex forms. When tasks are scoped to tenants the
+// task must belong to the caller's tenant, like for _tasks; otherwise the
+// request is passed through.
+func (p *Proxy) handleRethrottle(w http.ResponseWriter, r *http.Request, id string) {
+	if !p.cfg.Tasks.ScopeTasks {
+		if p.rejectUnscopedAPIKey(w, r) {
+			return
+		}
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	p.handleTask(w, r, id)
+}
+
+// handleTask serves GET /_tasks/{id} and POST /_tasks/{id}/_cancel when tasks
+// are scoped to tenants. Only tasks the proxy saw the caller's tenant start
+// are accepted; tasks of other tenants are reported as unknown so that their
+// ids are not confirmed.
+func (p *Proxy) handleTask(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID := p.taskTenant(r)
+	if tenantID == "" {
+		p.reject(w, codeTenantRequired, "tenant is required for _tasks requests")
+		return
+	}
+	task, ok, err := p.tasks.get(id)
+	if err != nil {
+		p.writeError(w, http.StatusServiceUnavailable, "service_unavailable", codeStateUnavailable, err.Error())
+		return
+	}
+	if !ok || task.TenantID != tenantID {
+		p.reject(w, codeInvalidRequest, "unknown task id")
+		return
+	}
+	if err := p.checkTenantAccess(r, tenantID); err != nil {
+		p.rejectError(w, err)
+		return
+	}
+	p.setResponseKind(r, responseKindTask, "", tenantID)
+	if state := requestStateFrom(r); state != nil {
+		state.asyncID = id
+		state.taskIndices = task.Indices
+	}
+	p.proxy.ServeHTTP(w, r)
+}
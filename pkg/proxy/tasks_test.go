@@ -0,0 +1,290 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+// tasksTestUsers authenticates each test tenant as the user of the same name.
+var tasksTestUsers = config.BasicAuth{
+	Enabled: true,
+	Users: []config.BasicAuthUser{
+		{Username: "tenant1", Password: "{PLAIN}secret"},
+		{Username: "tenant2", Password: "{PLAIN}secret"},
+	},
+}
+
+// newTaskRequest builds a request authenticated as tenant, or anonymous when
+// tenant is empty.
+func newTaskRequest(method, path, body, tenant string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if tenant != "" {
+		req.SetBasicAuth(tenant, "secret")
+	}
+	return req
+}
+
+func newTasksTestProxy(t *testing.T) (*Proxy, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var paths []string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/_tasks/"):
+			_, _ = io.WriteString(w, `{"completed":false,"task":{"node":"node1","id":1}}`)
+		case r.URL.Query().Get("wait_for_completion") == "false":
+			_, _ = io.WriteString(w, `{"task":"node1:1"}`)
+		default:
+			_, _ = io.WriteString(w, `{"took":1,"deleted":0}`)
+		}
+	})
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.Tasks.ScopeTasks = true
+	cfg.Auth.BasicAuth = tasksTestUsers
+	return newProxyWithUpstream(t, cfg, upstream), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+func TestTasksTrackedPerTenant(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "delete by query", path: "/products-tenant1/_delete_by_query?wait_for_completion=false", body: `{"query":{"match_all":{}}}`},
+		{name: "update by query", path: "/products-tenant1/_update_by_query?wait_for_completion=false", body: `{"query":{"match_all":{}}}`},
+		{name: "reindex", path: "/_reindex?wait_for_completion=false", body: `{"source":{"index":"products-tenant1"},"dest":{"index":"archive-tenant1"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyHandler, _ := newTasksTestProxy(t)
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, newTaskRequest(http.MethodPost, tt.path, tt.body, "tenant1"))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if task, ok, _ := proxyHandler.tasks.get("node1:1"); !ok || task.TenantID != "tenant1" {
+				t.Fatalf("expected task tracked for tenant1, got %+v %v", task, ok)
+			}
+		})
+	}
+}
+
+func TestTasksSynchronousNotTracked(t *testing.T) {
+	proxyHandler, _ := newTasksTestProxy(t)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, newTaskRequest(http.MethodPost, "/products-tenant1/_delete_by_query", `{"query":{"match_all":{}}}`, "tenant1"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok, _ := proxyHandler.tasks.get("node1:1"); ok {
+		t.Fatalf("expected no task tracked")
+	}
+}
+
+func TestTasksScopedToOwner(t *testing.T) {
+	proxyHandler, paths := newTasksTestProxy(t)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, newTaskRequest(http.MethodPost, "/products-tenant1/_delete_by_query?wait_for_completion=false", `{"query":{"match_all":{}}}`, "tenant1"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		tenant     string
+		wantStatus int
+	}{
+		{name: "get own task", method: http.MethodGet, path: "/_tasks/node1:1", tenant: "tenant1", wantStatus: http.StatusOK},
+		{name: "cancel own task", method: http.MethodPost, path: "/_tasks/node1:1/_cancel", tenant: "tenant1", wantStatus: http.StatusOK},
+		{name: "get other tenant task", method: http.MethodGet, path: "/_tasks/node1:1", tenant: "tenant2", wantStatus: http.StatusBadRequest},
+		{name: "cancel other tenant task", method: http.MethodPost, path: "/_tasks/node1:1/_cancel", tenant: "tenant2", wantStatus: http.StatusBadRequest},
+		{name: "unknown task", method: http.MethodGet, path: "/_tasks/node1:2", tenant: "tenant1", wantStatus: http.StatusBadRequest},
+		{name: "no tenant", method: http.MethodGet, path: "/_tasks/node1:1", wantStatus: http.StatusUnauthorized},
+		{name: "list tasks", method: http.MethodGet, path: "/_tasks", tenant: "tenant1", wantStatus: http.StatusBadRequest},
+		{name: "cancel by filter", method: http.MethodPost, path: "/_tasks/_cancel", tenant: "tenant1", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(paths())
+			req := newTaskRequest(tt.method, tt.path, "", tt.tenant)
+			req.Header.Set("X-Tenant-ID", "tenant1")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			forwarded := len(paths()) > before
+			if forwarded != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("expected forwarded=%v, got %v", tt.wantStatus == http.StatusOK, forwarded)
+			}
+		})
+	}
+}
+
+func TestTasksIgnoreTenantHeader(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.Tasks.ScopeTasks = true
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	if err := proxyHandler.tasks.add("node1:1", tenantTask{TenantID: "tenant1"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	for _, path := range []string{"/_tasks/node1:1", "/_tasks/node1:1/_cancel"} {
+		method := http.MethodGet
+		if strings.HasSuffix(path, "_cancel") {
+			method = http.MethodPost
+		}
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Tenant-ID", "tenant1")
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), string(codeTenantRequired)) {
+			t.Fatalf("%s %s: expected %s, got %d: %s", method, path, codeTenantRequired, rec.Code, rec.Body.String())
+		}
+	}
+	if _, _, _, _, calls := capture.snapshot(); calls != 0 {
+		t.Fatalf("expected no upstream calls, got %d", calls)
+	}
+}
+
+func TestTasksPassthroughWithoutScoping(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, config.Default())
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_tasks", nil))
+	if path, _, _, _, _ := capture.snapshot(); rec.Code != http.StatusOK || path != "/_tasks" {
+		t.Fatalf("expected passthrough, got %d %s", rec.Code, path)
+	}
+}
+
+func TestTaskStatusInTenantNames(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusOK
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.HasPrefix(r.URL.Path, "/_tasks/") {
+			_, _ = io.WriteString(w, `{"task":"node1:7"}`)
+			return
+		}
+		mu.Lock()
+		code := status
+		mu.Unlock()
+		w.WriteHeader(code)
+		_, _ = io.WriteString(w, `{"completed":true,"task":{"node":"node1","id":7,"description":"update-by-query [alias-products-tenant1]"},"response":{"updated":1,"failures":[{"index":"alias-products-tenant1","id":"2","cause":{"type":"mapper_parsing_exception"}}]}}`)
+	})
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.Tasks.ScopeTasks = true
+	cfg.Auth.BasicAuth = tasksTestUsers
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, newTaskRequest(http.MethodPost, "/_update_by_query?index=products-tenant1&wait_for_completion=false", `{"query":{"match_all":{}}}`, "tenant1"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req := newTaskRequest(http.MethodGet, "/_tasks/node1:7", "", "tenant1")
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); strings.Contains(body, "alias-") || !strings.Contains(body, `"description":"update-by-query [products-tenant1]"`) || !strings.Contains(body, `"index":"products-tenant1"`) {
+		t.Fatalf("expected the task in the tenant's index names, got %s", body)
+	}
+
+	mu.Lock()
+	status = http.StatusNotFound
+	mu.Unlock()
+	req = newTaskRequest(http.MethodGet, "/_tasks/node1:7", "", "tenant1")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	if _, ok, _ := proxyHandler.tasks.get("node1:7"); ok {
+		t.Fatalf("expected the task forgotten once the upstream no longer knows it")
+	}
+}
+
+func TestReindexTaskIndices(t *testing.T) {
+	body := []byte(`{"source":{"index":["orders-tenant1","products-tenant1"]},"dest":{"index":"archive-tenant1"}}`)
+	rewritten := []byte(`{"source":{"index":["alias-orders-tenant1","alias-products-tenant1"]},"dest":{"index":"shared-index"}}`)
+	indices := reindexTaskIndices(body, rewritten)
+	want := map[string]string{"alias-orders-tenant1": "orders-tenant1", "alias-products-tenant1": "products-tenant1", "shared-index": "archive-tenant1"}
+	if len(indices) != len(want) {
+		t.Fatalf("expected %v, got %v", want, indices)
+	}
+	for target, client := range want {
+		if indices[target] != client {
+			t.Fatalf("expected %v, got %v", want, indices)
+		}
+	}
+}
+
+func TestRethrottleScopedToOwner(t *testing.T) {
+	proxyHandler, paths := newTasksTestProxy(t)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, newTaskRequest(http.MethodPost, "/products-tenant1/_delete_by_query?wait_for_completion=false", `{"query":{"match_all":{}}}`, "tenant1"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		tenant     string
+		wantStatus int
+	}{
+		{name: "delete by query", path: "/_delete_by_query/node1:1/_rethrottle?requests_per_second=10", tenant: "tenant1", wantStatus: http.StatusOK},
+		{name: "update by query", path: "/_update_by_query/node1:1/_rethrottle?requests_per_second=10", tenant: "tenant1", wantStatus: http.StatusOK},
+		{name: "reindex", path: "/_reindex/node1:1/_rethrottle?requests_per_second=-1", tenant: "tenant1", wantStatus: http.StatusOK},
+		{name: "other tenant", path: "/_delete_by_query/node1:1/_rethrottle?requests_per_second=10", tenant: "tenant2", wantStatus: http.StatusBadRequest},
+		{name: "unknown task", path: "/_reindex/node1:2/_rethrottle?requests_per_second=10", tenant: "tenant1", wantStatus: http.StatusBadRequest},
+		{name: "no tenant", path: "/_update_by_query/node1:1/_rethrottle?requests_per_second=10", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(paths())
+			req := newTaskRequest(http.MethodPost, tt.path, "", tt.tenant)
+			req.Header.Set("X-Tenant-ID", "tenant1")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			all := paths()
+			forwarded := len(all) > before
+			if forwarded != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("expected forwarded=%v, got %v", tt.wantStatus == http.StatusOK, forwarded)
+			}
+			if forwarded && all[len(all)-1] != "POST "+strings.SplitN(tt.path, "?", 2)[0] {
+				t.Fatalf("expected the rethrottle path unchanged, got %s", all[len(all)-1])
+			}
+		})
+	}
+}
+
+func TestRethrottlePassthroughWithoutScoping(t *testing.T) {
+	proxyHandler, capture := newProxyWithServer(t, config.Default())
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_reindex/node1:1/_rethrottle?requests_per_second=10", nil))
+	if path, _, _, _, _ := capture.snapshot(); rec.Code != http.StatusOK || path != "/_reindex/node1:1/_rethrottle" {
+		t.Fatalf("expected passthrough, got %d %s", rec.Code, path)
+	}
+}
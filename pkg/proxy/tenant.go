@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+// TenantResolver finds the tenant of an index, alias, or other tenant-scoped
+// name a request refers to in its path, query, or body, and the base name the
+// proxy rewrites it from. The request is nil for names read outside of a
+// request, such as by bootstrap. It is called on the goroutine serving the
+// request, including for every bulk action line, before anything is forwarded,
+// so it may read the request but must not modify it. Implementations must be
+// safe for concurrent use.
+type TenantResolver interface {
+	ResolveTenant(r *http.Request, index string) (tenant, baseIndex string, err error)
+}
+
+// WithTenantResolver replaces the tenant resolver selected by the
+// tenant_resolver config.
+func WithTenantResolver(resolver TenantResolver) Option {
+	return func(p *Proxy) {
+		p.resolver = resolver
+	}
+}
+
+// validTenantID restricts tenants taken from request metadata to names that are
+// safe to render into index and alias names.
+var validTenantID = regexp.MustCompile(`^[a-z0-9][a-z0-9_.]*$`)
+
+var errNoRequest = errors.New("tenant resolver needs a request")
+
+func newTenantResolver(cfg config.TenantResolver, p *Proxy) (TenantResolver, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Type)) {
+	case "", "regex":
+		return regexTenantResolver{p: p}, nil
+	case "header":
+		return headerTenantResolver{header: cfg.Header}, nil
+	case "basic_auth":
+		return basicAuthTenantResolver{}, nil
+	case "jwt":
+		return newJWTTenantResolver(cfg)
+	default:
+		return nil, fmt.Errorf("unknown tenant resolver %q", cfg.Type)
+	}
+}
+
+// regexTenantResolver parses the tenant and base index out of the index name
+// with the tenant regex.
+type regexTenantResolver struct {
+	p *Proxy
+}
+
+func (res regexTenantResolver) ResolveTenant(_ *http.Request, index string) (string, string, error) {
+	baseIndex, tenantID, err := res.p.matchTenantRegex(index)
+	return tenantID, baseIndex, err
+}
+
+// headerTenantResolver takes the tenant from a request header.
+type headerTenantResolver struct {
+	header string
+}
+
+func (res headerTenantResolver) ResolveTenant(r *http.Request, index string) (string, string, error) {
+	if r == nil {
+		return "", "", errNoRequest
+	}
+	tenantID := strings.TrimSpace(r.Header.Get(res.header))
+	if tenantID == "" {
+		return "", "", fmt.Errorf("missing %s header", res.header)
+	}
+	return checkTenantID(tenantID, index)
+}
+
+// basicAuthTenantResolver takes the tenant from the basic auth user name. The
+// password is left for the upstream to check.
+type basicAuthTenantResolver struct{}
+
+func (basicAuthTenantResolver) ResolveTenant(r *http.Request, index string) (string, string, error) {
+	if r == nil {
+		return "", "", errNoRequest
+	}
+	user, _, ok := r.BasicAuth()
+	if !ok || user == "" {
+		return "", "", errors.New("missing basic auth credentials")
+	}
+	return checkTenantID(user, index)
+}
+
+// authTenantResolver takes the tenant the proxy authenticated the request as,
+// with an API key or the basic auth front door.
+type authTenantResolver struct{}
+
+func (authTenantResolver) ResolveTenant(r *http.Request, index string) (string, string, error) {
+	state := requestStateFrom(r)
+	if state == nil || state.authTenant == "" {
+		return "", "", errors.New("request is not authenticated")
+	}
+	return checkTenantID(state.authTenant, index)
+}
+
+// jwtTenantResolver takes the tenant from a claim of the bearer token in the
+// Authorization header, once its signature and expiry are verified.
+type jwtTenantResolver struct {
+	claim     string
+	secret    []byte
+	publicKey *rsa.PublicKey
+	now       func() time.Time
+}
+
+func newJWTTenantResolver(cfg config.TenantResolver) (*jwtTenantResolver, error) {
+	res := &jwtTenantResolver{claim: cfg.Claim, now: time.Now}
+	if cfg.JWTSecret != "" {
+		res.secret = []byte(cfg.JWTSecret)
+		return res, nil
+	}
+	data, err := os.ReadFile(cfg.JWTPublicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read jwt public key: %w", err)
+	}
+	res.publicKey, err = parseRSAPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse jwt public key %s: %w", cfg.JWTPublicKeyPath, err)
+	}
+	return res, nil
+}
+
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+	return rsaKey, nil
+}
+
+func (res *jwtTenantResolver) ResolveTenant(r *http.Request, index string) (string, string, error) {
+	if r == nil {
+		return "", "", errNoRequest
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", "", errors.New("missing bearer token")
+	}
+	claims, err := res.verify(strings.TrimSpace(token))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid bearer token: %w", err)
+	}
+	tenantID, _ := claims[res.claim].(string)
+	if tenantID == "" {
+		return "", "", fmt.Errorf("bearer token has no %s claim", res.claim)
+	}
+	return checkTenantID(tenantID, index)
+}
+
+func (res *jwtTenantResolver) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	newHash, cryptoHash, err := jwtHash(header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case res.secret != nil && strings.HasPrefix(header.Alg, "HS"):
+		mac := hmac.New(newHash, res.secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, errors.New("signature mismatch")
+		}
+	case res.publicKey != nil && strings.HasPrefix(header.Alg, "RS"):
+		digest := newHash()
+		digest.Write(signed)
+		if err := rsa.VerifyPKCS1v15(res.publicKey, cryptoHash, digest.Sum(nil), signature); err != nil {
+			return nil, errors.New("signature mismatch")
+		}
+	default:
+		return nil, fmt.Errorf("unexpected algorithm %s", header.Alg)
+	}
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := float64(res.now().Unix())
+	if exp, ok := claims["exp"].(float64); ok && now >= exp {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, errors.New("token not valid yet")
+	}
+	return claims, nil
+}
+
+func jwtHash(alg string) (func() hash.Hash, crypto.Hash, error) {
+	switch strings.TrimLeft(alg, "HRS") {
+	case "256":
+		return sha256.New, crypto.SHA256, nil
+	case "384":
+		return sha512.New384, crypto.SHA384, nil
+	case "512":
+		return sha512.New, crypto.SHA512, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+// checkTenantID validates a tenant taken from request metadata. The index the
+// request names is the base index.
+func checkTenantID(tenantID, index string) (string, string, error) {
+	if !validTenantID.MatchString(tenantID) {
+		return "", "", fmt.Errorf("invalid tenant '%s'", tenantID)
+	}
+	return tenantID, index, nil
+}
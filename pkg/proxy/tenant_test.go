@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+func signHS256(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	signed := jwtSigningInput(t, "HS256", claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	signed := jwtSigningInput(t, "RS256", claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwtSigningInput(t *testing.T, alg string, claims map[string]interface{}) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func TestHeaderTenantResolver(t *testing.T) {
+	cfg := config.Default()
+	cfg.TenantResolver.Type = "header"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/products/_search", strings.NewReader(`{"query":{"match_all":{}}}`))
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, _, _, _ := capture.snapshot()
+	if path != "/alias-products-acme/_search" {
+		t.Fatalf("unexpected upstream path %q", path)
+	}
+
+	// The chunked body is read by the bulk rewriter, which resolves every
+	// action line from the request headers.
+	body := `{"index":{"_index":"orders","_id":"1"}}` + "\n" + `{"name":"a"}` + "\n"
+	req = httptest.NewRequest(http.MethodPost, "/_bulk", io.MultiReader(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	_, _, upstreamBody, _, _ := capture.snapshot()
+	bulkBody := string(upstreamBody)
+	if !strings.Contains(bulkBody, `"_index":"orders"`) || !strings.Contains(bulkBody, `"tenant_id":"acme"`) {
+		t.Fatalf("expected bulk body rewritten for tenant acme, got %s", bulkBody)
+	}
+
+	for _, tenant := range []string{"", "Acme", "a-b"} {
+		req = httptest.NewRequest(http.MethodPost, "/products/_search", strings.NewReader(`{}`))
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+		rec = httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("tenant %q: expected 400, got %d: %s", tenant, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestBasicAuthTenantResolver(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	cfg.TenantResolver.Type = "basic_auth"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/_doc/1", nil)
+	req.SetBasicAuth("acme", "secret")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, _, _, _ := capture.snapshot()
+	if path != "/orders-acme/_doc/1" {
+		t.Fatalf("unexpected upstream path %q", path)
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/_doc/1", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "missing basic auth credentials") {
+		t.Fatalf("expected missing credentials error, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestJWTTenantResolverHMAC(t *testing.T) {
+	cfg := config.Default()
+	cfg.TenantResolver.Type = "jwt"
+	cfg.TenantResolver.JWTSecret = "s3cret"
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	future := float64(time.Now().Add(time.Hour).Unix())
+
+	cases := []struct {
+		name    string
+		token   string
+		status  int
+		wantErr string
+	}{
+		{name: "valid", token: signHS256(t, "s3cret", map[string]interface{}{"tenant": "acme", "exp": future}), status: http.StatusOK},
+		{name: "wrong secret", token: signHS256(t, "other", map[string]interface{}{"tenant": "acme"}), status: http.StatusBadRequest, wantErr: "signature mismatch"},
+		{name: "expired", token: signHS256(t, "s3cret", map[string]interface{}{"tenant": "acme", "exp": 1}), status: http.StatusBadRequest, wantErr: "token expired"},
+		{name: "missing claim", token: signHS256(t, "s3cret", map[string]interface{}{"sub": "acme"}), status: http.StatusBadRequest, wantErr: "no tenant claim"},
+		{name: "unsigned", token: jwtSigningInput(t, "none", map[string]interface{}{"tenant": "acme"}) + ".", status: http.StatusBadRequest, wantErr: "unsupported algorithm"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/products/_search", strings.NewReader(`{}`))
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			if tc.wantErr != "" && !strings.Contains(rec.Body.String(), tc.wantErr) {
+				t.Fatalf("expected error %q, got %s", tc.wantErr, rec.Body.String())
+			}
+		})
+	}
+	path, _, _, _, count := capture.snapshot()
+	if count != 1 || path != "/alias-products-acme/_search" {
+		t.Fatalf("expected one upstream search for acme, got %d to %q", count, path)
+	}
+}
+
+func TestJWTTenantResolverRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	resolver, err := newJWTTenantResolver(config.TenantResolver{Claim: "org", JWTPublicKeyPath: keyPath})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/_search", nil)
+	req.Header.Set("Authorization", "Bearer "+signRS256(t, key, map[string]interface{}{"org": "acme"}))
+	tenantID, baseIndex, err := resolver.ResolveTenant(req, "logs")
+	if err != nil || tenantID != "acme" || baseIndex != "logs" {
+		t.Fatalf("unexpected resolution: %q %q %v", tenantID, baseIndex, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+signHS256(t, "secret", map[string]interface{}{"org": "acme"}))
+	if _, _, err := resolver.ResolveTenant(req, "logs"); err == nil || !strings.Contains(err.Error(), "unexpected algorithm HS256") {
+		t.Fatalf("expected HMAC token to be rejected, got %v", err)
+	}
+
+	if _, err := newJWTTenantResolver(config.TenantResolver{Claim: "org", JWTPublicKeyPath: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Fatal("expected error for missing public key")
+	}
+}
+
+type staticTenantResolver struct{}
+
+func (staticTenantResolver) ResolveTenant(r *http.Request, index string) (string, string, error) {
+	if index == "forbidden" {
+		return "", "", errors.New("index is not available")
+	}
+	return "fixed", strings.TrimPrefix(index, "app-"), nil
+}
+
+func TestWithTenantResolver(t *testing.T) {
+	capture := &capturedRequest{}
+	proxyHandler := newProxyWithUpstream(t, config.Default(), http.HandlerFunc(capture.handler), WithTenantResolver(staticTenantResolver{}))
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/app-orders/_search", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path, _, _, _, _ := capture.snapshot()
+	if path != "/alias-orders-fixed/_search" {
+		t.Fatalf("unexpected upstream path %q", path)
+	}
+
+	rec = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/forbidden/_search", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "index is not available") {
+		t.Fatalf("expected resolver error, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReservedTenants(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	for _, path := range []string{"/orders-system/_search", "/orders-ALL/_search"} {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), string(codeTenantReserved)) {
+			t.Fatalf("%s: expected %s, got %d: %s", path, codeTenantReserved, rec.Code, rec.Body.String())
+		}
+	}
+	if _, _, _, _, count := capture.snapshot(); count != 0 {
+		t.Fatalf("expected no upstream call, got %d", count)
+	}
+
+	cfg.TenantResolver.Type = "header"
+	proxyHandler, _ = newProxyWithServer(t, cfg)
+	req := httptest.NewRequest(http.MethodPost, "/products/_search", strings.NewReader(`{}`))
+	req.Header.Set("X-Tenant-ID", "default")
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), string(codeTenantReserved)) {
+		t.Fatalf("expected %s for a reserved header tenant, got %d: %s", codeTenantReserved, rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeoutHeadroom is left between a client's ?timeout= and the route deadline
+// so that the upstream can still return its partial, timed out response.
+const timeoutHeadroom = time.Second
+
+// byQueryEndpoints are long-running writes bounded like bulk requests.
+var byQueryEndpoints = map[string]bool{
+	"_bulk": true, "_reindex": true, "_update_by_query": true, "_delete_by_query": true,
+}
+
+// routeTimeout returns how long the upstream may take to answer the request.
+// Zero means no deadline.
+func (p *Proxy) routeTimeout(r *http.Request, segments []string, passthrough bool) time.Duration {
+	seconds := p.cfg.Timeouts.DefaultSeconds
+	switch {
+	case passthrough:
+		seconds = p.cfg.Timeouts.PassthroughSeconds
+	case isByQueryRequest(segments):
+		seconds = p.cfg.Timeouts.BulkSeconds
+	case !isWriteRequest(r, segments):
+		seconds = p.cfg.Timeouts.SearchSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func isByQueryRequest(segments []string) bool {
+	for i := 0; i < len(segments) && i < 2; i++ {
+		if byQueryEndpoints[segments[i]] {
+			return true
+		}
+	}
+	return false
+}
+
+// withRouteTimeout bounds the upstream call of the request by its route
+// timeout. A client ?timeout= longer than the route allows is lowered so that
+// the upstream gives up, and answers, before the proxy does. The returned
+// cancel must be called once the request was served.
+func (p *Proxy) withRouteTimeout(r *http.Request, segments []string, passthrough bool) (*http.Request, context.CancelFunc) {
+	timeout := p.routeTimeout(r, segments, passthrough)
+	if timeout <= 0 {
+		return r, func() {}
+	}
+	clampTimeoutParam(r, timeout)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	if state := requestStateFrom(r); state != nil {
+		state.timeout = timeout
+	}
+	return r.WithContext(ctx), cancel
+}
+
+// clampTimeoutParam lowers the request's timeout parameter to fit within
+// limit, keeping timeoutHeadroom for the upstream's response when the limit
+// allows it. Parameters that do not parse are left for the upstream to reject.
+func clampTimeoutParam(r *http.Request, limit time.Duration) {
+	query := r.URL.Query()
+	raw := query.Get("timeout")
+	if raw == "" {
+		return
+	}
+	requested, ok := parseTimeValue(raw)
+	if !ok {
+		return
+	}
+	allowed := limit
+	if allowed > 2*timeoutHeadroom {
+		allowed -= timeoutHeadroom
+	}
+	if requested >= 0 && requested <= allowed {
+		return
+	}
+	setQueryParam(r, query, "timeout", strconv.FormatInt(allowed.Milliseconds(), 10)+"ms")
+}
+
+// timeUnits are the Elasticsearch time units, longest suffix first.
+var timeUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"nanos", time.Nanosecond},
+	{"micros", time.Microsecond},
+	{"ms", time.Millisecond},
+	{"s", time.Second},
+	{"m", time.Minute},
+	{"h", time.Hour},
+	{"d", 24 * time.Hour},
+}
+
+// parseTimeValue parses an Elasticsearch time value such as "30s" or "500ms".
+// "-1" means no timeout and is returned as a negative duration.
+func parseTimeValue(raw string) (time.Duration, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "-1" {
+		return -1, true
+	}
+	for _, unit := range timeUnits {
+		if !strings.HasSuffix(raw, unit.suffix) {
+			continue
+		}
+		value, err := strconv.ParseInt(strings.TrimSuffix(raw, unit.suffix), 10, 64)
+		if err != nil || value < 0 {
+			return 0, false
+		}
+		return time.Duration(value) * unit.unit, true
+	}
+	return 0, false
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestRouteTimeoutAnswersGatewayTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	})
+	cfg := config.Default()
+	cfg.Timeouts.SearchSeconds = 1
+	proxyHandler := newProxyWithUpstream(t, cfg, upstream)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusGatewayTimeout || !strings.Contains(rec.Body.String(), "timeout_exception") {
+		t.Fatalf("expected 504 timeout_exception, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the deadline to stop the request, took %s", elapsed)
+	}
+}
+
+func TestRouteTimeoutClampsTimeoutParam(t *testing.T) {
+	cfg := config.Default()
+	cfg.Timeouts.SearchSeconds = 10
+	cfg.Timeouts.BulkSeconds = 30
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   string
+	}{
+		{method: http.MethodPost, path: "/products-tenant1/_search?timeout=5s", body: `{}`, want: "timeout=5s"},
+		{method: http.MethodPost, path: "/products-tenant1/_search?timeout=1m", body: `{}`, want: "timeout=9000ms"},
+		{method: http.MethodPost, path: "/products-tenant1/_search?timeout=-1", body: `{}`, want: "timeout=9000ms"},
+		{method: http.MethodPost, path: "/_bulk?timeout=10m", body: "{\"index\":{\"_index\":\"products-tenant1\"}}\n{\"a\":1}\n", want: "timeout=29000ms"},
+		{method: http.MethodPost, path: "/products-tenant1/_search?timeout=soon", body: `{}`, want: "timeout=soon"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %s, got %d: %s", tt.path, rec.Code, rec.Body.String())
+		}
+		if _, query, _, _, _ := capture.snapshot(); !strings.Contains(query, tt.want) {
+			t.Fatalf("expected %s upstream query to contain %q, got %q", tt.path, tt.want, query)
+		}
+	}
+}
+
+func TestRouteTimeoutClassification(t *testing.T) {
+	cfg := config.Default()
+	cfg.Timeouts = config.Timeouts{SearchSeconds: 1, BulkSeconds: 2, PassthroughSeconds: 3, DefaultSeconds: 4}
+	proxyHandler, _ := newProxyWithServer(t, cfg)
+
+	tests := []struct {
+		method      string
+		path        string
+		passthrough bool
+		want        time.Duration
+	}{
+		{method: http.MethodGet, path: "/products-tenant1/_doc/1", want: time.Second},
+		{method: http.MethodPost, path: "/products-tenant1/_msearch", want: time.Second},
+		{method: http.MethodPost, path: "/_bulk", want: 2 * time.Second},
+		{method: http.MethodPost, path: "/products-tenant1/_update_by_query", want: 2 * time.Second},
+		{method: http.MethodGet, path: "/_cluster/health", passthrough: true, want: 3 * time.Second},
+		{method: http.MethodPut, path: "/products-tenant1/_doc/1", want: 4 * time.Second},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := proxyHandler.routeTimeout(r, splitPath(r.URL.Path), tt.passthrough); got != tt.want {
+			t.Fatalf("expected %s %s to get %s, got %s", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestParseTimeValue(t *testing.T) {
+	tests := map[string]time.Duration{
+		"500ms":    500 * time.Millisecond,
+		"30s":      30 * time.Second,
+		"2m":       2 * time.Minute,
+		"1h":       time.Hour,
+		"1d":       24 * time.Hour,
+		"10micros": 10 * time.Microsecond,
+		"-1":       -1,
+	}
+	for raw, want := range tests {
+		if got, ok := parseTimeValue(raw); !ok || got != want {
+			t.Fatalf("expected %q to parse as %s, got %s %v", raw, want, got, ok)
+		}
+	}
+	for _, raw := range []string{"", "5", "1.5s", "-5s", "soon"} {
+		if _, ok := parseTimeValue(raw); ok {
+			t.Fatalf("expected %q not to parse", raw)
+		}
+	}
+}
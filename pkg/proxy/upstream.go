@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"es-tmnt/pkg/config"
+)
+
+// upstreamClient sends the requests the proxy issues on its own behalf, such as
+// alias maintenance, to the upstream cluster. direct points a forwarded request
+// at the cluster.
+type upstreamClient struct {
+	base   *url.URL
+	client *http.Client
+	direct func(*http.Request)
+}
+
+func newUpstreamClient(base *url.URL) *upstreamClient {
+	return &upstreamClient{
+		base:   base,
+		client: &http.Client{},
+		direct: httputil.NewSingleHostReverseProxy(base).Director,
+	}
+}
+
+// newNamedUpstreams returns a client for each of upstreams, keyed by name.
+func newNamedUpstreams(upstreams []config.Upstream) (map[string]*upstreamClient, error) {
+	clients := make(map[string]*upstreamClient, len(upstreams))
+	for _, upstream := range upstreams {
+		parsed, err := url.Parse(upstream.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parse upstream %s url: %w", upstream.Name, err)
+		}
+		clients[strings.TrimSpace(upstream.Name)] = newUpstreamClient(parsed)
+	}
+	return clients, nil
+}
+
+// newTenantUpstreams maps the tenants whose settings name one of upstreams to
+// the client of that cluster. Tenants not in the map use upstream_url.
+func newTenantUpstreams(upstreams map[string]*upstreamClient, tenants map[string]config.TenantSettings) (map[string]*upstreamClient, error) {
+	routes := make(map[string]*upstreamClient)
+	for tenantID, settings := range tenants {
+		if settings.Upstream == "" {
+			continue
+		}
+		client, ok := upstreams[settings.Upstream]
+		if !ok {
+			return nil, fmt.Errorf("tenant %s: unknown upstream %s", tenantID, settings.Upstream)
+		}
+		routes[strings.TrimSpace(tenantID)] = client
+	}
+	return routes, nil
+}
+
+// upstreamFor returns the client of the cluster tenantID is routed to.
+func (p *Proxy) upstreamFor(tenantID string) *upstreamClient {
+	if upstream, ok := p.tenantUpstreams[tenantID]; ok {
+		return upstream
+	}
+	return p.upstream
+}
+
+// requestUpstream returns the client of the cluster r is forwarded to: that of
+// its tenant once one is resolved, and upstream_url otherwise.
+func (p *Proxy) requestUpstream(r *http.Request) *upstreamClient {
+	if state := requestStateFrom(r); state != nil && state.upstream != nil {
+		return state.upstream
+	}
+	return p.upstream
+}
+
+// tenantAliases returns the alias manager of the cluster tenantID is routed to.
+func (p *Proxy) tenantAliases(tenantID string) *aliasManager {
+	upstream := p.upstreamFor(tenantID)
+	if upstream == p.upstream {
+		return p.aliases
+	}
+	return newAliasManager(upstream)
+}
+
+// routeTenant records on r the cluster tenantID is routed to. A request is
+// forwarded to a single cluster, so one naming tenants of different clusters
+// is rejected.
+func (p *Proxy) routeTenant(r *http.Request, tenantID string) error {
+	state := requestStateFrom(r)
+	if state == nil || len(p.tenantUpstreams) == 0 {
+		return nil
+	}
+	upstream := p.upstreamFor(tenantID)
+	if state.upstream != nil && state.upstream != upstream {
+		return withCode(codeMultipleTenants, fmt.Errorf("tenant '%s' is routed to a different upstream cluster than the other tenants of the request", tenantID))
+	}
+	state.upstream = upstream
+	return nil
+}
+
+// do sends a request to the upstream cluster with the caller's credentials and
+// request id. pathValue may carry a query string.
+func (c *upstreamClient) do(ctx context.Context, header http.Header, method, pathValue string, body []byte) (*http.Response, error) {
+	pathValue, rawQuery, _ := strings.Cut(pathValue, "?")
+	target := *c.base
+	target.Path = strings.TrimSuffix(target.Path, "/") + pathValue
+	target.RawPath = ""
+	target.RawQuery = rawQuery
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if auth := header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	if id := header.Get(opaqueIDHeader); id != "" {
+		req.Header.Set(opaqueIDHeader, id)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.client.Do(req)
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"es-tmnt/pkg/config"
+)
+
+// pathRecorder answers every request with an empty JSON object and records
+// the method and path it was sent.
+type pathRecorder struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (p *pathRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, r.Body)
+	p.mu.Lock()
+	p.paths = append(p.paths, r.Method+" "+r.URL.Path)
+	p.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = io.WriteString(w, `{}`)
+}
+
+func (p *pathRecorder) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	paths := p.paths
+	p.paths = nil
+	return paths
+}
+
+func newMultiUpstreamProxy(t *testing.T, cfg config.Config) (*Proxy, *pathRecorder, *pathRecorder) {
+	t.Helper()
+	primary, eu := &pathRecorder{}, &pathRecorder{}
+	server := httptest.NewServer(eu)
+	t.Cleanup(server.Close)
+	cfg.Upstreams = []config.Upstream{{Name: "eu", URL: server.URL}}
+	cfg.Tenants = map[string]config.TenantSettings{"tenant2": {Upstream: "eu"}}
+	return newProxyWithUpstream(t, cfg, primary), primary, eu
+}
+
+func TestTenantUpstreams(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "index-per-tenant"
+	cfg.IndexPerTenant.IndexTemplate = "{{.index}}-{{.tenant}}"
+	proxyHandler, primary, eu := newMultiUpstreamProxy(t, cfg)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		wantStatus  int
+		wantPrimary string
+		wantEU      string
+	}{
+		{name: "default upstream", method: http.MethodPost, path: "/orders-tenant1/_search", body: `{}`, wantStatus: http.StatusOK, wantPrimary: "POST /orders-tenant1/_search"},
+		{name: "tenant upstream", method: http.MethodPost, path: "/orders-tenant2/_search", body: `{}`, wantStatus: http.StatusOK, wantEU: "POST /orders-tenant2/_search"},
+		{name: "tenant upstream bulk", method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"orders-tenant2\",\"_id\":\"1\"}}\n{\"a\":1}\n", wantStatus: http.StatusOK, wantEU: "POST /_bulk"},
+		{name: "bulk across upstreams", method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"orders-tenant1\",\"_id\":\"1\"}}\n{\"a\":1}\n{\"index\":{\"_index\":\"orders-tenant2\",\"_id\":\"1\"}}\n{\"a\":1}\n", wantStatus: http.StatusBadRequest},
+		{name: "unscoped path", method: http.MethodGet, path: "/_cluster/health", wantStatus: http.StatusOK, wantPrimary: "GET /_cluster/health"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusBadRequest && !strings.Contains(rec.Body.String(), string(codeMultipleTenants)) {
+				t.Fatalf("expected %s, got %s", codeMultipleTenants, rec.Body.String())
+			}
+			gotPrimary, gotEU := strings.Join(primary.take(), ","), strings.Join(eu.take(), ",")
+			if gotPrimary != tt.wantPrimary || gotEU != tt.wantEU {
+				t.Fatalf("expected primary %q and eu %q, got %q and %q", tt.wantPrimary, tt.wantEU, gotPrimary, gotEU)
+			}
+		})
+	}
+}
+
+func TestTenantUpstreamAliases(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	proxyHandler, primary, eu := newMultiUpstreamProxy(t, cfg)
+
+	req := httptest.NewRequest(http.MethodPut, "/orders-tenant2", nil)
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := primary.take(); len(got) != 0 {
+		t.Fatalf("expected nothing sent to the default upstream, got %v", got)
+	}
+	if got := strings.Join(eu.take(), ","); got != "PUT /orders,POST /_aliases" {
+		t.Fatalf("expected the index and alias created on the tenant upstream, got %q", got)
+	}
+}
+
+func TestReadyzProbesTenantUpstreams(t *testing.T) {
+	cfg := config.Default()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	cfg.Upstreams = []config.Upstream{{Name: "eu", URL: down.URL}}
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{}`))
+	rec := httptest.NewRecorder()
+	proxyHandler.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not ready with an upstream down, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Upstreams map[string]upstreamReadiness `json:"upstreams"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode readiness: %v", err)
+	}
+	if eu := body.Upstreams["eu"]; eu.Status != "unavailable" || !eu.Required {
+		t.Fatalf("unexpected eu status %+v", eu)
+	}
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// joinPath returns the absolute path of segments, skipping empty ones. Paths
+// are normalized before routing, so unlike path.Join it need not clean dot
+// segments, and it builds the path in a single allocation.
+func joinPath(segments []string) string {
+	size := 0
+	for _, segment := range segments {
+		if segment != "" {
+			size += len(segment) + 1
+		}
+	}
+	if size == 0 {
+		return "/"
+	}
+	var b strings.Builder
+	b.Grow(size)
+	for _, segment := range segments {
+		if segment != "" {
+			b.WriteByte('/')
+			b.WriteString(segment)
+		}
+	}
+	return b.String()
+}
+
+// replaceFirstSegment returns pathValue with its first segment replaced, and
+// whether that segment was original. The rest of the path is sliced rather
+// than split and joined again; paths that are not already in joined form, with
+// repeated or trailing slashes, are rebuilt with joinPath.
+func replaceFirstSegment(pathValue, original, replacement string) (string, bool) {
+	trimmed := strings.TrimLeft(pathValue, "/")
+	first, rest, hasRest := strings.Cut(trimmed, "/")
+	if first != original || first == "" {
+		return pathValue, false
+	}
+	if hasRest && (rest == "" || rest[0] == '/' || strings.HasSuffix(rest, "/") || strings.Contains(rest, "//")) {
+		segments := splitPath(pathValue)
+		segments[0] = replacement
+		return joinPath(segments), true
+	}
+	if !hasRest {
+		if replacement == "" {
+			return "/", true
+		}
+		return "/" + replacement, true
+	}
+	if replacement == "" {
+		return "/" + rest, true
+	}
+	return "/" + replacement + "/" + rest, true
+}
+
+// setQueryParam sets key to value in query, re-encoding the query of r only
+// when key did not already hold just that value. It reports whether the query
+// changed.
+func setQueryParam(r *http.Request, query url.Values, key, value string) bool {
+	if current, ok := query[key]; ok && len(current) == 1 && current[0] == value {
+		return false
+	}
+	query.Set(key, value)
+	r.URL.RawQuery = query.Encode()
+	return true
+}
+
+// deleteQueryParams removes keys from the query of r, leaving RawQuery
+// untouched when none of them is present. It reports whether the query
+// changed.
+func deleteQueryParams(r *http.Request, keys ...string) bool {
+	if !mayContainQueryKey(r.URL.RawQuery, keys) {
+		return false
+	}
+	query := r.URL.Query()
+	changed := false
+	for _, key := range keys {
+		if _, ok := query[key]; ok {
+			query.Del(key)
+			changed = true
+		}
+	}
+	if changed {
+		r.URL.RawQuery = query.Encode()
+	}
+	return changed
+}
+
+// mayContainQueryKey reports whether rawQuery may name one of keys, without
+// parsing it. Escaped queries are assumed to, since their keys may be encoded.
+func mayContainQueryKey(rawQuery string, keys []string) bool {
+	if rawQuery == "" {
+		return false
+	}
+	if strings.Contains(rawQuery, "%") {
+		return true
+	}
+	for _, key := range keys {
+		if strings.Contains(rawQuery, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+)
+
+func TestJoinPathMatchesPathJoin(t *testing.T) {
+	cases := [][]string{
+		nil,
+		{""},
+		{"orders"},
+		{"orders", "_doc", "1"},
+		{"orders", "", "_search"},
+		{"", "_bulk"},
+		{"orders-tenant1", "_doc", "a%2Fb"},
+	}
+	for _, segments := range cases {
+		want := "/" + path.Join(segments...)
+		if want == "/." {
+			want = "/"
+		}
+		if got := joinPath(segments); got != want {
+			t.Fatalf("joinPath(%q) = %q, want %q", segments, got, want)
+		}
+	}
+}
+
+func TestReplaceFirstSegment(t *testing.T) {
+	cases := []struct {
+		path        string
+		original    string
+		replacement string
+		want        string
+		ok          bool
+	}{
+		{path: "/orders-tenant1/_search", original: "orders-tenant1", replacement: "alias-orders-tenant1", want: "/alias-orders-tenant1/_search", ok: true},
+		{path: "/orders-tenant1", original: "orders-tenant1", replacement: "orders", want: "/orders", ok: true},
+		{path: "/orders-tenant1/_doc/1/", original: "orders-tenant1", replacement: "orders", want: "/orders/_doc/1", ok: true},
+		{path: "/orders-tenant1//_search", original: "orders-tenant1", replacement: "orders", want: "/orders/_search", ok: true},
+		{path: "/orders-tenant1/_search", original: "orders-tenant2", replacement: "orders", want: "/orders-tenant1/_search"},
+		{path: "/", original: "", replacement: "orders", want: "/"},
+	}
+	for _, tc := range cases {
+		got, ok := replaceFirstSegment(tc.path, tc.original, tc.replacement)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("replaceFirstSegment(%q) = %q, %t, want %q, %t", tc.path, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestQueryParamsUntouchedWithoutChanges(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/orders-tenant1/_doc/1?routing=tenant1&_source=b,a", nil)
+	raw := r.URL.RawQuery
+	if deleteQueryParams(r, getOnlyQueryParams...) || r.URL.RawQuery != raw {
+		t.Fatalf("expected the query to be kept, got %q", r.URL.RawQuery)
+	}
+	if setQueryParam(r, r.URL.Query(), "routing", "tenant1") || r.URL.RawQuery != raw {
+		t.Fatalf("expected the query to be kept, got %q", r.URL.RawQuery)
+	}
+	if !setQueryParam(r, r.URL.Query(), "routing", "tenant2") || r.URL.Query().Get("routing") != "tenant2" {
+		t.Fatalf("expected routing to be replaced, got %q", r.URL.RawQuery)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/orders-tenant1/_doc/1?realtime=false&routing=tenant1", nil)
+	if !deleteQueryParams(r, getOnlyQueryParams...) || r.URL.RawQuery != "routing=tenant1" {
+		t.Fatalf("expected realtime to be removed, got %q", r.URL.RawQuery)
+	}
+}
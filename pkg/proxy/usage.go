@@ -0,0 +1,327 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+// tenantUsage holds the cumulative usage counters of a tenant.
+type tenantUsage struct {
+	Searches         int64 `json:"searches"`
+	DocumentsIndexed int64 `json:"documents_indexed"`
+	Deletes          int64 `json:"deletes"`
+	BytesIn          int64 `json:"bytes_in"`
+	BytesOut         int64 `json:"bytes_out"`
+}
+
+func (u *tenantUsage) add(other tenantUsage) {
+	u.Searches += other.Searches
+	u.DocumentsIndexed += other.DocumentsIndexed
+	u.Deletes += other.Deletes
+	u.BytesIn += other.BytesIn
+	u.BytesOut += other.BytesOut
+}
+
+// usageTracker accumulates tenant usage in memory. It is safe for concurrent use.
+type usageTracker struct {
+	mu      sync.Mutex
+	tenants map[string]*tenantUsage
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{tenants: make(map[string]*tenantUsage)}
+}
+
+func (t *usageTracker) add(tenantID string, usage tenantUsage) {
+	if tenantID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current, ok := t.tenants[tenantID]
+	if !ok {
+		current = &tenantUsage{}
+		t.tenants[tenantID] = current
+	}
+	current.add(usage)
+}
+
+func (t *usageTracker) get(tenantID string) tenantUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, ok := t.tenants[tenantID]; ok {
+		return *current
+	}
+	return tenantUsage{}
+}
+
+func (t *usageTracker) snapshot() map[string]tenantUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	snapshot := make(map[string]tenantUsage, len(t.tenants))
+	for tenantID, usage := range t.tenants {
+		snapshot[tenantID] = *usage
+	}
+	return snapshot
+}
+
+// usageSink persists snapshots of the usage counters.
+type usageSink interface {
+	Flush(snapshot map[string]tenantUsage) error
+}
+
+func newUsageSink(cfg config.Usage, upstream *upstreamClient) (usageSink, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Sink)) {
+	case "":
+		return nil, nil
+	case "file":
+		return &fileUsageSink{path: cfg.Path}, nil
+	case "index":
+		return &indexUsageSink{upstream: upstream, index: cfg.Index, timeout: usageFlushTimeout}, nil
+	default:
+		return nil, fmt.Errorf("unsupported usage sink %q", cfg.Sink)
+	}
+}
+
+// fileUsageSink writes the counters of every tenant to a JSON file, replacing
+// the previous snapshot.
+type fileUsageSink struct {
+	path string
+}
+
+func (s *fileUsageSink) Flush(snapshot map[string]tenantUsage) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("write usage file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write usage file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write usage file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("write usage file: %w", err)
+	}
+	return nil
+}
+
+// load reads the counters written by a previous run, so they stay cumulative
+// across restarts. A missing file is not an error.
+func (s *fileUsageSink) load() (map[string]tenantUsage, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read usage file: %w", err)
+	}
+	var snapshot map[string]tenantUsage
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("parse usage file: %w", err)
+	}
+	return snapshot, nil
+}
+
+// indexUsageSink indexes one document per tenant, keyed by tenant id, holding
+// the tenant's current counters.
+type indexUsageSink struct {
+	upstream *upstreamClient
+	index    string
+	timeout  time.Duration
+}
+
+// usageFlushTimeout bounds the upstream write of a usage snapshot.
+const usageFlushTimeout = 10 * time.Second
+
+func (s *indexUsageSink) Flush(snapshot map[string]tenantUsage) error {
+	if len(snapshot) == 0 {
+		return nil
+	}
+	timestamp := time.Now().UTC()
+	var body bytes.Buffer
+	for tenantID, usage := range snapshot {
+		action, err := json.Marshal(map[string]interface{}{"index": map[string]string{"_id": tenantID}})
+		if err != nil {
+			return err
+		}
+		doc, err := json.Marshal(struct {
+			Timestamp time.Time `json:"@timestamp"`
+			Tenant    string    `json:"tenant"`
+			tenantUsage
+		}{timestamp, tenantID, usage})
+		if err != nil {
+			return err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	resp, err := s.upstream.do(ctx, nil, http.MethodPost, "/"+url.PathEscape(s.index)+"/_bulk", body.Bytes())
+	if err != nil {
+		return fmt.Errorf("index usage: %w", err)
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("index usage: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// usageFlusher stops the background usage flush. Stopping flushes the
+// counters a last time so nothing counted since the previous tick is lost.
+type usageFlusher struct {
+	stop chan struct{}
+	done chan error
+	once sync.Once
+	err  error
+}
+
+// close stops the flush loop and returns the error of the final flush. It may
+// be called more than once.
+func (f *usageFlusher) close() error {
+	f.once.Do(func() {
+		close(f.stop)
+		f.err = <-f.done
+	})
+	return f.err
+}
+
+// startUsageFlush restores counters from a file sink and flushes them to sink
+// every interval until the proxy is closed.
+func (p *Proxy) startUsageFlush(sink usageSink, interval time.Duration) error {
+	if fileSink, ok := sink.(*fileUsageSink); ok {
+		snapshot, err := fileSink.load()
+		if err != nil {
+			return err
+		}
+		for tenantID, usage := range snapshot {
+			p.usage.add(tenantID, usage)
+		}
+	}
+	flusher := &usageFlusher{stop: make(chan struct{}), done: make(chan error, 1)}
+	p.usageFlush = flusher
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := sink.Flush(p.usage.snapshot()); err != nil {
+					log.Printf("usage: %v", err)
+				}
+			case <-flusher.stop:
+				flusher.done <- sink.Flush(p.usage.snapshot())
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// usageRecord is the usage of a single request. It is added to the tenant's
+// counters once the response body has been sent to the client.
+type usageRecord struct {
+	tenant string
+	usage  tenantUsage
+}
+
+// setUsage attributes the request to tenantID with the operation counts in
+// usage. Request and response bytes are added when the response completes.
+func (p *Proxy) setUsage(r *http.Request, tenantID string, usage tenantUsage) *usageRecord {
+	if p.usage == nil {
+		return nil
+	}
+	state := requestStateFrom(r)
+	if state == nil {
+		return nil
+	}
+	state.usage = &usageRecord{tenant: tenantID, usage: usage}
+	return state.usage
+}
+
+// countRequestBytes counts the request body as handlers read it.
+func (p *Proxy) countRequestBytes(r *http.Request) {
+	if p.usage == nil || r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	state := requestStateFrom(r)
+	if state == nil {
+		return
+	}
+	state.bytesIn = &countingBody{ReadCloser: r.Body}
+	r.Body = state.bytesIn
+}
+
+// recordUsage wraps the response body so the request's usage is recorded once
+// the client has received it. Operation counts only apply to successful
+// responses; bytes are always counted.
+func (p *Proxy) recordUsage(resp *http.Response, state *requestState) {
+	record := state.usage
+	resp.Body = &countingBody{
+		ReadCloser: resp.Body,
+		onClose: func(bytesOut int64) {
+			usage := record.usage
+			if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+				usage = tenantUsage{}
+			}
+			if state.bytesIn != nil {
+				usage.BytesIn = state.bytesIn.count()
+			}
+			usage.BytesOut = bytesOut
+			p.usage.add(record.tenant, usage)
+		},
+	}
+}
+
+// countingBody counts the bytes read through it and reports the total once when
+// closed.
+type countingBody struct {
+	io.ReadCloser
+	n       atomic.Int64
+	once    sync.Once
+	onClose func(n int64)
+}
+
+func (c *countingBody) Read(b []byte) (int, error) {
+	n, err := c.ReadCloser.Read(b)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c *countingBody) Close() error {
+	err := c.ReadCloser.Close()
+	if c.onClose != nil {
+		c.once.Do(func() { c.onClose(c.n.Load()) })
+	}
+	return err
+}
+
+func (c *countingBody) count() int64 {
+	return c.n.Load()
+}
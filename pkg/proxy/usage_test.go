@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+)
+
+func TestUsageCountsTenantOperations(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	const response = `{"acknowledged":true}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, response))
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodPost, path: "/products-tenant1/_search", body: `{"query":{"match_all":{}}}`},
+		{method: http.MethodPut, path: "/products-tenant1/_doc/1", body: `{"name":"shoe"}`},
+		{method: http.MethodPost, path: "/products-tenant1/_delete/1"},
+		{method: http.MethodPost, path: "/_bulk", body: "{\"index\":{\"_index\":\"products-tenant2\",\"_id\":\"1\"}}\n{\"name\":\"a\"}\n{\"create\":{\"_index\":\"products-tenant2\",\"_id\":\"2\"}}\n{\"name\":\"b\"}\n{\"delete\":{\"_index\":\"products-tenant2\",\"_id\":\"3\"}}\n"},
+	}
+	bytesIn := map[string]int64{}
+	for _, tt := range requests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected 200, got %d: %s", tt.method, tt.path, rec.Code, rec.Body.String())
+		}
+		tenantID := "tenant1"
+		if tt.path == "/_bulk" {
+			tenantID = "tenant2"
+		}
+		bytesIn[tenantID] += int64(len(tt.body))
+	}
+
+	want := map[string]tenantUsage{
+		"tenant1": {Searches: 1, DocumentsIndexed: 1, Deletes: 1, BytesIn: bytesIn["tenant1"], BytesOut: 3 * int64(len(response))},
+		"tenant2": {DocumentsIndexed: 2, Deletes: 1, BytesIn: bytesIn["tenant2"], BytesOut: int64(len(response))},
+	}
+	for tenantID, expected := range want {
+		if got := proxyHandler.usage.get(tenantID); got != expected {
+			t.Fatalf("%s: expected usage %+v, got %+v", tenantID, expected, got)
+		}
+	}
+}
+
+func TestUsageSkipsOperationsOnFailure(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	const response = `{"error":"boom"}`
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusInternalServerError, response))
+
+	body := `{"query":{"match_all":{}}}`
+	req := httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, req)
+
+	want := tenantUsage{BytesIn: int64(len(body)), BytesOut: int64(len(response))}
+	if got := proxyHandler.usage.get("tenant1"); got != want {
+		t.Fatalf("expected usage %+v, got %+v", want, got)
+	}
+}
+
+func TestAdminUsageEndpoint(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{}`))
+	proxyHandler.usage.add("tenant1", tenantUsage{Searches: 2, BytesIn: 10})
+	proxyHandler.usage.add("tenant2", tenantUsage{Deletes: 1})
+	admin := proxyHandler.AdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/usage?tenant=tenant1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var single struct {
+		Tenant string      `json:"tenant"`
+		Usage  tenantUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &single); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if single.Tenant != "tenant1" || single.Usage != (tenantUsage{Searches: 2, BytesIn: 10}) {
+		t.Fatalf("unexpected tenant usage: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/usage", nil))
+	var all struct {
+		Tenants map[string]tenantUsage `json:"tenants"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &all); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(all.Tenants) != 2 || all.Tenants["tenant2"].Deletes != 1 {
+		t.Fatalf("unexpected usage report: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/usage", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected healthz 200, got %d", rec.Code)
+	}
+}
+
+func TestFileUsageSinkRoundTrip(t *testing.T) {
+	sink := &fileUsageSink{path: filepath.Join(t.TempDir(), "usage.json")}
+	snapshot, err := sink.load()
+	if err != nil || snapshot != nil {
+		t.Fatalf("expected no snapshot for a missing file, got %v, %v", snapshot, err)
+	}
+	want := map[string]tenantUsage{"tenant1": {Searches: 3, BytesOut: 42}}
+	if err := sink.Flush(want); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	snapshot, err = sink.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(snapshot) != 1 || snapshot["tenant1"] != want["tenant1"] {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+}
+
+func TestIndexUsageSinkFlush(t *testing.T) {
+	cfg := config.Default()
+	proxyHandler, capture := newProxyWithServer(t, cfg)
+	sink := &indexUsageSink{upstream: proxyHandler.upstream, index: "es-tmnt-usage", timeout: usageFlushTimeout}
+	if err := sink.Flush(map[string]tenantUsage{"tenant1": {DocumentsIndexed: 5}}); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	path, _, body, method, _ := capture.snapshot()
+	if method != http.MethodPost || path != "/es-tmnt-usage/_bulk" {
+		t.Fatalf("unexpected request %s %s", method, path)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 2 || lines[0] != `{"index":{"_id":"tenant1"}}` {
+		t.Fatalf("unexpected bulk body: %s", body)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &doc); err != nil {
+		t.Fatalf("decode usage document: %v", err)
+	}
+	if doc["tenant"] != "tenant1" || doc["documents_indexed"] != float64(5) || doc["@timestamp"] == nil {
+		t.Fatalf("unexpected usage document: %s", lines[1])
+	}
+}
+
+func TestIndexUsageSinkFlushTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	proxyHandler := newProxyWithUpstream(t, config.Default(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(func() { close(release) })
+	sink := &indexUsageSink{upstream: proxyHandler.upstream, index: "es-tmnt-usage", timeout: 50 * time.Millisecond}
+	err := sink.Flush(map[string]tenantUsage{"tenant1": {Searches: 1}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestCloseFlushesUsage(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = "shared"
+	cfg.Usage.Sink = "file"
+	cfg.Usage.Path = filepath.Join(t.TempDir(), "usage.json")
+	cfg.Usage.FlushIntervalSeconds = 3600
+	proxyHandler := newProxyWithUpstream(t, cfg, jsonUpstream(http.StatusOK, `{}`))
+
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/products-tenant1/_search", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := proxyHandler.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := proxyHandler.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+	snapshot, err := (&fileUsageSink{path: cfg.Usage.Path}).load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if snapshot["tenant1"].Searches != 1 {
+		t.Fatalf("expected the search flushed on close, got %+v", snapshot)
+	}
+}
@@ -123,9 +123,9 @@ func TestPerTenantMode(t *testing.T) {
 	}
 	proxyURL := mustEnv(t, "PROXY_URL")
 	esURL := mustEnv(t, "ES_URL")
-	realIndex := mustEnv(t, "REAL_INDEX")
 	indexName := "orders"
 	tenant := "tenant2"
+	realIndex := renderAlias(t, mustEnv(t, "INDEX_TEMPLATE"), indexName, tenant)
 	logIndexMapping(t, indexName+"-"+tenant, realIndex)
 
 	cleanupIndex(t, esURL, realIndex)
@@ -160,9 +160,9 @@ func TestPerTenantModeUpdate(t *testing.T) {
 	}
 	proxyURL := mustEnv(t, "PROXY_URL")
 	esURL := mustEnv(t, "ES_URL")
-	realIndex := mustEnv(t, "REAL_INDEX")
 	indexName := "invoices"
 	tenant := "tenant4"
+	realIndex := renderAlias(t, mustEnv(t, "INDEX_TEMPLATE"), indexName, tenant)
 	logIndexMapping(t, indexName+"-"+tenant, realIndex)
 
 	cleanupIndex(t, esURL, realIndex)
@@ -0,0 +1,281 @@
+//go:build integration
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"es-tmnt/pkg/config"
+	"es-tmnt/pkg/proxy"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// The lifecycle tests run the proxy in process against a real Elasticsearch in
+// both tenancy modes and check that two tenants never see each other's
+// documents. Elasticsearch is started with testcontainers-go unless ES_URL
+// names a running cluster:
+//
+//	go test -tags integration ./tests -run TestLifecycle
+
+const (
+	elasticsearchImage = "docker.elastic.co/elasticsearch/elasticsearch:8.12.2"
+	elasticsearchReady = 3 * time.Minute
+	lifecycleIndex     = "lifecycle"
+)
+
+var (
+	elasticsearchOnce      sync.Once
+	elasticsearchURL       string
+	elasticsearchContainer testcontainers.Container
+	elasticsearchErr       error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if elasticsearchContainer != nil {
+		_ = elasticsearchContainer.Terminate(context.Background())
+	}
+	os.Exit(code)
+}
+
+func TestLifecycleSharedMode(t *testing.T) {
+	runLifecycle(t, "shared", []string{lifecycleIndex})
+}
+
+func TestLifecycleIndexPerTenantMode(t *testing.T) {
+	runLifecycle(t, "index-per-tenant", []string{lifecycleIndex + "-tenant1", lifecycleIndex + "-tenant2"})
+}
+
+// runLifecycle creates an index for two tenants through the proxy, fills it
+// with a bulk request, and searches, updates, and deletes by query as one
+// tenant, checking after every step that the other tenant's documents are
+// neither visible nor changed.
+func runLifecycle(t *testing.T, mode string, upstreamIndices []string) {
+	esURL := startElasticsearch(t)
+	for _, index := range upstreamIndices {
+		deleteIndex(t, esURL, index)
+	}
+	t.Cleanup(func() {
+		for _, index := range upstreamIndices {
+			deleteIndex(t, esURL, index)
+		}
+	})
+	proxyURL := startProxy(t, esURL, mode)
+	tenants := []string{"tenant1", "tenant2"}
+
+	for _, tenant := range tenants {
+		status, body := call(t, http.MethodPut, proxyURL+"/"+tenantIndex(tenant), "", nil)
+		if status != http.StatusOK {
+			t.Fatalf("create index for %s: %d %v", tenant, status, body)
+		}
+	}
+
+	for _, tenant := range tenants {
+		var bulk strings.Builder
+		for i, color := range []string{"red", "blue"} {
+			fmt.Fprintf(&bulk, "{\"index\":{\"_index\":%q,\"_id\":%q}}\n", tenantIndex(tenant), docID(tenant, i+1))
+			fmt.Fprintf(&bulk, "{\"color\":%q,\"owner\":%q}\n", color, tenant)
+		}
+		status, body := call(t, http.MethodPost, proxyURL+"/_bulk?refresh=true", bulk.String(), map[string]string{"Content-Type": "application/x-ndjson"})
+		if status != http.StatusOK || body["errors"] != false {
+			t.Fatalf("bulk for %s: %d %v", tenant, status, body)
+		}
+		items, _ := body["items"].([]interface{})
+		for _, item := range items {
+			for _, result := range item.(map[string]interface{}) {
+				if index := result.(map[string]interface{})["_index"]; index != tenantIndex(tenant) {
+					t.Fatalf("bulk item for %s reports index %v", tenant, index)
+				}
+			}
+		}
+	}
+
+	for _, tenant := range tenants {
+		assertOwnDocuments(t, proxyURL, tenant, 2)
+	}
+
+	status, _ := call(t, http.MethodGet, proxyURL+"/"+tenantIndex("tenant2")+"/_doc/"+docID("tenant1", 1), "", nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("expected tenant2 not to get a tenant1 document, got %d", status)
+	}
+
+	update := `{"doc":{"color":"green"}}`
+	status, body := call(t, http.MethodPost, proxyURL+"/"+tenantIndex("tenant1")+"/_update/"+docID("tenant1", 1)+"?refresh=true", update, nil)
+	if status != http.StatusOK {
+		t.Fatalf("update as tenant1: %d %v", status, body)
+	}
+	status, _ = call(t, http.MethodPost, proxyURL+"/"+tenantIndex("tenant2")+"/_update/"+docID("tenant1", 2)+"?refresh=true", update, nil)
+	if status < http.StatusBadRequest {
+		t.Fatalf("expected tenant2 not to update a tenant1 document, got %d", status)
+	}
+	status, body = call(t, http.MethodGet, proxyURL+"/"+tenantIndex("tenant1")+"/_doc/"+docID("tenant1", 2), "", nil)
+	if source, _ := body["_source"].(map[string]interface{}); status != http.StatusOK || source["color"] != "blue" {
+		t.Fatalf("expected the tenant1 document unchanged, got %d %v", status, body)
+	}
+
+	status, body = call(t, http.MethodPost, proxyURL+"/"+tenantIndex("tenant1")+"/_delete_by_query?refresh=true", `{"query":{"match_all":{}}}`, nil)
+	if status != http.StatusOK || body["deleted"] != float64(2) {
+		t.Fatalf("delete by query as tenant1: %d %v", status, body)
+	}
+	assertOwnDocuments(t, proxyURL, "tenant1", 0)
+	assertOwnDocuments(t, proxyURL, "tenant2", 2)
+
+	for tenant, want := range map[string]string{"tenant1": "0", "tenant2": "2"} {
+		var rows []map[string]string
+		catCall(t, proxyURL+"/_cat/count/"+tenantIndex(tenant)+"?format=json", &rows)
+		if len(rows) != 1 || rows[0]["count"] != want {
+			t.Fatalf("expected cat count %s for %s, got %v", want, tenant, rows)
+		}
+	}
+}
+
+// assertOwnDocuments searches as tenant and checks that exactly want documents
+// come back, all of them the tenant's own.
+func assertOwnDocuments(t *testing.T, proxyURL, tenant string, want int) {
+	t.Helper()
+	status, body := call(t, http.MethodPost, proxyURL+"/"+tenantIndex(tenant)+"/_search", `{"query":{"match_all":{}},"size":100}`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("search as %s: %d %v", tenant, status, body)
+	}
+	if total := hitsTotal(body); total != want {
+		t.Fatalf("expected %d documents for %s, got %d: %v", want, tenant, total, body)
+	}
+	hits, _ := body["hits"].(map[string]interface{})["hits"].([]interface{})
+	for _, hit := range hits {
+		doc := hit.(map[string]interface{})
+		source, _ := doc["_source"].(map[string]interface{})
+		if !strings.HasPrefix(doc["_id"].(string), tenant+"-") || source["owner"] != tenant {
+			t.Fatalf("search as %s returned another tenant's document %v", tenant, doc)
+		}
+	}
+}
+
+func tenantIndex(tenant string) string {
+	return lifecycleIndex + "-" + tenant
+}
+
+func docID(tenant string, n int) string {
+	return fmt.Sprintf("%s-%d", tenant, n)
+}
+
+// startProxy serves a proxy in mode for the upstream at esURL.
+func startProxy(t *testing.T, esURL, mode string) string {
+	t.Helper()
+	cfg := config.Default()
+	cfg.UpstreamURL = esURL
+	cfg.Mode = mode
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate config: %v", err)
+	}
+	if err := cfg.Compile(); err != nil {
+		t.Fatalf("compile config: %v", err)
+	}
+	handler, err := proxy.New(cfg)
+	if err != nil {
+		t.Fatalf("new proxy: %v", err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// startElasticsearch returns the URL of the cluster named by ES_URL, or starts
+// a single-node cluster shared by every test of the package.
+func startElasticsearch(t *testing.T) string {
+	t.Helper()
+	elasticsearchOnce.Do(func() {
+		if url := strings.TrimSpace(os.Getenv("ES_URL")); url != "" {
+			elasticsearchURL = url
+			return
+		}
+		ctx := context.Background()
+		elasticsearchContainer, elasticsearchErr = testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+			ContainerRequest: testcontainers.ContainerRequest{
+				Image:        elasticsearchImage,
+				ExposedPorts: []string{"9200/tcp"},
+				Env: map[string]string{
+					"discovery.type":         "single-node",
+					"xpack.security.enabled": "false",
+					"ES_JAVA_OPTS":           "-Xms512m -Xmx512m",
+				},
+				WaitingFor: wait.ForHTTP("/_cluster/health?wait_for_status=yellow&timeout=5s").
+					WithPort("9200/tcp").
+					WithStartupTimeout(elasticsearchReady),
+			},
+			Started: true,
+		})
+		if elasticsearchErr != nil {
+			elasticsearchErr = fmt.Errorf("start elasticsearch: %w", elasticsearchErr)
+			return
+		}
+		elasticsearchURL, elasticsearchErr = elasticsearchContainer.PortEndpoint(ctx, "9200/tcp", "http")
+		if elasticsearchErr != nil {
+			elasticsearchErr = fmt.Errorf("find elasticsearch port: %w", elasticsearchErr)
+		}
+	})
+	if elasticsearchErr != nil {
+		t.Fatalf("%v", elasticsearchErr)
+	}
+	return elasticsearchURL
+}
+
+func deleteIndex(t *testing.T, esURL, index string) {
+	t.Helper()
+	status, body := call(t, http.MethodDelete, esURL+"/"+index, "", nil)
+	if status != http.StatusOK && status != http.StatusNotFound {
+		t.Fatalf("delete index %s: %d %v", index, status, body)
+	}
+}
+
+// call sends a request and returns its status and decoded JSON body, leaving
+// error statuses for the caller to check.
+func call(t *testing.T, method, url, body string, header map[string]string) (int, responseBody) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read %s %s: %v", method, url, err)
+	}
+	var decoded responseBody
+	_ = json.Unmarshal(payload, &decoded)
+	return resp.StatusCode, decoded
+}
+
+func catCall(t *testing.T, url string, rows interface{}) {
+	t.Helper()
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(rows); err != nil {
+		t.Fatalf("decode %s: %v", url, err)
+	}
+}